@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/benchmark"
+)
+
+type benchmarkOptions struct {
+	registry       string
+	repository     string
+	tokenFile      string
+	caFile         string
+	blobSizeMiB    int64
+	blobs          int
+	concurrency    int
+	terminationLog string
+}
+
+// newBenchmarkCommand returns a command that measures the throughput and the
+// latency of the registry storage. It is run by the storage benchmark job
+// of the operator.
+func newBenchmarkCommand() *cobra.Command {
+	o := &benchmarkOptions{}
+	cmd := &cobra.Command{
+		Use:   "benchmark",
+		Short: "Measure the throughput and the latency of the registry storage",
+		Long: `Measure the throughput and the latency of the registry storage.
+
+Pushes random blobs to the registry, reads them back and deletes them, and
+prints the throughput and the latency percentiles of the writes and of the
+reads as JSON. The result is also written to the termination log, where the
+operator reads it.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.registry, "registry", "https://image-registry.openshift-image-registry.svc:5000", "Base URL of the registry")
+	cmd.Flags().StringVar(&o.repository, "repository", "openshift-image-registry/storage-benchmark", "Repository the blobs are pushed to")
+	cmd.Flags().StringVar(&o.tokenFile, "token-file", "/var/run/secrets/kubernetes.io/serviceaccount/token", "File with the token that authenticates the requests")
+	cmd.Flags().StringVar(&o.caFile, "ca-file", "", "File with the CA bundle that signs the certificate of the registry")
+	cmd.Flags().Int64Var(&o.blobSizeMiB, "blob-size-mib", 16, "Size of each blob in MiB")
+	cmd.Flags().IntVar(&o.blobs, "blobs", 16, "Number of blobs that are written and read")
+	cmd.Flags().IntVar(&o.concurrency, "concurrency", 4, "Number of blobs transferred at the same time")
+	cmd.Flags().StringVar(&o.terminationLog, "termination-log", "", "File the result is also written to")
+
+	return cmd
+}
+
+func (o *benchmarkOptions) client() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", o.caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (o *benchmarkOptions) run(ctx context.Context, out io.Writer) error {
+	token, err := os.ReadFile(o.tokenFile)
+	if err != nil {
+		return err
+	}
+	client, err := o.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := benchmark.Run(ctx, client, benchmark.Options{
+		Registry:    strings.TrimSuffix(o.registry, "/"),
+		Repository:  o.repository,
+		Token:       strings.TrimSpace(string(token)),
+		BlobSize:    o.blobSizeMiB * 1024 * 1024,
+		Blobs:       o.blobs,
+		Concurrency: o.concurrency,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(data))
+	if o.terminationLog != "" {
+		return os.WriteFile(o.terminationLog, data, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+	routeclient "github.com/openshift/client-go/route/clientset/versioned"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/doctor"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+type doctorOptions struct {
+	kubeconfig string
+	output     string
+}
+
+// newDoctorCommand returns a command that collects the health of the
+// registry in one report. It is meant to be run in the operator pod with
+// oc exec, where it has the credentials and the network of the operator.
+func newDoctorCommand() *cobra.Command {
+	o := &doctorOptions{}
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Collect the health of the image registry in one report",
+		Long: `Collect the health of the image registry in one report.
+
+Writes, reads and deletes an object in the storage, downloads a pre-signed
+URL of the storage, sends requests to the health endpoint of the registry
+through its service and its routes, checks the CA bundle the nodes trust for
+the registry and reports the last job of the image pruner. The command exits
+with a non-zero status when at least one check fails.
+
+Run it in the operator pod:
+
+    oc -n openshift-image-registry exec deploy/cluster-image-registry-operator -- cluster-image-registry-operator doctor`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "text", "Output format, one of: json, text")
+
+	return cmd
+}
+
+func (o *doctorOptions) run(ctx context.Context, out io.Writer) error {
+	if o.output != "json" && o.output != "text" {
+		return fmt.Errorf("unsupported output format %q", o.output)
+	}
+
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return err
+	}
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	configClient, err := configclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	routeClient, err := routeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
+	kubeInformersForOpenShiftConfigManaged := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0, kubeinformers.WithNamespace(defaults.OpenShiftConfigManagedNamespace))
+	configInformers := configinformers.NewSharedInformerFactory(configClient, 0)
+
+	secretInformer := kubeInformers.Core().V1().Secrets()
+	openshiftConfigInformer := kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps()
+	infrastructureInformer := configInformers.Config().V1().Infrastructures()
+	listers := client.NewStorageListers(
+		infrastructureInformer.Lister(),
+		openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+	)
+
+	for _, informers := range []interface{ Start(<-chan struct{}) }{kubeInformers, kubeInformersForOpenShiftConfig, kubeInformersForOpenShiftConfigManaged, configInformers} {
+		informers.Start(ctx.Done())
+	}
+	if !cache.WaitForCacheSync(ctx.Done(),
+		secretInformer.Informer().HasSynced,
+		openshiftConfigInformer.Informer().HasSynced,
+		openshiftConfigManagedInformer.Informer().HasSynced,
+		infrastructureInformer.Informer().HasSynced,
+	) {
+		return fmt.Errorf("unable to sync the caches")
+	}
+
+	featureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(nil, nil)
+	d := doctor.New(kubeClient, imageregistryClient, routeClient.RouteV1(), func(cr *imageregistryv1.Config) (storage.Driver, error) {
+		return resource.NewStorageDriver(cr, kubeconfig, listers, featureGateAccessor)
+	})
+	report, err := d.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch o.output {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	case "text":
+		for _, check := range report.Checks {
+			fmt.Fprintln(out, check.String())
+		}
+	}
+
+	if report.Failed() {
+		return fmt.Errorf("at least one check failed")
+	}
+	return nil
+}
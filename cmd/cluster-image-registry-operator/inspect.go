@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/inspect"
+)
+
+type inspectOptions struct {
+	kubeconfig string
+}
+
+// newInspectCommand returns a command that prints the inspection data of
+// the operator. It is run by must-gather in the operator pod.
+func newInspectCommand() *cobra.Command {
+	o := &inspectOptions{}
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Print the inspection data of the operator for must-gather",
+		Long: `Print the inspection data of the operator for must-gather.
+
+Prints as JSON the effective configuration of the registry, with the values
+of its secrets redacted, the state of the storage, the recent reconcile
+errors and the status of the node-ca daemon set.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster")
+
+	return cmd
+}
+
+func (o *inspectOptions) run(ctx context.Context, out io.Writer) error {
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return err
+	}
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	data, err := inspect.Collect(ctx, kubeClient, imageregistryClient)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
@@ -88,6 +88,11 @@ func main() {
 	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster")
 	cmd.Flags().StringArrayVar(&filesToWatch, "files", []string{}, "List of files to watch")
 
+	cmd.AddCommand(newValidateCommand())
+	cmd.AddCommand(newBenchmarkCommand())
+	cmd.AddCommand(newDoctorCommand())
+	cmd.AddCommand(newInspectCommand())
+
 	if err := cmd.Execute(); err != nil {
 		klog.Errorf("%v", err)
 		os.Exit(1)
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/validation"
+	"github.com/openshift/cluster-image-registry-operator/pkg/version"
+)
+
+type validateOptions struct {
+	filenames []string
+	output    string
+}
+
+// newValidateCommand returns a command that validates image registry
+// manifests offline, without connecting to a cluster. It is meant to be used
+// in CI pipelines that manage the registry configuration declaratively.
+func newValidateCommand() *cobra.Command {
+	o := &validateOptions{}
+	cmd := &cobra.Command{
+		Use:   "validate -f FILENAME...",
+		Short: "Validate image registry Config and ImagePruner manifests",
+		Long: `Validate image registry Config and ImagePruner manifests.
+
+Checks the configuration for the errors the operator runs into when it
+applies it, and for settings that are likely to cause problems at runtime,
+and prints the findings. The command exits with a non-zero
+status when at least one finding has the Error severity.
+
+The sarif output format produces a SARIF 2.1.0 log that can be uploaded to
+code scanning and compliance tools.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&o.filenames, "filename", "f", nil, "Files with the manifests to validate, - for stdin")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "json", "Output format, one of: json, sarif, text")
+	_ = cmd.MarkFlagRequired("filename")
+
+	return cmd
+}
+
+func (o *validateOptions) run(out io.Writer) error {
+	if o.output != "json" && o.output != "sarif" && o.output != "text" {
+		return fmt.Errorf("unsupported output format %q", o.output)
+	}
+
+	findings := validation.Findings{}
+	for _, filename := range o.filenames {
+		fs, err := validateFile(filename)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, fs...)
+	}
+
+	switch o.output {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Findings validation.Findings `json:"findings"`
+		}{findings}); err != nil {
+			return err
+		}
+	case "sarif":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings.SARIF(version.Version)); err != nil {
+			return err
+		}
+	case "text":
+		for _, f := range findings {
+			fmt.Fprintln(out, f.String())
+		}
+	}
+
+	if findings.HasErrors() {
+		return fmt.Errorf("validation failed")
+	}
+	return nil
+}
+
+func validateFile(filename string) (validation.Findings, error) {
+	if filename == "-" {
+		return validation.ValidateManifests(os.Stdin)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	findings, err := validation.ValidateManifests(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	for i := range findings {
+		findings[i].File = filename
+	}
+	return findings, nil
+}
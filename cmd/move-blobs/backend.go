@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	backendAzure = "azure"
+	backendS3    = "s3"
+	backendGCS   = "gcs"
+)
+
+// blobBackend is a storage backend whose blobs can be relocated.
+type blobBackend interface {
+	// listBlobs returns the blobs whose names start with prefix.
+	listBlobs(ctx context.Context, prefix string) ([]blobItem, error)
+
+	// moveBlobs moves the blobs from o.source to o.dest and returns the
+	// names of the moved source blobs.
+	moveBlobs(ctx context.Context, o *moveBlobOpts) ([]string, error)
+}
+
+// newBackend returns the backend selected by opts.backend, Azure if it is
+// not set.
+func newBackend(ctx context.Context, opts *configOpts) (blobBackend, error) {
+	switch opts.backend {
+	case backendS3:
+		store, err := newS3Store(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &objectStoreBackend{store: store}, nil
+	case backendGCS:
+		store, err := newGCSStore(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &objectStoreBackend{store: store}, nil
+	}
+	return newAzureBackend(opts)
+}
+
+// movePrefixes returns the prefix the blobs of backend are moved from and the
+// prefix they are moved to. On Azure the blobs are moved under /docker, where
+// the registry expects them. The S3 and GCS drivers of the registry store
+// their objects under docker/, the objects that were written under /docker
+// are moved there.
+func movePrefixes(backend string) (source, dest string) {
+	switch backend {
+	case backendS3, backendGCS:
+		return "/docker", "docker"
+	}
+	return "docker", "/docker"
+}
+
+// objectStore is an object storage whose objects are copied synchronously.
+type objectStore interface {
+	// list returns the objects whose names start with prefix.
+	list(ctx context.Context, prefix string) ([]blobItem, error)
+
+	// copy copies the object source to dest.
+	copy(ctx context.Context, source blobItem, dest string) error
+
+	// delete deletes the object name. Objects that do not exist are not
+	// an error.
+	delete(ctx context.Context, name string) error
+}
+
+// objectStoreBackend moves the objects of an objectStore.
+type objectStoreBackend struct {
+	store objectStore
+}
+
+func (b *objectStoreBackend) listBlobs(ctx context.Context, prefix string) ([]blobItem, error) {
+	return b.store.list(ctx, prefix)
+}
+
+// moveBlobs moves objects from o.source to o.dest.
+//
+// Like the Azure backend, it first copies the objects, then deletes the
+// successfully copied ones from o.source, so that an interrupted move can be
+// retried. Objects whose copy is recorded by o.checkpoint are not copied
+// again.
+func (b *objectStoreBackend) moveBlobs(ctx context.Context, o *moveBlobOpts) ([]string, error) {
+	sourceBlobs, err := b.store.list(ctx, o.source)
+	if err != nil {
+		return []string{}, err
+	}
+	klog.Infof("found %d blobs to move", len(sourceBlobs))
+
+	movedBlobs, errors := copyBlobs(ctx, sourceBlobs, o, func(ctx context.Context, sourceBlob blobItem) error {
+		destBlobName := strings.Replace(sourceBlob.name, o.source, o.dest, 1)
+		klog.Infof("copying %q to %q", sourceBlob.name, destBlobName)
+		return b.store.copy(ctx, sourceBlob, destBlobName)
+	})
+
+	// only delete source blobs we know have been copied
+	for _, blobName := range movedBlobs {
+		if err := b.store.delete(ctx, blobName); err != nil {
+			errors = append(errors, fmt.Errorf("failed deleting copied blob: %v", err))
+			continue
+		}
+		klog.Infof("deleted copied blob from source %q", blobName)
+	}
+
+	klog.Infof("moved %d blobs", len(movedBlobs))
+	if len(errors) > 0 {
+		return movedBlobs, fmt.Errorf("encountered errors when moving blobs: %v", errors)
+	}
+	return movedBlobs, nil
+}
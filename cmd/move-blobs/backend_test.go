@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeObjectStore is an in-memory objectStore.
+type fakeObjectStore struct {
+	mu         sync.Mutex
+	objects    map[string]int64
+	failCopies map[string]bool
+	// flakyCopies is the number of times the copy of a blob fails before
+	// it succeeds.
+	flakyCopies map[string]int
+	copies      []string
+	attempts    map[string]int
+}
+
+func (s *fakeObjectStore) list(ctx context.Context, prefix string) ([]blobItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blobs := []blobItem{}
+	for name, size := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			blobs = append(blobs, blobItem{name: name, size: size})
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].name < blobs[j].name })
+	return blobs, nil
+}
+
+func (s *fakeObjectStore) copy(ctx context.Context, source blobItem, dest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attempts == nil {
+		s.attempts = map[string]int{}
+	}
+	s.attempts[source.name]++
+	if s.failCopies[source.name] {
+		return fmt.Errorf("copy refused")
+	}
+	if s.attempts[source.name] <= s.flakyCopies[source.name] {
+		return fmt.Errorf("copy throttled")
+	}
+	s.copies = append(s.copies, source.name)
+	s.objects[dest] = source.size
+	return nil
+}
+
+func (s *fakeObjectStore) delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, name)
+	return nil
+}
+
+func TestObjectStoreBackendMoveBlobs(t *testing.T) {
+	store := &fakeObjectStore{
+		objects: map[string]int64{
+			"/docker/registry/v2/blobs/sha256/18/18ca/data": 1024,
+			"/docker/registry/v2/blobs/sha256/72/72c9/data": 2048,
+			"docker/registry/v2/blobs/sha256/fa/fa09/data":  4096,
+		},
+		failCopies: map[string]bool{
+			"/docker/registry/v2/blobs/sha256/72/72c9/data": true,
+		},
+	}
+	backend := &objectStoreBackend{store: store}
+
+	moved, err := backend.moveBlobs(context.Background(), &moveBlobOpts{source: "/docker", dest: "docker", concurrency: 1})
+	if err == nil {
+		t.Errorf("expected an error for the refused copy")
+	}
+	if expected := []string{"/docker/registry/v2/blobs/sha256/18/18ca/data"}; !reflect.DeepEqual(moved, expected) {
+		t.Errorf("expected moved blobs %v, got %v", expected, moved)
+	}
+
+	expected := map[string]int64{
+		// the blob that could not be copied is kept for a retry
+		"/docker/registry/v2/blobs/sha256/72/72c9/data": 2048,
+		"docker/registry/v2/blobs/sha256/18/18ca/data":  1024,
+		"docker/registry/v2/blobs/sha256/fa/fa09/data":  4096,
+	}
+	if !reflect.DeepEqual(store.objects, expected) {
+		t.Errorf("expected objects %v, got %v", expected, store.objects)
+	}
+}
+
+func TestObjectStoreBackendResumesFromCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	// the copy of 18ca completed, but the move was interrupted before the
+	// source blobs were deleted. The last line was cut short.
+	err := os.WriteFile(path, []byte("/docker/registry/v2/blobs/sha256/18/18ca/data\ndocker/registry/v2/blo"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeObjectStore{
+		objects: map[string]int64{
+			"/docker/registry/v2/blobs/sha256/18/18ca/data": 1024,
+			"docker/registry/v2/blobs/sha256/18/18ca/data":  1024,
+			"/docker/registry/v2/blobs/sha256/72/72c9/data": 2048,
+		},
+		failCopies: map[string]bool{
+			"/docker/registry/v2/blobs/sha256/72/72c9/data": true,
+		},
+	}
+	backend := &objectStoreBackend{store: store}
+
+	checkpoint, err := openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &moveBlobOpts{source: "/docker", dest: "docker", concurrency: 1, checkpoint: checkpoint}
+	if _, err := backend.moveBlobs(context.Background(), o); err == nil {
+		t.Fatal("expected an error for the refused copy")
+	}
+	if len(store.copies) != 0 {
+		t.Errorf("expected no copies, got %v", store.copies)
+	}
+	if err := checkpoint.close(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the retry only copies the remaining blob and records it.
+	store.failCopies = nil
+	checkpoint, err = openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.checkpoint = checkpoint
+	if _, err := backend.moveBlobs(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"/docker/registry/v2/blobs/sha256/72/72c9/data"}; !reflect.DeepEqual(store.copies, expected) {
+		t.Errorf("expected copies %v, got %v", expected, store.copies)
+	}
+	if !checkpoint.isCopied("/docker/registry/v2/blobs/sha256/72/72c9/data") {
+		t.Errorf("expected the copy of 72c9 to be recorded")
+	}
+
+	expected := map[string]int64{
+		"docker/registry/v2/blobs/sha256/18/18ca/data": 1024,
+		"docker/registry/v2/blobs/sha256/72/72c9/data": 2048,
+	}
+	if !reflect.DeepEqual(store.objects, expected) {
+		t.Errorf("expected objects %v, got %v", expected, store.objects)
+	}
+
+	// the checkpoint of a complete move is removed.
+	if err := checkpoint.close(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestObjectStoreBackendConcurrentCopies(t *testing.T) {
+	store := &fakeObjectStore{
+		objects: map[string]int64{},
+		failCopies: map[string]bool{
+			"/docker/registry/v2/blobs/sha256/00/0003/data": true,
+		},
+		flakyCopies: map[string]int{
+			"/docker/registry/v2/blobs/sha256/00/0005/data": 2,
+		},
+	}
+	expectedMoved := []string{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("/docker/registry/v2/blobs/sha256/00/%04d/data", i)
+		store.objects[name] = int64(i)
+		if i != 3 {
+			expectedMoved = append(expectedMoved, name)
+		}
+	}
+	backend := &objectStoreBackend{store: store}
+
+	moved, err := backend.moveBlobs(context.Background(), &moveBlobOpts{
+		source:      "/docker",
+		dest:        "docker",
+		concurrency: 4,
+		retries:     2,
+		retryDelay:  time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "0003") {
+		t.Errorf("expected an error for the refused copy of 0003, got %v", err)
+	}
+	// the moved blobs are listed in the order of the source blobs, the
+	// flaky copy succeeded on its last attempt.
+	if !reflect.DeepEqual(moved, expectedMoved) {
+		t.Errorf("expected moved blobs %v, got %v", expectedMoved, moved)
+	}
+	for name, attempts := range map[string]int{
+		"/docker/registry/v2/blobs/sha256/00/0003/data": 3,
+		"/docker/registry/v2/blobs/sha256/00/0005/data": 3,
+		"/docker/registry/v2/blobs/sha256/00/0007/data": 1,
+	} {
+		if store.attempts[name] != attempts {
+			t.Errorf("expected %d copy attempts of %s, got %d", attempts, name, store.attempts[name])
+		}
+	}
+	if _, ok := store.objects["/docker/registry/v2/blobs/sha256/00/0003/data"]; !ok {
+		t.Errorf("expected the blob that could not be copied to be kept")
+	}
+	if len(store.objects) != 20 {
+		t.Errorf("expected 19 moved blobs and 1 source blob, got %d objects", len(store.objects))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// defaultProgressInterval is the default interval between two progress
+// reports.
+const defaultProgressInterval = time.Minute
+
+// moveCheckpoint records the source blobs whose copy has completed, so that a
+// restarted move only deletes them instead of copying them again.
+//
+// The checkpoint file has one source blob name per line. Names are appended
+// as the copies complete, an interrupted write leaves at most a truncated
+// last line, which does not match any blob. It is safe for concurrent use.
+type moveCheckpoint struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	copied map[string]bool
+}
+
+// openCheckpoint loads the checkpoint file path, which is created if it does
+// not exist.
+func openCheckpoint(path string) (*moveCheckpoint, error) {
+	c := &moveCheckpoint{
+		path:   path,
+		copied: map[string]bool{},
+	}
+
+	f, err := os.Open(path)
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if name := scanner.Text(); len(name) > 0 {
+				c.copied[name] = true
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(c.copied) > 0 {
+		klog.Infof("checkpoint %s: %d blobs have already been copied", path, len(c.copied))
+	}
+
+	c.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// isCopied returns whether the copy of the source blob name has completed.
+// A nil checkpoint has no copied blobs.
+func (c *moveCheckpoint) isCopied(name string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.copied[name]
+}
+
+// markCopied records that the copy of the source blob name has completed.
+func (c *moveCheckpoint) markCopied(name string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.copied[name] {
+		return nil
+	}
+	if _, err := c.file.WriteString(name + "\n"); err != nil {
+		return err
+	}
+	c.copied[name] = true
+	return nil
+}
+
+// recordCopy records the copy of the source blob name in checkpoint. The move
+// does not fail when the checkpoint cannot be written, the blob is only
+// copied again after a restart.
+func recordCopy(checkpoint *moveCheckpoint, name string) {
+	if err := checkpoint.markCopied(name); err != nil {
+		klog.Warningf("unable to record the copy of %q in the checkpoint: %v", name, err)
+	}
+}
+
+// close closes the checkpoint file. When the move is complete, the file is
+// removed, so that a later move starts afresh.
+func (c *moveCheckpoint) close(complete bool) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	if complete {
+		return os.Remove(c.path)
+	}
+	return nil
+}
+
+// moveProgress periodically logs the progress of a move. It is safe for
+// concurrent use.
+type moveProgress struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	lastReport time.Time
+
+	totalBlobs   int
+	totalBytes   int64
+	doneBlobs    int
+	doneBytes    int64
+	resumedBlobs int
+}
+
+func newMoveProgress(blobs []blobItem, interval time.Duration) *moveProgress {
+	p := &moveProgress{
+		interval:   interval,
+		lastReport: time.Now(),
+		totalBlobs: len(blobs),
+	}
+	for _, b := range blobs {
+		p.totalBytes += b.size
+	}
+	return p
+}
+
+// copied accounts the copied blob b, resumed is true when its copy was
+// recorded by the checkpoint.
+func (p *moveProgress) copied(b blobItem, resumed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.doneBlobs++
+	p.doneBytes += b.size
+	if resumed {
+		p.resumedBlobs++
+	}
+	if p.interval > 0 && time.Since(p.lastReport) >= p.interval {
+		p.log()
+	}
+}
+
+// report logs the progress.
+func (p *moveProgress) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log()
+}
+
+func (p *moveProgress) log() {
+	p.lastReport = time.Now()
+	klog.Infof(
+		"copied %d/%d blobs (%d/%d bytes), %d of them from the checkpoint",
+		p.doneBlobs, p.totalBlobs, p.doneBytes, p.totalBytes, p.resumedBlobs,
+	)
+}
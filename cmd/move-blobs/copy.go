@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultConcurrency = 1
+	defaultRetries     = 3
+	defaultRetryDelay  = time.Second
+)
+
+// copyFunc copies the source blob to its destination.
+type copyFunc func(ctx context.Context, source blobItem) error
+
+// copyBlobs copies blobs with copy, up to o.concurrency at a time. A failed
+// copy is retried up to o.retries times, with an exponential backoff starting
+// at o.retryDelay. Blobs whose copy is recorded by o.checkpoint are not copied
+// again.
+//
+// It returns the names of the copied blobs, in the order of blobs, and the
+// errors of the copies that failed.
+func copyBlobs(ctx context.Context, blobs []blobItem, o *moveBlobOpts, copy copyFunc) ([]string, []error) {
+	progress := newMoveProgress(blobs, o.progressInterval)
+
+	copied := make([]bool, len(blobs))
+	errs := make([]error, len(blobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < o.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				sourceBlob := blobs[i]
+				if o.checkpoint.isCopied(sourceBlob.name) {
+					klog.V(3).Infof("blob %q has already been copied", sourceBlob.name)
+					copied[i] = true
+					progress.copied(sourceBlob, true)
+					continue
+				}
+				if err := copyWithRetries(ctx, sourceBlob, o, copy); err != nil {
+					errs[i] = fmt.Errorf("failed to copy blob %q: %v", sourceBlob.name, err)
+					continue
+				}
+				copied[i] = true
+				recordCopy(o.checkpoint, sourceBlob.name)
+				progress.copied(sourceBlob, false)
+			}
+		}()
+	}
+	for i := range blobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	progress.report()
+
+	copiedBlobs := []string{}
+	errors := []error{}
+	for i, sourceBlob := range blobs {
+		if copied[i] {
+			copiedBlobs = append(copiedBlobs, sourceBlob.name)
+		}
+		if errs[i] != nil {
+			errors = append(errors, errs[i])
+		}
+	}
+	return copiedBlobs, errors
+}
+
+// copyWithRetries copies sourceBlob with copy, retrying up to o.retries times.
+func copyWithRetries(ctx context.Context, sourceBlob blobItem, o *moveBlobOpts, copy copyFunc) error {
+	delay := o.retryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		err := copy(ctx, sourceBlob)
+		if err == nil || attempt >= o.retries {
+			return err
+		}
+		klog.Warningf("copy of blob %q failed, retrying in %s: %v", sourceBlob.name, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	goption "google.golang.org/api/option"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/clientconfig"
+)
+
+// gcsStore is the objectStore of a GCS bucket.
+type gcsStore struct {
+	client *gstorage.Client
+	bucket string
+}
+
+// newGCSStore returns the store of the bucket opts.gcsBucket. Like the
+// operator, it uses the key file (or the workload identity federation
+// configuration) opts.gcsKeyfile, the application default credentials if it
+// is not set.
+func newGCSStore(ctx context.Context, opts *configOpts) (*gcsStore, error) {
+	var clientOpts []goption.ClientOption
+	if len(opts.gcsKeyfile) > 0 {
+		keyfileData, err := os.ReadFile(opts.gcsKeyfile)
+		if err != nil {
+			return nil, err
+		}
+		credentials, err := clientconfig.GCSCredentials(ctx, keyfileData)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, credentials)
+	}
+
+	client, err := gstorage.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsStore{
+		client: client,
+		bucket: opts.gcsBucket,
+	}, nil
+}
+
+func (s *gcsStore) list(ctx context.Context, prefix string) ([]blobItem, error) {
+	blobs := []blobItem{}
+	it := s.client.Bucket(s.bucket).Objects(ctx, &gstorage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return blobs, nil
+		}
+		if err != nil {
+			return []blobItem{}, err
+		}
+		blobs = append(blobs, blobItem{name: attrs.Name, size: attrs.Size})
+	}
+}
+
+func (s *gcsStore) copy(ctx context.Context, source blobItem, dest string) error {
+	bucket := s.client.Bucket(s.bucket)
+	// the copier rewrites large objects in several calls, it returns once
+	// the whole object is copied.
+	_, err := bucket.Object(dest).CopierFrom(bucket.Object(source.name)).Run(ctx)
+	return err
+}
+
+func (s *gcsStore) delete(ctx context.Context, name string) error {
+	err := s.client.Bucket(s.bucket).Object(name).Delete(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,10 +26,61 @@ import (
 
 func main() {
 	opts := getConfigOpts()
+	flag.BoolVar(&opts.dryRun, "dry-run", opts.dryRun, "list the blobs that would be moved without moving them (MOVE_BLOBS_DRY_RUN)")
+	flag.StringVar(&opts.planFile, "plan", opts.planFile, "file the dry-run plan is written to, standard output if empty (MOVE_BLOBS_PLAN_FILE)")
+	flag.StringVar(&opts.checkpointFile, "checkpoint", opts.checkpointFile, "file the completed copies are recorded in, so that a restarted move skips them (MOVE_BLOBS_CHECKPOINT_FILE)")
+	flag.DurationVar(&opts.progressInterval, "progress-interval", opts.progressInterval, "interval between two progress reports (MOVE_BLOBS_PROGRESS_INTERVAL)")
+	flag.IntVar(&opts.concurrency, "concurrency", opts.concurrency, "number of blobs copied at the same time (MOVE_BLOBS_CONCURRENCY)")
+	flag.IntVar(&opts.retries, "retries", opts.retries, "number of times a failed copy is retried (MOVE_BLOBS_RETRIES)")
+	flag.Parse()
+
 	if err := validate(opts); err != nil {
 		log.Fatal(err)
 	}
 
+	ctx := context.Background()
+	backend, err := newBackend(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	moveOpts := &moveBlobOpts{}
+	moveOpts.source, moveOpts.dest = movePrefixes(opts.backend)
+	if opts.dryRun {
+		plan, err := planMoveBlobs(ctx, backend, moveOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writePlan(plan, opts.planFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	moveOpts.progressInterval = opts.progressInterval
+	moveOpts.concurrency = opts.concurrency
+	moveOpts.retries = opts.retries
+	moveOpts.retryDelay = defaultRetryDelay
+	if len(opts.checkpointFile) > 0 {
+		moveOpts.checkpoint, err = openCheckpoint(opts.checkpointFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	_, err = backend.moveBlobs(ctx, moveOpts)
+	if cerr := moveOpts.checkpoint.close(err == nil); cerr != nil {
+		klog.Warningf("unable to close the checkpoint: %v", cerr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// azureBackend moves the blobs of an Azure Blob Storage container.
+type azureBackend struct {
+	client *container.Client
+}
+
+// newAzureBackend returns the backend of the container opts.containerName.
+func newAzureBackend(opts *configOpts) (*azureBackend, error) {
 	// if the environment specific configs are not given, assume
 	//  AzurePublicCloud as it's probably the most common choice anyway.
 	if len(opts.environment) == 0 {
@@ -33,31 +88,45 @@ func main() {
 	}
 
 	if err := createASHEnvironmentFile(opts); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	cloudConfig, err := getCloudConfig(opts.environment)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	client, err := getClient(cloudConfig, opts)
 	if err != nil {
-		log.Fatal(err)
-	}
-	ctx := context.Background()
-	_, err = moveBlobs(ctx, client, &moveBlobOpts{
-		source: "docker",
-		dest:   "/docker",
-	})
-	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return &azureBackend{client: client}, nil
+}
+
+func (b *azureBackend) listBlobs(ctx context.Context, prefix string) ([]blobItem, error) {
+	return listBlobItems(ctx, b.client, prefix)
+}
+
+func (b *azureBackend) moveBlobs(ctx context.Context, o *moveBlobOpts) ([]string, error) {
+	return moveBlobs(ctx, b.client, o)
 }
 
 type moveBlobOpts struct {
 	source string
 	dest   string
+
+	// checkpoint records the completed copies, it is optional.
+	checkpoint *moveCheckpoint
+	// progressInterval is the interval between two progress reports,
+	// progress is not reported if it is zero.
+	progressInterval time.Duration
+
+	// concurrency is the number of blobs copied at the same time.
+	concurrency int
+	// retries is the number of times a failed copy is retried, the first
+	// retry happens after retryDelay, which doubles for each retry.
+	retries    int
+	retryDelay time.Duration
 }
 
 // moveBlobs moves blobs from o.source to o.dest.
@@ -65,12 +134,13 @@ type moveBlobOpts struct {
 // moveBlobs will first copy blobs from o.source to o.dest, then delete the
 // successfully copied blobs from o.source.
 // If o.source has a lot of blobs, this function could take a while to finish.
+// Blobs whose copy is recorded by o.checkpoint are not copied again.
 func moveBlobs(
 	ctx context.Context,
 	containerClient *container.Client,
 	o *moveBlobOpts,
 ) ([]string, error) {
-	sourceBlobs, err := listBlobs(ctx, containerClient, o.source)
+	sourceBlobs, err := listBlobItems(ctx, containerClient, o.source)
 	if err != nil {
 		return []string{}, err
 	}
@@ -79,92 +149,9 @@ func moveBlobs(
 	// we gather errors so that when they happen we still have a shot
 	// of copying some blobs into the destination, which allows for
 	// incremental retries on error.
-	errors := []error{}
-	copiesToWaitFor := map[string]blob.CopyStatusType{}
-	movedBlobs := []string{}
-
-	for _, sourceBlobName := range sourceBlobs {
-		// rename the source blob to match the destination.
-		// we're dealing with virtual paths(dirs) here, so the path
-		// is part of the blob name.
-		destBlobName := strings.Replace(sourceBlobName, o.source, o.dest, 1)
-
-		klog.V(3).Infof("transforced source blob name from %q into %q", sourceBlobName, destBlobName)
-
-		// the blob client represents the destination blob, so we use
-		// blob renamed to match the destination.
-		blobClient := containerClient.NewBlobClient(destBlobName)
-
-		// the source blob has to be on the same container as the
-		// destination blob for this to work.
-		// it's name MUST be escaped.
-		// we also ensure there's a "/" separating the URL from the
-		// source blob name so the container name doesn't get mixed up
-		// with the source blob name.
-		sourceBlobURL := strings.TrimRight(containerClient.URL(), "/") + "/" + url.QueryEscape(sourceBlobName)
-
-		// counter-intuitively, this copy uses the blob which this client
-		// is created for as the destination, and the source is given in
-		// the call to StartCopyFromURL.
-		klog.Infof("starting copy of %q", sourceBlobName)
-		resp, err := blobClient.StartCopyFromURL(ctx, sourceBlobURL, nil)
-		if err != nil {
-			errors = append(errors, fmt.Errorf("failed to start copy: %v", err))
-			continue
-		}
-
-		switch *resp.CopyStatus {
-		case blob.CopyStatusTypeSuccess:
-			klog.Infof("copy finished instantly for blob %q", sourceBlobName)
-			movedBlobs = append(movedBlobs, sourceBlobName)
-		case blob.CopyStatusTypeAborted, blob.CopyStatusTypeFailed:
-			klog.Warningf("copy failed failed for blob %q, moving on", sourceBlobName)
-			errors = append(errors,
-				fmt.Errorf("copy failed with status %q for blob %q", *resp.CopyStatus, sourceBlobName))
-			// leave retry up to the client. in the image-registry case, the k8s job
-			// will handle retrying after failures.
-		case blob.CopyStatusTypePending:
-			klog.Infof("copy is pending for blob %q, adding to list of copies to wait for", sourceBlobName)
-			copiesToWaitFor[destBlobName] = *resp.CopyStatus
-		}
-	}
-
-	// this code is very difficult to exercise. none of my attempts to
-	// force an asynchronous copy worked, no matter how big the source file
-	// was. I was forced to manipulate the code in a way that exercised
-	// loop a few times to ensure it worked.
-	for blobName, copyStatus := range copiesToWaitFor {
-		blobClient := containerClient.NewBlobClient(blobName)
-		for copyStatus == blob.CopyStatusTypePending {
-			props, err := blobClient.GetProperties(ctx, nil)
-			if err != nil {
-				errors = append(errors, err)
-				continue
-			}
-			copyStatus = *props.CopyStatus
-			if copyStatus == blob.CopyStatusTypeAborted || copyStatus == blob.CopyStatusTypeFailed {
-				err := fmt.Errorf("copy failed, status: %q, blob: %q", *props.CopyStatus, blobName)
-				if props.CopyStatusDescription != nil {
-					err = fmt.Errorf(
-						"copy failed, status: %q, desc: %q, blob: %q",
-						copyStatus,
-						*props.CopyStatusDescription,
-						blobName,
-					)
-				}
-				errors = append(errors, err)
-				continue
-			}
-			if copyStatus == blob.CopyStatusTypePending {
-				// copy still pending - wait an arbitraty amount of time before trying again
-				klog.Infof("waiting 100ms before re-checking copy status for blob %q", blobName)
-				time.Sleep(100 * time.Millisecond)
-			}
-		}
-		sourceBlobName := strings.Replace(blobName, o.dest, o.source, 1)
-		klog.V(3).Infof("adding blob to moved blobs list: %q", sourceBlobName)
-		movedBlobs = append(movedBlobs, sourceBlobName)
-	}
+	movedBlobs, errors := copyBlobs(ctx, sourceBlobs, o, func(ctx context.Context, sourceBlob blobItem) error {
+		return copyBlob(ctx, containerClient, sourceBlob.name, o)
+	})
 
 	// only delete source blobs we know have been moved
 	for _, blobName := range movedBlobs {
@@ -183,31 +170,174 @@ func moveBlobs(
 	return movedBlobs, nil
 }
 
-func listBlobs(
+// copyBlob copies the blob sourceBlobName from o.source to o.dest and waits
+// for the copy to complete.
+func copyBlob(
+	ctx context.Context,
+	containerClient *container.Client,
+	sourceBlobName string,
+	o *moveBlobOpts,
+) error {
+	// rename the source blob to match the destination.
+	// we're dealing with virtual paths(dirs) here, so the path
+	// is part of the blob name.
+	destBlobName := strings.Replace(sourceBlobName, o.source, o.dest, 1)
+
+	klog.V(3).Infof("transforced source blob name from %q into %q", sourceBlobName, destBlobName)
+
+	// the blob client represents the destination blob, so we use
+	// blob renamed to match the destination.
+	blobClient := containerClient.NewBlobClient(destBlobName)
+
+	// the source blob has to be on the same container as the
+	// destination blob for this to work.
+	// it's name MUST be escaped.
+	// we also ensure there's a "/" separating the URL from the
+	// source blob name so the container name doesn't get mixed up
+	// with the source blob name.
+	sourceBlobURL := strings.TrimRight(containerClient.URL(), "/") + "/" + url.QueryEscape(sourceBlobName)
+
+	// counter-intuitively, this copy uses the blob which this client
+	// is created for as the destination, and the source is given in
+	// the call to StartCopyFromURL.
+	klog.Infof("starting copy of %q", sourceBlobName)
+	resp, err := blobClient.StartCopyFromURL(ctx, sourceBlobURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start copy: %v", err)
+	}
+
+	// large copies may complete asynchronously, in which case we poll
+	// the destination blob until the copy is done.
+	copyStatus := *resp.CopyStatus
+	var copyStatusDescription *string
+	for copyStatus == blob.CopyStatusTypePending {
+		// copy still pending - wait an arbitraty amount of time before trying again
+		klog.Infof("waiting 100ms before re-checking copy status for blob %q", destBlobName)
+		time.Sleep(100 * time.Millisecond)
+		props, err := blobClient.GetProperties(ctx, nil)
+		if err != nil {
+			return err
+		}
+		copyStatus = *props.CopyStatus
+		copyStatusDescription = props.CopyStatusDescription
+	}
+
+	if copyStatus != blob.CopyStatusTypeSuccess {
+		// leave retry up to the client. in the image-registry case, the k8s job
+		// will handle retrying after failures.
+		if copyStatusDescription != nil {
+			return fmt.Errorf("copy failed, status: %q, desc: %q, blob: %q", copyStatus, *copyStatusDescription, sourceBlobName)
+		}
+		return fmt.Errorf("copy failed with status %q for blob %q", copyStatus, sourceBlobName)
+	}
+	klog.Infof("copy finished for blob %q", sourceBlobName)
+	return nil
+}
+
+// plannedBlob is a blob that would be moved by moveBlobs.
+type plannedBlob struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// movePlan lists the blobs that would be moved by moveBlobs. It is the
+// output of the dry-run mode.
+type movePlan struct {
+	Source     string        `json:"source"`
+	Dest       string        `json:"dest"`
+	BlobCount  int           `json:"blobCount"`
+	TotalBytes int64         `json:"totalBytes"`
+	Blobs      []plannedBlob `json:"blobs"`
+}
+
+// newMovePlan returns the plan for moving blobs from o.source to o.dest.
+func newMovePlan(blobs []blobItem, o *moveBlobOpts) *movePlan {
+	plan := &movePlan{
+		Source: o.source,
+		Dest:   o.dest,
+		Blobs:  []plannedBlob{},
+	}
+	for _, b := range blobs {
+		plan.Blobs = append(plan.Blobs, plannedBlob{
+			Source: b.name,
+			Dest:   strings.Replace(b.name, o.source, o.dest, 1),
+			Bytes:  b.size,
+		})
+		plan.TotalBytes += b.size
+	}
+	plan.BlobCount = len(plan.Blobs)
+	return plan
+}
+
+// planMoveBlobs lists the blobs that moveBlobs would move from o.source to
+// o.dest, without modifying the container.
+func planMoveBlobs(
+	ctx context.Context,
+	backend blobBackend,
+	o *moveBlobOpts,
+) (*movePlan, error) {
+	blobs, err := backend.listBlobs(ctx, o.source)
+	if err != nil {
+		return nil, err
+	}
+	plan := newMovePlan(blobs, o)
+	klog.Infof("dry run: %d blobs (%d bytes) would be moved from %q to %q", plan.BlobCount, plan.TotalBytes, o.source, o.dest)
+	return plan, nil
+}
+
+// writePlan writes plan as JSON to path, or to the standard output if path is
+// empty.
+func writePlan(plan *movePlan, path string) error {
+	var w io.Writer = os.Stdout
+	if len(path) > 0 {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
+
+// blobItem is a listed blob.
+type blobItem struct {
+	name string
+	size int64
+}
+
+func listBlobItems(
 	ctx context.Context,
 	containerClient *container.Client,
 	prefix string,
-) ([]string, error) {
-	blobs := []string{}
+) ([]blobItem, error) {
+	blobs := []blobItem{}
 	pager := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
 		Prefix: &prefix,
 	})
 	for pager.More() {
 		resp, err := pager.NextPage(ctx)
 		if err != nil {
-			return []string{}, err
+			return []blobItem{}, err
 		}
 		if resp.Segment == nil {
-			return []string{}, fmt.Errorf("response has no segments")
+			return []blobItem{}, fmt.Errorf("response has no segments")
 		}
 		for _, blob := range resp.Segment.BlobItems {
 			if blob.Name == nil {
-				return []string{}, fmt.Errorf(
+				return []blobItem{}, fmt.Errorf(
 					"required blob property Name is missing while listing blobs under: %s",
 					prefix,
 				)
 			}
-			blobs = append(blobs, *blob.Name)
+			item := blobItem{name: *blob.Name}
+			if blob.Properties != nil && blob.Properties.ContentLength != nil {
+				item.size = *blob.Properties.ContentLength
+			}
+			blobs = append(blobs, item)
 
 		}
 	}
@@ -215,6 +345,9 @@ func listBlobs(
 }
 
 type configOpts struct {
+	// backend is the storage backend, azure (the default), s3 or gcs.
+	backend string
+
 	storageAccountName string
 	containerName      string
 	clientID           string
@@ -227,6 +360,30 @@ type configOpts struct {
 	// for Azure Stack Hub
 	environmentFilePath     string
 	environmentFileContents string
+
+	s3Bucket             string
+	s3Region             string
+	s3RegionEndpoint     string
+	s3VirtualHostedStyle bool
+
+	gcsBucket  string
+	gcsKeyfile string
+
+	// dryRun lists the blobs that would be moved instead of moving them,
+	// the plan is written to planFile.
+	dryRun   bool
+	planFile string
+
+	// checkpointFile records the completed copies, it should be on a
+	// volume that outlives the pod.
+	checkpointFile string
+	// progressInterval is the interval between two progress reports.
+	progressInterval time.Duration
+
+	// concurrency is the number of blobs copied at the same time, and
+	// retries the number of times a failed copy is retried.
+	concurrency int
+	retries     int
 }
 
 func createASHEnvironmentFile(opts *configOpts) error {
@@ -271,6 +428,7 @@ func getCloudConfig(environment string) (cloud.Configuration, error) {
 
 func getConfigOpts() *configOpts {
 	return &configOpts{
+		backend:                 strings.ToLower(strings.TrimSpace(os.Getenv("MOVE_BLOBS_BACKEND"))),
 		storageAccountName:      strings.TrimSpace(os.Getenv("AZURE_STORAGE_ACCOUNT_NAME")),
 		containerName:           strings.TrimSpace(os.Getenv("AZURE_CONTAINER_NAME")),
 		clientID:                strings.TrimSpace(os.Getenv("AZURE_CLIENT_ID")),
@@ -281,9 +439,46 @@ func getConfigOpts() *configOpts {
 		environment:             strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT")),
 		environmentFilePath:     strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT_FILEPATH")),
 		environmentFileContents: strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT_FILECONTENTS")),
+		s3Bucket:                strings.TrimSpace(os.Getenv("S3_BUCKET")),
+		s3Region:                strings.TrimSpace(os.Getenv("S3_REGION")),
+		s3RegionEndpoint:        strings.TrimSpace(os.Getenv("S3_REGION_ENDPOINT")),
+		s3VirtualHostedStyle:    parseBool(os.Getenv("S3_VIRTUAL_HOSTED_STYLE")),
+		gcsBucket:               strings.TrimSpace(os.Getenv("GCS_BUCKET")),
+		gcsKeyfile:              strings.TrimSpace(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")),
+		dryRun:                  parseBool(os.Getenv("MOVE_BLOBS_DRY_RUN")),
+		planFile:                strings.TrimSpace(os.Getenv("MOVE_BLOBS_PLAN_FILE")),
+		checkpointFile:          strings.TrimSpace(os.Getenv("MOVE_BLOBS_CHECKPOINT_FILE")),
+		progressInterval:        parseDuration(os.Getenv("MOVE_BLOBS_PROGRESS_INTERVAL"), defaultProgressInterval),
+		concurrency:             parseInt(os.Getenv("MOVE_BLOBS_CONCURRENCY"), defaultConcurrency),
+		retries:                 parseInt(os.Getenv("MOVE_BLOBS_RETRIES"), defaultRetries),
 	}
 }
 
+// parseDuration returns the duration s, or def if s is empty or invalid.
+func parseDuration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// parseInt returns the integer s, or def if s is empty or invalid.
+func parseInt(s string, def int) int {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+// parseBool returns whether s is a true boolean value, invalid values are
+// false.
+func parseBool(s string) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(s))
+	return b
+}
+
 // getCreds build credentials from the given parameters.
 //
 // this function is basically copy of what the operator itself does,
@@ -364,6 +559,32 @@ func getClient(cloudConfig cloud.Configuration, opts *configOpts) (*container.Cl
 
 // validate returns an error when the required options are missing.
 func validate(opts *configOpts) error {
+	if opts.concurrency < 1 {
+		return fmt.Errorf("MOVE_BLOBS_CONCURRENCY must be at least 1, got %d", opts.concurrency)
+	}
+	if opts.retries < 0 {
+		return fmt.Errorf("MOVE_BLOBS_RETRIES must not be negative, got %d", opts.retries)
+	}
+	switch opts.backend {
+	case "", backendAzure:
+		return validateAzure(opts)
+	case backendS3:
+		if len(opts.s3Bucket) == 0 {
+			return fmt.Errorf("S3_BUCKET is required")
+		}
+		return nil
+	case backendGCS:
+		if len(opts.gcsBucket) == 0 {
+			return fmt.Errorf("GCS_BUCKET is required")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported MOVE_BLOBS_BACKEND %q, must be one of %s, %s or %s", opts.backend, backendAzure, backendS3, backendGCS)
+}
+
+// validateAzure returns an error when the required Azure options are
+// missing.
+func validateAzure(opts *configOpts) error {
 	if len(opts.clientSecret) == 0 && len(opts.federatedTokenFile) == 0 && len(opts.accountKey) == 0 {
 		return fmt.Errorf("One of AZURE_CLIENT_SECRET or AZURE_FEDERATED_TOKEN_FILE or AZURE_ACCOUNTKEY is required for authentication")
 	}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -89,8 +92,9 @@ func TestMoveBlobs(t *testing.T) {
 		ctx,
 		containerClient,
 		&moveBlobOpts{
-			source: "docker",
-			dest:   "/docker",
+			source:      "docker",
+			dest:        "/docker",
+			concurrency: 1,
 		},
 	)
 	if err != nil {
@@ -152,6 +156,7 @@ func TestValidation(t *testing.T) {
 			name:        "valid with federated token file",
 			expectError: false,
 			opts: &configOpts{
+				concurrency:        1,
 				storageAccountName: "teststorageaccount",
 				containerName:      "test-container",
 				clientID:           "test-client-id",
@@ -164,6 +169,7 @@ func TestValidation(t *testing.T) {
 			name:        "valid with client secret",
 			expectError: false,
 			opts: &configOpts{
+				concurrency:        1,
 				storageAccountName: "teststorageaccount",
 				containerName:      "test-container",
 				clientID:           "test-client-id",
@@ -220,6 +226,71 @@ func TestValidation(t *testing.T) {
 				federatedTokenFile: "",
 			},
 		},
+		{
+			name:        "valid s3",
+			expectError: false,
+			opts: &configOpts{
+				concurrency: 1,
+				backend:     backendS3,
+				s3Bucket:    "test-bucket",
+			},
+		},
+		{
+			name:        "invalid: no s3 bucket",
+			expectError: true,
+			opts: &configOpts{
+				backend: backendS3,
+			},
+		},
+		{
+			name:        "valid gcs",
+			expectError: false,
+			opts: &configOpts{
+				concurrency: 1,
+				backend:     backendGCS,
+				gcsBucket:   "test-bucket",
+			},
+		},
+		{
+			name:        "invalid: no gcs bucket",
+			expectError: true,
+			opts: &configOpts{
+				backend: backendGCS,
+			},
+		},
+		{
+			name:        "invalid: unsupported backend",
+			expectError: true,
+			opts: &configOpts{
+				backend: "swift",
+			},
+		},
+		{
+			name:        "invalid: no concurrency",
+			expectError: true,
+			opts: &configOpts{
+				backend:  backendS3,
+				s3Bucket: "test-bucket",
+			},
+		},
+		{
+			name:        "invalid: negative concurrency",
+			expectError: true,
+			opts: &configOpts{
+				backend:     backendS3,
+				s3Bucket:    "test-bucket",
+				concurrency: -1,
+			},
+		},
+		{
+			name:        "invalid: negative retries",
+			expectError: true,
+			opts: &configOpts{
+				backend:  backendS3,
+				s3Bucket: "test-bucket",
+				retries:  -1,
+			},
+		},
 		{
 			name:        "invalid: no tenant id",
 			expectError: true,
@@ -246,6 +317,44 @@ func TestValidation(t *testing.T) {
 	}
 }
 
+func TestMovePlan(t *testing.T) {
+	blobs := []blobItem{
+		{name: "docker/registry/v2/blobs/sha256/18/18ca/data", size: 1024},
+		{name: "docker/registry/v2/repositories/ns/app/_layers/sha256/18ca/link", size: 71},
+	}
+	plan := newMovePlan(blobs, &moveBlobOpts{source: "docker", dest: "/docker"})
+
+	expected := &movePlan{
+		Source:     "docker",
+		Dest:       "/docker",
+		BlobCount:  2,
+		TotalBytes: 1095,
+		Blobs: []plannedBlob{
+			{Source: "docker/registry/v2/blobs/sha256/18/18ca/data", Dest: "/docker/registry/v2/blobs/sha256/18/18ca/data", Bytes: 1024},
+			{Source: "docker/registry/v2/repositories/ns/app/_layers/sha256/18ca/link", Dest: "/docker/registry/v2/repositories/ns/app/_layers/sha256/18ca/link", Bytes: 71},
+		},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Fatalf("expected plan %+v, got %+v", expected, plan)
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := writePlan(plan, path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written movePlan
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatalf("the plan is not valid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(&written, expected) {
+		t.Errorf("expected written plan %+v, got %+v", expected, written)
+	}
+}
+
 func TestStackHubEnvironmentFile(t *testing.T) {
 	path := strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT_FILEPATH"))
 	contents := strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT_FILECONTENTS"))
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/clientconfig"
+)
+
+// s3MaxCopySize is the largest object S3 copies in a single request, larger
+// objects are copied in parts of s3CopyPartSize bytes.
+const (
+	s3MaxCopySize  = 5 * 1024 * 1024 * 1024
+	s3CopyPartSize = 1024 * 1024 * 1024
+)
+
+// s3Store is the objectStore of an S3 bucket.
+type s3Store struct {
+	client *s3.S3
+	bucket string
+}
+
+// newS3Store returns the store of the bucket opts.s3Bucket. Its clients are
+// configured like the clients of the operator.
+func newS3Store(opts *configOpts) (*s3Store, error) {
+	sessionOptions := clientconfig.S3{
+		Region:             opts.s3Region,
+		RegionEndpoint:     opts.s3RegionEndpoint,
+		VirtualHostedStyle: opts.s3VirtualHostedStyle,
+	}.SessionOptions()
+	if len(opts.s3RegionEndpoint) > 0 {
+		sessionOptions.Config.Endpoint = aws.String(opts.s3RegionEndpoint)
+	}
+
+	sess, err := session.NewSessionWithOptions(sessionOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{
+		client: s3.New(sess),
+		bucket: opts.s3Bucket,
+	}, nil
+}
+
+func (s *s3Store) list(ctx context.Context, prefix string) ([]blobItem, error) {
+	blobs := []blobItem{}
+	err := s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			blobs = append(blobs, blobItem{
+				name: aws.StringValue(obj.Key),
+				size: aws.Int64Value(obj.Size),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return []blobItem{}, err
+	}
+	return blobs, nil
+}
+
+func (s *s3Store) copy(ctx context.Context, source blobItem, dest string) error {
+	// the copy source is the bucket and the key of the source object, the
+	// key MUST be escaped.
+	copySource := s.bucket + "/" + url.PathEscape(source.name)
+	if source.size <= s3MaxCopySize {
+		_, err := s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(dest),
+			CopySource: aws.String(copySource),
+		})
+		return err
+	}
+
+	upload, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(dest),
+	})
+	if err != nil {
+		return err
+	}
+	parts := []*s3.CompletedPart{}
+	for offset, number := int64(0), int64(1); offset < source.size; offset, number = offset+s3CopyPartSize, number+1 {
+		last := offset + s3CopyPartSize - 1
+		if last >= source.size {
+			last = source.size - 1
+		}
+		part, err := s.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(dest),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, last)),
+			PartNumber:      aws.Int64(number),
+			UploadId:        upload.UploadId,
+		})
+		if err != nil {
+			_, abortErr := s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.bucket),
+				Key:      aws.String(dest),
+				UploadId: upload.UploadId,
+			})
+			if abortErr != nil {
+				return fmt.Errorf("%v (aborting the upload failed: %v)", err, abortErr)
+			}
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int64(number),
+		})
+	}
+	_, err = s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(dest),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+func (s *s3Store) delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,286 @@
+// Package benchmark measures the throughput and the latency of the registry
+// storage. It pushes and pulls blobs through the distribution API of the
+// registry, the way clients do, so that the measures include the storage
+// driver and the network between the registry and its storage.
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Options configures a benchmark.
+type Options struct {
+	// Registry is the base URL of the registry, such as
+	// https://image-registry.openshift-image-registry.svc:5000.
+	Registry string
+	// Repository is the repository the blobs are pushed to.
+	Repository string
+	// Token authenticates the requests to the registry.
+	Token string
+	// BlobSize is the size of each blob in bytes.
+	BlobSize int64
+	// Blobs is the number of blobs that are written and read.
+	Blobs int
+	// Concurrency is the number of blobs transferred at the same time.
+	Concurrency int
+}
+
+// Operation is the measure of the writes or of the reads.
+type Operation struct {
+	// ThroughputBytesPerSecond is the number of bytes transferred by all
+	// the blobs divided by the duration of the operation.
+	ThroughputBytesPerSecond float64 `json:"throughputBytesPerSecond"`
+	// LatencyP50Seconds and LatencyP99Seconds are percentiles of the time
+	// it takes to transfer one blob.
+	LatencyP50Seconds float64 `json:"latencyP50Seconds"`
+	LatencyP99Seconds float64 `json:"latencyP99Seconds"`
+}
+
+// Result is the outcome of a benchmark.
+type Result struct {
+	Blobs         int       `json:"blobs"`
+	BlobSizeBytes int64     `json:"blobSizeBytes"`
+	Write         Operation `json:"write"`
+	Read          Operation `json:"read"`
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// measure returns the measure of an operation that transferred bytes in
+// elapsed, with the given latencies.
+func measure(bytes int64, elapsed time.Duration, latencies []time.Duration) Operation {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	op := Operation{
+		LatencyP50Seconds: percentile(sorted, 0.5).Seconds(),
+		LatencyP99Seconds: percentile(sorted, 0.99).Seconds(),
+	}
+	if elapsed > 0 {
+		op.ThroughputBytesPerSecond = float64(bytes) / elapsed.Seconds()
+	}
+	return op
+}
+
+// blob is a blob of random content. The content is generated again from its
+// seed when it is sent, the blobs are not held in memory.
+type blob struct {
+	seed   int64
+	size   int64
+	digest string
+}
+
+func (bl *blob) content() io.Reader {
+	return io.LimitReader(rand.New(rand.NewSource(bl.seed)), bl.size)
+}
+
+func newBlob(seed, size int64) (*blob, error) {
+	bl := &blob{seed: seed, size: size}
+	h := sha256.New()
+	if _, err := io.Copy(h, bl.content()); err != nil {
+		return nil, err
+	}
+	bl.digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	return bl, nil
+}
+
+type benchmark struct {
+	client *http.Client
+	opts   Options
+}
+
+// do sends a request to the registry, with the content of bl as its body if
+// bl is set.
+func (b *benchmark) do(ctx context.Context, method, u string, bl *blob) (*http.Response, error) {
+	var body io.Reader
+	if bl != nil {
+		body = bl.content()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.opts.Token)
+	if bl != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.ContentLength = bl.size
+	}
+	return b.client.Do(req)
+}
+
+// expect closes the body of resp and returns an error if its status is not
+// status.
+func expect(resp *http.Response, status int, what string) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to %s: %s: %s", what, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// location resolves the Location header of resp.
+func location(resp *http.Response) (*url.URL, error) {
+	loc, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("the registry did not return the upload location: %w", err)
+	}
+	return loc, nil
+}
+
+// push uploads the blob like clients do: an upload session is started, the
+// content is sent in a PATCH request and the upload is committed with its
+// digest.
+func (b *benchmark) push(ctx context.Context, bl *blob) error {
+	resp, err := b.do(ctx, http.MethodPost, fmt.Sprintf("%s/v2/%s/blobs/uploads/", b.opts.Registry, b.opts.Repository), nil)
+	if err != nil {
+		return err
+	}
+	loc, err := location(resp)
+	if err2 := expect(resp, http.StatusAccepted, "start an upload"); err2 != nil {
+		return err2
+	} else if err != nil {
+		return err
+	}
+
+	resp, err = b.do(ctx, http.MethodPatch, loc.String(), bl)
+	if err != nil {
+		return err
+	}
+	loc, err = location(resp)
+	if err2 := expect(resp, http.StatusAccepted, "upload a blob"); err2 != nil {
+		return err2
+	} else if err != nil {
+		return err
+	}
+
+	q := loc.Query()
+	q.Set("digest", bl.digest)
+	loc.RawQuery = q.Encode()
+	resp, err = b.do(ctx, http.MethodPut, loc.String(), nil)
+	if err != nil {
+		return err
+	}
+	return expect(resp, http.StatusCreated, "commit an upload")
+}
+
+// pull downloads the blob and checks its digest. The registry may redirect
+// the request to the storage.
+func (b *benchmark) pull(ctx context.Context, bl *blob) error {
+	resp, err := b.do(ctx, http.MethodGet, fmt.Sprintf("%s/v2/%s/blobs/%s", b.opts.Registry, b.opts.Repository, bl.digest), nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return expect(resp, http.StatusOK, "download a blob")
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return err
+	}
+	if digest := "sha256:" + hex.EncodeToString(h.Sum(nil)); digest != bl.digest {
+		return fmt.Errorf("the blob %s was read back with the digest %s", bl.digest, digest)
+	}
+	return nil
+}
+
+// delete deletes the blob from the repository. The registry may not allow
+// it, the blob is then removed by the next hard prune.
+func (b *benchmark) delete(ctx context.Context, bl *blob) {
+	resp, err := b.do(ctx, http.MethodDelete, fmt.Sprintf("%s/v2/%s/blobs/%s", b.opts.Registry, b.opts.Repository, bl.digest), nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// run runs fn for each blob with opts.Concurrency workers. It returns the
+// time fn took for each blob and the time all of them took.
+func (b *benchmark) run(ctx context.Context, blobs []*blob, fn func(context.Context, *blob) error) ([]time.Duration, time.Duration, error) {
+	latencies := make([]time.Duration, len(blobs))
+	errs := make([]error, len(blobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < b.opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				t := time.Now()
+				errs[i] = fn(ctx, blobs[i])
+				latencies[i] = time.Since(t)
+			}
+		}()
+	}
+	for i := range blobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	elapsed := time.Since(start)
+	for _, err := range errs {
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return latencies, elapsed, nil
+}
+
+// Run writes opts.Blobs random blobs of opts.BlobSize bytes to the registry,
+// reads them back and deletes them.
+func Run(ctx context.Context, client *http.Client, opts Options) (*Result, error) {
+	if opts.Blobs < 1 || opts.BlobSize < 1 || opts.Concurrency < 1 {
+		return nil, fmt.Errorf("the number of blobs, their size and the concurrency must be positive")
+	}
+	b := &benchmark{client: client, opts: opts}
+
+	blobs := make([]*blob, opts.Blobs)
+	for i := range blobs {
+		bl, err := newBlob(time.Now().UnixNano()+int64(i), opts.BlobSize)
+		if err != nil {
+			return nil, err
+		}
+		blobs[i] = bl
+	}
+	defer func() {
+		for _, bl := range blobs {
+			b.delete(ctx, bl)
+		}
+	}()
+
+	total := opts.BlobSize * int64(opts.Blobs)
+	writes, elapsed, err := b.run(ctx, blobs, b.push)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Blobs:         opts.Blobs,
+		BlobSizeBytes: opts.BlobSize,
+		Write:         measure(total, elapsed, writes),
+	}
+
+	reads, elapsed, err := b.run(ctx, blobs, b.pull)
+	if err != nil {
+		return nil, err
+	}
+	result.Read = measure(total, elapsed, reads)
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package benchmark
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry implements the blob uploads and downloads of the distribution
+// API in memory.
+type fakeRegistry struct {
+	mtx     sync.Mutex
+	uploads map[string][]byte
+	blobs   map[string][]byte
+	next    int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const prefix = "/v2/openshift-image-registry/storage-benchmark/blobs/"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	switch {
+	case r.Method == http.MethodPost && path == "uploads/":
+		f.next++
+		id := fmt.Sprintf("%d", f.next)
+		f.uploads[id] = nil
+		w.Header().Set("Location", prefix+"uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPatch && strings.HasPrefix(path, "uploads/"):
+		id := strings.TrimPrefix(path, "uploads/")
+		content, _ := io.ReadAll(r.Body)
+		f.uploads[id] = append(f.uploads[id], content...)
+		w.Header().Set("Location", prefix+"uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "uploads/"):
+		id := strings.TrimPrefix(path, "uploads/")
+		sum := sha256.Sum256(f.uploads[id])
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		if digest != r.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blobs[digest] = f.uploads[id]
+		delete(f.uploads, id)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet:
+		content, ok := f.blobs[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	case r.Method == http.MethodDelete:
+		delete(f.blobs, path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRun(t *testing.T) {
+	registry := &fakeRegistry{uploads: map[string][]byte{}, blobs: map[string][]byte{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	result, err := Run(context.Background(), server.Client(), Options{
+		Registry:    server.URL,
+		Repository:  "openshift-image-registry/storage-benchmark",
+		Token:       "token",
+		BlobSize:    64 * 1024,
+		Blobs:       5,
+		Concurrency: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Blobs != 5 || result.BlobSizeBytes != 64*1024 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	for name, op := range map[string]Operation{"write": result.Write, "read": result.Read} {
+		if op.ThroughputBytesPerSecond <= 0 || op.LatencyP99Seconds < op.LatencyP50Seconds {
+			t.Errorf("unexpected %s measure %+v", name, op)
+		}
+	}
+	if len(registry.blobs) != 0 || len(registry.uploads) != 0 {
+		t.Errorf("the blobs were not deleted: %d blobs, %d uploads", len(registry.blobs), len(registry.uploads))
+	}
+
+	if _, err := Run(context.Background(), server.Client(), Options{
+		Registry:    server.URL,
+		Repository:  "openshift-image-registry/storage-benchmark",
+		Token:       "expired",
+		BlobSize:    1024,
+		Blobs:       1,
+		Concurrency: 1,
+	}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v, want the authentication error", err)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Second)
+	}
+	op := measure(1000, 10*time.Second, latencies)
+	if op.ThroughputBytesPerSecond != 100 || op.LatencyP50Seconds != 50 || op.LatencyP99Seconds != 99 {
+		t.Errorf("unexpected measure %+v", op)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	rbacset "k8s.io/client-go/kubernetes/typed/rbac/v1"
 
+	buildset "github.com/openshift/client-go/build/clientset/versioned/typed/build/v1"
 	configset "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
 	regopset "github.com/openshift/client-go/imageregistry/clientset/versioned"
 	routeset "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
@@ -23,4 +24,5 @@ type Clients struct {
 	RBAC   rbacset.RbacV1Interface
 	Batch  batchset.BatchV1Interface
 	Job    jobset.BatchV1Interface
+	Build  buildset.BuildV1Interface
 }
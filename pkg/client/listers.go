@@ -2,6 +2,7 @@ package client
 
 import (
 	kappslisters "k8s.io/client-go/listers/apps/v1"
+	kautoscalinglisters "k8s.io/client-go/listers/autoscaling/v2"
 	kbatchlisters "k8s.io/client-go/listers/batch/v1"
 	kjoblisters "k8s.io/client-go/listers/batch/v1"
 	kcorelisters "k8s.io/client-go/listers/core/v1"
@@ -47,6 +48,9 @@ type Listers struct {
 	ClusterRoleBindings  krbaclisters.ClusterRoleBindingLister
 	RegistryConfigs      regoplisters.ConfigLister
 	ProxyConfigs         configlisters.ProxyLister
+	NetworkConfigs       configlisters.NetworkLister
+
+	HorizontalPodAutoscalers kautoscalinglisters.HorizontalPodAutoscalerNamespaceLister
 }
 
 type ImagePrunerControllerListers struct {
@@ -0,0 +1,130 @@
+// Package clientapi provides helpers for other in-cluster operators that need
+// to know the state of the image registry. They are backed by listers and only
+// rely on fields the registry operator keeps stable, so callers don't have to
+// parse the conditions of the registry Config and depend on their reasons.
+package clientapi
+
+import (
+	"errors"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// ErrNotReported is returned when the registry operator has not published the
+// requested information yet.
+var ErrNotReported = errors.New("not reported by the image registry operator yet")
+
+// StorageType is the kind of storage backend used by the registry.
+type StorageType string
+
+const (
+	StorageTypeS3       StorageType = "S3"
+	StorageTypeGCS      StorageType = "GCS"
+	StorageTypeAzure    StorageType = "Azure"
+	StorageTypeSwift    StorageType = "Swift"
+	StorageTypePVC      StorageType = "PVC"
+	StorageTypeEmptyDir StorageType = "EmptyDir"
+	StorageTypeIBMCOS   StorageType = "IBMCOS"
+	StorageTypeOSS      StorageType = "OSS"
+)
+
+// StorageBackendInfo describes the storage backend used by the registry.
+type StorageBackendInfo struct {
+	Type StorageType
+	// Location is the bucket, the container or the claim that holds the
+	// registry data. It is empty for EmptyDir.
+	Location string
+	// Managed is true if the storage was created by the registry operator,
+	// which deletes it when the registry is removed.
+	Managed bool
+}
+
+// GetInternalRegistryHostname returns the hostname, with the port, under which
+// the registry is reachable from within the cluster. It returns
+// ErrNotReported if it is not published yet.
+func GetInternalRegistryHostname(imageConfigLister configlisters.ImageLister) (string, error) {
+	imageConfig, err := imageConfigLister.Get(defaults.ImageConfigName)
+	if kerrors.IsNotFound(err) {
+		return "", ErrNotReported
+	}
+	if err != nil {
+		return "", err
+	}
+	if imageConfig.Status.InternalRegistryHostname == "" {
+		return "", ErrNotReported
+	}
+	return imageConfig.Status.InternalRegistryHostname, nil
+}
+
+// GetStorageBackendInfo returns the storage backend the registry operator has
+// configured. It returns ErrNotReported if the storage is not configured yet.
+func GetStorageBackendInfo(configLister imageregistrylisters.ConfigLister) (StorageBackendInfo, error) {
+	cr, err := configLister.Get(defaults.ImageRegistryResourceName)
+	if kerrors.IsNotFound(err) {
+		return StorageBackendInfo{}, ErrNotReported
+	}
+	if err != nil {
+		return StorageBackendInfo{}, err
+	}
+
+	storage := cr.Status.Storage
+	info := StorageBackendInfo{
+		Managed: cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged,
+	}
+	switch {
+	case storage.S3 != nil:
+		info.Type = StorageTypeS3
+		info.Location = storage.S3.Bucket
+	case storage.GCS != nil:
+		info.Type = StorageTypeGCS
+		info.Location = storage.GCS.Bucket
+	case storage.Azure != nil:
+		info.Type = StorageTypeAzure
+		info.Location = storage.Azure.AccountName + "/" + storage.Azure.Container
+	case storage.Swift != nil:
+		info.Type = StorageTypeSwift
+		info.Location = storage.Swift.Container
+	case storage.PVC != nil:
+		info.Type = StorageTypePVC
+		info.Location = storage.PVC.Claim
+	case storage.EmptyDir != nil:
+		info.Type = StorageTypeEmptyDir
+	case storage.IBMCOS != nil:
+		info.Type = StorageTypeIBMCOS
+		info.Location = storage.IBMCOS.Bucket
+	case storage.OSS != nil:
+		info.Type = StorageTypeOSS
+		info.Location = storage.OSS.Bucket
+	default:
+		return StorageBackendInfo{}, ErrNotReported
+	}
+	return info, nil
+}
+
+// IsRegistryAvailable returns true if the registry is installed and serves
+// requests. A registry that is removed or not installed is not available.
+func IsRegistryAvailable(configLister imageregistrylisters.ConfigLister) (bool, error) {
+	cr, err := configLister.Get(defaults.ImageRegistryResourceName)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return false, nil
+	}
+	for _, cond := range cr.Status.Conditions {
+		if cond.Type == operatorv1.OperatorStatusTypeAvailable {
+			return cond.Status == operatorv1.ConditionTrue, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,206 @@
+package clientapi
+
+import (
+	"testing"
+
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func newConfigLister(t *testing.T, cr *imageregistryv1.Config) imageregistrylisters.ConfigLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if cr != nil {
+		cr.Name = defaults.ImageRegistryResourceName
+		if err := indexer.Add(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return imageregistrylisters.NewConfigLister(indexer)
+}
+
+func TestGetInternalRegistryHostname(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		imageConfig *configv1.Image
+		expected    string
+		err         error
+	}{
+		{
+			name: "no image config",
+			err:  ErrNotReported,
+		},
+		{
+			name:        "hostname not published",
+			imageConfig: &configv1.Image{},
+			err:         ErrNotReported,
+		},
+		{
+			name: "hostname published",
+			imageConfig: &configv1.Image{
+				Status: configv1.ImageStatus{
+					InternalRegistryHostname: "image-registry.openshift-image-registry.svc:5000",
+				},
+			},
+			expected: "image-registry.openshift-image-registry.svc:5000",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.imageConfig != nil {
+				tt.imageConfig.ObjectMeta = metaapi.ObjectMeta{Name: defaults.ImageConfigName}
+				if err := indexer.Add(tt.imageConfig); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hostname, err := GetInternalRegistryHostname(configlisters.NewImageLister(indexer))
+			if err != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if hostname != tt.expected {
+				t.Errorf("expected hostname %q, got %q", tt.expected, hostname)
+			}
+		})
+	}
+}
+
+func TestGetStorageBackendInfo(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		cr       *imageregistryv1.Config
+		expected StorageBackendInfo
+		err      error
+	}{
+		{
+			name: "no config",
+			err:  ErrNotReported,
+		},
+		{
+			name: "storage not configured",
+			cr:   &imageregistryv1.Config{},
+			err:  ErrNotReported,
+		},
+		{
+			name: "managed s3 bucket",
+			cr: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry-bucket"},
+					},
+				},
+			},
+			expected: StorageBackendInfo{Type: StorageTypeS3, Location: "registry-bucket", Managed: true},
+		},
+		{
+			name: "azure container",
+			cr: &imageregistryv1.Config{
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account", Container: "container"},
+					},
+				},
+			},
+			expected: StorageBackendInfo{Type: StorageTypeAzure, Location: "account/container"},
+		},
+		{
+			name: "emptydir",
+			cr: &imageregistryv1.Config{
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+					},
+				},
+			},
+			expected: StorageBackendInfo{Type: StorageTypeEmptyDir},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := GetStorageBackendInfo(newConfigLister(t, tt.cr))
+			if err != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if info != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, info)
+			}
+		})
+	}
+}
+
+func TestIsRegistryAvailable(t *testing.T) {
+	available := operatorv1.OperatorCondition{
+		Type:   operatorv1.OperatorStatusTypeAvailable,
+		Status: operatorv1.ConditionTrue,
+		Reason: "Ready",
+	}
+
+	for _, tt := range []struct {
+		name     string
+		cr       *imageregistryv1.Config
+		expected bool
+	}{
+		{
+			name: "no config",
+		},
+		{
+			name: "no available condition",
+			cr:   &imageregistryv1.Config{},
+		},
+		{
+			name: "available",
+			cr: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{Conditions: []operatorv1.OperatorCondition{available}},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "removed",
+			cr: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Removed},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{Conditions: []operatorv1.OperatorCondition{available}},
+				},
+			},
+		},
+		{
+			name: "not available",
+			cr: &imageregistryv1.Config{
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{Conditions: []operatorv1.OperatorCondition{{
+						Type:   operatorv1.OperatorStatusTypeAvailable,
+						Status: operatorv1.ConditionFalse,
+						Reason: "NoReplicasAvailable",
+					}}},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsRegistryAvailable(newConfigLister(t, tt.cr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
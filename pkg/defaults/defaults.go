@@ -11,6 +11,11 @@ const (
 	// PVCImageRegistryName is the default name of the claim provisioned for PVC backend
 	PVCImageRegistryName = "image-registry-storage"
 
+	// RGWBucketClaimName is the name of the ObjectBucketClaim provisioned
+	// for the registry bucket on Ceph RADOS Gateway, and of the config map
+	// and the secret created for it by the bucket provisioner
+	RGWBucketClaimName = "image-registry-bucket"
+
 	// InstallationPullSecret is the secret where we keep pull secrets provided during
 	// cluster installation.
 	InstallationPullSecret = "installation-pull-secrets"
@@ -40,6 +45,15 @@ const (
 	// accessing S3 storage
 	ImageRegistryPrivateConfiguration = "image-registry-private-configuration"
 
+	// NodeCAName is the name of the daemon set that installs the CA bundles
+	// of the registries on the nodes. The daemon sets of the node pools with
+	// their own CA bundles are named after it.
+	NodeCAName = "node-ca"
+
+	// NodeCAPoolLabel is the label of the node-ca daemon sets and CA bundle
+	// config maps of the node pools, its value is the name of the pool.
+	NodeCAPoolLabel = "imageregistry.operator.openshift.io/node-ca-pool"
+
 	// ImageRegistryPrivateConfigurationUser is the name of a secret that is managed by
 	// the administrator and which provides credentials to the registry for things like
 	// accessing S3 storage.  This content takes precedence over content the operator
@@ -79,6 +93,11 @@ const (
 	// that we created has encryption enabled
 	StorageEncrypted = "StorageEncrypted"
 
+	// StorageSoftDeleteEnabled denotes whether or not the soft delete of
+	// blobs and containers requested in the overrides is enabled on the
+	// registry storage medium
+	StorageSoftDeleteEnabled = "StorageSoftDeleteEnabled"
+
 	// StoragePublicAccessBlocked denotes whether or not the registry storage medium
 	// that we created has had public access to itself and its objects blocked
 	StoragePublicAccessBlocked = "StoragePublicAccessBlocked"
@@ -87,6 +106,103 @@ const (
 	// medium is configured to automatically cleanup incomplete uploads
 	StorageIncompleteUploadCleanupEnabled = "StorageIncompleteUploadCleanupEnabled"
 
+	// StorageLifecycleTransitionsEnabled denotes whether or not the
+	// transitions of old blobs to other storage classes requested in the
+	// overrides are configured on the registry storage medium
+	StorageLifecycleTransitionsEnabled = "StorageLifecycleTransitionsEnabled"
+
+	// StorageAddressingStyleDetected denotes whether or not the operator
+	// found the addressing style the custom S3 endpoint answers to
+	StorageAddressingStyleDetected = "StorageAddressingStyleDetected"
+
+	// StorageVersioningEnabled denotes whether or not the versioning
+	// requested in the overrides is enabled on the registry storage medium
+	StorageVersioningEnabled = "StorageVersioningEnabled"
+
+	// StorageAccelerationEnabled denotes whether or not the S3 Transfer
+	// Acceleration requested in the overrides is available on the bucket
+	StorageAccelerationEnabled = "StorageAccelerationEnabled"
+
+	// StorageObjectLockEnabled denotes whether or not Object Lock is
+	// enabled on the registry storage medium
+	StorageObjectLockEnabled = "StorageObjectLockEnabled"
+
+	// StorageNetworkReachable denotes whether or not the endpoint of the
+	// registry storage medium can be reached from the operator
+	StorageNetworkReachable = "StorageNetworkReachable"
+
+	// StorageSASTokenExpiring denotes whether or not the SAS token the
+	// user provided for the Azure storage account is about to expire
+	StorageSASTokenExpiring = "StorageSASTokenExpiring"
+
+	// StorageCredentialsValid denotes whether or not the token that the
+	// operator uses to authenticate against the storage cloud provider
+	// (STS, workload identity) is readable and not expired
+	StorageCredentialsValid = "StorageCredentialsValid"
+
+	// StorageTokenExchangeFailing denotes whether or not the cloud provider
+	// rejects the exchange of the projected service account token for an
+	// access token, for example after the workload identity pool is deleted
+	StorageTokenExchangeFailing = "StorageTokenExchangeFailing"
+
+	// StorageCredentialsFallback denotes whether or not the registry uses the
+	// user provided storage credentials as a fallback during a credentials
+	// migration window
+	StorageCredentialsFallback = "StorageCredentialsFallback"
+
+	// StorageDegraded denotes whether or not the health probe of the
+	// registry storage medium fails, for example on stale NFS file handles
+	StorageDegraded = "StorageDegraded"
+
+	// StorageMirrored denotes whether or not the secondary storage
+	// provisioned as a copy target for the registry storage is ready
+	StorageMirrored = "StorageMirrored"
+
+	// StorageWritable denotes whether or not the registry storage accepts
+	// writes. The registry is switched to read-only mode while it doesn't
+	StorageWritable = "StorageWritable"
+
+	// StorageValidated denotes whether or not the operator could write,
+	// read and delete an object in the registry storage. The registry is
+	// not rolled out with a storage configuration that fails validation
+	StorageValidated = "StorageValidated"
+
+	// RolloutRolledBack denotes whether or not the registry deployment has
+	// been reverted to its last known-good pod template because a rollout
+	// did not complete
+	RolloutRolledBack = "RolloutRolledBack"
+
+	// RolloutDeferred denotes whether or not a rollout of the registry
+	// deployment is held back until the maintenance window opens
+	RolloutDeferred = "RolloutDeferred"
+
+	// GarbageCollectionDeferred denotes whether or not the garbage
+	// collection of the registry namespace is held back until the
+	// maintenance window opens
+	GarbageCollectionDeferred = "GarbageCollectionDeferred"
+
+	// ImageStreamImportModeCompatible denotes whether or not the registry
+	// configuration supports the image stream import mode of the cluster
+	ImageStreamImportModeCompatible = "ImageStreamImportModeCompatible"
+
+	// StoragePrivateEndpointHealthy denotes whether or not the shared
+	// private endpoint of the registry storage is connected to the storage
+	// account
+	StoragePrivateEndpointHealthy = "StoragePrivateEndpointHealthy"
+
+	// StorageBootstrapped describes the storage decision taken when the
+	// registry config was bootstrapped on platforms without a default
+	// storage backend
+	StorageBootstrapped = "StorageBootstrapped"
+
+	// ServiceIPFamiliesValid denotes whether or not the IP families of the
+	// registry services match the service network of the cluster
+	ServiceIPFamiliesValid = "ServiceIPFamiliesValid"
+
+	// ChangesPending denotes whether or not changes of the registry config
+	// are staged and wait for an approval before they are applied
+	ChangesPending = "ChangesPending"
+
 	// VersionAnnotation reflects the version of the registry that this deployment
 	// is running.
 	VersionAnnotation = "release.openshift.io/version"
@@ -104,18 +220,115 @@ const (
 	HealthzRoute          = "/healthz"
 	HealthzTimeoutSeconds = 5
 
+	// OperatorServiceAccountName is the service account of the operator.
+	OperatorServiceAccountName = "cluster-image-registry-operator"
+
+	// RevisionHistoryLimit is the number of old ReplicaSets kept by the
+	// deployments of the registry to allow rollbacks. Older ones are
+	// deleted by the deployment controller.
+	RevisionHistoryLimit = 3
+
+	// AzureTagSyncIntervalSeconds is the default time between two
+	// synchronizations of the tags of an Azure storage account.
+	AzureTagSyncIntervalSeconds = 3600
+
+	// GCSLabelSyncIntervalSeconds is the default time between two
+	// synchronizations of the labels of a GCS bucket.
+	GCSLabelSyncIntervalSeconds = 3600
+
+	// PVCHealthProbeIntervalSeconds is the default time between two health
+	// probes of the claim of the registry.
+	PVCHealthProbeIntervalSeconds = 300
+
+	// PVCHealthProbeTimeoutSeconds is the default time a health probe of the
+	// claim of the registry has to complete.
+	PVCHealthProbeTimeoutSeconds = 60
+
+	// PruneInterlockMaxDeferralSeconds is the default longest time a pruner
+	// job waits for the builds in progress.
+	PruneInterlockMaxDeferralSeconds = 3600
+
+	// AutoscalingTargetCPUUtilizationPercentage is the default average CPU
+	// usage of the registry replicas kept by the autoscaler.
+	AutoscalingTargetCPUUtilizationPercentage = 80
+
+	// UsagePruneThresholdPercent is the default usage of the quota of the
+	// storage above which the usage prune runs the image pruner.
+	UsagePruneThresholdPercent = 80
+
+	// UsagePruneIntervalSeconds is the default time between two measures
+	// of the storage usage by the usage prune.
+	UsagePruneIntervalSeconds = 3600
+
+	// UsagePruneAnnotation is set on the pruner jobs started by the usage
+	// prune, with the number of tag revisions they keep.
+	UsagePruneAnnotation = "imageregistry.operator.openshift.io/usage-prune-keep-tag-revisions"
+
+	// StorageUsageMetricsIntervalSeconds is the time between two measures
+	// of the storage for the storage usage metrics.
+	StorageUsageMetricsIntervalSeconds = 3600
+
+	// RecreationMaxPerHour is the default number of times in an hour the
+	// operator recreates a managed object deleted by someone else.
+	RecreationMaxPerHour = 5
+
+	// HardPruneSchedule is the default schedule of the hard prune of the
+	// registry storage when no maintenance window is set: every Sunday at
+	// 03:00.
+	HardPruneSchedule = "0 3 * * 0"
+
+	// HardPruneKeepYoungerThanSeconds is the default time during which no
+	// image must have been created for a hard prune to start.
+	HardPruneKeepYoungerThanSeconds = 3600
+
+	// StorageBenchmarkBlobSizeMiB, StorageBenchmarkBlobs and
+	// StorageBenchmarkConcurrency are the default size of the blobs of a
+	// storage benchmark, their number and the number of blobs transferred
+	// at the same time.
+	StorageBenchmarkBlobSizeMiB = 16
+	StorageBenchmarkBlobs       = 16
+	StorageBenchmarkConcurrency = 4
+
+	// ConsistencyCheckSchedule is the default schedule of the consistency
+	// check of the registry storage: every day at 04:00.
+	ConsistencyCheckSchedule = "0 4 * * *"
+
+	// S3DriftDetectionIntervalSeconds is the default time between two checks
+	// of the encryption and of the public access block of an S3 bucket.
+	S3DriftDetectionIntervalSeconds = 3600
+
+	// StagedChangesExpirySeconds is the default time a staged change set of
+	// the registry config can be approved.
+	StagedChangesExpirySeconds = 86400
+
 	ImageConfigName   = "cluster"
 	ClusterConfigName = "cluster-config-v1"
 
 	ServiceCAName = "serviceca"
 	TrustedCAName = "trusted-ca"
 
+	// GatewayCAName is the config map with the service CA the gateways use
+	// to verify the certificate of the registry.
+	GatewayCAName = "image-registry-gateway-ca"
+
 	// OpenShiftConfigNamespace is a namespace with global configuration resources.
 	OpenShiftConfigNamespace = "openshift-config"
 
 	// OpenShiftConfigManagedNamespace is a namespace with managed global configuration resources.
 	OpenShiftConfigManagedNamespace = "openshift-config-managed"
 
+	// IngressCAName is the config map of the openshift-config-managed
+	// namespace with the CA of the default ingress certificate.
+	IngressCAName = "default-ingress-cert"
+
+	// AzureCustomCloudConfigMapName is the name of the ConfigMap in the
+	// openshift-config namespace that defines a custom Azure cloud.
+	AzureCustomCloudConfigMapName = "image-registry-azure-cloud"
+
+	// AzureCustomCloudKey is the key of the custom Azure cloud definition,
+	// in the format of the Azure SDK environment files.
+	AzureCustomCloudKey = "cloud.json"
+
 	// KubeCloudConfigName is the name of the ConfigMap containing the kube cloud config.
 	KubeCloudConfigName = "kube-cloud-config"
 
@@ -125,12 +338,243 @@ const (
 	// InfrastructureResourceName is the name of the infrastructure config resource
 	InfrastructureResourceName = "cluster"
 
+	// IngressResourceName is the name of the ingress config resource
+	IngressResourceName = "cluster"
+
+	// NetworkResourceName is the name of the network config resource
+	NetworkResourceName = "cluster"
+
 	// AzurePathFixJobName is the job name for the azure-path-fix job
 	AzurePathFixJobName = "azure-path-fix"
+
+	// StorageMigrationJobName is the name of the job that moves the blobs
+	// of a storage migration.
+	StorageMigrationJobName = "image-registry-storage-migration"
+
+	// StorageHealthProbeJobName is the name of the job that probes the
+	// claim of the registry.
+	StorageHealthProbeJobName = "image-registry-storage-probe"
+
+	// HardPruneCronJobName is the name of the cron job that runs the hard
+	// prune of the registry storage.
+	HardPruneCronJobName = "image-registry-hard-prune"
+
+	// ConsistencyCheckCronJobName is the name of the cron job that checks
+	// the consistency of the image metadata with the registry storage.
+	ConsistencyCheckCronJobName = "image-registry-consistency-check"
+
+	// ConsistencyReportConfigMapName is the name of the config map that
+	// holds the report of the last consistency check.
+	ConsistencyReportConfigMapName = "image-registry-consistency-report"
+
+	// ConsistencyReportKey is the key of ConsistencyReportConfigMapName with
+	// the JSON report.
+	ConsistencyReportKey = "report.json"
+
+	// RestoredImageStreamAnnotation is set on the image streams re-created
+	// from the storage by a consistency check, with the name of its job.
+	RestoredImageStreamAnnotation = "imageregistry.operator.openshift.io/restored-by"
+
+	// LostFoundTagPrefix prefixes the tags of the images of the restored
+	// image streams, it is followed by the hex digest of the image.
+	LostFoundTagPrefix = "lost-found-"
+
+	// StorageMigrationAnnotation is set by the administrator on the registry
+	// config to request a storage migration. Its value identifies the
+	// migration, a new value starts a new migration.
+	StorageMigrationAnnotation = "imageregistry.operator.openshift.io/storage-migration"
+
+	// StorageBenchmarkAnnotation is set by the administrator on the registry
+	// config to request a benchmark of the storage. Its value identifies
+	// the benchmark, a new value starts a new benchmark.
+	StorageBenchmarkAnnotation = "imageregistry.operator.openshift.io/storage-benchmark"
+
+	// StorageBenchmarkJobName is the name of the job that benchmarks the
+	// registry storage.
+	StorageBenchmarkJobName = "image-registry-storage-benchmark"
+
+	// StorageBenchmarkRepository is the repository the benchmark pushes its
+	// blobs to.
+	StorageBenchmarkRepository = "openshift-image-registry/storage-benchmark"
+
+	// ImageRegistryCanaryName is the name of the deployment that runs a
+	// single canary replica with a new registry configuration before it is
+	// rolled out to the image-registry deployment.
+	ImageRegistryCanaryName = "image-registry-canary"
+
+	// ImageRegistryPullName is the name of the deployment and the service
+	// of the read-only registry replicas that serve the pull endpoint.
+	ImageRegistryPullName = "image-registry-pull"
+
+	// TemplateChecksumAnnotation holds the checksum of the pod template that
+	// the operator generated for a deployment.
+	TemplateChecksumAnnotation = "imageregistry.operator.openshift.io/template-checksum"
+
+	// TrustedCAChecksumAnnotation holds the checksum of the cluster trusted
+	// CA bundle that the registry pods were started with.
+	TrustedCAChecksumAnnotation = "imageregistry.operator.openshift.io/trusted-ca-checksum"
+
+	// CanaryFailureAnnotation is set on the canary deployment when the canary
+	// replica did not pass its checks. It contains the reason of the failure.
+	CanaryFailureAnnotation = "imageregistry.operator.openshift.io/canary-failure"
+
+	// CanaryFailureTimeAnnotation is set on the canary deployment with the
+	// time of the failure of the canary replica, in RFC 3339 format.
+	CanaryFailureTimeAnnotation = "imageregistry.operator.openshift.io/canary-failure-time"
+
+	// RecommendedReplicasAnnotation is set on the registry config by the
+	// scale advisor. It holds the number of replicas that fits the observed
+	// load of the registry.
+	RecommendedReplicasAnnotation = "imageregistry.operator.openshift.io/recommended-replicas"
+
+	// RecommendedResourcesAnnotation is set on the registry config by the
+	// scale advisor. It holds the JSON encoded resource requirements per
+	// replica that fit the observed load of the registry.
+	RecommendedResourcesAnnotation = "imageregistry.operator.openshift.io/recommended-resources"
+
+	// ImageStreamImportModeAnnotation is set on the registry config by the
+	// import mode controller. It holds the image stream import mode of the
+	// cluster (Legacy or PreserveOriginal).
+	ImageStreamImportModeAnnotation = "imageregistry.operator.openshift.io/image-stream-import-mode"
+
+	// CredentialsMigrationUntilAnnotation is set by the administrator on the
+	// image-registry-private-configuration-user secret to migrate from its
+	// keys to the cluster minted credentials (STS, workload identity). It
+	// holds an RFC 3339 time until which the keys are used as a fallback
+	// when the cluster credentials are not usable.
+	CredentialsMigrationUntilAnnotation = "imageregistry.operator.openshift.io/credentials-migration-until"
+
+	// StorageBootstrapConfigMapName is the name of the config map in the
+	// openshift-config namespace that controls the storage decision taken
+	// when the registry config is bootstrapped.
+	StorageBootstrapConfigMapName = "image-registry-storage-bootstrap"
+
+	// StorageBootstrapModeKey is the key of StorageBootstrapConfigMapName
+	// with the bootstrap mode: Provision (default), Propose or Disabled.
+	StorageBootstrapModeKey = "mode"
+
+	// NutanixObjectsEndpointKey is the key of the user provided secret that
+	// holds the Nutanix Objects endpoint on Nutanix clusters.
+	NutanixObjectsEndpointKey = "REGISTRY_STORAGE_S3_REGIONENDPOINT"
+
+	// GeneratedSecretLabel marks the secrets in the operator namespace that
+	// the operator generates for the registry. Only these secrets, and the
+	// ones generated by earlier versions of the operator, are deleted by the
+	// garbage collector once they are no longer referenced.
+	GeneratedSecretLabel = "imageregistry.operator.openshift.io/generated"
+
+	// StorageAccessRequestLabel marks the secrets in the operator namespace
+	// that request short-lived credentials for the registry storage. The
+	// operator fills them with the credentials and deletes them once the
+	// credentials expire.
+	StorageAccessRequestLabel = "imageregistry.operator.openshift.io/storage-access-request"
+
+	// StorageAccessScopeAnnotation is the scope of the requested storage
+	// credentials, ReadOnly (default) or ReadWrite.
+	StorageAccessScopeAnnotation = "imageregistry.operator.openshift.io/storage-access-scope"
+
+	// StorageAccessDurationAnnotation is the requested lifetime of the
+	// storage credentials, for example 2h. Defaults to 1h.
+	StorageAccessDurationAnnotation = "imageregistry.operator.openshift.io/storage-access-duration"
+
+	// StorageAccessExpiryAnnotation is set by the operator on a storage
+	// access request once the credentials are issued. It holds the RFC 3339
+	// time at which the credentials expire.
+	StorageAccessExpiryAnnotation = "imageregistry.operator.openshift.io/storage-access-expiry"
+
+	// StorageAccessErrorAnnotation is set by the operator on a storage
+	// access request that cannot be fulfilled.
+	StorageAccessErrorAnnotation = "imageregistry.operator.openshift.io/storage-access-error"
+
+	// BackupExcludeLabel excludes a resource from Velero (OADP) backups. It
+	// is set on the registry resources when the backup policy is Exclude.
+	BackupExcludeLabel = "velero.io/exclude-from-backup"
+
+	// CredentialsSourceAnnotation is set on the
+	// image-registry-private-configuration-user secret when it is copied by
+	// the operator from a secret managed by an external secret operator. It
+	// holds the name of the source secret.
+	CredentialsSourceAnnotation = "imageregistry.operator.openshift.io/credentials-source"
+
+	// IstioInjectAnnotation enables or disables the injection of the service
+	// mesh sidecar into a pod. It is also honored as a label.
+	IstioInjectAnnotation = "sidecar.istio.io/inject"
+	// IstioExcludeInboundPortsAnnotation lists the ports of a pod that are
+	// not intercepted by the sidecar.
+	IstioExcludeInboundPortsAnnotation = "traffic.sidecar.istio.io/excludeInboundPorts"
+	// IstioProxyConfigAnnotation overrides the proxy configuration of the
+	// sidecar of a pod.
+	IstioProxyConfigAnnotation = "proxy.istio.io/config"
+
+	// StorageUsageConfigMapName is the name of the config map with the
+	// storage usage report of the registry per namespace and image stream.
+	StorageUsageConfigMapName = "image-registry-storage-usage"
+
+	// StorageUsageReportKey is the key of StorageUsageConfigMapName with the
+	// JSON encoded report.
+	StorageUsageReportKey = "report.json"
+
+	// ConditionHistoryConfigMapName is the name of the config map with the
+	// last transitions of the key conditions of the registry, one key per
+	// condition type.
+	ConditionHistoryConfigMapName = "image-registry-condition-history"
+
+	// StagedChangesConfigMapName is the name of the config map with the last
+	// applied spec of the registry config and the pending change set when
+	// the changes are staged.
+	StagedChangesConfigMapName = "image-registry-staged-changes"
+
+	// ApproveChangesAnnotation is set by the administrator on the registry
+	// config to approve a staged change set. It holds the ID of the change
+	// set and is removed by the operator once the changes are applied.
+	ApproveChangesAnnotation = "imageregistry.operator.openshift.io/approve-changes"
+
+	// RollbackConfigMapName is the name of the config map that holds the last
+	// known-good pod template of the registry deployment.
+	RollbackConfigMapName = "image-registry-rollback"
+
+	// PodSecurityEnforceLabel, PodSecurityAuditLabel and PodSecurityWarnLabel
+	// are the namespace labels of the PodSecurity admission.
+	PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	PodSecurityAuditLabel   = "pod-security.kubernetes.io/audit"
+	PodSecurityWarnLabel    = "pod-security.kubernetes.io/warn"
+	// PodSecurityLabelSyncLabel enables or disables the synchronization of
+	// the PodSecurity labels of a namespace with the SCCs its service
+	// accounts can use. The operator manages the labels of its namespace
+	// itself.
+	PodSecurityLabelSyncLabel = "security.openshift.io/scc.podSecurityLabelSync"
+
+	// StorageRemovalConfigMapName is the name of the config map that
+	// records the progress of the deletion of the objects of a managed
+	// bucket, so that the deletion resumes after an operator restart.
+	StorageRemovalConfigMapName = "image-registry-storage-removal"
+	// StorageRemovalChunkSize is the default and the largest number of
+	// objects deleted between two checkpoints.
+	StorageRemovalChunkSize = 1000
+	// StorageRemovalObjectsPerSecond is the default rate at which objects
+	// are deleted.
+	StorageRemovalObjectsPerSecond = 1000
+
+	// StorageAuditConfigMapName is the name of the config map with the last
+	// operations of the operator on the cloud resources of the storage.
+	StorageAuditConfigMapName = "image-registry-storage-audit"
+	// StorageAuditKey is the key of StorageAuditConfigMapName with the JSON
+	// encoded operations, the oldest first.
+	StorageAuditKey = "operations.json"
+	// StorageAuditLength is the number of operations kept in the audit
+	// trail.
+	StorageAuditLength = 200
+
+	// StorageMirrorConfigMapName is the name of the config map with the
+	// state of the secondary storage provisioned as a copy target for the
+	// registry storage, as the registry config has no room for it.
+	StorageMirrorConfigMapName = "image-registry-storage-mirror"
 )
 
 var (
 	DeploymentLabels      = map[string]string{"docker-registry": "default"}
+	CanaryLabels          = map[string]string{"docker-registry": "canary"}
+	PullLabels            = map[string]string{"docker-registry": "pull"}
 	DeploymentAnnotations = map[string]string{
 		"target.workload.openshift.io/management": `{"effect": "PreferredDuringScheduling"}`,
 	}
@@ -0,0 +1,424 @@
+// Package doctor collects the health of the image registry in one report:
+// the storage, the pre-signed URLs the registry redirects the downloads to,
+// the service and the routes of the registry, the CA bundle the nodes trust
+// and the image pruner. It is meant to be run in the operator pod, where it
+// has the credentials of the operator and the network of the cluster.
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	regopset "github.com/openshift/client-go/imageregistry/clientset/versioned"
+	routeset "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// requestTimeout is how long the doctor waits for the answer to a request
+// to the registry or to the storage.
+const requestTimeout = 10 * time.Second
+
+// signedURLExpiry is how long the pre-signed URL of the signed URL check is
+// valid.
+const signedURLExpiry = time.Minute
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusOK      Status = "OK"
+	StatusWarning Status = "Warning"
+	StatusFailed  Status = "Failed"
+	StatusSkipped Status = "Skipped"
+)
+
+// Check is the outcome of one of the checks of the doctor.
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+func (c Check) String() string {
+	return fmt.Sprintf("[%s] %s: %s", c.Status, c.Name, c.Message)
+}
+
+// Report is the outcome of all the checks, in the order they were run.
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Failed returns true if at least one check failed.
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// Doctor runs the checks against a cluster.
+type Doctor struct {
+	Kube  kubernetes.Interface
+	RegOp regopset.Interface
+	Route routeset.RoutesGetter
+
+	// ServiceURL is the base URL of the registry service.
+	ServiceURL string
+
+	// newDriver returns the driver of the storage of the registry.
+	newDriver func(cr *imageregistryv1.Config) (storage.Driver, error)
+}
+
+// New returns a doctor that uses newDriver to get the driver of the storage
+// of the registry.
+func New(kube kubernetes.Interface, regop regopset.Interface, route routeset.RoutesGetter, newDriver func(cr *imageregistryv1.Config) (storage.Driver, error)) *Doctor {
+	return &Doctor{
+		Kube:       kube,
+		RegOp:      regop,
+		Route:      route,
+		ServiceURL: fmt.Sprintf("https://%s.%s.svc:%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort),
+		newDriver:  newDriver,
+	}
+}
+
+// Run runs all the checks. An error is returned only when the registry
+// config can not be read, the other problems are reported by the checks.
+func (d *Doctor) Run(ctx context.Context) (*Report, error) {
+	cr, err := d.RegOp.ImageregistryV1().Configs().Get(ctx, defaults.ImageRegistryResourceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the registry config: %w", err)
+	}
+
+	report := &Report{}
+	var driver storage.Driver
+	if cr.Spec.ManagementState != operatorapiv1.Removed {
+		driver, err = d.newDriver(cr)
+	}
+	report.Checks = append(report.Checks,
+		d.checkStorage(cr, driver, err),
+		d.checkSignedURL(ctx, cr, driver),
+		d.checkService(ctx),
+		d.checkRoutes(ctx),
+		d.checkCATrust(ctx),
+		d.checkPruner(ctx),
+	)
+	return report, nil
+}
+
+// checkStorage writes, reads and deletes an object in the storage when the
+// driver can validate the storage, and checks that the storage exists
+// otherwise.
+func (d *Doctor) checkStorage(cr *imageregistryv1.Config, driver storage.Driver, driverErr error) Check {
+	check := Check{Name: "storage"}
+	switch {
+	case cr.Spec.ManagementState == operatorapiv1.Removed:
+		check.Status, check.Message = StatusSkipped, "The registry is removed"
+		return check
+	case driverErr != nil:
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to configure the storage: %s", driverErr)
+		return check
+	}
+
+	if validator, ok := driver.(storage.Validator); ok && !cr.Spec.ReadOnly {
+		if err := validator.Validate(cr.DeepCopy()); err != nil {
+			check.Status, check.Message = StatusFailed, fmt.Sprintf("The %s storage fails validation: %s", util.DriverName(&cr.Spec.Storage), err)
+			return check
+		}
+		check.Status, check.Message = StatusOK, fmt.Sprintf("The operator can write, read and delete objects in the %s storage", util.DriverName(&cr.Spec.Storage))
+		return check
+	}
+
+	exists, err := driver.StorageExists(cr.DeepCopy())
+	switch {
+	case err != nil:
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to access the %s storage: %s", util.DriverName(&cr.Spec.Storage), err)
+	case !exists:
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("The %s storage does not exist", util.DriverName(&cr.Spec.Storage))
+	default:
+		check.Status, check.Message = StatusOK, fmt.Sprintf("The %s storage exists", util.DriverName(&cr.Spec.Storage))
+	}
+	return check
+}
+
+// checkSignedURL signs a URL of the storage, like the URLs the registry
+// redirects the blob downloads to, and downloads it. The object does not
+// exist, an answer that the object is not found shows that the storage
+// accepts the signature.
+func (d *Doctor) checkSignedURL(ctx context.Context, cr *imageregistryv1.Config, driver storage.Driver) Check {
+	check := Check{Name: "signed-url"}
+	signer, ok := driver.(storage.URLSigner)
+	switch {
+	case driver == nil:
+		check.Status, check.Message = StatusSkipped, "The storage is not configured"
+		return check
+	case cr.Spec.DisableRedirect || !driver.Capabilities().SupportsRedirect:
+		check.Status, check.Message = StatusSkipped, "The registry does not redirect the blob downloads to the storage"
+		return check
+	case !ok:
+		check.Status, check.Message = StatusSkipped, fmt.Sprintf("The doctor can not sign URLs of the %s storage", util.DriverName(&cr.Spec.Storage))
+		return check
+	}
+
+	signedURL, err := signer.SignURL(util.ValidationProbeObject, signedURLExpiry)
+	if err != nil {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to sign a URL of the storage: %s", err)
+		return check
+	}
+	resp, err := get(ctx, &http.Client{Timeout: requestTimeout}, signedURL)
+	if err != nil {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to download a pre-signed URL of the storage, the clients of the registry may need spec.disableRedirect: %s", err)
+		return check
+	}
+	if resp.status != http.StatusOK && resp.status != http.StatusNotFound {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("The storage rejected a pre-signed URL: %d: %s", resp.status, resp.body)
+		return check
+	}
+	check.Status, check.Message = StatusOK, "The storage accepts the pre-signed URLs"
+	return check
+}
+
+// checkService sends a request to the health endpoint of the registry
+// through its service, and checks its certificate with the service CA.
+func (d *Doctor) checkService(ctx context.Context) Check {
+	check := Check{Name: "service"}
+	pool, err := d.certPool(ctx, defaults.ImageRegistryOperatorNamespace, defaults.ServiceCAName, "service-ca.crt", false)
+	if err != nil {
+		check.Status, check.Message = StatusFailed, err.Error()
+		return check
+	}
+	resp, err := get(ctx, httpClient(pool), d.ServiceURL+defaults.HealthzRoute)
+	switch {
+	case err != nil:
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to reach the registry at %s: %s", d.ServiceURL, describeError(err))
+	case resp.status != http.StatusOK:
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("The registry at %s is not healthy: %d: %s", d.ServiceURL, resp.status, resp.body)
+	default:
+		check.Status, check.Message = StatusOK, fmt.Sprintf("The registry at %s is healthy", d.ServiceURL)
+	}
+	return check
+}
+
+// checkRoutes sends a request to the health endpoint of the registry through
+// each of its routes. The certificates of the routes are checked with the
+// system roots and the CA of the default ingress certificate.
+func (d *Doctor) checkRoutes(ctx context.Context) Check {
+	check := Check{Name: "routes"}
+	routes, err := d.Route.Routes(defaults.ImageRegistryOperatorNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to list the routes: %s", err)
+		return check
+	}
+	if len(routes.Items) == 0 {
+		check.Status, check.Message = StatusSkipped, "The registry is not exposed by a route"
+		return check
+	}
+	pool, err := d.certPool(ctx, defaults.OpenShiftConfigManagedNamespace, defaults.IngressCAName, "ca-bundle.crt", true)
+	if err != nil {
+		check.Status, check.Message = StatusFailed, err.Error()
+		return check
+	}
+
+	client := httpClient(pool)
+	var hosts, problems []string
+	for _, route := range routes.Items {
+		if route.Spec.Host == "" {
+			continue
+		}
+		hosts = append(hosts, route.Spec.Host)
+		resp, err := get(ctx, client, "https://"+route.Spec.Host+defaults.HealthzRoute)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %s", route.Spec.Host, describeError(err)))
+		case resp.status != http.StatusOK:
+			problems = append(problems, fmt.Sprintf("%s: %d: %s", route.Spec.Host, resp.status, resp.body))
+		}
+	}
+	switch {
+	case len(problems) > 0:
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("The registry can not be reached through its routes: %s", strings.Join(problems, "; "))
+	case len(hosts) == 0:
+		check.Status, check.Message = StatusSkipped, "The routes of the registry have no host yet"
+	default:
+		check.Status, check.Message = StatusOK, fmt.Sprintf("The registry can be reached through %s", strings.Join(hosts, ", "))
+	}
+	return check
+}
+
+// checkCATrust checks that the CA bundle the node-ca daemon installs on the
+// nodes trusts the certificate of the registry service.
+func (d *Doctor) checkCATrust(ctx context.Context) Check {
+	check := Check{Name: "ca-trust"}
+	cm, err := d.Kube.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.ImageRegistryCertificatesName, metav1.GetOptions{})
+	if err != nil {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to get the CA bundle of the nodes: %s", err)
+		return check
+	}
+
+	serviceKey := fmt.Sprintf("%s.%s.svc..%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort)
+	ca, ok := cm.Data[serviceKey]
+	if !ok {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("The config map %s has no CA for %s, the nodes do not trust the registry service", defaults.ImageRegistryCertificatesName, serviceKey)
+		return check
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(ca)) {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("The CA for %s in the config map %s has no certificates", serviceKey, defaults.ImageRegistryCertificatesName)
+		return check
+	}
+
+	serviceCA, err := d.Kube.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.ServiceCAName, metav1.GetOptions{})
+	if err == nil && strings.TrimSpace(serviceCA.Data["service-ca.crt"]) != strings.TrimSpace(ca) {
+		check.Status, check.Message = StatusWarning, fmt.Sprintf("The CA for %s in the config map %s is not the current service CA, the nodes trust the registry once the operator updates it", serviceKey, defaults.ImageRegistryCertificatesName)
+		return check
+	}
+
+	keys := make([]string, 0, len(cm.Data)+len(cm.BinaryData))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	for key := range cm.BinaryData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	check.Status, check.Message = StatusOK, fmt.Sprintf("The nodes trust the CAs of %s", strings.Join(keys, ", "))
+	return check
+}
+
+// checkPruner reports the state of the image pruner and the outcome of its
+// last job.
+func (d *Doctor) checkPruner(ctx context.Context) Check {
+	check := Check{Name: "pruner"}
+	pruner, err := d.RegOp.ImageregistryV1().ImagePruners().Get(ctx, defaults.ImageRegistryImagePrunerResourceName, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		check.Status, check.Message = StatusWarning, "The image pruner is not configured, images are not pruned"
+		return check
+	} else if err != nil {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to get the image pruner: %s", err)
+		return check
+	}
+	if pruner.Spec.Suspend != nil && *pruner.Spec.Suspend {
+		check.Status, check.Message = StatusWarning, "The image pruner is suspended, images are not pruned"
+		return check
+	}
+
+	jobs, err := d.Kube.BatchV1().Jobs(defaults.ImageRegistryOperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "created-by=image-pruner",
+	})
+	if err != nil {
+		check.Status, check.Message = StatusFailed, fmt.Sprintf("Unable to list the jobs of the image pruner: %s", err)
+		return check
+	}
+	job := lastFinishedJob(jobs.Items)
+	if job == nil {
+		check.Status, check.Message = StatusOK, "The image pruner has not run yet"
+		return check
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			check.Status, check.Message = StatusFailed, fmt.Sprintf("The last job of the image pruner, %s, failed: %s: %s", job.Name, cond.Reason, cond.Message)
+			return check
+		}
+	}
+	check.Status, check.Message = StatusOK, fmt.Sprintf("The last job of the image pruner, %s, succeeded", job.Name)
+	return check
+}
+
+// lastFinishedJob returns the most recent of the jobs that have finished, or
+// nil if none has.
+func lastFinishedJob(jobs []batchv1.Job) *batchv1.Job {
+	var last *batchv1.Job
+	for i := range jobs {
+		job := &jobs[i]
+		finished := false
+		for _, cond := range job.Status.Conditions {
+			if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+				finished = true
+			}
+		}
+		if finished && (last == nil || last.CreationTimestamp.Before(&job.CreationTimestamp)) {
+			last = job
+		}
+	}
+	return last
+}
+
+// certPool returns a pool with the certificates of the key of the config map
+// name. The system roots are included when withSystemRoots is set, a
+// missing config map is not an error then.
+func (d *Doctor) certPool(ctx context.Context, namespace, name, key string, withSystemRoots bool) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if withSystemRoots {
+		if systemPool, err := x509.SystemCertPool(); err == nil {
+			pool = systemPool
+		}
+	}
+
+	cm, err := d.Kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) && withSystemRoots {
+		return pool, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get the CA in %s/%s: %w", namespace, name, err)
+	}
+	if !pool.AppendCertsFromPEM([]byte(cm.Data[key])) && !withSystemRoots {
+		return nil, fmt.Errorf("no certificates found in %s/%s", namespace, name)
+	}
+	return pool, nil
+}
+
+func httpClient(pool *x509.CertPool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport, Timeout: requestTimeout}
+}
+
+// response is the status and the beginning of the body of an answer.
+type response struct {
+	status int
+	body   string
+}
+
+func get(ctx context.Context, client *http.Client, url string) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &response{status: resp.StatusCode, body: strings.TrimSpace(string(body))}, nil
+}
+
+// describeError adds a hint to the errors of the verification of a
+// certificate.
+func describeError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &certErr) {
+		return fmt.Sprintf("the certificate is not trusted: %s", err)
+	}
+	return err.Error()
+}
@@ -0,0 +1,268 @@
+package doctor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	imageregistryfakeclient "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
+	routeset "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+)
+
+type fakeRoutes struct {
+	routeset.RouteInterface
+	routes []routev1.Route
+}
+
+func (r *fakeRoutes) List(ctx context.Context, opts metav1.ListOptions) (*routev1.RouteList, error) {
+	return &routev1.RouteList{Items: r.routes}, nil
+}
+
+type fakeRoutesGetter struct {
+	routes []routev1.Route
+}
+
+func (g *fakeRoutesGetter) Routes(namespace string) routeset.RouteInterface {
+	return &fakeRoutes{routes: g.routes}
+}
+
+type validatorDriver struct {
+	storage.Driver
+	err error
+}
+
+func (d *validatorDriver) Validate(cr *imageregistryv1.Config) error {
+	return d.err
+}
+
+// serverCA returns the certificate of the test server as a PEM bundle.
+func serverCA(server *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+// newCA returns a self-signed certificate that does not sign the
+// certificate of the test servers.
+func newCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func newHealthyServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaults.HealthzRoute {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func configMap(namespace, name string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       data,
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := newHealthyServer()
+	defer server.Close()
+	otherCA := newCA(t)
+
+	serviceKey := fmt.Sprintf("%s.%s.svc..%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		kubeObjs   []runtime.Object
+		pruner     *imageregistryv1.ImagePruner
+		routes     []routev1.Route
+		driverErr  error
+		validation error
+		expected   map[string]Status
+		failed     bool
+	}{
+		{
+			name: "healthy registry",
+			kubeObjs: []runtime.Object{
+				configMap(defaults.ImageRegistryOperatorNamespace, defaults.ServiceCAName, map[string]string{"service-ca.crt": serverCA(server)}),
+				configMap(defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryCertificatesName, map[string]string{serviceKey: serverCA(server)}),
+				configMap(defaults.OpenShiftConfigManagedNamespace, defaults.IngressCAName, map[string]string{"ca-bundle.crt": serverCA(server)}),
+				&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+						Name:      "image-pruner-1",
+						Labels:    map[string]string{"created-by": "image-pruner"},
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+					},
+				},
+			},
+			pruner: &imageregistryv1.ImagePruner{ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryImagePrunerResourceName}},
+			routes: []routev1.Route{{Spec: routev1.RouteSpec{Host: serverURL.Host}}},
+			expected: map[string]Status{
+				"storage":    StatusOK,
+				"signed-url": StatusSkipped,
+				"service":    StatusOK,
+				"routes":     StatusOK,
+				"ca-trust":   StatusOK,
+				"pruner":     StatusOK,
+			},
+		},
+		{
+			name: "broken registry",
+			kubeObjs: []runtime.Object{
+				configMap(defaults.ImageRegistryOperatorNamespace, defaults.ServiceCAName, map[string]string{"service-ca.crt": otherCA}),
+				configMap(defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryCertificatesName, map[string]string{}),
+				&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:         defaults.ImageRegistryOperatorNamespace,
+						Name:              "image-pruner-1",
+						Labels:            map[string]string{"created-by": "image-pruner"},
+						CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+					},
+				},
+				&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:         defaults.ImageRegistryOperatorNamespace,
+						Name:              "image-pruner-2",
+						Labels:            map[string]string{"created-by": "image-pruner"},
+						CreationTimestamp: metav1.NewTime(time.Now()),
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}},
+					},
+				},
+			},
+			pruner:     &imageregistryv1.ImagePruner{ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryImagePrunerResourceName}},
+			validation: fmt.Errorf("unable to write the object: AccessDenied"),
+			expected: map[string]Status{
+				"storage":    StatusFailed,
+				"signed-url": StatusSkipped,
+				"service":    StatusFailed,
+				"routes":     StatusSkipped,
+				"ca-trust":   StatusFailed,
+				"pruner":     StatusFailed,
+			},
+			failed: true,
+		},
+		{
+			name: "storage not configured",
+			kubeObjs: []runtime.Object{
+				configMap(defaults.ImageRegistryOperatorNamespace, defaults.ServiceCAName, map[string]string{"service-ca.crt": serverCA(server)}),
+				configMap(defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryCertificatesName, map[string]string{serviceKey: otherCA}),
+			},
+			driverErr: storage.ErrStorageNotConfigured,
+			expected: map[string]Status{
+				"storage":    StatusFailed,
+				"signed-url": StatusSkipped,
+				"service":    StatusOK,
+				"routes":     StatusSkipped,
+				"ca-trust":   StatusWarning,
+				"pruner":     StatusWarning,
+			},
+			failed: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					OperatorSpec: operatorapiv1.OperatorSpec{
+						ManagementState: operatorapiv1.Managed,
+					},
+				},
+			}
+			regopObjs := []runtime.Object{cr}
+			if tt.pruner != nil {
+				regopObjs = append(regopObjs, tt.pruner)
+			}
+
+			d := New(kubefake.NewSimpleClientset(tt.kubeObjs...), imageregistryfakeclient.NewSimpleClientset(regopObjs...), &fakeRoutesGetter{routes: tt.routes}, func(cr *imageregistryv1.Config) (storage.Driver, error) {
+				if tt.driverErr != nil {
+					return nil, tt.driverErr
+				}
+				return &validatorDriver{
+					Driver: emptydir.NewDriver(&imageregistryv1.ImageRegistryConfigStorageEmptyDir{}),
+					err:    tt.validation,
+				}, nil
+			})
+			d.ServiceURL = server.URL
+
+			report, err := d.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Checks) != len(tt.expected) {
+				t.Errorf("expected %d checks, got %d", len(tt.expected), len(report.Checks))
+			}
+			for _, check := range report.Checks {
+				if check.Status != tt.expected[check.Name] {
+					t.Errorf("expected %s to be %s, got %s", check.Name, tt.expected[check.Name], check)
+				}
+			}
+			if report.Failed() != tt.failed {
+				t.Errorf("expected failed %t, got %t", tt.failed, report.Failed())
+			}
+		})
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	server := newHealthyServer()
+	defer server.Close()
+
+	_, err := get(context.Background(), httpClient(nil), server.URL+defaults.HealthzRoute)
+	if err == nil {
+		t.Fatal("expected an error for an untrusted certificate")
+	}
+	if msg := describeError(err); !strings.HasPrefix(msg, "the certificate is not trusted") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
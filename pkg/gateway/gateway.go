@@ -0,0 +1,138 @@
+// Package gateway exposes the registry through Gateway API. The Gateway API
+// types are not vendored, the objects are managed with the dynamic client.
+package gateway
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// HTTPRouteGVR is the resource of the HTTPRoutes.
+var HTTPRouteGVR = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1",
+	Resource: "httproutes",
+}
+
+// BackendTLSPolicyGVR is the resource of the BackendTLSPolicies.
+var BackendTLSPolicyGVR = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1alpha3",
+	Resource: "backendtlspolicies",
+}
+
+// HTTPRoute returns the HTTPRoute that sends the traffic of the hostnames
+// on the parent gateways to the port of the service.
+func HTTPRoute(namespace, name, serviceName string, port int64, gateway *overrides.GatewayOverrides) *unstructured.Unstructured {
+	var parentRefs []interface{}
+	for _, ref := range gateway.ParentRefs {
+		parentRef := map[string]interface{}{
+			"name": ref.Name,
+		}
+		if ref.Namespace != "" {
+			parentRef["namespace"] = ref.Namespace
+		}
+		if ref.SectionName != "" {
+			parentRef["sectionName"] = ref.SectionName
+		}
+		parentRefs = append(parentRefs, parentRef)
+	}
+	var hostnames []interface{}
+	for _, hostname := range gateway.Hostnames {
+		hostnames = append(hostnames, hostname)
+	}
+
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(HTTPRouteGVR.GroupVersion().WithKind("HTTPRoute"))
+	route.SetNamespace(namespace)
+	route.SetName(name)
+	route.Object["spec"] = map[string]interface{}{
+		"parentRefs": parentRefs,
+		"hostnames":  hostnames,
+		"rules": []interface{}{
+			map[string]interface{}{
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"name": serviceName,
+						"port": port,
+					},
+				},
+			},
+		},
+	}
+	return route
+}
+
+// BackendTLSPolicy returns the policy that makes the gateways connect to the
+// service with TLS, and verify its certificate for hostname with the CA
+// bundle in the ca.crt key of the config map caName.
+func BackendTLSPolicy(namespace, name, serviceName, caName, hostname string) *unstructured.Unstructured {
+	policy := &unstructured.Unstructured{}
+	policy.SetGroupVersionKind(BackendTLSPolicyGVR.GroupVersion().WithKind("BackendTLSPolicy"))
+	policy.SetNamespace(namespace)
+	policy.SetName(name)
+	policy.Object["spec"] = map[string]interface{}{
+		"targetRefs": []interface{}{
+			map[string]interface{}{
+				"group": "",
+				"kind":  "Service",
+				"name":  serviceName,
+			},
+		},
+		"validation": map[string]interface{}{
+			"caCertificateRefs": []interface{}{
+				map[string]interface{}{
+					"group": "",
+					"kind":  "ConfigMap",
+					"name":  caName,
+				},
+			},
+			"hostname": hostname,
+		},
+	}
+	return policy
+}
+
+// Apply creates the object, or updates its spec if it differs.
+func Apply(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	objects := client.Resource(gvr).Namespace(obj.GetNamespace())
+	current, err := objects.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if _, err := objects.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		klog.Infof("%s %s/%s created", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(current.Object["spec"], obj.Object["spec"]) {
+		return nil
+	}
+	current = current.DeepCopy()
+	current.Object["spec"] = obj.Object["spec"]
+	if _, err := objects.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	klog.Infof("%s %s/%s updated", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	return nil
+}
+
+// Delete deletes the object if it exists.
+func Delete(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace, name string) error {
+	err := client.Resource(gvr).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
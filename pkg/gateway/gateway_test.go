@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestApplyHTTPRoute(t *testing.T) {
+	ctx := context.Background()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		HTTPRouteGVR:        "HTTPRouteList",
+		BackendTLSPolicyGVR: "BackendTLSPolicyList",
+	})
+	settings := &overrides.GatewayOverrides{
+		ParentRefs: []overrides.GatewayParentRef{{Name: "public", Namespace: "openshift-ingress", SectionName: "https"}},
+		Hostnames:  []string{"registry.example.com"},
+	}
+
+	if err := Apply(ctx, client, HTTPRouteGVR, HTTPRoute("openshift-image-registry", "image-registry", "image-registry", 5000, settings)); err != nil {
+		t.Fatal(err)
+	}
+	routes := client.Resource(HTTPRouteGVR).Namespace("openshift-image-registry")
+	route, err := routes.Get(ctx, "image-registry", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if len(hostnames) != 1 || hostnames[0] != "registry.example.com" {
+		t.Errorf("got hostnames %q, want registry.example.com", hostnames)
+	}
+	parentRefs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	if len(parentRefs) != 1 || parentRefs[0].(map[string]interface{})["sectionName"] != "https" {
+		t.Errorf("unexpected parentRefs %v", parentRefs)
+	}
+
+	settings.Hostnames = []string{"registry.example.com", "registry.example.org"}
+	if err := Apply(ctx, client, HTTPRouteGVR, HTTPRoute("openshift-image-registry", "image-registry", "image-registry", 5000, settings)); err != nil {
+		t.Fatal(err)
+	}
+	route, err = routes.Get(ctx, "image-registry", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames"); len(hostnames) != 2 {
+		t.Errorf("expected the hostnames to be updated, got %q", hostnames)
+	}
+
+	policy := BackendTLSPolicy("openshift-image-registry", "image-registry", "image-registry", "image-registry-gateway-ca", "image-registry.openshift-image-registry.svc")
+	if err := Apply(ctx, client, BackendTLSPolicyGVR, policy); err != nil {
+		t.Fatal(err)
+	}
+	policy, err = client.Resource(BackendTLSPolicyGVR).Namespace("openshift-image-registry").Get(ctx, "image-registry", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostname, _, _ := unstructured.NestedString(policy.Object, "spec", "validation", "hostname"); hostname != "image-registry.openshift-image-registry.svc" {
+		t.Errorf("got hostname %q, want the service name", hostname)
+	}
+
+	if err := Delete(ctx, client, HTTPRouteGVR, "openshift-image-registry", "image-registry"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(ctx, client, HTTPRouteGVR, "openshift-image-registry", "image-registry"); err != nil {
+		t.Errorf("deleting a missing route: %v", err)
+	}
+}
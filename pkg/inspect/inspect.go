@@ -0,0 +1,286 @@
+// Package inspect collects the inspection data of the operator that
+// must-gather bundles: the effective configuration of the registry without
+// its secrets, the state of the storage, the recent reconcile errors and the
+// status of the node-ca daemon set.
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	regopset "github.com/openshift/client-go/imageregistry/clientset/versioned"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+	"github.com/openshift/cluster-image-registry-operator/pkg/version"
+)
+
+// redacted replaces the values that are not included in the data.
+const redacted = "<redacted>"
+
+// nodeCAName is the name of the daemon set that installs the CA bundle of
+// the registry on the nodes.
+const nodeCAName = "node-ca"
+
+// registryContainerName is the name of the registry container of the
+// deployment.
+const registryContainerName = "registry"
+
+// sensitiveEnvName matches the names of the environment variables whose
+// values are secrets.
+var sensitiveEnvName = regexp.MustCompile(`(?i)(SECRET|PASSWORD|TOKEN|ACCESSKEY|ACCOUNTKEY|CREDENTIAL|PRIVATEKEY)`)
+
+// Config is the part of the registry config that drives the deployment.
+type Config struct {
+	ManagementState    operatorapiv1.ManagementState `json:"managementState"`
+	Replicas           int32                         `json:"replicas"`
+	ReadOnly           bool                          `json:"readOnly"`
+	DisableRedirect    bool                          `json:"disableRedirect"`
+	Generation         int64                         `json:"generation"`
+	ObservedGeneration int64                         `json:"observedGeneration"`
+}
+
+// EnvVar is an environment variable of the registry. Secret values are
+// redacted, values read from other objects are replaced by a reference to
+// them.
+type EnvVar struct {
+	Name      string `json:"name"`
+	Value     string `json:"value,omitempty"`
+	ValueFrom string `json:"valueFrom,omitempty"`
+}
+
+// Storage is the state of the storage of the registry.
+type Storage struct {
+	Driver     string                                     `json:"driver"`
+	Status     imageregistryv1.ImageRegistryConfigStorage `json:"status"`
+	Conditions []operatorapiv1.OperatorCondition          `json:"conditions"`
+}
+
+// ReconcileError is a condition that reported a failed reconciliation.
+type ReconcileError struct {
+	Condition string                        `json:"condition"`
+	Status    operatorapiv1.ConditionStatus `json:"status"`
+	Reason    string                        `json:"reason,omitempty"`
+	Message   string                        `json:"message,omitempty"`
+	Time      metav1.Time                   `json:"time"`
+}
+
+// DaemonSetStatus is the rollout status of a daemon set.
+type DaemonSetStatus struct {
+	Name               string `json:"name"`
+	Generation         int64  `json:"generation"`
+	ObservedGeneration int64  `json:"observedGeneration"`
+	Desired            int32  `json:"desired"`
+	Current            int32  `json:"current"`
+	Ready              int32  `json:"ready"`
+	Updated            int32  `json:"updated"`
+	Available          int32  `json:"available"`
+	Unavailable        int32  `json:"unavailable"`
+}
+
+// Data is the inspection data of the operator.
+type Data struct {
+	Version         string           `json:"version"`
+	Config          Config           `json:"config"`
+	Environment     []EnvVar         `json:"environment"`
+	Storage         Storage          `json:"storage"`
+	ReconcileErrors []ReconcileError `json:"reconcileErrors"`
+	NodeCA          *DaemonSetStatus `json:"nodeCA,omitempty"`
+	// Errors are the parts of the data that could not be collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Collect returns the inspection data of the operator. An error is returned
+// only when the registry config can not be read, the data that can not be
+// collected otherwise is reported in Errors.
+func Collect(ctx context.Context, kube kubernetes.Interface, regop regopset.Interface) (*Data, error) {
+	cr, err := regop.ImageregistryV1().Configs().Get(ctx, defaults.ImageRegistryResourceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the registry config: %w", err)
+	}
+
+	data := &Data{
+		Version: version.Version,
+		Config: Config{
+			ManagementState:    cr.Spec.ManagementState,
+			Replicas:           cr.Spec.Replicas,
+			ReadOnly:           cr.Spec.ReadOnly,
+			DisableRedirect:    cr.Spec.DisableRedirect,
+			Generation:         cr.Generation,
+			ObservedGeneration: cr.Status.ObservedGeneration,
+		},
+		Environment:     []EnvVar{},
+		Storage:         storageState(cr),
+		ReconcileErrors: []ReconcileError{},
+	}
+
+	deploy, err := kube.AppsV1().Deployments(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.ImageRegistryName, metav1.GetOptions{})
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("unable to get the registry deployment: %s", err))
+	} else {
+		for _, c := range deploy.Spec.Template.Spec.Containers {
+			if c.Name == registryContainerName {
+				data.Environment = sanitizeEnv(c.Env)
+			}
+		}
+	}
+
+	cm, err := kube.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.ConditionHistoryConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("unable to get the condition history: %s", err))
+		cm = &corev1.ConfigMap{}
+	}
+	data.ReconcileErrors = reconcileErrors(cr, cm)
+
+	ds, err := kube.AppsV1().DaemonSets(defaults.ImageRegistryOperatorNamespace).Get(ctx, nodeCAName, metav1.GetOptions{})
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("unable to get the %s daemon set: %s", nodeCAName, err))
+	} else {
+		data.NodeCA = &DaemonSetStatus{
+			Name:               ds.Name,
+			Generation:         ds.Generation,
+			ObservedGeneration: ds.Status.ObservedGeneration,
+			Desired:            ds.Status.DesiredNumberScheduled,
+			Current:            ds.Status.CurrentNumberScheduled,
+			Ready:              ds.Status.NumberReady,
+			Updated:            ds.Status.UpdatedNumberScheduled,
+			Available:          ds.Status.NumberAvailable,
+			Unavailable:        ds.Status.NumberUnavailable,
+		}
+	}
+
+	return data, nil
+}
+
+// storageState returns the driver, the reconciled storage and the storage
+// conditions of cr.
+func storageState(cr *imageregistryv1.Config) Storage {
+	s := Storage{
+		Driver:     util.DriverName(&cr.Spec.Storage),
+		Status:     cr.Status.Storage,
+		Conditions: []operatorapiv1.OperatorCondition{},
+	}
+	for _, cond := range cr.Status.Conditions {
+		if strings.HasPrefix(cond.Type, "Storage") {
+			s.Conditions = append(s.Conditions, cond)
+		}
+	}
+	return s
+}
+
+// sanitizeEnv returns env without the values of the secrets. The
+// credentials in URLs, such as the ones of the proxies, are redacted too.
+func sanitizeEnv(env []corev1.EnvVar) []EnvVar {
+	result := make([]EnvVar, 0, len(env))
+	for _, e := range env {
+		v := EnvVar{Name: e.Name}
+		switch {
+		case e.ValueFrom != nil:
+			v.ValueFrom = valueFrom(e.ValueFrom)
+		case e.Value == "":
+		case sensitiveEnvName.MatchString(e.Name):
+			v.Value = redacted
+		default:
+			v.Value = redactURL(e.Value)
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// valueFrom returns a reference to the source of the value of an
+// environment variable.
+func valueFrom(source *corev1.EnvVarSource) string {
+	switch {
+	case source.SecretKeyRef != nil:
+		return fmt.Sprintf("secret/%s:%s", source.SecretKeyRef.Name, source.SecretKeyRef.Key)
+	case source.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("configmap/%s:%s", source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key)
+	case source.FieldRef != nil:
+		return fmt.Sprintf("field/%s", source.FieldRef.FieldPath)
+	case source.ResourceFieldRef != nil:
+		return fmt.Sprintf("resource/%s", source.ResourceFieldRef.Resource)
+	}
+	return ""
+}
+
+// redactURL replaces the password of value if it is a URL with one.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	return u.Redacted()
+}
+
+// transition is a recorded change of a condition of the registry config.
+type transition struct {
+	Status  operatorapiv1.ConditionStatus `json:"status"`
+	Reason  string                        `json:"reason,omitempty"`
+	Message string                        `json:"message,omitempty"`
+	Time    metav1.Time                   `json:"time"`
+}
+
+// reconcileErrors returns the storage conditions of cr that report a failed
+// reconciliation, and the transitions of the condition history cm that
+// reported a problem, the most recent first.
+func reconcileErrors(cr *imageregistryv1.Config, cm *corev1.ConfigMap) []ReconcileError {
+	errs := []ReconcileError{}
+	for _, cond := range cr.Status.Conditions {
+		if strings.HasPrefix(cond.Type, "Storage") && util.IsReconcileError(cond) {
+			errs = append(errs, ReconcileError{
+				Condition: cond.Type,
+				Status:    cond.Status,
+				Reason:    cond.Reason,
+				Message:   cond.Message,
+				Time:      cond.LastTransitionTime,
+			})
+		}
+	}
+
+	conditionTypes := make([]string, 0, len(cm.Data))
+	for conditionType := range cm.Data {
+		conditionTypes = append(conditionTypes, conditionType)
+	}
+	sort.Strings(conditionTypes)
+	for _, conditionType := range conditionTypes {
+		var transitions []transition
+		if err := json.Unmarshal([]byte(cm.Data[conditionType]), &transitions); err != nil {
+			continue
+		}
+		for _, t := range transitions {
+			problem := t.Status != operatorapiv1.ConditionTrue
+			if conditionType == operatorapiv1.OperatorStatusTypeDegraded {
+				problem = t.Status == operatorapiv1.ConditionTrue
+			}
+			if problem {
+				errs = append(errs, ReconcileError{
+					Condition: conditionType,
+					Status:    t.Status,
+					Reason:    t.Reason,
+					Message:   t.Message,
+					Time:      t.Time,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[j].Time.Before(&errs[i].Time)
+	})
+	return errs
+}
@@ -33,6 +33,138 @@ var (
 		},
 		[]string{"storage"},
 	)
+	garbageCollectedObjects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_garbage_collected_objects_total",
+			Help: "Number of stale objects deleted by the operator garbage collector, by resource",
+		},
+		[]string{"resource"},
+	)
+	recreatedResources = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_resources_recreated_total",
+			Help: "Number of managed objects deleted by someone else and recreated by the operator, by kind",
+		},
+		[]string{"kind"},
+	)
+	storageTokenAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_token_age_seconds",
+			Help: "Time since the token file used to authenticate against the storage cloud provider (STS, workload identity) was last refreshed",
+		},
+		[]string{"storage"},
+	)
+	storageTokenExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_token_expiry_timestamp_seconds",
+			Help: "Expiration time of the token used to authenticate against the storage cloud provider, in seconds since the epoch",
+		},
+		[]string{"storage"},
+	)
+	storageLastSuccessfulAuth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_last_successful_auth_timestamp_seconds",
+			Help: "Last time the operator successfully authenticated against the storage cloud provider, in seconds since the epoch",
+		},
+		[]string{"storage"},
+	)
+	storageTokenExchangeFailing = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_token_exchange_failing",
+			Help: "Whether the storage cloud provider rejects the exchange of the workload identity token for an access token (1) or not (0)",
+		},
+		[]string{"storage"},
+	)
+	storageUsageBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_usage_bytes",
+			Help: "Approximate size of the layers stored by the image registry for the image streams of a namespace. Layers shared by namespaces are counted in each of them",
+		},
+		[]string{"namespace"},
+	)
+	storageUsageTotalBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "image_registry_storage_usage_total_bytes",
+		Help: "Approximate size of the layers stored by the image registry that are referenced by image streams, shared layers are counted once",
+	})
+	storageLayersBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_layers_bytes",
+			Help: "Approximate size of the layers stored by the image registry that are referenced by image streams, by compression algorithm",
+		},
+		[]string{"compression"},
+	)
+	storageRemovalRemainingObjects = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "image_registry_operator_storage_removal_remaining_objects",
+		Help: "Number of objects of the managed bucket that are still to be deleted while the storage is removed",
+	})
+	storageConsistencyIssues = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_consistency_issues",
+			Help: "Number of inconsistencies between the image metadata and the registry storage found by the last consistency check, by kind",
+		},
+		[]string{"kind"},
+	)
+	storageBenchmarkThroughput = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_benchmark_throughput_bytes_per_second",
+			Help: "Throughput of the blob writes and reads of the last storage benchmark, by operation",
+		},
+		[]string{"operation"},
+	)
+	storageBenchmarkLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_benchmark_latency_seconds",
+			Help: "Latency percentiles of the blob writes and reads of the last storage benchmark, by operation",
+		},
+		[]string{"operation", "quantile"},
+	)
+	storageUsedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_used_bytes",
+			Help: "Total size of the objects in the storage of the image registry, as reported by the storage backend",
+		},
+		[]string{"storage"},
+	)
+	storageObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_objects",
+			Help: "Number of objects in the storage of the image registry, as reported by the storage backend",
+		},
+		[]string{"storage"},
+	)
+	storageUsageErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_registry_operator_storage_usage_errors_total",
+		Help: "Total number of failed measures of the usage of the storage of the image registry.",
+	})
+	storageReconcileErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_storage_reconcile_errors_total",
+			Help: "Number of failed reconciliations of the storage of the image registry, by driver and by the reason of the condition that reports the failure",
+		},
+		[]string{"driver", "reason"},
+	)
+	storageExists = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_exists",
+			Help: "Whether the StorageExists condition of the image registry is True (1) or not (0), by driver",
+		},
+		[]string{"driver"},
+	)
+	servingCertExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_tls_cert_expiry_seconds",
+			Help: "Time left before the serving certificate of the image registry expires, negative once it is expired, by secret",
+		},
+		[]string{"secret"},
+	)
+	clientThrottledRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_registry_operator_client_throttled_requests_total",
+		Help: "Total number of requests to the API server delayed by the client side rate limiter of the operator.",
+	})
+	clientThrottledSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_registry_operator_client_throttled_seconds_total",
+		Help: "Total time requests to the API server waited for the client side rate limiter of the operator.",
+	})
 )
 
 func init() {
@@ -42,5 +174,26 @@ func init() {
 		azurePrimaryKeyCache,
 		imageStreamTags,
 		storageType,
+		garbageCollectedObjects,
+		recreatedResources,
+		storageTokenAge,
+		storageTokenExpiry,
+		storageLastSuccessfulAuth,
+		storageTokenExchangeFailing,
+		storageUsageBytes,
+		storageUsageTotalBytes,
+		storageLayersBytes,
+		storageRemovalRemainingObjects,
+		storageConsistencyIssues,
+		storageBenchmarkThroughput,
+		storageBenchmarkLatency,
+		storageUsedBytes,
+		storageObjects,
+		storageUsageErrors,
+		storageReconcileErrors,
+		storageExists,
+		servingCertExpiry,
+		clientThrottledRequests,
+		clientThrottledSeconds,
 	)
 }
@@ -4,10 +4,13 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/benchmark"
 )
 
 var (
@@ -90,3 +93,124 @@ func AzureKeyCacheHit() {
 func AzureKeyCacheMiss() {
 	azurePrimaryKeyCache.With(map[string]string{"result": "miss"}).Inc()
 }
+
+// ObjectGarbageCollected registers the deletion of a stale object of the given
+// resource (secrets) by the garbage collector.
+func ObjectGarbageCollected(resource string) {
+	garbageCollectedObjects.WithLabelValues(resource).Inc()
+}
+
+// ResourceRecreated registers the recreation of a managed object of the given
+// kind that was deleted by someone else.
+func ResourceRecreated(kind string) {
+	recreatedResources.WithLabelValues(kind).Inc()
+}
+
+// ReportStorageToken reports the age of the token file used by the given
+// storage and, when it is known, the expiration time of the token.
+func ReportStorageToken(stype string, age time.Duration, expiry time.Time) {
+	storageTokenAge.WithLabelValues(stype).Set(age.Seconds())
+	if expiry.IsZero() {
+		storageTokenExpiry.DeleteLabelValues(stype)
+		return
+	}
+	storageTokenExpiry.WithLabelValues(stype).Set(float64(expiry.Unix()))
+}
+
+// StorageAuthSucceeded records a successful authentication against the cloud
+// provider of the given storage.
+func StorageAuthSucceeded(stype string) {
+	storageLastSuccessfulAuth.WithLabelValues(stype).SetToCurrentTime()
+}
+
+// ReportStorageTokenExchange reports whether the cloud provider of the given
+// storage rejects the exchange of the workload identity token.
+func ReportStorageTokenExchange(stype string, failing bool) {
+	value := 0.0
+	if failing {
+		value = 1
+	}
+	storageTokenExchangeFailing.WithLabelValues(stype).Set(value)
+}
+
+// ReportStorageUsage reports the approximate storage usage of the registry
+// per namespace and in total. Namespaces that are not in namespaceBytes are
+// no longer reported.
+func ReportStorageUsage(namespaceBytes map[string]int64, totalBytes int64) {
+	storageUsageBytes.Reset()
+	for namespace, bytes := range namespaceBytes {
+		storageUsageBytes.WithLabelValues(namespace).Set(float64(bytes))
+	}
+	storageUsageTotalBytes.Set(float64(totalBytes))
+}
+
+// ReportStorageCompression reports the approximate size of the layers stored
+// by the registry per compression algorithm.
+func ReportStorageCompression(compressionBytes map[string]int64) {
+	storageLayersBytes.Reset()
+	for compression, bytes := range compressionBytes {
+		storageLayersBytes.WithLabelValues(compression).Set(float64(bytes))
+	}
+}
+
+// ReportStorageRemovalRemaining reports the number of objects of the managed
+// bucket that are still to be deleted.
+func ReportStorageRemovalRemaining(objects int64) {
+	storageRemovalRemainingObjects.Set(float64(objects))
+}
+
+// ReportStorageConsistency reports the inconsistencies found by the last
+// consistency check, by kind. A nil map removes the report.
+func ReportStorageConsistency(issues map[string]int) {
+	storageConsistencyIssues.Reset()
+	for kind, n := range issues {
+		storageConsistencyIssues.WithLabelValues(kind).Set(float64(n))
+	}
+}
+
+// ReportStorageBenchmark reports the measures of the last storage benchmark.
+// A nil result removes them.
+func ReportStorageBenchmark(result *benchmark.Result) {
+	storageBenchmarkThroughput.Reset()
+	storageBenchmarkLatency.Reset()
+	if result == nil {
+		return
+	}
+	for operation, op := range map[string]benchmark.Operation{"write": result.Write, "read": result.Read} {
+		storageBenchmarkThroughput.WithLabelValues(operation).Set(op.ThroughputBytesPerSecond)
+		storageBenchmarkLatency.WithLabelValues(operation, "0.5").Set(op.LatencyP50Seconds)
+		storageBenchmarkLatency.WithLabelValues(operation, "0.99").Set(op.LatencyP99Seconds)
+	}
+}
+
+// StorageReconcileError registers a failed reconciliation of the storage of
+// the given driver.
+func StorageReconcileError(driver, reason string) {
+	storageReconcileErrors.WithLabelValues(driver, reason).Inc()
+}
+
+// ReportStorageExists reports the StorageExists condition of the storage of
+// the given driver. Only the driver in use is reported.
+func ReportStorageExists(driver string, exists bool) {
+	storageExists.Reset()
+	value := 0.0
+	if exists {
+		value = 1
+	}
+	storageExists.WithLabelValues(driver).Set(value)
+}
+
+// ReportServingCertExpiry reports the time left before the serving
+// certificate in the given secret expires. Only the secret in use is
+// reported.
+func ReportServingCertExpiry(secret string, expiry time.Time) {
+	servingCertExpiry.Reset()
+	servingCertExpiry.WithLabelValues(secret).Set(time.Until(expiry).Seconds())
+}
+
+// ClientRequestThrottled reports a request to the API server that waited for
+// the client side rate limiter.
+func ClientRequestThrottled(latency time.Duration) {
+	clientThrottledRequests.Inc()
+	clientThrottledSeconds.Add(latency.Seconds())
+}
@@ -1,11 +1,13 @@
 package metrics
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io"
 	"log"
 	"math/big"
@@ -201,6 +203,54 @@ func TestImagePrunerInstallStatus(t *testing.T) {
 	}
 }
 
+func TestStorageUsageCollector(t *testing.T) {
+	var measureErr error
+	collector := NewStorageUsageCollector(func(ctx context.Context) (string, int64, int64, error) {
+		return "S3", 1 << 30, 42, measureErr
+	}, time.Hour)
+
+	for _, tc := range []struct {
+		name    string
+		err     error
+		objects float64
+	}{
+		{
+			name:    "measured",
+			objects: 42,
+		},
+		{
+			name:    "stale measure is kept",
+			err:     fmt.Errorf("AccessDenied"),
+			objects: 42,
+		},
+		{
+			name: "unsupported storage",
+			err:  ErrStorageUsageUnsupported,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			measureErr = tc.err
+			collector.collect(context.Background())
+
+			resp, err := http.Get("https://localhost:5000/metrics")
+			if err != nil {
+				t.Fatalf("error requesting metrics server: %v", err)
+			}
+
+			metrics := findMetricsByCounter(resp.Body, "image_registry_operator_storage_objects")
+			if tc.objects == 0 {
+				if len(metrics) != 0 {
+					t.Errorf("expected no metric, got %v", metrics)
+				}
+				return
+			}
+			if len(metrics) != 1 || metrics[0].Gauge.GetValue() != tc.objects || metrics[0].Label[0].GetValue() != "S3" {
+				t.Errorf("expected %.0f S3 objects, got %v", tc.objects, metrics)
+			}
+		})
+	}
+}
+
 func findMetricsByCounter(buf io.ReadCloser, name string) []*io_prometheus_client.Metric {
 	defer buf.Close()
 	mf := io_prometheus_client.MetricFamily{}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ErrStorageUsageUnsupported is returned by a StorageUsageFunc when the
+// usage of the storage in use cannot be measured, or when there is no
+// storage.
+var ErrStorageUsageUnsupported = errors.New("the usage of the storage cannot be measured")
+
+// StorageUsageFunc measures the storage of the registry. It returns the type
+// of the storage, the total size and the number of its objects.
+type StorageUsageFunc func(ctx context.Context) (storageType string, bytes, objects int64, err error)
+
+// StorageUsageCollector periodically measures the storage of the registry
+// and reports its size and its number of objects. Measures can list every
+// object of the storage, so they are not done on scrapes.
+type StorageUsageCollector struct {
+	measure  StorageUsageFunc
+	interval time.Duration
+}
+
+func NewStorageUsageCollector(measure StorageUsageFunc, interval time.Duration) *StorageUsageCollector {
+	return &StorageUsageCollector{
+		measure:  measure,
+		interval: interval,
+	}
+}
+
+// Run measures the storage every interval until ctx is done.
+func (c *StorageUsageCollector) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, c.collect, c.interval)
+}
+
+func (c *StorageUsageCollector) collect(ctx context.Context) {
+	storageType, bytes, objects, err := c.measure(ctx)
+	if errors.Is(err, ErrStorageUsageUnsupported) {
+		storageUsedBytes.Reset()
+		storageObjects.Reset()
+		return
+	}
+	if err != nil {
+		// the last measure is kept, the errors counter tells it is stale.
+		klog.Warningf("unable to measure the usage of the storage: %s", err)
+		storageUsageErrors.Inc()
+		return
+	}
+	storageUsedBytes.Reset()
+	storageObjects.Reset()
+	storageUsedBytes.WithLabelValues(storageType).Set(float64(bytes))
+	storageObjects.WithLabelValues(storageType).Set(float64(objects))
+}
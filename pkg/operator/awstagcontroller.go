@@ -27,6 +27,7 @@ import (
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/s3"
 )
 
@@ -221,6 +222,15 @@ func (c *AWSTagController) syncTags() error {
 		return nil
 	}
 
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	if !configOverrides.S3ManagedFeatures().ManagesTagging() {
+		klog.V(5).Infof("tagging of the S3 bucket is managed externally, skipping")
+		return nil
+	}
+
 	// make a copy to avoid changing the cached data
 	cr = cr.DeepCopy()
 
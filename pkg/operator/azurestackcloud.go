@@ -23,6 +23,12 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
+// AzureStackCloudController writes the definition of the Azure cloud the
+// registry runs on to the environment file of the operator
+// (AZURE_ENVIRONMENT_FILEPATH), for clouds that are not known by the Azure
+// SDK. The definition is taken from the image-registry-azure-cloud config
+// map for custom clouds, or from the endpoints of the cloud provider config
+// on Azure Stack Hub.
 type AzureStackCloudController struct {
 	operatorClient        v1helpers.OperatorClient
 	openshiftConfigLister corev1listers.ConfigMapNamespaceLister
@@ -84,7 +90,14 @@ func (c *AzureStackCloudController) processNextWorkItem() bool {
 }
 
 func (c *AzureStackCloudController) getAzureStackCloudConfig() (string, error) {
-	cm, err := c.openshiftConfigLister.Get("cloud-provider-config")
+	cm, err := c.openshiftConfigLister.Get(defaults.AzureCustomCloudConfigMapName)
+	if err == nil {
+		return cm.Data[defaults.AzureCustomCloudKey], nil
+	} else if !errors.IsNotFound(err) {
+		return "", err
+	}
+
+	cm, err = c.openshiftConfigLister.Get("cloud-provider-config")
 	if errors.IsNotFound(err) {
 		return "", nil
 	} else if err != nil {
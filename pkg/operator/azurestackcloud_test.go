@@ -0,0 +1,120 @@
+package operator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestAzureStackCloudSyncConfig(t *testing.T) {
+	const endpoints = `{"name":"AzureStackCloud","storageEndpointSuffix":"local.azurestack.external"}`
+
+	filename := filepath.Join(t.TempDir(), "azurestackcloud.json")
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", filename)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cloud-provider-config",
+			Namespace: defaults.OpenShiftConfigNamespace,
+		},
+		Data: map[string]string{
+			"endpoints": endpoints,
+		},
+	}
+	if err := indexer.Add(cm); err != nil {
+		t.Fatal(err)
+	}
+	c := &AzureStackCloudController{
+		openshiftConfigLister: corev1listers.NewConfigMapLister(indexer).ConfigMaps(defaults.OpenShiftConfigNamespace),
+	}
+
+	if err := c.syncConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != endpoints {
+		t.Errorf("expected the environment file to contain %s, got %s", endpoints, data)
+	}
+
+	// the file is replaced atomically, no temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the environment file, got %d files", len(entries))
+	}
+
+	if err := indexer.Delete(cm); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.syncConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected the environment file to be removed, got %v", err)
+	}
+
+	// removing a file that is already gone is not an error.
+	if err := c.syncConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAzureCustomCloudSyncConfig(t *testing.T) {
+	const custom = `{"name":"ContosoCloud","storageEndpointSuffix":"core.contoso.example"}`
+
+	filename := filepath.Join(t.TempDir(), "cloud.json")
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", filename)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, cm := range []*corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cloud-provider-config",
+				Namespace: defaults.OpenShiftConfigNamespace,
+			},
+			Data: map[string]string{
+				"endpoints": `{"name":"AzureStackCloud"}`,
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.AzureCustomCloudConfigMapName,
+				Namespace: defaults.OpenShiftConfigNamespace,
+			},
+			Data: map[string]string{
+				defaults.AzureCustomCloudKey: custom,
+			},
+		},
+	} {
+		if err := indexer.Add(cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &AzureStackCloudController{
+		openshiftConfigLister: corev1listers.NewConfigMapLister(indexer).ConfigMaps(defaults.OpenShiftConfigNamespace),
+	}
+
+	if err := c.syncConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != custom {
+		t.Errorf("expected the custom cloud definition to take precedence, got %s", data)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	appsapi "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,6 +49,21 @@ func (c *Controller) Bootstrap() error {
 		return fmt.Errorf("unable to get infrastructure resource: %w", err)
 	}
 
+	// vSphere has no default storage backend, but the cluster may have
+	// storage that the registry can use.
+	var decision *storage.BootstrapDecision
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Type == configapiv1.VSpherePlatformType {
+		decision, err = c.decideBootstrapStorage()
+		if err != nil {
+			return err
+		}
+		klog.Infof("storage bootstrap decision: %s: %s", decision.Source, decision.Message)
+		if decision.Provisioned() {
+			platformStorage = decision.Storage
+			replicas = 2
+		}
+	}
+
 	if infra.Status.InfrastructureTopology == configapiv1.SingleReplicaTopologyMode && replicas > 1 {
 		replicas = 1
 	}
@@ -64,8 +80,14 @@ func (c *Controller) Bootstrap() error {
 	}
 
 	rolloutStrategy := appsapi.RollingUpdateDeploymentStrategyType
-	if platformStorage.PVC != nil {
-		if err = c.createPVC(corev1.ReadWriteOnce, platformStorage.PVC.Claim); err != nil {
+	if platformStorage.PVC != nil && decision != nil {
+		// ReadWriteMany claims can be shared by the old and new pods
+		// of a rolling update.
+		if err = c.createPVC(corev1.ReadWriteMany, platformStorage.PVC.Claim, decision.StorageClassName); err != nil {
+			return err
+		}
+	} else if platformStorage.PVC != nil {
+		if err = c.createPVC(corev1.ReadWriteOnce, platformStorage.PVC.Claim, ""); err != nil {
 			return err
 		}
 		rolloutStrategy = appsapi.RecreateDeploymentStrategyType
@@ -89,16 +111,53 @@ func (c *Controller) Bootstrap() error {
 		Status: imageregistryv1.ImageRegistryStatus{},
 	}
 
-	if _, err = c.clients.RegOp.ImageregistryV1().Configs().Create(
+	cr, err = c.clients.RegOp.ImageregistryV1().Configs().Create(
 		context.TODO(), cr, metav1.CreateOptions{},
-	); err != nil {
+	)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if decision == nil {
+		return nil
+	}
+	status := operatorapi.ConditionFalse
+	if decision.Provisioned() {
+		status = operatorapi.ConditionTrue
+	}
+	util.UpdateCondition(cr, defaults.StorageBootstrapped, status, string(decision.Source), decision.Message)
+	_, err = c.clients.RegOp.ImageregistryV1().Configs().UpdateStatus(
+		context.TODO(), cr, metav1.UpdateOptions{},
+	)
+	return err
+}
+
+// decideBootstrapStorage looks for storage the registry can use on platforms
+// without a default storage backend.
+func (c *Controller) decideBootstrapStorage() (*storage.BootstrapDecision, error) {
+	mode, err := storage.GetBootstrapMode(c.listers.StorageListers.OpenShiftConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var classes []*storagev1.StorageClass
+	if mode != storage.BootstrapModeDisabled {
+		list, err := c.clients.Kube.StorageV1().StorageClasses().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list storage classes: %w", err)
+		}
+		for i := range list.Items {
+			classes = append(classes, &list.Items[i])
+		}
+	}
+
+	decision := storage.DecideBootstrapStorage(classes, mode)
+	return &decision, nil
 }
 
-func (c *Controller) createPVC(accessMode corev1.PersistentVolumeAccessMode, claimName string) error {
+// createPVC creates the claim of the registry if it doesn't exist. If
+// storageClassName is empty, the default class of the platform is used.
+func (c *Controller) createPVC(accessMode corev1.PersistentVolumeAccessMode, claimName, storageClassName string) error {
 	// Check that the claim does not exist before creating it
 	if _, err := c.clients.Core.PersistentVolumeClaims(defaults.ImageRegistryOperatorNamespace).Get(
 		context.TODO(), claimName, metav1.GetOptions{},
@@ -108,14 +167,16 @@ func (c *Controller) createPVC(accessMode corev1.PersistentVolumeAccessMode, cla
 		return err
 	}
 
-	// "standard-csi" is the default StorageClass name in 4.11 and newer versions, that was provisioned by the cloud provider
-	storageClassName := "standard-csi"
+	if storageClassName == "" {
+		// "standard-csi" is the default StorageClass name in 4.11 and newer versions, that was provisioned by the cloud provider
+		storageClassName = "standard-csi"
 
-	// This is a Workaround for Bug#1862991 Tracker for removel on Bug#1866240
-	if infra, err := util.GetInfrastructure(c.listers.StorageListers.Infrastructures); err != nil {
-		return err
-	} else if infra.Status.PlatformStatus.Type == configapiv1.OvirtPlatformType {
-		storageClassName = "ovirt-csi-sc"
+		// This is a Workaround for Bug#1862991 Tracker for removel on Bug#1866240
+		if infra, err := util.GetInfrastructure(c.listers.StorageListers.Infrastructures); err != nil {
+			return err
+		} else if infra.Status.PlatformStatus.Type == configapiv1.OvirtPlatformType {
+			storageClassName = "ovirt-csi-sc"
+		}
 	}
 
 	claim := &corev1.PersistentVolumeClaim{
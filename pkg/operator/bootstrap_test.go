@@ -7,8 +7,12 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	kfake "k8s.io/client-go/kubernetes/fake"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -17,8 +21,10 @@ import (
 	configinformers "github.com/openshift/client-go/config/informers/externalversions"
 	imageregistryfakeclient "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
 	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
 func TestBootstrapAWS(t *testing.T) {
@@ -86,3 +92,101 @@ func TestBootstrapAWS(t *testing.T) {
 		t.Errorf("unexpected config: %s", cmp.Diff(expected, config.Spec))
 	}
 }
+
+func TestBootstrapVSphere(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	configObjects := []runtime.Object{
+		&configv1.Infrastructure{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "cluster",
+			},
+			Status: configv1.InfrastructureStatus{
+				PlatformStatus: &configv1.PlatformStatus{
+					Type: configv1.VSpherePlatformType,
+				},
+			},
+		},
+	}
+
+	configClient := configfakeclient.NewSimpleClientset(configObjects...)
+	configInformerFactory := configinformers.NewSharedInformerFactory(configClient, 0)
+
+	imageregistryClient := imageregistryfakeclient.NewSimpleClientset()
+	imageregistryInformerFactory := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, 0)
+
+	kubeClient := kfake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "thin-csi"},
+			Provisioner: "csi.vsphere.vmware.com",
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "ocs-storagecluster-cephfs"},
+			Provisioner: "openshift-storage.cephfs.csi.ceph.com",
+		},
+	)
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+
+	c := &Controller{
+		listers: &client.Listers{
+			StorageListers: client.StorageListers{
+				Infrastructures: configInformerFactory.Config().V1().Infrastructures().Lister(),
+				OpenShiftConfig: kubeInformerFactory.Core().V1().ConfigMaps().Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+			},
+			RegistryConfigs: imageregistryInformerFactory.Imageregistry().V1().Configs().Lister(),
+		},
+		clients: &client.Clients{
+			Kube:  kubeClient,
+			Core:  kubeClient.CoreV1(),
+			RegOp: imageregistryClient,
+		},
+	}
+
+	configInformerFactory.Start(ctx.Done())
+	imageregistryInformerFactory.Start(ctx.Done())
+	kubeInformerFactory.Start(ctx.Done())
+	configInformerFactory.WaitForCacheSync(ctx.Done())
+	imageregistryInformerFactory.WaitForCacheSync(ctx.Done())
+	kubeInformerFactory.WaitForCacheSync(ctx.Done())
+
+	if err := c.Bootstrap(); err != nil {
+		t.Fatalf("bootstrap failed: %v", err)
+	}
+
+	config, err := imageregistryClient.ImageregistryV1().Configs().Get(ctx, "cluster", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := imageregistryv1.ImageRegistrySpec{
+		Storage: imageregistryv1.ImageRegistryConfigStorage{
+			PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+				Claim: defaults.PVCImageRegistryName,
+			},
+		},
+		OperatorSpec: operatorv1.OperatorSpec{
+			ManagementState:  "Managed",
+			LogLevel:         operatorv1.Normal,
+			OperatorLogLevel: operatorv1.Normal,
+		},
+		Replicas:        2,
+		RolloutStrategy: "RollingUpdate",
+	}
+	if !reflect.DeepEqual(config.Spec, expected) {
+		t.Errorf("unexpected config: %s", cmp.Diff(expected, config.Spec))
+	}
+
+	cond := v1helpers.FindOperatorCondition(config.Status.Conditions, defaults.StorageBootstrapped)
+	if cond == nil || cond.Status != operatorv1.ConditionTrue || cond.Reason != "RWXStorageClass" {
+		t.Errorf("unexpected %s condition: %+v", defaults.StorageBootstrapped, cond)
+	}
+
+	claim, err := kubeClient.CoreV1().PersistentVolumeClaims(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.PVCImageRegistryName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *claim.Spec.StorageClassName != "ocs-storagecluster-cephfs" || claim.Spec.AccessModes[0] != corev1.ReadWriteMany {
+		t.Errorf("unexpected claim: class %s, access modes %v", *claim.Spec.StorageClassName, claim.Spec.AccessModes)
+	}
+}
@@ -0,0 +1,122 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+)
+
+const (
+	// resyncPeriodEnv is the environment variable of the operator that sets
+	// the resync period of the informers, as a Go duration.
+	resyncPeriodEnv = "OPERATOR_RESYNC_PERIOD"
+	// kubeAPIQPSEnv is the environment variable of the operator that sets
+	// the number of queries per second each client may send to the API
+	// server.
+	kubeAPIQPSEnv = "OPERATOR_KUBE_API_QPS"
+	// kubeAPIBurstEnv is the environment variable of the operator that sets
+	// the number of queries each client may send at once above its QPS.
+	kubeAPIBurstEnv = "OPERATOR_KUBE_API_BURST"
+
+	// minResyncPeriod is the shortest resync period accepted, resyncs run
+	// every controller over all the cached objects.
+	minResyncPeriod = time.Minute
+
+	// throttledRequestLatency is the time a request has to wait for the
+	// client side rate limiter to be reported as throttled. It matches the
+	// latency client-go starts logging throttled requests at.
+	throttledRequestLatency = 50 * time.Millisecond
+)
+
+// clientSettings holds the tuning of the informers and of the API clients of
+// the operator.
+type clientSettings struct {
+	resyncPeriod time.Duration
+	qps          float32
+	burst        int
+}
+
+// clientSettingsFromEnv reads the client settings from the environment of
+// the operator. Unset variables keep the defaults of the operator and of
+// kubeconfig.
+func clientSettingsFromEnv(kubeconfig *restclient.Config) (clientSettings, error) {
+	settings := clientSettings{
+		resyncPeriod: defaultResyncDuration,
+		qps:          kubeconfig.QPS,
+		burst:        kubeconfig.Burst,
+	}
+	if settings.qps == 0 {
+		settings.qps = restclient.DefaultQPS
+	}
+	if settings.burst == 0 {
+		settings.burst = restclient.DefaultBurst
+	}
+
+	if value := os.Getenv(resyncPeriodEnv); value != "" {
+		period, err := time.ParseDuration(value)
+		if err != nil {
+			return clientSettings{}, fmt.Errorf("invalid %s: %w", resyncPeriodEnv, err)
+		}
+		if period < minResyncPeriod {
+			return clientSettings{}, fmt.Errorf("%s must be at least %s, got %s", resyncPeriodEnv, minResyncPeriod, period)
+		}
+		settings.resyncPeriod = period
+	}
+	if value := os.Getenv(kubeAPIQPSEnv); value != "" {
+		qps, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return clientSettings{}, fmt.Errorf("invalid %s: %w", kubeAPIQPSEnv, err)
+		}
+		if qps <= 0 {
+			return clientSettings{}, fmt.Errorf("%s must be positive, got %s", kubeAPIQPSEnv, value)
+		}
+		settings.qps = float32(qps)
+	}
+	if value := os.Getenv(kubeAPIBurstEnv); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return clientSettings{}, fmt.Errorf("invalid %s: %w", kubeAPIBurstEnv, err)
+		}
+		if burst < 1 {
+			return clientSettings{}, fmt.Errorf("%s must be at least 1, got %d", kubeAPIBurstEnv, burst)
+		}
+		settings.burst = burst
+	}
+	return settings, nil
+}
+
+// restConfig returns a copy of kubeconfig for a new client. The client gets
+// its own rate limiter, which reports the requests it throttles.
+func (s clientSettings) restConfig(kubeconfig *restclient.Config) *restclient.Config {
+	config := restclient.CopyConfig(kubeconfig)
+	config.QPS = s.qps
+	config.Burst = s.burst
+	config.RateLimiter = &throttlingRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(s.qps, s.burst),
+	}
+	return config
+}
+
+// throttlingRateLimiter counts the requests delayed by a client side rate
+// limiter.
+type throttlingRateLimiter struct {
+	flowcontrol.RateLimiter
+}
+
+// Wait waits for a token of the rate limiter and reports the request as
+// throttled if it had to wait.
+func (r *throttlingRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := r.RateLimiter.Wait(ctx)
+	if latency := time.Since(start); latency >= throttledRequestLatency {
+		metrics.ClientRequestThrottled(latency)
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestClientSettingsFromEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		env        map[string]string
+		kubeconfig *restclient.Config
+		expected   clientSettings
+		err        bool
+	}{
+		{
+			name:       "defaults",
+			kubeconfig: &restclient.Config{},
+			expected:   clientSettings{resyncPeriod: defaultResyncDuration, qps: restclient.DefaultQPS, burst: restclient.DefaultBurst},
+		},
+		{
+			name:       "kubeconfig limits",
+			kubeconfig: &restclient.Config{QPS: 20, Burst: 40},
+			expected:   clientSettings{resyncPeriod: defaultResyncDuration, qps: 20, burst: 40},
+		},
+		{
+			name: "tuned",
+			env: map[string]string{
+				resyncPeriodEnv: "30m",
+				kubeAPIQPSEnv:   "50",
+				kubeAPIBurstEnv: "100",
+			},
+			kubeconfig: &restclient.Config{QPS: 20, Burst: 40},
+			expected:   clientSettings{resyncPeriod: 30 * time.Minute, qps: 50, burst: 100},
+		},
+		{
+			name:       "resync period too short",
+			env:        map[string]string{resyncPeriodEnv: "10s"},
+			kubeconfig: &restclient.Config{},
+			err:        true,
+		},
+		{
+			name:       "invalid qps",
+			env:        map[string]string{kubeAPIQPSEnv: "-1"},
+			kubeconfig: &restclient.Config{},
+			err:        true,
+		},
+		{
+			name:       "invalid burst",
+			env:        map[string]string{kubeAPIBurstEnv: "many"},
+			kubeconfig: &restclient.Config{},
+			err:        true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{resyncPeriodEnv, kubeAPIQPSEnv, kubeAPIBurstEnv} {
+				t.Setenv(name, tt.env[name])
+			}
+			settings, err := clientSettingsFromEnv(tt.kubeconfig)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if settings != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, settings)
+			}
+		})
+	}
+}
+
+func TestClientSettingsRestConfig(t *testing.T) {
+	settings := clientSettings{resyncPeriod: defaultResyncDuration, qps: 1, burst: 1}
+	kubeconfig := &restclient.Config{Host: "https://api.example.com"}
+
+	first := settings.restConfig(kubeconfig)
+	second := settings.restConfig(kubeconfig)
+	if kubeconfig.RateLimiter != nil {
+		t.Errorf("expected kubeconfig to be left unchanged")
+	}
+	if first.RateLimiter == second.RateLimiter {
+		t.Errorf("expected each client to get its own rate limiter")
+	}
+	if first.Host != kubeconfig.Host || first.QPS != 1 || first.Burst != 1 {
+		t.Errorf("unexpected config %+v", first)
+	}
+}
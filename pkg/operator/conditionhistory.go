@@ -0,0 +1,126 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// conditionHistoryLength is the number of transitions kept for each
+// condition type.
+const conditionHistoryLength = 20
+
+// conditionHistoryTypes are the conditions whose transitions are recorded.
+// They are the ones that flap when the storage backend is unreliable.
+var conditionHistoryTypes = []string{
+	defaults.StorageExists,
+	operatorv1.OperatorStatusTypeAvailable,
+	operatorv1.OperatorStatusTypeDegraded,
+}
+
+// conditionTransition is a change of the status or of the reason of a
+// condition.
+type conditionTransition struct {
+	Status  operatorv1.ConditionStatus `json:"status"`
+	Reason  string                     `json:"reason,omitempty"`
+	Message string                     `json:"message,omitempty"`
+	Time    metaapi.Time               `json:"time"`
+}
+
+// appendConditionTransitions adds to history the transitions between the
+// conditions prev and cur. The oldest transitions are dropped when there are
+// more than conditionHistoryLength of them. It returns whether history has
+// changed.
+func appendConditionTransitions(history map[string][]conditionTransition, prev, cur []operatorv1.OperatorCondition, now time.Time) bool {
+	changed := false
+	for _, conditionType := range conditionHistoryTypes {
+		c := v1helpers.FindOperatorCondition(cur, conditionType)
+		if c == nil {
+			continue
+		}
+		if p := v1helpers.FindOperatorCondition(prev, conditionType); p != nil && p.Status == c.Status && p.Reason == c.Reason {
+			continue
+		}
+		transitions := append(history[conditionType], conditionTransition{
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+			Time:    metaapi.NewTime(now),
+		})
+		if len(transitions) > conditionHistoryLength {
+			transitions = transitions[len(transitions)-conditionHistoryLength:]
+		}
+		history[conditionType] = transitions
+		changed = true
+	}
+	return changed
+}
+
+// recordConditionHistory stores the transitions between the conditions prev
+// and cur in the ConditionHistoryConfigMapName config map.
+func (c *Controller) recordConditionHistory(prev, cur []operatorv1.OperatorCondition) error {
+	cm, err := c.listers.ConfigMaps.Get(defaults.ConditionHistoryConfigMapName)
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metaapi.ObjectMeta{
+				Name:      defaults.ConditionHistoryConfigMapName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+		}
+	} else if err != nil {
+		return err
+	} else {
+		cm = cm.DeepCopy()
+	}
+
+	history := map[string][]conditionTransition{}
+	for _, conditionType := range conditionHistoryTypes {
+		data, ok := cm.Data[conditionType]
+		if !ok {
+			continue
+		}
+		var transitions []conditionTransition
+		if err := json.Unmarshal([]byte(data), &transitions); err != nil {
+			// The history is only a debugging aid, a damaged one is
+			// started over.
+			continue
+		}
+		history[conditionType] = transitions
+	}
+
+	if !appendConditionTransitions(history, prev, cur, time.Now()) {
+		return nil
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	for conditionType, transitions := range history {
+		data, err := json.Marshal(transitions)
+		if err != nil {
+			return fmt.Errorf("unable to encode the history of the condition %s: %w", conditionType, err)
+		}
+		cm.Data[conditionType] = string(data)
+	}
+
+	if cm.ResourceVersion == "" {
+		_, err = c.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Create(
+			context.TODO(), cm, metaapi.CreateOptions{},
+		)
+		return err
+	}
+	_, err = c.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Update(
+		context.TODO(), cm, metaapi.UpdateOptions{},
+	)
+	return err
+}
@@ -0,0 +1,62 @@
+package operator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestAppendConditionTransitions(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	storage := func(status operatorv1.ConditionStatus, reason string) []operatorv1.OperatorCondition {
+		return []operatorv1.OperatorCondition{
+			{Type: defaults.StorageExists, Status: status, Reason: reason},
+			{Type: operatorv1.OperatorStatusTypeProgressing, Status: status, Reason: reason},
+		}
+	}
+
+	history := map[string][]conditionTransition{}
+	if !appendConditionTransitions(history, nil, storage(operatorv1.ConditionTrue, "S3BucketExists"), now) {
+		t.Fatalf("expected the first condition to be recorded")
+	}
+	if appendConditionTransitions(history, storage(operatorv1.ConditionTrue, "S3BucketExists"), storage(operatorv1.ConditionTrue, "S3BucketExists"), now) {
+		t.Errorf("expected no transition for an unchanged condition")
+	}
+	if !appendConditionTransitions(history, storage(operatorv1.ConditionTrue, "S3BucketExists"), storage(operatorv1.ConditionFalse, "StorageThrottled"), now) {
+		t.Errorf("expected a transition for a changed status")
+	}
+	if !appendConditionTransitions(history, storage(operatorv1.ConditionFalse, "StorageThrottled"), storage(operatorv1.ConditionFalse, "StorageTransientNetwork"), now) {
+		t.Errorf("expected a transition for a changed reason")
+	}
+
+	if _, ok := history[operatorv1.OperatorStatusTypeProgressing]; ok {
+		t.Errorf("unexpected history for the Progressing condition")
+	}
+	transitions := history[defaults.StorageExists]
+	if len(transitions) != 3 {
+		t.Fatalf("expected 3 transitions, got %d: %v", len(transitions), transitions)
+	}
+	last := transitions[2]
+	if last.Status != operatorv1.ConditionFalse || last.Reason != "StorageTransientNetwork" || !last.Time.Time.Equal(now) {
+		t.Errorf("unexpected last transition %+v", last)
+	}
+
+	// The history is bounded, the oldest transitions are dropped.
+	prev := storage(operatorv1.ConditionFalse, "StorageTransientNetwork")
+	for i := 0; i < 2*conditionHistoryLength; i++ {
+		cur := storage(operatorv1.ConditionFalse, fmt.Sprintf("Reason%d", i))
+		appendConditionTransitions(history, prev, cur, now)
+		prev = cur
+	}
+	transitions = history[defaults.StorageExists]
+	if len(transitions) != conditionHistoryLength {
+		t.Fatalf("expected %d transitions, got %d", conditionHistoryLength, len(transitions))
+	}
+	if got, want := transitions[0].Reason, fmt.Sprintf("Reason%d", conditionHistoryLength); got != want {
+		t.Errorf("expected the oldest kept transition to be %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,692 @@
+package operator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1informers "k8s.io/client-go/informers/apps/v1"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	rbacv1informers "k8s.io/client-go/informers/rbac/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+const (
+	storageConsistencyDegraded = "StorageConsistencyDegraded"
+
+	consistencyCheckWorkQueueKey = "instance"
+
+	// consistencyReportMaxEntries is the number of entries of each list
+	// of the report, it keeps the config map under the size limit of the
+	// API server. The counts are always complete.
+	consistencyReportMaxEntries = 1000
+)
+
+// The kinds of inconsistencies of the report.
+const (
+	consistencyBrokenTags            = "brokenTags"
+	consistencyImagesMissingBlobs    = "imagesWithMissingBlobs"
+	consistencyOrphanedBlobs         = "orphanedBlobs"
+	consistencyOrphanedManifestLinks = "orphanedManifestLinks"
+	consistencyOrphanedRepositories  = "orphanedRepositories"
+)
+
+// The messages of the check mode of the hard prune that report the data of
+// the storage that no image references.
+const (
+	checkOrphanedBlobPrefix         = "Would delete blob: "
+	checkOrphanedManifestLinkPrefix = "Would delete manifest link: "
+	checkOrphanedRepositoryPrefix   = "Would delete repository: "
+	// checkMissingBlobMessage is the error of the storage driver for a
+	// blob that does not exist.
+	checkMissingBlobMessage = "blob unknown"
+)
+
+var digestPattern = regexp.MustCompile(`sha256:[0-9a-f]{64}`)
+
+// checkOutput is what the check mode of the hard prune found in the storage.
+type checkOutput struct {
+	orphanedBlobs         []string
+	orphanedManifestLinks []string
+	orphanedRepositories  []string
+	// missingBlobs are the digests of the blobs that are referenced but
+	// not found.
+	missingBlobs map[string]bool
+}
+
+// checkMessageValue returns what follows prefix in a log line, up to the end
+// of the quoted message.
+func checkMessageValue(line, prefix string) (string, bool) {
+	i := strings.Index(line, prefix)
+	if i < 0 {
+		return "", false
+	}
+	value := line[i+len(prefix):]
+	if end := strings.IndexAny(value, "\" "); end >= 0 {
+		value = value[:end]
+	}
+	return value, value != ""
+}
+
+// parseCheckOutput reads the logs of a consistency check job.
+func parseCheckOutput(r io.Reader) (*checkOutput, error) {
+	out := &checkOutput{missingBlobs: map[string]bool{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := checkMessageValue(line, checkOrphanedBlobPrefix); ok {
+			out.orphanedBlobs = append(out.orphanedBlobs, value)
+		} else if value, ok := checkMessageValue(line, checkOrphanedManifestLinkPrefix); ok {
+			out.orphanedManifestLinks = append(out.orphanedManifestLinks, value)
+		} else if value, ok := checkMessageValue(line, checkOrphanedRepositoryPrefix); ok {
+			out.orphanedRepositories = append(out.orphanedRepositories, value)
+		} else if strings.Contains(line, checkMissingBlobMessage) {
+			for _, dgst := range digestPattern.FindAllString(line, -1) {
+				out.missingBlobs[dgst] = true
+			}
+		}
+	}
+	return out, scanner.Err()
+}
+
+// consistencyReport lists the inconsistencies between the image metadata
+// and the registry storage found by a consistency check job.
+type consistencyReport struct {
+	GeneratedAt metav1.Time `json:"generatedAt"`
+	// Job is the consistency check job the report comes from.
+	Job string `json:"job"`
+	// Counts is the number of inconsistencies by kind.
+	Counts map[string]int `json:"counts"`
+	// BrokenTags are the image stream tags whose image does not exist.
+	BrokenTags []string `json:"brokenTags,omitempty"`
+	// ImagesWithMissingBlobs are the images whose manifest or layers are
+	// not in the storage.
+	ImagesWithMissingBlobs []string `json:"imagesWithMissingBlobs,omitempty"`
+	// OrphanedBlobs, OrphanedManifestLinks and OrphanedRepositories are
+	// the data of the storage that no image references, the hard prune
+	// deletes them.
+	OrphanedBlobs         []string `json:"orphanedBlobs,omitempty"`
+	OrphanedManifestLinks []string `json:"orphanedManifestLinks,omitempty"`
+	OrphanedRepositories  []string `json:"orphanedRepositories,omitempty"`
+	// RestoredImageStreams are the image streams of orphaned repositories
+	// that were re-created, when restoreLostImageStreams is set.
+	RestoredImageStreams []string `json:"restoredImageStreams,omitempty"`
+	// Truncated is set when some lists are limited to their first
+	// entries.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// lostImages are the images that were pushed to the orphaned
+	// repositories, by repository.
+	lostImages map[string][]imagev1.Image
+}
+
+// add records the inconsistencies of a kind in the report.
+func (r *consistencyReport) add(kind string, entries []string) []string {
+	sort.Strings(entries)
+	r.Counts[kind] = len(entries)
+	if len(entries) > consistencyReportMaxEntries {
+		r.Truncated = true
+		return entries[:consistencyReportMaxEntries]
+	}
+	return entries
+}
+
+// corrupted returns true if the image metadata references data that is not
+// in the storage. Orphaned data only wastes space.
+func (r *consistencyReport) corrupted() bool {
+	return r.Counts[consistencyBrokenTags] > 0 || r.Counts[consistencyImagesMissingBlobs] > 0
+}
+
+// storageConsistencyCondition returns the condition that reports the last
+// consistency check.
+func storageConsistencyCondition(report *consistencyReport) operatorv1.OperatorCondition {
+	if !report.corrupted() {
+		return operatorv1.OperatorCondition{
+			Type:    storageConsistencyDegraded,
+			Status:  operatorv1.ConditionFalse,
+			Reason:  "AsExpected",
+			Message: fmt.Sprintf("The consistency check %s found no corruption", report.Job),
+		}
+	}
+	return operatorv1.OperatorCondition{
+		Type:    storageConsistencyDegraded,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "CorruptionDetected",
+		Message: fmt.Sprintf("The consistency check %s found %d image stream tags whose image does not exist and %d images with missing blobs, see the %s config map", report.Job, report.Counts[consistencyBrokenTags], report.Counts[consistencyImagesMissingBlobs], defaults.ConsistencyReportConfigMapName),
+	}
+}
+
+// consistencyCheckImageClient can list image streams and images, and restore
+// image streams.
+type consistencyCheckImageClient interface {
+	imageStreamsAndImagesGetter
+	imageset.ImageStreamMappingsGetter
+}
+
+// imageRepository returns the namespace/name repository of a pull spec of
+// the registry, such as
+// image-registry.openshift-image-registry.svc:5000/ns/name@sha256:...
+func imageRepository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 {
+		return ""
+	}
+	name := parts[2]
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	return parts[1] + "/" + name
+}
+
+// ConsistencyCheckController runs the check mode of the hard prune on the
+// schedule of the consistencyCheck maintenance override. Once a job
+// completes, the data it found in the storage is compared with the images
+// and the image streams, and the report is published in a config map, as
+// metrics and by the StorageConsistencyDegraded condition.
+type ConsistencyCheckController struct {
+	coreClient                corev1client.CoreV1Interface
+	batchClient               batchv1client.BatchV1Interface
+	rbacClient                rbacv1client.RbacV1Interface
+	imageClient               consistencyCheckImageClient
+	operatorClient            v1helpers.OperatorClient
+	cronJobLister             batchv1listers.CronJobNamespaceLister
+	jobLister                 batchv1listers.JobNamespaceLister
+	deploymentLister          appsv1listers.DeploymentNamespaceLister
+	clusterRoleBindingLister  rbacv1listers.ClusterRoleBindingLister
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+
+	// reportedJob is the job of the report that is published.
+	reportedJob string
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+func NewConsistencyCheckController(
+	coreClient corev1client.CoreV1Interface,
+	batchClient batchv1client.BatchV1Interface,
+	rbacClient rbacv1client.RbacV1Interface,
+	imageClient consistencyCheckImageClient,
+	operatorClient v1helpers.OperatorClient,
+	cronJobInformer batchv1informers.CronJobInformer,
+	jobInformer batchv1informers.JobInformer,
+	deploymentInformer appsv1informers.DeploymentInformer,
+	clusterRoleBindingInformer rbacv1informers.ClusterRoleBindingInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+) (*ConsistencyCheckController, error) {
+	c := &ConsistencyCheckController{
+		coreClient:                coreClient,
+		batchClient:               batchClient,
+		rbacClient:                rbacClient,
+		imageClient:               imageClient,
+		operatorClient:            operatorClient,
+		cronJobLister:             cronJobInformer.Lister().CronJobs(defaults.ImageRegistryOperatorNamespace),
+		jobLister:                 jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		deploymentLister:          deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		clusterRoleBindingLister:  clusterRoleBindingInformer.Lister(),
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "ConsistencyCheckController"),
+	}
+
+	for _, informer := range []cache.SharedIndexInformer{
+		cronJobInformer.Informer(),
+		jobInformer.Informer(),
+		deploymentInformer.Informer(),
+		clusterRoleBindingInformer.Informer(),
+		imageRegistryConfigInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(c.eventHandler()); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+
+	return c, nil
+}
+
+func (c *ConsistencyCheckController) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(consistencyCheckWorkQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(consistencyCheckWorkQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(consistencyCheckWorkQueueKey) },
+	}
+}
+
+func (c *ConsistencyCheckController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *ConsistencyCheckController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue: %s", obj)
+
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("ConsistencyCheckController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("ConsistencyCheckController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// lastFinishedJob returns the newest consistency check job that finished,
+// with the condition that finished it.
+func lastFinishedJob(jobs []*batchv1.Job) (*batchv1.Job, *batchv1.JobCondition) {
+	jobs = append([]*batchv1.Job(nil), jobs...)
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreationTimestamp.After(jobs[j].CreationTimestamp.Time)
+	})
+	for _, job := range jobs {
+		if finished := storageMigrationJobFinished(job); finished != nil {
+			return job, finished
+		}
+	}
+	return nil, nil
+}
+
+// jobOutput parses the logs of the pod of a consistency check job.
+func (c *ConsistencyCheckController) jobOutput(ctx context.Context, job *batchv1.Job) (*checkOutput, error) {
+	pods, err := c.coreClient.Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"job-name": job.Name}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		logs, err := c.coreClient.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container: resource.ConsistencyCheckContainerName,
+		}).Stream(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the logs of the pod %s: %w", pod.Name, err)
+		}
+		defer logs.Close()
+		return parseCheckOutput(logs)
+	}
+	return nil, fmt.Errorf("the job %s has no succeeded pod", job.Name)
+}
+
+// buildReport compares what the check found in the storage with the images
+// and the image streams.
+func (c *ConsistencyCheckController) buildReport(ctx context.Context, job string, out *checkOutput) (*consistencyReport, error) {
+	orphaned := map[string]bool{}
+	for _, repo := range out.orphanedRepositories {
+		orphaned[repo] = true
+	}
+	lostImages := map[string][]imagev1.Image{}
+
+	images := map[string]bool{}
+	var imagesWithMissingBlobs []string
+	opts := metav1.ListOptions{Limit: imageStreamPageSize}
+	for {
+		var list *imagev1.ImageList
+		err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+			return !errors.IsResourceExpired(err) && ctx.Err() == nil
+		}, func() (err error) {
+			list, err = c.imageClient.Images().List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			image := &list.Items[i]
+			images[image.Name] = true
+			missing := out.missingBlobs[image.Name]
+			for _, layer := range image.DockerImageLayers {
+				missing = missing || out.missingBlobs[layer.Name]
+			}
+			if missing {
+				imagesWithMissingBlobs = append(imagesWithMissingBlobs, image.Name)
+			}
+			if repo := imageRepository(image.DockerImageReference); orphaned[repo] {
+				lostImages[repo] = append(lostImages[repo], *image)
+			}
+		}
+		if list.Continue == "" {
+			break
+		}
+		opts.Continue = list.Continue
+	}
+
+	var brokenTags []string
+	err := listImageStreamPages(ctx, c.imageClient, func(list *imagev1.ImageStreamList) {
+		for _, is := range list.Items {
+			for _, tag := range is.Status.Tags {
+				if len(tag.Items) > 0 && !images[tag.Items[0].Image] {
+					brokenTags = append(brokenTags, fmt.Sprintf("%s/%s:%s", is.Namespace, is.Name, tag.Tag))
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &consistencyReport{
+		GeneratedAt: metav1.Now(),
+		Job:         job,
+		Counts:      map[string]int{},
+		lostImages:  lostImages,
+	}
+	report.BrokenTags = report.add(consistencyBrokenTags, brokenTags)
+	report.ImagesWithMissingBlobs = report.add(consistencyImagesMissingBlobs, imagesWithMissingBlobs)
+	report.OrphanedBlobs = report.add(consistencyOrphanedBlobs, out.orphanedBlobs)
+	report.OrphanedManifestLinks = report.add(consistencyOrphanedManifestLinks, out.orphanedManifestLinks)
+	report.OrphanedRepositories = report.add(consistencyOrphanedRepositories, out.orphanedRepositories)
+	return report, nil
+}
+
+// restoreLostImageStreams re-creates the image streams of the orphaned
+// repositories of the report whose images still exist. Each image is tagged
+// lost-found-<digest> in the image stream of the repository it was pushed
+// to. Repositories whose namespace is gone or whose image stream was
+// re-created in the meantime are left for the hard prune.
+func (c *ConsistencyCheckController) restoreLostImageStreams(ctx context.Context, report *consistencyReport) error {
+	repos := make([]string, 0, len(report.lostImages))
+	for repo := range report.lostImages {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	var errs []error
+	var restored []string
+	for _, repo := range repos {
+		namespace, name, _ := strings.Cut(repo, "/")
+		_, err := c.imageClient.ImageStreams(namespace).Create(ctx, &imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Annotations: map[string]string{
+					defaults.RestoredImageStreamAnnotation: report.Job,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) || errors.IsNotFound(err) || errors.IsForbidden(err) {
+			klog.Infof("not restoring the image stream %s: %s", repo, err)
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("unable to restore the image stream %s: %w", repo, err))
+			continue
+		}
+
+		for _, image := range report.lostImages[repo] {
+			_, err := c.imageClient.ImageStreamMappings(namespace).Create(ctx, &imagev1.ImageStreamMapping{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: namespace,
+					Name:      name,
+				},
+				Image: image,
+				Tag:   defaults.LostFoundTagPrefix + strings.TrimPrefix(image.Name, "sha256:"),
+			}, metav1.CreateOptions{})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to restore the image %s in %s: %w", image.Name, repo, err))
+			}
+		}
+		restored = append(restored, repo)
+		klog.Infof("restored the image stream %s with %d images", repo, len(report.lostImages[repo]))
+	}
+	report.RestoredImageStreams = restored
+	return utilerrors.NewAggregate(errs)
+}
+
+// readReport returns the report of the ConsistencyReportConfigMapName config
+// map, or nil if there is none.
+func (c *ConsistencyCheckController) readReport(ctx context.Context) (*consistencyReport, error) {
+	cm, err := c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(
+		ctx, defaults.ConsistencyReportConfigMapName, metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	report := &consistencyReport{}
+	if err := json.Unmarshal([]byte(cm.Data[defaults.ConsistencyReportKey]), report); err != nil {
+		klog.Warningf("ignoring the invalid consistency report: %s", err)
+		return nil, nil
+	}
+	return report, nil
+}
+
+// writeReport stores the report in the ConsistencyReportConfigMapName config
+// map.
+func (c *ConsistencyCheckController) writeReport(ctx context.Context, report *consistencyReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	cm, err := c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(
+		ctx, defaults.ConsistencyReportConfigMapName, metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		_, err = c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Create(
+			ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ConsistencyReportConfigMapName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string]string{
+					defaults.ConsistencyReportKey: string(data),
+				},
+			}, metav1.CreateOptions{},
+		)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	cm = cm.DeepCopy()
+	cm.Data = map[string]string{
+		defaults.ConsistencyReportKey: string(data),
+	}
+	_, err = c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Update(
+		ctx, cm, metav1.UpdateOptions{},
+	)
+	return err
+}
+
+// removeConsistencyCheck deletes the cron job of the consistency check with
+// its jobs, the report and the condition that reports it.
+func (c *ConsistencyCheckController) removeConsistencyCheck(ctx context.Context, cr *imageregistryv1.Config) error {
+	for _, gen := range []resource.Mutator{
+		resource.NewGeneratorConsistencyCheckCronJob(c.cronJobLister, c.batchClient, nil, nil),
+		resource.NewGeneratorConsistencyCheckClusterRoleBinding(c.clusterRoleBindingLister, c.rbacClient),
+	} {
+		if _, err := gen.Get(); errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := gen.Delete(metav1.DeleteOptions{PropagationPolicy: ptr.To(metav1.DeletePropagationBackground)}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if c.reportedJob != "" || v1helpers.FindOperatorCondition(cr.Status.Conditions, storageConsistencyDegraded) != nil {
+		err := c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(
+			ctx, defaults.ConsistencyReportConfigMapName, metav1.DeleteOptions{},
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		metrics.ReportStorageConsistency(nil)
+		c.reportedJob = ""
+	}
+
+	if v1helpers.FindOperatorCondition(cr.Status.Conditions, storageConsistencyDegraded) == nil {
+		return nil
+	}
+	_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, func(oldStatus *operatorv1.OperatorStatus) error {
+		v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, storageConsistencyDegraded)
+		return nil
+	})
+	return err
+}
+
+func (c *ConsistencyCheckController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	check, err := configOverrides.ConsistencyCheck()
+	if err != nil {
+		return err
+	}
+	if check == nil || cr.Spec.ManagementState != operatorv1.Managed {
+		return c.removeConsistencyCheck(ctx, cr)
+	}
+
+	// the jobs run the registry container, the cron job is created once
+	// the registry is deployed.
+	deployment, err := c.deploymentLister.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, gen := range []resource.Mutator{
+		resource.NewGeneratorConsistencyCheckClusterRoleBinding(c.clusterRoleBindingLister, c.rbacClient),
+		resource.NewGeneratorConsistencyCheckCronJob(c.cronJobLister, c.batchClient, deployment, check),
+	} {
+		if err := resource.ApplyMutator(gen); err != nil {
+			_, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+				Type:    storageConsistencyDegraded,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Error",
+				Message: fmt.Sprintf("Unable to apply %s: %s", resource.Name(gen), err),
+			}))
+			return utilerrors.NewAggregate([]error{err, updateErr})
+		}
+	}
+
+	jobs, err := c.jobLister.List(labels.SelectorFromSet(labels.Set{"created-by": defaults.ConsistencyCheckCronJobName}))
+	if err != nil {
+		return err
+	}
+	job, finished := lastFinishedJob(jobs)
+	if job == nil || job.Name == c.reportedJob {
+		return nil
+	}
+	if finished.Type == batchv1.JobFailed {
+		_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    storageConsistencyDegraded,
+			Status:  operatorv1.ConditionTrue,
+			Reason:  "CheckFailed",
+			Message: fmt.Sprintf("The consistency check %s failed: %s", job.Name, finished.Message),
+		}))
+		if err != nil {
+			return err
+		}
+		c.reportedJob = job.Name
+		return nil
+	}
+
+	report, err := c.readReport(ctx)
+	if err != nil {
+		return err
+	}
+	if report == nil || report.Job != job.Name {
+		out, err := c.jobOutput(ctx, job)
+		if err != nil {
+			return err
+		}
+		if report, err = c.buildReport(ctx, job.Name, out); err != nil {
+			return fmt.Errorf("unable to build the consistency report: %w", err)
+		}
+		if check.RestoreLostImageStreams {
+			// the report is written even if some images could not be
+			// restored, the next check finds them again.
+			if err := c.restoreLostImageStreams(ctx, report); err != nil {
+				klog.Errorf("ConsistencyCheckController: %s", err)
+			}
+		}
+		if err := c.writeReport(ctx, report); err != nil {
+			return fmt.Errorf("unable to write the consistency report: %w", err)
+		}
+		klog.Infof("the consistency check %s found %v", job.Name, report.Counts)
+	}
+
+	metrics.ReportStorageConsistency(report.Counts)
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(storageConsistencyCondition(report))); err != nil {
+		return err
+	}
+	c.reportedJob = job.Name
+	return nil
+}
+
+func (c *ConsistencyCheckController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting ConsistencyCheckController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started ConsistencyCheckController")
+	<-stopCh
+	klog.Infof("Shutting down ConsistencyCheckController")
+}
@@ -0,0 +1,181 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+)
+
+func TestConsistencyReport(t *testing.T) {
+	missing := "sha256:" + strings.Repeat("a", 64)
+	logs := strings.Join([]string{
+		`time="2024-03-10T04:00:01Z" level=info msg="Would delete repository: team-a/old"`,
+		`time="2024-03-10T04:00:01Z" level=info msg="Would delete manifest link: team-a/app@sha256:orphan-manifest"`,
+		`time="2024-03-10T04:00:02Z" level=info msg="Would delete blob: sha256:orphan-blob"`,
+		`time="2024-03-10T04:00:02Z" level=error msg="unable to stat team-b/app@` + missing + `: blob unknown to registry"`,
+		`time="2024-03-10T04:00:03Z" level=info msg="Would free up 1.2 MiB of disk space"`,
+	}, "\n")
+	out, err := parseCheckOutput(strings.NewReader(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := []imagev1.Image{
+		{
+			ObjectMeta:        metav1.ObjectMeta{Name: "sha256:app1"},
+			DockerImageLayers: []imagev1.ImageLayer{{Name: "sha256:base"}},
+		},
+		{
+			ObjectMeta:        metav1.ObjectMeta{Name: "sha256:app2"},
+			DockerImageLayers: []imagev1.ImageLayer{{Name: "sha256:base"}, {Name: missing}},
+		},
+		{
+			// the image stream of the repository it was pushed to was
+			// deleted.
+			ObjectMeta:           metav1.ObjectMeta{Name: "sha256:old1"},
+			DockerImageReference: "image-registry.openshift-image-registry.svc:5000/team-a/old@sha256:old1",
+		},
+	}
+	imageStreams := []imagev1.ImageStream{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app"},
+			Status: imagev1.ImageStreamStatus{
+				Tags: []imagev1.NamedTagEventList{
+					{Tag: "latest", Items: []imagev1.TagEvent{{Image: "sha256:app1"}}},
+					// only the current image of a tag matters.
+					{Tag: "v1", Items: []imagev1.TagEvent{{Image: "sha256:app1"}, {Image: "sha256:deleted"}}},
+					{Tag: "v0", Items: []imagev1.TagEvent{{Image: "sha256:deleted"}}},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "app"},
+			Status: imagev1.ImageStreamStatus{
+				Tags: []imagev1.NamedTagEventList{
+					{Tag: "latest", Items: []imagev1.TagEvent{{Image: "sha256:app2"}}},
+				},
+			},
+		},
+	}
+	imageClient := &fakeRestoreClient{fakeImageClient: &fakeImageClient{images: images}}
+	imageClient.list = func(opts metav1.ListOptions) (*imagev1.ImageStreamList, error) {
+		return &imagev1.ImageStreamList{Items: imageStreams}, nil
+	}
+
+	c := &ConsistencyCheckController{imageClient: imageClient}
+	report, err := c.buildReport(context.Background(), "image-registry-consistency-check-1", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &consistencyReport{
+		GeneratedAt: report.GeneratedAt,
+		Job:         "image-registry-consistency-check-1",
+		Counts: map[string]int{
+			consistencyBrokenTags:            1,
+			consistencyImagesMissingBlobs:    1,
+			consistencyOrphanedBlobs:         1,
+			consistencyOrphanedManifestLinks: 1,
+			consistencyOrphanedRepositories:  1,
+		},
+		BrokenTags:             []string{"team-a/app:v0"},
+		ImagesWithMissingBlobs: []string{"sha256:app2"},
+		OrphanedBlobs:          []string{"sha256:orphan-blob"},
+		OrphanedManifestLinks:  []string{"team-a/app@sha256:orphan-manifest"},
+		OrphanedRepositories:   []string{"team-a/old"},
+		lostImages: map[string][]imagev1.Image{
+			"team-a/old": {images[2]},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected report\n%+v\ngot\n%+v", expected, report)
+	}
+
+	if cond := storageConsistencyCondition(report); cond.Status != operatorv1.ConditionTrue || cond.Reason != "CorruptionDetected" {
+		t.Errorf("expected the corruption to be reported, got %#v", cond)
+	}
+	report.Counts[consistencyBrokenTags] = 0
+	report.Counts[consistencyImagesMissingBlobs] = 0
+	if cond := storageConsistencyCondition(report); cond.Status != operatorv1.ConditionFalse {
+		t.Errorf("orphaned data is not a corruption, got %#v", cond)
+	}
+
+	if err := c.restoreLostImageStreams(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.RestoredImageStreams, []string{"team-a/old"}) {
+		t.Errorf("unexpected restored image streams %v", report.RestoredImageStreams)
+	}
+	if expected := []string{"team-a/old:lost-found-old1"}; !reflect.DeepEqual(imageClient.mappings, expected) {
+		t.Errorf("expected the tags %v, got %v", expected, imageClient.mappings)
+	}
+
+	// an image stream that was re-created in the meantime is not touched.
+	imageClient.existing = map[string]bool{"team-a/old": true}
+	imageClient.mappings = nil
+	if err := c.restoreLostImageStreams(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RestoredImageStreams) != 0 || len(imageClient.mappings) != 0 {
+		t.Errorf("expected the existing image stream to be kept, got %v", imageClient.mappings)
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"image-registry.openshift-image-registry.svc:5000/ns/app@sha256:abc": "ns/app",
+		"default-route.apps.example.com/ns/app:latest":                       "ns/app",
+		"quay.io/org/team/app@sha256:abc":                                    "",
+		"app":                                                                "",
+	} {
+		if repo := imageRepository(ref); repo != expected {
+			t.Errorf("%s: expected %q, got %q", ref, expected, repo)
+		}
+	}
+}
+
+// fakeRestoreClient records the image streams and the tags that are
+// restored.
+type fakeRestoreClient struct {
+	*fakeImageClient
+	existing map[string]bool
+	mappings []string
+}
+
+func (f *fakeRestoreClient) ImageStreams(namespace string) imageset.ImageStreamInterface {
+	return &fakeRestoreImageStreams{ImageStreamInterface: f.fakeImageClient.ImageStreams(namespace), client: f}
+}
+
+func (f *fakeRestoreClient) ImageStreamMappings(namespace string) imageset.ImageStreamMappingInterface {
+	return &fakeImageStreamMappings{client: f}
+}
+
+type fakeRestoreImageStreams struct {
+	imageset.ImageStreamInterface
+	client *fakeRestoreClient
+}
+
+func (f *fakeRestoreImageStreams) Create(ctx context.Context, is *imagev1.ImageStream, opts metav1.CreateOptions) (*imagev1.ImageStream, error) {
+	if f.client.existing[is.Namespace+"/"+is.Name] {
+		return nil, errors.NewAlreadyExists(imagev1.Resource("imagestreams"), is.Name)
+	}
+	return is, nil
+}
+
+type fakeImageStreamMappings struct {
+	imageset.ImageStreamMappingInterface
+	client *fakeRestoreClient
+}
+
+func (f *fakeImageStreamMappings) Create(ctx context.Context, ism *imagev1.ImageStreamMapping, opts metav1.CreateOptions) (*metav1.Status, error) {
+	f.client.mappings = append(f.client.mappings, ism.Namespace+"/"+ism.Name+":"+ism.Tag)
+	return &metav1.Status{}, nil
+}
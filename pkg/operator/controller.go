@@ -2,6 +2,7 @@ package operator
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"reflect"
 	"time"
@@ -33,10 +34,12 @@ import (
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const (
@@ -61,6 +64,10 @@ func (e permanentError) Error() string {
 	return e.Err.Error()
 }
 
+func (e permanentError) Unwrap() error {
+	return e.Err
+}
+
 // NewController returns a controller for openshift image registry objects.
 //
 // This controller keeps track of resources needed in order to have openshift
@@ -134,6 +141,11 @@ func NewController(
 			c.listers.PodDisruptionBudgets = informer.Lister().PodDisruptionBudgets(defaults.ImageRegistryOperatorNamespace)
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := kubeInformerFactory.Autoscaling().V2().HorizontalPodAutoscalers()
+			c.listers.HorizontalPodAutoscalers = informer.Lister().HorizontalPodAutoscalers(defaults.ImageRegistryOperatorNamespace)
+			return informer.Informer()
+		},
 		func() cache.SharedIndexInformer {
 			informer := routeInformerFactory.Route().V1().Routes()
 			c.listers.Routes = informer.Lister().Routes(defaults.ImageRegistryOperatorNamespace)
@@ -174,6 +186,11 @@ func NewController(
 			c.listers.Infrastructures = informer.Lister()
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := configInformerFactory.Config().V1().Networks()
+			c.listers.NetworkConfigs = informer.Lister()
+			return informer.Informer()
+		},
 	} {
 		informer := ctor()
 		if _, err := informer.AddEventHandler(c.handler()); err != nil {
@@ -208,14 +225,31 @@ func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
 		return err
 	}
 
-	err = c.generator.Apply(cr)
+	target, staged, err := c.stageChanges(cr)
+	if err != nil {
+		return fmt.Errorf("unable to stage the changes of the registry config: %w", err)
+	}
+
+	err = c.generator.Apply(target)
+	if target != cr {
+		cr.Status = target.Status
+	}
+	var storageErr *storageutil.StorageError
+	var recreationErr *resource.RecreationError
 	if err == storage.ErrStorageNotConfigured {
 		return newPermanentError("StorageNotConfigured", err)
+	} else if goerrors.As(err, &storageErr) && storageErr.Permanent() {
+		return newPermanentError(storageErr.Reason(), err)
+	} else if goerrors.As(err, &recreationErr) && recreationErr.Halted {
+		return newPermanentError("ResourceRecreationHalted", err)
 	} else if err != nil {
 		return err
 	}
 
-	return nil
+	if !staged {
+		return c.removeStagedChanges()
+	}
+	return c.recordAppliedSpec(target, target == cr)
 }
 
 // getRoutes returns a list of all routes configured for the image registry, including
@@ -278,11 +312,21 @@ func (c *Controller) sync() error {
 		deploy = deploy.DeepCopy() // make sure we won't corrupt the cached vesrion
 	}
 
+	canary, err := c.listers.Deployments.Get(defaults.ImageRegistryCanaryName)
+	if errors.IsNotFound(err) {
+		canary = nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get %q deployment: %s", defaults.ImageRegistryCanaryName, err)
+	}
+
 	routes, err := c.getRoutes(cr)
 	if err != nil {
 		return err
 	}
 	c.syncStatus(cr, deploy, routes, applyError)
+	syncCanaryStatus(cr, canary, applyError)
+	syncRollbackStatus(cr, applyError)
+	syncStorageWritableStatus(cr, applyError)
 
 	metadataChanged := strategy.Metadata(prevCR.ObjectMeta.DeepCopy(), &cr.ObjectMeta)
 	specChanged := !reflect.DeepEqual(prevCR.Spec, cr.Spec)
@@ -348,8 +392,14 @@ func (c *Controller) sync() error {
 			}
 			return err
 		}
+
+		if err := c.recordConditionHistory(prevCR.Status.Conditions, cr.Status.Conditions); err != nil {
+			klog.Errorf("unable to record the condition history: %s", err)
+		}
 	}
 
+	c.requeueDeferredRollout(cr)
+
 	if _, ok := applyError.(permanentError); !ok {
 		return applyError
 	}
@@ -357,6 +407,24 @@ func (c *Controller) sync() error {
 	return nil
 }
 
+// requeueDeferredRollout schedules a sync for when the maintenance window
+// opens if a rollout of the registry is deferred to it.
+func (c *Controller) requeueDeferredRollout(cr *imageregistryv1.Config) {
+	if storageutil.FetchCondition(cr, defaults.RolloutDeferred).Status != operatorv1.ConditionTrue {
+		return
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return
+	}
+	window, err := configOverrides.MaintenanceWindow()
+	if err != nil || window == nil {
+		return
+	}
+	now := time.Now()
+	c.workqueue.AddAfter(workqueueKey, window.NextStart(now).Sub(now))
+}
+
 func (c *Controller) eventProcessor() {
 	for {
 		obj, shutdown := c.workqueue.Get()
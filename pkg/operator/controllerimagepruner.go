@@ -23,6 +23,7 @@ import (
 	"k8s.io/klog/v2"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	buildset "github.com/openshift/client-go/build/clientset/versioned/typed/build/v1"
 	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
 	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
 	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
@@ -49,6 +50,7 @@ var (
 func NewImagePrunerController(
 	kubeClient kubeclient.Interface,
 	imageregistryClient imageregistryclient.Interface,
+	buildClient buildset.BuildV1Interface,
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	regopInformerFactory imageregistryinformers.SharedInformerFactory,
 	imageConfigInformer configv1informers.ImageInformer,
@@ -71,6 +73,7 @@ func NewImagePrunerController(
 	c.clients.Kube = kubeClient
 	c.clients.RegOp = imageregistryClient
 	c.clients.Batch = kubeClient.BatchV1()
+	c.clients.Build = buildClient
 
 	for _, ctor := range []func() cache.SharedIndexInformer{
 		func() cache.SharedIndexInformer {
@@ -236,8 +239,9 @@ func (c *ImagePrunerController) sync() error {
 	if len(prunerJobs) > 0 {
 		sort.Sort(sort.Reverse(byCreationTimestamp(prunerJobs)))
 		for _, job := range prunerJobs {
-			// skip not finished jobs.
-			if len(job.Status.Conditions) == 0 {
+			// skip not finished jobs, and jobs held back by the
+			// prune interlock.
+			if len(job.Status.Conditions) == 0 || job.Status.StartTime == nil {
 				continue
 			}
 			lastPrunerJobConditions = job.Status.Conditions
@@ -245,6 +249,11 @@ func (c *ImagePrunerController) sync() error {
 		}
 	}
 
+	deferred, err := c.syncPruneInterlock(pcr, prunerJobs)
+	if err != nil {
+		return err
+	}
+
 	c.syncPrunerStatus(pcr, applyError, prunerCronJob, lastPrunerJobConditions)
 
 	metadataChanged := strategy.Metadata(&prevPCR.ObjectMeta, &pcr.ObjectMeta)
@@ -293,6 +302,10 @@ func (c *ImagePrunerController) sync() error {
 		}
 	}
 
+	if deferred {
+		c.workqueue.AddAfter(imagePrunerWorkQueueKey, pruneInterlockRecheckInterval)
+	}
+
 	if _, ok := applyError.(permanentError); !ok {
 		return applyError
 	}
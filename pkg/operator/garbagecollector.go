@@ -0,0 +1,371 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+const (
+	// garbageCollectionInterval is the time between two garbage
+	// collections.
+	garbageCollectionInterval = time.Hour
+
+	// garbageCollectionCheckInterval is how often the controller checks
+	// whether a garbage collection is due. It is shorter than the interval
+	// so that a collection deferred to the maintenance window starts soon
+	// after the window opens.
+	garbageCollectionCheckInterval = 10 * time.Minute
+
+	// garbageCollectionMinAge is the minimum age of an object before it can
+	// be garbage collected. It protects objects that were just created and
+	// are not referenced yet.
+	garbageCollectionMinAge = time.Hour
+)
+
+// legacyGeneratedSecrets are the names of the secrets that earlier versions
+// of the operator generated before they were labeled.
+var legacyGeneratedSecrets = map[string]bool{
+	// The CA of the client authentication listener.
+	"image-registry-client-ca": true,
+}
+
+// GarbageCollectorController is a controller that runs from time to time and
+// deletes the secrets that are left behind in the registry namespace by
+// earlier versions of the operator and are no longer referenced. Old
+// ReplicaSets are left to the deployment controller, which keeps as many as
+// the revision history limit of the deployment.
+type GarbageCollectorController struct {
+	eventRecorder    events.Recorder
+	operatorClient   v1helpers.OperatorClient
+	coreClient       coreset.CoreV1Interface
+	configLister     imageregistrylisters.ConfigLister
+	deploymentLister appslisters.DeploymentNamespaceLister
+	replicaSetLister appslisters.ReplicaSetNamespaceLister
+	secretLister     corelisters.SecretNamespaceLister
+	caches           []cache.InformerSynced
+	lastCollection   time.Time
+}
+
+// NewGarbageCollectorController returns a new GarbageCollectorController.
+func NewGarbageCollectorController(
+	eventRecorder events.Recorder,
+	operatorClient v1helpers.OperatorClient,
+	coreClient coreset.CoreV1Interface,
+	configInformer imageregistryinformers.ConfigInformer,
+	deploymentInformer appsinformers.DeploymentInformer,
+	replicaSetInformer appsinformers.ReplicaSetInformer,
+	secretInformer coreinformers.SecretInformer,
+) *GarbageCollectorController {
+	return &GarbageCollectorController{
+		eventRecorder:    eventRecorder,
+		operatorClient:   operatorClient,
+		coreClient:       coreClient,
+		configLister:     configInformer.Lister(),
+		deploymentLister: deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		replicaSetLister: replicaSetInformer.Lister().ReplicaSets(defaults.ImageRegistryOperatorNamespace),
+		secretLister:     secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		caches: []cache.InformerSynced{
+			configInformer.Informer().HasSynced,
+			deploymentInformer.Informer().HasSynced,
+			replicaSetInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// collectIfDue runs a garbage collection when the last one is older than
+// the garbage collection interval.
+func (c *GarbageCollectorController) collectIfDue(ctx context.Context) {
+	if time.Since(c.lastCollection) < garbageCollectionInterval {
+		return
+	}
+	if c.collect(ctx) {
+		c.lastCollection = time.Now()
+	}
+}
+
+// collect deletes the stale objects and returns false if the collection is
+// deferred to the maintenance window. Nothing is deleted unless the registry
+// is managed and its deployment exists, as the deployment is the source of
+// truth for what is still referenced.
+func (c *GarbageCollectorController) collect(ctx context.Context) bool {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return true
+	} else if err != nil {
+		klog.Errorf("unable to get registry config: %s", err)
+		return true
+	}
+	if cr.Spec.ManagementState != operatorv1.Managed {
+		klog.V(4).Infof("registry is not managed, skipping garbage collection")
+		return true
+	}
+
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		klog.Errorf("unable to get registry config overrides: %s", err)
+		return true
+	}
+	window, err := configOverrides.MaintenanceWindow()
+	if err != nil {
+		klog.Errorf("unable to get the maintenance window: %s", err)
+		return true
+	}
+	if now := time.Now(); !window.Open(now) {
+		next := window.NextStart(now)
+		klog.V(4).Infof("outside of the maintenance window, deferring garbage collection until %s", next)
+		c.updateDeferredCondition(ctx, true, fmt.Sprintf("Garbage collection is deferred to the maintenance window starting at %s", next.Format(time.RFC3339)))
+		return false
+	}
+	c.updateDeferredCondition(ctx, false, "")
+
+	if _, err := c.deploymentLister.Get(defaults.ImageRegistryName); errors.IsNotFound(err) {
+		klog.V(4).Infof("registry deployment does not exist, skipping garbage collection")
+		return true
+	} else if err != nil {
+		klog.Errorf("unable to get registry deployment: %s", err)
+		return true
+	}
+
+	deployments, err := c.deploymentLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("unable to list deployments: %s", err)
+		return true
+	}
+	replicaSets, err := c.replicaSetLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("unable to list replica sets: %s", err)
+		return true
+	}
+
+	protected, err := protectedSecrets(configOverrides)
+	if err != nil {
+		klog.Errorf("unable to get the secrets used by the registry: %s", err)
+		return true
+	}
+
+	if err := c.collectSecrets(ctx, deployments, replicaSets, protected); err != nil {
+		klog.Errorf("unable to garbage collect secrets: %s", err)
+	}
+	return true
+}
+
+// updateDeferredCondition reports whether the garbage collection is
+// deferred. The condition is only added to the registry config once a
+// collection has been deferred.
+func (c *GarbageCollectorController) updateDeferredCondition(ctx context.Context, deferred bool, message string) {
+	cond := operatorv1.OperatorCondition{
+		Type:    defaults.GarbageCollectionDeferred,
+		Status:  operatorv1.ConditionFalse,
+		Reason:  "AsExpected",
+		Message: message,
+	}
+	if deferred {
+		cond.Status = operatorv1.ConditionTrue
+		cond.Reason = "OutsideMaintenanceWindow"
+	}
+	_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, func(status *operatorv1.OperatorStatus) error {
+		if !deferred && v1helpers.FindOperatorCondition(status.Conditions, cond.Type) == nil {
+			return nil
+		}
+		v1helpers.SetOperatorCondition(&status.Conditions, cond)
+		return nil
+	})
+	if err != nil {
+		klog.Errorf("unable to update the %s condition: %s", cond.Type, err)
+	}
+}
+
+func (c *GarbageCollectorController) collectSecrets(ctx context.Context, deployments []*appsapi.Deployment, replicaSets []*appsapi.ReplicaSet, protected map[string]bool) error {
+	secrets, err := c.secretLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range staleSecrets(deployments, replicaSets, secrets, protected, time.Now()) {
+		err := c.coreClient.Secrets(secret.Namespace).Delete(ctx, secret.Name, metaapi.DeleteOptions{
+			Preconditions: &metaapi.Preconditions{UID: &secret.UID},
+		})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to delete secret %s: %w", secret.Name, err)
+		}
+		klog.Infof("garbage collected unreferenced secret %s", secret.Name)
+		c.eventRecorder.Eventf("GarbageCollected", "Deleted unreferenced secret %s", secret.Name)
+		metrics.ObjectGarbageCollected("secrets")
+	}
+	return nil
+}
+
+// protectedSecrets returns the names of the secrets that the operator
+// manages or reads for the registry without mounting them into its pods.
+// They are never stale.
+func protectedSecrets(configOverrides overrides.ConfigOverrides) (map[string]bool, error) {
+	protected := map[string]bool{
+		defaults.ImageRegistryPrivateConfiguration:     true,
+		defaults.ImageRegistryPrivateConfigurationUser: true,
+		defaults.InstallationPullSecret:                true,
+		defaults.CloudCredentialsName:                  true,
+	}
+	source, err := configOverrides.StorageCredentialsSource()
+	if err != nil {
+		return nil, err
+	}
+	if source != nil {
+		protected[source.SecretName] = true
+	}
+	return protected, nil
+}
+
+// staleSecrets returns the secrets that are left behind by earlier versions
+// of the operator and are not referenced by the pod template of any
+// deployment or replica set. A secret is left behind if it is controlled by
+// a deployment or a replica set that no longer exists, or if it is generated
+// by the operator and nothing else owns or manages it.
+func staleSecrets(deployments []*appsapi.Deployment, replicaSets []*appsapi.ReplicaSet, secrets []*corev1.Secret, protected map[string]bool, now time.Time) []*corev1.Secret {
+	existing := map[types.UID]bool{}
+	referenced := map[string]bool{}
+	for _, d := range deployments {
+		existing[d.UID] = true
+		for _, name := range podSpecSecretNames(&d.Spec.Template.Spec) {
+			referenced[name] = true
+		}
+	}
+	for _, rs := range replicaSets {
+		existing[rs.UID] = true
+		for _, name := range podSpecSecretNames(&rs.Spec.Template.Spec) {
+			referenced[name] = true
+		}
+	}
+
+	var stale []*corev1.Secret
+	for _, secret := range secrets {
+		if secret.DeletionTimestamp != nil || referenced[secret.Name] || protected[secret.Name] {
+			continue
+		}
+		if now.Sub(secret.CreationTimestamp.Time) < garbageCollectionMinAge {
+			continue
+		}
+		if !orphanedSecret(secret, existing) {
+			continue
+		}
+		stale = append(stale, secret)
+	}
+	return stale
+}
+
+// orphanedSecret returns whether secret is controlled by a workload that no
+// longer exists, or is a generated secret that nothing else manages.
+func orphanedSecret(secret *corev1.Secret, existing map[types.UID]bool) bool {
+	if ref := metaapi.GetControllerOf(secret); ref != nil {
+		if ref.Kind != "Deployment" && ref.Kind != "ReplicaSet" {
+			return false
+		}
+		return !existing[ref.UID]
+	}
+	if len(secret.OwnerReferences) > 0 || !generatedSecret(secret) {
+		return false
+	}
+	switch secret.Type {
+	case corev1.SecretTypeServiceAccountToken, corev1.SecretTypeDockercfg, corev1.SecretTypeDockerConfigJson:
+		return false
+	}
+	// Secrets managed by other controllers, such as the service serving
+	// certificates, or requests to other controllers of the operator.
+	for key := range secret.Annotations {
+		if strings.HasPrefix(key, "service.beta.openshift.io/") || strings.HasPrefix(key, "service.alpha.openshift.io/") || key == corev1.ServiceAccountNameKey {
+			return false
+		}
+	}
+	if _, ok := secret.Labels[defaults.StorageAccessRequestLabel]; ok {
+		return false
+	}
+	return true
+}
+
+// generatedSecret returns whether secret is generated by the operator. The
+// name of a secret is not enough, as users and other controllers can create
+// secrets with the prefix of the registry resources.
+func generatedSecret(secret *corev1.Secret) bool {
+	if _, ok := secret.Labels[defaults.GeneratedSecretLabel]; ok {
+		return true
+	}
+	return legacyGeneratedSecrets[secret.Name]
+}
+
+// podSpecSecretNames returns the names of all secrets referenced by spec.
+func podSpecSecretNames(spec *corev1.PodSpec) []string {
+	var names []string
+	for _, ref := range spec.ImagePullSecrets {
+		names = append(names, ref.Name)
+	}
+	for _, vol := range spec.Volumes {
+		if vol.Secret != nil {
+			names = append(names, vol.Secret.SecretName)
+		}
+		if vol.Projected != nil {
+			for _, source := range vol.Projected.Sources {
+				if source.Secret != nil {
+					names = append(names, source.Secret.Name)
+				}
+			}
+		}
+	}
+	containers := append([]corev1.Container{}, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				names = append(names, env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				names = append(names, envFrom.SecretRef.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *GarbageCollectorController) Run(ctx context.Context) {
+	klog.Infof("Starting GarbageCollectorController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.collectIfDue, garbageCollectionCheckInterval)
+	klog.Infof("Started GarbageCollectorController")
+	<-ctx.Done()
+	klog.Infof("Shutting down GarbageCollectorController")
+}
@@ -0,0 +1,201 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestStaleSecrets(t *testing.T) {
+	now := time.Now()
+	old := metaapi.NewTime(now.Add(-2 * time.Hour))
+
+	deploy := &appsapi.Deployment{
+		Spec: appsapi.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "volume",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{SecretName: "image-registry-mounted"},
+							},
+						},
+						{
+							Name: "projected",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected"}}},
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Env: []corev1.EnvVar{
+								{
+									Name: "KEY",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{Name: "env"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	rollback := &appsapi.ReplicaSet{
+		ObjectMeta: metaapi.ObjectMeta{UID: "rollback"},
+		Spec: appsapi.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "image-registry-rollback"}},
+				},
+			},
+		},
+	}
+
+	secret := func(name string, created metaapi.Time) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metaapi.ObjectMeta{Name: name, CreationTimestamp: created},
+		}
+	}
+	ownedBy := func(s *corev1.Secret, kind string, uid types.UID) *corev1.Secret {
+		s.OwnerReferences = []metaapi.OwnerReference{
+			{Kind: kind, Name: "owner", UID: uid, Controller: ptr.To(true)},
+		}
+		return s
+	}
+	annotated := func(s *corev1.Secret, key string) *corev1.Secret {
+		s.Annotations = map[string]string{key: "value"}
+		return s
+	}
+	generated := func(s *corev1.Secret) *corev1.Secret {
+		s.Labels = map[string]string{defaults.GeneratedSecretLabel: "true"}
+		return s
+	}
+
+	secrets := []*corev1.Secret{
+		secret(defaults.ImageRegistryPrivateConfiguration, old),
+		secret(defaults.ImageRegistryPrivateConfigurationUser, old),
+		secret(defaults.InstallationPullSecret, old),
+		generated(secret("image-registry-mounted", old)),
+		generated(secret("projected", old)),
+		generated(secret("env", old)),
+		generated(secret("image-registry-rollback", old)),
+		generated(secret("image-registry-orphan", old)),
+		generated(secret("image-registry-just-created", metaapi.NewTime(now))),
+		secret("image-registry-client-ca", old),
+		secret("image-registry-credentials-source", old),
+		secret("image-registry-user-secret", old),
+		secret("user-secret", old),
+		ownedBy(secret("owned-by-deleted-replica-set", old), "ReplicaSet", "deleted"),
+		ownedBy(secret("owned-by-replica-set", old), "ReplicaSet", "rollback"),
+		ownedBy(generated(secret("image-registry-owned-by-service", old)), "Service", "deleted"),
+		annotated(generated(secret("image-registry-serving-cert", old)), "service.beta.openshift.io/originating-service-name"),
+		annotated(generated(secret("image-registry-token", old)), corev1.ServiceAccountNameKey),
+	}
+	protected := map[string]bool{
+		defaults.ImageRegistryPrivateConfiguration:     true,
+		defaults.ImageRegistryPrivateConfigurationUser: true,
+		defaults.InstallationPullSecret:                true,
+		"image-registry-credentials-source":            true,
+	}
+
+	var names []string
+	for _, s := range staleSecrets([]*appsapi.Deployment{deploy}, []*appsapi.ReplicaSet{rollback}, secrets, protected, now) {
+		names = append(names, s.Name)
+	}
+
+	expected := []string{"image-registry-orphan", "image-registry-client-ca", "owned-by-deleted-replica-set"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected stale secrets %v, got %v", expected, names)
+	}
+}
+
+func TestCollectSecrets(t *testing.T) {
+	old := metaapi.NewTime(time.Now().Add(-2 * time.Hour))
+	orphan := &corev1.Secret{
+		ObjectMeta: metaapi.ObjectMeta{
+			Name:              "image-registry-orphan",
+			Namespace:         defaults.ImageRegistryOperatorNamespace,
+			Labels:            map[string]string{defaults.GeneratedSecretLabel: "true"},
+			CreationTimestamp: old,
+		},
+	}
+	unlabeled := &corev1.Secret{
+		ObjectMeta: metaapi.ObjectMeta{
+			Name:              "image-registry-foo",
+			Namespace:         defaults.ImageRegistryOperatorNamespace,
+			CreationTimestamp: old,
+		},
+	}
+	kept := &corev1.Secret{
+		ObjectMeta: metaapi.ObjectMeta{
+			Name:              defaults.ImageRegistryPrivateConfiguration,
+			Namespace:         defaults.ImageRegistryOperatorNamespace,
+			CreationTimestamp: old,
+		},
+	}
+
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, s := range []*corev1.Secret{orphan, unlabeled, kept} {
+		if err := secretIndexer.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kubeClient := kfake.NewSimpleClientset(orphan, unlabeled, kept)
+	c := &GarbageCollectorController{
+		eventRecorder: events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{}),
+		coreClient:    kubeClient.CoreV1(),
+		secretLister:  corelisters.NewSecretLister(secretIndexer).Secrets(defaults.ImageRegistryOperatorNamespace),
+	}
+
+	protected, err := protectedSecrets(overrides.ConfigOverrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.collectSecrets(ctx, nil, nil, protected); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).List(ctx, metaapi.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range secrets.Items {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	expected := []string{"image-registry-foo", defaults.ImageRegistryPrivateConfiguration}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected secrets %v after the collection, got %v", expected, names)
+	}
+}
@@ -0,0 +1,207 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configlister "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryset "github.com/openshift/client-go/imageregistry/clientset/versioned/typed/imageregistry/v1"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// ImportModeController coordinates the image registry with the image stream
+// import mode of the cluster.
+//
+// It records the import mode reported by image.config.openshift.io/cluster
+// in an annotation of the registry config, the registry deployment is
+// configured from it, and reports registry settings that conflict with the
+// import mode in the ImageStreamImportModeCompatible condition.
+type ImportModeController struct {
+	client            imageregistryset.ConfigsGetter
+	operatorClient    v1helpers.OperatorClient
+	configLister      imageregistrylisters.ConfigLister
+	imageConfigLister configlister.ImageLister
+	cachesToSync      []cache.InformerSynced
+	queue             workqueue.TypedRateLimitingInterface[any]
+}
+
+// NewImportModeController returns a new ImportModeController.
+func NewImportModeController(
+	client imageregistryset.ConfigsGetter,
+	operatorClient v1helpers.OperatorClient,
+	configInformer imageregistryinformers.ConfigInformer,
+	imageConfigInformer configv1informers.ImageInformer,
+) (*ImportModeController, error) {
+	c := &ImportModeController{
+		client:            client,
+		operatorClient:    operatorClient,
+		configLister:      configInformer.Lister(),
+		imageConfigLister: imageConfigInformer.Lister(),
+		queue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "ImportModeController"),
+	}
+
+	if _, err := configInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configInformer.Informer().HasSynced)
+
+	if _, err := imageConfigInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, imageConfigInformer.Informer().HasSynced)
+
+	return c, nil
+}
+
+func (c *ImportModeController) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workqueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workqueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workqueueKey) },
+	}
+}
+
+// importModeConflict returns a description of the registry settings that
+// prevent the registry from serving image streams imported in mode, or an
+// empty string if there are none.
+func importModeConflict(mode configv1.ImportModeType, configOverrides overrides.ConfigOverrides) string {
+	if mode != configv1.ImportModePreserveOriginal {
+		return ""
+	}
+	if acceptSchema2 := configOverrides.AcceptSchema2(); acceptSchema2 != nil && !*acceptSchema2 {
+		return fmt.Sprintf("image streams are imported in the %s mode, but the registry does not accept manifest lists (manifests.acceptSchema2 is false)", mode)
+	}
+	return ""
+}
+
+func (c *ImportModeController) sync(ctx context.Context) error {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cr.Spec.ManagementState != operatorv1.Managed {
+		return nil
+	}
+
+	var mode configv1.ImportModeType
+	imageConfig, err := c.imageConfigLister.Get(defaults.ImageConfigName)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	} else if err == nil {
+		mode = imageConfig.Status.ImageStreamImportMode
+	}
+
+	if err := c.syncAnnotation(ctx, cr, mode); err != nil {
+		return err
+	}
+
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+
+	condition := operatorv1.OperatorCondition{
+		Type:   defaults.ImageStreamImportModeCompatible,
+		Status: operatorv1.ConditionTrue,
+		Reason: "AsExpected",
+	}
+	if conflict := importModeConflict(mode, configOverrides); conflict != "" {
+		condition.Status = operatorv1.ConditionFalse
+		condition.Reason = "Conflict"
+		condition.Message = conflict
+	}
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition))
+	return err
+}
+
+// syncAnnotation records mode on the registry config. Removing the annotation
+// when the import mode is not known lets the registry run with its defaults.
+func (c *ImportModeController) syncAnnotation(ctx context.Context, cr *imageregistryv1.Config, mode configv1.ImportModeType) error {
+	current, ok := cr.Annotations[defaults.ImageStreamImportModeAnnotation]
+	if current == string(mode) && (ok || mode == "") {
+		return nil
+	}
+
+	var value interface{}
+	if mode != "" {
+		value = string(mode)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				defaults.ImageStreamImportModeAnnotation: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.client.Configs().Patch(ctx, cr.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	klog.Infof("image stream import mode changed from %q to %q", current, mode)
+	return nil
+}
+
+func (c *ImportModeController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *ImportModeController) processNextWorkItem(ctx context.Context) bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("ImportModeController: got event from workqueue")
+	if err := c.sync(ctx); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("ImportModeController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("ImportModeController: event from workqueue processed")
+	}
+	return true
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *ImportModeController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting ImportModeController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+
+	klog.Infof("Started ImportModeController")
+	<-ctx.Done()
+	klog.Infof("Shutting down ImportModeController")
+}
@@ -0,0 +1,98 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	imageregistryfake "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestImportModeConflict(t *testing.T) {
+	refused := false
+	accepted := true
+	for _, tt := range []struct {
+		name            string
+		mode            configv1.ImportModeType
+		configOverrides overrides.ConfigOverrides
+		conflict        bool
+	}{
+		{
+			name: "unknown import mode",
+			mode: "",
+			configOverrides: overrides.ConfigOverrides{
+				Manifests: &overrides.ManifestOverrides{AcceptSchema2: &refused},
+			},
+		},
+		{
+			name: "legacy with schema 2 refused",
+			mode: configv1.ImportModeLegacy,
+			configOverrides: overrides.ConfigOverrides{
+				Manifests: &overrides.ManifestOverrides{AcceptSchema2: &refused},
+			},
+		},
+		{
+			name: "preserve original",
+			mode: configv1.ImportModePreserveOriginal,
+		},
+		{
+			name: "preserve original with schema 2 accepted",
+			mode: configv1.ImportModePreserveOriginal,
+			configOverrides: overrides.ConfigOverrides{
+				Manifests: &overrides.ManifestOverrides{AcceptSchema2: &accepted},
+			},
+		},
+		{
+			name: "preserve original with schema 2 refused",
+			mode: configv1.ImportModePreserveOriginal,
+			configOverrides: overrides.ConfigOverrides{
+				Manifests: &overrides.ManifestOverrides{AcceptSchema2: &refused},
+			},
+			conflict: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict := importModeConflict(tt.mode, tt.configOverrides)
+			if (conflict != "") != tt.conflict {
+				t.Errorf("expected conflict %t, got %q", tt.conflict, conflict)
+			}
+		})
+	}
+}
+
+func TestImportModeSyncAnnotation(t *testing.T) {
+	ctx := context.Background()
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metaapi.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+	}
+	client := imageregistryfake.NewSimpleClientset(cr)
+	c := &ImportModeController{client: client.ImageregistryV1()}
+
+	if err := c.syncAnnotation(ctx, cr, configv1.ImportModePreserveOriginal); err != nil {
+		t.Fatal(err)
+	}
+	cr, err := client.ImageregistryV1().Configs().Get(ctx, defaults.ImageRegistryResourceName, metaapi.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := cr.Annotations[defaults.ImageStreamImportModeAnnotation]; mode != string(configv1.ImportModePreserveOriginal) {
+		t.Fatalf("expected import mode %s, got %q", configv1.ImportModePreserveOriginal, mode)
+	}
+
+	if err := c.syncAnnotation(ctx, cr, ""); err != nil {
+		t.Fatal(err)
+	}
+	cr, err = client.ImageregistryV1().Configs().Get(ctx, defaults.ImageRegistryResourceName, metaapi.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode, ok := cr.Annotations[defaults.ImageStreamImportModeAnnotation]; ok {
+		t.Errorf("expected the import mode annotation to be removed, got %q", mode)
+	}
+}
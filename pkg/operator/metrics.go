@@ -5,60 +5,137 @@ import (
 	"strings"
 	"time"
 
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 
 	imagev1 "github.com/openshift/api/image/v1"
-	imageinformers "github.com/openshift/client-go/image/informers/externalversions/image/v1"
-	imagelisters "github.com/openshift/client-go/image/listers/image/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 )
 
+const (
+	// imageStreamPageSize is the number of image streams that are loaded
+	// at once. Image streams are not cached, so memory usage is bounded by
+	// the size of a page even on clusters with tens of thousands of them.
+	imageStreamPageSize = 500
+
+	// imageStreamPassAttempts is the number of times a pass over all
+	// image streams is started over when the list expires before it is
+	// complete.
+	imageStreamPassAttempts = 3
+
+	// imageStreamProgressPages is the number of pages after which the
+	// progress of a pass is logged.
+	imageStreamProgressPages = 20
+)
+
 // MetricsController is a controller that runs from time to time and reports some metrics about
 // the current status of the system.
 type MetricsController struct {
-	lister imagelisters.ImageStreamLister
-	caches []cache.InformerSynced
+	client imageset.ImageStreamsGetter
 }
 
 // NewMetricsController returns a new MetricsController.
-func NewMetricsController(informer imageinformers.ImageStreamInformer) *MetricsController {
+func NewMetricsController(client imageset.ImageStreamsGetter) *MetricsController {
 	return &MetricsController{
-		lister: informer.Lister(),
-		caches: []cache.InformerSynced{informer.Informer().HasSynced},
+		client: client,
 	}
 }
 
+// imageStreamTags holds the number of imported and pushed image stream tags.
+type imageStreamTags struct {
+	importedOpenShift float64
+	pushedOpenShift   float64
+	importedOther     float64
+	pushedOther       float64
+}
+
 // report gathers all metrics reported by this operator and calls appropriate function in the
 // metrics package to report the current values.
-func (m *MetricsController) report(_ context.Context) {
-	imgstreams, err := m.lister.List(labels.Everything())
-	if err != nil {
-		klog.Errorf("unable to list image streams: %s", err)
+func (m *MetricsController) report(ctx context.Context) {
+	for attempt := 1; attempt <= imageStreamPassAttempts; attempt++ {
+		tags, err := m.countImageStreamTags(ctx)
+		if errors.IsResourceExpired(err) {
+			klog.Warningf("the list of image streams expired before it was processed, starting over (attempt %d/%d)", attempt, imageStreamPassAttempts)
+			continue
+		} else if err != nil {
+			klog.Errorf("unable to list image streams: %s", err)
+			return
+		}
+
+		metrics.ReportOpenShiftImageStreamTags(tags.importedOpenShift, tags.pushedOpenShift)
+		metrics.ReportOtherImageStreamTags(tags.importedOther, tags.pushedOther)
 		return
 	}
+	klog.Errorf("unable to list image streams: the list expired %d times", imageStreamPassAttempts)
+}
 
-	var importedOpenShift float64
-	var pushedOpenShift float64
-	var importedOther float64
-	var pushedOther float64
-	for _, is := range imgstreams {
-		imported, pushed := m.assessImageStream(is.DeepCopy())
-		if strings.HasPrefix(is.Namespace, "openshift") {
-			importedOpenShift += imported
-			pushedOpenShift += pushed
-			continue
+// countImageStreamTags counts the imported and pushed tags of all image
+// streams.
+func (m *MetricsController) countImageStreamTags(ctx context.Context) (imageStreamTags, error) {
+	var tags imageStreamTags
+	err := listImageStreamPages(ctx, m.client, func(list *imagev1.ImageStreamList) {
+		for i := range list.Items {
+			is := &list.Items[i]
+			imported, pushed := m.assessImageStream(is)
+			if strings.HasPrefix(is.Namespace, "openshift") {
+				tags.importedOpenShift += imported
+				tags.pushedOpenShift += pushed
+				continue
+			}
+
+			tags.importedOther += imported
+			tags.pushedOther += pushed
+		}
+	})
+	return tags, err
+}
+
+// listImageStreamPages walks through all image streams page by page and
+// calls fn for every page. A page that fails to load is retried from the
+// same continue token, so transient errors do not restart the pass. An
+// expired continue token cannot be resumed and is returned to the caller.
+func listImageStreamPages(ctx context.Context, client imageset.ImageStreamsGetter, fn func(list *imagev1.ImageStreamList)) error {
+	opts := metav1.ListOptions{Limit: imageStreamPageSize}
+	start := time.Now()
+	processed := 0
+	for pages := 1; ; pages++ {
+		var list *imagev1.ImageStreamList
+		err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+			return !errors.IsResourceExpired(err) && ctx.Err() == nil
+		}, func() (err error) {
+			list, err = client.ImageStreams(metav1.NamespaceAll).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return err
 		}
 
-		importedOther += imported
-		pushedOther += pushed
+		fn(list)
+		processed += len(list.Items)
+
+		if list.Continue == "" {
+			klog.V(4).Infof("processed %d image streams in %d pages in %s", processed, pages, time.Since(start).Round(time.Second))
+			return nil
+		}
+		if pages%imageStreamProgressPages == 0 {
+			klog.Infof("processed %d image streams so far (%d remaining)", processed, remainingItemCount(list))
+		}
+		opts.Continue = list.Continue
 	}
+}
 
-	metrics.ReportOpenShiftImageStreamTags(importedOpenShift, pushedOpenShift)
-	metrics.ReportOtherImageStreamTags(importedOther, pushedOther)
+// remainingItemCount returns the approximate number of image streams that are
+// not loaded yet, or -1 if the API server does not report it.
+func remainingItemCount(list *imagev1.ImageStreamList) int64 {
+	if list.RemainingItemCount == nil {
+		return -1
+	}
+	return *list.RemainingItemCount
 }
 
 // assessImageStream returns the number of imported and the number of pushed tags for the provided
@@ -86,10 +163,6 @@ func (m *MetricsController) assessImageStream(is *imagev1.ImageStream) (float64,
 // the provided context is finished.
 func (m *MetricsController) Run(ctx context.Context) {
 	klog.Infof("Starting MetricsController")
-	if !cache.WaitForCacheSync(ctx.Done(), m.caches...) {
-		return
-	}
-
 	go wait.UntilWithContext(ctx, m.report, time.Hour)
 	klog.Infof("Started MetricsController")
 	<-ctx.Done()
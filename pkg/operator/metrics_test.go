@@ -0,0 +1,130 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+)
+
+// fakeImageStreams serves image stream lists from a function, the image
+// fake clientset is not vendored.
+type fakeImageStreams struct {
+	imageset.ImageStreamInterface
+	list func(opts metav1.ListOptions) (*imagev1.ImageStreamList, error)
+}
+
+func (f *fakeImageStreams) List(ctx context.Context, opts metav1.ListOptions) (*imagev1.ImageStreamList, error) {
+	return f.list(opts)
+}
+
+func (f *fakeImageStreams) ImageStreams(namespace string) imageset.ImageStreamInterface {
+	return f
+}
+
+func TestCountImageStreamTags(t *testing.T) {
+	var imagestreams []imagev1.ImageStream
+	for i := 0; i < 1234; i++ {
+		namespace := "user"
+		if i%2 == 0 {
+			namespace = "openshift"
+		}
+		imagestreams = append(imagestreams, imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: fmt.Sprintf("is%d", i)},
+			Spec: imagev1.ImageStreamSpec{
+				Tags: []imagev1.TagReference{{Name: "imported"}},
+			},
+			Status: imagev1.ImageStreamStatus{
+				Tags: []imagev1.NamedTagEventList{{Tag: "imported"}, {Tag: "pushed"}},
+			},
+		})
+	}
+
+	for _, tt := range []struct {
+		name string
+		// fail returns the error for the page that starts at offset, it
+		// is called once per request.
+		fail func(request, offset int) error
+	}{
+		{
+			name: "all pages succeed",
+		},
+		{
+			name: "transient error",
+			fail: func(request, offset int) error {
+				if request == 2 {
+					return errors.NewServiceUnavailable("etcd leader changed")
+				}
+				return nil
+			},
+		},
+		{
+			name: "expired continue token",
+			fail: func(request, offset int) error {
+				if request == 3 && offset > 0 {
+					return errors.NewResourceExpired("too old resource version")
+				}
+				return nil
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			client := &fakeImageStreams{}
+			client.list = func(opts metav1.ListOptions) (*imagev1.ImageStreamList, error) {
+				requests++
+				if opts.Limit != imageStreamPageSize {
+					t.Fatalf("expected page size %d, got %d", imageStreamPageSize, opts.Limit)
+				}
+
+				offset := 0
+				if opts.Continue != "" {
+					var err error
+					if offset, err = strconv.Atoi(opts.Continue); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if tt.fail != nil {
+					if err := tt.fail(requests, offset); err != nil {
+						return nil, err
+					}
+				}
+
+				end := offset + int(opts.Limit)
+				list := &imagev1.ImageStreamList{}
+				if end < len(imagestreams) {
+					list.Continue = strconv.Itoa(end)
+				} else {
+					end = len(imagestreams)
+				}
+				list.Items = imagestreams[offset:end]
+				return list, nil
+			}
+
+			c := NewMetricsController(client)
+			tags, err := c.countImageStreamTags(context.Background())
+			for errors.IsResourceExpired(err) {
+				tags, err = c.countImageStreamTags(context.Background())
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := imageStreamTags{
+				importedOpenShift: 617,
+				pushedOpenShift:   617,
+				importedOther:     617,
+				pushedOther:       617,
+			}
+			if tags != expected {
+				t.Errorf("expected %+v, got %+v", expected, tags)
+			}
+		})
+	}
+}
@@ -2,17 +2,22 @@ package operator
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	appsv1informers "k8s.io/client-go/informers/apps/v1"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
@@ -24,15 +29,20 @@ import (
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
 type NodeCADaemonController struct {
-	eventRecorder   events.Recorder
-	appsClient      appsv1client.AppsV1Interface
-	operatorClient  v1helpers.OperatorClient
-	daemonSetLister appsv1listers.DaemonSetNamespaceLister
-	serviceLister   corev1listers.ServiceNamespaceLister
+	eventRecorder         events.Recorder
+	appsClient            appsv1client.AppsV1Interface
+	coreClient            coreset.CoreV1Interface
+	operatorClient        v1helpers.OperatorClient
+	daemonSetLister       appsv1listers.DaemonSetNamespaceLister
+	serviceLister         corev1listers.ServiceNamespaceLister
+	configMapLister       corev1listers.ConfigMapNamespaceLister
+	openshiftConfigLister corev1listers.ConfigMapNamespaceLister
+	recreations           *resource.RecreationTracker
 
 	cachesToSync []cache.InformerSynced
 	queue        workqueue.TypedRateLimitingInterface[any]
@@ -41,19 +51,31 @@ type NodeCADaemonController struct {
 func NewNodeCADaemonController(
 	eventRecorder events.Recorder,
 	appsClient appsv1client.AppsV1Interface,
+	coreClient coreset.CoreV1Interface,
 	operatorClient v1helpers.OperatorClient,
 	daemonSetInformer appsv1informers.DaemonSetInformer,
 	serviceInformer corev1informers.ServiceInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
+	openshiftConfigInformer corev1informers.ConfigMapInformer,
 ) (*NodeCADaemonController, error) {
 	c := &NodeCADaemonController{
-		eventRecorder:   eventRecorder,
-		appsClient:      appsClient,
-		operatorClient:  operatorClient,
-		daemonSetLister: daemonSetInformer.Lister().DaemonSets(defaults.ImageRegistryOperatorNamespace),
-		serviceLister:   serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
-		queue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "NodeCADaemonController"),
+		eventRecorder:         eventRecorder,
+		appsClient:            appsClient,
+		coreClient:            coreClient,
+		operatorClient:        operatorClient,
+		daemonSetLister:       daemonSetInformer.Lister().DaemonSets(defaults.ImageRegistryOperatorNamespace),
+		serviceLister:         serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
+		configMapLister:       configMapInformer.Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		openshiftConfigLister: openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		recreations:           resource.NewRecreationTracker(),
+		queue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "NodeCADaemonController"),
 	}
 
+	// the node-ca pods are configured by the overrides of the registry
+	// config
+	if _, err := operatorClient.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
 	c.cachesToSync = append(c.cachesToSync, operatorClient.Informer().HasSynced)
 
 	if _, err := daemonSetInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
@@ -66,6 +88,16 @@ func NewNodeCADaemonController(
 	}
 	c.cachesToSync = append(c.cachesToSync, serviceInformer.Informer().HasSynced)
 
+	if _, err := configMapInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configMapInformer.Informer().HasSynced)
+
+	if _, err := openshiftConfigInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, openshiftConfigInformer.Informer().HasSynced)
+
 	return c, nil
 }
 
@@ -110,6 +142,82 @@ func (c *NodeCADaemonController) processNextWorkItem() bool {
 	return true
 }
 
+// applyDaemonSet applies the node-ca daemon set with the recreation policy of
+// the registry config, and the daemon sets of the node pools with their own
+// CA bundles.
+func (c *NodeCADaemonController) applyDaemonSet(gen resource.Mutator) error {
+	spec, _, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	configOverrides, err := overrides.ParseRaw(spec.UnsupportedConfigOverrides.Raw)
+	if err != nil {
+		return err
+	}
+	policy, err := configOverrides.RecreationPolicy()
+	if err != nil {
+		return err
+	}
+	if err := c.recreations.Apply(gen, policy, c.eventRecorder); err != nil {
+		return err
+	}
+	pools, err := configOverrides.NodeCAPools()
+	if err != nil {
+		return err
+	}
+	return c.syncPools(pools)
+}
+
+// syncPools applies the CA bundles and the node-ca daemon sets of pools and
+// deletes the ones of the pools that are gone.
+func (c *NodeCADaemonController) syncPools(pools []overrides.NodeCAPool) error {
+	var errs []error
+	names := map[string]bool{}
+	for _, pool := range pools {
+		names[pool.Name] = true
+		if err := resource.ApplyMutator(resource.NewGeneratorNodeCAPoolCAConfig(c.configMapLister, c.openshiftConfigLister, c.coreClient, pool)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := resource.ApplyMutator(resource.NewGeneratorNodeCAPoolDaemonSet(c.eventRecorder, c.daemonSetLister, c.appsClient, c.operatorClient, pool)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	requirement, err := labels.NewRequirement(defaults.NodeCAPoolLabel, selection.Exists, nil)
+	if err != nil {
+		return err
+	}
+	selector := labels.NewSelector().Add(*requirement)
+	daemonSets, err := c.daemonSetLister.List(selector)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, ds := range daemonSets {
+		if names[ds.Labels[defaults.NodeCAPoolLabel]] {
+			continue
+		}
+		if err := c.appsClient.DaemonSets(ds.Namespace).Delete(context.TODO(), ds.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		klog.Infof("deleted the node-ca daemon set %s of a removed node pool", ds.Name)
+	}
+	configMaps, err := c.configMapLister.List(selector)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, cm := range configMaps {
+		if names[cm.Labels[defaults.NodeCAPoolLabel]] {
+			continue
+		}
+		if err := c.coreClient.ConfigMaps(cm.Namespace).Delete(context.TODO(), cm.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
 func (c *NodeCADaemonController) sync() error {
 	ctx := context.TODO()
 	gen := resource.NewGeneratorNodeCADaemonSet(c.eventRecorder, c.daemonSetLister, c.serviceLister, c.appsClient, c.operatorClient)
@@ -166,8 +274,13 @@ func (c *NodeCADaemonController) sync() error {
 		}
 	}
 
-	err = resource.ApplyMutator(gen)
+	err = c.applyDaemonSet(gen)
 	if err != nil {
+		reason := "Error"
+		var recreationErr *resource.RecreationError
+		if goerrors.As(err, &recreationErr) && recreationErr.Halted {
+			reason = "ResourceRecreationHalted"
+		}
 		_, _, updateError := v1helpers.UpdateStatus(
 			ctx,
 			c.operatorClient,
@@ -176,7 +289,7 @@ func (c *NodeCADaemonController) sync() error {
 			v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
 				Type:    "NodeCADaemonControllerDegraded",
 				Status:  operatorv1.ConditionTrue,
-				Reason:  "Error",
+				Reason:  reason,
 				Message: err.Error(),
 			}),
 		)
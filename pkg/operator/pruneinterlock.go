@@ -0,0 +1,161 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+const (
+	// prunerDeferredCondition is the condition of the image pruner that
+	// reports whether a pruner job waits for builds in progress.
+	prunerDeferredCondition = "Deferred"
+
+	// pruneInterlockRecheckInterval is how often the builds are listed
+	// again while a pruner job waits for them.
+	pruneInterlockRecheckInterval = time.Minute
+)
+
+// buildInProgress returns true if the build may still push an image to the
+// registry.
+func buildInProgress(build *buildv1.Build) bool {
+	switch build.Status.Phase {
+	case buildv1.BuildPhaseNew, buildv1.BuildPhasePending, buildv1.BuildPhaseRunning:
+		return true
+	}
+	return false
+}
+
+// waitingPrunerJobs returns the pruner jobs that were created suspended and
+// have not been started yet.
+func waitingPrunerJobs(jobs []*batchv1.Job) []*batchv1.Job {
+	var waiting []*batchv1.Job
+	for _, job := range jobs {
+		if job.Spec.Suspend != nil && *job.Spec.Suspend && job.Status.StartTime == nil {
+			waiting = append(waiting, job)
+		}
+	}
+	return waiting
+}
+
+// pruneInterlock decides whether a waiting pruner job can be started. It
+// returns false while builds are in progress and the job has waited less
+// than maxDeferral, and otherwise the message of the Deferred condition that
+// explains why the job was started.
+func pruneInterlock(job *batchv1.Job, builds []buildv1.Build, enabled bool, maxDeferral time.Duration, now time.Time) (bool, string) {
+	if !enabled {
+		return true, fmt.Sprintf("The pruner job %s was started, the prune interlock is disabled", job.Name)
+	}
+	if len(builds) == 0 {
+		return true, fmt.Sprintf("The pruner job %s was started, no builds are in progress", job.Name)
+	}
+	if waited := now.Sub(job.CreationTimestamp.Time); waited >= maxDeferral {
+		return true, fmt.Sprintf("The pruner job %s was started after waiting %s, %d builds were still in progress", job.Name, waited.Round(time.Second), len(builds))
+	}
+	return false, ""
+}
+
+// pruneInterlockSettings returns whether the prune interlock is enabled in the
+// registry config, and how long the pruner jobs wait at most.
+func (c *ImagePrunerController) pruneInterlockSettings() (bool, time.Duration, error) {
+	cr, err := c.listers.RegistryConfigs.Get(defaults.ImageRegistryResourceName)
+	if kerrors.IsNotFound(err) {
+		return false, 0, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return false, 0, err
+	}
+	enabled, maxDeferralSeconds, err := configOverrides.PruneInterlock()
+	return enabled, time.Duration(maxDeferralSeconds) * time.Second, err
+}
+
+// buildsInProgress lists the builds of the cluster that may still push images
+// to the registry. Clusters without the build API have none.
+func (c *ImagePrunerController) buildsInProgress() ([]buildv1.Build, error) {
+	list, err := c.clients.Build.Builds(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var builds []buildv1.Build
+	for _, build := range list.Items {
+		if buildInProgress(&build) {
+			builds = append(builds, build)
+		}
+	}
+	return builds, nil
+}
+
+// syncPruneInterlock starts the waiting pruner jobs once no builds are in
+// progress, or once they have waited long enough, and reports the jobs held
+// back by the Deferred condition of the image pruner. It returns true if a job
+// is still waiting.
+func (c *ImagePrunerController) syncPruneInterlock(cr *imageregistryv1.ImagePruner, jobs []*batchv1.Job) (bool, error) {
+	enabled, maxDeferral, err := c.pruneInterlockSettings()
+	if err != nil {
+		return false, err
+	}
+
+	waiting := waitingPrunerJobs(jobs)
+	if len(waiting) == 0 {
+		if !enabled {
+			v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, prunerDeferredCondition)
+		}
+		return false, nil
+	}
+
+	var builds []buildv1.Build
+	if enabled {
+		if builds, err = c.buildsInProgress(); err != nil {
+			return false, fmt.Errorf("unable to list the builds in progress: %w", err)
+		}
+	}
+
+	deferred := false
+	for _, job := range waiting {
+		start, message := pruneInterlock(job, builds, enabled, maxDeferral, time.Now())
+		if !start {
+			deferred = true
+			updatePrunerCondition(cr, prunerDeferredCondition, operatorapiv1.OperatorCondition{
+				Status:  operatorapiv1.ConditionTrue,
+				Reason:  "BuildsInProgress",
+				Message: fmt.Sprintf("The pruner job %s waits for %d builds in progress, such as %s/%s, for at most %s", job.Name, len(builds), builds[0].Namespace, builds[0].Name, maxDeferral),
+			})
+			continue
+		}
+
+		_, err := c.clients.Batch.Jobs(job.Namespace).Patch(
+			context.TODO(), job.Name, types.MergePatchType, []byte(`{"spec":{"suspend":false}}`), metav1.PatchOptions{},
+		)
+		if err != nil {
+			return false, fmt.Errorf("unable to start the pruner job %s: %w", job.Name, err)
+		}
+		klog.Info(message)
+		if !deferred {
+			updatePrunerCondition(cr, prunerDeferredCondition, operatorapiv1.OperatorCondition{
+				Status:  operatorapiv1.ConditionFalse,
+				Reason:  "Started",
+				Message: message,
+			})
+		}
+	}
+	return deferred, nil
+}
@@ -0,0 +1,99 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestWaitingPrunerJobs(t *testing.T) {
+	started := metav1.Now()
+	jobs := []*batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Name: "not-suspended"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "waiting"}, Spec: batchv1.JobSpec{Suspend: ptr.To(true)}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "suspended-after-start"}, Spec: batchv1.JobSpec{Suspend: ptr.To(true)}, Status: batchv1.JobStatus{StartTime: &started}},
+	}
+
+	waiting := waitingPrunerJobs(jobs)
+	if len(waiting) != 1 || waiting[0].Name != "waiting" {
+		t.Errorf("expected only the job that never started to wait, got %v", waiting)
+	}
+}
+
+func TestPruneInterlock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "image-pruner-28577280",
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+		},
+	}
+	builds := []buildv1.Build{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "app-1"},
+		Status:     buildv1.BuildStatus{Phase: buildv1.BuildPhaseRunning},
+	}}
+
+	for _, tt := range []struct {
+		name        string
+		builds      []buildv1.Build
+		enabled     bool
+		maxDeferral time.Duration
+		start       bool
+	}{
+		{
+			name:        "builds in progress",
+			builds:      builds,
+			enabled:     true,
+			maxDeferral: time.Hour,
+		},
+		{
+			name:        "no builds",
+			enabled:     true,
+			maxDeferral: time.Hour,
+			start:       true,
+		},
+		{
+			name:        "deferral expired",
+			builds:      builds,
+			enabled:     true,
+			maxDeferral: 5 * time.Minute,
+			start:       true,
+		},
+		{
+			name:   "interlock disabled",
+			builds: builds,
+			start:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			start, message := pruneInterlock(job, tt.builds, tt.enabled, tt.maxDeferral, now)
+			if start != tt.start {
+				t.Errorf("expected start %t, got %t", tt.start, start)
+			}
+			if start && message == "" {
+				t.Errorf("expected a message explaining why the job was started")
+			}
+		})
+	}
+}
+
+func TestBuildInProgress(t *testing.T) {
+	for phase, expected := range map[buildv1.BuildPhase]bool{
+		buildv1.BuildPhaseNew:       true,
+		buildv1.BuildPhasePending:   true,
+		buildv1.BuildPhaseRunning:   true,
+		buildv1.BuildPhaseComplete:  false,
+		buildv1.BuildPhaseFailed:    false,
+		buildv1.BuildPhaseCancelled: false,
+	} {
+		build := &buildv1.Build{Status: buildv1.BuildStatus{Phase: phase}}
+		if got := buildInProgress(build); got != expected {
+			t.Errorf("%s: expected %t, got %t", phase, expected, got)
+		}
+	}
+}
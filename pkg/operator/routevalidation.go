@@ -0,0 +1,385 @@
+package operator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routev1informers "github.com/openshift/client-go/route/informers/externalversions/route/v1"
+	routev1listers "github.com/openshift/client-go/route/listers/route/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+const routeValidationWorkQueueKey = "instance"
+
+// routeProblem is a reason why a route of the registry does not serve the
+// registry.
+type routeProblem struct {
+	reason  string
+	message string
+}
+
+// routeConditionType returns the type of the condition of the route name,
+// for example RouteDefaultRouteDegraded for the route default-route.
+func routeConditionType(name string) string {
+	var b strings.Builder
+	b.WriteString("Route")
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	b.WriteString("Degraded")
+	return b.String()
+}
+
+// isRouteConditionType returns whether the condition type is the condition
+// of a route.
+func isRouteConditionType(conditionType string) bool {
+	return len(conditionType) > len("RouteDegraded") &&
+		strings.HasPrefix(conditionType, "Route") &&
+		strings.HasSuffix(conditionType, "Degraded")
+}
+
+// ingressDomains returns the domains served by the ingress controllers of
+// the cluster.
+func ingressDomains(ingress *configv1.Ingress) []string {
+	if ingress == nil {
+		return nil
+	}
+	var domains []string
+	for _, domain := range []string{ingress.Spec.Domain, ingress.Spec.AppsDomain} {
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// coveredByWildcard returns whether the hostname is covered by the wildcard
+// certificate of one of the ingress domains, which only covers the names
+// one level below the domain.
+func coveredByWildcard(hostname string, domains []string) bool {
+	for _, domain := range domains {
+		label, ok := strings.CutSuffix(hostname, "."+domain)
+		if ok && label != "" && !strings.Contains(label, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRoute returns the problems of a route of the registry. The
+// hostname must be a valid name served with a certificate that covers it:
+// either the wildcard certificate of the ingress domains or the certificate
+// of the route secret, which must also match its key and not be expired.
+// The router must admit the route. route and secret are nil when they do
+// not exist.
+func validateRoute(spec imageregistryv1.ImageRegistryConfigRoute, route *routev1.Route, secret *corev1.Secret, domains []string, now time.Time) []routeProblem {
+	var problems []routeProblem
+
+	hostname := spec.Hostname
+	if hostname == "" && route != nil {
+		// the hostname is generated by the router.
+		hostname = route.Spec.Host
+	}
+	if spec.Hostname != "" {
+		if errs := validation.IsDNS1123Subdomain(spec.Hostname); len(errs) > 0 {
+			problems = append(problems, routeProblem{
+				reason:  "InvalidHostname",
+				message: fmt.Sprintf("the hostname %s is invalid: %s", spec.Hostname, strings.Join(errs, ", ")),
+			})
+			hostname = ""
+		}
+	}
+
+	if spec.SecretName == "" {
+		if hostname != "" && len(domains) > 0 && !coveredByWildcard(hostname, domains) {
+			problems = append(problems, routeProblem{
+				reason:  "HostnameNotCovered",
+				message: fmt.Sprintf("the hostname %s is not covered by the default certificate of the ingress domains %s, the route needs a secret with a certificate for it", hostname, strings.Join(domains, ", ")),
+			})
+		}
+	} else if secret == nil {
+		problems = append(problems, routeProblem{
+			reason:  "SecretNotFound",
+			message: fmt.Sprintf("the secret %s is not found", spec.SecretName),
+		})
+	} else if problem := validateRouteCertificate(secret, hostname, now); problem != nil {
+		problems = append(problems, *problem)
+	}
+
+	if route != nil {
+		for _, ingress := range route.Status.Ingress {
+			for _, cond := range ingress.Conditions {
+				if cond.Type == routev1.RouteAdmitted && cond.Status == corev1.ConditionFalse {
+					problems = append(problems, routeProblem{
+						reason:  "NotAdmitted",
+						message: fmt.Sprintf("the route is not admitted by the router %s: %s: %s", ingress.RouterName, cond.Reason, cond.Message),
+					})
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateRouteCertificate checks the certificate of the route secret
+// against its key and the hostname of the route.
+func validateRouteCertificate(secret *corev1.Secret, hostname string, now time.Time) *routeProblem {
+	crt, key := secret.Data["tls.crt"], secret.Data["tls.key"]
+	if len(crt) == 0 || len(key) == 0 {
+		return &routeProblem{
+			reason:  "InvalidCertificate",
+			message: fmt.Sprintf("the secret %s must have the keys tls.crt and tls.key", secret.Name),
+		}
+	}
+	pair, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return &routeProblem{
+			reason:  "CertificateKeyMismatch",
+			message: fmt.Sprintf("the certificate and the key of the secret %s do not match: %s", secret.Name, err),
+		}
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return &routeProblem{
+			reason:  "InvalidCertificate",
+			message: fmt.Sprintf("unable to parse the certificate of the secret %s: %s", secret.Name, err),
+		}
+	}
+	if now.After(leaf.NotAfter) {
+		return &routeProblem{
+			reason:  "CertificateExpired",
+			message: fmt.Sprintf("the certificate of the secret %s expired on %s", secret.Name, leaf.NotAfter.UTC().Format(time.RFC3339)),
+		}
+	}
+	if hostname != "" {
+		if err := leaf.VerifyHostname(hostname); err != nil {
+			return &routeProblem{
+				reason:  "HostnameNotCovered",
+				message: fmt.Sprintf("the certificate of the secret %s does not cover the hostname: %s", secret.Name, err),
+			}
+		}
+	}
+	return nil
+}
+
+// RouteValidationController checks the routes of the registry and reports
+// the problems of each route in its own Route<Name>Degraded condition, so
+// a route that the router rejects or serves with the wrong certificate
+// does not fail silently.
+type RouteValidationController struct {
+	operatorClient            v1helpers.OperatorClient
+	routeLister               routev1listers.RouteNamespaceLister
+	secretLister              corev1listers.SecretNamespaceLister
+	ingressLister             configv1listers.IngressLister
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+func NewRouteValidationController(
+	operatorClient v1helpers.OperatorClient,
+	routeInformer routev1informers.RouteInformer,
+	secretInformer corev1informers.SecretInformer,
+	ingressInformer configv1informers.IngressInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+) (*RouteValidationController, error) {
+	c := &RouteValidationController{
+		operatorClient:            operatorClient,
+		routeLister:               routeInformer.Lister().Routes(defaults.ImageRegistryOperatorNamespace),
+		secretLister:              secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		ingressLister:             ingressInformer.Lister(),
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "RouteValidationController"),
+	}
+
+	// the periodic resyncs are kept, they catch the certificates that
+	// expire.
+	for _, informer := range []cache.SharedIndexInformer{
+		routeInformer.Informer(),
+		secretInformer.Informer(),
+		ingressInformer.Informer(),
+		imageRegistryConfigInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { c.queue.Add(routeValidationWorkQueueKey) },
+			UpdateFunc: func(old, new interface{}) { c.queue.Add(routeValidationWorkQueueKey) },
+			DeleteFunc: func(obj interface{}) { c.queue.Add(routeValidationWorkQueueKey) },
+		}); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+
+	return c, nil
+}
+
+func (c *RouteValidationController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *RouteValidationController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue: %s", obj)
+
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("RouteValidationController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("RouteValidationController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// routes returns the routes of the registry, including the default route
+// and the routes of the pull endpoint.
+func (c *RouteValidationController) routes(cr *imageregistryv1.Config) ([]imageregistryv1.ImageRegistryConfigRoute, error) {
+	var routes []imageregistryv1.ImageRegistryConfigRoute
+	if cr.Spec.DefaultRoute {
+		routes = append(routes, imageregistryv1.ImageRegistryConfigRoute{Name: defaults.RouteName})
+	}
+	routes = append(routes, cr.Spec.Routes...)
+
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, err
+	}
+	_, pullRoutes, err := configOverrides.PullEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	return append(routes, pullRoutes...), nil
+}
+
+func (c *RouteValidationController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var routes []imageregistryv1.ImageRegistryConfigRoute
+	if cr.Spec.ManagementState == operatorv1.Managed {
+		routes, err = c.routes(cr)
+		if err != nil {
+			return err
+		}
+	}
+
+	ingress, err := c.ingressLister.Get(defaults.IngressResourceName)
+	if errors.IsNotFound(err) {
+		ingress = nil
+	} else if err != nil {
+		return err
+	}
+	domains := ingressDomains(ingress)
+
+	var updateFns []v1helpers.UpdateStatusFunc
+	known := map[string]bool{}
+	now := time.Now()
+	for _, spec := range routes {
+		route, err := c.routeLister.Get(spec.Name)
+		if errors.IsNotFound(err) {
+			route = nil
+		} else if err != nil {
+			return err
+		}
+		var secret *corev1.Secret
+		if spec.SecretName != "" {
+			secret, err = c.secretLister.Get(spec.SecretName)
+			if errors.IsNotFound(err) {
+				secret = nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		cond := operatorv1.OperatorCondition{
+			Type:   routeConditionType(spec.Name),
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}
+		if problems := validateRoute(spec, route, secret, domains, now); len(problems) > 0 {
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.message)
+			}
+			cond.Status = operatorv1.ConditionTrue
+			cond.Reason = problems[0].reason
+			cond.Message = fmt.Sprintf("Route %s: %s", spec.Name, strings.Join(messages, "; "))
+		}
+		known[cond.Type] = true
+		updateFns = append(updateFns, v1helpers.UpdateConditionFn(cond))
+	}
+
+	// the conditions of the routes that are gone are removed.
+	for _, cond := range cr.Status.Conditions {
+		if !isRouteConditionType(cond.Type) || known[cond.Type] {
+			continue
+		}
+		conditionType := cond.Type
+		updateFns = append(updateFns, func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, conditionType)
+			return nil
+		})
+	}
+
+	if len(updateFns) == 0 {
+		return nil
+	}
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, updateFns...)
+	return err
+}
+
+func (c *RouteValidationController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting RouteValidationController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started RouteValidationController")
+	<-stopCh
+	klog.Infof("Shutting down RouteValidationController")
+}
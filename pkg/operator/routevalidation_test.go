@@ -0,0 +1,154 @@
+package operator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func testRouteSecret(t *testing.T, notAfter time.Time, dnsNames ...string) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-tls"},
+		Data: map[string][]byte{
+			"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
+
+func TestValidateRoute(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	domains := []string{"apps.example.com"}
+	valid := testRouteSecret(t, now.Add(time.Hour), "registry.example.org")
+	mismatched := testRouteSecret(t, now.Add(time.Hour), "registry.example.org")
+	mismatched.Data["tls.key"] = testRouteSecret(t, now.Add(time.Hour), "registry.example.org").Data["tls.key"]
+
+	for _, tc := range []struct {
+		name   string
+		spec   imageregistryv1.ImageRegistryConfigRoute
+		route  *routev1.Route
+		secret *corev1.Secret
+		reason string
+	}{
+		{
+			name: "generated hostname",
+			spec: imageregistryv1.ImageRegistryConfigRoute{Name: "default-route"},
+			route: &routev1.Route{
+				Spec: routev1.RouteSpec{Host: "default-route-openshift-image-registry.apps.example.com"},
+			},
+		},
+		{
+			name: "hostname in the ingress domain",
+			spec: imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.apps.example.com"},
+		},
+		{
+			name:   "hostname below the wildcard",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.internal.apps.example.com"},
+			reason: "HostnameNotCovered",
+		},
+		{
+			name:   "invalid hostname",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "Registry_1.example.org"},
+			reason: "InvalidHostname",
+		},
+		{
+			name:   "custom certificate",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.example.org", SecretName: "registry-tls"},
+			secret: valid,
+		},
+		{
+			name:   "missing secret",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.example.org", SecretName: "registry-tls"},
+			reason: "SecretNotFound",
+		},
+		{
+			name:   "certificate for another hostname",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "mirror.example.org", SecretName: "registry-tls"},
+			secret: valid,
+			reason: "HostnameNotCovered",
+		},
+		{
+			name:   "key of another certificate",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.example.org", SecretName: "registry-tls"},
+			secret: mismatched,
+			reason: "CertificateKeyMismatch",
+		},
+		{
+			name:   "expired certificate",
+			spec:   imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.example.org", SecretName: "registry-tls"},
+			secret: testRouteSecret(t, now.Add(-time.Hour), "registry.example.org"),
+			reason: "CertificateExpired",
+		},
+		{
+			name: "rejected by the router",
+			spec: imageregistryv1.ImageRegistryConfigRoute{Name: "public", Hostname: "registry.apps.example.com"},
+			route: &routev1.Route{
+				Status: routev1.RouteStatus{
+					Ingress: []routev1.RouteIngress{
+						{
+							RouterName: "default",
+							Conditions: []routev1.RouteIngressCondition{
+								{Type: routev1.RouteAdmitted, Status: corev1.ConditionFalse, Reason: "HostAlreadyClaimed"},
+							},
+						},
+					},
+				},
+			},
+			reason: "NotAdmitted",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := validateRoute(tc.spec, tc.route, tc.secret, domains, now)
+			if tc.reason == "" {
+				if len(problems) != 0 {
+					t.Errorf("expected no problems, got %#v", problems)
+				}
+				return
+			}
+			if len(problems) == 0 || problems[0].reason != tc.reason {
+				t.Errorf("expected the reason %s, got %#v", tc.reason, problems)
+			}
+		})
+	}
+}
+
+func TestRouteConditionType(t *testing.T) {
+	if got := routeConditionType("default-route"); got != "RouteDefaultRouteDegraded" {
+		t.Errorf("expected RouteDefaultRouteDegraded, got %s", got)
+	}
+	if !isRouteConditionType(routeConditionType("public.registry")) {
+		t.Errorf("expected the condition of a route to be recognized")
+	}
+	if isRouteConditionType("RouteDegraded") || isRouteConditionType("StorageDegraded") {
+		t.Errorf("expected other conditions not to be recognized as route conditions")
+	}
+}
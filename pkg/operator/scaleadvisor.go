@@ -0,0 +1,320 @@
+package operator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistryset "github.com/openshift/client-go/imageregistry/clientset/versioned/typed/imageregistry/v1"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	thanosQuerierURL = "https://thanos-querier.openshift-monitoring.svc:9091"
+	serviceCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+
+	// The load of the registry is observed over this window. Peaks are
+	// used, the registry should be able to handle the busiest time of the
+	// day.
+	scaleAdvisorWindow = "24h"
+
+	// scaleAdvisorHeadroom is the margin added on top of the observed
+	// peaks.
+	scaleAdvisorHeadroom = 1.25
+
+	// cpuPerReplica and requestsPerSecondPerReplica are the loads a single
+	// registry replica is expected to handle comfortably.
+	cpuPerReplica               = 1.0
+	requestsPerSecondPerReplica = 50.0
+
+	// The recommended requests are never lower than the default requests
+	// of the registry.
+	minRecommendedMilliCPU = 100
+	minRecommendedMemoryMi = 256
+)
+
+// promQuerier runs instant queries that return a single sample.
+type promQuerier interface {
+	// Query returns the value of the first sample of the query result.
+	// The returned bool is false if the result is empty.
+	Query(ctx context.Context, query string) (float64, bool, error)
+}
+
+// prometheusClient queries the cluster monitoring stack through the Thanos
+// querier with the credentials of the operator.
+type prometheusClient struct {
+	client *http.Client
+	url    string
+}
+
+func newPrometheusClient(kubeconfig *restclient.Config) (*prometheusClient, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca, err := os.ReadFile(serviceCAFile); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read the service CA: %w", err)
+	}
+
+	rt, err := transport.NewBearerAuthWithRefreshRoundTripper(
+		kubeconfig.BearerToken, kubeconfig.BearerTokenFile, &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &prometheusClient{
+		client: &http.Client{Transport: rt, Timeout: time.Minute},
+		url:    thanosQuerierURL,
+	}, nil
+}
+
+func (p *prometheusClient) Query(ctx context.Context, query string) (float64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/api/v1/query?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Value []interface{} `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, false, fmt.Errorf("unable to decode response (%s): %w", resp.Status, err)
+	}
+	if result.Status != "success" {
+		return 0, false, fmt.Errorf("query failed (%s): %s", resp.Status, result.Error)
+	}
+	if len(result.Data.Result) == 0 || len(result.Data.Result[0].Value) != 2 {
+		return 0, false, nil
+	}
+
+	s, ok := result.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0, false, fmt.Errorf("unexpected sample value %v", result.Data.Result[0].Value[1])
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return v, true, nil
+}
+
+// registryLoad is the peak load of the registry over the observation window.
+type registryLoad struct {
+	// CPU is the CPU usage of all replicas, in cores.
+	CPU float64
+	// Memory is the highest working set of a single replica, in bytes.
+	Memory float64
+	// RequestsPerSecond is the request rate of all replicas.
+	RequestsPerSecond float64
+}
+
+// scaleRecommendation is the number of replicas and the resources per replica
+// that fit the observed load.
+type scaleRecommendation struct {
+	Replicas  int32
+	Resources corev1.ResourceRequirements
+}
+
+// recommendScale sizes the registry for load. A highly available registry
+// (more than one replica) is never recommended less than two replicas.
+func recommendScale(load registryLoad, currentReplicas int32) scaleRecommendation {
+	replicas := int32(1)
+	if currentReplicas > 1 {
+		replicas = 2
+	}
+	if n := int32(math.Ceil(load.CPU * scaleAdvisorHeadroom / cpuPerReplica)); n > replicas {
+		replicas = n
+	}
+	if n := int32(math.Ceil(load.RequestsPerSecond * scaleAdvisorHeadroom / requestsPerSecondPerReplica)); n > replicas {
+		replicas = n
+	}
+
+	// CPU is rounded up to 10 millicores, memory to mebibytes.
+	milliCPU := int64(math.Ceil(load.CPU*scaleAdvisorHeadroom/float64(replicas)*100)) * 10
+	if milliCPU < minRecommendedMilliCPU {
+		milliCPU = minRecommendedMilliCPU
+	}
+	memoryMi := int64(math.Ceil(load.Memory * scaleAdvisorHeadroom / (1 << 20)))
+	if memoryMi < minRecommendedMemoryMi {
+		memoryMi = minRecommendedMemoryMi
+	}
+
+	return scaleRecommendation{
+		Replicas: replicas,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewMilliQuantity(milliCPU, resource.DecimalSI),
+				corev1.ResourceMemory: *resource.NewQuantity(memoryMi<<20, resource.BinarySI),
+			},
+		},
+	}
+}
+
+// ScaleAdvisorController is a controller that runs from time to time,
+// inspects the load of the registry through the cluster monitoring stack and
+// records a scale recommendation in the annotations of the registry config.
+// It never changes the registry itself.
+type ScaleAdvisorController struct {
+	client       imageregistryset.ConfigsGetter
+	configLister imageregistrylisters.ConfigLister
+	querier      promQuerier
+	caches       []cache.InformerSynced
+}
+
+// NewScaleAdvisorController returns a new ScaleAdvisorController.
+func NewScaleAdvisorController(
+	kubeconfig *restclient.Config,
+	client imageregistryset.ConfigsGetter,
+	configInformer imageregistryinformers.ConfigInformer,
+) (*ScaleAdvisorController, error) {
+	querier, err := newPrometheusClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return &ScaleAdvisorController{
+		client:       client,
+		configLister: configInformer.Lister(),
+		querier:      querier,
+		caches:       []cache.InformerSynced{configInformer.Informer().HasSynced},
+	}, nil
+}
+
+func (c *ScaleAdvisorController) load(ctx context.Context) (registryLoad, bool, error) {
+	var load registryLoad
+	selector := fmt.Sprintf(`namespace=%q,container="registry"`, defaults.ImageRegistryOperatorNamespace)
+	queries := []struct {
+		query string
+		value *float64
+	}{
+		{fmt.Sprintf(`max_over_time(sum(rate(container_cpu_usage_seconds_total{%s}[5m]))[%s:5m])`, selector, scaleAdvisorWindow), &load.CPU},
+		{fmt.Sprintf(`max(max_over_time(container_memory_working_set_bytes{%s}[%s]))`, selector, scaleAdvisorWindow), &load.Memory},
+		{fmt.Sprintf(`max_over_time(sum(rate(imageregistry_http_requests_total{namespace=%q}[5m]))[%s:5m])`, defaults.ImageRegistryOperatorNamespace, scaleAdvisorWindow), &load.RequestsPerSecond},
+	}
+
+	for _, q := range queries {
+		v, ok, err := c.querier.Query(ctx, q.query)
+		if err != nil {
+			return load, false, err
+		}
+		if !ok {
+			return load, false, nil
+		}
+		*q.value = v
+	}
+	return load, true, nil
+}
+
+// advise computes the scale recommendation and stores it in the registry
+// config annotations when it changes.
+func (c *ScaleAdvisorController) advise(ctx context.Context) {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return
+	} else if err != nil {
+		klog.Errorf("unable to get registry config: %s", err)
+		return
+	}
+	if cr.Spec.ManagementState != operatorv1.Managed {
+		return
+	}
+
+	load, ok, err := c.load(ctx)
+	if err != nil {
+		klog.Warningf("unable to query the registry load, skipping scale recommendation: %s", err)
+		return
+	}
+	if !ok {
+		klog.V(4).Infof("no registry load metrics available, skipping scale recommendation")
+		return
+	}
+
+	rec := recommendScale(load, cr.Spec.Replicas)
+	resources, err := json.Marshal(rec.Resources)
+	if err != nil {
+		klog.Errorf("unable to encode recommended resources: %s", err)
+		return
+	}
+
+	annotations := map[string]string{
+		defaults.RecommendedReplicasAnnotation:  strconv.Itoa(int(rec.Replicas)),
+		defaults.RecommendedResourcesAnnotation: string(resources),
+	}
+	changed := false
+	for key, value := range annotations {
+		if cr.Annotations[key] != value {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		klog.Errorf("unable to encode scale recommendation: %s", err)
+		return
+	}
+	if _, err := c.client.Configs().Patch(ctx, cr.Name, types.MergePatchType, patch, metaapi.PatchOptions{}); err != nil {
+		klog.Errorf("unable to record scale recommendation: %s", err)
+		return
+	}
+	klog.Infof("registry scale recommendation: %d replicas, resources %s", rec.Replicas, resources)
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *ScaleAdvisorController) Run(ctx context.Context) {
+	klog.Infof("Starting ScaleAdvisorController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.advise, time.Hour)
+	klog.Infof("Started ScaleAdvisorController")
+	<-ctx.Done()
+	klog.Infof("Shutting down ScaleAdvisorController")
+}
@@ -0,0 +1,130 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistryfake "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestRecommendScale(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		load             registryLoad
+		replicas         int32
+		expectedReplicas int32
+		expectedCPU      string
+		expectedMemory   string
+	}{
+		{
+			name:             "idle registry",
+			replicas:         1,
+			expectedReplicas: 1,
+			expectedCPU:      "100m",
+			expectedMemory:   "256Mi",
+		},
+		{
+			name:             "idle highly available registry",
+			replicas:         3,
+			expectedReplicas: 2,
+			expectedCPU:      "100m",
+			expectedMemory:   "256Mi",
+		},
+		{
+			name:             "cpu bound",
+			load:             registryLoad{CPU: 3, Memory: 512 << 20},
+			replicas:         2,
+			expectedReplicas: 4,
+			expectedCPU:      "940m",
+			expectedMemory:   "640Mi",
+		},
+		{
+			name:             "request bound",
+			load:             registryLoad{CPU: 0.5, Memory: 100 << 20, RequestsPerSecond: 200},
+			replicas:         2,
+			expectedReplicas: 5,
+			expectedCPU:      "130m",
+			expectedMemory:   "256Mi",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := recommendScale(tt.load, tt.replicas)
+			if rec.Replicas != tt.expectedReplicas {
+				t.Errorf("expected %d replicas, got %d", tt.expectedReplicas, rec.Replicas)
+			}
+			if cpu := rec.Resources.Requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse(tt.expectedCPU)) != 0 {
+				t.Errorf("expected cpu %s, got %s", tt.expectedCPU, cpu.String())
+			}
+			if memory := rec.Resources.Requests[corev1.ResourceMemory]; memory.Cmp(resource.MustParse(tt.expectedMemory)) != 0 {
+				t.Errorf("expected memory %s, got %s", tt.expectedMemory, memory.String())
+			}
+		})
+	}
+}
+
+func TestScaleAdvisorAdvise(t *testing.T) {
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		value := "0"
+		switch {
+		case strings.Contains(query, "container_cpu_usage_seconds_total"):
+			value = "1.5"
+		case strings.Contains(query, "container_memory_working_set_bytes"):
+			value = "1073741824"
+		case strings.Contains(query, "imageregistry_http_requests_total"):
+			value = "20"
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"` + value + `"]}]}}`))
+	}))
+	defer prometheus.Close()
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metaapi.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+			Replicas:     2,
+		},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(cr); err != nil {
+		t.Fatal(err)
+	}
+	client := imageregistryfake.NewSimpleClientset(cr)
+
+	c := &ScaleAdvisorController{
+		client:       client.ImageregistryV1(),
+		configLister: imageregistrylisters.NewConfigLister(indexer),
+		querier:      &prometheusClient{client: prometheus.Client(), url: prometheus.URL},
+	}
+	c.advise(context.Background())
+
+	updated, err := client.ImageregistryV1().Configs().Get(context.Background(), defaults.ImageRegistryResourceName, metaapi.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas := updated.Annotations[defaults.RecommendedReplicasAnnotation]; replicas != "2" {
+		t.Errorf("expected 2 recommended replicas, got %q", replicas)
+	}
+
+	var resources corev1.ResourceRequirements
+	if err := json.Unmarshal([]byte(updated.Annotations[defaults.RecommendedResourcesAnnotation]), &resources); err != nil {
+		t.Fatalf("unable to decode recommended resources: %s", err)
+	}
+	if memory := resources.Requests[corev1.ResourceMemory]; memory.Cmp(resource.MustParse("1280Mi")) != 0 {
+		t.Errorf("expected 1280Mi of memory, got %s", memory.String())
+	}
+}
@@ -0,0 +1,246 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// The keys of the StagedChangesConfigMapName config map.
+const (
+	stagedAppliedKey = "applied"
+	stagedPendingKey = "pending"
+	stagedChangesKey = "changes"
+	stagedIDKey      = "id"
+	stagedExpiresKey = "expires"
+)
+
+// specSection returns the JSON encoding of a part of the registry spec.
+// Comparing the encodings ignores the difference between nil and empty
+// fields that are omitted when they are empty.
+func specSection(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// changedSections returns the parts of the registry that are changed when
+// the spec proposed replaces the spec applied: storage, routes and
+// deployment. The management state is not staged.
+func changedSections(applied, proposed imageregistryv1.ImageRegistrySpec) []string {
+	var sections []string
+	if !bytes.Equal(specSection(applied.Storage), specSection(proposed.Storage)) {
+		sections = append(sections, "storage")
+	}
+	routesChanged := len(applied.Routes) != 0 || len(proposed.Routes) != 0
+	routesChanged = routesChanged && !bytes.Equal(specSection(applied.Routes), specSection(proposed.Routes))
+	if applied.DefaultRoute != proposed.DefaultRoute || routesChanged {
+		sections = append(sections, "routes")
+	}
+
+	// Everything else ends up in the registry deployment.
+	applied.Storage, proposed.Storage = imageregistryv1.ImageRegistryConfigStorage{}, imageregistryv1.ImageRegistryConfigStorage{}
+	applied.DefaultRoute, proposed.DefaultRoute = false, false
+	applied.Routes, proposed.Routes = nil, nil
+	applied.ManagementState = proposed.ManagementState
+	if !bytes.Equal(specSection(applied), specSection(proposed)) {
+		sections = append(sections, "deployment")
+	}
+	return sections
+}
+
+// changeSetID identifies the change set that stages spec at stagedAt. A
+// change set staged again after it expired gets a new ID, an approval is
+// only valid for the change set that was reviewed.
+func changeSetID(spec []byte, stagedAt time.Time) string {
+	sum := sha256.Sum256(append(spec, []byte(stagedAt.UTC().Format(time.RFC3339))...))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+// stagedChangesSettings returns whether the changes of the registry config
+// are staged, and for how long a change set can be approved. Once a spec has
+// been applied, its settings are the ones that count, so that staging can
+// not be disabled without an approval.
+func stagedChangesSettings(cr *imageregistryv1.Config, applied *imageregistryv1.ImageRegistrySpec) (bool, time.Duration, error) {
+	spec := &cr.Spec
+	if applied != nil {
+		spec = applied
+	}
+	configOverrides, err := overrides.ParseRaw(spec.UnsupportedConfigOverrides.Raw)
+	if err != nil {
+		return false, 0, err
+	}
+	enabled, expirySeconds, err := configOverrides.StagedChanges()
+	return enabled, time.Duration(expirySeconds) * time.Second, err
+}
+
+// getStagedChanges returns the StagedChangesConfigMapName config map, or a
+// new one if it does not exist.
+func (c *Controller) getStagedChanges() (*corev1.ConfigMap, error) {
+	cm, err := c.listers.ConfigMaps.Get(defaults.StagedChangesConfigMapName)
+	if errors.IsNotFound(err) {
+		return &corev1.ConfigMap{
+			ObjectMeta: metaapi.ObjectMeta{
+				Name:      defaults.StagedChangesConfigMapName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Data: map[string]string{},
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	return cm, nil
+}
+
+func (c *Controller) writeStagedChanges(cm *corev1.ConfigMap) error {
+	if cm.ResourceVersion == "" {
+		_, err := c.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Create(
+			context.TODO(), cm, metaapi.CreateOptions{},
+		)
+		return err
+	}
+	_, err := c.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Update(
+		context.TODO(), cm, metaapi.UpdateOptions{},
+	)
+	return err
+}
+
+// stageChanges returns the registry config to apply and whether the changes
+// are staged. While a change set waits for its approval, the config to apply
+// is a copy of cr with the last applied spec, and the ChangesPending
+// condition of cr tells how to approve the change set. A change set is
+// approved by setting the ApproveChangesAnnotation of cr to its ID.
+func (c *Controller) stageChanges(cr *imageregistryv1.Config) (*imageregistryv1.Config, bool, error) {
+	cm, err := c.getStagedChanges()
+	if err != nil {
+		return nil, false, err
+	}
+	var applied *imageregistryv1.ImageRegistrySpec
+	if data, ok := cm.Data[stagedAppliedKey]; ok {
+		applied = &imageregistryv1.ImageRegistrySpec{}
+		if err := json.Unmarshal([]byte(data), applied); err != nil {
+			return nil, false, fmt.Errorf("unable to decode the applied spec of %s: %w", defaults.StagedChangesConfigMapName, err)
+		}
+	}
+
+	enabled, expiry, err := stagedChangesSettings(cr, applied)
+	if err != nil {
+		return nil, false, err
+	}
+	if !enabled {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.ChangesPending)
+		return cr, false, nil
+	}
+	if applied == nil {
+		// The first spec applied with staging enabled is the
+		// baseline of the next change sets.
+		return cr, true, nil
+	}
+
+	changes := changedSections(*applied, cr.Spec)
+	if len(changes) == 0 {
+		if storageutil.FetchCondition(cr, defaults.ChangesPending).Status == operatorv1.ConditionTrue {
+			storageutil.UpdateCondition(cr, defaults.ChangesPending, operatorv1.ConditionFalse, "Withdrawn", "The staged changes were reverted")
+		}
+		return cr, true, nil
+	}
+
+	pending := string(specSection(cr.Spec))
+	now := time.Now()
+	expires, _ := time.Parse(time.RFC3339, cm.Data[stagedExpiresKey])
+	id := cm.Data[stagedIDKey]
+	if cm.Data[stagedPendingKey] != pending || !now.Before(expires) {
+		expires = now.Add(expiry).Truncate(time.Second)
+		id = changeSetID([]byte(pending), now)
+		cm.Data[stagedPendingKey] = pending
+		cm.Data[stagedChangesKey] = strings.Join(changes, ",")
+		cm.Data[stagedIDKey] = id
+		cm.Data[stagedExpiresKey] = expires.UTC().Format(time.RFC3339)
+		if err := c.writeStagedChanges(cm); err != nil {
+			return nil, true, fmt.Errorf("unable to publish the staged changes: %w", err)
+		}
+		klog.Infof("changes of the %s of the registry staged as change set %s until %s", strings.Join(changes, ", "), id, cm.Data[stagedExpiresKey])
+	}
+
+	approval, approved := cr.Annotations[defaults.ApproveChangesAnnotation]
+	if approved && approval == id {
+		klog.Infof("change set %s approved, applying the changes of the %s of the registry", id, strings.Join(changes, ", "))
+		delete(cr.Annotations, defaults.ApproveChangesAnnotation)
+		storageutil.UpdateCondition(cr, defaults.ChangesPending, operatorv1.ConditionFalse, "Approved", fmt.Sprintf("The change set %s was approved and applied", id))
+		return cr, true, nil
+	}
+
+	message := fmt.Sprintf(
+		"The changes of the %s of the registry are staged as change set %s, see the config map %s/%s. Set the annotation %s=%s on the registry config before %s to apply them",
+		strings.Join(changes, ", "), id, defaults.ImageRegistryOperatorNamespace, defaults.StagedChangesConfigMapName,
+		defaults.ApproveChangesAnnotation, id, expires.UTC().Format(time.RFC3339),
+	)
+	if approved {
+		message += fmt.Sprintf(", the approval %q does not match the change set", approval)
+	}
+	storageutil.UpdateCondition(cr, defaults.ChangesPending, operatorv1.ConditionTrue, "AwaitingApproval", message)
+	c.workqueue.AddAfter(workqueueKey, time.Until(expires))
+
+	target := cr.DeepCopy()
+	target.Spec = *applied
+	target.Spec.ManagementState = cr.Spec.ManagementState
+	return target, true, nil
+}
+
+// recordAppliedSpec stores the spec of the applied registry config as the
+// baseline of the next change sets. The pending change set is dropped once
+// the config with the changes has been applied.
+func (c *Controller) recordAppliedSpec(applied *imageregistryv1.Config, pendingApplied bool) error {
+	cm, err := c.getStagedChanges()
+	if err != nil {
+		return err
+	}
+	data := string(specSection(applied.Spec))
+	if cm.Data[stagedAppliedKey] == data && (!pendingApplied || cm.Data[stagedPendingKey] == "") {
+		return nil
+	}
+	cm.Data[stagedAppliedKey] = data
+	if pendingApplied {
+		for _, key := range []string{stagedPendingKey, stagedChangesKey, stagedIDKey, stagedExpiresKey} {
+			delete(cm.Data, key)
+		}
+	}
+	return c.writeStagedChanges(cm)
+}
+
+// removeStagedChanges deletes the StagedChangesConfigMapName config map once
+// the changes are not staged anymore.
+func (c *Controller) removeStagedChanges() error {
+	if _, err := c.listers.ConfigMaps.Get(defaults.StagedChangesConfigMapName); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err := c.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StagedChangesConfigMapName, metaapi.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
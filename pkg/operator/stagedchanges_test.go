@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestChangedSections(t *testing.T) {
+	applied := imageregistryv1.ImageRegistrySpec{
+		OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		Replicas:     2,
+		Storage: imageregistryv1.ImageRegistryConfigStorage{
+			S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(spec *imageregistryv1.ImageRegistrySpec)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			modify: func(spec *imageregistryv1.ImageRegistrySpec) {},
+		},
+		{
+			name: "management state",
+			modify: func(spec *imageregistryv1.ImageRegistrySpec) {
+				spec.ManagementState = operatorv1.Removed
+			},
+		},
+		{
+			name: "empty routes",
+			modify: func(spec *imageregistryv1.ImageRegistrySpec) {
+				spec.Routes = []imageregistryv1.ImageRegistryConfigRoute{}
+			},
+		},
+		{
+			name: "bucket",
+			modify: func(spec *imageregistryv1.ImageRegistrySpec) {
+				spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "other"}
+			},
+			want: []string{"storage"},
+		},
+		{
+			name: "default route and replicas",
+			modify: func(spec *imageregistryv1.ImageRegistrySpec) {
+				spec.DefaultRoute = true
+				spec.Replicas = 3
+			},
+			want: []string{"routes", "deployment"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			proposed := *applied.DeepCopy()
+			tc.modify(&proposed)
+			if got := changedSections(applied, proposed); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChangeSetID(t *testing.T) {
+	stagedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	id := changeSetID([]byte(`{"replicas":2}`), stagedAt)
+	if id != changeSetID([]byte(`{"replicas":2}`), stagedAt) {
+		t.Error("the ID of a change set must be stable")
+	}
+	if id == changeSetID([]byte(`{"replicas":2}`), stagedAt.Add(24*time.Hour)) {
+		t.Error("a change set staged again must get a new ID")
+	}
+	if id == changeSetID([]byte(`{"replicas":3}`), stagedAt) {
+		t.Error("different changes must get different IDs")
+	}
+}
+
+func TestStagedChangesSettings(t *testing.T) {
+	staging := runtime.RawExtension{Raw: []byte(`{"staging":{"enabled":true,"expirySeconds":3600}}`)}
+	cr := &imageregistryv1.Config{}
+
+	enabled, expiry, err := stagedChangesSettings(cr, nil)
+	if err != nil || enabled {
+		t.Fatalf("staging must be disabled by default, got %t, %v", enabled, err)
+	}
+
+	cr.Spec.UnsupportedConfigOverrides = staging
+	enabled, expiry, err = stagedChangesSettings(cr, nil)
+	if err != nil || !enabled || expiry != time.Hour {
+		t.Fatalf("got %t, %s, %v, want staging for an hour", enabled, expiry, err)
+	}
+
+	// Disabling staging is itself a change that needs an approval.
+	applied := cr.Spec.DeepCopy()
+	cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{}
+	enabled, _, err = stagedChangesSettings(cr, applied)
+	if err != nil || !enabled {
+		t.Fatalf("staging must stay enabled until the change is approved, got %t, %v", enabled, err)
+	}
+}
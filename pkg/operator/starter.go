@@ -13,10 +13,10 @@ import (
 
 	configv1 "github.com/openshift/api/config/v1"
 	"github.com/openshift/api/features"
+	buildclient "github.com/openshift/client-go/build/clientset/versioned/typed/build/v1"
 	configclient "github.com/openshift/client-go/config/clientset/versioned"
 	configinformers "github.com/openshift/client-go/config/informers/externalversions"
 	imageclient "github.com/openshift/client-go/image/clientset/versioned"
-	imageinformers "github.com/openshift/client-go/image/informers/externalversions"
 	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
 	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
 	routeclient "github.com/openshift/client-go/route/clientset/versioned"
@@ -28,38 +28,48 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 )
 
 func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
-	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	settings, err := clientSettingsFromEnv(kubeconfig)
 	if err != nil {
 		return err
 	}
-	configClient, err := configclient.NewForConfig(kubeconfig)
+	klog.Infof("Informers resync every %s, API clients are limited to %v QPS with a burst of %d", settings.resyncPeriod, settings.qps, settings.burst)
+
+	kubeClient, err := kubeclient.NewForConfig(settings.restConfig(kubeconfig))
+	if err != nil {
+		return err
+	}
+	configClient, err := configclient.NewForConfig(settings.restConfig(kubeconfig))
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(settings.restConfig(kubeconfig))
 	if err != nil {
 		return err
 	}
-	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	routeClient, err := routeclient.NewForConfig(settings.restConfig(kubeconfig))
 	if err != nil {
 		return err
 	}
-	routeClient, err := routeclient.NewForConfig(kubeconfig)
+	imageClient, err := imageclient.NewForConfig(settings.restConfig(kubeconfig))
 	if err != nil {
 		return err
 	}
-	imageClient, err := imageclient.NewForConfig(kubeconfig)
+	buildClient, err := buildclient.NewForConfig(settings.restConfig(kubeconfig))
 	if err != nil {
 		return err
 	}
 
-	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
-	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
-	kubeInformersForOpenShiftConfigManaged := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigManagedNamespace))
-	kubeInformersForKubeSystem := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(kubeSystemNamespace))
-	configInformers := configinformers.NewSharedInformerFactory(configClient, defaultResyncDuration)
-	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, defaultResyncDuration)
-	routeInformers := routeinformers.NewSharedInformerFactoryWithOptions(routeClient, defaultResyncDuration, routeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
-	imageInformers := imageinformers.NewSharedInformerFactory(imageClient, defaultResyncDuration)
+	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, settings.resyncPeriod, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, settings.resyncPeriod, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
+	kubeInformersForOpenShiftConfigManaged := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, settings.resyncPeriod, kubeinformers.WithNamespace(defaults.OpenShiftConfigManagedNamespace))
+	kubeInformersForKubeSystem := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, settings.resyncPeriod, kubeinformers.WithNamespace(kubeSystemNamespace))
+	configInformers := configinformers.NewSharedInformerFactory(configClient, settings.resyncPeriod)
+	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, settings.resyncPeriod)
+	routeInformers := routeinformers.NewSharedInformerFactoryWithOptions(routeClient, settings.resyncPeriod, routeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
 
 	configOperatorClient := client.NewConfigOperatorClient(
 		imageregistryClient.ImageregistryV1().Configs(),
@@ -94,7 +104,7 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 
 	controller, err := NewController(
 		eventRecorder,
-		kubeconfig,
+		settings.restConfig(kubeconfig),
 		kubeClient,
 		configClient,
 		imageregistryClient,
@@ -131,6 +141,19 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		return err
 	}
 
+	var importModeController *ImportModeController
+	if imageStreamImportModeEnabled {
+		importModeController, err = NewImportModeController(
+			imageregistryClient.ImageregistryV1(),
+			configOperatorClient,
+			imageregistryInformers.Imageregistry().V1().Configs(),
+			configInformers.Config().V1().Images(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	clusterOperatorStatusController, err := NewClusterOperatorStatusController(
 		[]configv1.ObjectReference{
 			{Group: "imageregistry.operator.openshift.io", Resource: "configs", Name: "cluster"},
@@ -151,7 +174,7 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	}
 
 	imageRegistryCertificatesController, err := NewImageRegistryCertificatesController(
-		kubeconfig,
+		settings.restConfig(kubeconfig),
 		kubeClient.CoreV1(),
 		configOperatorClient,
 		kubeInformers.Core().V1().ConfigMaps(),
@@ -170,9 +193,12 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	nodeCADaemonController, err := NewNodeCADaemonController(
 		eventRecorder,
 		kubeClient.AppsV1(),
+		kubeClient.CoreV1(),
 		configOperatorClient,
 		kubeInformers.Apps().V1().DaemonSets(),
 		kubeInformers.Core().V1().Services(),
+		kubeInformers.Core().V1().ConfigMaps(),
+		kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
 	)
 	if err != nil {
 		return err
@@ -181,6 +207,7 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	imagePrunerController, err := NewImagePrunerController(
 		kubeClient,
 		imageregistryClient,
+		buildClient,
 		kubeInformers,
 		imageregistryInformers,
 		configInformers.Config().V1().Images(),
@@ -213,6 +240,62 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		return err
 	}
 
+	storageMigrationController, err := NewStorageMigrationController(
+		kubeClient.BatchV1(),
+		configOperatorClient,
+		kubeInformers.Batch().V1().Jobs(),
+		kubeInformers.Core().V1().Secrets(),
+		kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		configInformers.Config().V1().Infrastructures(),
+		configInformers.Config().V1().Proxies(),
+	)
+	if err != nil {
+		return err
+	}
+
+	storagePruneController, err := NewStoragePruneController(
+		kubeClient.BatchV1(),
+		kubeClient.RbacV1(),
+		imageClient.ImageV1(),
+		configOperatorClient,
+		kubeInformers.Batch().V1().CronJobs(),
+		kubeInformers.Batch().V1().Jobs(),
+		kubeInformers.Apps().V1().Deployments(),
+		kubeInformers.Rbac().V1().ClusterRoleBindings(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	storageBenchmarkController, err := NewStorageBenchmarkController(
+		kubeClient.CoreV1(),
+		kubeClient.BatchV1(),
+		configOperatorClient,
+		kubeInformers.Batch().V1().Jobs(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	consistencyCheckController, err := NewConsistencyCheckController(
+		kubeClient.CoreV1(),
+		kubeClient.BatchV1(),
+		kubeClient.RbacV1(),
+		imageClient.ImageV1(),
+		configOperatorClient,
+		kubeInformers.Batch().V1().CronJobs(),
+		kubeInformers.Batch().V1().Jobs(),
+		kubeInformers.Apps().V1().Deployments(),
+		kubeInformers.Rbac().V1().ClusterRoleBindings(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
 	awsTagController, err := NewAWSTagController(
 		configClient.ConfigV1().Infrastructures(),
 		imageregistryClient.ImageregistryV1().Configs(),
@@ -229,7 +312,85 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		return err
 	}
 
-	metricsController := NewMetricsController(imageInformers.Image().V1().ImageStreams())
+	metricsController := NewMetricsController(imageClient.ImageV1())
+
+	storageUsageController := NewStorageUsageController(imageClient.ImageV1(), kubeClient.CoreV1())
+
+	garbageCollectorController := NewGarbageCollectorController(
+		eventRecorder,
+		configOperatorClient,
+		kubeClient.CoreV1(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		kubeInformers.Apps().V1().Deployments(),
+		kubeInformers.Apps().V1().ReplicaSets(),
+		kubeInformers.Core().V1().Secrets(),
+	)
+
+	scaleAdvisorController, err := NewScaleAdvisorController(
+		settings.restConfig(kubeconfig),
+		imageregistryClient.ImageregistryV1(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	storageAccessController, err := NewStorageAccessController(
+		settings.restConfig(kubeconfig),
+		kubeClient.CoreV1(),
+		kubeInformers.Core().V1().Secrets(),
+		configInformers.Config().V1().Infrastructures(),
+		kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
+		kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		eventRecorder,
+		featureGateAccessor,
+	)
+	if err != nil {
+		return err
+	}
+
+	usagePruneController, err := NewUsagePruneController(
+		settings.restConfig(kubeconfig),
+		kubeClient.BatchV1(),
+		configOperatorClient,
+		kubeInformers.Batch().V1().CronJobs(),
+		kubeInformers.Batch().V1().Jobs(),
+		kubeInformers.Core().V1().Secrets(),
+		configInformers.Config().V1().Infrastructures(),
+		kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
+		kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps(),
+		imageregistryInformers.Imageregistry().V1().ImagePruners(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		featureGateAccessor,
+	)
+	if err != nil {
+		return err
+	}
+
+	routeValidationController, err := NewRouteValidationController(
+		configOperatorClient,
+		routeInformers.Route().V1().Routes(),
+		kubeInformers.Core().V1().Secrets(),
+		configInformers.Config().V1().Ingresses(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	storageUsageCollector := metrics.NewStorageUsageCollector(
+		newStorageUsageFunc(
+			settings.restConfig(kubeconfig),
+			kubeInformers.Core().V1().Secrets(),
+			configInformers.Config().V1().Infrastructures(),
+			kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
+			kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps(),
+			imageregistryInformers.Imageregistry().V1().Configs(),
+			featureGateAccessor,
+		),
+		defaults.StorageUsageMetricsIntervalSeconds*time.Second,
+	)
 
 	kubeInformers.Start(ctx.Done())
 	kubeInformersForOpenShiftConfig.Start(ctx.Done())
@@ -238,7 +399,6 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	configInformers.Start(ctx.Done())
 	imageregistryInformers.Start(ctx.Done())
 	routeInformers.Start(ctx.Done())
-	imageInformers.Start(ctx.Done())
 
 	go controller.Run(ctx.Done())
 	go clusterOperatorStatusController.Run(ctx.Done())
@@ -249,8 +409,22 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	go loggingController.Run(ctx, 1)
 	go azureStackCloudController.Run(ctx)
 	go azurePathFixController.Run(ctx.Done())
+	go storageMigrationController.Run(ctx.Done())
+	go storagePruneController.Run(ctx.Done())
+	go consistencyCheckController.Run(ctx.Done())
+	go storageBenchmarkController.Run(ctx.Done())
 	go awsTagController.Run(ctx)
 	go metricsController.Run(ctx)
+	go storageUsageController.Run(ctx)
+	go garbageCollectorController.Run(ctx)
+	go scaleAdvisorController.Run(ctx)
+	go storageAccessController.Run(ctx)
+	go usagePruneController.Run(ctx.Done())
+	go storageUsageCollector.Run(ctx)
+	go routeValidationController.Run(ctx.Done())
+	if importModeController != nil {
+		go importModeController.Run(ctx)
+	}
 
 	<-ctx.Done()
 	return nil
@@ -1,6 +1,7 @@
 package operator
 
 import (
+	goerrors "errors"
 	"fmt"
 	"strings"
 	"time"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func updateCondition(cr *imageregistryv1.Config, condtype string, condstate operatorapiv1.OperatorCondition) {
@@ -319,6 +321,10 @@ func (c *Controller) syncStatus(
 		}
 		operatorProgressing.Message = fmt.Sprintf("Unable to apply resources: %s", applyError)
 		operatorProgressing.Reason = "Error"
+		var storageErr *storageutil.StorageError
+		if goerrors.As(applyError, &storageErr) {
+			operatorProgressing.Reason = storageErr.Reason()
+		}
 	} else if deploy == nil {
 		operatorProgressing.Message = "All resources are successfully applied, but the deployment does not exist"
 		operatorProgressing.Reason = "WaitingForDeployment"
@@ -399,3 +405,65 @@ func (c *Controller) syncStatus(
 		cr.Status.ReadyReplicas = deploy.Status.ReadyReplicas
 	}
 }
+
+// syncCanaryStatus reports the registry as progressing while a canary
+// replica is checking a new configuration, and as degraded when the canary
+// replica failed. The current replicas keep running the previous
+// configuration in both cases, so the rest of the status is not affected.
+func syncCanaryStatus(cr *imageregistryv1.Config, canary *appsapi.Deployment, applyError error) {
+	if cr.Spec.ManagementState != operatorapiv1.Managed || canary == nil || applyError != nil {
+		return
+	}
+	if reason, failed := canary.Annotations[defaults.CanaryFailureAnnotation]; failed {
+		updateCondition(cr, operatorapiv1.OperatorStatusTypeDegraded, operatorapiv1.OperatorCondition{
+			Status:  operatorapiv1.ConditionTrue,
+			Message: fmt.Sprintf("The new registry configuration is not rolled out, the registry keeps running the previous configuration: the canary replica failed: %s", reason),
+			Reason:  "CanaryFailed",
+		})
+		return
+	}
+
+	updateCondition(cr, operatorapiv1.OperatorStatusTypeProgressing, operatorapiv1.OperatorCondition{
+		Status:  operatorapiv1.ConditionTrue,
+		Message: "A canary replica is checking the new registry configuration",
+		Reason:  "CanaryInProgress",
+	})
+}
+
+// syncStorageWritableStatus reports the registry as degraded while it runs in
+// read-only mode because its storage rejects writes. Images can still be
+// pulled, but pushes fail.
+func syncStorageWritableStatus(cr *imageregistryv1.Config, applyError error) {
+	if cr.Spec.ManagementState != operatorapiv1.Managed || applyError != nil {
+		return
+	}
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageWritable)
+	if cond == nil || cond.Status != operatorapiv1.ConditionFalse {
+		return
+	}
+
+	updateCondition(cr, operatorapiv1.OperatorStatusTypeDegraded, operatorapiv1.OperatorCondition{
+		Status:  operatorapiv1.ConditionTrue,
+		Message: cond.Message,
+		Reason:  "StorageReadOnly",
+	})
+}
+
+// syncRollbackStatus reports the registry as degraded while it runs the last
+// known-good configuration instead of the current one. The registry keeps
+// serving, but the configuration requested by the user is not in effect.
+func syncRollbackStatus(cr *imageregistryv1.Config, applyError error) {
+	if cr.Spec.ManagementState != operatorapiv1.Managed || applyError != nil {
+		return
+	}
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.RolloutRolledBack)
+	if cond == nil || cond.Status != operatorapiv1.ConditionTrue {
+		return
+	}
+
+	updateCondition(cr, operatorapiv1.OperatorStatusTypeDegraded, operatorapiv1.OperatorCondition{
+		Status:  operatorapiv1.ConditionTrue,
+		Message: cond.Message,
+		Reason:  "RolledBack",
+	})
+}
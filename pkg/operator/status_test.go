@@ -13,6 +13,9 @@ import (
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorv1 "github.com/openshift/api/operator/v1"
 	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func validateCondition(t *testing.T, expcond, cond operatorv1.OperatorCondition) {
@@ -630,6 +633,80 @@ func Test_syncStatus(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "transient storage error without Deployment in place",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					OperatorSpec: operatorv1.OperatorSpec{
+						ManagementState: "Managed",
+					},
+				},
+			},
+			applyError: fmt.Errorf("unable to sync storage configuration: %w", storageutil.NewStorageError(storageutil.ErrorKindThrottled, fmt.Errorf("slow down"))),
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Available",
+					Status:  "False",
+					Reason:  "DeploymentNotFound",
+					Message: "The deployment does not exist",
+				},
+				{
+					Type:    "Progressing",
+					Status:  "True",
+					Reason:  "StorageThrottled",
+					Message: "Unable to apply resources: unable to sync storage configuration: slow down",
+				},
+				{
+					Type:    "Degraded",
+					Status:  "False",
+					Reason:  "",
+					Message: "",
+				},
+				{
+					Type:    "Removed",
+					Status:  "False",
+					Reason:  "",
+					Message: "",
+				},
+			},
+		},
+		{
+			name: "permanent storage error without Deployment in place",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					OperatorSpec: operatorv1.OperatorSpec{
+						ManagementState: "Managed",
+					},
+				},
+			},
+			applyError: newPermanentError("StoragePermissionDenied", storageutil.NewStorageError(storageutil.ErrorKindPermissionDenied, fmt.Errorf("access denied"))),
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Available",
+					Status:  "False",
+					Reason:  "StoragePermissionDenied",
+					Message: "Error: access denied",
+				},
+				{
+					Type:    "Progressing",
+					Status:  "False",
+					Reason:  "StoragePermissionDenied",
+					Message: "Unable to apply resources: access denied",
+				},
+				{
+					Type:    "Degraded",
+					Status:  "True",
+					Reason:  "StoragePermissionDenied",
+					Message: "Error: access denied",
+				},
+				{
+					Type:    "Removed",
+					Status:  "False",
+					Reason:  "",
+					Message: "",
+				},
+			},
+		},
 		{
 			name:   "set as Unmanaged",
 			deploy: &appsapi.Deployment{},
@@ -796,3 +873,54 @@ func Test_syncStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncCanaryStatus(t *testing.T) {
+	cfg := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		},
+	}
+	canary := &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				defaults.CanaryFailureAnnotation: "self-test failed: GET /healthz: unexpected status 503",
+			},
+		},
+	}
+
+	syncCanaryStatus(cfg, canary, nil)
+	validateCondition(t, operatorv1.OperatorCondition{
+		Type:    operatorv1.OperatorStatusTypeDegraded,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "CanaryFailed",
+		Message: "The new registry configuration is not rolled out, the registry keeps running the previous configuration: the canary replica failed: self-test failed: GET /healthz: unexpected status 503",
+	}, cfg.Status.Conditions[0])
+}
+
+func TestSyncStorageWritableStatus(t *testing.T) {
+	cfg := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		},
+		Status: imageregistryv1.ImageRegistryStatus{
+			OperatorStatus: operatorv1.OperatorStatus{
+				Conditions: []operatorv1.OperatorCondition{
+					{
+						Type:    defaults.StorageWritable,
+						Status:  operatorv1.ConditionFalse,
+						Reason:  "WriteProbeFailed",
+						Message: "The storage does not accept writes, the registry is in read-only mode until it does: QuotaExceeded",
+					},
+				},
+			},
+		},
+	}
+
+	syncStorageWritableStatus(cfg, nil)
+	validateCondition(t, operatorv1.OperatorCondition{
+		Type:    operatorv1.OperatorStatusTypeDegraded,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "StorageReadOnly",
+		Message: "The storage does not accept writes, the registry is in read-only mode until it does: QuotaExceeded",
+	}, cfg.Status.Conditions[1])
+}
@@ -0,0 +1,311 @@
+package operator
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	storageAccessReadOnly  = "ReadOnly"
+	storageAccessReadWrite = "ReadWrite"
+
+	storageAccessDefaultDuration = time.Hour
+	storageAccessMinDuration     = 15 * time.Minute
+	storageAccessMaxDuration     = 12 * time.Hour
+)
+
+// StorageAccessController issues short-lived credentials for the registry
+// storage to external tools.
+//
+// A tool requests credentials by creating a secret with the
+// StorageAccessRequestLabel in the operator namespace. The controller fills
+// the secret with credentials scoped to the registry bucket or container,
+// and deletes the secret once the credentials expire. Requests that cannot
+// be fulfilled get the StorageAccessErrorAnnotation and are left alone.
+type StorageAccessController struct {
+	secrets       coreset.SecretsGetter
+	secretLister  corelisters.SecretNamespaceLister
+	configLister  imageregistrylisters.ConfigLister
+	eventRecorder events.Recorder
+	newDriver     func(*imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error)
+	now           func() time.Time
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+// NewStorageAccessController returns a new StorageAccessController.
+func NewStorageAccessController(
+	kubeconfig *rest.Config,
+	secrets coreset.SecretsGetter,
+	secretInformer corev1informers.SecretInformer,
+	infrastructureInformer configv1informers.InfrastructureInformer,
+	openshiftConfigInformer corev1informers.ConfigMapInformer,
+	openshiftConfigManagedInformer corev1informers.ConfigMapInformer,
+	configInformer imageregistryinformers.ConfigInformer,
+	eventRecorder events.Recorder,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) (*StorageAccessController, error) {
+	listers := client.NewStorageListers(
+		infrastructureInformer.Lister(),
+		openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+	)
+
+	c := &StorageAccessController{
+		secrets:       secrets,
+		secretLister:  secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		configLister:  configInformer.Lister(),
+		eventRecorder: eventRecorder,
+		newDriver: func(cfg *imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error) {
+			return storage.NewDriver(cfg, kubeconfig, listers, featureGateAccessor)
+		},
+		now:   time.Now,
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StorageAccessController"),
+	}
+
+	if _, err := secretInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: isStorageAccessRequest,
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.enqueue,
+			UpdateFunc: func(old, new interface{}) { c.enqueue(new) },
+		},
+	}); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, secretInformer.Informer().HasSynced)
+
+	// the storage listers and the registry config are only read when a
+	// request is processed, they don't trigger syncs.
+	c.cachesToSync = append(c.cachesToSync,
+		infrastructureInformer.Informer().HasSynced,
+		openshiftConfigInformer.Informer().HasSynced,
+		openshiftConfigManagedInformer.Informer().HasSynced,
+		configInformer.Informer().HasSynced,
+	)
+
+	return c, nil
+}
+
+func isStorageAccessRequest(obj interface{}) bool {
+	sec, ok := obj.(*corev1.Secret)
+	if !ok {
+		return false
+	}
+	_, ok = sec.Labels[defaults.StorageAccessRequestLabel]
+	return ok
+}
+
+func (c *StorageAccessController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// parseStorageAccessRequest returns the scope and the lifetime of the
+// credentials requested by sec.
+func parseStorageAccessRequest(sec *corev1.Secret) (readOnly bool, duration time.Duration, err error) {
+	switch scope := sec.Annotations[defaults.StorageAccessScopeAnnotation]; scope {
+	case "", storageAccessReadOnly:
+		readOnly = true
+	case storageAccessReadWrite:
+		readOnly = false
+	default:
+		return false, 0, fmt.Errorf("invalid scope %q, expected %s or %s", scope, storageAccessReadOnly, storageAccessReadWrite)
+	}
+
+	duration = storageAccessDefaultDuration
+	if value, ok := sec.Annotations[defaults.StorageAccessDurationAnnotation]; ok {
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+	}
+	if duration < storageAccessMinDuration || duration > storageAccessMaxDuration {
+		return false, 0, fmt.Errorf("duration %s is out of range, it must be between %s and %s", duration, storageAccessMinDuration, storageAccessMaxDuration)
+	}
+	return readOnly, duration, nil
+}
+
+func (c *StorageAccessController) sync(ctx context.Context, name string) error {
+	sec, err := c.secretLister.Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !isStorageAccessRequest(sec) {
+		return nil
+	}
+	if _, ok := sec.Annotations[defaults.StorageAccessErrorAnnotation]; ok {
+		return nil
+	}
+
+	if value, ok := sec.Annotations[defaults.StorageAccessExpiryAnnotation]; ok {
+		expiry, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return c.reject(ctx, sec, fmt.Errorf("invalid expiry %q: %w", value, err))
+		}
+		return c.revokeAt(ctx, sec, expiry)
+	}
+
+	readOnly, duration, err := parseStorageAccessRequest(sec)
+	if err != nil {
+		return c.reject(ctx, sec, err)
+	}
+
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil {
+		return err
+	}
+	if cr.Spec.ManagementState != operatorv1.Managed {
+		return c.reject(ctx, sec, fmt.Errorf("the image registry is %s", cr.Spec.ManagementState))
+	}
+
+	driver, err := c.newDriver(&cr.Spec.Storage)
+	if err != nil {
+		return err
+	}
+	granter, ok := driver.(storage.AccessGranter)
+	if !ok {
+		return c.reject(ctx, sec, fmt.Errorf("the %s storage does not support short-lived credentials", driver.ID()))
+	}
+
+	data, expiry, err := granter.GrantAccess(readOnly, duration)
+	var storageErr *storageutil.StorageError
+	if goerrors.As(err, &storageErr) && storageErr.Permanent() {
+		return c.reject(ctx, sec, err)
+	} else if err != nil {
+		return fmt.Errorf("unable to grant access to the storage for %s: %w", sec.Name, err)
+	}
+
+	sec = sec.DeepCopy()
+	sec.Data = data
+	sec.Annotations[defaults.StorageAccessExpiryAnnotation] = expiry.UTC().Format(time.RFC3339)
+	if _, err := c.secrets.Secrets(sec.Namespace).Update(ctx, sec, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	scope := storageAccessReadWrite
+	if readOnly {
+		scope = storageAccessReadOnly
+	}
+	c.eventRecorder.Eventf("StorageAccessGranted", "Issued %s storage credentials in secret %s, they expire at %s", scope, sec.Name, expiry.UTC().Format(time.RFC3339))
+	c.queue.AddAfter(name, expiry.Sub(c.now()))
+	return nil
+}
+
+// revokeAt deletes sec if expiry has passed, or schedules its deletion.
+func (c *StorageAccessController) revokeAt(ctx context.Context, sec *corev1.Secret, expiry time.Time) error {
+	if remaining := expiry.Sub(c.now()); remaining > 0 {
+		c.queue.AddAfter(sec.Name, remaining)
+		return nil
+	}
+
+	err := c.secrets.Secrets(sec.Namespace).Delete(ctx, sec.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &sec.UID},
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// The credentials cannot be revoked before they expire, the secret is
+	// only deleted once they have.
+	c.eventRecorder.Eventf("StorageAccessRevoked", "Deleted expired storage credentials in secret %s", sec.Name)
+	return nil
+}
+
+// reject records on sec why its request cannot be fulfilled.
+func (c *StorageAccessController) reject(ctx context.Context, sec *corev1.Secret, reason error) error {
+	sec = sec.DeepCopy()
+	if sec.Annotations == nil {
+		sec.Annotations = map[string]string{}
+	}
+	sec.Annotations[defaults.StorageAccessErrorAnnotation] = reason.Error()
+	sec.Data = nil
+	if _, err := c.secrets.Secrets(sec.Namespace).Update(ctx, sec, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	c.eventRecorder.Warningf("StorageAccessRejected", "Rejected storage access request %s: %s", sec.Name, reason)
+	return nil
+}
+
+func (c *StorageAccessController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *StorageAccessController) processNextWorkItem(ctx context.Context) bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("StorageAccessController: got event from workqueue: %s", obj)
+	_, name, err := cache.SplitMetaNamespaceKey(fmt.Sprint(obj))
+	if err != nil {
+		utilruntime.HandleError(err)
+		c.queue.Forget(obj)
+		return true
+	}
+	if err := c.sync(ctx, name); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("StorageAccessController: unable to sync %s: %s, requeuing", obj, err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("StorageAccessController: event from workqueue processed")
+	}
+	return true
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageAccessController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting StorageAccessController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+
+	klog.Infof("Started StorageAccessController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageAccessController")
+}
@@ -0,0 +1,306 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistrylisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type fakeAccessDriver struct {
+	storage.Driver
+	readOnly bool
+	duration time.Duration
+	expiry   time.Time
+	err      error
+}
+
+func (d *fakeAccessDriver) ID() string {
+	return "fake"
+}
+
+func (d *fakeAccessDriver) GrantAccess(readOnly bool, duration time.Duration) (map[string][]byte, time.Time, error) {
+	if d.err != nil {
+		return nil, time.Time{}, d.err
+	}
+	d.readOnly = readOnly
+	d.duration = duration
+	return map[string][]byte{"token": []byte("secret")}, d.expiry, nil
+}
+
+func TestParseStorageAccessRequest(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		readOnly    bool
+		duration    time.Duration
+		err         bool
+	}{
+		{
+			name:     "defaults",
+			readOnly: true,
+			duration: time.Hour,
+		},
+		{
+			name: "read-write",
+			annotations: map[string]string{
+				defaults.StorageAccessScopeAnnotation:    "ReadWrite",
+				defaults.StorageAccessDurationAnnotation: "2h30m",
+			},
+			readOnly: false,
+			duration: 150 * time.Minute,
+		},
+		{
+			name:        "invalid scope",
+			annotations: map[string]string{defaults.StorageAccessScopeAnnotation: "Admin"},
+			err:         true,
+		},
+		{
+			name:        "invalid duration",
+			annotations: map[string]string{defaults.StorageAccessDurationAnnotation: "a day"},
+			err:         true,
+		},
+		{
+			name:        "too short",
+			annotations: map[string]string{defaults.StorageAccessDurationAnnotation: "5m"},
+			err:         true,
+		},
+		{
+			name:        "too long",
+			annotations: map[string]string{defaults.StorageAccessDurationAnnotation: "24h"},
+			err:         true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			readOnly, duration, err := parseStorageAccessRequest(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+			})
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if readOnly != tt.readOnly || duration != tt.duration {
+				t.Errorf("expected readOnly=%t duration=%s, got readOnly=%t duration=%s", tt.readOnly, tt.duration, readOnly, duration)
+			}
+		})
+	}
+}
+
+func TestStorageAccessSync(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	request := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      "migration",
+			Labels:    map[string]string{defaults.StorageAccessRequestLabel: ""},
+			Annotations: map[string]string{
+				defaults.StorageAccessScopeAnnotation:    "ReadWrite",
+				defaults.StorageAccessDurationAnnotation: "30m",
+			},
+		},
+	}
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		},
+	}
+
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := secretIndexer.Add(request); err != nil {
+		t.Fatal(err)
+	}
+	configIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := configIndexer.Add(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeClient := kfake.NewSimpleClientset(request)
+	driver := &fakeAccessDriver{expiry: now.Add(30 * time.Minute)}
+	c := &StorageAccessController{
+		secrets:       kubeClient.CoreV1(),
+		secretLister:  corelisters.NewSecretLister(secretIndexer).Secrets(defaults.ImageRegistryOperatorNamespace),
+		configLister:  imageregistrylisters.NewConfigLister(configIndexer),
+		eventRecorder: events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{}),
+		newDriver: func(*imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error) {
+			return driver, nil
+		},
+		now:   func() time.Time { return now },
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StorageAccessController"),
+	}
+	defer c.queue.ShutDown()
+
+	ctx := context.Background()
+	if err := c.sync(ctx, request.Name); err != nil {
+		t.Fatal(err)
+	}
+	if driver.readOnly || driver.duration != 30*time.Minute {
+		t.Errorf("unexpected grant: readOnly=%t duration=%s", driver.readOnly, driver.duration)
+	}
+
+	granted, err := kubeClient.CoreV1().Secrets(request.Namespace).Get(ctx, request.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(granted.Data["token"]) != "secret" {
+		t.Errorf("expected the credentials in the secret, got %v", granted.Data)
+	}
+	if expiry := granted.Annotations[defaults.StorageAccessExpiryAnnotation]; expiry != "2026-10-01T12:30:00Z" {
+		t.Errorf("unexpected expiry %q", expiry)
+	}
+
+	// the credentials are revoked once they expire.
+	if err := secretIndexer.Update(granted); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Minute)
+	if err := c.sync(ctx, request.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeClient.CoreV1().Secrets(request.Namespace).Get(ctx, request.Name, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the secret to be kept until its expiry: %v", err)
+	}
+
+	now = now.Add(30 * time.Minute)
+	if err := c.sync(ctx, request.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeClient.CoreV1().Secrets(request.Namespace).Get(ctx, request.Name, metav1.GetOptions{}); err == nil {
+		t.Fatal("expected the expired secret to be deleted")
+	}
+}
+
+func TestStorageAccessSyncUnsupportedDriver(t *testing.T) {
+	request := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      "migration",
+			Labels:    map[string]string{defaults.StorageAccessRequestLabel: ""},
+		},
+	}
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		},
+	}
+
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := secretIndexer.Add(request); err != nil {
+		t.Fatal(err)
+	}
+	configIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := configIndexer.Add(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeClient := kfake.NewSimpleClientset(request)
+	c := &StorageAccessController{
+		secrets:       kubeClient.CoreV1(),
+		secretLister:  corelisters.NewSecretLister(secretIndexer).Secrets(defaults.ImageRegistryOperatorNamespace),
+		configLister:  imageregistrylisters.NewConfigLister(configIndexer),
+		eventRecorder: events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{}),
+		newDriver: func(*imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error) {
+			return unsupportedDriver{}, nil
+		},
+		now:   time.Now,
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StorageAccessController"),
+	}
+	defer c.queue.ShutDown()
+
+	ctx := context.Background()
+	if err := c.sync(ctx, request.Name); err != nil {
+		t.Fatal(err)
+	}
+	rejected, err := kubeClient.CoreV1().Secrets(request.Namespace).Get(ctx, request.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := rejected.Annotations[defaults.StorageAccessErrorAnnotation]; msg != "the fake storage does not support short-lived credentials" {
+		t.Errorf("unexpected error annotation %q", msg)
+	}
+}
+
+func TestStorageAccessSyncPermanentError(t *testing.T) {
+	request := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      "migration",
+			Labels:    map[string]string{defaults.StorageAccessRequestLabel: ""},
+		},
+	}
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			OperatorSpec: operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		},
+	}
+
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := secretIndexer.Add(request); err != nil {
+		t.Fatal(err)
+	}
+	configIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := configIndexer.Add(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeClient := kfake.NewSimpleClientset(request)
+	driver := &fakeAccessDriver{
+		err: storageutil.NewStorageError(storageutil.ErrorKindInvalidConfig, fmt.Errorf("the operator uses temporary AWS STS credentials")),
+	}
+	c := &StorageAccessController{
+		secrets:       kubeClient.CoreV1(),
+		secretLister:  corelisters.NewSecretLister(secretIndexer).Secrets(defaults.ImageRegistryOperatorNamespace),
+		configLister:  imageregistrylisters.NewConfigLister(configIndexer),
+		eventRecorder: events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{}),
+		newDriver: func(*imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error) {
+			return driver, nil
+		},
+		now:   time.Now,
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StorageAccessController"),
+	}
+	defer c.queue.ShutDown()
+
+	ctx := context.Background()
+	if err := c.sync(ctx, request.Name); err != nil {
+		t.Fatalf("expected the request to be rejected without retries, got %v", err)
+	}
+	rejected, err := kubeClient.CoreV1().Secrets(request.Namespace).Get(ctx, request.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := rejected.Annotations[defaults.StorageAccessErrorAnnotation]; msg != "the operator uses temporary AWS STS credentials" {
+		t.Errorf("unexpected error annotation %q", msg)
+	}
+}
+
+type unsupportedDriver struct {
+	storage.Driver
+}
+
+func (unsupportedDriver) ID() string {
+	return "fake"
+}
@@ -0,0 +1,329 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/benchmark"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+const (
+	storageBenchmarkProgressing = "StorageBenchmarkProgressing"
+	storageBenchmarkDegraded    = "StorageBenchmarkDegraded"
+)
+
+// StorageBenchmarkController measures the throughput and the latency of the
+// registry storage on request. A benchmark is requested by setting the
+// StorageBenchmarkAnnotation on the registry config, the controller runs the
+// benchmark command of the operator in a job for it. The job pushes blobs to
+// the registry and pulls them back, the measures are published in the
+// StorageBenchmarkProgressing condition and as metrics. The job of a finished
+// benchmark is kept until the annotation is removed or changed, so that a
+// benchmark runs only once.
+type StorageBenchmarkController struct {
+	coreClient                corev1client.CoreV1Interface
+	batchClient               batchv1client.BatchV1Interface
+	operatorClient            v1helpers.OperatorClient
+	jobLister                 batchv1listers.JobNamespaceLister
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+
+	// reportedJob is the uid of the job whose result is published.
+	reportedJob string
+	result      *benchmark.Result
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+func NewStorageBenchmarkController(
+	coreClient corev1client.CoreV1Interface,
+	batchClient batchv1client.BatchV1Interface,
+	operatorClient v1helpers.OperatorClient,
+	jobInformer batchv1informers.JobInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+) (*StorageBenchmarkController, error) {
+	c := &StorageBenchmarkController{
+		coreClient:                coreClient,
+		batchClient:               batchClient,
+		operatorClient:            operatorClient,
+		jobLister:                 jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StorageBenchmarkController"),
+	}
+
+	if _, err := jobInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, jobInformer.Informer().HasSynced)
+
+	if _, err := imageRegistryConfigInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, imageRegistryConfigInformer.Informer().HasSynced)
+
+	return c, nil
+}
+
+func (c *StorageBenchmarkController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *StorageBenchmarkController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *StorageBenchmarkController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue: %s", obj)
+
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("StorageBenchmarkController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("StorageBenchmarkController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// parseBenchmarkResult parses the result the benchmark command writes to the
+// termination log of its container.
+func parseBenchmarkResult(pod *corev1.Pod) (*benchmark.Result, error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+			continue
+		}
+		result := &benchmark.Result{}
+		if err := json.Unmarshal([]byte(status.State.Terminated.Message), result); err != nil {
+			return nil, fmt.Errorf("unable to parse the result of the pod %s: %w", pod.Name, err)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("the pod %s has no terminated container", pod.Name)
+}
+
+// jobResult returns the result of the succeeded pod of the benchmark job.
+func (c *StorageBenchmarkController) jobResult(ctx context.Context, job *batchv1.Job) (*benchmark.Result, error) {
+	pods, err := c.coreClient.Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"job-name": job.Name}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodSucceeded {
+			return parseBenchmarkResult(&pods.Items[i])
+		}
+	}
+	return nil, fmt.Errorf("the job %s has no succeeded pod", job.Name)
+}
+
+// formatOperation describes the measure of the writes or of the reads.
+func formatOperation(op benchmark.Operation) string {
+	return fmt.Sprintf("%.1f MiB/s, p50 %.3fs, p99 %.3fs", op.ThroughputBytesPerSecond/(1024*1024), op.LatencyP50Seconds, op.LatencyP99Seconds)
+}
+
+// storageBenchmarkConditions returns the operator conditions that report the
+// progress of the job of the benchmark and its result.
+func storageBenchmarkConditions(name string, job *batchv1.Job, result *benchmark.Result) []operatorv1.OperatorCondition {
+	progressing := operatorv1.OperatorCondition{
+		Type:    storageBenchmarkProgressing,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "Running",
+		Message: fmt.Sprintf("The storage benchmark %s is running", name),
+	}
+	degraded := operatorv1.OperatorCondition{
+		Type:   storageBenchmarkDegraded,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+
+	if job == nil {
+		return []operatorv1.OperatorCondition{progressing, degraded}
+	}
+
+	finished := storageMigrationJobFinished(job)
+	switch {
+	case finished == nil:
+	case finished.Type == batchv1.JobComplete:
+		progressing.Status = operatorv1.ConditionFalse
+		progressing.Reason = "Completed"
+		progressing.Message = fmt.Sprintf("The storage benchmark %s is completed", name)
+		if result != nil {
+			progressing.Message += fmt.Sprintf(
+				": %d blobs of %d MiB, writes %s, reads %s",
+				result.Blobs, result.BlobSizeBytes/(1024*1024), formatOperation(result.Write), formatOperation(result.Read),
+			)
+		}
+	default:
+		progressing.Status = operatorv1.ConditionFalse
+		progressing.Reason = "Failed"
+		progressing.Message = fmt.Sprintf("The storage benchmark %s failed", name)
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "JobFailed"
+		degraded.Message = fmt.Sprintf("The job of the storage benchmark %s failed: %s", name, finished.Message)
+	}
+	return []operatorv1.OperatorCondition{progressing, degraded}
+}
+
+// applyJob creates the job of the benchmark name with the settings of the
+// benchmark override.
+func (c *StorageBenchmarkController) applyJob(cr *imageregistryv1.Config, name string) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	settings, err := configOverrides.StorageBenchmark()
+	if err != nil {
+		return err
+	}
+	return resource.ApplyMutator(resource.NewGeneratorStorageBenchmarkJob(c.jobLister, c.batchClient, settings, name))
+}
+
+func (c *StorageBenchmarkController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	name := cr.Annotations[defaults.StorageBenchmarkAnnotation]
+
+	job, err := c.jobLister.Get(defaults.StorageBenchmarkJobName)
+	if errors.IsNotFound(err) {
+		job = nil
+	} else if err != nil {
+		return err
+	}
+
+	if name == "" {
+		if job != nil {
+			propagationPolicy := metav1.DeletePropagationForeground
+			if err := c.batchClient.Jobs(defaults.ImageRegistryOperatorNamespace).Delete(
+				ctx, defaults.StorageBenchmarkJobName, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy},
+			); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		c.reportedJob = ""
+		c.result = nil
+		metrics.ReportStorageBenchmark(nil)
+
+		var removeConditionFns []v1helpers.UpdateStatusFunc
+		for _, conditionType := range []string{storageBenchmarkProgressing, storageBenchmarkDegraded} {
+			if v1helpers.FindOperatorCondition(cr.Status.Conditions, conditionType) == nil {
+				continue
+			}
+			conditionType := conditionType
+			removeConditionFns = append(removeConditionFns, func(oldStatus *operatorv1.OperatorStatus) error {
+				v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, conditionType)
+				return nil
+			})
+		}
+		if len(removeConditionFns) > 0 {
+			if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, removeConditionFns...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the job of a finished benchmark is not touched, a benchmark runs once.
+	if job == nil || job.Annotations[defaults.StorageBenchmarkAnnotation] != name || storageMigrationJobFinished(job) == nil {
+		if err := c.applyJob(cr, name); err != nil {
+			_, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+				Type:    storageBenchmarkDegraded,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Error",
+				Message: fmt.Sprintf("Unable to start the storage benchmark %s: %s", name, err),
+			}))
+			return utilerrors.NewAggregate([]error{err, updateErr})
+		}
+		if job != nil && job.Annotations[defaults.StorageBenchmarkAnnotation] != name {
+			job = nil
+		}
+	}
+
+	if job == nil || string(job.UID) != c.reportedJob {
+		c.reportedJob = ""
+		c.result = nil
+		metrics.ReportStorageBenchmark(nil)
+	}
+	if job != nil && c.reportedJob == "" {
+		if finished := storageMigrationJobFinished(job); finished != nil && finished.Type == batchv1.JobComplete {
+			result, err := c.jobResult(ctx, job)
+			if err != nil {
+				// the pod may have been deleted, the benchmark is reported
+				// without its measures.
+				klog.Warningf("StorageBenchmarkController: unable to get the result of the job %s: %s", job.Name, err)
+			}
+			c.reportedJob = string(job.UID)
+			c.result = result
+			metrics.ReportStorageBenchmark(result)
+		}
+	}
+
+	var updateFns []v1helpers.UpdateStatusFunc
+	for _, cond := range storageBenchmarkConditions(name, job, c.result) {
+		updateFns = append(updateFns, v1helpers.UpdateConditionFn(cond))
+	}
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, updateFns...)
+	return err
+}
+
+func (c *StorageBenchmarkController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting StorageBenchmarkController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started StorageBenchmarkController")
+	<-stopCh
+	klog.Infof("Shutting down StorageBenchmarkController")
+}
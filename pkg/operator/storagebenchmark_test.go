@@ -0,0 +1,70 @@
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStorageBenchmarkConditions(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-registry-storage-benchmark-x7k2p"},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							Message: `{"blobs":16,"blobSizeBytes":16777216,` +
+								`"write":{"throughputBytesPerSecond":104857600,"latencyP50Seconds":0.5,"latencyP99Seconds":1.25},` +
+								`"read":{"throughputBytesPerSecond":209715200,"latencyP50Seconds":0.25,"latencyP99Seconds":0.5}}`,
+						},
+					},
+				},
+			},
+		},
+	}
+	result, err := parseBenchmarkResult(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running := &batchv1.Job{}
+	conds := storageBenchmarkConditions("run-1", running, nil)
+	if conds[0].Status != operatorv1.ConditionTrue || conds[0].Reason != "Running" {
+		t.Errorf("expected the benchmark to be running, got %#v", conds[0])
+	}
+
+	completed := &batchv1.Job{
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	conds = storageBenchmarkConditions("run-1", completed, result)
+	expected := "The storage benchmark run-1 is completed: 16 blobs of 16 MiB, writes 100.0 MiB/s, p50 0.500s, p99 1.250s, reads 200.0 MiB/s, p50 0.250s, p99 0.500s"
+	if conds[0].Status != operatorv1.ConditionFalse || conds[0].Message != expected {
+		t.Errorf("expected the message %q, got %#v", expected, conds[0])
+	}
+	if conds[1].Status != operatorv1.ConditionFalse {
+		t.Errorf("expected the operator not to be degraded, got %#v", conds[1])
+	}
+
+	failed := &batchv1.Job{
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}},
+		},
+	}
+	conds = storageBenchmarkConditions("run-1", failed, nil)
+	if conds[1].Status != operatorv1.ConditionTrue || !strings.Contains(conds[1].Message, "BackoffLimitExceeded") {
+		t.Errorf("expected the failure to be reported, got %#v", conds[1])
+	}
+
+	pod.Status.ContainerStatuses[0].State.Terminated.Message = "unable to start an upload: 401 Unauthorized"
+	if _, err := parseBenchmarkResult(pod); err == nil {
+		t.Errorf("expected an error for a message that is not a result")
+	}
+}
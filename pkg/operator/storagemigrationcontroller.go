@@ -0,0 +1,286 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+const (
+	storageMigrationProgressing = "StorageMigrationProgressing"
+	storageMigrationDegraded    = "StorageMigrationDegraded"
+)
+
+// StorageMigrationController relocates the blobs of the registry storage on
+// request. A migration is requested by setting the StorageMigrationAnnotation
+// on the registry config, the controller runs the move-blobs command in a job
+// for it and reports the progress of the job in the operator conditions. The
+// job of a finished migration is kept until the annotation is removed or
+// changed, so that a migration runs only once.
+type StorageMigrationController struct {
+	batchClient               batchv1client.BatchV1Interface
+	operatorClient            v1helpers.OperatorClient
+	jobLister                 batchv1listers.JobNamespaceLister
+	secretLister              corev1listers.SecretNamespaceLister
+	openshiftConfigLister     corev1listers.ConfigMapNamespaceLister
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+	infrastructureLister      configlisters.InfrastructureLister
+	proxyLister               configlisters.ProxyLister
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+func NewStorageMigrationController(
+	batchClient batchv1client.BatchV1Interface,
+	operatorClient v1helpers.OperatorClient,
+	jobInformer batchv1informers.JobInformer,
+	secretInformer corev1informers.SecretInformer,
+	openshiftConfigInformer corev1informers.ConfigMapInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+	infrastructureInformer configv1informers.InfrastructureInformer,
+	proxyInformer configv1informers.ProxyInformer,
+) (*StorageMigrationController, error) {
+	c := &StorageMigrationController{
+		batchClient:               batchClient,
+		operatorClient:            operatorClient,
+		jobLister:                 jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		secretLister:              secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		openshiftConfigLister:     openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		infrastructureLister:      infrastructureInformer.Lister(),
+		proxyLister:               proxyInformer.Lister(),
+		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StorageMigrationController"),
+	}
+
+	if _, err := jobInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, jobInformer.Informer().HasSynced)
+
+	if _, err := imageRegistryConfigInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, imageRegistryConfigInformer.Informer().HasSynced)
+
+	// the credentials, the cloud configuration and the proxy are read when
+	// the job is created, they don't trigger syncs.
+	c.cachesToSync = append(c.cachesToSync,
+		secretInformer.Informer().HasSynced,
+		openshiftConfigInformer.Informer().HasSynced,
+		infrastructureInformer.Informer().HasSynced,
+		proxyInformer.Informer().HasSynced,
+	)
+
+	return c, nil
+}
+
+func (c *StorageMigrationController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *StorageMigrationController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *StorageMigrationController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue: %s", obj)
+
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("StorageMigrationController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("StorageMigrationController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// storageMigrationJobFinished returns the condition that finished job, nil
+// if the job is still running.
+func storageMigrationJobFinished(job *batchv1.Job) *batchv1.JobCondition {
+	for i, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		if cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// storageMigrationConditions returns the operator conditions that report the
+// progress of the job of the migration.
+func storageMigrationConditions(migration string, job *batchv1.Job) []operatorv1.OperatorCondition {
+	progressing := operatorv1.OperatorCondition{
+		Type:    storageMigrationProgressing,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "Migrating",
+		Message: fmt.Sprintf("The blobs of the storage migration %s are being moved", migration),
+	}
+	degraded := operatorv1.OperatorCondition{
+		Type:   storageMigrationDegraded,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+
+	if job == nil {
+		return []operatorv1.OperatorCondition{progressing, degraded}
+	}
+	if job.Status.Failed > 0 {
+		progressing.Message += fmt.Sprintf(", %d attempts failed", job.Status.Failed)
+	}
+
+	finished := storageMigrationJobFinished(job)
+	switch {
+	case finished == nil:
+	case finished.Type == batchv1.JobComplete:
+		progressing.Status = operatorv1.ConditionFalse
+		progressing.Reason = "Completed"
+		progressing.Message = fmt.Sprintf("The storage migration %s is completed", migration)
+	default:
+		progressing.Status = operatorv1.ConditionFalse
+		progressing.Reason = "Failed"
+		progressing.Message = fmt.Sprintf("The storage migration %s failed", migration)
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "JobFailed"
+		degraded.Message = fmt.Sprintf("The job of the storage migration %s failed: %s", migration, finished.Message)
+	}
+	return []operatorv1.OperatorCondition{progressing, degraded}
+}
+
+func (c *StorageMigrationController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	migration := cr.Annotations[defaults.StorageMigrationAnnotation]
+
+	job, err := c.jobLister.Get(defaults.StorageMigrationJobName)
+	if errors.IsNotFound(err) {
+		job = nil
+	} else if err != nil {
+		return err
+	}
+
+	if migration == "" {
+		if job != nil {
+			propagationPolicy := metav1.DeletePropagationForeground
+			if err := c.batchClient.Jobs(defaults.ImageRegistryOperatorNamespace).Delete(
+				ctx, defaults.StorageMigrationJobName, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy},
+			); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		var removeConditionFns []v1helpers.UpdateStatusFunc
+		for _, conditionType := range []string{storageMigrationProgressing, storageMigrationDegraded} {
+			if v1helpers.FindOperatorCondition(cr.Status.Conditions, conditionType) == nil {
+				continue
+			}
+			conditionType := conditionType
+			removeConditionFns = append(removeConditionFns, func(oldStatus *operatorv1.OperatorStatus) error {
+				v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, conditionType)
+				return nil
+			})
+		}
+		if len(removeConditionFns) > 0 {
+			if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, removeConditionFns...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the job of a finished migration is not touched, the blobs are only
+	// moved once per migration.
+	if job == nil || job.Annotations[defaults.StorageMigrationAnnotation] != migration || storageMigrationJobFinished(job) == nil {
+		gen := resource.NewGeneratorStorageMigrationJob(
+			c.jobLister,
+			c.batchClient,
+			c.secretLister,
+			c.infrastructureLister,
+			c.proxyLister,
+			c.openshiftConfigLister,
+			cr,
+			migration,
+		)
+		if err := resource.ApplyMutator(gen); err != nil {
+			_, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+				Type:    storageMigrationDegraded,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Error",
+				Message: fmt.Sprintf("Unable to start the storage migration %s: %s", migration, err),
+			}))
+			return utilerrors.NewAggregate([]error{err, updateErr})
+		}
+		if job != nil && job.Annotations[defaults.StorageMigrationAnnotation] != migration {
+			job = nil
+		}
+	}
+
+	var updateFns []v1helpers.UpdateStatusFunc
+	for _, cond := range storageMigrationConditions(migration, job) {
+		updateFns = append(updateFns, v1helpers.UpdateConditionFn(cond))
+	}
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, updateFns...)
+	return err
+}
+
+func (c *StorageMigrationController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting StorageMigrationController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started StorageMigrationController")
+	<-stopCh
+	klog.Infof("Shutting down StorageMigrationController")
+}
@@ -0,0 +1,108 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestStorageMigrationConditions(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		job         *batchv1.Job
+		progressing operatorv1.OperatorCondition
+		degraded    operatorv1.OperatorCondition
+	}{
+		{
+			name: "job not created yet",
+			progressing: operatorv1.OperatorCondition{
+				Type:    storageMigrationProgressing,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Migrating",
+				Message: "The blobs of the storage migration m1 are being moved",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:   storageMigrationDegraded,
+				Status: operatorv1.ConditionFalse,
+				Reason: "AsExpected",
+			},
+		},
+		{
+			name: "job running after a failed attempt",
+			job: &batchv1.Job{
+				Status: batchv1.JobStatus{
+					Active: 1,
+					Failed: 1,
+				},
+			},
+			progressing: operatorv1.OperatorCondition{
+				Type:    storageMigrationProgressing,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Migrating",
+				Message: "The blobs of the storage migration m1 are being moved, 1 attempts failed",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:   storageMigrationDegraded,
+				Status: operatorv1.ConditionFalse,
+				Reason: "AsExpected",
+			},
+		},
+		{
+			name: "job completed",
+			job: &batchv1.Job{
+				Status: batchv1.JobStatus{
+					Succeeded: 1,
+					Conditions: []batchv1.JobCondition{
+						{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+					},
+				},
+			},
+			progressing: operatorv1.OperatorCondition{
+				Type:    storageMigrationProgressing,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Completed",
+				Message: "The storage migration m1 is completed",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:   storageMigrationDegraded,
+				Status: operatorv1.ConditionFalse,
+				Reason: "AsExpected",
+			},
+		},
+		{
+			name: "job failed",
+			job: &batchv1.Job{
+				Status: batchv1.JobStatus{
+					Failed: 7,
+					Conditions: []batchv1.JobCondition{
+						{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"},
+					},
+				},
+			},
+			progressing: operatorv1.OperatorCondition{
+				Type:    storageMigrationProgressing,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Failed",
+				Message: "The storage migration m1 failed",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:    storageMigrationDegraded,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "JobFailed",
+				Message: "The job of the storage migration m1 failed: Job has reached the specified backoff limit",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := storageMigrationConditions("m1", tc.job)
+			want := []operatorv1.OperatorCondition{tc.progressing, tc.degraded}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
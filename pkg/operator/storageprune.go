@@ -0,0 +1,373 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1informers "k8s.io/client-go/informers/apps/v1"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	rbacv1informers "k8s.io/client-go/informers/rbac/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+const (
+	hardPruneProgressing = "HardPruneProgressing"
+	hardPruneDegraded    = "HardPruneDegraded"
+
+	storagePruneWorkQueueKey = "instance"
+)
+
+// StoragePruneController runs the hard prune of the registry storage on the
+// schedule of the hardPrune maintenance override. It manages a cron job whose
+// jobs are created suspended: a job is started once no image was created
+// during keepYoungerThan, as the hard prune would delete the blobs of the
+// images that are being pushed. The outcome of the last job is reported in
+// the operator conditions.
+type StoragePruneController struct {
+	batchClient               batchv1client.BatchV1Interface
+	rbacClient                rbacv1client.RbacV1Interface
+	imageClient               imageset.ImagesGetter
+	operatorClient            v1helpers.OperatorClient
+	cronJobLister             batchv1listers.CronJobNamespaceLister
+	jobLister                 batchv1listers.JobNamespaceLister
+	deploymentLister          appsv1listers.DeploymentNamespaceLister
+	clusterRoleBindingLister  rbacv1listers.ClusterRoleBindingLister
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+func NewStoragePruneController(
+	batchClient batchv1client.BatchV1Interface,
+	rbacClient rbacv1client.RbacV1Interface,
+	imageClient imageset.ImagesGetter,
+	operatorClient v1helpers.OperatorClient,
+	cronJobInformer batchv1informers.CronJobInformer,
+	jobInformer batchv1informers.JobInformer,
+	deploymentInformer appsv1informers.DeploymentInformer,
+	clusterRoleBindingInformer rbacv1informers.ClusterRoleBindingInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+) (*StoragePruneController, error) {
+	c := &StoragePruneController{
+		batchClient:               batchClient,
+		rbacClient:                rbacClient,
+		imageClient:               imageClient,
+		operatorClient:            operatorClient,
+		cronJobLister:             cronJobInformer.Lister().CronJobs(defaults.ImageRegistryOperatorNamespace),
+		jobLister:                 jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		deploymentLister:          deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		clusterRoleBindingLister:  clusterRoleBindingInformer.Lister(),
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "StoragePruneController"),
+	}
+
+	for _, informer := range []cache.SharedIndexInformer{
+		cronJobInformer.Informer(),
+		jobInformer.Informer(),
+		deploymentInformer.Informer(),
+		clusterRoleBindingInformer.Informer(),
+		imageRegistryConfigInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(c.eventHandler()); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+
+	return c, nil
+}
+
+func (c *StoragePruneController) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(storagePruneWorkQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(storagePruneWorkQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(storagePruneWorkQueueKey) },
+	}
+}
+
+func (c *StoragePruneController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *StoragePruneController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue: %s", obj)
+
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("StoragePruneController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("StoragePruneController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// hardPruneQuietPeriod decides whether a waiting hard prune job can be
+// started: no image must have been created during keepYoungerThan. It
+// returns how long the job still has to wait otherwise.
+func hardPruneQuietPeriod(newestImage time.Time, keepYoungerThan time.Duration, now time.Time) (bool, time.Duration) {
+	remaining := newestImage.Add(keepYoungerThan).Sub(now)
+	if remaining <= 0 {
+		return true, 0
+	}
+	return false, remaining
+}
+
+// hardPruneConditions returns the operator conditions that report the jobs
+// of the hard prune. deferred is the time the waiting jobs still wait, zero
+// if no job waits.
+func hardPruneConditions(jobs []*batchv1.Job, deferred time.Duration, dryRun bool) []operatorv1.OperatorCondition {
+	progressing := operatorv1.OperatorCondition{
+		Type:   hardPruneProgressing,
+		Status: operatorv1.ConditionFalse,
+		Reason: "Idle",
+	}
+	degraded := operatorv1.OperatorCondition{
+		Type:   hardPruneDegraded,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+
+	jobs = append([]*batchv1.Job(nil), jobs...)
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreationTimestamp.After(jobs[j].CreationTimestamp.Time)
+	})
+	for _, job := range jobs {
+		finished := storageMigrationJobFinished(job)
+		switch {
+		case finished == nil && deferred > 0 && job.Status.StartTime == nil:
+			progressing.Status = operatorv1.ConditionTrue
+			progressing.Reason = "Deferred"
+			progressing.Message = fmt.Sprintf("The hard prune job %s waits %s more for images to stop being pushed", job.Name, deferred.Round(time.Second))
+		case finished == nil:
+			progressing.Status = operatorv1.ConditionTrue
+			progressing.Reason = "Pruning"
+			progressing.Message = fmt.Sprintf("The hard prune job %s is running", job.Name)
+		default:
+			if progressing.Status == operatorv1.ConditionFalse {
+				progressing.Reason = "Completed"
+				progressing.Message = fmt.Sprintf("The last hard prune job %s finished at %s", job.Name, finished.LastTransitionTime.UTC().Format(time.RFC3339))
+				if dryRun {
+					progressing.Message += ", it was a dry run"
+				}
+			}
+			if finished.Type == batchv1.JobFailed {
+				degraded.Status = operatorv1.ConditionTrue
+				degraded.Reason = "JobFailed"
+				degraded.Message = fmt.Sprintf("The hard prune job %s failed: %s", job.Name, finished.Message)
+			}
+			return []operatorv1.OperatorCondition{progressing, degraded}
+		}
+	}
+	return []operatorv1.OperatorCondition{progressing, degraded}
+}
+
+// newestImage returns the creation time of the newest image, or the zero
+// time if there are no images.
+func (c *StoragePruneController) newestImage(ctx context.Context) (time.Time, error) {
+	var newest time.Time
+	opts := metav1.ListOptions{Limit: imageStreamPageSize}
+	for {
+		var list *imagev1.ImageList
+		err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+			return !errors.IsResourceExpired(err) && ctx.Err() == nil
+		}, func() (err error) {
+			list, err = c.imageClient.Images().List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+		for i := range list.Items {
+			if created := list.Items[i].CreationTimestamp.Time; created.After(newest) {
+				newest = created
+			}
+		}
+		if list.Continue == "" {
+			return newest, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// startHardPruneJobs starts the waiting jobs once no image was created during
+// keepYoungerThan. It returns how long the jobs still have to wait otherwise.
+func (c *StoragePruneController) startHardPruneJobs(ctx context.Context, waiting []*batchv1.Job, keepYoungerThan time.Duration) (time.Duration, error) {
+	if len(waiting) == 0 {
+		return 0, nil
+	}
+	newest, err := c.newestImage(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list the images: %w", err)
+	}
+	start, remaining := hardPruneQuietPeriod(newest, keepYoungerThan, time.Now())
+	if !start {
+		return remaining, nil
+	}
+	for _, job := range waiting {
+		_, err := c.batchClient.Jobs(job.Namespace).Patch(
+			ctx, job.Name, types.MergePatchType, []byte(`{"spec":{"suspend":false}}`), metav1.PatchOptions{},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("unable to start the hard prune job %s: %w", job.Name, err)
+		}
+		klog.Infof("started the hard prune job %s, no image was created during the last %s", job.Name, keepYoungerThan)
+	}
+	return 0, nil
+}
+
+// removeHardPrune deletes the cron job of the hard prune with its jobs and
+// the conditions that report them.
+func (c *StoragePruneController) removeHardPrune(ctx context.Context, cr *imageregistryv1.Config) error {
+	for _, gen := range []resource.Mutator{
+		resource.NewGeneratorHardPruneCronJob(c.cronJobLister, c.batchClient, cr, nil, nil),
+		resource.NewGeneratorHardPruneClusterRoleBinding(c.clusterRoleBindingLister, c.rbacClient),
+	} {
+		if _, err := gen.Get(); errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := gen.Delete(metav1.DeleteOptions{PropagationPolicy: ptr.To(metav1.DeletePropagationBackground)}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	var removeConditionFns []v1helpers.UpdateStatusFunc
+	for _, conditionType := range []string{hardPruneProgressing, hardPruneDegraded} {
+		if v1helpers.FindOperatorCondition(cr.Status.Conditions, conditionType) == nil {
+			continue
+		}
+		conditionType := conditionType
+		removeConditionFns = append(removeConditionFns, func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, conditionType)
+			return nil
+		})
+	}
+	if len(removeConditionFns) > 0 {
+		if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, removeConditionFns...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *StoragePruneController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	hardPrune, err := configOverrides.HardPrune()
+	if err != nil {
+		return err
+	}
+	if hardPrune == nil || cr.Spec.ManagementState != operatorv1.Managed {
+		return c.removeHardPrune(ctx, cr)
+	}
+
+	// the jobs run the registry container, the cron job is created once
+	// the registry is deployed.
+	deployment, err := c.deploymentLister.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, gen := range []resource.Mutator{
+		resource.NewGeneratorHardPruneClusterRoleBinding(c.clusterRoleBindingLister, c.rbacClient),
+		resource.NewGeneratorHardPruneCronJob(c.cronJobLister, c.batchClient, cr, deployment, hardPrune),
+	} {
+		if err := resource.ApplyMutator(gen); err != nil {
+			_, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+				Type:    hardPruneDegraded,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Error",
+				Message: fmt.Sprintf("Unable to apply %s: %s", resource.Name(gen), err),
+			}))
+			return utilerrors.NewAggregate([]error{err, updateErr})
+		}
+	}
+
+	jobs, err := c.jobLister.List(labels.SelectorFromSet(labels.Set{"created-by": defaults.HardPruneCronJobName}))
+	if err != nil {
+		return err
+	}
+	deferred, err := c.startHardPruneJobs(ctx, waitingPrunerJobs(jobs), hardPrune.KeepYoungerThan.Duration)
+	if err != nil {
+		return err
+	}
+	if deferred > 0 {
+		c.queue.AddAfter(storagePruneWorkQueueKey, deferred)
+	}
+
+	var updateFns []v1helpers.UpdateStatusFunc
+	for _, cond := range hardPruneConditions(jobs, deferred, hardPrune.DryRun) {
+		updateFns = append(updateFns, v1helpers.UpdateConditionFn(cond))
+	}
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, updateFns...)
+	return err
+}
+
+func (c *StoragePruneController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting StoragePruneController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started StoragePruneController")
+	<-stopCh
+	klog.Infof("Shutting down StoragePruneController")
+}
@@ -0,0 +1,137 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestHardPruneQuietPeriod(t *testing.T) {
+	now := time.Date(2024, 3, 10, 3, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name      string
+		newest    time.Time
+		start     bool
+		remaining time.Duration
+	}{
+		{
+			name:  "no images",
+			start: true,
+		},
+		{
+			name:   "last image created before the quiet period",
+			newest: now.Add(-2 * time.Hour),
+			start:  true,
+		},
+		{
+			name:      "image created during the quiet period",
+			newest:    now.Add(-20 * time.Minute),
+			remaining: 40 * time.Minute,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start, remaining := hardPruneQuietPeriod(tc.newest, time.Hour, now)
+			if start != tc.start || remaining != tc.remaining {
+				t.Errorf("got start=%t remaining=%s, want start=%t remaining=%s", start, remaining, tc.start, tc.remaining)
+			}
+		})
+	}
+}
+
+func TestHardPruneConditions(t *testing.T) {
+	finishedAt := metav1.NewTime(time.Date(2024, 3, 10, 3, 30, 0, 0, time.UTC))
+	job := func(name string, created time.Time, started bool, finished batchv1.JobConditionType) *batchv1.Job {
+		j := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+		}
+		if started {
+			j.Status.StartTime = &metav1.Time{Time: created}
+		} else {
+			j.Spec.Suspend = ptr.To(true)
+		}
+		if finished != "" {
+			j.Status.Conditions = []batchv1.JobCondition{{
+				Type:               finished,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: finishedAt,
+				Message:            "BackoffLimitExceeded",
+			}}
+		}
+		return j
+	}
+	older := time.Date(2024, 3, 3, 3, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 3, 10, 3, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name        string
+		jobs        []*batchv1.Job
+		deferred    time.Duration
+		progressing operatorv1.OperatorCondition
+		degraded    operatorv1.OperatorCondition
+	}{
+		{
+			name: "no jobs",
+			progressing: operatorv1.OperatorCondition{
+				Type:   hardPruneProgressing,
+				Status: operatorv1.ConditionFalse,
+				Reason: "Idle",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:   hardPruneDegraded,
+				Status: operatorv1.ConditionFalse,
+				Reason: "AsExpected",
+			},
+		},
+		{
+			name:     "job deferred after a failed job",
+			jobs:     []*batchv1.Job{job("old", older, true, batchv1.JobFailed), job("new", newer, false, "")},
+			deferred: 15 * time.Minute,
+			progressing: operatorv1.OperatorCondition{
+				Type:    hardPruneProgressing,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Deferred",
+				Message: "The hard prune job new waits 15m0s more for images to stop being pushed",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:    hardPruneDegraded,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "JobFailed",
+				Message: "The hard prune job old failed: BackoffLimitExceeded",
+			},
+		},
+		{
+			name: "last job completed",
+			jobs: []*batchv1.Job{job("new", newer, true, batchv1.JobComplete), job("old", older, true, batchv1.JobFailed)},
+			progressing: operatorv1.OperatorCondition{
+				Type:    hardPruneProgressing,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Completed",
+				Message: "The last hard prune job new finished at 2024-03-10T03:30:00Z",
+			},
+			degraded: operatorv1.OperatorCondition{
+				Type:   hardPruneDegraded,
+				Status: operatorv1.ConditionFalse,
+				Reason: "AsExpected",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conds := hardPruneConditions(tc.jobs, tc.deferred, false)
+			if len(conds) != 2 {
+				t.Fatalf("got %d conditions, want 2", len(conds))
+			}
+			if conds[0] != tc.progressing {
+				t.Errorf("progressing: got %#v, want %#v", conds[0], tc.progressing)
+			}
+			if conds[1] != tc.degraded {
+				t.Errorf("degraded: got %#v, want %#v", conds[1], tc.degraded)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+)
+
+const (
+	// storageUsageInterval is the time between two storage usage reports.
+	storageUsageInterval = 6 * time.Hour
+
+	// storageUsageMaxImageStreams is the number of the largest image
+	// streams that are listed in the report, it keeps the config map
+	// under the size limit of the API server. Namespaces are always
+	// listed.
+	storageUsageMaxImageStreams = 1000
+)
+
+// imageStreamsAndImagesGetter can list image streams and images.
+type imageStreamsAndImagesGetter interface {
+	imageset.ImageStreamsGetter
+	imageset.ImagesGetter
+}
+
+// imageStreamUsage is the approximate storage usage of an image stream.
+type imageStreamUsage struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+type namespacedImageStreamUsage struct {
+	namespace string
+	usage     imageStreamUsage
+}
+
+// namespaceUsage is the approximate storage usage of the image streams of a
+// namespace. Layers shared by image streams of the namespace are counted
+// once.
+type namespaceUsage struct {
+	Namespace    string             `json:"namespace"`
+	Bytes        int64              `json:"bytes"`
+	ImageStreams []imageStreamUsage `json:"imageStreams,omitempty"`
+}
+
+// storageUsageReport attributes the layers stored by the registry to the
+// namespaces and image streams that reference them.
+type storageUsageReport struct {
+	GeneratedAt metav1.Time      `json:"generatedAt"`
+	TotalBytes  int64            `json:"totalBytes"`
+	Namespaces  []namespaceUsage `json:"namespaces"`
+	// Truncated is set when only the largest image streams are listed.
+	Truncated bool `json:"truncated,omitempty"`
+	// CompressionBytes is the size of the layers by compression algorithm,
+	// shared layers are counted once.
+	CompressionBytes map[string]int64 `json:"compressionBytes,omitempty"`
+}
+
+// layerCompression returns the compression algorithm of a layer with the
+// media type mediaType.
+func layerCompression(mediaType string) string {
+	switch {
+	case strings.HasSuffix(mediaType, "+zstd"):
+		return "zstd"
+	case strings.HasSuffix(mediaType, "+gzip"), strings.HasSuffix(mediaType, ".tar.gzip"):
+		return "gzip"
+	case mediaType == "":
+		return "unknown"
+	}
+	return "none"
+}
+
+// StorageUsageController periodically attributes the storage used by the
+// registry to namespaces and image streams, for chargeback. The sizes come
+// from the layers of the images pushed to the registry, they are an
+// approximation of the storage usage: blobs that are not referenced by an
+// image stream are not accounted.
+type StorageUsageController struct {
+	imageClient imageStreamsAndImagesGetter
+	coreClient  corev1client.ConfigMapsGetter
+	now         func() time.Time
+}
+
+// NewStorageUsageController returns a new StorageUsageController.
+func NewStorageUsageController(imageClient imageStreamsAndImagesGetter, coreClient corev1client.ConfigMapsGetter) *StorageUsageController {
+	return &StorageUsageController{
+		imageClient: imageClient,
+		coreClient:  coreClient,
+		now:         time.Now,
+	}
+}
+
+func (c *StorageUsageController) report(ctx context.Context) {
+	for attempt := 1; attempt <= imageStreamPassAttempts; attempt++ {
+		report, err := c.buildReport(ctx)
+		if errors.IsResourceExpired(err) {
+			klog.Warningf("the list of images expired before it was processed, starting over (attempt %d/%d)", attempt, imageStreamPassAttempts)
+			continue
+		} else if err != nil {
+			klog.Errorf("unable to build the storage usage report: %s", err)
+			return
+		}
+
+		namespaceBytes := map[string]int64{}
+		for _, ns := range report.Namespaces {
+			namespaceBytes[ns.Namespace] = ns.Bytes
+		}
+		metrics.ReportStorageUsage(namespaceBytes, report.TotalBytes)
+		metrics.ReportStorageCompression(report.CompressionBytes)
+
+		if err := c.writeReport(ctx, report); err != nil {
+			klog.Errorf("unable to write the storage usage report: %s", err)
+		}
+		return
+	}
+	klog.Errorf("unable to build the storage usage report: the list expired %d times", imageStreamPassAttempts)
+}
+
+// buildReport loads the layers of the images stored by the registry and
+// attributes them to the image streams that reference the images.
+func (c *StorageUsageController) buildReport(ctx context.Context) (*storageUsageReport, error) {
+	layers, err := c.storedImageLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	total := map[string]int64{}
+	compressions := map[string]string{}
+	namespaceLayers := map[string]map[string]int64{}
+	var imageStreams []namespacedImageStreamUsage
+	err = listImageStreamPages(ctx, c.imageClient, func(list *imagev1.ImageStreamList) {
+		for i := range list.Items {
+			is := &list.Items[i]
+			streamLayers := map[string]int64{}
+			for _, tag := range is.Status.Tags {
+				for _, item := range tag.Items {
+					for _, layer := range layers[item.Image] {
+						streamLayers[layer.Name] = layer.LayerSize
+						compressions[layer.Name] = layerCompression(layer.MediaType)
+					}
+				}
+			}
+			if len(streamLayers) == 0 {
+				continue
+			}
+
+			if namespaceLayers[is.Namespace] == nil {
+				namespaceLayers[is.Namespace] = map[string]int64{}
+			}
+			var bytes int64
+			for digest, size := range streamLayers {
+				bytes += size
+				namespaceLayers[is.Namespace][digest] = size
+				total[digest] = size
+			}
+			imageStreams = append(imageStreams, namespacedImageStreamUsage{
+				namespace: is.Namespace,
+				usage:     imageStreamUsage{Name: is.Name, Bytes: bytes},
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &storageUsageReport{
+		GeneratedAt: metav1.NewTime(c.now()),
+	}
+	for digest, size := range total {
+		report.TotalBytes += size
+		if report.CompressionBytes == nil {
+			report.CompressionBytes = map[string]int64{}
+		}
+		report.CompressionBytes[compressions[digest]] += size
+	}
+
+	sort.SliceStable(imageStreams, func(i, j int) bool {
+		return imageStreams[i].usage.Bytes > imageStreams[j].usage.Bytes
+	})
+	if len(imageStreams) > storageUsageMaxImageStreams {
+		imageStreams = imageStreams[:storageUsageMaxImageStreams]
+		report.Truncated = true
+	}
+	namespaces := map[string]*namespaceUsage{}
+	for namespace, digests := range namespaceLayers {
+		ns := &namespaceUsage{Namespace: namespace}
+		for _, size := range digests {
+			ns.Bytes += size
+		}
+		namespaces[namespace] = ns
+	}
+	for _, is := range imageStreams {
+		ns := namespaces[is.namespace]
+		ns.ImageStreams = append(ns.ImageStreams, is.usage)
+	}
+	for _, ns := range namespaces {
+		report.Namespaces = append(report.Namespaces, *ns)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		if report.Namespaces[i].Bytes != report.Namespaces[j].Bytes {
+			return report.Namespaces[i].Bytes > report.Namespaces[j].Bytes
+		}
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+	return report, nil
+}
+
+// storedImageLayers returns the layers of the images that are stored by
+// the registry, by image name. Images that are only referenced by the
+// registry (imported without being mirrored) are not stored by it.
+func (c *StorageUsageController) storedImageLayers(ctx context.Context) (map[string][]imagev1.ImageLayer, error) {
+	layers := map[string][]imagev1.ImageLayer{}
+	opts := metav1.ListOptions{Limit: imageStreamPageSize}
+	for {
+		var list *imagev1.ImageList
+		err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+			return !errors.IsResourceExpired(err) && ctx.Err() == nil
+		}, func() (err error) {
+			list, err = c.imageClient.Images().List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range list.Items {
+			image := &list.Items[i]
+			if image.Annotations[imagev1.ManagedByOpenShiftAnnotation] != "true" {
+				continue
+			}
+			layers[image.Name] = image.DockerImageLayers
+		}
+
+		if list.Continue == "" {
+			return layers, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// writeReport stores the report in the StorageUsageConfigMapName config map.
+func (c *StorageUsageController) writeReport(ctx context.Context, report *storageUsageReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	cm, err := c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(
+		ctx, defaults.StorageUsageConfigMapName, metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		_, err = c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Create(
+			ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.StorageUsageConfigMapName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string]string{
+					defaults.StorageUsageReportKey: string(data),
+				},
+			}, metav1.CreateOptions{},
+		)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	cm = cm.DeepCopy()
+	cm.Data = map[string]string{
+		defaults.StorageUsageReportKey: string(data),
+	}
+	_, err = c.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Update(
+		ctx, cm, metav1.UpdateOptions{},
+	)
+	return err
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageUsageController) Run(ctx context.Context) {
+	klog.Infof("Starting StorageUsageController")
+	go wait.UntilWithContext(ctx, c.report, storageUsageInterval)
+	klog.Infof("Started StorageUsageController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageUsageController")
+}
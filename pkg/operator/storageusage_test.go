@@ -0,0 +1,136 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageset "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// fakeImageClient serves a single page of image streams and images.
+type fakeImageClient struct {
+	fakeImageStreams
+	imageset.ImageInterface
+	images []imagev1.Image
+}
+
+func (f *fakeImageClient) Images() imageset.ImageInterface {
+	return f
+}
+
+func (f *fakeImageClient) List(ctx context.Context, opts metav1.ListOptions) (*imagev1.ImageList, error) {
+	return &imagev1.ImageList{Items: f.images}, nil
+}
+
+func TestStorageUsageReport(t *testing.T) {
+	managed := map[string]string{imagev1.ManagedByOpenShiftAnnotation: "true"}
+	images := []imagev1.Image{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "sha256:app1", Annotations: managed},
+			DockerImageLayers: []imagev1.ImageLayer{
+				{Name: "sha256:base", LayerSize: 100, MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip"},
+				{Name: "sha256:app1-layer", LayerSize: 10, MediaType: "application/vnd.oci.image.layer.v1.tar+zstd"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "sha256:app2", Annotations: managed},
+			DockerImageLayers: []imagev1.ImageLayer{
+				{Name: "sha256:base", LayerSize: 100, MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip"},
+				{Name: "sha256:app2-layer", LayerSize: 20, MediaType: "application/vnd.oci.image.layer.v1.tar+gzip"},
+			},
+		},
+		{
+			// Imported without being mirrored, the registry does not
+			// store it.
+			ObjectMeta: metav1.ObjectMeta{Name: "sha256:imported"},
+			DockerImageLayers: []imagev1.ImageLayer{
+				{Name: "sha256:imported-layer", LayerSize: 1000},
+			},
+		},
+	}
+	imageStream := func(namespace, name string, images ...string) imagev1.ImageStream {
+		var items []imagev1.TagEvent
+		for _, image := range images {
+			items = append(items, imagev1.TagEvent{Image: image})
+		}
+		return imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Status: imagev1.ImageStreamStatus{
+				Tags: []imagev1.NamedTagEventList{{Tag: "latest", Items: items}},
+			},
+		}
+	}
+	imageStreams := []imagev1.ImageStream{
+		imageStream("team-a", "app1", "sha256:app1"),
+		imageStream("team-a", "app2", "sha256:app2"),
+		imageStream("team-b", "app", "sha256:app2", "sha256:app1"),
+		imageStream("team-c", "imported", "sha256:imported"),
+	}
+
+	imageClient := &fakeImageClient{images: images}
+	imageClient.list = func(opts metav1.ListOptions) (*imagev1.ImageStreamList, error) {
+		return &imagev1.ImageStreamList{Items: imageStreams}, nil
+	}
+	kubeClient := fake.NewSimpleClientset()
+
+	c := NewStorageUsageController(imageClient, kubeClient.CoreV1())
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	// The second pass updates the config map created by the first one.
+	for i := 0; i < 2; i++ {
+		c.report(context.Background())
+	}
+
+	cm, err := kubeClient.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(
+		context.Background(), defaults.StorageUsageConfigMapName, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report storageUsageReport
+	if err := json.Unmarshal([]byte(cm.Data[defaults.StorageUsageReportKey]), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.GeneratedAt.Time.Equal(now) {
+		t.Errorf("expected the report to be generated at %s, got %s", now, report.GeneratedAt)
+	}
+	expected := storageUsageReport{
+		GeneratedAt: report.GeneratedAt,
+		TotalBytes:  130,
+		CompressionBytes: map[string]int64{
+			"gzip": 120,
+			"zstd": 10,
+		},
+		Namespaces: []namespaceUsage{
+			{
+				Namespace: "team-a",
+				Bytes:     130,
+				ImageStreams: []imageStreamUsage{
+					{Name: "app2", Bytes: 120},
+					{Name: "app1", Bytes: 110},
+				},
+			},
+			{
+				Namespace: "team-b",
+				Bytes:     130,
+				ImageStreams: []imageStreamUsage{
+					{Name: "app", Bytes: 130},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected report\n%+v\ngot\n%+v", expected, report)
+	}
+}
@@ -0,0 +1,477 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+const (
+	storageUsagePruneProgressing = "StorageUsagePruneProgressing"
+	storageUsageDegraded         = "StorageUsageDegraded"
+
+	usagePruneWorkQueueKey = "instance"
+
+	// usagePruneJobsHistoryLimit is the number of finished usage prune
+	// jobs that are kept.
+	usagePruneJobsHistoryLimit = 3
+)
+
+// UsagePruneController runs the image pruner when the storage of the
+// registry holds more data than the threshold of the usagePrune maintenance
+// override. The usage is measured by the storage driver. Each time it is
+// above the threshold, a pruner job that keeps one tag revision less than
+// the previous one is started, down to minKeepTagRevisions. The
+// StorageUsageDegraded condition is set when the usage stays above the
+// threshold with the fewest revisions.
+type UsagePruneController struct {
+	batchClient               batchv1client.BatchV1Interface
+	operatorClient            v1helpers.OperatorClient
+	cronJobLister             batchv1listers.CronJobNamespaceLister
+	jobLister                 batchv1listers.JobNamespaceLister
+	prunerLister              imageregistryv1listers.ImagePrunerLister
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+	newDriver                 func(*imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error)
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+func NewUsagePruneController(
+	kubeconfig *rest.Config,
+	batchClient batchv1client.BatchV1Interface,
+	operatorClient v1helpers.OperatorClient,
+	cronJobInformer batchv1informers.CronJobInformer,
+	jobInformer batchv1informers.JobInformer,
+	secretInformer corev1informers.SecretInformer,
+	infrastructureInformer configv1informers.InfrastructureInformer,
+	openshiftConfigInformer corev1informers.ConfigMapInformer,
+	openshiftConfigManagedInformer corev1informers.ConfigMapInformer,
+	imagePrunerInformer imageregistryv1informers.ImagePrunerInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) (*UsagePruneController, error) {
+	listers := client.NewStorageListers(
+		infrastructureInformer.Lister(),
+		openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+	)
+
+	c := &UsagePruneController{
+		batchClient:               batchClient,
+		operatorClient:            operatorClient,
+		cronJobLister:             cronJobInformer.Lister().CronJobs(defaults.ImageRegistryOperatorNamespace),
+		jobLister:                 jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		prunerLister:              imagePrunerInformer.Lister(),
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		newDriver: func(cfg *imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error) {
+			return storage.NewDriver(cfg, kubeconfig, listers, featureGateAccessor)
+		},
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any](), "UsagePruneController"),
+	}
+
+	// the usage is measured again when a usage prune job finishes or when
+	// the settings change, and otherwise on the interval of the override.
+	for _, informer := range []cache.SharedIndexInformer{
+		jobInformer.Informer(),
+		imageRegistryConfigInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { c.queue.Add(usagePruneWorkQueueKey) },
+			UpdateFunc: c.updateHandler,
+			DeleteFunc: func(obj interface{}) { c.queue.Add(usagePruneWorkQueueKey) },
+		}); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+	c.cachesToSync = append(c.cachesToSync,
+		cronJobInformer.Informer().HasSynced,
+		imagePrunerInformer.Informer().HasSynced,
+		secretInformer.Informer().HasSynced,
+		infrastructureInformer.Informer().HasSynced,
+		openshiftConfigInformer.Informer().HasSynced,
+		openshiftConfigManagedInformer.Informer().HasSynced,
+	)
+
+	return c, nil
+}
+
+// updateHandler ignores the periodic resyncs, the usage is not measured
+// more often than the interval of the override.
+func (c *UsagePruneController) updateHandler(old, new interface{}) {
+	oldObj, oldOK := old.(metav1.Object)
+	newObj, newOK := new.(metav1.Object)
+	if oldOK && newOK && oldObj.GetResourceVersion() == newObj.GetResourceVersion() {
+		return
+	}
+	c.queue.Add(usagePruneWorkQueueKey)
+}
+
+func (c *UsagePruneController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *UsagePruneController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue: %s", obj)
+
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("UsagePruneController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("UsagePruneController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// formatBytes formats a size in GiB.
+func formatBytes(bytes int64) string {
+	return fmt.Sprintf("%.1f GiB", float64(bytes)/(1<<30))
+}
+
+// usagePruneJobs returns the pruner jobs started by the usage prune, the
+// newest first.
+func usagePruneJobs(jobs []*batchv1.Job) []*batchv1.Job {
+	var usageJobs []*batchv1.Job
+	for _, job := range jobs {
+		if _, ok := job.Annotations[defaults.UsagePruneAnnotation]; ok {
+			usageJobs = append(usageJobs, job)
+		}
+	}
+	sort.Slice(usageJobs, func(i, j int) bool {
+		return usageJobs[i].CreationTimestamp.After(usageJobs[j].CreationTimestamp.Time)
+	})
+	return usageJobs
+}
+
+// nextKeepTagRevisions returns the number of tag revisions the next usage
+// prune job keeps. It is one less than the previous usage prune job if it
+// finished less than two intervals ago, and one less than the image pruner
+// otherwise. It returns false when fewer revisions than minimum would be
+// kept.
+func nextKeepTagRevisions(last *batchv1.Job, prunerKeep, minimum int32, interval time.Duration, now time.Time) (int32, bool) {
+	keep := prunerKeep - 1
+	if last != nil {
+		if finished := storageMigrationJobFinished(last); finished != nil && now.Sub(finished.LastTransitionTime.Time) < 2*interval {
+			if lastKeep, err := strconv.Atoi(last.Annotations[defaults.UsagePruneAnnotation]); err == nil {
+				keep = int32(lastKeep) - 1
+			}
+		}
+	}
+	if keep < minimum {
+		return 0, false
+	}
+	return keep, true
+}
+
+// usagePruneJob returns a job of the image pruner cron job that keeps keep
+// tag revisions.
+func usagePruneJob(cronJob *batchv1.CronJob, keep int32) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: cronJob.Name + "-usage-",
+			Namespace:    cronJob.Namespace,
+			Labels:       map[string]string{},
+			Annotations:  map[string]string{},
+		},
+		Spec: *cronJob.Spec.JobTemplate.Spec.DeepCopy(),
+	}
+	for k, v := range cronJob.Spec.JobTemplate.Labels {
+		job.Labels[k] = v
+	}
+	for k, v := range cronJob.Spec.JobTemplate.Annotations {
+		job.Annotations[k] = v
+	}
+	job.Annotations[defaults.UsagePruneAnnotation] = strconv.Itoa(int(keep))
+
+	for i := range job.Spec.Template.Spec.Containers {
+		args := job.Spec.Template.Spec.Containers[i].Args
+		for j, arg := range args {
+			if strings.HasPrefix(arg, "--keep-tag-revisions=") {
+				args[j] = fmt.Sprintf("--keep-tag-revisions=%d", keep)
+			}
+		}
+	}
+	return job
+}
+
+// removeConditions removes the conditions of the usage prune.
+func (c *UsagePruneController) removeConditions(ctx context.Context, cr *imageregistryv1.Config) error {
+	var removeConditionFns []v1helpers.UpdateStatusFunc
+	for _, conditionType := range []string{storageUsagePruneProgressing, storageUsageDegraded} {
+		if v1helpers.FindOperatorCondition(cr.Status.Conditions, conditionType) == nil {
+			continue
+		}
+		conditionType := conditionType
+		removeConditionFns = append(removeConditionFns, func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, conditionType)
+			return nil
+		})
+	}
+	if len(removeConditionFns) == 0 {
+		return nil
+	}
+	_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, removeConditionFns...)
+	return err
+}
+
+// deleteOldJobs deletes the finished usage prune jobs beyond the history
+// limit.
+func (c *UsagePruneController) deleteOldJobs(ctx context.Context, jobs []*batchv1.Job) error {
+	finished := 0
+	for _, job := range jobs {
+		if storageMigrationJobFinished(job) == nil {
+			continue
+		}
+		finished++
+		if finished <= usagePruneJobsHistoryLimit {
+			continue
+		}
+		err := c.batchClient.Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+			PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// measure returns the usage of the storage of the registry.
+func (c *UsagePruneController) measure(cr *imageregistryv1.Config) (storage.Usage, error) {
+	return measureStorageUsage(c.newDriver, &cr.Status.Storage)
+}
+
+// measureStorageUsage returns the usage of the storage cfg. It returns
+// metrics.ErrStorageUsageUnsupported when the driver cannot measure it.
+func measureStorageUsage(newDriver func(*imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error), cfg *imageregistryv1.ImageRegistryConfigStorage) (storage.Usage, error) {
+	driver, err := newDriver(cfg)
+	if err != nil {
+		return storage.Usage{}, err
+	}
+	reporter, ok := driver.(storage.UsageReporter)
+	if !ok {
+		return storage.Usage{}, fmt.Errorf("%w, it is only supported on S3, Azure, GCS and Swift", metrics.ErrStorageUsageUnsupported)
+	}
+	return reporter.StorageUsage()
+}
+
+// newStorageUsageFunc returns the measure of the storage of the registry
+// for the storage usage metrics. It waits for the caches of the informers.
+func newStorageUsageFunc(
+	kubeconfig *rest.Config,
+	secretInformer corev1informers.SecretInformer,
+	infrastructureInformer configv1informers.InfrastructureInformer,
+	openshiftConfigInformer corev1informers.ConfigMapInformer,
+	openshiftConfigManagedInformer corev1informers.ConfigMapInformer,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) metrics.StorageUsageFunc {
+	listers := client.NewStorageListers(
+		infrastructureInformer.Lister(),
+		openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+	)
+	newDriver := func(cfg *imageregistryv1.ImageRegistryConfigStorage) (storage.Driver, error) {
+		return storage.NewDriver(cfg, kubeconfig, listers, featureGateAccessor)
+	}
+	cachesToSync := []cache.InformerSynced{
+		secretInformer.Informer().HasSynced,
+		infrastructureInformer.Informer().HasSynced,
+		openshiftConfigInformer.Informer().HasSynced,
+		openshiftConfigManagedInformer.Informer().HasSynced,
+		imageRegistryConfigInformer.Informer().HasSynced,
+	}
+
+	return func(ctx context.Context) (string, int64, int64, error) {
+		if !cache.WaitForCacheSync(ctx.Done(), cachesToSync...) {
+			return "", 0, 0, ctx.Err()
+		}
+		cr, err := imageRegistryConfigInformer.Lister().Get(defaults.ImageRegistryResourceName)
+		if errors.IsNotFound(err) {
+			return "", 0, 0, metrics.ErrStorageUsageUnsupported
+		} else if err != nil {
+			return "", 0, 0, err
+		}
+		if cr.Spec.ManagementState != operatorv1.Managed || storage.Name(&cr.Status.Storage) == "" {
+			return "", 0, 0, metrics.ErrStorageUsageUnsupported
+		}
+		usage, err := measureStorageUsage(newDriver, &cr.Status.Storage)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		return storage.Name(&cr.Status.Storage), usage.Bytes, usage.Objects, nil
+	}
+}
+
+func (c *UsagePruneController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	settings, threshold, err := configOverrides.UsagePrune()
+	if err != nil {
+		return err
+	}
+	if settings == nil || cr.Spec.ManagementState != operatorv1.Managed {
+		return c.removeConditions(ctx, cr)
+	}
+	interval := time.Duration(settings.IntervalSeconds) * time.Second
+	defer c.queue.AddAfter(usagePruneWorkQueueKey, interval)
+
+	progressing := operatorv1.OperatorCondition{
+		Type:   storageUsagePruneProgressing,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	degraded := operatorv1.OperatorCondition{
+		Type:   storageUsageDegraded,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	updateConditions := func() error {
+		_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient,
+			v1helpers.UpdateConditionFn(progressing),
+			v1helpers.UpdateConditionFn(degraded),
+		)
+		return err
+	}
+
+	jobs, err := c.jobLister.List(labels.SelectorFromSet(labels.Set{"created-by": "image-pruner"}))
+	if err != nil {
+		return err
+	}
+	usageJobs := usagePruneJobs(jobs)
+	if err := c.deleteOldJobs(ctx, usageJobs); err != nil {
+		return err
+	}
+	var last *batchv1.Job
+	if len(usageJobs) > 0 {
+		last = usageJobs[0]
+		if storageMigrationJobFinished(last) == nil {
+			progressing.Status = operatorv1.ConditionTrue
+			progressing.Reason = "Pruning"
+			progressing.Message = fmt.Sprintf("The pruner job %s keeps %s tag revisions to reduce the storage usage", last.Name, last.Annotations[defaults.UsagePruneAnnotation])
+			return updateConditions()
+		}
+	}
+
+	usage, err := c.measure(cr)
+	if err != nil {
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "Error"
+		degraded.Message = fmt.Sprintf("Unable to measure the usage of the storage: %s", err)
+		return updateConditions()
+	}
+	usageMessage := fmt.Sprintf("The storage holds %s in %d objects, the threshold is %s", formatBytes(usage.Bytes), usage.Objects, formatBytes(threshold))
+	progressing.Message = usageMessage
+	if usage.Bytes <= threshold {
+		return updateConditions()
+	}
+
+	pruner, err := c.prunerLister.Get(defaults.ImageRegistryImagePrunerResourceName)
+	if errors.IsNotFound(err) {
+		pruner = nil
+	} else if err != nil {
+		return err
+	}
+	if pruner == nil || (pruner.Spec.Suspend != nil && *pruner.Spec.Suspend) {
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "PrunerSuspended"
+		degraded.Message = usageMessage + ", the image pruner is suspended"
+		return updateConditions()
+	}
+	prunerKeep := int32(defaultPrunerKeepTagRevisions)
+	if pruner.Spec.KeepTagRevisions != nil {
+		prunerKeep = int32(*pruner.Spec.KeepTagRevisions)
+	}
+
+	keep, ok := nextKeepTagRevisions(last, prunerKeep, settings.MinKeepTagRevisions, interval, time.Now())
+	if !ok {
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "ThresholdExceeded"
+		degraded.Message = fmt.Sprintf("%s, it cannot be pruned further with at least %d tag revisions", usageMessage, settings.MinKeepTagRevisions)
+		return updateConditions()
+	}
+
+	cronJob, err := c.cronJobLister.Get("image-pruner")
+	if err != nil {
+		return err
+	}
+	job, err := c.batchClient.Jobs(defaults.ImageRegistryOperatorNamespace).Create(ctx, usagePruneJob(cronJob, keep), metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	klog.Infof("%s, started the pruner job %s that keeps %d tag revisions", usageMessage, job.Name, keep)
+	progressing.Status = operatorv1.ConditionTrue
+	progressing.Reason = "Pruning"
+	progressing.Message = fmt.Sprintf("%s, the pruner job %s keeps %d tag revisions", usageMessage, job.Name, keep)
+	return updateConditions()
+}
+
+func (c *UsagePruneController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting UsagePruneController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started UsagePruneController")
+	<-stopCh
+	klog.Infof("Shutting down UsagePruneController")
+}
@@ -0,0 +1,113 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestNextKeepTagRevisions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	finishedJob := func(keep string, finished time.Time) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{defaults.UsagePruneAnnotation: keep},
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{
+					{
+						Type:               batchv1.JobComplete,
+						Status:             corev1.ConditionTrue,
+						LastTransitionTime: metav1.NewTime(finished),
+					},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		last     *batchv1.Job
+		expected int32
+		ok       bool
+	}{
+		{
+			name:     "first run",
+			expected: 2,
+			ok:       true,
+		},
+		{
+			name:     "recent run",
+			last:     finishedJob("2", now.Add(-time.Minute)),
+			expected: 1,
+			ok:       true,
+		},
+		{
+			name:     "old run",
+			last:     finishedJob("1", now.Add(-3*time.Hour)),
+			expected: 2,
+			ok:       true,
+		},
+		{
+			name: "minimum reached",
+			last: finishedJob("1", now.Add(-time.Minute)),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keep, ok := nextKeepTagRevisions(tc.last, 3, 1, time.Hour, now)
+			if keep != tc.expected || ok != tc.ok {
+				t.Errorf("expected %d, %t, got %d, %t", tc.expected, tc.ok, keep, ok)
+			}
+		})
+	}
+}
+
+func TestUsagePruneJob(t *testing.T) {
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-pruner",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"created-by": "image-pruner"},
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:    "image-pruner",
+									Command: []string{"oc"},
+									Args:    []string{"adm", "prune", "images", "--keep-tag-revisions=3", "--prune-registry=true"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	job := usagePruneJob(cronJob, 1)
+	if job.GenerateName != "image-pruner-usage-" || job.Labels["created-by"] != "image-pruner" {
+		t.Errorf("unexpected metadata %#v", job.ObjectMeta)
+	}
+	if job.Annotations[defaults.UsagePruneAnnotation] != "1" {
+		t.Errorf("expected the keep level to be annotated, got %#v", job.Annotations)
+	}
+	expectedArgs := []string{"adm", "prune", "images", "--keep-tag-revisions=1", "--prune-registry=true"}
+	if args := job.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args %q, got %q", expectedArgs, args)
+	}
+	if args := cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args; args[3] != "--keep-tag-revisions=3" {
+		t.Errorf("the cron job was modified: %q", args)
+	}
+}
@@ -0,0 +1,154 @@
+package overrides
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a recurring period of time during which the operator
+// runs disruptive or heavy operations: image pruning, garbage collection and,
+// optionally, registry rollouts. The window starts at StartHour on each of
+// Days and ends at EndHour, on the next day if EndHour is not after
+// StartHour.
+type MaintenanceWindow struct {
+	// Days are the days of the week the window starts on, for example
+	// Saturday. Every day if it is empty.
+	Days []string `json:"days,omitempty"`
+	// StartHour is the hour of the day (0-23) the window starts at.
+	StartHour int32 `json:"startHour,omitempty"`
+	// EndHour is the hour of the day (0-23) the window ends at. The
+	// window lasts 24 hours if it is equal to StartHour.
+	EndHour int32 `json:"endHour,omitempty"`
+	// TimeZone is the IANA name of the time zone of the window, for
+	// example Europe/Paris. Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// DeferRollouts holds back rollouts of a changed registry pod
+	// template until the window opens.
+	DeferRollouts bool `json:"deferRollouts,omitempty"`
+}
+
+// MaintenanceWindow returns the maintenance window, or nil if it is not set.
+func (o ConfigOverrides) MaintenanceWindow() (*MaintenanceWindow, error) {
+	if o.Maintenance == nil || o.Maintenance.Window == nil {
+		return nil, nil
+	}
+	if err := o.Maintenance.Window.validate(); err != nil {
+		return nil, fmt.Errorf("invalid maintenance window: %w", err)
+	}
+	return o.Maintenance.Window, nil
+}
+
+func (w *MaintenanceWindow) validate() error {
+	if w.StartHour < 0 || w.StartHour > 23 {
+		return fmt.Errorf("startHour must be between 0 and 23, got %d", w.StartHour)
+	}
+	if w.EndHour < 0 || w.EndHour > 23 {
+		return fmt.Errorf("endHour must be between 0 and 23, got %d", w.EndHour)
+	}
+	if _, err := w.weekdays(); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(w.TimeZone); err != nil {
+		return fmt.Errorf("unknown time zone %q: %w", w.TimeZone, err)
+	}
+	return nil
+}
+
+func (w *MaintenanceWindow) weekdays() (map[time.Weekday]bool, error) {
+	days := map[time.Weekday]bool{}
+	for _, name := range w.Days {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(name, d.String()) {
+				days[d] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown day %q", name)
+		}
+	}
+	return days, nil
+}
+
+func (w *MaintenanceWindow) location() *time.Location {
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (w *MaintenanceWindow) duration() time.Duration {
+	hours := w.EndHour - w.StartHour
+	if hours <= 0 {
+		hours += 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// startOn returns the start of the window on the day of t, and whether the
+// window starts on that day.
+func (w *MaintenanceWindow) startOn(t time.Time) (time.Time, bool) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), int(w.StartHour), 0, 0, 0, t.Location())
+	days, _ := w.weekdays()
+	return start, len(days) == 0 || days[start.Weekday()]
+}
+
+// Open returns whether the window is open at t. A nil window is always open.
+func (w *MaintenanceWindow) Open(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	t = t.In(w.location())
+	// The window that is open at t started either on the day of t or on
+	// the day before.
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		start, ok := w.startOn(day)
+		if ok && !t.Before(start) && t.Before(start.Add(w.duration())) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStart returns the first start of the window after t.
+func (w *MaintenanceWindow) NextStart(t time.Time) time.Time {
+	t = t.In(w.location())
+	for i := 0; i <= 7; i++ {
+		start, ok := w.startOn(t.AddDate(0, 0, i))
+		if ok && start.After(t) {
+			return start
+		}
+	}
+	// Not reached, the window starts at least once a week.
+	return t
+}
+
+// CronSchedule returns a cron schedule that fires when the window opens, in
+// the time zone of the window.
+func (w *MaintenanceWindow) CronSchedule() string {
+	days, _ := w.weekdays()
+	dow := "*"
+	if len(days) > 0 {
+		var numbers []int
+		for d := range days {
+			numbers = append(numbers, int(d))
+		}
+		sort.Ints(numbers)
+		var fields []string
+		for _, n := range numbers {
+			fields = append(fields, strconv.Itoa(n))
+		}
+		dow = strings.Join(fields, ",")
+	}
+	return fmt.Sprintf("0 %d * * %s", w.StartHour, dow)
+}
+
+// TimeZoneName returns the time zone of the window.
+func (w *MaintenanceWindow) TimeZoneName() string {
+	return w.location().String()
+}
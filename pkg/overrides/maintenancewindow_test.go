@@ -0,0 +1,106 @@
+package overrides
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time zone database is not available: %s", err)
+	}
+
+	// Saturday and Sunday nights, from 22:00 to 04:00, Paris time.
+	w := &MaintenanceWindow{
+		Days:      []string{"saturday", "Sunday"},
+		StartHour: 22,
+		EndHour:   4,
+		TimeZone:  "Europe/Paris",
+	}
+	if err := w.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		now       time.Time
+		open      bool
+		nextStart time.Time
+	}{
+		{
+			name:      "friday evening",
+			now:       time.Date(2024, 6, 7, 23, 0, 0, 0, paris),
+			nextStart: time.Date(2024, 6, 8, 22, 0, 0, 0, paris),
+		},
+		{
+			name:      "saturday at the start",
+			now:       time.Date(2024, 6, 8, 22, 0, 0, 0, paris),
+			open:      true,
+			nextStart: time.Date(2024, 6, 9, 22, 0, 0, 0, paris),
+		},
+		{
+			name:      "sunday early morning, window started on saturday",
+			now:       time.Date(2024, 6, 9, 3, 59, 0, 0, paris),
+			open:      true,
+			nextStart: time.Date(2024, 6, 9, 22, 0, 0, 0, paris),
+		},
+		{
+			name:      "monday at the end",
+			now:       time.Date(2024, 6, 10, 4, 0, 0, 0, paris),
+			nextStart: time.Date(2024, 6, 15, 22, 0, 0, 0, paris),
+		},
+		{
+			name:      "saturday in UTC",
+			now:       time.Date(2024, 6, 8, 20, 30, 0, 0, time.UTC),
+			open:      true,
+			nextStart: time.Date(2024, 6, 9, 22, 0, 0, 0, paris),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if open := w.Open(tt.now); open != tt.open {
+				t.Errorf("got open %t, want %t", open, tt.open)
+			}
+			if next := w.NextStart(tt.now); !next.Equal(tt.nextStart) {
+				t.Errorf("got next start %s, want %s", next, tt.nextStart)
+			}
+		})
+	}
+
+	if schedule := w.CronSchedule(); schedule != "0 22 * * 0,6" {
+		t.Errorf("got schedule %q", schedule)
+	}
+	if tz := w.TimeZoneName(); tz != "Europe/Paris" {
+		t.Errorf("got time zone %q", tz)
+	}
+
+	var none *MaintenanceWindow
+	if !none.Open(time.Now()) {
+		t.Errorf("a nil window should always be open")
+	}
+}
+
+func TestMaintenanceWindowValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		w     MaintenanceWindow
+		valid bool
+	}{
+		{name: "every day in UTC", w: MaintenanceWindow{StartHour: 1, EndHour: 3}, valid: true},
+		{name: "full day", w: MaintenanceWindow{Days: []string{"Sunday"}}, valid: true},
+		{name: "unknown day", w: MaintenanceWindow{Days: []string{"Caturday"}}},
+		{name: "start hour out of range", w: MaintenanceWindow{StartHour: 24}},
+		{name: "end hour out of range", w: MaintenanceWindow{EndHour: -1}},
+		{name: "unknown time zone", w: MaintenanceWindow{TimeZone: "Mars/Olympus_Mons"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := ConfigOverrides{Maintenance: &MaintenanceOverrides{Window: &tt.w}}
+			_, err := o.MaintenanceWindow()
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if !tt.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,1791 @@
+// Package overrides decodes the unsupported config overrides of the image
+// registry. They hold settings that are not part of the Config API yet and
+// are shared by the resource generators and the storage drivers.
+package overrides
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// ConfigOverrides holds data users can set to override default object configurations created
+// by this operator. This is stored in the registry Config.Spec.UnsupportedConfigOverrides.
+type ConfigOverrides struct {
+	Deployment  *DeploymentOverrides  `json:"deployment,omitempty"`
+	Rollout     *RolloutOverrides     `json:"rollout,omitempty"`
+	Logging     *LoggingOverrides     `json:"logging,omitempty"`
+	Storage     *StorageOverrides     `json:"storage,omitempty"`
+	Rollback    *RollbackOverrides    `json:"rollback,omitempty"`
+	Routing     *RoutingOverrides     `json:"routing,omitempty"`
+	Network     *NetworkOverrides     `json:"network,omitempty"`
+	TLS         *TLSOverrides         `json:"tls,omitempty"`
+	TrustedCA   *TrustedCAOverrides   `json:"trustedCA,omitempty"`
+	Manifests   *ManifestOverrides    `json:"manifests,omitempty"`
+	Backup      *BackupOverrides      `json:"backup,omitempty"`
+	Maintenance *MaintenanceOverrides `json:"maintenance,omitempty"`
+	Recreation  *RecreationOverrides  `json:"recreation,omitempty"`
+	Mesh        *MeshOverrides        `json:"mesh,omitempty"`
+	PodSecurity *PodSecurityOverrides `json:"podSecurity,omitempty"`
+	Staging     *StagingOverrides     `json:"staging,omitempty"`
+	Autoscaling *AutoscalingOverrides `json:"autoscaling,omitempty"`
+	Cache       *CacheOverrides       `json:"cache,omitempty"`
+	Probes      *ProbeOverrides       `json:"probes,omitempty"`
+	NodeCA      *NodeCAOverrides      `json:"nodeCA,omitempty"`
+}
+
+// DeploymentOverrides holds items that can be overwriten in the image registry deployment.
+type DeploymentOverrides struct {
+	Annotations      map[string]string `json:"annotations,omitempty"`
+	RuntimeClassName *string           `json:"runtimeClassName,omitempty"`
+}
+
+// RolloutOverrides controls how configuration changes are rolled out to the
+// image registry deployment.
+type RolloutOverrides struct {
+	// Canary enables canary rollouts. When the pod template of the registry
+	// changes, a single canary replica is started with the new template and
+	// checked before the change is applied to all replicas.
+	Canary bool `json:"canary,omitempty"`
+	// CanaryTimeoutSeconds is the time the canary replica has to become
+	// available. Defaults to 300 seconds.
+	CanaryTimeoutSeconds int32 `json:"canaryTimeoutSeconds,omitempty"`
+	// MaxUnavailable is the number or the percentage of registry replicas
+	// that can be unavailable during a rolling update. It defaults to a
+	// value computed from the number of replicas.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// MaxSurge is the number or the percentage of registry replicas that
+	// can be started above the desired number during a rolling update. It
+	// defaults to a value computed from the number of replicas.
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// RollbackOverrides controls automatic rollbacks of registry rollouts.
+type RollbackOverrides struct {
+	// Enabled makes the operator revert the registry deployment to the last
+	// pod template that was rolled out successfully when a rollout does not
+	// complete within the progress deadline. Storage configuration changes
+	// are never rolled back.
+	Enabled bool `json:"enabled,omitempty"`
+	// ProgressDeadlineSeconds is the progress deadline of the registry
+	// deployment when rollbacks are enabled. Defaults to 600 seconds.
+	ProgressDeadlineSeconds int32 `json:"progressDeadlineSeconds,omitempty"`
+}
+
+// Canary returns whether canary rollouts are enabled and the time the canary
+// replica has to become available, 0 for the default.
+func (o ConfigOverrides) Canary() (bool, int32, error) {
+	if o.Rollout == nil {
+		return false, 0, nil
+	}
+	if o.Rollout.CanaryTimeoutSeconds < 0 {
+		return false, 0, fmt.Errorf("canaryTimeoutSeconds must not be negative, got %d", o.Rollout.CanaryTimeoutSeconds)
+	}
+	return o.Rollout.Canary, o.Rollout.CanaryTimeoutSeconds, nil
+}
+
+// RollingUpdate returns the maxUnavailable and maxSurge of the rolling updates
+// of the registry deployment, nil for the values computed by the operator.
+func (o ConfigOverrides) RollingUpdate() (maxUnavailable, maxSurge *intstr.IntOrString, err error) {
+	if o.Rollout == nil {
+		return nil, nil, nil
+	}
+	unavailable, err := rollingUpdateValue("maxUnavailable", o.Rollout.MaxUnavailable)
+	if err != nil {
+		return nil, nil, err
+	}
+	surge, err := rollingUpdateValue("maxSurge", o.Rollout.MaxSurge)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.Rollout.MaxUnavailable != nil && o.Rollout.MaxSurge != nil && unavailable == 0 && surge == 0 {
+		return nil, nil, fmt.Errorf("maxUnavailable and maxSurge must not both be 0")
+	}
+	return o.Rollout.MaxUnavailable, o.Rollout.MaxSurge, nil
+}
+
+// rollingUpdateValue checks that v is a non-negative number or percentage, and
+// returns the number of replicas it stands for out of 100.
+func rollingUpdateValue(name string, v *intstr.IntOrString) (int, error) {
+	if v == nil {
+		return 0, nil
+	}
+	n, err := intstr.GetScaledValueFromIntOrPercent(v, 100, true)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %s", name, v.String())
+	}
+	return n, nil
+}
+
+// AutoRollback returns whether automatic rollbacks are enabled and the
+// progress deadline of the registry deployment, 0 for the default.
+func (o ConfigOverrides) AutoRollback() (bool, int32, error) {
+	if o.Rollback == nil {
+		return false, 0, nil
+	}
+	if o.Rollback.ProgressDeadlineSeconds < 0 {
+		return false, 0, fmt.Errorf("progressDeadlineSeconds must not be negative, got %d", o.Rollback.ProgressDeadlineSeconds)
+	}
+	return o.Rollback.Enabled, o.Rollback.ProgressDeadlineSeconds, nil
+}
+
+// ProbeOverrides tunes the liveness and the readiness probes of the
+// registry, for storage backends that are slow to answer its health checks.
+type ProbeOverrides struct {
+	Liveness  *ProbeSettings `json:"liveness,omitempty"`
+	Readiness *ProbeSettings `json:"readiness,omitempty"`
+}
+
+// ProbeSettings are the timing parameters of a probe of the registry. A
+// value that is not set keeps the default of the probe.
+type ProbeSettings struct {
+	// TimeoutSeconds is the time the registry has to answer the probe,
+	// between 1 and 60 seconds. Defaults to 5 seconds.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// PeriodSeconds is the interval between two probes, between 1 and 300
+	// seconds. Defaults to 10 seconds.
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// FailureThreshold is the number of consecutive failed probes after
+	// which the registry is restarted or marked unready, between 1 and 30.
+	// Defaults to 3.
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+const (
+	maxProbeTimeoutSeconds   = 60
+	maxProbePeriodSeconds    = 300
+	maxProbeFailureThreshold = 30
+
+	// defaultProbePeriodSeconds is the period of the probes when it is not
+	// set, the default of Kubernetes.
+	defaultProbePeriodSeconds = 10
+)
+
+// validate checks the settings of the probe name against the bounds of
+// each value. The timeout must not be longer than the period, with the
+// defaults applied to the values that are not set.
+func (s *ProbeSettings) validate(name string) error {
+	if s == nil {
+		return nil
+	}
+	for _, v := range []struct {
+		field string
+		value int32
+		max   int32
+	}{
+		{"timeoutSeconds", s.TimeoutSeconds, maxProbeTimeoutSeconds},
+		{"periodSeconds", s.PeriodSeconds, maxProbePeriodSeconds},
+		{"failureThreshold", s.FailureThreshold, maxProbeFailureThreshold},
+	} {
+		if v.value < 0 || v.value > v.max {
+			return fmt.Errorf("%s.%s must be between 1 and %d, got %d", name, v.field, v.max, v.value)
+		}
+	}
+	timeout, period := s.TimeoutSeconds, s.PeriodSeconds
+	if timeout == 0 {
+		timeout = defaults.HealthzTimeoutSeconds
+	}
+	if period == 0 {
+		period = defaultProbePeriodSeconds
+	}
+	if timeout > period {
+		return fmt.Errorf("%s.timeoutSeconds (%d) must not be longer than %s.periodSeconds (%d)", name, timeout, name, period)
+	}
+	return nil
+}
+
+// RegistryProbes returns the settings of the liveness and of the readiness
+// probes of the registry, nil for the defaults.
+func (o ConfigOverrides) RegistryProbes() (liveness, readiness *ProbeSettings, err error) {
+	if o.Probes == nil {
+		return nil, nil, nil
+	}
+	if err := o.Probes.Liveness.validate("liveness"); err != nil {
+		return nil, nil, err
+	}
+	if err := o.Probes.Readiness.validate("readiness"); err != nil {
+		return nil, nil, err
+	}
+	return o.Probes.Liveness, o.Probes.Readiness, nil
+}
+
+// AutoscalingOverrides makes a HorizontalPodAutoscaler scale the registry
+// deployment instead of spec.replicas.
+type AutoscalingOverrides struct {
+	// MinReplicas is the lower limit of the number of replicas. Defaults
+	// to spec.replicas, or 1 when it is 0.
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit of the number of replicas.
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage is the average CPU usage of the
+	// replicas, in percent of their requests, that the autoscaler keeps.
+	// Defaults to 80 when no other target is set.
+	TargetCPUUtilizationPercentage int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// TargetMemoryUtilizationPercentage is the average memory usage of the
+	// replicas, in percent of their requests, that the autoscaler keeps.
+	TargetMemoryUtilizationPercentage int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Metrics are additional metrics of the autoscaler, for example the
+	// request rate of the registry served by a custom metrics adapter.
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// Autoscaler returns the settings of the autoscaler of the registry, with
+// the defaults applied, or nil if the registry is not autoscaled. replicas
+// is spec.replicas.
+func (o ConfigOverrides) Autoscaler(replicas int32) (*AutoscalingOverrides, error) {
+	if o.Autoscaling == nil {
+		return nil, nil
+	}
+	settings := *o.Autoscaling
+	if settings.MinReplicas == 0 {
+		settings.MinReplicas = max(replicas, 1)
+	}
+	if settings.MinReplicas < 1 {
+		return nil, fmt.Errorf("minReplicas must be at least 1, got %d", settings.MinReplicas)
+	}
+	if settings.MaxReplicas < settings.MinReplicas {
+		return nil, fmt.Errorf("maxReplicas must be at least minReplicas %d, got %d", settings.MinReplicas, settings.MaxReplicas)
+	}
+	for name, target := range map[string]int32{
+		"targetCPUUtilizationPercentage":    settings.TargetCPUUtilizationPercentage,
+		"targetMemoryUtilizationPercentage": settings.TargetMemoryUtilizationPercentage,
+	} {
+		if target < 0 {
+			return nil, fmt.Errorf("%s must not be negative, got %d", name, target)
+		}
+	}
+	if settings.TargetCPUUtilizationPercentage == 0 && settings.TargetMemoryUtilizationPercentage == 0 && len(settings.Metrics) == 0 {
+		settings.TargetCPUUtilizationPercentage = defaults.AutoscalingTargetCPUUtilizationPercentage
+	}
+	return &settings, nil
+}
+
+// TrustedCAReloadPolicy defines how the registry picks up changes of the
+// cluster trusted CA bundle.
+type TrustedCAReloadPolicy string
+
+const (
+	// TrustedCAReloadRollout rolls the registry out like any other
+	// configuration change, canary checks included. This is the default.
+	TrustedCAReloadRollout TrustedCAReloadPolicy = "Rollout"
+	// TrustedCAReloadImmediate rolls the registry out without waiting for a
+	// canary replica when only the trusted CA bundle has changed.
+	TrustedCAReloadImmediate TrustedCAReloadPolicy = "Immediate"
+)
+
+// TrustedCAOverrides controls how changes of the cluster trusted CA bundle
+// (proxy CA, user CAs) reach the registry.
+type TrustedCAOverrides struct {
+	Reload TrustedCAReloadPolicy `json:"reload,omitempty"`
+}
+
+// TrustedCAReloadPolicy returns the trusted CA reload policy, Rollout if it is
+// not set.
+func (o ConfigOverrides) TrustedCAReloadPolicy() TrustedCAReloadPolicy {
+	if o.TrustedCA == nil || o.TrustedCA.Reload == "" {
+		return TrustedCAReloadRollout
+	}
+	return o.TrustedCA.Reload
+}
+
+// ManifestOverrides controls which manifests the image registry accepts.
+type ManifestOverrides struct {
+	// AcceptSchema2 makes the registry accept image manifests of schema 2
+	// and manifest lists. When it is not set, the registry accepts them if
+	// the cluster imports image streams in the PreserveOriginal mode.
+	AcceptSchema2 *bool `json:"acceptSchema2,omitempty"`
+}
+
+// AcceptSchema2 returns whether schema 2 manifests and manifest lists are
+// explicitly accepted or refused, or nil if it is not set.
+func (o ConfigOverrides) AcceptSchema2() *bool {
+	if o.Manifests == nil {
+		return nil
+	}
+	return o.Manifests.AcceptSchema2
+}
+
+// PodSecurityOverrides controls the PodSecurity admission levels of the
+// operator namespace and the SCCs the registry and node-ca pods are pinned
+// to. Unset fields keep the defaults of the operator.
+type PodSecurityOverrides struct {
+	Enforce string `json:"enforce,omitempty"`
+	Audit   string `json:"audit,omitempty"`
+	Warn    string `json:"warn,omitempty"`
+	// RegistrySCC is the SCC of the registry pods. Defaults to
+	// restricted-v2.
+	RegistrySCC string `json:"registrySCC,omitempty"`
+	// NodeCASCC is the SCC of the node-ca pods. Defaults to privileged.
+	NodeCASCC string `json:"nodeCASCC,omitempty"`
+}
+
+// podSecurityLevels are the levels of the PodSecurity admission.
+var podSecurityLevels = map[string]bool{
+	"privileged": true,
+	"baseline":   true,
+	"restricted": true,
+}
+
+// PodSecurityLabels returns the PodSecurity labels of the operator
+// namespace. The levels default to privileged: the node-ca pods use the host
+// network and a host path.
+func (o ConfigOverrides) PodSecurityLabels() (map[string]string, error) {
+	labels := map[string]string{
+		defaults.PodSecurityEnforceLabel: "privileged",
+		defaults.PodSecurityAuditLabel:   "privileged",
+		defaults.PodSecurityWarnLabel:    "privileged",
+	}
+	if o.PodSecurity == nil {
+		return labels, nil
+	}
+	for label, level := range map[string]string{
+		defaults.PodSecurityEnforceLabel: o.PodSecurity.Enforce,
+		defaults.PodSecurityAuditLabel:   o.PodSecurity.Audit,
+		defaults.PodSecurityWarnLabel:    o.PodSecurity.Warn,
+	} {
+		if level == "" {
+			continue
+		}
+		if !podSecurityLevels[level] {
+			return nil, fmt.Errorf("unsupported pod security level %q for %s", level, label)
+		}
+		labels[label] = level
+	}
+	return labels, nil
+}
+
+// RegistrySCC returns the SCC the registry pods are pinned to.
+func (o ConfigOverrides) RegistrySCC() string {
+	if o.PodSecurity == nil || o.PodSecurity.RegistrySCC == "" {
+		return "restricted-v2"
+	}
+	return o.PodSecurity.RegistrySCC
+}
+
+// NodeCASCC returns the SCC the node-ca pods are pinned to.
+func (o ConfigOverrides) NodeCASCC() string {
+	if o.PodSecurity == nil || o.PodSecurity.NodeCASCC == "" {
+		return "privileged"
+	}
+	return o.PodSecurity.NodeCASCC
+}
+
+// NodeCAOverrides controls the node-ca daemon sets that install the CA
+// bundles of the registries on the nodes.
+type NodeCAOverrides struct {
+	// Pools are the node pools that trust additional registry CA bundles.
+	// Each pool gets its own node-ca daemon set, the node-ca daemon set of
+	// the other nodes is kept off the nodes of the pools.
+	Pools []NodeCAPool `json:"pools,omitempty"`
+
+	// Resources, PriorityClassName and Tolerations replace the ones of the
+	// node-ca pods, independently of the registry deployment. The pods
+	// request 10m of CPU and 10Mi of memory, have the
+	// system-cluster-critical priority class and tolerate all the taints
+	// by default.
+	Resources         *corev1.ResourceRequirements `json:"resources,omitempty"`
+	PriorityClassName string                       `json:"priorityClassName,omitempty"`
+	Tolerations       []corev1.Toleration          `json:"tolerations,omitempty"`
+}
+
+// NodeCAPool is a node pool that trusts the CA bundles of the TrustedCA
+// config map in the openshift-config namespace in addition to the ones that
+// all the nodes trust. The keys of the config map are registry hostnames, as
+// in the additionalTrustedCA config map of the image config.
+type NodeCAPool struct {
+	Name string `json:"name"`
+	// NodeSelector selects the nodes of the pool with a single label, for
+	// example the node-role.kubernetes.io/<pool> label of a machine config
+	// pool.
+	NodeSelector map[string]string `json:"nodeSelector"`
+	TrustedCA    string            `json:"trustedCA"`
+}
+
+// NodeCAPools returns the node pools with their own CA bundles.
+func (o ConfigOverrides) NodeCAPools() ([]NodeCAPool, error) {
+	if o.NodeCA == nil {
+		return nil, nil
+	}
+	names := map[string]bool{}
+	selectors := map[string]bool{}
+	for _, pool := range o.NodeCA.Pools {
+		if errs := validation.IsDNS1123Label(defaults.NodeCAName + "-" + pool.Name); pool.Name == "" || len(errs) > 0 {
+			return nil, fmt.Errorf("invalid pool name %q: %s", pool.Name, strings.Join(errs, ", "))
+		}
+		if names[pool.Name] {
+			return nil, fmt.Errorf("the pool %s is defined more than once", pool.Name)
+		}
+		names[pool.Name] = true
+		if len(pool.NodeSelector) != 1 {
+			return nil, fmt.Errorf("the node selector of the pool %s must have exactly one label", pool.Name)
+		}
+		for key, value := range pool.NodeSelector {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid node selector label %q of the pool %s: %s", key, pool.Name, strings.Join(errs, ", "))
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid node selector value %q of the pool %s: %s", value, pool.Name, strings.Join(errs, ", "))
+			}
+			if selectors[key+"="+value] {
+				return nil, fmt.Errorf("the node selector %s=%s of the pool %s is used by another pool", key, value, pool.Name)
+			}
+			selectors[key+"="+value] = true
+		}
+		if errs := validation.IsDNS1123Subdomain(pool.TrustedCA); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid trustedCA %q of the pool %s: %s", pool.TrustedCA, pool.Name, strings.Join(errs, ", "))
+		}
+	}
+	return o.NodeCA.Pools, nil
+}
+
+// NodeCAPodSettings returns the resources, the priority class and the
+// tolerations of the node-ca pods, or nil if they are not set.
+func (o ConfigOverrides) NodeCAPodSettings() (*NodeCAOverrides, error) {
+	if o.NodeCA == nil {
+		return nil, nil
+	}
+	if r := o.NodeCA.Resources; r != nil {
+		for name, request := range r.Requests {
+			if limit, ok := r.Limits[name]; ok && request.Cmp(limit) > 0 {
+				return nil, fmt.Errorf("the %s request %s is greater than the limit %s", name, request.String(), limit.String())
+			}
+		}
+	}
+	if name := o.NodeCA.PriorityClassName; name != "" {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid priorityClassName %q: %s", name, strings.Join(errs, ", "))
+		}
+	}
+	for _, toleration := range o.NodeCA.Tolerations {
+		switch toleration.Operator {
+		case "", corev1.TolerationOpEqual:
+			if toleration.Key == "" {
+				return nil, fmt.Errorf("a toleration with the %s operator needs a key", corev1.TolerationOpEqual)
+			}
+		case corev1.TolerationOpExists:
+			if toleration.Value != "" {
+				return nil, fmt.Errorf("the toleration of %q with the %s operator can not have a value", toleration.Key, corev1.TolerationOpExists)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported toleration operator %q", toleration.Operator)
+		}
+		switch toleration.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("unsupported toleration effect %q", toleration.Effect)
+		}
+		if toleration.TolerationSeconds != nil && toleration.Effect != corev1.TaintEffectNoExecute {
+			return nil, fmt.Errorf("tolerationSeconds of %q can only be set for the %s effect", toleration.Key, corev1.TaintEffectNoExecute)
+		}
+	}
+	return o.NodeCA, nil
+}
+
+// RoutingOverrides controls how traffic reaches the image registry.
+type RoutingOverrides struct {
+	// SplitPullEndpoint makes the operator run read-only registry replicas
+	// behind a separate pull endpoint, the image-registry-pull service.
+	// Pushes keep going to the image-registry service. Clients have to
+	// use the pull endpoint to benefit from the read-only replicas.
+	SplitPullEndpoint bool `json:"splitPullEndpoint,omitempty"`
+	// PullReplicas is the number of read-only replicas. Defaults to the
+	// number of registry replicas.
+	PullReplicas int32 `json:"pullReplicas,omitempty"`
+	// PullRoutes are routes exposing the pull endpoint outside of the
+	// cluster. They are load balanced by the least number of connections
+	// and allow long-running blob downloads.
+	PullRoutes []imageregistryv1.ImageRegistryConfigRoute `json:"pullRoutes,omitempty"`
+	// Gateway exposes the registry through a Gateway API HTTPRoute, for
+	// clusters that use Gateway API for their ingress.
+	Gateway *GatewayOverrides `json:"gateway,omitempty"`
+	// RateLimit limits the traffic of each client of the registry routes.
+	RateLimit *RateLimitOverrides `json:"rateLimit,omitempty"`
+}
+
+// GatewayOverrides configures the HTTPRoute of the registry. TLS is
+// terminated by the listeners of the gateways, which re-encrypt the traffic
+// to the registry with the service CA.
+type GatewayOverrides struct {
+	// ParentRefs are the gateways the HTTPRoute is attached to.
+	ParentRefs []GatewayParentRef `json:"parentRefs,omitempty"`
+	// Hostnames are the hostnames of the registry on the gateways. They
+	// must be served by a listener with a certificate that covers them.
+	Hostnames []string `json:"hostnames,omitempty"`
+}
+
+// GatewayParentRef is a reference to a gateway, or to one of its listeners.
+type GatewayParentRef struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// SplitPullEndpoint returns whether the pull endpoint is separated from the
+// push endpoint.
+func (o ConfigOverrides) SplitPullEndpoint() bool {
+	return o.Routing != nil && o.Routing.SplitPullEndpoint
+}
+
+// PullEndpoint returns the number of read-only replicas, 0 for the number of
+// registry replicas, and the routes of the pull endpoint. It returns no
+// routes if the pull endpoint is not separated from the push endpoint.
+func (o ConfigOverrides) PullEndpoint() (int32, []imageregistryv1.ImageRegistryConfigRoute, error) {
+	if !o.SplitPullEndpoint() {
+		return 0, nil, nil
+	}
+	if o.Routing.PullReplicas < 0 {
+		return 0, nil, fmt.Errorf("pullReplicas must not be negative, got %d", o.Routing.PullReplicas)
+	}
+	names := map[string]bool{}
+	for _, route := range o.Routing.PullRoutes {
+		if route.Name == "" {
+			return 0, nil, fmt.Errorf("pull routes must have a name")
+		}
+		if names[route.Name] {
+			return 0, nil, fmt.Errorf("duplicate pull route name %q", route.Name)
+		}
+		names[route.Name] = true
+	}
+	return o.Routing.PullReplicas, o.Routing.PullRoutes, nil
+}
+
+// Gateway returns the settings of the HTTPRoute of the registry, or nil if
+// the registry is not exposed through Gateway API.
+func (o ConfigOverrides) Gateway() (*GatewayOverrides, error) {
+	if o.Routing == nil || o.Routing.Gateway == nil {
+		return nil, nil
+	}
+	gateway := o.Routing.Gateway
+	if len(gateway.ParentRefs) == 0 {
+		return nil, fmt.Errorf("the gateway needs at least one parentRef")
+	}
+	for _, ref := range gateway.ParentRefs {
+		if ref.Name == "" {
+			return nil, fmt.Errorf("gateway parentRefs must have a name")
+		}
+	}
+	if len(gateway.Hostnames) == 0 {
+		return nil, fmt.Errorf("the gateway needs at least one hostname")
+	}
+	for _, hostname := range gateway.Hostnames {
+		if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(hostname, "*.")); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid gateway hostname %q: %s", hostname, strings.Join(errs, ", "))
+		}
+	}
+	return gateway, nil
+}
+
+// NetworkOverrides controls the IP families of the registry services.
+type NetworkOverrides struct {
+	// IPFamilyPolicy is the IP family policy of the services: SingleStack,
+	// PreferDualStack or RequireDualStack.
+	IPFamilyPolicy corev1.IPFamilyPolicy `json:"ipFamilyPolicy,omitempty"`
+	// IPFamilies are the IP families of the services. The first one is the
+	// family of the primary cluster IP.
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
+}
+
+// ServiceIPFamilies returns the IP families requested for the registry
+// services, or nil if the families of the cluster are used.
+func (o ConfigOverrides) ServiceIPFamilies() (*NetworkOverrides, error) {
+	if o.Network == nil {
+		return nil, nil
+	}
+	switch o.Network.IPFamilyPolicy {
+	case "", corev1.IPFamilyPolicySingleStack, corev1.IPFamilyPolicyPreferDualStack, corev1.IPFamilyPolicyRequireDualStack:
+	default:
+		return nil, fmt.Errorf("unsupported IP family policy %q", o.Network.IPFamilyPolicy)
+	}
+	if len(o.Network.IPFamilies) > 2 {
+		return nil, fmt.Errorf("at most two IP families can be set, got %d", len(o.Network.IPFamilies))
+	}
+	seen := map[corev1.IPFamily]bool{}
+	for _, family := range o.Network.IPFamilies {
+		if family != corev1.IPv4Protocol && family != corev1.IPv6Protocol {
+			return nil, fmt.Errorf("unsupported IP family %q", family)
+		}
+		if seen[family] {
+			return nil, fmt.Errorf("duplicate IP family %q", family)
+		}
+		seen[family] = true
+	}
+	if o.Network.IPFamilyPolicy == corev1.IPFamilyPolicySingleStack && len(o.Network.IPFamilies) > 1 {
+		return nil, fmt.Errorf("the SingleStack IP family policy takes a single IP family")
+	}
+	return o.Network, nil
+}
+
+// TLSOverrides controls the serving certificate of the registry.
+type TLSOverrides struct {
+	// ServingCertSecretName is a secret of the operator namespace with the
+	// tls.crt and tls.key of the registry, for example a secret issued by
+	// cert-manager. The certificate of the service CA is used by default.
+	ServingCertSecretName string `json:"servingCertSecretName,omitempty"`
+}
+
+// ServingCertSecretName returns the name of the secret with the serving
+// certificate of the registry, and whether it is supplied by the user.
+func (o ConfigOverrides) ServingCertSecretName() (string, bool) {
+	if o.TLS == nil || o.TLS.ServingCertSecretName == "" {
+		return defaults.ImageRegistryName + "-tls", false
+	}
+	return o.TLS.ServingCertSecretName, true
+}
+
+// CacheOverrides configures the registry as a pull-through cache of an
+// upstream registry.
+type CacheOverrides struct {
+	// RemoteURL is the URL of the upstream registry. Setting it enables the
+	// pull-through cache.
+	RemoteURL string `json:"remoteURL,omitempty"`
+	// CredentialsSecretName is the name of a secret in the namespace of the
+	// registry with the username and password keys used to authenticate to
+	// the upstream registry. The upstream registry is accessed anonymously
+	// if it is not set.
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+	// TTL is how long the cached content is kept after it was last pulled.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// PullThroughCache returns the settings of the pull-through cache, or nil if
+// the registry is not a pull-through cache.
+func (o ConfigOverrides) PullThroughCache() (*CacheOverrides, error) {
+	if o.Cache == nil || o.Cache.RemoteURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(o.Cache.RemoteURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remoteURL: %w", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("remoteURL must be an http or https URL, got %q", o.Cache.RemoteURL)
+	}
+	if name := o.Cache.CredentialsSecretName; name != "" {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid credentialsSecretName %q: %s", name, strings.Join(errs, ", "))
+		}
+	}
+	if o.Cache.TTL != nil && o.Cache.TTL.Duration < 0 {
+		return nil, fmt.Errorf("ttl must not be negative, got %s", o.Cache.TTL.Duration)
+	}
+	return o.Cache, nil
+}
+
+// RateLimitOverrides limits the traffic of each client of the registry
+// routes, so that a single client can not saturate the registry. The
+// limits are enforced by the router for each client IP address.
+type RateLimitOverrides struct {
+	// ConcurrentConnectionsPerClient is the number of connections a client
+	// can keep open.
+	ConcurrentConnectionsPerClient int32 `json:"concurrentConnectionsPerClient,omitempty"`
+	// RequestsPerSecondPerClient is the average number of HTTP requests a
+	// client can send per second.
+	RequestsPerSecondPerClient int32 `json:"requestsPerSecondPerClient,omitempty"`
+}
+
+// RouteRateLimit returns the limits of the clients of the registry routes,
+// or nil if they are not limited.
+func (o ConfigOverrides) RouteRateLimit() (*RateLimitOverrides, error) {
+	if o.Routing == nil || o.Routing.RateLimit == nil {
+		return nil, nil
+	}
+	rateLimit := o.Routing.RateLimit
+	if rateLimit.ConcurrentConnectionsPerClient < 0 {
+		return nil, fmt.Errorf("concurrentConnectionsPerClient must not be negative, got %d", rateLimit.ConcurrentConnectionsPerClient)
+	}
+	if rateLimit.RequestsPerSecondPerClient < 0 {
+		return nil, fmt.Errorf("requestsPerSecondPerClient must not be negative, got %d", rateLimit.RequestsPerSecondPerClient)
+	}
+	if rateLimit.ConcurrentConnectionsPerClient == 0 && rateLimit.RequestsPerSecondPerClient == 0 {
+		return nil, nil
+	}
+	return rateLimit, nil
+}
+
+// RequestLoggingMode defines which HTTP requests the registry logs.
+type RequestLoggingMode string
+
+const (
+	// RequestLoggingModeAll logs every request. This is the default.
+	RequestLoggingModeAll RequestLoggingMode = "All"
+	// RequestLoggingModeNone disables request logging. The registry still
+	// logs the errors of failed requests.
+	RequestLoggingModeNone RequestLoggingMode = "None"
+)
+
+// LoggingOverrides holds the logging settings of the image registry.
+type LoggingOverrides struct {
+	// Level is the log level of the registry: error, warn, info or debug.
+	// It takes precedence over spec.logLevel and spec.logging.
+	Level string `json:"level,omitempty"`
+	// Format is the format of the registry logs.
+	Format LogFormat `json:"format,omitempty"`
+	// Requests controls the logging of the HTTP requests.
+	Requests *RequestLoggingOverrides `json:"requests,omitempty"`
+}
+
+// LogFormat defines the format of the registry logs.
+type LogFormat string
+
+const (
+	// LogFormatText logs lines of key=value pairs. This is the default.
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON logs a JSON object per line.
+	LogFormatJSON LogFormat = "json"
+)
+
+// RegistryLogLevel returns the log level of the registry, or an empty
+// string if it is derived from spec.logLevel.
+func (o ConfigOverrides) RegistryLogLevel() (string, error) {
+	if o.Logging == nil || o.Logging.Level == "" {
+		return "", nil
+	}
+	switch level := o.Logging.Level; level {
+	case "error", "warn", "info", "debug":
+		return level, nil
+	default:
+		return "", fmt.Errorf("unsupported log level %q, must be error, warn, info or debug", level)
+	}
+}
+
+// RegistryLogFormat returns the format of the registry logs, text if it is
+// not set.
+func (o ConfigOverrides) RegistryLogFormat() (LogFormat, error) {
+	if o.Logging == nil || o.Logging.Format == "" {
+		return LogFormatText, nil
+	}
+	switch format := o.Logging.Format; format {
+	case LogFormatText, LogFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported log format %q, must be %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// RequestLoggingOverrides controls the HTTP request (access) logging of the
+// image registry. It maps to the log.accesslog.disabled setting of the
+// registry, which has no sampling.
+type RequestLoggingOverrides struct {
+	Mode RequestLoggingMode `json:"mode,omitempty"`
+}
+
+// RequestLoggingMode returns the request logging mode, All if it is not set.
+func (o ConfigOverrides) RequestLoggingMode() (RequestLoggingMode, error) {
+	if o.Logging == nil || o.Logging.Requests == nil || o.Logging.Requests.Mode == "" {
+		return RequestLoggingModeAll, nil
+	}
+	switch mode := o.Logging.Requests.Mode; mode {
+	case RequestLoggingModeAll, RequestLoggingModeNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported request logging mode %q, must be %s or %s", mode, RequestLoggingModeAll, RequestLoggingModeNone)
+	}
+}
+
+// MaintenanceOverrides controls when the operator runs maintenance
+// operations.
+type MaintenanceOverrides struct {
+	Window         *MaintenanceWindow `json:"window,omitempty"`
+	PruneInterlock *PruneInterlock    `json:"pruneInterlock,omitempty"`
+	HardPrune      *HardPrune         `json:"hardPrune,omitempty"`
+	// ConsistencyCheck runs the check mode of the hard prune on a
+	// schedule, to compare the image metadata with the storage.
+	ConsistencyCheck *ConsistencyCheck `json:"consistencyCheck,omitempty"`
+	// UsagePrune runs the image pruner when the storage holds more data
+	// than a threshold.
+	UsagePrune *UsagePrune `json:"usagePrune,omitempty"`
+}
+
+// PruneInterlock holds the jobs of the image pruner back while builds are in
+// progress, so that the pruner doesn't delete the blobs of images that are
+// still being pushed.
+type PruneInterlock struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// MaxDeferralSeconds is the longest time a pruner job waits for the
+	// builds, from 60 to 86400. It defaults to one hour.
+	MaxDeferralSeconds int32 `json:"maxDeferralSeconds,omitempty"`
+}
+
+// PruneInterlock returns whether the pruner jobs wait for the builds in
+// progress, and the number of seconds they wait at most.
+func (o ConfigOverrides) PruneInterlock() (bool, int32, error) {
+	if o.Maintenance == nil || o.Maintenance.PruneInterlock == nil {
+		return false, 0, nil
+	}
+	interlock := o.Maintenance.PruneInterlock
+	if interlock.MaxDeferralSeconds == 0 {
+		return interlock.Enabled, defaults.PruneInterlockMaxDeferralSeconds, nil
+	}
+	if interlock.MaxDeferralSeconds < 60 || interlock.MaxDeferralSeconds > 86400 {
+		return false, 0, fmt.Errorf("maxDeferralSeconds must be between 60 and 86400, got %d", interlock.MaxDeferralSeconds)
+	}
+	return interlock.Enabled, interlock.MaxDeferralSeconds, nil
+}
+
+// HardPrune runs the hard prune of the registry on a schedule. The hard prune
+// deletes the blobs of the storage that no image references anymore, the
+// image pruner only deletes the images and the links to their blobs.
+type HardPrune struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Schedule is the cron schedule of the hard prune. It defaults to the
+	// start of the maintenance window, or to every Sunday at 03:00.
+	Schedule string `json:"schedule,omitempty"`
+	// DryRun only reports the blobs the hard prune would delete.
+	DryRun bool `json:"dryRun,omitempty"`
+	// KeepYoungerThan holds a hard prune back until no image was created
+	// during this time, the blobs of an image that is being pushed are not
+	// referenced yet. It defaults to one hour.
+	KeepYoungerThan *metav1.Duration `json:"keepYoungerThan,omitempty"`
+}
+
+// HardPrune returns the settings of the hard prune, or nil if it is not
+// enabled. KeepYoungerThan is always set.
+func (o ConfigOverrides) HardPrune() (*HardPrune, error) {
+	if o.Maintenance == nil || o.Maintenance.HardPrune == nil || !o.Maintenance.HardPrune.Enabled {
+		return nil, nil
+	}
+	hardPrune := *o.Maintenance.HardPrune
+	if hardPrune.Schedule != "" {
+		if _, err := cron.ParseStandard(hardPrune.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", hardPrune.Schedule, err)
+		}
+	}
+	if hardPrune.KeepYoungerThan == nil {
+		hardPrune.KeepYoungerThan = &metav1.Duration{Duration: defaults.HardPruneKeepYoungerThanSeconds * time.Second}
+	} else if hardPrune.KeepYoungerThan.Duration < 0 {
+		return nil, fmt.Errorf("keepYoungerThan must not be negative, got %s", hardPrune.KeepYoungerThan.Duration)
+	}
+	return &hardPrune, nil
+}
+
+// ConsistencyCheck runs the check mode of the hard prune periodically and
+// reports the inconsistencies between the image metadata and the storage.
+type ConsistencyCheck struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Schedule is the cron schedule of the check. It defaults to every day
+	// at 04:00.
+	Schedule string `json:"schedule,omitempty"`
+	// RestoreLostImageStreams re-creates the image streams of the
+	// repositories that are in the storage but have no image stream, with
+	// a lost-found-<digest> tag for each of their images that still exist.
+	RestoreLostImageStreams bool `json:"restoreLostImageStreams,omitempty"`
+}
+
+// ConsistencyCheck returns the settings of the consistency check, or nil if
+// it is not enabled. Schedule is always set.
+func (o ConfigOverrides) ConsistencyCheck() (*ConsistencyCheck, error) {
+	if o.Maintenance == nil || o.Maintenance.ConsistencyCheck == nil || !o.Maintenance.ConsistencyCheck.Enabled {
+		return nil, nil
+	}
+	check := *o.Maintenance.ConsistencyCheck
+	if check.Schedule == "" {
+		check.Schedule = defaults.ConsistencyCheckSchedule
+	} else if _, err := cron.ParseStandard(check.Schedule); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", check.Schedule, err)
+	}
+	return &check, nil
+}
+
+// UsagePrune runs the image pruner with fewer tag revisions when the storage
+// of the registry holds more than ThresholdPercent of Quota, until it holds
+// less.
+type UsagePrune struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Quota is the amount of data the storage may hold, such as 500Gi.
+	Quota string `json:"quota,omitempty"`
+	// ThresholdPercent is the usage of the quota above which images are
+	// pruned, from 1 to 100. It defaults to 80.
+	ThresholdPercent int32 `json:"thresholdPercent,omitempty"`
+	// MinKeepTagRevisions is the number of tag revisions the pruner keeps
+	// at least, from 1 to 100. It defaults to 1.
+	MinKeepTagRevisions int32 `json:"minKeepTagRevisions,omitempty"`
+	// IntervalSeconds is the time between two measures of the usage, from
+	// 300 to 86400. It defaults to one hour.
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// UsagePrune returns the settings of the usage prune and the number of bytes
+// above which images are pruned, or nil if it is not enabled. The optional
+// fields are always set.
+func (o ConfigOverrides) UsagePrune() (*UsagePrune, int64, error) {
+	if o.Maintenance == nil || o.Maintenance.UsagePrune == nil || !o.Maintenance.UsagePrune.Enabled {
+		return nil, 0, nil
+	}
+	prune := *o.Maintenance.UsagePrune
+	quota, err := resource.ParseQuantity(prune.Quota)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid quota %q: %w", prune.Quota, err)
+	}
+	if quota.Sign() <= 0 {
+		return nil, 0, fmt.Errorf("quota must be positive, got %s", prune.Quota)
+	}
+	if prune.ThresholdPercent == 0 {
+		prune.ThresholdPercent = defaults.UsagePruneThresholdPercent
+	} else if prune.ThresholdPercent < 1 || prune.ThresholdPercent > 100 {
+		return nil, 0, fmt.Errorf("thresholdPercent must be between 1 and 100, got %d", prune.ThresholdPercent)
+	}
+	if prune.MinKeepTagRevisions == 0 {
+		prune.MinKeepTagRevisions = 1
+	} else if prune.MinKeepTagRevisions < 1 || prune.MinKeepTagRevisions > 100 {
+		return nil, 0, fmt.Errorf("minKeepTagRevisions must be between 1 and 100, got %d", prune.MinKeepTagRevisions)
+	}
+	if prune.IntervalSeconds == 0 {
+		prune.IntervalSeconds = defaults.UsagePruneIntervalSeconds
+	} else if prune.IntervalSeconds < 300 || prune.IntervalSeconds > 86400 {
+		return nil, 0, fmt.Errorf("intervalSeconds must be between 300 and 86400, got %d", prune.IntervalSeconds)
+	}
+	threshold := quota.Value() / 100 * int64(prune.ThresholdPercent)
+	return &prune, threshold, nil
+}
+
+// RecreationOverrides controls how the operator recreates the objects it
+// manages when someone else deletes them.
+type RecreationOverrides struct {
+	// Halt stops the recreation of deleted objects, the operator reports
+	// Degraded instead so that the deletion can be investigated.
+	Halt bool `json:"halt,omitempty"`
+	// MaxPerHour is the number of times an object is recreated in an
+	// hour, from 1 to 60. It defaults to 5.
+	MaxPerHour int32 `json:"maxPerHour,omitempty"`
+}
+
+// RecreationPolicy returns how the operator recreates deleted objects. MaxPerHour
+// is always set.
+func (o ConfigOverrides) RecreationPolicy() (*RecreationOverrides, error) {
+	recreation := RecreationOverrides{}
+	if o.Recreation != nil {
+		recreation = *o.Recreation
+	}
+	if recreation.MaxPerHour == 0 {
+		recreation.MaxPerHour = defaults.RecreationMaxPerHour
+	} else if recreation.MaxPerHour < 1 || recreation.MaxPerHour > 60 {
+		return nil, fmt.Errorf("maxPerHour must be between 1 and 60, got %d", recreation.MaxPerHour)
+	}
+	return &recreation, nil
+}
+
+// MeshMode defines how the registry pods are integrated with a service mesh
+// (OpenShift Service Mesh, Istio) that injects sidecars automatically.
+type MeshMode string
+
+const (
+	// MeshModeNone leaves the sidecar injection to the mesh configuration.
+	// This is the default.
+	MeshModeNone MeshMode = "None"
+	// MeshModeExclude keeps the mesh from injecting a sidecar into the
+	// registry pods.
+	MeshModeExclude MeshMode = "Exclude"
+	// MeshModeCompatible lets the mesh inject a sidecar and configures the
+	// registry pods to work with it: the probes are rewritten by the
+	// sidecar, the registry port keeps its own TLS instead of the mesh
+	// mTLS, and blobs are served by the registry instead of redirecting
+	// clients to the storage.
+	MeshModeCompatible MeshMode = "Compatible"
+)
+
+// MeshOverrides controls the integration of the registry with a service
+// mesh.
+type MeshOverrides struct {
+	Mode MeshMode `json:"mode,omitempty"`
+}
+
+// MeshMode returns the service mesh mode, None if it is not set.
+func (o ConfigOverrides) MeshMode() (MeshMode, error) {
+	if o.Mesh == nil || o.Mesh.Mode == "" {
+		return MeshModeNone, nil
+	}
+	switch o.Mesh.Mode {
+	case MeshModeNone, MeshModeExclude:
+	case MeshModeCompatible:
+		if o.Deployment != nil && o.Deployment.Annotations[defaults.IstioInjectAnnotation] == "false" {
+			return "", fmt.Errorf("the %s mesh mode needs the sidecar, it is disabled by the deployment annotation %s", MeshModeCompatible, defaults.IstioInjectAnnotation)
+		}
+	default:
+		return "", fmt.Errorf("unsupported mesh mode %q", o.Mesh.Mode)
+	}
+	return o.Mesh.Mode, nil
+}
+
+// StagingOverrides makes the changes of the registry config wait for an
+// approval. The operator publishes the pending change set and keeps applying
+// the last approved config until the change set is approved.
+type StagingOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// ExpirySeconds is the time a change set can be approved, from 300 to
+	// 604800. An expired change set is staged again under a new ID. It
+	// defaults to one day.
+	ExpirySeconds int32 `json:"expirySeconds,omitempty"`
+}
+
+// StagedChanges returns whether the changes of the registry config wait for
+// an approval, and the number of seconds a change set can be approved.
+func (o ConfigOverrides) StagedChanges() (bool, int32, error) {
+	if o.Staging == nil || !o.Staging.Enabled {
+		return false, 0, nil
+	}
+	expiry := o.Staging.ExpirySeconds
+	if expiry == 0 {
+		return true, defaults.StagedChangesExpirySeconds, nil
+	}
+	if expiry < 300 || expiry > 604800 {
+		return false, 0, fmt.Errorf("expirySeconds must be between 300 and 604800, got %d", expiry)
+	}
+	return true, expiry, nil
+}
+
+// BackupPolicy defines how cluster backup tools (Velero, OADP) treat the
+// resources of the image registry.
+type BackupPolicy string
+
+const (
+	// BackupPolicyNone leaves the registry resources as they are. This is
+	// the default.
+	BackupPolicyNone BackupPolicy = "None"
+	// BackupPolicyExclude labels the registry resources to be excluded from
+	// backups.
+	BackupPolicyExclude BackupPolicy = "Exclude"
+	// BackupPolicyIncludeWithHooks annotates the registry pods with backup
+	// hooks that wait for in-flight uploads to settle and flush the
+	// filesystem before the volume is backed up.
+	BackupPolicyIncludeWithHooks BackupPolicy = "IncludeWithHooks"
+)
+
+// BackupOverrides controls how the image registry is backed up.
+type BackupOverrides struct {
+	Policy BackupPolicy `json:"policy,omitempty"`
+	// QuiesceTimeoutSeconds is the time the pre-backup hook waits for
+	// uploads to settle in the IncludeWithHooks policy. Defaults to 300
+	// seconds.
+	QuiesceTimeoutSeconds int32 `json:"quiesceTimeoutSeconds,omitempty"`
+}
+
+// BackupPolicy returns the backup policy, None if it is not set.
+func (o ConfigOverrides) BackupPolicy() (BackupPolicy, error) {
+	if o.Backup == nil {
+		return BackupPolicyNone, nil
+	}
+	if o.Backup.QuiesceTimeoutSeconds < 0 {
+		return "", fmt.Errorf("quiesceTimeoutSeconds must not be negative, got %d", o.Backup.QuiesceTimeoutSeconds)
+	}
+	switch o.Backup.Policy {
+	case "":
+		return BackupPolicyNone, nil
+	case BackupPolicyNone, BackupPolicyExclude, BackupPolicyIncludeWithHooks:
+		return o.Backup.Policy, nil
+	default:
+		return "", fmt.Errorf("unsupported backup policy %q", o.Backup.Policy)
+	}
+}
+
+// StorageOverrides holds settings of the storage drivers.
+type StorageOverrides struct {
+	Azure       *AzureOverrides              `json:"azure,omitempty"`
+	GCS         *GCSOverrides                `json:"gcs,omitempty"`
+	PVC         *PVCOverrides                `json:"pvc,omitempty"`
+	S3          *S3Overrides                 `json:"s3,omitempty"`
+	RGW         *RGWOverrides                `json:"rgw,omitempty"`
+	Credentials *StorageCredentialsOverrides `json:"credentials,omitempty"`
+	Removal     *StorageRemovalOverrides     `json:"removal,omitempty"`
+	// Mirror is a secondary storage the operator provisions as a copy
+	// target for the registry storage.
+	Mirror *imageregistryv1.ImageRegistryConfigStorage `json:"mirror,omitempty"`
+	// Preset is the on-prem product behind the S3-compatible endpoint of
+	// spec.storage.s3.
+	Preset StoragePreset `json:"preset,omitempty"`
+	// Benchmark tunes the benchmarks of the storage requested by the
+	// StorageBenchmarkAnnotation.
+	Benchmark *StorageBenchmark `json:"benchmark,omitempty"`
+}
+
+// StorageBenchmark tunes the blobs a storage benchmark writes and reads.
+type StorageBenchmark struct {
+	// BlobSizeMiB is the size of each blob, from 1 to 1024. It defaults
+	// to 16.
+	BlobSizeMiB int64 `json:"blobSizeMiB,omitempty"`
+	// Blobs is the number of blobs, from 1 to 1000. It defaults to 16.
+	Blobs int `json:"blobs,omitempty"`
+	// Concurrency is the number of blobs transferred at the same time,
+	// from 1 to 32. It defaults to 4.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// StorageBenchmark returns the settings of the storage benchmarks, the
+// fields are always set.
+func (o ConfigOverrides) StorageBenchmark() (*StorageBenchmark, error) {
+	benchmark := StorageBenchmark{
+		BlobSizeMiB: defaults.StorageBenchmarkBlobSizeMiB,
+		Blobs:       defaults.StorageBenchmarkBlobs,
+		Concurrency: defaults.StorageBenchmarkConcurrency,
+	}
+	if o.Storage == nil || o.Storage.Benchmark == nil {
+		return &benchmark, nil
+	}
+	if size := o.Storage.Benchmark.BlobSizeMiB; size != 0 {
+		if size < 1 || size > 1024 {
+			return nil, fmt.Errorf("blobSizeMiB must be between 1 and 1024, got %d", size)
+		}
+		benchmark.BlobSizeMiB = size
+	}
+	if blobs := o.Storage.Benchmark.Blobs; blobs != 0 {
+		if blobs < 1 || blobs > 1000 {
+			return nil, fmt.Errorf("blobs must be between 1 and 1000, got %d", blobs)
+		}
+		benchmark.Blobs = blobs
+	}
+	if concurrency := o.Storage.Benchmark.Concurrency; concurrency != 0 {
+		if concurrency < 1 || concurrency > 32 {
+			return nil, fmt.Errorf("concurrency must be between 1 and 32, got %d", concurrency)
+		}
+		benchmark.Concurrency = concurrency
+	}
+	return &benchmark, nil
+}
+
+// StoragePreset is an on-prem object store with an S3-compatible API. A
+// preset expands to the S3 settings the product needs.
+type StoragePreset string
+
+const (
+	StoragePresetMinIO             StoragePreset = "MinIO"
+	StoragePresetCephRGW           StoragePreset = "CephRGW"
+	StoragePresetNetAppStorageGRID StoragePreset = "NetAppStorageGRID"
+	StoragePresetQuobyte           StoragePreset = "Quobyte"
+)
+
+// StoragePreset returns the on-prem product of the S3 storage, or an empty
+// string.
+func (o ConfigOverrides) StoragePreset() (StoragePreset, error) {
+	if o.Storage == nil {
+		return "", nil
+	}
+	switch preset := o.Storage.Preset; preset {
+	case "", StoragePresetMinIO, StoragePresetCephRGW, StoragePresetNetAppStorageGRID, StoragePresetQuobyte:
+		return preset, nil
+	default:
+		return "", fmt.Errorf("unsupported storage preset %q, must be %s, %s, %s or %s", preset, StoragePresetMinIO, StoragePresetCephRGW, StoragePresetNetAppStorageGRID, StoragePresetQuobyte)
+	}
+}
+
+// StorageRemovalOverrides controls how the objects of a managed bucket are
+// deleted when the storage is removed. The objects are deleted in chunks and
+// the progress is persisted after each chunk, so that an interrupted removal
+// resumes where it stopped.
+type StorageRemovalOverrides struct {
+	// ChunkSize is the number of objects deleted between two checkpoints.
+	// Zero means the default, 1000, the most objects S3 deletes in a single
+	// request.
+	ChunkSize int `json:"chunkSize,omitempty"`
+	// ObjectsPerSecond limits the rate at which objects are deleted. Zero
+	// means the default, 1000.
+	ObjectsPerSecond int `json:"objectsPerSecond,omitempty"`
+}
+
+// StorageRemoval returns the chunk size and the rate limit of the deletion of
+// the objects of a managed bucket.
+func (o ConfigOverrides) StorageRemoval() (chunkSize int, objectsPerSecond int, err error) {
+	chunkSize = defaults.StorageRemovalChunkSize
+	objectsPerSecond = defaults.StorageRemovalObjectsPerSecond
+	if o.Storage == nil || o.Storage.Removal == nil {
+		return chunkSize, objectsPerSecond, nil
+	}
+	removal := o.Storage.Removal
+	if removal.ChunkSize < 0 || removal.ChunkSize > defaults.StorageRemovalChunkSize {
+		return 0, 0, fmt.Errorf("chunkSize must be between 0 (the default) and %d, got %d", defaults.StorageRemovalChunkSize, removal.ChunkSize)
+	}
+	if removal.ObjectsPerSecond < 0 {
+		return 0, 0, fmt.Errorf("objectsPerSecond must not be negative (0 is the default), got %d", removal.ObjectsPerSecond)
+	}
+	if removal.ChunkSize > 0 {
+		chunkSize = removal.ChunkSize
+	}
+	if removal.ObjectsPerSecond > 0 {
+		objectsPerSecond = removal.ObjectsPerSecond
+	}
+	return chunkSize, objectsPerSecond, nil
+}
+
+// StorageCredentialsOverrides sources the user provided storage credentials
+// from a secret managed by an external secret operator (External Secrets
+// Operator, Secrets Store CSI driver) instead of the
+// image-registry-private-configuration-user secret.
+type StorageCredentialsOverrides struct {
+	// SecretName is the name of the secret in the openshift-image-registry
+	// namespace with the storage credentials, in the format of the
+	// image-registry-private-configuration-user secret. The operator copies
+	// it into image-registry-private-configuration-user whenever it
+	// changes and rolls the registry out.
+	SecretName string `json:"secretName,omitempty"`
+	// SecretProviderClass is the name of a SecretProviderClass of the
+	// Secrets Store CSI driver. Its volume is mounted into the registry
+	// pods, so that the driver keeps the secret SecretName synchronized
+	// and rotated.
+	SecretProviderClass string `json:"secretProviderClass,omitempty"`
+}
+
+// StorageCredentialsSource returns where the user provided storage
+// credentials are sourced from, or nil if they are in the
+// image-registry-private-configuration-user secret.
+func (o ConfigOverrides) StorageCredentialsSource() (*StorageCredentialsOverrides, error) {
+	if o.Storage == nil || o.Storage.Credentials == nil {
+		return nil, nil
+	}
+	source := o.Storage.Credentials
+	if source.SecretName == "" {
+		if source.SecretProviderClass != "" {
+			return nil, fmt.Errorf("secretName is required with secretProviderClass, it is the secret synchronized by the Secrets Store CSI driver")
+		}
+		return nil, nil
+	}
+	if source.SecretName == defaults.ImageRegistryPrivateConfigurationUser {
+		return nil, fmt.Errorf("secretName must not be %s, the credentials are copied into it", defaults.ImageRegistryPrivateConfigurationUser)
+	}
+	return source, nil
+}
+
+// S3Overrides extends spec.storage.s3.
+type S3Overrides struct {
+	ManagedFeatures *S3ManagedFeatures `json:"managedFeatures,omitempty"`
+	LifecycleRules  []S3LifecycleRule  `json:"lifecycleRules,omitempty"`
+	DriftDetection  *S3DriftDetection  `json:"driftDetection,omitempty"`
+	// AddressingStyle selects how the bucket is addressed on the
+	// regionEndpoint of spec.storage.s3: Path, VirtualHosted, or Auto to
+	// probe the endpoint. It overrides spec.storage.s3.virtualHostedStyle.
+	AddressingStyle string        `json:"addressingStyle,omitempty"`
+	Versioning      *S3Versioning `json:"versioning,omitempty"`
+	// Accelerate makes the registry use the S3 Transfer Acceleration
+	// endpoint of the bucket, for clients far from its region.
+	Accelerate bool          `json:"accelerate,omitempty"`
+	ObjectLock *S3ObjectLock `json:"objectLock,omitempty"`
+	// CheckReachability makes the operator check that the S3 endpoint
+	// can be reached before it uses the bucket, and report why it can
+	// not be, for example a missing S3 gateway endpoint in a private VPC.
+	CheckReachability bool `json:"checkReachability,omitempty"`
+}
+
+// S3ObjectLock enables Object Lock on a managed bucket, so that the objects
+// written by the registry can not be deleted before their retention period
+// ends. The objects are retained in governance mode.
+type S3ObjectLock struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// RetentionDays is the default retention period of the objects, one
+	// day when it is not set.
+	RetentionDays int32 `json:"retentionDays,omitempty"`
+}
+
+// maxObjectLockRetentionDays is the longest default retention period S3
+// accepts, 100 years.
+const maxObjectLockRetentionDays = 36500
+
+// S3Versioning enables the versioning of a managed bucket, so that blobs
+// deleted by accident can be recovered.
+type S3Versioning struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// NoncurrentVersionExpirationDays is the number of days overwritten
+	// and deleted objects are kept. Zero keeps them until they are deleted
+	// by hand.
+	NoncurrentVersionExpirationDays int32 `json:"noncurrentVersionExpirationDays,omitempty"`
+}
+
+// S3Versioning returns the versioning settings of the S3 bucket, or nil if
+// versioning is not enabled.
+func (o ConfigOverrides) S3Versioning() (*S3Versioning, error) {
+	if o.Storage == nil || o.Storage.S3 == nil || o.Storage.S3.Versioning == nil {
+		return nil, nil
+	}
+	versioning := o.Storage.S3.Versioning
+	if versioning.NoncurrentVersionExpirationDays < 0 {
+		return nil, fmt.Errorf("noncurrentVersionExpirationDays must not be negative, got %d", versioning.NoncurrentVersionExpirationDays)
+	}
+	if !versioning.Enabled {
+		return nil, nil
+	}
+	return versioning, nil
+}
+
+// S3ObjectLockRetention returns the Object Lock settings of the S3 bucket,
+// or nil if Object Lock is not requested.
+func (o ConfigOverrides) S3ObjectLockRetention() (*S3ObjectLock, error) {
+	if o.Storage == nil || o.Storage.S3 == nil || o.Storage.S3.ObjectLock == nil {
+		return nil, nil
+	}
+	lock := *o.Storage.S3.ObjectLock
+	if lock.RetentionDays < 0 || lock.RetentionDays > maxObjectLockRetentionDays {
+		return nil, fmt.Errorf("retentionDays must be between 1 and %d, got %d", maxObjectLockRetentionDays, lock.RetentionDays)
+	}
+	if !lock.Enabled {
+		return nil, nil
+	}
+	if lock.RetentionDays == 0 {
+		lock.RetentionDays = 1
+	}
+	return &lock, nil
+}
+
+// S3Accelerate returns true if the registry should use the S3 Transfer
+// Acceleration endpoint of the bucket.
+func (o ConfigOverrides) S3Accelerate() bool {
+	return o.Storage != nil && o.Storage.S3 != nil && o.Storage.S3.Accelerate
+}
+
+// S3ReachabilityCheck returns true if the operator should check that the S3
+// endpoint can be reached.
+func (o ConfigOverrides) S3ReachabilityCheck() bool {
+	return o.Storage != nil && o.Storage.S3 != nil && o.Storage.S3.CheckReachability
+}
+
+const (
+	S3AddressingStyleAuto          = "Auto"
+	S3AddressingStylePath          = "Path"
+	S3AddressingStyleVirtualHosted = "VirtualHosted"
+)
+
+// S3AddressingStyle returns the addressing style requested for the custom S3
+// endpoint, or an empty string if spec.storage.s3.virtualHostedStyle is used
+// as it is.
+func (o ConfigOverrides) S3AddressingStyle() (string, error) {
+	if o.Storage == nil || o.Storage.S3 == nil {
+		return "", nil
+	}
+	switch style := o.Storage.S3.AddressingStyle; style {
+	case "", S3AddressingStyleAuto, S3AddressingStylePath, S3AddressingStyleVirtualHosted:
+		return style, nil
+	default:
+		return "", fmt.Errorf("addressing style %q is not supported, use Auto, Path or VirtualHosted", style)
+	}
+}
+
+// S3DriftDetection makes the operator periodically check that the default
+// encryption and the public access block of a managed bucket have not been
+// changed out-of-band.
+type S3DriftDetection struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// IntervalSeconds is the time between two checks, at least 300. It
+	// defaults to one hour.
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+	// Remediate makes the operator restore the settings it finds changed.
+	// Otherwise the changes are only reported.
+	Remediate bool `json:"remediate,omitempty"`
+}
+
+// S3DriftDetection returns the drift detection settings of the S3 bucket, or
+// nil if drift detection is disabled. IntervalSeconds is always set.
+func (o ConfigOverrides) S3DriftDetection() (*S3DriftDetection, error) {
+	if o.Storage == nil || o.Storage.S3 == nil || o.Storage.S3.DriftDetection == nil {
+		return nil, nil
+	}
+	detection := *o.Storage.S3.DriftDetection
+	if detection.IntervalSeconds == 0 {
+		detection.IntervalSeconds = defaults.S3DriftDetectionIntervalSeconds
+	} else if detection.IntervalSeconds < 300 {
+		return nil, fmt.Errorf("intervalSeconds must be at least 300, got %d", detection.IntervalSeconds)
+	}
+	if !detection.Enabled {
+		return nil, nil
+	}
+	return &detection, nil
+}
+
+// S3LifecycleRule moves the blobs of the registry to another storage class
+// once they are older than a number of days.
+type S3LifecycleRule struct {
+	StorageClass string `json:"storageClass"`
+	Days         int64  `json:"days"`
+}
+
+// s3TransitionMinDays holds the storage classes blobs can be moved to, with
+// the minimum age AWS accepts for the transition. Archive classes such as
+// GLACIER and DEEP_ARCHIVE are left out: their objects have to be restored
+// before they can be read, the registry would fail to serve them.
+var s3TransitionMinDays = map[string]int64{
+	"STANDARD_IA":         30,
+	"ONEZONE_IA":          30,
+	"INTELLIGENT_TIERING": 0,
+	"GLACIER_IR":          0,
+}
+
+// S3LifecycleRules returns the transitions of the registry blobs to other
+// storage classes, ordered by age.
+func (o ConfigOverrides) S3LifecycleRules() ([]S3LifecycleRule, error) {
+	if o.Storage == nil || o.Storage.S3 == nil {
+		return nil, nil
+	}
+	rules := o.Storage.S3.LifecycleRules
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		minDays, ok := s3TransitionMinDays[rule.StorageClass]
+		if !ok {
+			return nil, fmt.Errorf("storageClass %q is not supported, use STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or GLACIER_IR", rule.StorageClass)
+		}
+		if seen[rule.StorageClass] {
+			return nil, fmt.Errorf("storageClass %s is used by several rules", rule.StorageClass)
+		}
+		seen[rule.StorageClass] = true
+		if rule.Days < 1 || rule.Days < minDays {
+			return nil, fmt.Errorf("days for %s must be at least %d, got %d", rule.StorageClass, max(minDays, 1), rule.Days)
+		}
+		if i > 0 && rule.Days <= rules[i-1].Days {
+			return nil, fmt.Errorf("rules must be ordered by increasing days, %s after %d days follows %s after %d days", rule.StorageClass, rule.Days, rules[i-1].StorageClass, rules[i-1].Days)
+		}
+	}
+	return rules, nil
+}
+
+// S3ManagedFeatures selects which bucket settings the operator applies to a
+// managed bucket. All of them are applied unless explicitly disabled, a
+// disabled feature is left to external tooling such as organization-wide
+// bucket policies.
+type S3ManagedFeatures struct {
+	Encryption        *bool `json:"encryption,omitempty"`
+	PublicAccessBlock *bool `json:"publicAccessBlock,omitempty"`
+	Lifecycle         *bool `json:"lifecycle,omitempty"`
+	Tagging           *bool `json:"tagging,omitempty"`
+}
+
+// S3ManagedFeatures returns the S3 managed features, or nil if they are not
+// set.
+func (o ConfigOverrides) S3ManagedFeatures() *S3ManagedFeatures {
+	if o.Storage == nil || o.Storage.S3 == nil {
+		return nil
+	}
+	return o.Storage.S3.ManagedFeatures
+}
+
+// ManagesEncryption returns whether the operator configures the default
+// encryption of the bucket.
+func (f *S3ManagedFeatures) ManagesEncryption() bool {
+	return f == nil || f.Encryption == nil || *f.Encryption
+}
+
+// ManagesPublicAccessBlock returns whether the operator blocks public access
+// to the bucket.
+func (f *S3ManagedFeatures) ManagesPublicAccessBlock() bool {
+	return f == nil || f.PublicAccessBlock == nil || *f.PublicAccessBlock
+}
+
+// ManagesLifecycle returns whether the operator configures the lifecycle
+// rules of the bucket.
+func (f *S3ManagedFeatures) ManagesLifecycle() bool {
+	return f == nil || f.Lifecycle == nil || *f.Lifecycle
+}
+
+// ManagesTagging returns whether the operator tags the bucket.
+func (f *S3ManagedFeatures) ManagesTagging() bool {
+	return f == nil || f.Tagging == nil || *f.Tagging
+}
+
+// AzureOverrides holds settings of the Azure storage driver.
+type AzureOverrides struct {
+	NetworkAccess *AzureNetworkAccessOverrides `json:"networkAccess,omitempty"`
+	SoftDelete    *AzureSoftDelete             `json:"softDelete,omitempty"`
+	TagSync       *AzureTagSync                `json:"tagSync,omitempty"`
+	TrustedCA     *AzureTrustedCA              `json:"trustedCA,omitempty"`
+}
+
+// AzureTrustedCA references a config map in the openshift-config namespace
+// with the CA bundle of the storage endpoints under the key ca-bundle.crt,
+// for Azure Stack Hub instances with a private CA.
+type AzureTrustedCA struct {
+	Name string `json:"name"`
+}
+
+// AzureTrustedCAName returns the name of the config map with the CA bundle of
+// the Azure storage endpoints, or an empty string if it is not set.
+func (o ConfigOverrides) AzureTrustedCAName() (string, error) {
+	if o.Storage == nil || o.Storage.Azure == nil || o.Storage.Azure.TrustedCA == nil {
+		return "", nil
+	}
+	name := o.Storage.Azure.TrustedCA.Name
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid name %q: %s", name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// AzureTagSync makes the operator keep the tags of a managed storage account
+// in sync with the user-defined tags of the cluster.
+type AzureTagSync struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// IntervalSeconds is the time between two synchronizations of the
+	// tags, at least 300. It defaults to one hour.
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// AzureTagSync returns whether the tags of the Azure storage account are kept
+// in sync, and the number of seconds between two synchronizations.
+func (o ConfigOverrides) AzureTagSync() (bool, int32, error) {
+	if o.Storage == nil || o.Storage.Azure == nil || o.Storage.Azure.TagSync == nil {
+		return false, 0, nil
+	}
+	tagSync := o.Storage.Azure.TagSync
+	if tagSync.IntervalSeconds == 0 {
+		return tagSync.Enabled, defaults.AzureTagSyncIntervalSeconds, nil
+	}
+	if tagSync.IntervalSeconds < 300 {
+		return false, 0, fmt.Errorf("intervalSeconds must be at least 300, got %d", tagSync.IntervalSeconds)
+	}
+	return tagSync.Enabled, tagSync.IntervalSeconds, nil
+}
+
+// GCSOverrides holds settings of the GCS storage driver.
+type GCSOverrides struct {
+	LabelSync *GCSLabelSync `json:"labelSync,omitempty"`
+}
+
+// GCSLabelSync makes the operator keep the labels of a managed bucket in sync
+// with the user-defined labels of the cluster.
+type GCSLabelSync struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// IntervalSeconds is the time between two synchronizations of the
+	// labels, at least 300. It defaults to one hour.
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// GCSLabelSync returns whether the labels of the GCS bucket are kept in sync,
+// and the number of seconds between two synchronizations.
+func (o ConfigOverrides) GCSLabelSync() (bool, int32, error) {
+	if o.Storage == nil || o.Storage.GCS == nil || o.Storage.GCS.LabelSync == nil {
+		return false, 0, nil
+	}
+	labelSync := o.Storage.GCS.LabelSync
+	if labelSync.IntervalSeconds == 0 {
+		return labelSync.Enabled, defaults.GCSLabelSyncIntervalSeconds, nil
+	}
+	if labelSync.IntervalSeconds < 300 {
+		return false, 0, fmt.Errorf("intervalSeconds must be at least 300, got %d", labelSync.IntervalSeconds)
+	}
+	return labelSync.Enabled, labelSync.IntervalSeconds, nil
+}
+
+// PVCOverrides holds settings of the PVC storage driver.
+type PVCOverrides struct {
+	HealthProbe *PVCHealthProbe `json:"healthProbe,omitempty"`
+}
+
+// PVCHealthProbe makes the operator check periodically that files can be
+// written to and read back from the claim of the registry, as NFS volumes
+// can go stale while they stay mounted.
+type PVCHealthProbe struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// IntervalSeconds is the time between two probes, at least 60. It
+	// defaults to 5 minutes.
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+	// TimeoutSeconds is the time a probe has to complete, from 10 to 600.
+	// It defaults to one minute.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// PVCHealthProbe returns whether the claim of the registry is probed, the
+// number of seconds between two probes, and the number of seconds a probe
+// has to complete.
+func (o ConfigOverrides) PVCHealthProbe() (enabled bool, intervalSeconds, timeoutSeconds int32, err error) {
+	if o.Storage == nil || o.Storage.PVC == nil || o.Storage.PVC.HealthProbe == nil || !o.Storage.PVC.HealthProbe.Enabled {
+		return false, 0, 0, nil
+	}
+	probe := o.Storage.PVC.HealthProbe
+	intervalSeconds, timeoutSeconds = probe.IntervalSeconds, probe.TimeoutSeconds
+	if intervalSeconds == 0 {
+		intervalSeconds = defaults.PVCHealthProbeIntervalSeconds
+	}
+	if timeoutSeconds == 0 {
+		timeoutSeconds = defaults.PVCHealthProbeTimeoutSeconds
+	}
+	if intervalSeconds < 60 {
+		return false, 0, 0, fmt.Errorf("intervalSeconds must be at least 60, got %d", intervalSeconds)
+	}
+	if timeoutSeconds < 10 || timeoutSeconds > 600 {
+		return false, 0, 0, fmt.Errorf("timeoutSeconds must be between 10 and 600, got %d", timeoutSeconds)
+	}
+	return true, intervalSeconds, timeoutSeconds, nil
+}
+
+// AzureSoftDelete configures the retention of the deleted blobs and of the
+// deleted containers of a managed storage account.
+type AzureSoftDelete struct {
+	// BlobRetentionDays is the number of days deleted blobs are kept, from
+	// 1 to 365. Zero leaves the blob soft delete of the account unchanged.
+	BlobRetentionDays int32 `json:"blobRetentionDays,omitempty"`
+	// ContainerRetentionDays is the number of days deleted containers are
+	// kept, from 1 to 365. Zero leaves the container soft delete of the
+	// account unchanged.
+	ContainerRetentionDays int32 `json:"containerRetentionDays,omitempty"`
+}
+
+// AzureSoftDelete returns the soft delete settings of the Azure storage, or
+// nil if they are not set.
+func (o ConfigOverrides) AzureSoftDelete() (*AzureSoftDelete, error) {
+	if o.Storage == nil || o.Storage.Azure == nil || o.Storage.Azure.SoftDelete == nil {
+		return nil, nil
+	}
+	softDelete := o.Storage.Azure.SoftDelete
+	if softDelete.BlobRetentionDays < 0 || softDelete.BlobRetentionDays > 365 {
+		return nil, fmt.Errorf("blobRetentionDays must be between 1 and 365, or 0 to leave it unchanged, got %d", softDelete.BlobRetentionDays)
+	}
+	if softDelete.ContainerRetentionDays < 0 || softDelete.ContainerRetentionDays > 365 {
+		return nil, fmt.Errorf("containerRetentionDays must be between 1 and 365, or 0 to leave it unchanged, got %d", softDelete.ContainerRetentionDays)
+	}
+	if softDelete.BlobRetentionDays == 0 && softDelete.ContainerRetentionDays == 0 {
+		return nil, nil
+	}
+	return softDelete, nil
+}
+
+// AzureNetworkAccessOverrides extends spec.storage.azure.networkAccess.
+type AzureNetworkAccessOverrides struct {
+	Internal *AzureNetworkAccessInternalOverrides `json:"internal,omitempty"`
+}
+
+// AzureNetworkAccessInternalOverrides extends
+// spec.storage.azure.networkAccess.internal.
+type AzureNetworkAccessInternalOverrides struct {
+	PrivateDNS *AzurePrivateDNS `json:"privateDNS,omitempty"`
+	// SharedPrivateEndpointID is the resource ID of an existing private
+	// endpoint of the storage account that is shared by several clusters,
+	// for example
+	// /subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Network/privateEndpoints/<name>
+	// The operator checks that the endpoint is connected to the storage
+	// account, it never creates or deletes it, nor the private DNS.
+	SharedPrivateEndpointID string `json:"sharedPrivateEndpointID,omitempty"`
+}
+
+// AzurePrivateDNSMode defines who manages the private DNS zone used to
+// resolve the private endpoint of the storage account.
+type AzurePrivateDNSMode string
+
+const (
+	// AzurePrivateDNSModeManaged makes the operator create the private DNS
+	// zone, the record set and the virtual network link. This is the
+	// default.
+	AzurePrivateDNSModeManaged AzurePrivateDNSMode = "Managed"
+	// AzurePrivateDNSModeUnmanaged makes the operator skip the DNS
+	// configuration, it is managed by the administrator.
+	AzurePrivateDNSModeUnmanaged AzurePrivateDNSMode = "Unmanaged"
+	// AzurePrivateDNSModeExistingZone makes the operator register the
+	// private endpoint in an existing private DNS zone.
+	AzurePrivateDNSModeExistingZone AzurePrivateDNSMode = "ExistingZone"
+)
+
+// AzurePrivateDNS configures the private DNS of the storage account private
+// endpoint. It is recorded in the tags of the private endpoint when the
+// endpoint is created, the removal of the storage cleans up the private DNS
+// it was registered in.
+type AzurePrivateDNS struct {
+	Mode AzurePrivateDNSMode `json:"mode,omitempty"`
+	// ExistingZoneID is the resource ID of the private DNS zone to use in
+	// the ExistingZone mode, for example
+	// /subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Network/privateDnsZones/privatelink.blob.core.windows.net
+	ExistingZoneID string `json:"existingZoneID,omitempty"`
+}
+
+// AzurePrivateDNS returns the private DNS configuration of the Azure storage,
+// or nil if it is not set.
+func (o ConfigOverrides) AzurePrivateDNS() *AzurePrivateDNS {
+	if o.Storage == nil || o.Storage.Azure == nil || o.Storage.Azure.NetworkAccess == nil || o.Storage.Azure.NetworkAccess.Internal == nil {
+		return nil
+	}
+	return o.Storage.Azure.NetworkAccess.Internal.PrivateDNS
+}
+
+// AzureSharedPrivateEndpointID returns the resource ID of the shared private
+// endpoint of the Azure storage, or an empty string if it is not set.
+func (o ConfigOverrides) AzureSharedPrivateEndpointID() string {
+	if o.Storage == nil || o.Storage.Azure == nil || o.Storage.Azure.NetworkAccess == nil || o.Storage.Azure.NetworkAccess.Internal == nil {
+		return ""
+	}
+	return o.Storage.Azure.NetworkAccess.Internal.SharedPrivateEndpointID
+}
+
+// RGWOverrides makes the operator provision the S3 bucket of the registry on
+// Ceph RADOS Gateway through an ObjectBucketClaim.
+type RGWOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// StorageClassName is the storage class of the claim. It defaults to
+	// the storage class of the Ceph bucket provisioner found in the
+	// cluster.
+	StorageClassName string `json:"storageClassName,omitempty"`
+}
+
+// RGWBucketClaim returns the settings of the ObjectBucketClaim of the
+// registry bucket, or nil if the bucket is not provisioned through a claim.
+func (o ConfigOverrides) RGWBucketClaim() *RGWOverrides {
+	if o.Storage == nil || o.Storage.RGW == nil || !o.Storage.RGW.Enabled {
+		return nil
+	}
+	return o.Storage.RGW
+}
+
+// StorageMirror returns the secondary storage the operator provisions as a
+// copy target for the registry storage, or nil if the storage is not mirrored. The mirror is an S3,
+// GCS, Azure or Swift storage whose bucket or container is named, the
+// operator does not generate its name.
+func (o ConfigOverrides) StorageMirror() (*imageregistryv1.ImageRegistryConfigStorage, error) {
+	if o.Storage == nil || o.Storage.Mirror == nil {
+		return nil, nil
+	}
+	mirror := o.Storage.Mirror
+	if mirror.EmptyDir != nil || mirror.PVC != nil || mirror.IBMCOS != nil || mirror.OSS != nil {
+		return nil, fmt.Errorf("the mirror must be an s3, gcs, azure or swift storage")
+	}
+	var configured []string
+	var name string
+	if mirror.S3 != nil {
+		configured = append(configured, "s3")
+		name = mirror.S3.Bucket
+	}
+	if mirror.GCS != nil {
+		configured = append(configured, "gcs")
+		name = mirror.GCS.Bucket
+	}
+	if mirror.Azure != nil {
+		configured = append(configured, "azure")
+		name = mirror.Azure.Container
+		if mirror.Azure.AccountName == "" {
+			name = ""
+		}
+	}
+	if mirror.Swift != nil {
+		configured = append(configured, "swift")
+		name = mirror.Swift.Container
+	}
+	if len(configured) != 1 {
+		return nil, fmt.Errorf("exactly one storage type must be configured for the mirror, got %d: %v", len(configured), configured)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("the %s mirror must name its bucket, or its account and container", configured[0])
+	}
+	return mirror, nil
+}
+
+// Parse decodes the unsupported config overrides of cr.
+func Parse(cr *imageregistryv1.Config) (ConfigOverrides, error) {
+	return ParseRaw(cr.Spec.UnsupportedConfigOverrides.Raw)
+}
+
+// ParseRaw decodes the raw unsupported config overrides, for the controllers
+// that only see the operator spec of the Config.
+func ParseRaw(rawoverrides []byte) (ConfigOverrides, error) {
+	var overrides ConfigOverrides
+	if len(rawoverrides) == 0 {
+		return overrides, nil
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return overrides, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	return overrides, nil
+}
@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// TestAzurePathFixJobAzureStackHub checks that the job gets everything the
+// move-blobs command needs to recreate the environment file of an Azure
+// Stack Hub cluster.
+func TestAzurePathFixJobAzureStackHub(t *testing.T) {
+	const endpoints = `{"name":"AzureStackCloud","resourceManagerEndpoint":"https://management.local.azurestack.external/","storageEndpointSuffix":"local.azurestack.external"}`
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", "/tmp/azurestackcloud.json")
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+					CloudName:         configv1.AzureStackCloud,
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_tenant_id":       []byte("tenant_id"),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+		},
+	})
+	builder.AddConfigMaps(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cloud-provider-config",
+			Namespace: defaults.OpenShiftConfigNamespace,
+		},
+		Data: map[string]string{
+			"endpoints": endpoints,
+		},
+	})
+	listers := builder.BuildListers()
+
+	cr := &imageregistryv1.Config{
+		Status: imageregistryv1.ImageRegistryStatus{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+					AccountName: "imageregistryash",
+					Container:   "registry",
+					CloudName:   string(configv1.AzureStackCloud),
+				},
+			},
+		},
+	}
+
+	gen := NewGeneratorAzurePathFixJob(nil, nil, listers.Secrets, listers.Infrastructures, listers.ProxyConfigs, listers.OpenShiftConfig, cr, nil)
+	obj, err := gen.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{}
+	for _, e := range obj.(*batchv1.Job).Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	for name, value := range map[string]string{
+		"AZURE_ENVIRONMENT":              string(configv1.AzureStackCloud),
+		"AZURE_ENVIRONMENT_FILEPATH":     "/tmp/azurestackcloud.json",
+		"AZURE_ENVIRONMENT_FILECONTENTS": endpoints,
+		"AZURE_STORAGE_ACCOUNT_NAME":     "imageregistryash",
+		"AZURE_CONTAINER_NAME":           "registry",
+	} {
+		if env[name] != value {
+			t.Errorf("expected %s=%q, got %q", name, value, env[name])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsapi "k8s.io/api/apps/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/pvc"
+)
+
+const (
+	veleroPreHookContainerAnnotation = "pre.hook.backup.velero.io/container"
+	veleroPreHookCommandAnnotation   = "pre.hook.backup.velero.io/command"
+	veleroPreHookTimeoutAnnotation   = "pre.hook.backup.velero.io/timeout"
+
+	defaultBackupQuiesceTimeoutSeconds = 300
+)
+
+// quiesceCommand returns a command that waits until no upload has been
+// written to the filesystem storage for a minute, and then flushes it. It
+// fails if the uploads do not settle within timeoutSeconds.
+func quiesceCommand(timeoutSeconds int32) []string {
+	script := fmt.Sprintf(
+		`deadline=$(($(date +%%s)+%d)); `+
+			`while [ -n "$(find %s -path '*/_uploads/*' -mmin -1 -print -quit 2>/dev/null)" ]; do `+
+			`if [ "$(date +%%s)" -ge "$deadline" ]; then echo "uploads are still in progress" >&2; exit 1; fi; `+
+			`sleep 5; done; sync`,
+		timeoutSeconds, pvc.RootDirectory,
+	)
+	return []string{"/bin/sh", "-c", script}
+}
+
+// applyBackupPolicy labels or annotates deploy and its pod template for
+// cluster backup tools according to the backup overrides of cr.
+func applyBackupPolicy(deploy *appsapi.Deployment, cr *imageregistryv1.Config, configOverrides overrides.ConfigOverrides) error {
+	policy, err := configOverrides.BackupPolicy()
+	if err != nil {
+		return err
+	}
+	switch policy {
+	case overrides.BackupPolicyNone:
+		return nil
+	case overrides.BackupPolicyExclude:
+		// The labels of the deployment and its template may be shared
+		// with other objects, they are copied before they are modified.
+		deploy.Labels = withLabel(deploy.Labels, defaults.BackupExcludeLabel, "true")
+		deploy.Spec.Template.Labels = withLabel(deploy.Spec.Template.Labels, defaults.BackupExcludeLabel, "true")
+		return nil
+	case overrides.BackupPolicyIncludeWithHooks:
+		// Only the filesystem storage is backed up with the pods, object
+		// storage is outside of the cluster.
+		if cr.Spec.Storage.PVC == nil {
+			return nil
+		}
+		timeoutSeconds := configOverrides.Backup.QuiesceTimeoutSeconds
+		if timeoutSeconds <= 0 {
+			timeoutSeconds = defaultBackupQuiesceTimeoutSeconds
+		}
+		command, err := json.Marshal(quiesceCommand(timeoutSeconds))
+		if err != nil {
+			return err
+		}
+		if deploy.Spec.Template.Annotations == nil {
+			deploy.Spec.Template.Annotations = map[string]string{}
+		}
+		deploy.Spec.Template.Annotations[veleroPreHookContainerAnnotation] = deploy.Spec.Template.Spec.Containers[0].Name
+		deploy.Spec.Template.Annotations[veleroPreHookCommandAnnotation] = string(command)
+		// Give the hook some time to flush the filesystem after the
+		// uploads have settled.
+		deploy.Spec.Template.Annotations[veleroPreHookTimeoutAnnotation] = fmt.Sprintf("%ds", timeoutSeconds+30)
+		return nil
+	default:
+		return fmt.Errorf("unsupported backup policy %q", policy)
+	}
+}
+
+func withLabel(labels map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
@@ -0,0 +1,129 @@
+package resource
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestApplyBackupPolicy(t *testing.T) {
+	pvcStorage := imageregistryv1.ImageRegistryConfigStorage{
+		PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{Claim: "image-registry-storage"},
+	}
+	s3Storage := imageregistryv1.ImageRegistryConfigStorage{
+		S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "bucket"},
+	}
+
+	for _, tt := range []struct {
+		name        string
+		storage     imageregistryv1.ImageRegistryConfigStorage
+		backup      *overrides.BackupOverrides
+		excluded    bool
+		hookTimeout string
+		err         string
+	}{
+		{
+			name:    "no backup policy",
+			storage: pvcStorage,
+		},
+		{
+			name:     "exclude",
+			storage:  s3Storage,
+			backup:   &overrides.BackupOverrides{Policy: overrides.BackupPolicyExclude},
+			excluded: true,
+		},
+		{
+			name:        "hooks with the default timeout",
+			storage:     pvcStorage,
+			backup:      &overrides.BackupOverrides{Policy: overrides.BackupPolicyIncludeWithHooks},
+			hookTimeout: "330s",
+		},
+		{
+			name:        "hooks with a custom timeout",
+			storage:     pvcStorage,
+			backup:      &overrides.BackupOverrides{Policy: overrides.BackupPolicyIncludeWithHooks, QuiesceTimeoutSeconds: 60},
+			hookTimeout: "90s",
+		},
+		{
+			name:    "no hooks for object storage",
+			storage: s3Storage,
+			backup:  &overrides.BackupOverrides{Policy: overrides.BackupPolicyIncludeWithHooks},
+		},
+		{
+			name:    "unsupported policy",
+			storage: pvcStorage,
+			backup:  &overrides.BackupOverrides{Policy: "Snapshot"},
+			err:     `unsupported backup policy "Snapshot"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: tt.storage,
+				},
+			}
+			deploy := &appsapi.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: defaults.DeploymentLabels,
+				},
+				Spec: appsapi.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: defaults.DeploymentLabels,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "registry"}},
+						},
+					},
+				},
+			}
+
+			err := applyBackupPolicy(deploy, cr, overrides.ConfigOverrides{Backup: tt.backup})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := defaults.DeploymentLabels[defaults.BackupExcludeLabel]; ok {
+				t.Fatalf("the default deployment labels were modified")
+			}
+			for _, labels := range []map[string]string{deploy.Labels, deploy.Spec.Template.Labels} {
+				if _, excluded := labels[defaults.BackupExcludeLabel]; excluded != tt.excluded {
+					t.Errorf("expected excluded %t, got labels %v", tt.excluded, labels)
+				}
+			}
+
+			annotations := deploy.Spec.Template.Annotations
+			if annotations[veleroPreHookTimeoutAnnotation] != tt.hookTimeout {
+				t.Errorf("expected hook timeout %q, got %q", tt.hookTimeout, annotations[veleroPreHookTimeoutAnnotation])
+			}
+			if tt.hookTimeout == "" {
+				return
+			}
+			if annotations[veleroPreHookContainerAnnotation] != "registry" {
+				t.Errorf("expected the hook to run in the registry container, got %q", annotations[veleroPreHookContainerAnnotation])
+			}
+			var command []string
+			if err := json.Unmarshal([]byte(annotations[veleroPreHookCommandAnnotation]), &command); err != nil {
+				t.Fatalf("unable to decode the hook command: %v", err)
+			}
+			if len(command) != 3 || !strings.Contains(command[2], "/registry") {
+				t.Errorf("unexpected hook command %q", command)
+			}
+		})
+	}
+}
@@ -94,8 +94,11 @@ func (gcac *generatorCAConfig) storageDriver() (storage.Driver, bool, error) {
 	} else if err != nil {
 		return nil, false, err
 	}
+	if err := configureStorageDriver(imageRegistryConfig, driver); err != nil {
+		return nil, false, err
+	}
 
-	canRedirect := !imageRegistryConfig.Spec.DisableRedirect
+	canRedirect := !imageRegistryConfig.Spec.DisableRedirect && driver.Capabilities().SupportsRedirect
 
 	return driver, canRedirect, nil
 }
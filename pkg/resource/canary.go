@@ -0,0 +1,379 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appsset "k8s.io/client-go/kubernetes/typed/apps/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	defaultCanaryTimeoutSeconds = 300
+
+	// canaryRetryInterval is the time after which a pod template whose
+	// canary replica failed is tried again, in case the failure was caused
+	// by a transient problem of the storage or of the network.
+	canaryRetryInterval = 30 * time.Minute
+)
+
+// canaryProbeRepository is the repository the canary probe pushes the test
+// blob canaryProbeBlob to. The content of the blob is fixed, so the probes of
+// all canary replicas share a single blob in the storage.
+var (
+	canaryProbeRepository = defaults.ImageRegistryOperatorNamespace + "/canary-probe"
+	canaryProbeBlob       = []byte("openshift image registry canary probe\n")
+)
+
+// canaryProbe runs a self-test against a canary pod that is ready.
+type canaryProbe func(ctx context.Context, pod *corev1.Pod) error
+
+// canaryRollout starts a single replica with a new pod template next to the
+// existing registry replicas and decides whether the template can be rolled
+// out. The state of the rollout is kept in the canary deployment, so the
+// decision is made over several syncs.
+type canaryRollout struct {
+	eventRecorder  events.Recorder
+	lister         appslisters.DeploymentNamespaceLister
+	client         appsset.AppsV1Interface
+	coreClient     coreset.CoreV1Interface
+	probe          canaryProbe
+	timeoutSeconds int32
+	now            func() time.Time
+}
+
+func newCanaryRollout(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, client appsset.AppsV1Interface, coreClient coreset.CoreV1Interface, kubeconfig *rest.Config, timeoutSeconds int32) *canaryRollout {
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = defaultCanaryTimeoutSeconds
+	}
+	return &canaryRollout{
+		eventRecorder:  eventRecorder,
+		lister:         lister,
+		client:         client,
+		coreClient:     coreClient,
+		probe:          newRegistryProbe(configMapLister, kubeconfig),
+		timeoutSeconds: timeoutSeconds,
+		now:            time.Now,
+	}
+}
+
+// canaryNeeded returns true if replacing cur with exp changes the pod
+// template of running replicas. Deployments with the Recreate strategy are
+// excluded as their storage cannot be shared with an extra replica.
+func canaryNeeded(cur, exp *appsapi.Deployment) bool {
+	if cur.Spec.Replicas != nil && *cur.Spec.Replicas == 0 {
+		return false
+	}
+	if exp.Spec.Strategy.Type == appsapi.RecreateDeploymentStrategyType {
+		return false
+	}
+	return cur.Annotations[defaults.TemplateChecksumAnnotation] != exp.Annotations[defaults.TemplateChecksumAnnotation]
+}
+
+// Gate returns true when the pod template of exp has been verified by the
+// canary replica and can be rolled out. While the canary is starting, it
+// returns false and no error. When the canary replica fails, the registry
+// replicas keep their current template: Gate returns false until the
+// template is tried again after canaryRetryInterval, the failure is reported
+// by the Degraded condition.
+func (c *canaryRollout) Gate(exp *appsapi.Deployment) (bool, error) {
+	checksum := exp.Annotations[defaults.TemplateChecksumAnnotation]
+
+	canary, err := c.lister.Get(defaults.ImageRegistryCanaryName)
+	if errors.IsNotFound(err) {
+		return false, c.start(nil, exp)
+	} else if err != nil {
+		return false, err
+	}
+
+	if canary.Annotations[defaults.TemplateChecksumAnnotation] != checksum {
+		return false, c.start(canary.DeepCopy(), exp)
+	}
+
+	if reason, failed := canary.Annotations[defaults.CanaryFailureAnnotation]; failed {
+		failedAt, err := time.Parse(time.RFC3339, canary.Annotations[defaults.CanaryFailureTimeAnnotation])
+		if err == nil && c.now().Before(failedAt.Add(canaryRetryInterval)) {
+			return false, nil
+		}
+		klog.Infof("retrying the canary replica for pod template %s, it failed: %s", checksum, reason)
+		return false, c.start(canary.DeepCopy(), exp)
+	}
+
+	if canary.Status.ObservedGeneration < canary.Generation {
+		return false, nil
+	}
+
+	for _, cond := range canary.Status.Conditions {
+		if cond.Type == appsapi.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, c.fail(canary.DeepCopy(), fmt.Sprintf("the canary replica did not become available within %d seconds", c.timeoutSeconds))
+		}
+	}
+
+	if canary.Status.UpdatedReplicas < 1 || canary.Status.AvailableReplicas < 1 {
+		return false, nil
+	}
+
+	pod, err := c.readyPod()
+	if err != nil {
+		return false, err
+	}
+	if pod == nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+	if err := c.probe(ctx, pod); err != nil {
+		return false, c.fail(canary.DeepCopy(), fmt.Sprintf("self-test failed: %s", err))
+	}
+
+	klog.Infof("canary replica %s passed its checks, rolling out pod template %s", pod.Name, checksum)
+	return true, nil
+}
+
+// Remove deletes the canary deployment if it exists.
+func (c *canaryRollout) Remove() error {
+	if _, err := c.lister.Get(defaults.ImageRegistryCanaryName); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err := c.client.Deployments(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.ImageRegistryCanaryName, metav1.DeleteOptions{
+			PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+		},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *canaryRollout) expected(exp *appsapi.Deployment) *appsapi.Deployment {
+	template := exp.Spec.Template.DeepCopy()
+	template.Labels = map[string]string{}
+	for k, v := range defaults.CanaryLabels {
+		template.Labels[k] = v
+	}
+	// The canary replica runs next to the existing replicas, the rules that
+	// spread the registry replicas across nodes must not prevent it from
+	// being scheduled.
+	template.Spec.TopologySpreadConstraints = nil
+	if template.Spec.Affinity != nil {
+		template.Spec.Affinity.PodAntiAffinity = nil
+	}
+
+	return &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryCanaryName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Labels:    defaults.CanaryLabels,
+			Annotations: map[string]string{
+				defaults.TemplateChecksumAnnotation: exp.Annotations[defaults.TemplateChecksumAnnotation],
+			},
+		},
+		Spec: appsapi.DeploymentSpec{
+			ProgressDeadlineSeconds: ptr.To(c.timeoutSeconds),
+			Replicas:                ptr.To[int32](1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: defaults.CanaryLabels,
+			},
+			Template: *template,
+			Strategy: appsapi.DeploymentStrategy{
+				Type: appsapi.RecreateDeploymentStrategyType,
+			},
+		},
+	}
+}
+
+// start creates the canary deployment for exp, or replaces the template of
+// the existing canary deployment.
+func (c *canaryRollout) start(canary, exp *appsapi.Deployment) error {
+	n := c.expected(exp)
+	checksum := n.Annotations[defaults.TemplateChecksumAnnotation]
+
+	if canary == nil {
+		if _, err := c.client.Deployments(n.Namespace).Create(context.TODO(), n, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create canary deployment: %w", err)
+		}
+	} else {
+		canary.Labels = n.Labels
+		canary.Annotations = n.Annotations
+		canary.Spec = n.Spec
+		if _, err := c.client.Deployments(n.Namespace).Update(context.TODO(), canary, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("unable to update canary deployment: %w", err)
+		}
+	}
+
+	c.eventRecorder.Eventf("CanaryStarted", "Started a canary replica for the registry pod template %s", checksum)
+	return nil
+}
+
+// fail scales the canary deployment down and records reason on it, so the
+// same pod template is not tried again before canaryRetryInterval.
+func (c *canaryRollout) fail(canary *appsapi.Deployment, reason string) error {
+	if canary.Annotations == nil {
+		canary.Annotations = map[string]string{}
+	}
+	canary.Annotations[defaults.CanaryFailureAnnotation] = reason
+	canary.Annotations[defaults.CanaryFailureTimeAnnotation] = c.now().UTC().Format(time.RFC3339)
+	canary.Spec.Replicas = ptr.To[int32](0)
+	if _, err := c.client.Deployments(canary.Namespace).Update(context.TODO(), canary, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to scale down failed canary deployment: %w", err)
+	}
+
+	c.eventRecorder.Warningf("CanaryFailed", "The canary replica for the registry pod template %s failed: %s", canary.Annotations[defaults.TemplateChecksumAnnotation], reason)
+	return nil
+}
+
+// readyPod returns a ready canary pod, or nil if there is none.
+func (c *canaryRollout) readyPod() (*corev1.Pod, error) {
+	pods, err := c.coreClient.Pods(defaults.ImageRegistryOperatorNamespace).List(
+		context.TODO(), metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(defaults.CanaryLabels).String(),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list canary pods: %w", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" {
+			continue
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+				return pod, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// newRegistryProbe returns a probe that checks that the registry in a pod
+// serves requests. The health endpoint of the registry must answer, then the
+// probe pushes a small test blob with the credentials of the operator and
+// pulls it back, which checks that the registry can write to and read from
+// its storage.
+func newRegistryProbe(configMapLister corelisters.ConfigMapNamespaceLister, kubeconfig *rest.Config) canaryProbe {
+	return func(ctx context.Context, pod *corev1.Pod) error {
+		serviceCA, err := configMapLister.Get(defaults.ServiceCAName)
+		if err != nil {
+			return fmt.Errorf("unable to get service CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(serviceCA.Data["service-ca.crt"])) {
+			return fmt.Errorf("no certificates found in the service CA config map")
+		}
+
+		rt, err := transport.NewBearerAuthWithRefreshRoundTripper(
+			kubeconfig.BearerToken, kubeconfig.BearerTokenFile, &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    pool,
+					ServerName: fmt.Sprintf("%s.%s.svc", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace),
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: rt}
+
+		base := "https://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(defaults.ContainerPort))
+		resp, err := canaryRequest(ctx, client, http.MethodGet, base+defaults.HealthzRoute, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		return pushPullBlob(ctx, client, base)
+	}
+}
+
+// pushPullBlob uploads canaryProbeBlob to the registry at base in a single
+// request and downloads it again.
+func pushPullBlob(ctx context.Context, client *http.Client, base string) error {
+	dgst := fmt.Sprintf("sha256:%x", sha256.Sum256(canaryProbeBlob))
+
+	resp, err := canaryRequest(ctx, client, http.MethodPost, base+"/v2/"+canaryProbeRepository+"/blobs/uploads/", nil, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// The location of the upload can be an absolute URL with the public
+	// hostname of the registry, the upload must be finished on the canary
+	// replica itself.
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid location of the blob upload: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", dgst)
+	resp, err = canaryRequest(ctx, client, http.MethodPut, base+location.Path+"?"+query.Encode(), canaryProbeBlob, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = canaryRequest(ctx, client, http.MethodGet, base+"/v2/"+canaryProbeRepository+"/blobs/"+dgst, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	pulled, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to pull the test blob: %w", err)
+	}
+	if !bytes.Equal(pulled, canaryProbeBlob) {
+		return fmt.Errorf("the pulled test blob does not match the pushed one")
+	}
+	return nil
+}
+
+// canaryRequest sends a request to the canary replica and returns its
+// response if it has the status code.
+func canaryRequest(ctx context.Context, client *http.Client, method, target string, body []byte, code int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != code {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: unexpected status %s", method, req.URL.Path, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,354 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func testCanaryDeployment(checksum string, modify func(*appsapi.Deployment)) *appsapi.Deployment {
+	d := &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       defaults.ImageRegistryCanaryName,
+			Namespace:  defaults.ImageRegistryOperatorNamespace,
+			Generation: 1,
+			Annotations: map[string]string{
+				defaults.TemplateChecksumAnnotation: checksum,
+			},
+		},
+		Spec: appsapi.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+		},
+		Status: appsapi.DeploymentStatus{
+			ObservedGeneration: 1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+		},
+	}
+	if modify != nil {
+		modify(d)
+	}
+	return d
+}
+
+func testCanaryPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-registry-canary-1",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Labels:    defaults.CanaryLabels,
+		},
+		Status: corev1.PodStatus{
+			PodIP: "10.128.0.10",
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func TestCanaryGate(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	exp := &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.TemplateChecksumAnnotation: "sha256:new",
+			},
+		},
+		Spec: appsapi.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: defaults.DeploymentLabels,
+				},
+				Spec: corev1.PodSpec{
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name       string
+		canary     *appsapi.Deployment
+		probeErr   error
+		proceed    bool
+		verifyFunc func(t *testing.T, canary *appsapi.Deployment)
+	}{
+		{
+			name: "canary is started",
+			verifyFunc: func(t *testing.T, canary *appsapi.Deployment) {
+				if canary.Annotations[defaults.TemplateChecksumAnnotation] != "sha256:new" {
+					t.Errorf("unexpected canary annotations: %v", canary.Annotations)
+				}
+				if canary.Spec.Template.Labels["docker-registry"] != "canary" {
+					t.Errorf("canary pods must not be selected by the registry service, got labels %v", canary.Spec.Template.Labels)
+				}
+				if canary.Spec.Template.Spec.Affinity.PodAntiAffinity != nil {
+					t.Errorf("expected pod anti-affinity to be removed from the canary")
+				}
+				if *canary.Spec.Replicas != 1 {
+					t.Errorf("expected 1 canary replica, got %d", *canary.Spec.Replicas)
+				}
+			},
+		},
+		{
+			name:   "canary is restarted for a new template",
+			canary: testCanaryDeployment("sha256:old", nil),
+			verifyFunc: func(t *testing.T, canary *appsapi.Deployment) {
+				if canary.Annotations[defaults.TemplateChecksumAnnotation] != "sha256:new" {
+					t.Errorf("unexpected canary annotations: %v", canary.Annotations)
+				}
+			},
+		},
+		{
+			name: "canary is not available yet",
+			canary: testCanaryDeployment("sha256:new", func(d *appsapi.Deployment) {
+				d.Status.AvailableReplicas = 0
+			}),
+		},
+		{
+			name:    "canary passes",
+			canary:  testCanaryDeployment("sha256:new", nil),
+			proceed: true,
+		},
+		{
+			name:     "canary self-test fails",
+			canary:   testCanaryDeployment("sha256:new", nil),
+			probeErr: errors.New("storage unreachable"),
+			verifyFunc: func(t *testing.T, canary *appsapi.Deployment) {
+				if *canary.Spec.Replicas != 0 {
+					t.Errorf("expected the canary to be scaled down, got %d replicas", *canary.Spec.Replicas)
+				}
+				if _, ok := canary.Annotations[defaults.CanaryFailureAnnotation]; !ok {
+					t.Errorf("expected the failure to be recorded on the canary")
+				}
+				if canary.Annotations[defaults.CanaryFailureTimeAnnotation] != now.Format(time.RFC3339) {
+					t.Errorf("expected the time of the failure to be recorded on the canary, got %v", canary.Annotations)
+				}
+			},
+		},
+		{
+			name: "canary exceeds progress deadline",
+			canary: testCanaryDeployment("sha256:new", func(d *appsapi.Deployment) {
+				d.Status.AvailableReplicas = 0
+				d.Status.Conditions = []appsapi.DeploymentCondition{
+					{Type: appsapi.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+				}
+			}),
+			verifyFunc: func(t *testing.T, canary *appsapi.Deployment) {
+				if _, ok := canary.Annotations[defaults.CanaryFailureAnnotation]; !ok {
+					t.Errorf("expected the failure to be recorded on the canary")
+				}
+			},
+		},
+		{
+			name: "failed canary is not retried yet",
+			canary: testCanaryDeployment("sha256:new", func(d *appsapi.Deployment) {
+				d.Annotations[defaults.CanaryFailureAnnotation] = "self-test failed"
+				d.Annotations[defaults.CanaryFailureTimeAnnotation] = now.Add(-time.Minute).Format(time.RFC3339)
+				d.Spec.Replicas = ptr.To[int32](0)
+			}),
+			verifyFunc: func(t *testing.T, canary *appsapi.Deployment) {
+				if *canary.Spec.Replicas != 0 {
+					t.Errorf("expected the canary to stay scaled down, got %d replicas", *canary.Spec.Replicas)
+				}
+			},
+		},
+		{
+			name: "failed canary is retried",
+			canary: testCanaryDeployment("sha256:new", func(d *appsapi.Deployment) {
+				d.Annotations[defaults.CanaryFailureAnnotation] = "self-test failed"
+				d.Annotations[defaults.CanaryFailureTimeAnnotation] = now.Add(-canaryRetryInterval).Format(time.RFC3339)
+				d.Spec.Replicas = ptr.To[int32](0)
+			}),
+			verifyFunc: func(t *testing.T, canary *appsapi.Deployment) {
+				if *canary.Spec.Replicas != 1 {
+					t.Errorf("expected the canary to be scaled up, got %d replicas", *canary.Spec.Replicas)
+				}
+				if _, ok := canary.Annotations[defaults.CanaryFailureAnnotation]; ok {
+					t.Errorf("expected the failure to be cleared, got %v", canary.Annotations)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			objects := []runtime.Object{testCanaryPod()}
+			if tt.canary != nil {
+				if err := indexer.Add(tt.canary); err != nil {
+					t.Fatal(err)
+				}
+				objects = append(objects, tt.canary)
+			}
+			clientset := fake.NewSimpleClientset(objects...)
+
+			c := &canaryRollout{
+				eventRecorder: events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{}),
+				lister:        appslisters.NewDeploymentLister(indexer).Deployments(defaults.ImageRegistryOperatorNamespace),
+				client:        clientset.AppsV1(),
+				coreClient:    clientset.CoreV1(),
+				probe: func(ctx context.Context, pod *corev1.Pod) error {
+					return tt.probeErr
+				},
+				timeoutSeconds: defaultCanaryTimeoutSeconds,
+				now:            func() time.Time { return now },
+			}
+
+			proceed, err := c.Gate(exp)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if proceed != tt.proceed {
+				t.Errorf("expected proceed=%t, got %t", tt.proceed, proceed)
+			}
+
+			if tt.verifyFunc != nil {
+				canary, err := clientset.AppsV1().Deployments(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.ImageRegistryCanaryName, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.verifyFunc(t, canary)
+			}
+		})
+	}
+}
+
+func TestCanaryRemove(t *testing.T) {
+	canary := testCanaryDeployment("sha256:new", nil)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(canary); err != nil {
+		t.Fatal(err)
+	}
+	clientset := fake.NewSimpleClientset(canary)
+
+	c := &canaryRollout{
+		lister: appslisters.NewDeploymentLister(indexer).Deployments(defaults.ImageRegistryOperatorNamespace),
+		client: clientset.AppsV1(),
+	}
+	if err := c.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := clientset.AppsV1().Deployments(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.ImageRegistryCanaryName, metav1.GetOptions{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected the canary to be deleted, got %v", err)
+	}
+}
+
+func TestCanaryNeeded(t *testing.T) {
+	deployment := func(replicas int32, strategy appsapi.DeploymentStrategyType, checksum string) *appsapi.Deployment {
+		return &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{defaults.TemplateChecksumAnnotation: checksum},
+			},
+			Spec: appsapi.DeploymentSpec{
+				Replicas: ptr.To(replicas),
+				Strategy: appsapi.DeploymentStrategy{Type: strategy},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		cur, exp *appsapi.Deployment
+		expected bool
+	}{
+		{
+			name:     "template changed",
+			cur:      deployment(2, appsapi.RollingUpdateDeploymentStrategyType, "a"),
+			exp:      deployment(2, appsapi.RollingUpdateDeploymentStrategyType, "b"),
+			expected: true,
+		},
+		{
+			name: "template unchanged",
+			cur:  deployment(2, appsapi.RollingUpdateDeploymentStrategyType, "a"),
+			exp:  deployment(3, appsapi.RollingUpdateDeploymentStrategyType, "a"),
+		},
+		{
+			name: "no running replicas",
+			cur:  deployment(0, appsapi.RollingUpdateDeploymentStrategyType, "a"),
+			exp:  deployment(2, appsapi.RollingUpdateDeploymentStrategyType, "b"),
+		},
+		{
+			name: "recreate strategy",
+			cur:  deployment(1, appsapi.RecreateDeploymentStrategyType, "a"),
+			exp:  deployment(1, appsapi.RecreateDeploymentStrategyType, "b"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canaryNeeded(tt.cur, tt.exp); got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPushPullBlob(t *testing.T) {
+	blobs := map[string][]byte{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads := "/v2/" + canaryProbeRepository + "/blobs/uploads/"
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == uploads:
+			// the registry answers with its public hostname
+			w.Header().Set("Location", "https://image-registry.openshift-image-registry.svc:5000"+uploads+"1234?_state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == uploads+"1234":
+			if r.URL.Query().Get("_state") != "abc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet:
+			for dgst, body := range blobs {
+				if r.URL.Path == "/v2/"+canaryProbeRepository+"/blobs/"+dgst {
+					w.Write(body)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	if err := pushPullBlob(context.Background(), srv.Client(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 {
+		t.Errorf("expected the test blob to be pushed, got %d blobs", len(blobs))
+	}
+
+	// a registry that cannot write to its storage
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if err := pushPullBlob(context.Background(), srv.Client(), srv.URL); err == nil {
+		t.Error("expected an error when the push fails")
+	}
+}
@@ -0,0 +1,118 @@
+package resource
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// ConsistencyCheckContainerName is the name of the container of the
+// consistency check jobs, the report is read from its logs.
+const ConsistencyCheckContainerName = "consistency-check"
+
+var _ Mutator = &generatorConsistencyCheckCronJob{}
+
+type generatorConsistencyCheckCronJob struct {
+	lister     batchlisters.CronJobNamespaceLister
+	client     batchset.BatchV1Interface
+	deployment *appsv1.Deployment
+	check      *overrides.ConsistencyCheck
+}
+
+// NewGeneratorConsistencyCheckCronJob returns the generator of the cron job
+// that runs the check mode of the hard prune. The check only reads the
+// storage, its jobs run as soon as they are created.
+func NewGeneratorConsistencyCheckCronJob(
+	lister batchlisters.CronJobNamespaceLister,
+	client batchset.BatchV1Interface,
+	deployment *appsv1.Deployment,
+	check *overrides.ConsistencyCheck,
+) *generatorConsistencyCheckCronJob {
+	return &generatorConsistencyCheckCronJob{
+		lister:     lister,
+		client:     client,
+		deployment: deployment,
+		check:      check,
+	}
+}
+
+func (gcc *generatorConsistencyCheckCronJob) Type() runtime.Object {
+	return &batchv1.CronJob{}
+}
+
+func (gcc *generatorConsistencyCheckCronJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gcc *generatorConsistencyCheckCronJob) GetName() string {
+	return defaults.ConsistencyCheckCronJobName
+}
+
+func (gcc *generatorConsistencyCheckCronJob) expected() (runtime.Object, error) {
+	template, err := registryJobPodTemplate(gcc.deployment, ConsistencyCheckContainerName, "check")
+	if err != nil {
+		return nil, err
+	}
+
+	cj := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gcc.GetName(),
+			Namespace: gcc.GetNamespace(),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   gcc.check.Schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			FailedJobsHistoryLimit:     ptr.To[int32](3),
+			SuccessfulJobsHistoryLimit: ptr.To[int32](3),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"created-by": gcc.GetName()},
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: ptr.To[int32](0),
+					Template:     template,
+				},
+			},
+		},
+	}
+	return cj, nil
+}
+
+func (gcc *generatorConsistencyCheckCronJob) Get() (runtime.Object, error) {
+	return gcc.lister.Get(gcc.GetName())
+}
+
+func (gcc *generatorConsistencyCheckCronJob) Create() (runtime.Object, error) {
+	return commonCreate(gcc, func(obj runtime.Object) (runtime.Object, error) {
+		return gcc.client.CronJobs(gcc.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.CronJob), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gcc *generatorConsistencyCheckCronJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gcc, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gcc.client.CronJobs(gcc.GetNamespace()).Update(
+			context.TODO(), obj.(*batchv1.CronJob), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gcc *generatorConsistencyCheckCronJob) Delete(opts metav1.DeleteOptions) error {
+	return gcc.client.CronJobs(gcc.GetNamespace()).Delete(
+		context.TODO(), gcc.GetName(), opts,
+	)
+}
+
+func (gcc *generatorConsistencyCheckCronJob) Owned() bool {
+	return true
+}
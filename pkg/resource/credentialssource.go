@@ -0,0 +1,160 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+const (
+	secretsStoreCSIDriver = "secrets-store.csi.k8s.io"
+
+	// storageCredentialsMountPath is where the volume of the Secrets Store
+	// CSI driver is mounted in the registry pods.
+	storageCredentialsMountPath = "/var/run/secrets/storage-credentials"
+)
+
+var _ Mutator = &generatorCredentialsSecret{}
+
+// generatorCredentialsSecret copies a secret managed by an external secret
+// operator into the image-registry-private-configuration-user secret, where
+// the storage drivers read the user provided credentials from.
+type generatorCredentialsSecret struct {
+	lister     corelisters.SecretNamespaceLister
+	client     coreset.CoreV1Interface
+	sourceName string
+	// keys renames the keys of the source secret, the keys that are not
+	// in it are copied as they are.
+	keys map[string]string
+}
+
+func newGeneratorCredentialsSecret(lister corelisters.SecretNamespaceLister, client coreset.CoreV1Interface, sourceName string) *generatorCredentialsSecret {
+	return &generatorCredentialsSecret{
+		lister:     lister,
+		client:     client,
+		sourceName: sourceName,
+	}
+}
+
+func (gs *generatorCredentialsSecret) Type() runtime.Object {
+	return &corev1.Secret{}
+}
+
+func (gs *generatorCredentialsSecret) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gs *generatorCredentialsSecret) GetName() string {
+	return defaults.ImageRegistryPrivateConfigurationUser
+}
+
+func (gs *generatorCredentialsSecret) expected() (runtime.Object, error) {
+	source, err := gs.lister.Get(gs.sourceName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the storage credentials secret %s/%s: %w", gs.GetNamespace(), gs.sourceName, err)
+	}
+
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gs.GetName(),
+			Namespace: gs.GetNamespace(),
+			Labels:    map[string]string{defaults.GeneratedSecretLabel: "true"},
+			Annotations: map[string]string{
+				defaults.CredentialsSourceAnnotation: gs.sourceName,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{},
+	}
+	// The migration to the cluster credentials can be driven from the
+	// source secret as well.
+	if until, ok := source.Annotations[defaults.CredentialsMigrationUntilAnnotation]; ok {
+		sec.Annotations[defaults.CredentialsMigrationUntilAnnotation] = until
+	}
+	for k, v := range source.Data {
+		if key, ok := gs.keys[k]; ok {
+			k = key
+		}
+		sec.Data[k] = v
+	}
+	return sec, nil
+}
+
+func (gs *generatorCredentialsSecret) Get() (runtime.Object, error) {
+	return gs.lister.Get(gs.GetName())
+}
+
+func (gs *generatorCredentialsSecret) Create() (runtime.Object, error) {
+	return commonCreate(gs, func(obj runtime.Object) (runtime.Object, error) {
+		return gs.client.Secrets(gs.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.Secret), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gs *generatorCredentialsSecret) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gs, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gs.client.Secrets(gs.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.Secret), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gs *generatorCredentialsSecret) Delete(opts metav1.DeleteOptions) error {
+	return gs.client.Secrets(gs.GetNamespace()).Delete(
+		context.TODO(), gs.GetName(), opts,
+	)
+}
+
+// Owned returns false, the credentials are kept when the source is removed
+// from the configuration.
+func (gs *generatorCredentialsSecret) Owned() bool {
+	return false
+}
+
+// applyCredentialsSourceVolume mounts the volume of the Secrets Store CSI
+// driver into the pods of deploy when the storage credentials are sourced
+// from it. The driver synchronizes the secret with the credentials only
+// while a pod mounts the volume.
+func applyCredentialsSourceVolume(deploy *appsapi.Deployment, configOverrides overrides.ConfigOverrides) error {
+	source, err := configOverrides.StorageCredentialsSource()
+	if err != nil {
+		return err
+	}
+	if source == nil || source.SecretProviderClass == "" {
+		return nil
+	}
+
+	vol := corev1.Volume{
+		Name: "storage-credentials",
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{
+				Driver:   secretsStoreCSIDriver,
+				ReadOnly: ptr.To(true),
+				VolumeAttributes: map[string]string{
+					"secretProviderClass": source.SecretProviderClass,
+				},
+			},
+		},
+	}
+	template := &deploy.Spec.Template
+	template.Spec.Volumes = append(template.Spec.Volumes, vol)
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].VolumeMounts = append(template.Spec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      vol.Name,
+			MountPath: storageCredentialsMountPath,
+			ReadOnly:  true,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package resource
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestCredentialsSecretIsCopiedFromSource(t *testing.T) {
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "registry-credentials",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				"reconcile.external-secrets.io/data-hash":    "1234",
+				defaults.CredentialsMigrationUntilAnnotation: "2030-01-01T00:00:00Z",
+			},
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("access"),
+			"REGISTRY_STORAGE_S3_SECRETKEY": []byte("secret"),
+		},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(source); err != nil {
+		t.Fatal(err)
+	}
+	lister := corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+	client := fake.NewSimpleClientset()
+
+	gen := newGeneratorCredentialsSecret(lister, client.CoreV1(), source.Name)
+	if err := ApplyMutator(gen); err != nil {
+		t.Fatal(err)
+	}
+
+	sec, err := client.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(
+		context.Background(), defaults.ImageRegistryPrivateConfigurationUser, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sec.Data, source.Data) {
+		t.Errorf("expected data %v, got %v", source.Data, sec.Data)
+	}
+	if got := sec.Annotations[defaults.CredentialsSourceAnnotation]; got != source.Name {
+		t.Errorf("expected the source annotation %q, got %q", source.Name, got)
+	}
+	if got := sec.Annotations[defaults.CredentialsMigrationUntilAnnotation]; got != "2030-01-01T00:00:00Z" {
+		t.Errorf("expected the migration annotation to be copied, got %q", got)
+	}
+	if _, ok := sec.Annotations["reconcile.external-secrets.io/data-hash"]; ok {
+		t.Errorf("unexpected annotation of the external secret operator")
+	}
+
+	// A refreshed source is copied again.
+	if err := indexer.Add(sec); err != nil {
+		t.Fatal(err)
+	}
+	refreshed := source.DeepCopy()
+	refreshed.Data["REGISTRY_STORAGE_S3_SECRETKEY"] = []byte("rotated")
+	if err := indexer.Update(refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMutator(gen); err != nil {
+		t.Fatal(err)
+	}
+	sec, err = client.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(
+		context.Background(), defaults.ImageRegistryPrivateConfigurationUser, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(sec.Data["REGISTRY_STORAGE_S3_SECRETKEY"]); got != "rotated" {
+		t.Errorf("expected the rotated secret key, got %q", got)
+	}
+}
+
+func TestApplyCredentialsSourceVolume(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		credentials *overrides.StorageCredentialsOverrides
+		volume      bool
+		err         string
+	}{
+		{
+			name: "no credentials source",
+		},
+		{
+			name:        "external secret",
+			credentials: &overrides.StorageCredentialsOverrides{SecretName: "registry-credentials"},
+		},
+		{
+			name: "secrets store",
+			credentials: &overrides.StorageCredentialsOverrides{
+				SecretName:          "registry-credentials",
+				SecretProviderClass: "registry-storage",
+			},
+			volume: true,
+		},
+		{
+			name:        "secrets store without secret",
+			credentials: &overrides.StorageCredentialsOverrides{SecretProviderClass: "registry-storage"},
+			err:         "secretName is required",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy := &appsapi.Deployment{
+				Spec: appsapi.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "registry"}},
+						},
+					},
+				},
+			}
+
+			err := applyCredentialsSourceVolume(deploy, overrides.ConfigOverrides{
+				Storage: &overrides.StorageOverrides{Credentials: tt.credentials},
+			})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			volumes := deploy.Spec.Template.Spec.Volumes
+			if !tt.volume {
+				if len(volumes) != 0 {
+					t.Errorf("unexpected volumes %v", volumes)
+				}
+				return
+			}
+			if len(volumes) != 1 || volumes[0].CSI == nil || volumes[0].CSI.VolumeAttributes["secretProviderClass"] != "registry-storage" {
+				t.Fatalf("expected a secrets store volume, got %v", volumes)
+			}
+			mounts := deploy.Spec.Template.Spec.Containers[0].VolumeMounts
+			if len(mounts) != 1 || mounts[0].Name != volumes[0].Name || !mounts[0].ReadOnly {
+				t.Errorf("expected a read-only mount of the volume, got %v", mounts)
+			}
+		})
+	}
+}
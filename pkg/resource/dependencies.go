@@ -8,6 +8,7 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 )
 
@@ -40,6 +41,10 @@ func (d dependencies) Checksum(configMapLister corelisters.ConfigMapNamespaceLis
 	}
 	sort.Strings(names)
 	for _, name := range names {
+		if name == defaults.TrustedCAName {
+			// The trusted CA bundle has its own checksum, see trustedCAChecksum.
+			continue
+		}
 		cm, err := configMapLister.Get(name)
 		if errors.IsNotFound(err) {
 			// We may have optional dependencies.
@@ -84,3 +89,15 @@ func (d dependencies) Checksum(configMapLister corelisters.ConfigMapNamespaceLis
 
 	return strategy.Checksum(checksums)
 }
+
+// trustedCAChecksum returns the checksum of the cluster trusted CA bundle, or
+// an empty string if the bundle has not been injected yet.
+func trustedCAChecksum(configMapLister corelisters.ConfigMapNamespaceLister) (string, error) {
+	cm, err := configMapLister.Get(defaults.TrustedCAName)
+	if errors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strategy.Checksum(cm.Data)
+}
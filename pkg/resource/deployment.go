@@ -2,11 +2,12 @@ package resource
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	appsapi "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -14,6 +15,7 @@ import (
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	appslisters "k8s.io/client-go/listers/apps/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/utils/ptr"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -24,6 +26,7 @@ import (
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
@@ -39,10 +42,11 @@ type generatorDeployment struct {
 	coreClient      coreset.CoreV1Interface
 	client          appsset.AppsV1Interface
 	driver          storage.Driver
+	kubeconfig      *rest.Config
 	cr              *imageregistryv1.Config
 }
 
-func newGeneratorDeployment(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, secretLister corelisters.SecretNamespaceLister, proxyLister configlisters.ProxyLister, coreClient coreset.CoreV1Interface, client appsset.AppsV1Interface, driver storage.Driver, cr *imageregistryv1.Config) *generatorDeployment {
+func newGeneratorDeployment(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, secretLister corelisters.SecretNamespaceLister, proxyLister configlisters.ProxyLister, coreClient coreset.CoreV1Interface, client appsset.AppsV1Interface, driver storage.Driver, kubeconfig *rest.Config, cr *imageregistryv1.Config) *generatorDeployment {
 	return &generatorDeployment{
 		eventRecorder:   eventRecorder,
 		lister:          lister,
@@ -52,6 +56,7 @@ func newGeneratorDeployment(eventRecorder events.Recorder, lister appslisters.De
 		coreClient:      coreClient,
 		client:          client,
 		driver:          driver,
+		kubeconfig:      kubeconfig,
 		cr:              cr,
 	}
 }
@@ -95,7 +100,21 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 		podTemplateSpec.Annotations = map[string]string{}
 	}
 	podTemplateSpec.Annotations[defaults.ChecksumOperatorDepsAnnotation] = depsChecksum
-	podTemplateSpec.Annotations[securityv1.RequiredSCCAnnotation] = "restricted-v2"
+
+	caChecksum, err := trustedCAChecksum(gd.configMapLister)
+	if err != nil {
+		return nil, err
+	}
+	podTemplateSpec.Annotations[defaults.TrustedCAChecksumAnnotation] = caChecksum
+
+	configOverrides, err := overrides.Parse(gd.cr)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := registryReplicas(gd.cr, configOverrides)
+	if err != nil {
+		return nil, err
+	}
 
 	// Strategy defaults to RollingUpdate
 	deployStrategy := appsapi.DeploymentStrategyType(gd.cr.Spec.RolloutStrategy)
@@ -105,7 +124,7 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 
 	var rollingUpdate *appsapi.RollingUpdateDeployment
 	if deployStrategy == appsapi.RollingUpdateDeploymentStrategyType {
-		if gd.cr.Spec.Replicas == 2 {
+		if replicas == 2 {
 			maxUnavailable := intstr.Parse("1")
 			maxSurge := intstr.Parse("1")
 			rollingUpdate = &appsapi.RollingUpdateDeployment{
@@ -126,7 +145,7 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 			//
 			//  * 4 replicas out of 6 cannot fit onto 2 workers,
 			//  * 1 replica should be deleted before a new one can be created.
-			maxUnavailable := intstr.FromInt(int(gd.cr.Spec.Replicas) - 1)
+			maxUnavailable := intstr.FromInt(int(replicas) - 1)
 			maxSurge := intstr.FromString("25%")
 			rollingUpdate = &appsapi.RollingUpdateDeployment{
 				MaxUnavailable: &maxUnavailable,
@@ -134,6 +153,9 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 			}
 		}
 	}
+	if err := applyRollingUpdateOverrides(rollingUpdate, deployStrategy, gd.driver, configOverrides); err != nil {
+		return nil, err
+	}
 
 	deploy := &appsapi.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -146,7 +168,8 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 		},
 		Spec: appsapi.DeploymentSpec{
 			ProgressDeadlineSeconds: ptr.To[int32](60),
-			Replicas:                &gd.cr.Spec.Replicas,
+			RevisionHistoryLimit:    ptr.To[int32](defaults.RevisionHistoryLimit),
+			Replicas:                ptr.To(replicas),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: defaults.DeploymentLabels,
 			},
@@ -158,23 +181,46 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 		},
 	}
 
-	rawoverrides := gd.cr.Spec.UnsupportedConfigOverrides.Raw
-	if len(rawoverrides) > 0 {
-		var overrides ConfigOverrides
-		if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
-			return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	rollbackEnabled, progressDeadlineSeconds, err := configOverrides.AutoRollback()
+	if err != nil {
+		return nil, err
+	}
+	if rollbackEnabled {
+		if progressDeadlineSeconds == 0 {
+			progressDeadlineSeconds = defaultRollbackProgressDeadlineSeconds
 		}
+		deploy.Spec.ProgressDeadlineSeconds = ptr.To(progressDeadlineSeconds)
+	}
 
-		depoverrides := overrides.Deployment
-		if depoverrides != nil {
-			deploy.Spec.Template.Spec.RuntimeClassName = depoverrides.RuntimeClassName
-			for key, val := range depoverrides.Annotations {
-				deploy.Annotations[key] = val
-				deploy.Spec.Template.Annotations[key] = val
-			}
+	deploy.Spec.Template.Annotations[securityv1.RequiredSCCAnnotation] = configOverrides.RegistrySCC()
+
+	depoverrides := configOverrides.Deployment
+	if depoverrides != nil {
+		deploy.Spec.Template.Spec.RuntimeClassName = depoverrides.RuntimeClassName
+		for key, val := range depoverrides.Annotations {
+			deploy.Annotations[key] = val
+			deploy.Spec.Template.Annotations[key] = val
 		}
 	}
 
+	if err := applyBackupPolicy(deploy, gd.cr, configOverrides); err != nil {
+		return nil, err
+	}
+
+	if err := applyMeshPolicy(deploy, configOverrides); err != nil {
+		return nil, err
+	}
+
+	if err := applyCredentialsSourceVolume(deploy, configOverrides); err != nil {
+		return nil, err
+	}
+
+	templateDgst, err := strategy.Checksum(deploy.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	deploy.ObjectMeta.Annotations[defaults.TemplateChecksumAnnotation] = templateDgst
+
 	dgst, err := strategy.Checksum(deploy)
 	if err != nil {
 		return nil, err
@@ -184,6 +230,52 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 	return deploy, nil
 }
 
+// registryReplicas returns the number of replicas of the registry
+// deployment: spec.replicas, or the minimum of the autoscaler when the
+// registry is autoscaled.
+func registryReplicas(cr *imageregistryv1.Config, configOverrides overrides.ConfigOverrides) (int32, error) {
+	autoscaler, err := configOverrides.Autoscaler(cr.Spec.Replicas)
+	if err != nil {
+		return 0, err
+	}
+	if autoscaler != nil {
+		return autoscaler.MinReplicas, nil
+	}
+	return cr.Spec.Replicas, nil
+}
+
+// applyRollingUpdateOverrides sets the maxUnavailable and maxSurge of the
+// overrides on the rolling update parameters computed by the operator. They
+// are rejected with the Recreate strategy, and a surge is rejected when the
+// storage can not be written by the old and the new replicas at the same time.
+func applyRollingUpdateOverrides(rollingUpdate *appsapi.RollingUpdateDeployment, strategy appsapi.DeploymentStrategyType, driver storage.Driver, configOverrides overrides.ConfigOverrides) error {
+	maxUnavailable, maxSurge, err := configOverrides.RollingUpdate()
+	if err != nil {
+		return err
+	}
+	if maxUnavailable == nil && maxSurge == nil {
+		return nil
+	}
+	if rollingUpdate == nil {
+		return fmt.Errorf("maxUnavailable and maxSurge can not be used with the %s rollout strategy", strategy)
+	}
+	if maxSurge != nil {
+		if surge, _ := intstr.GetScaledValueFromIntOrPercent(maxSurge, 100, true); surge > 0 && !driver.Capabilities().MultiWriterSafe {
+			return fmt.Errorf("maxSurge must be 0, the storage can not be shared by the old and the new replicas")
+		}
+		rollingUpdate.MaxSurge = maxSurge
+	}
+	if maxUnavailable != nil {
+		rollingUpdate.MaxUnavailable = maxUnavailable
+	}
+	surge, _ := intstr.GetScaledValueFromIntOrPercent(rollingUpdate.MaxSurge, 100, true)
+	unavailable, _ := intstr.GetScaledValueFromIntOrPercent(rollingUpdate.MaxUnavailable, 100, true)
+	if surge == 0 && unavailable == 0 {
+		return fmt.Errorf("maxUnavailable and maxSurge must not both be 0, the rolling update could not make progress")
+	}
+	return nil
+}
+
 func (gd *generatorDeployment) Get() (runtime.Object, error) {
 	return gd.lister.Get(gd.GetName())
 }
@@ -211,8 +303,34 @@ func (gd *generatorDeployment) Update(o runtime.Object) (runtime.Object, bool, e
 		return o, false, err
 	}
 
+	expDeploy, err := gd.rollbackGate(o.(*appsapi.Deployment), exp.(*appsapi.Deployment))
+	if err != nil {
+		return o, false, err
+	}
+
+	configOverrides, err := overrides.Parse(gd.cr)
+	if err != nil {
+		return o, false, err
+	}
+	// the autoscaler owns the number of replicas, it is not reset.
+	if autoscaler, err := configOverrides.Autoscaler(gd.cr.Spec.Replicas); err != nil {
+		return o, false, err
+	} else if cur := o.(*appsapi.Deployment); autoscaler != nil && cur.Spec.Replicas != nil {
+		expDeploy.Spec.Replicas = ptr.To(*cur.Spec.Replicas)
+	}
+
+	proceed, err := maintenanceGate(gd.cr, configOverrides, o.(*appsapi.Deployment), expDeploy, time.Now())
+	if err != nil || !proceed {
+		return o, false, err
+	}
+
+	proceed, err = gd.canaryGate(o.(*appsapi.Deployment), expDeploy)
+	if err != nil || !proceed {
+		return o, false, err
+	}
+
 	dep, updated, err := resourceapply.ApplyDeployment(
-		context.TODO(), gd.client, gd.eventRecorder, exp.(*appsapi.Deployment), gd.LastGeneration(),
+		context.TODO(), gd.client, gd.eventRecorder, expDeploy, gd.LastGeneration(),
 	)
 	if err != nil {
 		return o, false, err
@@ -220,11 +338,97 @@ func (gd *generatorDeployment) Update(o runtime.Object) (runtime.Object, bool, e
 
 	if updated {
 		gd.UpdateLastGeneration(dep.ObjectMeta.Generation)
+
+		curCA := o.(*appsapi.Deployment).Spec.Template.Annotations[defaults.TrustedCAChecksumAnnotation]
+		if newCA := dep.Spec.Template.Annotations[defaults.TrustedCAChecksumAnnotation]; curCA != "" && curCA != newCA {
+			gd.eventRecorder.Eventf("TrustedCAChanged", "The cluster trusted CA bundle has changed, rolling out the registry")
+		}
 	}
 
 	return dep, updated, nil
 }
 
+// rollbackGate returns the deployment that should replace the current
+// deployment cur. When automatic rollbacks are enabled and the rollout of
+// the pod template of exp did not complete, the last known-good pod template
+// is used instead.
+func (gd *generatorDeployment) rollbackGate(cur, exp *appsapi.Deployment) (*appsapi.Deployment, error) {
+	configOverrides, err := overrides.Parse(gd.cr)
+	if err != nil {
+		return nil, err
+	}
+
+	rollback := newRollbackTracker(gd.eventRecorder, gd.configMapLister, gd.coreClient, gd.cr)
+	enabled, _, err := configOverrides.AutoRollback()
+	if err != nil {
+		return exp, err
+	}
+	if !enabled {
+		rollback.clearCondition()
+		return exp, rollback.Remove()
+	}
+	return rollback.Gate(cur, exp)
+}
+
+// canaryGate returns true if exp can replace the current deployment cur. When
+// canary rollouts are enabled, a changed pod template is rolled out only
+// after a canary replica with the new template has passed its checks.
+func (gd *generatorDeployment) canaryGate(cur, exp *appsapi.Deployment) (bool, error) {
+	configOverrides, err := overrides.Parse(gd.cr)
+	if err != nil {
+		return false, err
+	}
+
+	enabled, timeoutSeconds, err := configOverrides.Canary()
+	if err != nil {
+		return false, err
+	}
+	canary := newCanaryRollout(gd.eventRecorder, gd.lister, gd.configMapLister, gd.client, gd.coreClient, gd.kubeconfig, timeoutSeconds)
+
+	// the canary replica pushes a test blob, which cannot succeed while the
+	// storage rejects writes. The switch to read-only mode is not delayed.
+	if !enabled || !canaryNeeded(cur, exp) || storage.WritesFailing(gd.cr) {
+		return true, canary.Remove()
+	}
+
+	if configOverrides.TrustedCAReloadPolicy() == overrides.TrustedCAReloadImmediate {
+		caOnly, err := trustedCAOnlyChange(cur, exp)
+		if err != nil {
+			return false, err
+		}
+		if caOnly {
+			return true, canary.Remove()
+		}
+	}
+
+	proceed, err := canary.Gate(exp)
+	if err != nil || !proceed {
+		return false, err
+	}
+	return true, canary.Remove()
+}
+
+// trustedCAOnlyChange returns true if the pod template of exp differs from the
+// pod template of cur only by the trusted CA bundle.
+func trustedCAOnlyChange(cur, exp *appsapi.Deployment) (bool, error) {
+	curCA, ok := cur.Spec.Template.Annotations[defaults.TrustedCAChecksumAnnotation]
+	if ok && curCA == exp.Spec.Template.Annotations[defaults.TrustedCAChecksumAnnotation] {
+		return false, nil
+	}
+
+	template := exp.Spec.Template.DeepCopy()
+	if ok {
+		template.Annotations[defaults.TrustedCAChecksumAnnotation] = curCA
+	} else {
+		delete(template.Annotations, defaults.TrustedCAChecksumAnnotation)
+	}
+	dgst, err := strategy.Checksum(template)
+	if err != nil {
+		return false, err
+	}
+	return dgst == cur.Annotations[defaults.TemplateChecksumAnnotation], nil
+}
+
 func (gd *generatorDeployment) UpdateLastGeneration(lastGen int64) {
 	for i, gen := range gd.cr.Status.Generations {
 		if gen.Name == gd.GetName() &&
@@ -263,9 +467,27 @@ func (gd *generatorDeployment) LastGeneration() int64 {
 }
 
 func (gd *generatorDeployment) Delete(opts metav1.DeleteOptions) error {
-	return gd.client.Deployments(gd.GetNamespace()).Delete(
+	err := gd.client.Deployments(gd.GetNamespace()).Delete(
 		context.TODO(), gd.GetName(), opts,
 	)
+	if err != nil {
+		return err
+	}
+
+	err = gd.client.Deployments(gd.GetNamespace()).Delete(
+		context.TODO(), defaults.ImageRegistryCanaryName, opts,
+	)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	err = gd.coreClient.ConfigMaps(gd.GetNamespace()).Delete(
+		context.TODO(), defaults.RollbackConfigMapName, opts,
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 func (g *generatorDeployment) Owned() bool {
@@ -0,0 +1,353 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/s3"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// matrixSecretValue is the value of every secret configuration parameter in
+// the matrix, it must never be rendered into the deployment.
+const matrixSecretValue = "matrix-secret-value"
+
+// matrixPlatform is a cluster platform with its default storage.
+type matrixPlatform struct {
+	name    string
+	infra   *configv1.PlatformStatus
+	storage imageregistryv1.ImageRegistryConfigStorage
+	// env is the configuration of a stubbed storage driver, the real
+	// driver is used when it is nil.
+	env envvar.List
+}
+
+var matrixPlatforms = []matrixPlatform{
+	{
+		name: "aws",
+		infra: &configv1.PlatformStatus{
+			Type: configv1.AWSPlatformType,
+			AWS:  &configv1.AWSPlatformStatus{Region: "us-east-1"},
+		},
+		storage: imageregistryv1.ImageRegistryConfigStorage{
+			ManagementState: imageregistryv1.StorageManagementStateUnmanaged,
+			S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "bucket",
+				Region: "us-east-1",
+			},
+		},
+	},
+	{
+		name:  "azure",
+		infra: &configv1.PlatformStatus{Type: configv1.AzurePlatformType},
+		storage: imageregistryv1.ImageRegistryConfigStorage{
+			Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account", Container: "container"},
+		},
+		env: envvar.List{
+			{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: matrixSecretValue, Secret: true},
+			{Name: "REGISTRY_STORAGE", Value: "azure"},
+			{Name: "REGISTRY_STORAGE_AZURE_CONTAINER", Value: "container"},
+			{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTNAME", Value: "account"},
+		},
+	},
+	{
+		name:  "gcp",
+		infra: &configv1.PlatformStatus{Type: configv1.GCPPlatformType},
+		storage: imageregistryv1.ImageRegistryConfigStorage{
+			GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{Bucket: "bucket"},
+		},
+		env: envvar.List{
+			{Name: "REGISTRY_STORAGE", Value: "gcs"},
+			{Name: "REGISTRY_STORAGE_GCS_BUCKET", Value: "bucket"},
+			{Name: "REGISTRY_STORAGE_GCS_KEYFILE", Value: "/gcs/keyfile"},
+		},
+	},
+	{
+		name:  "openstack",
+		infra: &configv1.PlatformStatus{Type: configv1.OpenStackPlatformType},
+		storage: imageregistryv1.ImageRegistryConfigStorage{
+			Swift: &imageregistryv1.ImageRegistryConfigStorageSwift{Container: "container"},
+		},
+		env: envvar.List{
+			{Name: "REGISTRY_STORAGE", Value: "swift"},
+			{Name: "REGISTRY_STORAGE_SWIFT_CONTAINER", Value: "container"},
+			{Name: "REGISTRY_STORAGE_SWIFT_USERNAME", Value: matrixSecretValue, Secret: true},
+			{Name: "REGISTRY_STORAGE_SWIFT_PASSWORD", Value: matrixSecretValue, Secret: true},
+		},
+	},
+	{
+		name:  "none",
+		infra: &configv1.PlatformStatus{Type: configv1.NonePlatformType},
+		storage: imageregistryv1.ImageRegistryConfigStorage{
+			EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+		},
+	},
+}
+
+// matrixProxy is a cluster-wide or registry proxy configuration.
+type matrixProxy struct {
+	name    string
+	cluster *configv1.ProxyStatus
+	spec    imageregistryv1.ImageRegistryConfigProxy
+}
+
+var matrixProxies = []matrixProxy{
+	{name: "no-proxy"},
+	{
+		name: "cluster-proxy",
+		cluster: &configv1.ProxyStatus{
+			HTTPProxy:  "http://proxy.example.com:3128",
+			HTTPSProxy: "http://proxy.example.com:3128",
+			NoProxy:    ".cluster.local,.svc,10.0.0.0/16",
+		},
+	},
+	{
+		name: "cluster-proxy-ipv6",
+		cluster: &configv1.ProxyStatus{
+			HTTPProxy:  "http://[fd00::1]:3128",
+			HTTPSProxy: "http://[fd00::1]:3128",
+			NoProxy:    ".cluster.local,.svc,fd01::/48,fd02::/112",
+		},
+	},
+	{
+		name: "registry-proxy",
+		spec: imageregistryv1.ImageRegistryConfigProxy{
+			HTTP:    "http://registry-proxy.example.com:3128",
+			HTTPS:   "http://registry-proxy.example.com:3128",
+			NoProxy: ".svc",
+		},
+	},
+}
+
+// matrixRollout is a rollout strategy with a number of replicas.
+type matrixRollout struct {
+	name     string
+	strategy string
+	replicas int32
+}
+
+var matrixRollouts = []matrixRollout{
+	{name: "default-1", replicas: 1},
+	{name: "rolling-2", strategy: string(appsapi.RollingUpdateDeploymentStrategyType), replicas: 2},
+	{name: "rolling-3", strategy: string(appsapi.RollingUpdateDeploymentStrategyType), replicas: 3},
+	{name: "recreate-1", strategy: string(appsapi.RecreateDeploymentStrategyType), replicas: 1},
+}
+
+// TestDeploymentMatrix renders the registry deployment for every combination
+// of platform, proxy and rollout strategy and checks invariants that hold for
+// all of them.
+func TestDeploymentMatrix(t *testing.T) {
+	for _, platform := range matrixPlatforms {
+		for _, proxy := range matrixProxies {
+			for _, rollout := range matrixRollouts {
+				name := fmt.Sprintf("%s/%s/%s", platform.name, proxy.name, rollout.name)
+				t.Run(name, func(t *testing.T) {
+					deploy := renderMatrixDeployment(t, platform, proxy, rollout)
+					checkDeploymentInvariants(t, deploy, proxy, rollout)
+				})
+			}
+		}
+	}
+}
+
+func renderMatrixDeployment(t *testing.T, platform matrixPlatform, proxy matrixProxy, rollout matrixRollout) *appsapi.Deployment {
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			HTTPSecret:      "http-secret",
+			Replicas:        rollout.replicas,
+			RolloutStrategy: rollout.strategy,
+			Proxy:           proxy.spec,
+			Storage:         platform.storage,
+		},
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddRegistryOperatorConfig(cr)
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{Name: defaults.InfrastructureResourceName},
+		Status:     configv1.InfrastructureStatus{PlatformStatus: platform.infra},
+	})
+	if proxy.cluster != nil {
+		builder.AddProxyConfig(&configv1.Proxy{
+			ObjectMeta: metav1.ObjectMeta{Name: defaults.ClusterProxyResourceName},
+			Status:     *proxy.cluster,
+		})
+	}
+	builder.AddNamespaces(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfiguration,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte(matrixSecretValue),
+		},
+	})
+	builder.AddConfigMaps(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.TrustedCAName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string]string{"ca-bundle.crt": "bundle"},
+	})
+	fixture := builder.Build()
+
+	var driver storage.Driver
+	switch {
+	case platform.env != nil:
+		driver = &envDriver{env: platform.env}
+	case platform.storage.S3 != nil:
+		driver = s3.NewDriver(context.Background(), platform.storage.S3, &fixture.Listers.StorageListers, featuregates.NewHardcodedFeatureGateAccess(
+			[]configv1.FeatureGateName{util.TestFeatureGateName},
+			[]configv1.FeatureGateName{},
+		))
+	case platform.storage.EmptyDir != nil:
+		driver = emptydir.NewDriver(platform.storage.EmptyDir)
+	default:
+		t.Fatalf("no storage driver for the platform %s", platform.name)
+	}
+
+	gd := &generatorDeployment{
+		configMapLister: fixture.Listers.ConfigMaps,
+		secretLister:    fixture.Listers.Secrets,
+		proxyLister:     fixture.Listers.ProxyConfigs,
+		coreClient:      fixture.KubeClient.CoreV1(),
+		driver:          driver,
+		cr:              cr,
+	}
+	obj, err := gd.expected()
+	if err != nil {
+		t.Fatalf("unable to render the deployment: %v", err)
+	}
+	return obj.(*appsapi.Deployment)
+}
+
+func checkDeploymentInvariants(t *testing.T, deploy *appsapi.Deployment, proxy matrixProxy, rollout matrixRollout) {
+	for _, annotation := range []string{defaults.ChecksumOperatorAnnotation, defaults.TemplateChecksumAnnotation} {
+		if deploy.Annotations[annotation] == "" {
+			t.Errorf("the deployment has no %s annotation", annotation)
+		}
+	}
+	template := deploy.Spec.Template
+	for _, annotation := range []string{defaults.ChecksumOperatorDepsAnnotation, defaults.TrustedCAChecksumAnnotation} {
+		if template.Annotations[annotation] == "" {
+			t.Errorf("the pod template has no %s annotation", annotation)
+		}
+	}
+
+	if got := *deploy.Spec.Replicas; got != rollout.replicas {
+		t.Errorf("expected %d replicas, got %d", rollout.replicas, got)
+	}
+	expectedStrategy := appsapi.DeploymentStrategyType(rollout.strategy)
+	if expectedStrategy == "" {
+		expectedStrategy = appsapi.RollingUpdateDeploymentStrategyType
+	}
+	if deploy.Spec.Strategy.Type != expectedStrategy {
+		t.Errorf("expected the %s strategy, got %s", expectedStrategy, deploy.Spec.Strategy.Type)
+	}
+	if expectedStrategy == appsapi.RollingUpdateDeploymentStrategyType {
+		rollingUpdate := deploy.Spec.Strategy.RollingUpdate
+		if rollingUpdate == nil || rollingUpdate.MaxUnavailable == nil || rollingUpdate.MaxSurge == nil {
+			t.Errorf("expected rolling update parameters, got %v", rollingUpdate)
+		} else if rollingUpdate.MaxUnavailable.IntValue() >= int(rollout.replicas) && rollout.replicas > 1 {
+			t.Errorf("the rollout may take all %d replicas down: maxUnavailable %s", rollout.replicas, rollingUpdate.MaxUnavailable.String())
+		}
+	} else if deploy.Spec.Strategy.RollingUpdate != nil {
+		t.Errorf("unexpected rolling update parameters for the %s strategy", expectedStrategy)
+	}
+
+	if len(template.Spec.Containers) != 1 {
+		t.Fatalf("expected a single container, got %d", len(template.Spec.Containers))
+	}
+	container := template.Spec.Containers[0]
+
+	env := map[string]corev1.EnvVar{}
+	for _, e := range container.Env {
+		if _, ok := env[e.Name]; ok {
+			t.Errorf("the env var %s is set more than once", e.Name)
+		}
+		env[e.Name] = e
+		if strings.Contains(e.Value, matrixSecretValue) {
+			t.Errorf("the env var %s has a secret value", e.Name)
+		}
+		if ref := e.ValueFrom; ref != nil && ref.SecretKeyRef != nil && ref.SecretKeyRef.Name != defaults.ImageRegistryPrivateConfiguration {
+			t.Errorf("the env var %s references the secret %s", e.Name, ref.SecretKeyRef.Name)
+		}
+	}
+	if got := env["REGISTRY_HTTP_ADDR"].Value; got != fmt.Sprintf(":%d", defaults.ContainerPort) {
+		t.Errorf("the registry must listen on all addresses of all families, got %q", got)
+	}
+	if env["REGISTRY_STORAGE"].Value == "" {
+		t.Errorf("the storage is not configured")
+	}
+	expectedProxy := map[string]string{}
+	if proxy.cluster != nil {
+		expectedProxy = map[string]string{"HTTP_PROXY": proxy.cluster.HTTPProxy, "HTTPS_PROXY": proxy.cluster.HTTPSProxy, "NO_PROXY": proxy.cluster.NoProxy}
+	}
+	if proxy.spec.HTTP != "" {
+		expectedProxy = map[string]string{"HTTP_PROXY": proxy.spec.HTTP, "HTTPS_PROXY": proxy.spec.HTTPS, "NO_PROXY": proxy.spec.NoProxy}
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if got := env[name].Value; got != expectedProxy[name] {
+			t.Errorf("expected %s=%q, got %q", name, expectedProxy[name], got)
+		}
+	}
+
+	for name, probe := range map[string]*corev1.Probe{"liveness": container.LivenessProbe, "readiness": container.ReadinessProbe} {
+		if probe == nil || probe.HTTPGet == nil {
+			t.Errorf("the %s probe is not an HTTP probe: %v", name, probe)
+			continue
+		}
+		if probe.HTTPGet.Scheme != corev1.URISchemeHTTPS || probe.HTTPGet.Path != defaults.HealthzRoute || probe.HTTPGet.Port.IntValue() != defaults.ContainerPort {
+			t.Errorf("the %s probe does not check the registry health endpoint: %v", name, probe.HTTPGet)
+		}
+		if probe.TimeoutSeconds <= 0 {
+			t.Errorf("the %s probe has no timeout", name)
+		}
+	}
+	ports := map[int32]bool{}
+	for _, port := range container.Ports {
+		ports[port.ContainerPort] = true
+	}
+	if !ports[int32(defaults.ContainerPort)] {
+		t.Errorf("the container does not expose the port %d", defaults.ContainerPort)
+	}
+
+	volumes := map[string]bool{}
+	for _, vol := range template.Spec.Volumes {
+		if volumes[vol.Name] {
+			t.Errorf("the volume %s is defined more than once", vol.Name)
+		}
+		volumes[vol.Name] = true
+	}
+	for _, mount := range container.VolumeMounts {
+		if !volumes[mount.Name] {
+			t.Errorf("the mount %s references an undefined volume", mount.Name)
+		}
+	}
+}
@@ -3,16 +3,19 @@ package resource
 import (
 	"context"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	appsapi "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -21,6 +24,9 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
 
 func TestChecksum(t *testing.T) {
@@ -199,6 +205,10 @@ func (d *testDriver) ID() string {
 	panic("ID not implemented")
 }
 
+func (d *testDriver) Capabilities() storage.Capabilities {
+	return storage.Capabilities{MultiWriterSafe: true}
+}
+
 func (d *testDriver) RemoveStorage(*imageregistryv1.Config) (bool, error) {
 	panic("RemoveStorage not implemented")
 }
@@ -228,3 +238,219 @@ func (d *testDriver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
 	}
 	return volumes, []corev1.VolumeMount{}, nil
 }
+
+func TestTrustedCAOnlyChange(t *testing.T) {
+	newDeployment := func(caChecksum, image string) *appsapi.Deployment {
+		template := corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					defaults.TrustedCAChecksumAnnotation: caChecksum,
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "registry", Image: image}},
+			},
+		}
+		dgst, err := strategy.Checksum(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					defaults.TemplateChecksumAnnotation: dgst,
+				},
+			},
+			Spec: appsapi.DeploymentSpec{
+				Template: template,
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		cur      *appsapi.Deployment
+		exp      *appsapi.Deployment
+		expected bool
+	}{
+		{
+			name:     "no changes",
+			cur:      newDeployment("ca1", "registry:1"),
+			exp:      newDeployment("ca1", "registry:1"),
+			expected: false,
+		},
+		{
+			name:     "trusted CA changed",
+			cur:      newDeployment("ca1", "registry:1"),
+			exp:      newDeployment("ca2", "registry:1"),
+			expected: true,
+		},
+		{
+			name:     "trusted CA and image changed",
+			cur:      newDeployment("ca1", "registry:1"),
+			exp:      newDeployment("ca2", "registry:2"),
+			expected: false,
+		},
+		{
+			name:     "image changed",
+			cur:      newDeployment("ca1", "registry:1"),
+			exp:      newDeployment("ca1", "registry:2"),
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			caOnly, err := trustedCAOnlyChange(tt.cur, tt.exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if caOnly != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, caOnly)
+			}
+		})
+	}
+}
+
+func TestTrustedCAChecksum(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	lister := corelisters.NewConfigMapLister(indexer).ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+
+	checksum, err := trustedCAChecksum(lister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != "" {
+		t.Errorf("expected an empty checksum without the trusted CA bundle, got %q", checksum)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      defaults.TrustedCAName,
+		},
+		Data: map[string]string{"ca-bundle.crt": "bundle1"},
+	}
+	if err := indexer.Add(cm); err != nil {
+		t.Fatal(err)
+	}
+	first, err := trustedCAChecksum(lister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" {
+		t.Fatal("expected a checksum for the trusted CA bundle")
+	}
+
+	cm = cm.DeepCopy()
+	cm.Data["ca-bundle.crt"] = "bundle2"
+	if err := indexer.Update(cm); err != nil {
+		t.Fatal(err)
+	}
+	second, err := trustedCAChecksum(lister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("expected the checksum to change with the trusted CA bundle")
+	}
+}
+
+// singleWriterDriver is a storage driver that the old and the new replicas
+// can not share during a rollout.
+type singleWriterDriver struct {
+	testDriver
+}
+
+func (d *singleWriterDriver) Capabilities() storage.Capabilities {
+	return storage.Capabilities{}
+}
+
+func TestApplyRollingUpdateOverrides(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		overrides      string
+		strategy       appsapi.DeploymentStrategyType
+		driver         storage.Driver
+		maxUnavailable string
+		maxSurge       string
+		err            string
+	}{
+		{
+			name:           "defaults",
+			overrides:      `{}`,
+			maxUnavailable: "1",
+			maxSurge:       "25%",
+		},
+		{
+			name:           "overridden",
+			overrides:      `{"rollout":{"maxUnavailable":"10%","maxSurge":2}}`,
+			maxUnavailable: "10%",
+			maxSurge:       "2",
+		},
+		{
+			name:      "recreate strategy",
+			overrides: `{"rollout":{"maxSurge":2}}`,
+			strategy:  appsapi.RecreateDeploymentStrategyType,
+			err:       "can not be used with the Recreate rollout strategy",
+		},
+		{
+			name:      "surge on storage that can not be shared",
+			overrides: `{"rollout":{"maxSurge":1}}`,
+			driver:    &singleWriterDriver{},
+			err:       "maxSurge must be 0",
+		},
+		{
+			name:           "no surge on storage that can not be shared",
+			overrides:      `{"rollout":{"maxSurge":0}}`,
+			driver:         &singleWriterDriver{},
+			maxUnavailable: "1",
+			maxSurge:       "0",
+		},
+		{
+			name:      "no progress",
+			overrides: `{"rollout":{"maxUnavailable":0,"maxSurge":0}}`,
+			err:       "must not both be 0",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			configOverrides, err := overrides.Parse(cr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			strategy := tt.strategy
+			var rollingUpdate *appsapi.RollingUpdateDeployment
+			if strategy == "" {
+				strategy = appsapi.RollingUpdateDeploymentStrategyType
+				maxUnavailable := intstr.FromInt(1)
+				maxSurge := intstr.FromString("25%")
+				rollingUpdate = &appsapi.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+					MaxSurge:       &maxSurge,
+				}
+			}
+			driver := tt.driver
+			if driver == nil {
+				driver = &testDriver{}
+			}
+
+			err = applyRollingUpdateOverrides(rollingUpdate, strategy, driver, configOverrides)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := rollingUpdate.MaxUnavailable.String(); got != tt.maxUnavailable {
+				t.Errorf("expected maxUnavailable %s, got %s", tt.maxUnavailable, got)
+			}
+			if got := rollingUpdate.MaxSurge.String(); got != tt.maxSurge {
+				t.Errorf("expected maxSurge %s, got %s", tt.maxSurge, got)
+			}
+		})
+	}
+}
@@ -6,23 +6,33 @@ import (
 	"reflect"
 	"time"
 
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
 	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/gateway"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/rgw"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func ApplyMutator(gen Mutator) error {
@@ -35,7 +45,7 @@ func ApplyMutator(gen Mutator) error {
 
 			n, err := gen.Create()
 			if err != nil {
-				return fmt.Errorf("failed to create object %s: %s", Name(gen), err)
+				return fmt.Errorf("failed to create object %s: %w", Name(gen), err)
 			}
 
 			str, err := object.DumpString(n)
@@ -53,7 +63,7 @@ func ApplyMutator(gen Mutator) error {
 			if errors.IsConflict(err) {
 				return err
 			}
-			return fmt.Errorf("failed to update object %s: %s", Name(gen), err)
+			return fmt.Errorf("failed to update object %s: %w", Name(gen), err)
 		}
 		if updated {
 			difference, err := object.DiffString(o, n)
@@ -73,6 +83,7 @@ func NewGenerator(eventRecorder events.Recorder, kubeconfig *rest.Config, client
 		listers:             listers,
 		clients:             clients,
 		featureGateAccessor: featureGateAccessor,
+		recreations:         NewRecreationTracker(),
 	}
 }
 
@@ -82,19 +93,66 @@ type Generator struct {
 	listers             *client.Listers
 	clients             *client.Clients
 	featureGateAccessor featuregates.FeatureGateAccess
+	recreations         *RecreationTracker
 }
 
-func (g *Generator) listRoutes(cr *imageregistryv1.Config) []Mutator {
-	var mutators []Mutator
+func (g *Generator) listRoutes(cr *imageregistryv1.Config) ([]Mutator, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, err
+	}
+	rateLimit, err := configOverrides.RouteRateLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*generatorRoute
 	if cr.Spec.DefaultRoute {
-		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, imageregistryv1.ImageRegistryConfigRoute{
+		routes = append(routes, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, imageregistryv1.ImageRegistryConfigRoute{
 			Name: defaults.RouteName,
 		}))
 	}
 	for _, route := range cr.Spec.Routes {
-		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, route))
+		routes = append(routes, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, route))
+	}
+	_, pullRoutes, err := configOverrides.PullEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range pullRoutes {
+		routes = append(routes, newGeneratorPullRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, route))
+	}
+
+	var mutators []Mutator
+	for _, route := range routes {
+		route.addAnnotations(rateLimitAnnotations(rateLimit))
+		mutators = append(mutators, route)
+	}
+	return mutators, nil
+}
+
+// serviceIPFamilies returns the IP families of the registry services and
+// reports in the ServiceIPFamiliesValid condition whether the overrides fit
+// the service network of the cluster.
+func (g *Generator) serviceIPFamilies(cr *imageregistryv1.Config, configOverrides overrides.ConfigOverrides) (*corev1.IPFamilyPolicy, []corev1.IPFamily, error) {
+	settings, err := configOverrides.ServiceIPFamilies()
+	if err != nil {
+		util.UpdateCondition(cr, defaults.ServiceIPFamiliesValid, operatorapi.ConditionFalse, "InvalidOverrides", err.Error())
+		return nil, nil, err
 	}
-	return mutators
+	network, err := g.listers.NetworkConfigs.Get(defaults.NetworkResourceName)
+	if errors.IsNotFound(err) {
+		network = nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	policy, families, err := serviceIPFamilies(network, settings)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.ServiceIPFamiliesValid, operatorapi.ConditionFalse, "UnsupportedIPFamilies", err.Error())
+		return nil, nil, err
+	}
+	util.UpdateCondition(cr, defaults.ServiceIPFamiliesValid, operatorapi.ConditionTrue, "AsExpected", "")
+	return policy, families, nil
 }
 
 func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
@@ -103,6 +161,8 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 		return nil, err
 	} else if err == storage.ErrStorageNotConfigured {
 		klog.V(6).Info("storage not configured, some mutators might not work.")
+	} else if err = configureStorageDriver(cr, driver); err != nil {
+		return nil, err
 	}
 
 	var mutators []Mutator
@@ -111,14 +171,92 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 	mutators = append(mutators, newGeneratorServiceAccount(g.listers.ServiceAccounts, g.clients.Core))
 	mutators = append(mutators, newGeneratorPullSecret(g.clients.Core))
 	mutators = append(mutators, newGeneratorSecret(g.listers.Secrets, g.clients.Core, driver))
-	mutators = append(mutators, newGeneratorService(g.listers.Services, g.clients.Core))
-	mutators = append(mutators, newGeneratorDeployment(g.eventRecorder, g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.listers.ProxyConfigs, g.clients.Core, g.clients.Apps, driver, cr))
+
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, err
+	}
+	ipFamilyPolicy, ipFamilies, err := g.serviceIPFamilies(cr, configOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	service := newGeneratorService(g.listers.Services, g.clients.Core)
+	service.ipFamilyPolicy, service.ipFamilies = ipFamilyPolicy, ipFamilies
+	mutators = append(mutators, service)
+	mutators = append(mutators, newGeneratorDeployment(g.eventRecorder, g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.listers.ProxyConfigs, g.clients.Core, g.clients.Apps, driver, g.kubeconfig, cr))
 	mutators = append(mutators, newGeneratorPodDisruptionBudget(g.listers.PodDisruptionBudgets, g.clients.Kube.PolicyV1(), cr))
-	mutators = append(mutators, g.listRoutes(cr)...)
+
+	autoscaler, err := configOverrides.Autoscaler(cr.Spec.Replicas)
+	if err != nil {
+		return nil, err
+	}
+	if autoscaler != nil {
+		if driver != nil && !driver.Capabilities().MultiWriterSafe {
+			return nil, fmt.Errorf("the registry can not be autoscaled, its storage can not be shared by several replicas")
+		}
+		mutators = append(mutators, newGeneratorHorizontalPodAutoscaler(g.listers.HorizontalPodAutoscalers, g.clients.Kube.AutoscalingV2(), cr, autoscaler))
+	}
+
+	if configOverrides.SplitPullEndpoint() {
+		pullService := newGeneratorPullService(g.listers.Services, g.clients.Core)
+		pullService.ipFamilyPolicy, pullService.ipFamilies = ipFamilyPolicy, ipFamilies
+		mutators = append(mutators, pullService)
+		mutators = append(mutators, newGeneratorPullDeployment(g.eventRecorder, g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.listers.ProxyConfigs, g.clients.Core, g.clients.Apps, driver, cr))
+	}
+
+	routes, err := g.listRoutes(cr)
+	if err != nil {
+		return nil, err
+	}
+	mutators = append(mutators, routes...)
 
 	return mutators, nil
 }
 
+// configureStorageDriver configures driver for the on-prem product of the
+// storage preset override, for the S3 Transfer Acceleration once it is
+// known to be available on the bucket, and for the CA of the Azure storage
+// endpoints.
+func configureStorageDriver(cr *imageregistryv1.Config, driver storage.Driver) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	if configurable, ok := driver.(storage.PresetConfigurable); ok {
+		preset, err := configOverrides.StoragePreset()
+		if err != nil {
+			return err
+		}
+		configurable.SetPreset(preset)
+	}
+	if configurable, ok := driver.(storage.AccelerationConfigurable); ok {
+		available := util.FetchCondition(cr, defaults.StorageAccelerationEnabled).Status == operatorapi.ConditionTrue
+		configurable.SetAccelerate(configOverrides.S3Accelerate() && available)
+	}
+	if configurable, ok := driver.(storage.TrustedCAConfigurable); ok {
+		name, err := configOverrides.AzureTrustedCAName()
+		if err != nil {
+			return err
+		}
+		configurable.SetTrustedCA(name)
+	}
+	return nil
+}
+
+// NewStorageDriver returns the driver of the storage of cr, configured the
+// way the operator uses it.
+func NewStorageDriver(cr *imageregistryv1.Config, kubeconfig *rest.Config, listers *client.StorageListers, fg featuregates.FeatureGateAccess) (storage.Driver, error) {
+	driver, err := storage.NewDriver(&cr.Spec.Storage, kubeconfig, listers, fg)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureStorageDriver(cr, driver); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
 // syncStorage checks:
 // 1.)  to make sure that an existing storage medium still exists and we can access it
 // 2.)  to see if the storage medium name changed and we need to:
@@ -127,6 +265,7 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 //	b.) see if we need to try to create the new storage
 func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 	var runCreate bool
+	validate := storageSpecChanged(cr) || storage.ValidationFailed(cr) || util.FetchCondition(cr, defaults.StorageValidated).Type == ""
 	// Create a driver with the current configuration
 	driver, err := storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
 	if err == storage.ErrStorageNotConfigured {
@@ -139,6 +278,11 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 	if err != nil {
 		return err
 	}
+	if err := configureStorageDriver(cr, driver); err != nil {
+		return err
+	}
+
+	storage.ReportCredentials(cr, driver)
 
 	if driver.StorageChanged(cr) {
 		runCreate = true
@@ -147,6 +291,7 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 		if err != nil {
 			return err
 		}
+		storage.ReportAuthSucceeded(cr)
 		if !exists {
 			runCreate = true
 		}
@@ -157,14 +302,33 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 		if err := driver.CreateStorage(cr); err != nil {
 			return err
 		}
+		storage.ReportAuthSucceeded(cr)
 		if reconf {
 			metrics.StorageReconfigured()
 		}
 	}
 
+	// a new storage configuration is validated before the registry is
+	// rolled out with it.
+	if validate {
+		if err := storage.Validate(cr, driver); err != nil {
+			return err
+		}
+	}
+
+	storage.ReportWritable(cr, driver)
+
 	return nil
 }
 
+// storageSpecChanged returns true if the storage configuration in the spec
+// is not the one the storage was last reconciled with.
+func storageSpecChanged(cr *imageregistryv1.Config) bool {
+	spec, status := cr.Spec.Storage.DeepCopy(), cr.Status.Storage.DeepCopy()
+	spec.ManagementState, status.ManagementState = "", ""
+	return !reflect.DeepEqual(spec, status)
+}
+
 // storageReconfigured returns true if we are, based on the provided config,
 // starting to use a different underlying storage location.
 func (g *Generator) storageReconfigured(
@@ -194,12 +358,18 @@ func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
 		return fmt.Errorf("failed to list routes: %s", err)
 	}
 
-	routesGenerators := g.listRoutes(cr)
+	routesGenerators, err := g.listRoutes(cr)
+	if err != nil {
+		return err
+	}
 	knownNames := map[string]struct{}{}
 	for _, gen := range routesGenerators {
 		knownNames[gen.GetName()] = struct{}{}
 	}
 
+	// the objects deleted with the registry are not recreations.
+	g.recreations.Retain(nil)
+
 	gracePeriod := int64(0)
 	propagationPolicy := metaapi.DeletePropagationForeground
 	opts := metaapi.DeleteOptions{
@@ -223,12 +393,286 @@ func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
 	return nil
 }
 
+// removePullEndpoint deletes the read-only registry replicas and their
+// service when the pull endpoint is no longer separated.
+func (g *Generator) removePullEndpoint(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	if configOverrides.SplitPullEndpoint() {
+		return nil
+	}
+
+	opts := metaapi.DeleteOptions{
+		PropagationPolicy: ptr.To(metaapi.DeletePropagationBackground),
+	}
+	if _, err := g.listers.Deployments.Get(defaults.ImageRegistryPullName); err == nil {
+		err = g.clients.Apps.Deployments(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), defaults.ImageRegistryPullName, opts,
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	if _, err := g.listers.Services.Get(defaults.ImageRegistryPullName); err == nil {
+		err = g.clients.Core.Services(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), defaults.ImageRegistryPullName, opts,
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// removeAutoscaler deletes the autoscaler of the registry deployment when
+// the registry is not autoscaled anymore. The deployment gets the replicas
+// of spec.replicas back.
+func (g *Generator) removeAutoscaler(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	if autoscaler, err := configOverrides.Autoscaler(cr.Spec.Replicas); err != nil || autoscaler != nil {
+		return err
+	}
+
+	if _, err := g.listers.HorizontalPodAutoscalers.Get(defaults.ImageRegistryName); err == nil {
+		err = g.clients.Kube.AutoscalingV2().HorizontalPodAutoscalers(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), defaults.ImageRegistryName, metaapi.DeleteOptions{},
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// syncCredentialsSource copies the storage credentials managed by an
+// external secret operator into the secret the storage drivers read them
+// from.
+func (g *Generator) syncCredentialsSource(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	source, err := configOverrides.StorageCredentialsSource()
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		return nil
+	}
+	return ApplyMutator(newGeneratorCredentialsSecret(g.listers.Secrets, g.clients.Core, source.SecretName))
+}
+
+// syncRGWBucketClaim provisions the registry bucket on Ceph RADOS Gateway
+// through an ObjectBucketClaim, and configures the S3 storage with the bucket
+// and the credentials of the claim once it is bound.
+func (g *Generator) syncRGWBucketClaim(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	claim := configOverrides.RGWBucketClaim()
+	if claim == nil || cr.Spec.Storage.S3 == nil {
+		return nil
+	}
+
+	storageClassName := claim.StorageClassName
+	if storageClassName == "" {
+		if storageClassName, err = rgw.DiscoverStorageClass(context.TODO(), g.clients.Kube); err != nil {
+			return err
+		}
+	}
+	dynamicClient, err := dynamic.NewForConfig(g.kubeconfig)
+	if err != nil {
+		return err
+	}
+	bound, err := rgw.EnsureClaim(context.TODO(), dynamicClient, defaults.ImageRegistryOperatorNamespace, defaults.RGWBucketClaimName, storageClassName)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Bucket Claim Pending", fmt.Sprintf("The ObjectBucketClaim %s/%s is not bound yet", defaults.ImageRegistryOperatorNamespace, defaults.RGWBucketClaimName))
+		return fmt.Errorf("the ObjectBucketClaim %s/%s is not bound yet", defaults.ImageRegistryOperatorNamespace, defaults.RGWBucketClaimName)
+	}
+
+	cm, err := g.listers.ConfigMaps.Get(defaults.RGWBucketClaimName)
+	if err != nil {
+		return fmt.Errorf("unable to get the bucket of the ObjectBucketClaim: %w", err)
+	}
+	bucket, err := rgw.BucketFromConfigMap(cm)
+	if err != nil {
+		return err
+	}
+	credentials := newGeneratorCredentialsSecret(g.listers.Secrets, g.clients.Core, defaults.RGWBucketClaimName)
+	credentials.keys = rgw.CredentialsKeys
+	if err := ApplyMutator(credentials); err != nil {
+		return err
+	}
+
+	cr.Spec.Storage.S3.Bucket = bucket.Name
+	cr.Spec.Storage.S3.Region = bucket.Region
+	cr.Spec.Storage.S3.RegionEndpoint = bucket.Endpoint
+	cr.Spec.Storage.S3.VirtualHostedStyle = false
+	// The bucket belongs to the claim, the storage driver must not manage
+	// nor remove it.
+	if cr.Spec.Storage.ManagementState == "" {
+		cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+	}
+	return nil
+}
+
+// removeRGWBucketClaim deletes the ObjectBucketClaim of the registry bucket.
+func (g *Generator) removeRGWBucketClaim(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	if configOverrides.RGWBucketClaim() == nil {
+		return nil
+	}
+	dynamicClient, err := dynamic.NewForConfig(g.kubeconfig)
+	if err != nil {
+		return err
+	}
+	return rgw.DeleteClaim(context.TODO(), dynamicClient, defaults.ImageRegistryOperatorNamespace, defaults.RGWBucketClaimName)
+}
+
+// syncGateway exposes the registry through a Gateway API HTTPRoute. The
+// registry only serves TLS, a BackendTLSPolicy makes the gateways verify it
+// with the service CA, which is copied to the ca.crt key that Gateway API
+// expects.
+func (g *Generator) syncGateway(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	settings, err := configOverrides.Gateway()
+	if err != nil || settings == nil {
+		return err
+	}
+
+	serviceCA, err := g.listers.ConfigMaps.Get(defaults.ServiceCAName)
+	if err != nil {
+		return fmt.Errorf("unable to get the service CA: %w", err)
+	}
+	ca := serviceCA.Data["service-ca.crt"]
+	if ca == "" {
+		return fmt.Errorf("the service CA is not injected into the config map %s yet", defaults.ServiceCAName)
+	}
+	_, _, err = resourceapply.ApplyConfigMap(context.TODO(), g.clients.Core, g.eventRecorder, &corev1.ConfigMap{
+		ObjectMeta: metaapi.ObjectMeta{
+			Name:      defaults.GatewayCAName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string]string{"ca.crt": ca},
+	})
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(g.kubeconfig)
+	if err != nil {
+		return err
+	}
+	route := gateway.HTTPRoute(defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryName, defaults.ServiceName, defaults.ContainerPort, settings)
+	if err := gateway.Apply(context.TODO(), dynamicClient, gateway.HTTPRouteGVR, route); err != nil {
+		return err
+	}
+	hostname := fmt.Sprintf("%s.%s.svc", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace)
+	policy := gateway.BackendTLSPolicy(defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryName, defaults.ServiceName, defaults.GatewayCAName, hostname)
+	return gateway.Apply(context.TODO(), dynamicClient, gateway.BackendTLSPolicyGVR, policy)
+}
+
+// removeGateway deletes the Gateway API objects of the registry when it is
+// no longer exposed through Gateway API.
+func (g *Generator) removeGateway(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	if settings, err := configOverrides.Gateway(); err != nil || settings != nil {
+		return err
+	}
+	return g.deleteGateway()
+}
+
+// deleteGateway deletes the Gateway API objects of the registry. The CA
+// config map is deleted last, it tells whether there is anything to delete
+// without calling the Gateway API, which may not be installed.
+func (g *Generator) deleteGateway() error {
+	if _, err := g.listers.ConfigMaps.Get(defaults.GatewayCAName); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(g.kubeconfig)
+	if err != nil {
+		return err
+	}
+	if err := gateway.Delete(context.TODO(), dynamicClient, gateway.HTTPRouteGVR, defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryName); err != nil {
+		return err
+	}
+	if err := gateway.Delete(context.TODO(), dynamicClient, gateway.BackendTLSPolicyGVR, defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryName); err != nil {
+		return err
+	}
+	err = g.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(context.TODO(), defaults.GatewayCAName, metaapi.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// syncNamespacePodSecurity sets the PodSecurity labels of the operator
+// namespace.
+func (g *Generator) syncNamespacePodSecurity(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	labels, err := configOverrides.PodSecurityLabels()
+	if err != nil {
+		return err
+	}
+	return applyNamespacePodSecurity(g.clients.Core, labels)
+}
+
 func (g *Generator) Apply(cr *imageregistryv1.Config) error {
+	if err := g.syncNamespacePodSecurity(cr); err != nil {
+		return fmt.Errorf("unable to sync the namespace pod security labels: %w", err)
+	}
+
+	if err := g.syncCredentialsSource(cr); err != nil {
+		return fmt.Errorf("unable to sync storage credentials: %w", err)
+	}
+
+	if err := g.syncRGWBucketClaim(cr); err != nil {
+		return fmt.Errorf("unable to sync the ObjectBucketClaim of the registry bucket: %w", err)
+	}
+
 	err := g.syncStorage(cr)
+	if err == nil {
+		if mirrorErr := g.syncStorageMirror(cr); mirrorErr != nil {
+			klog.Errorf("unable to sync the storage mirror: %s", mirrorErr)
+		}
+	}
+	if auditErr := g.writeStorageAudit(); auditErr != nil {
+		klog.Errorf("unable to write the storage audit trail: %s", auditErr)
+	}
 	if err == storage.ErrStorageNotConfigured {
 		return err
 	} else if err != nil {
-		return fmt.Errorf("unable to sync storage configuration: %s", err)
+		return fmt.Errorf("unable to sync storage configuration: %w", err)
 	}
 
 	// XXX https://bugzilla.redhat.com/show_bug.cgi?id=1833109
@@ -247,15 +691,28 @@ func (g *Generator) Apply(cr *imageregistryv1.Config) error {
 	cr.Status.StorageManaged = cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
 	cr.Status.Storage.ManagementState = cr.Spec.Storage.ManagementState
 
+	if err := g.checkServingCert(cr); err != nil {
+		return fmt.Errorf("invalid serving certificate: %w", err)
+	}
+
 	generators, err := g.List(cr)
 	if err != nil {
 		return fmt.Errorf("unable to get generators: %s", err)
 	}
 
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	recreationPolicy, err := configOverrides.RecreationPolicy()
+	if err != nil {
+		return err
+	}
+	g.recreations.Retain(generators)
 	for _, gen := range generators {
-		err = ApplyMutator(gen)
+		err = g.recreations.Apply(gen, recreationPolicy, g.eventRecorder)
 		if err != nil {
-			return fmt.Errorf("unable to apply objects: %s", err)
+			return fmt.Errorf("unable to apply objects: %w", err)
 		}
 	}
 
@@ -264,6 +721,26 @@ func (g *Generator) Apply(cr *imageregistryv1.Config) error {
 		return fmt.Errorf("unable to remove obsolete routes: %s", err)
 	}
 
+	err = g.removePullEndpoint(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove the pull endpoint: %s", err)
+	}
+
+	err = g.removeAutoscaler(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove the autoscaler: %s", err)
+	}
+
+	err = g.syncGateway(cr)
+	if err != nil {
+		return fmt.Errorf("unable to sync the Gateway API objects: %s", err)
+	}
+
+	err = g.removeGateway(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove the Gateway API objects: %s", err)
+	}
+
 	return nil
 }
 
@@ -291,6 +768,9 @@ func (g *Generator) Remove(cr *imageregistryv1.Config) error {
 		}
 		klog.Infof("object %s deleted", Name(gen))
 	}
+	if err := g.deleteGateway(); err != nil {
+		return fmt.Errorf("failed to delete the Gateway API objects: %s", err)
+	}
 
 	driver, err := storage.NewDriver(&cr.Status.Storage, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
 	if err == storage.ErrStorageNotConfigured {
@@ -299,6 +779,11 @@ func (g *Generator) Remove(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	checkpoint := &removalCheckpoint{client: g.clients.Core}
+	if remover, ok := driver.(storage.ChunkedRemover); ok {
+		remover.SetRemovalOptions(storageRemovalOptions(cr, checkpoint))
+	}
+
 	var derr error
 	var retriable bool
 	err = wait.PollUntilContextTimeout(context.Background(), 1*time.Second, 5*time.Minute, true,
@@ -313,11 +798,46 @@ func (g *Generator) Remove(cr *imageregistryv1.Config) error {
 			return true, nil
 		},
 	)
+	if auditErr := g.writeStorageAudit(); auditErr != nil {
+		klog.Errorf("unable to write the storage audit trail: %s", auditErr)
+	}
 	if err != nil {
 		return fmt.Errorf("unable to remove storage: %s, %s", err, derr)
 	}
+	if err := checkpoint.Remove(); err != nil {
+		return fmt.Errorf("unable to remove the storage removal progress: %s", err)
+	}
+	if err := g.removeRGWBucketClaim(cr); err != nil {
+		return fmt.Errorf("unable to remove the ObjectBucketClaim of the registry bucket: %s", err)
+	}
+	if err := g.removeStorageMirror(); err != nil {
+		return fmt.Errorf("unable to remove the mirror storage: %s", err)
+	}
+	if auditErr := g.writeStorageAudit(); auditErr != nil {
+		klog.Errorf("unable to write the storage audit trail: %s", auditErr)
+	}
 
 	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{}
 
 	return nil
 }
+
+// storageRemovalOptions returns how the objects of the managed bucket are
+// deleted. Invalid overrides must not prevent the removal of the storage,
+// the defaults are used instead.
+func storageRemovalOptions(cr *imageregistryv1.Config, checkpoint util.RemovalCheckpoint) storage.RemovalOptions {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		klog.Warningf("unable to parse the config overrides, using the default storage removal settings: %s", err)
+	}
+	chunkSize, objectsPerSecond, err := configOverrides.StorageRemoval()
+	if err != nil {
+		klog.Warningf("invalid storage removal settings, using the defaults: %s", err)
+		chunkSize, objectsPerSecond, _ = overrides.ConfigOverrides{}.StorageRemoval()
+	}
+	return storage.RemovalOptions{
+		Checkpoint: checkpoint,
+		ChunkSize:  chunkSize,
+		Limiter:    rate.NewLimiter(rate.Limit(objectsPerSecond), chunkSize),
+	}
+}
@@ -0,0 +1,226 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	securityv1 "github.com/openshift/api/security/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// hardPruneCommand extracts the trusted CAs like the registry does and runs
+// the hard prune of the registry binary with the given mode.
+const hardPruneCommand = "mkdir -p /etc/pki/ca-trust/extracted/edk2 /etc/pki/ca-trust/extracted/java /etc/pki/ca-trust/extracted/openssl /etc/pki/ca-trust/extracted/pem && update-ca-trust extract --output /etc/pki/ca-trust/extracted/ && exec /usr/bin/dockerregistry -prune=%s"
+
+var _ Mutator = &generatorHardPruneCronJob{}
+
+type generatorHardPruneCronJob struct {
+	lister     batchlisters.CronJobNamespaceLister
+	client     batchset.BatchV1Interface
+	cr         *imageregistryv1.Config
+	deployment *appsv1.Deployment
+	hardPrune  *overrides.HardPrune
+}
+
+// NewGeneratorHardPruneCronJob returns the generator of the cron job that
+// runs the hard prune of the registry storage. The pods of the job run the
+// registry container of deployment, so that they access the storage with the
+// configuration and the credentials of the registry.
+func NewGeneratorHardPruneCronJob(
+	lister batchlisters.CronJobNamespaceLister,
+	client batchset.BatchV1Interface,
+	cr *imageregistryv1.Config,
+	deployment *appsv1.Deployment,
+	hardPrune *overrides.HardPrune,
+) *generatorHardPruneCronJob {
+	return &generatorHardPruneCronJob{
+		lister:     lister,
+		client:     client,
+		cr:         cr,
+		deployment: deployment,
+		hardPrune:  hardPrune,
+	}
+}
+
+func (ghp *generatorHardPruneCronJob) Type() runtime.Object {
+	return &batchv1.CronJob{}
+}
+
+func (ghp *generatorHardPruneCronJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (ghp *generatorHardPruneCronJob) GetName() string {
+	return defaults.HardPruneCronJobName
+}
+
+// getSchedule returns the schedule of the hard prune and its time zone. Unless
+// it has its own schedule, the hard prune runs when the maintenance window of
+// the registry opens.
+func (ghp *generatorHardPruneCronJob) getSchedule() (string, *string, error) {
+	if ghp.hardPrune.Schedule != "" {
+		return ghp.hardPrune.Schedule, nil, nil
+	}
+	configOverrides, err := overrides.Parse(ghp.cr)
+	if err != nil {
+		return "", nil, err
+	}
+	window, err := configOverrides.MaintenanceWindow()
+	if err != nil {
+		return "", nil, err
+	}
+	if window == nil {
+		return defaults.HardPruneSchedule, nil, nil
+	}
+	return window.CronSchedule(), ptr.To(window.TimeZoneName()), nil
+}
+
+// registryContainer returns the registry container of the deployment.
+func registryContainer(deployment *appsv1.Deployment) (*corev1.Container, error) {
+	for i, c := range deployment.Spec.Template.Spec.Containers {
+		if c.Name == "registry" {
+			return &deployment.Spec.Template.Spec.Containers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("the deployment %s has no registry container", deployment.Name)
+}
+
+// registryJobPodTemplate returns the template of the pods of a job that runs
+// the registry binary with the prune mode. The pods run the registry
+// container of deployment, so that they access the storage with the
+// configuration and the credentials of the registry.
+func registryJobPodTemplate(deployment *appsv1.Deployment, containerName, mode string) (corev1.PodTemplateSpec, error) {
+	registry, err := registryContainer(deployment)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+	podSpec := deployment.Spec.Template.Spec
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				securityv1.RequiredSCCAnnotation: "restricted-v2",
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: defaults.ServiceAccountName,
+			PriorityClassName:  "system-cluster-critical",
+			SecurityContext:    podSpec.SecurityContext,
+			NodeSelector:       podSpec.NodeSelector,
+			Tolerations:        podSpec.Tolerations,
+			// ReadWriteOnce claims can only be mounted on the nodes
+			// of the registry pods.
+			Affinity: &corev1.Affinity{
+				PodAffinity: &corev1.PodAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+						Weight: 100,
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{MatchLabels: defaults.DeploymentLabels},
+							TopologyKey:   "kubernetes.io/hostname",
+						},
+					}},
+				},
+			},
+			Containers: []corev1.Container{{
+				Name:    containerName,
+				Image:   registry.Image,
+				Command: []string{"/bin/sh", "-c", fmt.Sprintf(hardPruneCommand, mode)},
+				Env:     registry.Env,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("100m"),
+						corev1.ResourceMemory: resource.MustParse("256Mi"),
+					},
+				},
+				VolumeMounts:             registry.VolumeMounts,
+				TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+			}},
+			Volumes: podSpec.Volumes,
+		},
+	}, nil
+}
+
+func (ghp *generatorHardPruneCronJob) expected() (runtime.Object, error) {
+	schedule, timeZone, err := ghp.getSchedule()
+	if err != nil {
+		return nil, err
+	}
+	mode := "delete"
+	if ghp.hardPrune.DryRun {
+		mode = "check"
+	}
+	template, err := registryJobPodTemplate(ghp.deployment, "hard-prune", mode)
+	if err != nil {
+		return nil, err
+	}
+
+	cj := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ghp.GetName(),
+			Namespace: ghp.GetNamespace(),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   schedule,
+			TimeZone:                   timeZone,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			FailedJobsHistoryLimit:     ptr.To[int32](3),
+			SuccessfulJobsHistoryLimit: ptr.To[int32](3),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"created-by": ghp.GetName()},
+				},
+				Spec: batchv1.JobSpec{
+					// the jobs are started by the storage prune
+					// controller once no image is being pushed.
+					Suspend:      ptr.To(true),
+					BackoffLimit: ptr.To[int32](0),
+					Template:     template,
+				},
+			},
+		},
+	}
+	return cj, nil
+}
+
+func (ghp *generatorHardPruneCronJob) Get() (runtime.Object, error) {
+	return ghp.lister.Get(ghp.GetName())
+}
+
+func (ghp *generatorHardPruneCronJob) Create() (runtime.Object, error) {
+	return commonCreate(ghp, func(obj runtime.Object) (runtime.Object, error) {
+		return ghp.client.CronJobs(ghp.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.CronJob), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (ghp *generatorHardPruneCronJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(ghp, o, func(obj runtime.Object) (runtime.Object, error) {
+		return ghp.client.CronJobs(ghp.GetNamespace()).Update(
+			context.TODO(), obj.(*batchv1.CronJob), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (ghp *generatorHardPruneCronJob) Delete(opts metav1.DeleteOptions) error {
+	return ghp.client.CronJobs(ghp.GetNamespace()).Delete(
+		context.TODO(), ghp.GetName(), opts,
+	)
+}
+
+func (ghp *generatorHardPruneCronJob) Owned() bool {
+	return true
+}
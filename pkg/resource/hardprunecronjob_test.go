@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestHardPruneCronJob(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-registry"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         "registry",
+						Image:        "registry:latest",
+						Env:          []corev1.EnvVar{{Name: "REGISTRY_STORAGE", Value: "s3"}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "registry-tls", MountPath: "/etc/secrets"}},
+					}},
+					Volumes: []corev1.Volume{{Name: "registry-tls"}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		overrides string
+		hardPrune overrides.HardPrune
+		schedule  string
+		timeZone  string
+		mode      string
+	}{
+		{
+			name:     "default schedule",
+			schedule: "0 3 * * 0",
+			mode:     "-prune=delete",
+		},
+		{
+			name:      "maintenance window",
+			overrides: `{"maintenance":{"window":{"days":["Saturday"],"startHour":22,"endHour":4,"timeZone":"Europe/Paris"}}}`,
+			hardPrune: overrides.HardPrune{DryRun: true},
+			schedule:  "0 22 * * 6",
+			timeZone:  "Europe/Paris",
+			mode:      "-prune=check",
+		},
+		{
+			name:      "own schedule",
+			overrides: `{"maintenance":{"window":{"startHour":22}}}`,
+			hardPrune: overrides.HardPrune{Schedule: "30 1 * * *"},
+			schedule:  "30 1 * * *",
+			mode:      "-prune=delete",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			if tc.overrides != "" {
+				cr.Spec.OperatorSpec = operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(tc.overrides)},
+				}
+			}
+			gen := NewGeneratorHardPruneCronJob(nil, nil, cr, deployment, &tc.hardPrune)
+			obj, err := gen.expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cj := obj.(*batchv1.CronJob)
+
+			if cj.Spec.Schedule != tc.schedule {
+				t.Errorf("got schedule %q, want %q", cj.Spec.Schedule, tc.schedule)
+			}
+			timeZone := ""
+			if cj.Spec.TimeZone != nil {
+				timeZone = *cj.Spec.TimeZone
+			}
+			if timeZone != tc.timeZone {
+				t.Errorf("got time zone %q, want %q", timeZone, tc.timeZone)
+			}
+			if suspend := cj.Spec.JobTemplate.Spec.Suspend; suspend == nil || !*suspend {
+				t.Errorf("the jobs must be created suspended")
+			}
+
+			pod := cj.Spec.JobTemplate.Spec.Template.Spec
+			c := pod.Containers[0]
+			if c.Image != "registry:latest" || len(c.Env) != 1 || len(c.VolumeMounts) != 1 || len(pod.Volumes) != 1 {
+				t.Errorf("the container does not run the registry with its configuration: %#v", c)
+			}
+			if command := c.Command[len(c.Command)-1]; !strings.HasSuffix(command, "exec /usr/bin/dockerregistry "+tc.mode) {
+				t.Errorf("got command %q, want the %s mode", command, tc.mode)
+			}
+		})
+	}
+}
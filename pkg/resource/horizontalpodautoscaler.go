@@ -0,0 +1,126 @@
+package resource
+
+import (
+	"context"
+
+	appsapi "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	autoscalingclient "k8s.io/client-go/kubernetes/typed/autoscaling/v2"
+	autoscalinglisters "k8s.io/client-go/listers/autoscaling/v2"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+var _ Mutator = &generatorHorizontalPodAutoscaler{}
+
+// generatorHorizontalPodAutoscaler generates the autoscaler of the registry
+// deployment when the autoscaling override is set.
+type generatorHorizontalPodAutoscaler struct {
+	lister   autoscalinglisters.HorizontalPodAutoscalerNamespaceLister
+	client   autoscalingclient.AutoscalingV2Interface
+	cr       *imageregistryv1.Config
+	settings *overrides.AutoscalingOverrides
+}
+
+func newGeneratorHorizontalPodAutoscaler(lister autoscalinglisters.HorizontalPodAutoscalerNamespaceLister, client autoscalingclient.AutoscalingV2Interface, cr *imageregistryv1.Config, settings *overrides.AutoscalingOverrides) *generatorHorizontalPodAutoscaler {
+	return &generatorHorizontalPodAutoscaler{
+		lister:   lister,
+		client:   client,
+		cr:       cr,
+		settings: settings,
+	}
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) Type() runtime.Object {
+	return &autoscalingv2.HorizontalPodAutoscaler{}
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) GetName() string {
+	return defaults.ImageRegistryName
+}
+
+// utilizationMetric returns the metric of the average utilization of
+// resource by the registry replicas.
+func utilizationMetric(resource corev1.ResourceName, percentage int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: resource,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: ptr.To(percentage),
+			},
+		},
+	}
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) expected() (runtime.Object, error) {
+	var metrics []autoscalingv2.MetricSpec
+	if ghpa.settings.TargetCPUUtilizationPercentage != 0 {
+		metrics = append(metrics, utilizationMetric(corev1.ResourceCPU, ghpa.settings.TargetCPUUtilizationPercentage))
+	}
+	if ghpa.settings.TargetMemoryUtilizationPercentage != 0 {
+		metrics = append(metrics, utilizationMetric(corev1.ResourceMemory, ghpa.settings.TargetMemoryUtilizationPercentage))
+	}
+	metrics = append(metrics, ghpa.settings.Metrics...)
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ghpa.GetName(),
+			Namespace: ghpa.GetNamespace(),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsapi.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       defaults.ImageRegistryName,
+			},
+			MinReplicas: ptr.To(ghpa.settings.MinReplicas),
+			MaxReplicas: ghpa.settings.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+
+	return hpa, nil
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) Get() (runtime.Object, error) {
+	return ghpa.lister.Get(ghpa.GetName())
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) Create() (runtime.Object, error) {
+	return commonCreate(ghpa, func(obj runtime.Object) (runtime.Object, error) {
+		return ghpa.client.HorizontalPodAutoscalers(ghpa.GetNamespace()).Create(
+			context.TODO(), obj.(*autoscalingv2.HorizontalPodAutoscaler), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(ghpa, o, func(obj runtime.Object) (runtime.Object, error) {
+		return ghpa.client.HorizontalPodAutoscalers(ghpa.GetNamespace()).Update(
+			context.TODO(), obj.(*autoscalingv2.HorizontalPodAutoscaler), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) Delete(opts metav1.DeleteOptions) error {
+	return ghpa.client.HorizontalPodAutoscalers(ghpa.GetNamespace()).Delete(
+		context.TODO(), ghpa.GetName(), opts,
+	)
+}
+
+func (ghpa *generatorHorizontalPodAutoscaler) Owned() bool {
+	return true
+}
@@ -0,0 +1,57 @@
+package resource
+
+import (
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestHorizontalPodAutoscaler(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Replicas: 2,
+			OperatorSpec: operatorv1.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{
+					Raw: []byte(`{"autoscaling":{"maxReplicas":6,"targetMemoryUtilizationPercentage":70}}`),
+				},
+			},
+		},
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := configOverrides.Autoscaler(cr.Spec.Replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas, err := registryReplicas(cr, configOverrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas != 2 {
+		t.Errorf("expected the deployment to start with spec.replicas, got %d", replicas)
+	}
+
+	obj, err := newGeneratorHorizontalPodAutoscaler(nil, nil, cr, settings).expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hpa := obj.(*autoscalingv2.HorizontalPodAutoscaler)
+	if hpa.Spec.ScaleTargetRef.Kind != "Deployment" || hpa.Spec.ScaleTargetRef.Name != "image-registry" {
+		t.Errorf("unexpected scale target %#v", hpa.Spec.ScaleTargetRef)
+	}
+	if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 6 {
+		t.Errorf("expected 2 to 6 replicas, got %d to %d", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	if len(hpa.Spec.Metrics) != 1 || hpa.Spec.Metrics[0].Resource.Name != corev1.ResourceMemory || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != 70 {
+		t.Errorf("expected only the memory target, got %#v", hpa.Spec.Metrics)
+	}
+}
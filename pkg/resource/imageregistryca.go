@@ -97,8 +97,11 @@ func (girca *generatorImageRegistryCA) storageDriver() (storage.Driver, bool, er
 	} else if err != nil {
 		return nil, false, err
 	}
+	if err := configureStorageDriver(imageRegistryConfig, driver); err != nil {
+		return nil, false, err
+	}
 
-	canRedirect := !imageRegistryConfig.Spec.DisableRedirect
+	canRedirect := !imageRegistryConfig.Spec.DisableRedirect && driver.Capabilities().SupportsRedirect
 
 	return driver, canRedirect, nil
 }
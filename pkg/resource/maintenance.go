@@ -0,0 +1,45 @@
+package resource
+
+import (
+	"fmt"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// maintenanceGate returns true if the pod template of exp can replace the
+// pod template of cur at now. When rollouts are deferred to the maintenance
+// window, a changed pod template is held back until the window opens and
+// the RolloutDeferred condition of cr says so. Rollbacks to the last
+// known-good pod template are never held back.
+func maintenanceGate(cr *imageregistryv1.Config, configOverrides overrides.ConfigOverrides, cur, exp *appsapi.Deployment, now time.Time) (bool, error) {
+	window, err := configOverrides.MaintenanceWindow()
+	if err != nil {
+		return false, err
+	}
+
+	changed := cur.Annotations[defaults.TemplateChecksumAnnotation] != exp.Annotations[defaults.TemplateChecksumAnnotation]
+	rolledBack := util.FetchCondition(cr, defaults.RolloutRolledBack).Status == operatorv1.ConditionTrue
+	if window == nil || !window.DeferRollouts || !changed || rolledBack || window.Open(now) {
+		if util.FetchCondition(cr, defaults.RolloutDeferred).Status == operatorv1.ConditionTrue {
+			util.UpdateCondition(cr, defaults.RolloutDeferred, operatorv1.ConditionFalse, "AsExpected", "")
+		}
+		return true, nil
+	}
+
+	util.UpdateCondition(
+		cr,
+		defaults.RolloutDeferred,
+		operatorv1.ConditionTrue,
+		"OutsideMaintenanceWindow",
+		fmt.Sprintf("The rollout of pod template %s is deferred to the maintenance window starting at %s", exp.Annotations[defaults.TemplateChecksumAnnotation], window.NextStart(now).Format(time.RFC3339)),
+	)
+	return false, nil
+}
@@ -0,0 +1,121 @@
+package resource
+
+import (
+	"testing"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestMaintenanceGate(t *testing.T) {
+	deployment := func(checksum string) *appsapi.Deployment {
+		return &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{defaults.TemplateChecksumAnnotation: checksum},
+			},
+		}
+	}
+	// Every day from 02:00 to 04:00 UTC.
+	window := &overrides.MaintenanceWindow{StartHour: 2, EndHour: 4, DeferRollouts: true}
+	outside := time.Date(2024, 6, 7, 12, 0, 0, 0, time.UTC)
+	inside := time.Date(2024, 6, 7, 3, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name       string
+		window     *overrides.MaintenanceWindow
+		rolledBack bool
+		cur, exp   string
+		now        time.Time
+		proceed    bool
+		deferred   operatorv1.ConditionStatus
+	}{
+		{
+			name:    "no window",
+			cur:     "a",
+			exp:     "b",
+			now:     outside,
+			proceed: true,
+		},
+		{
+			name:     "rollouts are not deferred",
+			window:   &overrides.MaintenanceWindow{StartHour: 2, EndHour: 4},
+			cur:      "a",
+			exp:      "b",
+			now:      outside,
+			proceed:  true,
+			deferred: operatorv1.ConditionFalse,
+		},
+		{
+			name:     "changed template outside of the window",
+			window:   window,
+			cur:      "a",
+			exp:      "b",
+			now:      outside,
+			deferred: operatorv1.ConditionTrue,
+		},
+		{
+			name:     "changed template in the window",
+			window:   window,
+			cur:      "a",
+			exp:      "b",
+			now:      inside,
+			proceed:  true,
+			deferred: operatorv1.ConditionFalse,
+		},
+		{
+			name:     "unchanged template outside of the window",
+			window:   window,
+			cur:      "a",
+			exp:      "a",
+			now:      outside,
+			proceed:  true,
+			deferred: operatorv1.ConditionFalse,
+		},
+		{
+			name:       "rollback outside of the window",
+			window:     window,
+			rolledBack: true,
+			cur:        "b",
+			exp:        "a",
+			now:        outside,
+			proceed:    true,
+			deferred:   operatorv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			// A previous sync deferred a rollout.
+			util.UpdateCondition(cr, defaults.RolloutDeferred, operatorv1.ConditionTrue, "OutsideMaintenanceWindow", "")
+			if tt.window == nil {
+				cr = &imageregistryv1.Config{}
+				tt.deferred = ""
+			}
+			if tt.rolledBack {
+				util.UpdateCondition(cr, defaults.RolloutRolledBack, operatorv1.ConditionTrue, "ProgressDeadlineExceeded", "")
+			}
+			configOverrides := overrides.ConfigOverrides{}
+			if tt.window != nil {
+				configOverrides.Maintenance = &overrides.MaintenanceOverrides{Window: tt.window}
+			}
+
+			proceed, err := maintenanceGate(cr, configOverrides, deployment(tt.cur), deployment(tt.exp), tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proceed != tt.proceed {
+				t.Errorf("got proceed %t, want %t", proceed, tt.proceed)
+			}
+			if status := util.FetchCondition(cr, defaults.RolloutDeferred).Status; status != tt.deferred {
+				t.Errorf("got %s condition %q, want %q", defaults.RolloutDeferred, status, tt.deferred)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package resource
+
+import (
+	"fmt"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// applyMeshPolicy configures deploy for a service mesh that injects sidecars
+// automatically, according to the mesh overrides of the registry.
+func applyMeshPolicy(deploy *appsapi.Deployment, configOverrides overrides.ConfigOverrides) error {
+	mode, err := configOverrides.MeshMode()
+	if err != nil {
+		return err
+	}
+
+	template := &deploy.Spec.Template
+	if mode != overrides.MeshModeNone && template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	switch mode {
+	case overrides.MeshModeNone:
+		return nil
+	case overrides.MeshModeExclude:
+		// Istio honors the label, older versions and OpenShift Service
+		// Mesh 2 only the annotation.
+		template.Labels = withLabel(template.Labels, defaults.IstioInjectAnnotation, "false")
+		template.Annotations[defaults.IstioInjectAnnotation] = "false"
+		return nil
+	case overrides.MeshModeCompatible:
+		// The registry terminates TLS itself. Its port is not intercepted
+		// by the sidecar, so that the kubelet probes and the clients
+		// outside of the mesh keep reaching it over HTTPS, while clients
+		// in the mesh are accepted as well.
+		template.Annotations[defaults.IstioExcludeInboundPortsAnnotation] = fmt.Sprintf("%d", defaults.ContainerPort)
+		// The registry checks its storage on startup, the sidecar has to
+		// be ready before the registry makes outbound connections.
+		template.Annotations[defaults.IstioProxyConfigAnnotation] = `{"holdApplicationUntilProxyStarts":true}`
+		// Clients in the mesh cannot follow redirects to the storage
+		// when the mesh restricts egress traffic.
+		for i := range template.Spec.Containers {
+			template.Spec.Containers[i].Env = withEnv(template.Spec.Containers[i].Env, "REGISTRY_STORAGE_REDIRECT_DISABLE", "true")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported mesh mode %q", mode)
+	}
+}
+
+// withEnv returns env with name set to value.
+func withEnv(env []corev1.EnvVar, name, value string) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			env[i] = corev1.EnvVar{Name: name, Value: value}
+			return env
+		}
+	}
+	return append(env, corev1.EnvVar{Name: name, Value: value})
+}
@@ -0,0 +1,121 @@
+package resource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestApplyMeshPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		overrides   overrides.ConfigOverrides
+		labels      map[string]string
+		annotations map[string]string
+		env         []corev1.EnvVar
+		err         string
+	}{
+		{
+			name:   "no mesh mode",
+			labels: defaults.DeploymentLabels,
+			env: []corev1.EnvVar{
+				{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "false"},
+			},
+		},
+		{
+			name:      "exclude",
+			overrides: overrides.ConfigOverrides{Mesh: &overrides.MeshOverrides{Mode: overrides.MeshModeExclude}},
+			labels: map[string]string{
+				"docker-registry":              "default",
+				defaults.IstioInjectAnnotation: "false",
+			},
+			annotations: map[string]string{
+				defaults.IstioInjectAnnotation: "false",
+			},
+			env: []corev1.EnvVar{
+				{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "false"},
+			},
+		},
+		{
+			name:      "compatible",
+			overrides: overrides.ConfigOverrides{Mesh: &overrides.MeshOverrides{Mode: overrides.MeshModeCompatible}},
+			labels:    defaults.DeploymentLabels,
+			annotations: map[string]string{
+				defaults.IstioExcludeInboundPortsAnnotation: "5000",
+				defaults.IstioProxyConfigAnnotation:         `{"holdApplicationUntilProxyStarts":true}`,
+			},
+			env: []corev1.EnvVar{
+				{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "true"},
+			},
+		},
+		{
+			name: "compatible with the sidecar disabled",
+			overrides: overrides.ConfigOverrides{
+				Mesh: &overrides.MeshOverrides{Mode: overrides.MeshModeCompatible},
+				Deployment: &overrides.DeploymentOverrides{
+					Annotations: map[string]string{defaults.IstioInjectAnnotation: "false"},
+				},
+			},
+			err: "needs the sidecar",
+		},
+		{
+			name:      "unsupported mode",
+			overrides: overrides.ConfigOverrides{Mesh: &overrides.MeshOverrides{Mode: "Ambient"}},
+			err:       `unsupported mesh mode "Ambient"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy := &appsapi.Deployment{
+				Spec: appsapi.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: defaults.DeploymentLabels,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{
+								Name: "registry",
+								Env: []corev1.EnvVar{
+									{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "false"},
+								},
+							}},
+						},
+					},
+				},
+			}
+
+			err := applyMeshPolicy(deploy, tt.overrides)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := defaults.DeploymentLabels[defaults.IstioInjectAnnotation]; ok {
+				t.Fatalf("the default deployment labels were modified")
+			}
+			template := deploy.Spec.Template
+			if !reflect.DeepEqual(template.Labels, tt.labels) {
+				t.Errorf("expected labels %v, got %v", tt.labels, template.Labels)
+			}
+			if len(template.Annotations) != 0 || len(tt.annotations) != 0 {
+				if !reflect.DeepEqual(template.Annotations, tt.annotations) {
+					t.Errorf("expected annotations %v, got %v", tt.annotations, template.Annotations)
+				}
+			}
+			if !reflect.DeepEqual(template.Spec.Containers[0].Env, tt.env) {
+				t.Errorf("expected env %v, got %v", tt.env, template.Spec.Containers[0].Env)
+			}
+		})
+	}
+}
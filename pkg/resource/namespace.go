@@ -0,0 +1,52 @@
+package resource
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// applyNamespacePodSecurity sets the PodSecurity labels of the operator
+// namespace to labels. The synchronization of the labels with the SCCs is
+// disabled, otherwise it would replace them with levels derived from the
+// SCCs the service accounts can use, which change between releases. The
+// namespace manifest leaves these labels to the operator, so that the cluster
+// version operator does not revert them.
+func applyNamespacePodSecurity(client coreset.NamespacesGetter, labels map[string]string) error {
+	ns, err := client.Namespaces().Get(
+		context.TODO(), defaults.ImageRegistryOperatorNamespace, metav1.GetOptions{},
+	)
+	if err != nil {
+		return err
+	}
+
+	expected := map[string]string{
+		defaults.PodSecurityLabelSyncLabel: "false",
+	}
+	for key, val := range labels {
+		expected[key] = val
+	}
+
+	changed := false
+	ns = ns.DeepCopy()
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	for key, val := range expected {
+		if ns.Labels[key] != val {
+			ns.Labels[key] = val
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	klog.Infof("updating the pod security labels of the namespace %s", ns.Name)
+	_, err = client.Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+	return err
+}
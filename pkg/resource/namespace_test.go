@@ -0,0 +1,65 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestApplyNamespacePodSecurity(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Labels: map[string]string{
+				"openshift.io/cluster-monitoring": "true",
+				defaults.PodSecurityEnforceLabel:  "privileged",
+				defaults.PodSecurityAuditLabel:    "restricted",
+				defaults.PodSecurityWarnLabel:     "restricted",
+			},
+		},
+	})
+
+	labels, err := overrides.ConfigOverrides{
+		PodSecurity: &overrides.PodSecurityOverrides{Warn: "baseline"},
+	}.PodSecurityLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyNamespacePodSecurity(client.CoreV1(), labels); err != nil {
+		t.Fatal(err)
+	}
+
+	ns, err := client.CoreV1().Namespaces().Get(context.Background(), defaults.ImageRegistryOperatorNamespace, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, val := range map[string]string{
+		"openshift.io/cluster-monitoring":  "true",
+		defaults.PodSecurityEnforceLabel:   "privileged",
+		defaults.PodSecurityAuditLabel:     "privileged",
+		defaults.PodSecurityWarnLabel:      "baseline",
+		defaults.PodSecurityLabelSyncLabel: "false",
+	} {
+		if got := ns.Labels[key]; got != val {
+			t.Errorf("expected the label %s to be %q, got %q", key, val, got)
+		}
+	}
+
+	// The namespace is not updated when its labels are up to date.
+	client.ClearActions()
+	if err := applyNamespacePodSecurity(client.CoreV1(), labels); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range client.Actions() {
+		if _, ok := action.(ktesting.UpdateAction); ok {
+			t.Errorf("unexpected update %v", action)
+		}
+	}
+}
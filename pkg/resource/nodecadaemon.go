@@ -5,6 +5,7 @@ import (
 	"os"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
@@ -12,6 +13,7 @@ import (
 	corev1listers "k8s.io/client-go/listers/core/v1"
 
 	operatorv1 "github.com/openshift/api/operator/v1"
+	securityv1 "github.com/openshift/api/security/v1"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
@@ -20,6 +22,7 @@ import (
 
 	assets "github.com/openshift/cluster-image-registry-operator/bindata"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 )
 
 var _ Mutator = &generatorNodeCADaemonSet{}
@@ -30,6 +33,9 @@ type generatorNodeCADaemonSet struct {
 	serviceLister   corev1listers.ServiceNamespaceLister
 	client          appsv1client.AppsV1Interface
 	operatorClient  v1helpers.OperatorClient
+	// pool is the node pool of the daemon set, nil for the daemon set of
+	// the nodes that are not in a pool.
+	pool *overrides.NodeCAPool
 }
 
 func NewGeneratorNodeCADaemonSet(eventRecorder events.Recorder, daemonSetLister appsv1listers.DaemonSetNamespaceLister, serviceLister corev1listers.ServiceNamespaceLister, client appsv1client.AppsV1Interface, operatorClient v1helpers.OperatorClient) Mutator {
@@ -42,6 +48,24 @@ func NewGeneratorNodeCADaemonSet(eventRecorder events.Recorder, daemonSetLister
 	}
 }
 
+// NewGeneratorNodeCAPoolDaemonSet returns the generator of the node-ca
+// daemon set of a node pool with its own CA bundles.
+func NewGeneratorNodeCAPoolDaemonSet(eventRecorder events.Recorder, daemonSetLister appsv1listers.DaemonSetNamespaceLister, client appsv1client.AppsV1Interface, operatorClient v1helpers.OperatorClient, pool overrides.NodeCAPool) Mutator {
+	return &generatorNodeCADaemonSet{
+		eventRecorder:   eventRecorder,
+		daemonSetLister: daemonSetLister,
+		client:          client,
+		operatorClient:  operatorClient,
+		pool:            &pool,
+	}
+}
+
+// NodeCAPoolName returns the name of the node-ca daemon set of the node pool
+// pool.
+func NodeCAPoolName(pool string) string {
+	return defaults.NodeCAName + "-" + pool
+}
+
 func (ds *generatorNodeCADaemonSet) Type() runtime.Object {
 	return &appsv1.DaemonSet{}
 }
@@ -51,17 +75,100 @@ func (ds *generatorNodeCADaemonSet) GetNamespace() string {
 }
 
 func (ds *generatorNodeCADaemonSet) GetName() string {
-	return "node-ca"
+	if ds.pool != nil {
+		return NodeCAPoolName(ds.pool.Name)
+	}
+	return defaults.NodeCAName
 }
 
 func (ds *generatorNodeCADaemonSet) Get() (runtime.Object, error) {
 	return ds.daemonSetLister.Get(ds.GetName())
 }
 
-func (ds *generatorNodeCADaemonSet) expected() *appsv1.DaemonSet {
+func (ds *generatorNodeCADaemonSet) expected(configOverrides overrides.ConfigOverrides) (*appsv1.DaemonSet, error) {
 	daemonSet := resourceread.ReadDaemonSetV1OrDie(assets.MustAsset("nodecadaemon.yaml"))
 	daemonSet.Spec.Template.Spec.Containers[0].Image = os.Getenv("IMAGE")
-	return daemonSet
+	daemonSet.Spec.Template.Annotations[securityv1.RequiredSCCAnnotation] = configOverrides.NodeCASCC()
+
+	settings, err := configOverrides.NodeCAPodSettings()
+	if err != nil {
+		return nil, err
+	}
+	setNodeCAPodSettings(daemonSet, settings)
+
+	if ds.pool != nil {
+		setNodeCAPool(daemonSet, ds.pool)
+		return daemonSet, nil
+	}
+
+	pools, err := configOverrides.NodeCAPools()
+	if err != nil {
+		return nil, err
+	}
+	excludeNodeCAPools(daemonSet, pools)
+	return daemonSet, nil
+}
+
+// setNodeCAPodSettings applies the resources, the priority class and the
+// tolerations of the overrides to the node-ca pods of daemonSet.
+func setNodeCAPodSettings(daemonSet *appsv1.DaemonSet, settings *overrides.NodeCAOverrides) {
+	if settings == nil {
+		return
+	}
+	podSpec := &daemonSet.Spec.Template.Spec
+	if settings.Resources != nil {
+		podSpec.Containers[0].Resources = *settings.Resources
+	}
+	if settings.PriorityClassName != "" {
+		podSpec.PriorityClassName = settings.PriorityClassName
+	}
+	if settings.Tolerations != nil {
+		podSpec.Tolerations = settings.Tolerations
+	}
+}
+
+// setNodeCAPool makes daemonSet the node-ca daemon set of pool: it runs only
+// on the nodes of the pool and installs the CA bundles of the pool.
+func setNodeCAPool(daemonSet *appsv1.DaemonSet, pool *overrides.NodeCAPool) {
+	name := NodeCAPoolName(pool.Name)
+	daemonSet.Name = name
+	daemonSet.Labels = map[string]string{defaults.NodeCAPoolLabel: pool.Name}
+	daemonSet.Spec.Selector.MatchLabels = map[string]string{"name": name}
+	daemonSet.Spec.Template.Labels = map[string]string{"name": name}
+	for key, value := range pool.NodeSelector {
+		daemonSet.Spec.Template.Spec.NodeSelector[key] = value
+	}
+	for _, vol := range daemonSet.Spec.Template.Spec.Volumes {
+		if vol.ConfigMap != nil && vol.ConfigMap.Name == defaults.ImageRegistryCertificatesName {
+			vol.ConfigMap.Name = NodeCAPoolConfigMapName(pool.Name)
+		}
+	}
+}
+
+// excludeNodeCAPools keeps daemonSet off the nodes of pools. The node-ca
+// pods remove the CA bundles they do not know about, the pods of two daemon
+// sets must not run on the same node.
+func excludeNodeCAPools(daemonSet *appsv1.DaemonSet, pools []overrides.NodeCAPool) {
+	if len(pools) == 0 {
+		return
+	}
+	var requirements []corev1.NodeSelectorRequirement
+	for _, pool := range pools {
+		for key, value := range pool.NodeSelector {
+			requirements = append(requirements, corev1.NodeSelectorRequirement{
+				Key:      key,
+				Operator: corev1.NodeSelectorOpNotIn,
+				Values:   []string{value},
+			})
+		}
+	}
+	daemonSet.Spec.Template.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: requirements}},
+			},
+		},
+	}
 }
 
 func (ds *generatorNodeCADaemonSet) Create() (runtime.Object, error) {
@@ -70,9 +177,15 @@ func (ds *generatorNodeCADaemonSet) Create() (runtime.Object, error) {
 }
 
 func (ds *generatorNodeCADaemonSet) Update(o runtime.Object) (runtime.Object, bool, error) {
-	desiredDaemonSet := ds.expected()
-
-	_, opStatus, _, err := ds.operatorClient.GetOperatorState()
+	opSpec, opStatus, _, err := ds.operatorClient.GetOperatorState()
+	if err != nil {
+		return nil, false, err
+	}
+	configOverrides, err := overrides.ParseRaw(opSpec.UnsupportedConfigOverrides.Raw)
+	if err != nil {
+		return nil, false, err
+	}
+	desiredDaemonSet, err := ds.expected(configOverrides)
 	if err != nil {
 		return nil, false, err
 	}
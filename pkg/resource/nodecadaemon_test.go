@@ -2,6 +2,7 @@ package resource
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
@@ -10,14 +11,19 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kfake "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/clock"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	securityv1 "github.com/openshift/api/security/v1"
 	imageregistryfake "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
 	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
 	"github.com/openshift/library-go/pkg/operator/events"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 )
 
 func findToleration(list []corev1.Toleration, cond func(toleration corev1.Toleration) bool) *corev1.Toleration {
@@ -67,4 +73,171 @@ func TestNodeCADaemon(t *testing.T) {
 	if noScheduleToleration == nil {
 		t.Errorf("unable to find toleration for all taints, %#+v", ds.Spec.Template.Spec.Tolerations)
 	}
+	if scc := ds.Spec.Template.Annotations[securityv1.RequiredSCCAnnotation]; scc != "privileged" {
+		t.Errorf("expected the node-ca pods to be pinned to the privileged SCC, got %q", scc)
+	}
+}
+
+func TestNodeCADaemonPools(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+	}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"nodeCA":{"pools":[{"name":"edge","nodeSelector":{"node-role.kubernetes.io/edge":""},"trustedCA":"edge-registries"}]}}`)
+
+	clientset := kfake.NewSimpleClientset()
+	imageregistryClient := imageregistryfake.NewSimpleClientset(cr)
+	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, time.Minute)
+	operatorClient := client.NewConfigOperatorClient(
+		imageregistryClient.ImageregistryV1().Configs(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	imageregistryInformers.Start(ctx.Done())
+	imageregistryInformers.WaitForCacheSync(ctx.Done())
+
+	recorder := events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{})
+
+	obj, err := NewGeneratorNodeCADaemonSet(recorder, nil, nil, clientset.AppsV1(), operatorClient).Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := obj.(*appsv1.DaemonSet)
+	affinity := ds.Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("expected the node-ca daemon set to be kept off the pools, got %#+v", affinity)
+	}
+	expectedTerms := []corev1.NodeSelectorTerm{{
+		MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "node-role.kubernetes.io/edge", Operator: corev1.NodeSelectorOpNotIn, Values: []string{""}}},
+	}}
+	if terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms; !reflect.DeepEqual(terms, expectedTerms) {
+		t.Errorf("expected the node selector terms %#+v, got %#+v", expectedTerms, terms)
+	}
+
+	pool := overrides.NodeCAPool{Name: "edge", NodeSelector: map[string]string{"node-role.kubernetes.io/edge": ""}, TrustedCA: "edge-registries"}
+	obj, err = NewGeneratorNodeCAPoolDaemonSet(recorder, nil, clientset.AppsV1(), operatorClient, pool).Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds = obj.(*appsv1.DaemonSet)
+	if ds.Name != "node-ca-edge" || ds.Labels[defaults.NodeCAPoolLabel] != "edge" {
+		t.Errorf("unexpected metadata of the pool daemon set: %#+v", ds.ObjectMeta)
+	}
+	if ds.Spec.Selector.MatchLabels["name"] != "node-ca-edge" || ds.Spec.Template.Labels["name"] != "node-ca-edge" {
+		t.Errorf("the pool daemon set selects the pods of another daemon set: %#+v", ds.Spec.Selector)
+	}
+	expectedNodeSelector := map[string]string{"kubernetes.io/os": "linux", "node-role.kubernetes.io/edge": ""}
+	if !reflect.DeepEqual(ds.Spec.Template.Spec.NodeSelector, expectedNodeSelector) {
+		t.Errorf("expected the node selector %v, got %v", expectedNodeSelector, ds.Spec.Template.Spec.NodeSelector)
+	}
+	if ds.Spec.Template.Spec.Affinity != nil {
+		t.Errorf("unexpected affinity of the pool daemon set: %#+v", ds.Spec.Template.Spec.Affinity)
+	}
+	var configMapName string
+	for _, vol := range ds.Spec.Template.Spec.Volumes {
+		if vol.ConfigMap != nil {
+			configMapName = vol.ConfigMap.Name
+		}
+	}
+	if configMapName != "image-registry-certificates-edge" {
+		t.Errorf("expected the pool daemon set to mount the CA bundles of the pool, got %q", configMapName)
+	}
+}
+
+func TestNodeCAPoolCAConfig(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, cm := range []*corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: defaults.ImageRegistryOperatorNamespace, Name: defaults.ImageRegistryCertificatesName},
+			Data: map[string]string{
+				"image-registry.openshift-image-registry.svc..5000": "service-ca",
+				"mirror.example.com": "cluster-ca",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: defaults.OpenShiftConfigNamespace, Name: "edge-registries"},
+			Data: map[string]string{
+				"mirror.example.com": "edge-ca",
+				"edge.example.com":   "edge-ca",
+			},
+		},
+	} {
+		if err := indexer.Add(cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lister := corelisters.NewConfigMapLister(indexer)
+
+	pool := overrides.NodeCAPool{Name: "edge", NodeSelector: map[string]string{"node-role.kubernetes.io/edge": ""}, TrustedCA: "edge-registries"}
+	g := NewGeneratorNodeCAPoolCAConfig(lister.ConfigMaps(defaults.ImageRegistryOperatorNamespace), lister.ConfigMaps(defaults.OpenShiftConfigNamespace), nil, pool).(*generatorNodeCAPoolCAConfig)
+	obj, err := g.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := obj.(*corev1.ConfigMap)
+	expected := map[string]string{
+		"image-registry.openshift-image-registry.svc..5000": "service-ca",
+		"mirror.example.com": "edge-ca",
+		"edge.example.com":   "edge-ca",
+	}
+	if !reflect.DeepEqual(cm.Data, expected) {
+		t.Errorf("expected %v, got %v", expected, cm.Data)
+	}
+	if cm.Name != "image-registry-certificates-edge" || cm.Labels[defaults.NodeCAPoolLabel] != "edge" {
+		t.Errorf("unexpected metadata: %#+v", cm.ObjectMeta)
+	}
+
+	g.pool.TrustedCA = "missing"
+	if _, err := g.expected(); err == nil {
+		t.Errorf("expected an error for a missing config map")
+	}
+}
+
+func TestNodeCADaemonPodSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+	}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"nodeCA":{"resources":{"requests":{"cpu":"5m","memory":"20Mi"},"limits":{"memory":"50Mi"}},"priorityClassName":"edge-critical","tolerations":[{"key":"node-role.kubernetes.io/edge","operator":"Exists","effect":"NoSchedule"}]}}`)
+
+	clientset := kfake.NewSimpleClientset()
+	imageregistryClient := imageregistryfake.NewSimpleClientset(cr)
+	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, time.Minute)
+	operatorClient := client.NewConfigOperatorClient(
+		imageregistryClient.ImageregistryV1().Configs(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	imageregistryInformers.Start(ctx.Done())
+	imageregistryInformers.WaitForCacheSync(ctx.Done())
+
+	recorder := events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{})
+	pool := overrides.NodeCAPool{Name: "edge", NodeSelector: map[string]string{"node-role.kubernetes.io/edge": ""}, TrustedCA: "edge-registries"}
+	for _, g := range []Mutator{
+		NewGeneratorNodeCADaemonSet(recorder, nil, nil, clientset.AppsV1(), operatorClient),
+		NewGeneratorNodeCAPoolDaemonSet(recorder, nil, clientset.AppsV1(), operatorClient, pool),
+	} {
+		obj, err := g.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		podSpec := obj.(*appsv1.DaemonSet).Spec.Template.Spec
+		resources := podSpec.Containers[0].Resources
+		if resources.Requests.Cpu().String() != "5m" || resources.Requests.Memory().String() != "20Mi" || resources.Limits.Memory().String() != "50Mi" {
+			t.Errorf("%s: unexpected resources %#+v", g.GetName(), resources)
+		}
+		if podSpec.PriorityClassName != "edge-critical" {
+			t.Errorf("%s: expected the priority class edge-critical, got %q", g.GetName(), podSpec.PriorityClassName)
+		}
+		expectedTolerations := []corev1.Toleration{{Key: "node-role.kubernetes.io/edge", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+		if !reflect.DeepEqual(podSpec.Tolerations, expectedTolerations) {
+			t.Errorf("%s: expected the tolerations %#+v, got %#+v", g.GetName(), expectedTolerations, podSpec.Tolerations)
+		}
+	}
 }
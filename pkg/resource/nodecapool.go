@@ -0,0 +1,117 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// NodeCAPoolConfigMapName returns the name of the config map with the CA
+// bundles that the node-ca daemon set of the node pool pool installs.
+func NodeCAPoolConfigMapName(pool string) string {
+	return defaults.ImageRegistryCertificatesName + "-" + pool
+}
+
+var _ Mutator = &generatorNodeCAPoolCAConfig{}
+
+// generatorNodeCAPoolCAConfig manages the CA bundles of a node pool: the CA
+// bundles that all the nodes trust and the ones of the pool, which take
+// precedence.
+type generatorNodeCAPoolCAConfig struct {
+	lister                corelisters.ConfigMapNamespaceLister
+	openshiftConfigLister corelisters.ConfigMapNamespaceLister
+	client                coreset.CoreV1Interface
+	pool                  overrides.NodeCAPool
+}
+
+func NewGeneratorNodeCAPoolCAConfig(lister corelisters.ConfigMapNamespaceLister, openshiftConfigLister corelisters.ConfigMapNamespaceLister, client coreset.CoreV1Interface, pool overrides.NodeCAPool) Mutator {
+	return &generatorNodeCAPoolCAConfig{
+		lister:                lister,
+		openshiftConfigLister: openshiftConfigLister,
+		client:                client,
+		pool:                  pool,
+	}
+}
+
+func (g *generatorNodeCAPoolCAConfig) Type() runtime.Object {
+	return &corev1.ConfigMap{}
+}
+
+func (g *generatorNodeCAPoolCAConfig) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (g *generatorNodeCAPoolCAConfig) GetName() string {
+	return NodeCAPoolConfigMapName(g.pool.Name)
+}
+
+func (g *generatorNodeCAPoolCAConfig) expected() (runtime.Object, error) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      g.GetName(),
+			Namespace: g.GetNamespace(),
+			Labels:    map[string]string{defaults.NodeCAPoolLabel: g.pool.Name},
+		},
+		Data:       map[string]string{},
+		BinaryData: map[string][]byte{},
+	}
+
+	common, err := g.lister.Get(defaults.ImageRegistryCertificatesName)
+	if err != nil {
+		return cm, fmt.Errorf("%s: unable to get the CA bundles of all the nodes: %s", g.GetName(), err)
+	}
+	trusted, err := g.openshiftConfigLister.Get(g.pool.TrustedCA)
+	if err != nil {
+		return cm, fmt.Errorf("%s: unable to get the CA bundles of the pool %s: %s", g.GetName(), g.pool.Name, err)
+	}
+
+	for _, source := range []*corev1.ConfigMap{common, trusted} {
+		for k, v := range source.Data {
+			cm.Data[k] = v
+		}
+		for k, v := range source.BinaryData {
+			cm.BinaryData[k] = v
+		}
+	}
+	return cm, nil
+}
+
+func (g *generatorNodeCAPoolCAConfig) Get() (runtime.Object, error) {
+	return g.lister.Get(g.GetName())
+}
+
+func (g *generatorNodeCAPoolCAConfig) Create() (runtime.Object, error) {
+	return commonCreate(g, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (g *generatorNodeCAPoolCAConfig) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(g, o, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (g *generatorNodeCAPoolCAConfig) Delete(opts metav1.DeleteOptions) error {
+	return g.client.ConfigMaps(g.GetNamespace()).Delete(
+		context.TODO(), g.GetName(), opts,
+	)
+}
+
+func (g *generatorNodeCAPoolCAConfig) Owned() bool {
+	// like the node-ca daemon sets, the CA bundles of the pools are not
+	// tied to the lifecycle of the registry
+	return false
+}
@@ -5,6 +5,7 @@ import (
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -42,8 +43,17 @@ func (gpdb *generatorPodDisruptionBudget) GetName() string {
 }
 
 func (gpdb *generatorPodDisruptionBudget) expected() (runtime.Object, error) {
+	configOverrides, err := overrides.Parse(gpdb.cr)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := registryReplicas(gpdb.cr, configOverrides)
+	if err != nil {
+		return nil, err
+	}
+
 	minAvailable := intstr.FromInt(1)
-	if gpdb.cr.Spec.Replicas <= 1 {
+	if replicas <= 1 {
 		minAvailable = intstr.FromInt(0)
 	}
 
@@ -13,6 +13,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/ptr"
 
 	configapiv1 "github.com/openshift/api/config/v1"
 	v1 "github.com/openshift/api/imageregistry/v1"
@@ -20,6 +21,7 @@ import (
 	configlisters "github.com/openshift/client-go/config/listers/config/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
 
@@ -40,27 +42,144 @@ func generateLogLevel(cr *v1.Config) string {
 	return "debug"
 }
 
+// generateRequestLoggingEnv returns the environment variables that configure
+// the HTTP request logging of the registry.
+func generateRequestLoggingEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := configOverrides.RequestLoggingMode()
+	if err != nil || mode != overrides.RequestLoggingModeNone {
+		return nil, err
+	}
+	return []corev1.EnvVar{
+		{Name: "REGISTRY_LOG_ACCESSLOG_DISABLED", Value: "true"},
+	}, nil
+}
+
+// generateLogEnv returns the environment variables that configure the level
+// and the format of the registry logs.
+func generateLogEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, err
+	}
+	level, err := configOverrides.RegistryLogLevel()
+	if err != nil {
+		return nil, err
+	}
+	if level == "" {
+		level = generateLogLevel(cr)
+	}
+	format, err := configOverrides.RegistryLogFormat()
+	if err != nil {
+		return nil, err
+	}
+	return []corev1.EnvVar{
+		{Name: "REGISTRY_LOG_LEVEL", Value: level},
+		{Name: "REGISTRY_LOG_FORMATTER", Value: string(format)},
+	}, nil
+}
+
+// generateImportModeEnv returns the environment variables that configure which
+// manifests the registry accepts. Image streams imported in the
+// PreserveOriginal mode reference manifest lists, the registry has to accept
+// them to serve the imported images. The import mode of the cluster is
+// recorded on cr by the ImportModeController.
+func generateImportModeEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptSchema2 := configOverrides.AcceptSchema2()
+	if acceptSchema2 == nil && cr.Annotations[defaults.ImageStreamImportModeAnnotation] == string(configapiv1.ImportModePreserveOriginal) {
+		acceptSchema2 = ptr.To(true)
+	}
+	if acceptSchema2 == nil {
+		return nil, nil
+	}
+	return []corev1.EnvVar{
+		{Name: "REGISTRY_OPENSHIFT_COMPATIBILITY_ACCEPTSCHEMA2", Value: strconv.FormatBool(*acceptSchema2)},
+	}, nil
+}
+
+// generatePullThroughCacheEnv returns the environment variables that make
+// the registry a pull-through cache of an upstream registry, and the secret
+// with the credentials for the upstream registry.
+func generatePullThroughCacheEnv(cr *v1.Config) ([]corev1.EnvVar, string, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return nil, "", err
+	}
+	cache, err := configOverrides.PullThroughCache()
+	if err != nil || cache == nil {
+		return nil, "", err
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "REGISTRY_PROXY_REMOTEURL", Value: cache.RemoteURL},
+	}
+	if cache.TTL != nil {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_PROXY_TTL", Value: cache.TTL.Duration.String()})
+	}
+	if cache.CredentialsSecretName != "" {
+		secretEnv := func(name, key string) corev1.EnvVar {
+			return corev1.EnvVar{
+				Name: name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: cache.CredentialsSecretName,
+						},
+						Key: key,
+					},
+				},
+			}
+		}
+		env = append(env,
+			secretEnv("REGISTRY_PROXY_USERNAME", "username"),
+			secretEnv("REGISTRY_PROXY_PASSWORD", "password"),
+		)
+	}
+	return env, cache.CredentialsSecretName, nil
+}
+
+// generateRedirectEnv returns the environment variables that stop the
+// registry from redirecting clients to the storage. The object storage
+// drivers (S3, GCS, Azure, IBM COS) redirect blob downloads to pre-signed
+// URLs by default, the other drivers always serve the blobs themselves.
+func generateRedirectEnv(cr *v1.Config) []corev1.EnvVar {
+	if !cr.Spec.DisableRedirect {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "true"},
+	}
+}
+
 // generateLivenessProbeConfig returns an HTTPS liveness probe for the image
-// registry.
-func generateLivenessProbeConfig() *corev1.Probe {
-	probeConfig := generateProbeConfig()
+// registry, tuned by settings.
+func generateLivenessProbeConfig(settings *overrides.ProbeSettings) *corev1.Probe {
+	probeConfig := generateProbeConfig(settings)
 	// Wait until the registry is ready to serve requests.
 	probeConfig.InitialDelaySeconds = 5
 	return probeConfig
 }
 
 // generateReadinessProbeConfig returns an HTTPS readiness probe for the image
-// registry.
-func generateReadinessProbeConfig() *corev1.Probe {
-	probeConfig := generateProbeConfig()
+// registry, tuned by settings.
+func generateReadinessProbeConfig(settings *overrides.ProbeSettings) *corev1.Probe {
+	probeConfig := generateProbeConfig(settings)
 	// Wait until the registry checks its storage health before reporting
 	// the registry as Ready.
 	probeConfig.InitialDelaySeconds = 15
 	return probeConfig
 }
 
-func generateProbeConfig() *corev1.Probe {
-	return &corev1.Probe{
+func generateProbeConfig(settings *overrides.ProbeSettings) *corev1.Probe {
+	probeConfig := &corev1.Probe{
 		TimeoutSeconds: int32(defaults.HealthzTimeoutSeconds),
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
@@ -70,6 +189,19 @@ func generateProbeConfig() *corev1.Probe {
 			},
 		},
 	}
+	if settings == nil {
+		return probeConfig
+	}
+	if settings.TimeoutSeconds != 0 {
+		probeConfig.TimeoutSeconds = settings.TimeoutSeconds
+	}
+	if settings.PeriodSeconds != 0 {
+		probeConfig.PeriodSeconds = settings.PeriodSeconds
+	}
+	if settings.FailureThreshold != 0 {
+		probeConfig.FailureThreshold = settings.FailureThreshold
+	}
+	return probeConfig
 }
 
 func generateSecurityContext(coreClient coreset.CoreV1Interface, namespace string) (*corev1.PodSecurityContext, error) {
@@ -163,7 +295,6 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		corev1.EnvVar{Name: "REGISTRY_HTTP_ADDR", Value: fmt.Sprintf(":%d", defaults.ContainerPort)},
 		corev1.EnvVar{Name: "REGISTRY_HTTP_NET", Value: "tcp"},
 		corev1.EnvVar{Name: "REGISTRY_HTTP_SECRET", Value: cr.Spec.HTTPSecret},
-		corev1.EnvVar{Name: "REGISTRY_LOG_LEVEL", Value: generateLogLevel(cr)},
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_QUOTA_ENABLED", Value: "true"},
 		corev1.EnvVar{Name: "REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR", Value: "inmemory"},
 		corev1.EnvVar{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: "true"},
@@ -175,13 +306,40 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_SERVER_ADDR", Value: fmt.Sprintf("%s.%s.svc:%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort)},
 	)
 
-	if cr.Spec.ReadOnly {
-		env = append(env, corev1.EnvVar{Name: "REGISTRY_STORAGE_MAINTENANCE_READONLY", Value: "{enabled: true}"})
+	logEnv, err := generateLogEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
 	}
+	env = append(env, logEnv...)
 
-	if cr.Spec.DisableRedirect {
-		env = append(env, corev1.EnvVar{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "true"})
+	requestLoggingEnv, err := generateRequestLoggingEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, requestLoggingEnv...)
+
+	importModeEnv, err := generateImportModeEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
 	}
+	env = append(env, importModeEnv...)
+
+	cacheEnv, cacheSecretName, err := generatePullThroughCacheEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, cacheEnv...)
+	if cacheSecretName != "" {
+		deps.AddSecret(cacheSecretName)
+	}
+
+	// the registry is also switched to read-only mode while its storage
+	// rejects writes, pushes fail anyway but pulls keep working.
+	if cr.Spec.ReadOnly || storage.WritesFailing(cr) {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_STORAGE_MAINTENANCE_READONLY", Value: "{enabled: true}"})
+	}
+
+	env = append(env, generateRedirectEnv(cr)...)
 
 	if cr.Spec.Proxy.HTTP != "" {
 		env = append(env, corev1.EnvVar{Name: "HTTP_PROXY", Value: cr.Spec.Proxy.HTTP})
@@ -234,6 +392,18 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		return corev1.PodTemplateSpec{}, deps, fmt.Errorf("generate security context for deployment config: %s", err)
 	}
 
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	// The serving certificate is a dependency, the registry is rolled out
+	// when its content changes.
+	servingCertSecretName, _ := configOverrides.ServingCertSecretName()
+	livenessSettings, readinessSettings, err := configOverrides.RegistryProbes()
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+
 	vol := corev1.Volume{
 		Name: "registry-tls",
 		VolumeSource: corev1.VolumeSource{
@@ -242,7 +412,7 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 					{
 						Secret: &corev1.SecretProjection{
 							LocalObjectReference: corev1.LocalObjectReference{
-								Name: defaults.ImageRegistryName + "-tls",
+								Name: servingCertSecretName,
 							},
 						},
 					},
@@ -368,6 +538,11 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 	}
 	mounts = append(mounts, saMount)
 
+	env, err = renderRegistryConfigEnv(env)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+
 	image := os.Getenv("IMAGE")
 
 	resources := corev1.ResourceRequirements{
@@ -440,9 +615,14 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 
 	// if user has provided an affinity through config spec we use it here, if not
 	// then we fallback to a preferred affinity configuration. we only require a
-	// certain affinity during schedule if the number of replicas is defined to two.
+	// certain affinity during schedule if the number of replicas is defined to two
+	// and the registry is not autoscaled beyond the number of nodes.
+	autoscaler, err := configOverrides.Autoscaler(cr.Spec.Replicas)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, nil, err
+	}
 	affinity := cr.Spec.Affinity
-	if affinity == nil && cr.Spec.Replicas == 2 {
+	if affinity == nil && cr.Spec.Replicas == 2 && autoscaler == nil {
 		affinity = &corev1.Affinity{
 			PodAntiAffinity: &corev1.PodAntiAffinity{
 				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
@@ -496,8 +676,8 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 					},
 					Env:            env,
 					VolumeMounts:   mounts,
-					LivenessProbe:  generateLivenessProbeConfig(),
-					ReadinessProbe: generateReadinessProbeConfig(),
+					LivenessProbe:  generateLivenessProbeConfig(livenessSettings),
+					ReadinessProbe: generateReadinessProbeConfig(readinessSettings),
 					Resources:      resources,
 					// Once the pod is deleted, its endpoint should be removed
 					// from routers, load balancers, and nodes. We'll give 25
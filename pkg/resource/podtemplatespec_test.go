@@ -12,10 +12,12 @@ import (
 
 	configv1 "github.com/openshift/api/config/v1"
 	v1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/s3"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
@@ -560,3 +562,241 @@ func TestMakePodTemplateSpecS3CloudFront(t *testing.T) {
 		t.Errorf("expected env var %s not found", name)
 	}
 }
+
+func TestGenerateRequestLoggingEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  []corev1.EnvVar
+		err       string
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "all requests",
+			overrides: `{"logging":{"requests":{"mode":"All"}}}`,
+		},
+		{
+			name:      "none",
+			overrides: `{"logging":{"requests":{"mode":"None"}}}`,
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_LOG_ACCESSLOG_DISABLED", Value: "true"},
+			},
+		},
+		{
+			name:      "unknown mode",
+			overrides: `{"logging":{"requests":{"mode":"Verbose"}}}`,
+			err:       `unsupported request logging mode "Verbose"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			env, err := generateRequestLoggingEnv(cr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(env, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, env)
+			}
+		})
+	}
+}
+
+func TestGenerateImportModeEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		importMode configv1.ImportModeType
+		overrides  string
+		expected   []corev1.EnvVar
+	}{
+		{
+			name: "unknown import mode",
+		},
+		{
+			name:       "legacy",
+			importMode: configv1.ImportModeLegacy,
+		},
+		{
+			name:       "preserve original",
+			importMode: configv1.ImportModePreserveOriginal,
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_OPENSHIFT_COMPATIBILITY_ACCEPTSCHEMA2", Value: "true"},
+			},
+		},
+		{
+			name:       "preserve original with schema 2 refused",
+			importMode: configv1.ImportModePreserveOriginal,
+			overrides:  `{"manifests":{"acceptSchema2":false}}`,
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_OPENSHIFT_COMPATIBILITY_ACCEPTSCHEMA2", Value: "false"},
+			},
+		},
+		{
+			name:       "legacy with schema 2 accepted",
+			importMode: configv1.ImportModeLegacy,
+			overrides:  `{"manifests":{"acceptSchema2":true}}`,
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_OPENSHIFT_COMPATIBILITY_ACCEPTSCHEMA2", Value: "true"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			if tt.importMode != "" {
+				cr.Annotations = map[string]string{
+					defaults.ImageStreamImportModeAnnotation: string(tt.importMode),
+				}
+			}
+
+			env, err := generateImportModeEnv(cr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(env, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, env)
+			}
+		})
+	}
+}
+
+func TestGenerateLogEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		logLevel  operatorapiv1.LogLevel
+		overrides string
+		expected  []corev1.EnvVar
+		err       string
+	}{
+		{
+			name: "no overrides",
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_LOG_LEVEL", Value: "info"},
+				{Name: "REGISTRY_LOG_FORMATTER", Value: "text"},
+			},
+		},
+		{
+			name:     "debug log level",
+			logLevel: operatorapiv1.Debug,
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_LOG_LEVEL", Value: "debug"},
+				{Name: "REGISTRY_LOG_FORMATTER", Value: "text"},
+			},
+		},
+		{
+			name:      "level and format",
+			logLevel:  operatorapiv1.Debug,
+			overrides: `{"logging":{"level":"warn","format":"json"}}`,
+			expected: []corev1.EnvVar{
+				{Name: "REGISTRY_LOG_LEVEL", Value: "warn"},
+				{Name: "REGISTRY_LOG_FORMATTER", Value: "json"},
+			},
+		},
+		{
+			name:      "unknown format",
+			overrides: `{"logging":{"format":"logfmt"}}`,
+			err:       `unsupported log format "logfmt"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1.Config{}
+			cr.Spec.LogLevel = tt.logLevel
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			env, err := generateLogEnv(cr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(env, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, env)
+			}
+		})
+	}
+}
+
+func TestGeneratePullThroughCacheEnv(t *testing.T) {
+	cr := &v1.Config{}
+	env, secretName, err := generatePullThroughCacheEnv(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env != nil || secretName != "" {
+		t.Errorf("expected no pull-through cache, got %v %q", env, secretName)
+	}
+
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"cache":{"remoteURL":"https://registry.example.com","credentialsSecretName":"upstream","ttl":"24h"}}`)
+	env, secretName, err = generatePullThroughCacheEnv(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secretName != "upstream" {
+		t.Errorf("expected the secret upstream, got %q", secretName)
+	}
+	secretEnv := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "upstream"},
+					Key:                  key,
+				},
+			},
+		}
+	}
+	expected := []corev1.EnvVar{
+		{Name: "REGISTRY_PROXY_REMOTEURL", Value: "https://registry.example.com"},
+		{Name: "REGISTRY_PROXY_TTL", Value: "24h0m0s"},
+		secretEnv("REGISTRY_PROXY_USERNAME", "username"),
+		secretEnv("REGISTRY_PROXY_PASSWORD", "password"),
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+}
+
+func TestGenerateRedirectEnv(t *testing.T) {
+	cr := &v1.Config{}
+	if env := generateRedirectEnv(cr); env != nil {
+		t.Errorf("expected no env vars when redirects are enabled, got %v", env)
+	}
+
+	cr.Spec.DisableRedirect = true
+	expected := []corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE_REDIRECT_DISABLE", Value: "true"},
+	}
+	if env := generateRedirectEnv(cr); !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+}
+
+func TestGenerateProbeConfig(t *testing.T) {
+	liveness := generateLivenessProbeConfig(nil)
+	if liveness.TimeoutSeconds != defaults.HealthzTimeoutSeconds || liveness.PeriodSeconds != 0 || liveness.FailureThreshold != 0 || liveness.InitialDelaySeconds != 5 {
+		t.Errorf("unexpected default liveness probe: %+v", liveness)
+	}
+
+	readiness := generateReadinessProbeConfig(&overrides.ProbeSettings{TimeoutSeconds: 20, PeriodSeconds: 30, FailureThreshold: 6})
+	if readiness.TimeoutSeconds != 20 || readiness.PeriodSeconds != 30 || readiness.FailureThreshold != 6 || readiness.InitialDelaySeconds != 15 {
+		t.Errorf("unexpected tuned readiness probe: %+v", readiness)
+	}
+
+	liveness = generateLivenessProbeConfig(&overrides.ProbeSettings{FailureThreshold: 10})
+	if liveness.TimeoutSeconds != defaults.HealthzTimeoutSeconds || liveness.FailureThreshold != 10 {
+		t.Errorf("unexpected partially tuned liveness probe: %+v", liveness)
+	}
+}
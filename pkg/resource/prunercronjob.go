@@ -8,11 +8,13 @@ import (
 	batchapi "k8s.io/api/batch/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
 	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/utils/ptr"
 
 	imageregistryapiv1 "github.com/openshift/api/imageregistry/v1"
 	securityv1 "github.com/openshift/api/security/v1"
@@ -21,6 +23,7 @@ import (
 	"github.com/openshift/library-go/pkg/operator/loglevel"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 )
 
 var (
@@ -45,18 +48,20 @@ var (
 var _ Mutator = &generatorPrunerCronJob{}
 
 type generatorPrunerCronJob struct {
-	lister            batchlisters.CronJobNamespaceLister
-	client            batchset.BatchV1Interface
-	prunerLister      imageregistryv1listers.ImagePrunerLister
-	imageConfigLister configv1listers.ImageLister
+	lister               batchlisters.CronJobNamespaceLister
+	client               batchset.BatchV1Interface
+	prunerLister         imageregistryv1listers.ImagePrunerLister
+	imageConfigLister    configv1listers.ImageLister
+	registryConfigLister imageregistryv1listers.ConfigLister
 }
 
-func newGeneratorPrunerCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, imageConfigLister configv1listers.ImageLister) *generatorPrunerCronJob {
+func newGeneratorPrunerCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, imageConfigLister configv1listers.ImageLister, registryConfigLister imageregistryv1listers.ConfigLister) *generatorPrunerCronJob {
 	return &generatorPrunerCronJob{
-		lister:            lister,
-		client:            client,
-		prunerLister:      prunerLister,
-		imageConfigLister: imageConfigLister,
+		lister:               lister,
+		client:               client,
+		prunerLister:         prunerLister,
+		imageConfigLister:    imageConfigLister,
+		registryConfigLister: registryConfigLister,
 	}
 }
 
@@ -115,6 +120,11 @@ done
 		args = append(args, "--prune-registry=false")
 	}
 
+	schedule, timeZone, err := gcj.getSchedule(cr)
+	if err != nil {
+		return nil, err
+	}
+
 	backoffLimit := int32(0)
 	cj := &batchapi.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
@@ -123,7 +133,8 @@ done
 		},
 		Spec: batchapi.CronJobSpec{
 			Suspend:                    gcj.getSuspend(cr),
-			Schedule:                   gcj.getSchedule(cr),
+			Schedule:                   schedule,
+			TimeZone:                   timeZone,
 			ConcurrencyPolicy:          batchapi.ForbidConcurrent,
 			FailedJobsHistoryLimit:     gcj.getFailedJobsHistoryLimit(cr),
 			SuccessfulJobsHistoryLimit: gcj.getSuccessfulJobsHistoryLimit(cr),
@@ -174,6 +185,15 @@ done
 			},
 		},
 	}
+	interlock, err := gcj.getPruneInterlock()
+	if err != nil {
+		return nil, err
+	}
+	if interlock {
+		// the jobs are started by the image pruner controller once no
+		// builds are in progress.
+		cj.Spec.JobTemplate.Spec.Suspend = ptr.To(true)
+	}
 	cj.Spec.JobTemplate.Labels = map[string]string{"created-by": gcj.GetName()}
 	cj.Spec.JobTemplate.Annotations = map[string]string{securityv1.RequiredSCCAnnotation: "restricted-v2"}
 	return cj, nil
@@ -186,11 +206,49 @@ func (gcj *generatorPrunerCronJob) getSuspend(cr *imageregistryapiv1.ImagePruner
 	return &defaultSuspend
 }
 
-func (gcj *generatorPrunerCronJob) getSchedule(cr *imageregistryapiv1.ImagePruner) string {
+// getSchedule returns the schedule of the pruner and its time zone. Unless
+// the pruner has its own schedule, it runs when the maintenance window of the
+// registry opens.
+func (gcj *generatorPrunerCronJob) getSchedule(cr *imageregistryapiv1.ImagePruner) (string, *string, error) {
 	if len(cr.Spec.Schedule) != 0 {
-		return cr.Spec.Schedule
+		return cr.Spec.Schedule, nil, nil
+	}
+
+	registryConfig, err := gcj.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return defaultSchedule, nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	configOverrides, err := overrides.Parse(registryConfig)
+	if err != nil {
+		return "", nil, err
+	}
+	window, err := configOverrides.MaintenanceWindow()
+	if err != nil {
+		return "", nil, err
+	}
+	if window == nil {
+		return defaultSchedule, nil, nil
+	}
+	return window.CronSchedule(), ptr.To(window.TimeZoneName()), nil
+}
+
+// getPruneInterlock returns true if the pruner jobs have to wait for the
+// builds in progress.
+func (gcj *generatorPrunerCronJob) getPruneInterlock() (bool, error) {
+	registryConfig, err := gcj.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	configOverrides, err := overrides.Parse(registryConfig)
+	if err != nil {
+		return false, err
 	}
-	return defaultSchedule
+	enabled, _, err := configOverrides.PruneInterlock()
+	return enabled, err
 }
 
 func (gcj *generatorPrunerCronJob) getAffinity(cr *imageregistryapiv1.ImagePruner) *kcorev1.Affinity {
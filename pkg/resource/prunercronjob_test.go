@@ -1,12 +1,18 @@
 package resource
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
 func TestGetKeepYoungerThan(t *testing.T) {
@@ -90,3 +96,104 @@ func TestLogLevel(t *testing.T) {
 		}
 	}
 }
+
+func TestGetSchedule(t *testing.T) {
+	registryConfig := func(rawOverrides string) *imageregistryv1.Config {
+		cr := &imageregistryv1.Config{
+			ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+		}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(rawOverrides)
+		return cr
+	}
+
+	for _, tc := range []struct {
+		name         string
+		schedule     string
+		config       *imageregistryv1.Config
+		wantSchedule string
+		wantTimeZone *string
+	}{
+		{
+			name:         "no registry config",
+			wantSchedule: defaultSchedule,
+		},
+		{
+			name:         "no maintenance window",
+			config:       registryConfig(""),
+			wantSchedule: defaultSchedule,
+		},
+		{
+			name:         "maintenance window",
+			config:       registryConfig(`{"maintenance":{"window":{"days":["Saturday"],"startHour":1,"endHour":5,"timeZone":"UTC"}}}`),
+			wantSchedule: "0 1 * * 6",
+			wantTimeZone: ptr.To("UTC"),
+		},
+		{
+			name:         "pruner schedule wins",
+			schedule:     "30 * * * *",
+			config:       registryConfig(`{"maintenance":{"window":{"startHour":1,"endHour":5}}}`),
+			wantSchedule: "30 * * * *",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tc.config != nil {
+				if err := indexer.Add(tc.config); err != nil {
+					t.Fatal(err)
+				}
+			}
+			g := generatorPrunerCronJob{registryConfigLister: imageregistryv1listers.NewConfigLister(indexer)}
+			pruner := &imageregistryv1.ImagePruner{
+				Spec: imageregistryv1.ImagePrunerSpec{Schedule: tc.schedule},
+			}
+
+			schedule, timeZone, err := g.getSchedule(pruner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if schedule != tc.wantSchedule {
+				t.Errorf("got schedule %q, want %q", schedule, tc.wantSchedule)
+			}
+			if !reflect.DeepEqual(timeZone, tc.wantTimeZone) {
+				t.Errorf("got time zone %v, want %v", ptr.Deref(timeZone, "<nil>"), ptr.Deref(tc.wantTimeZone, "<nil>"))
+			}
+		})
+	}
+}
+
+func TestGetPruneInterlock(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		overrides string
+		want      bool
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "interlock enabled",
+			overrides: `{"maintenance":{"pruneInterlock":{"enabled":true}}}`,
+			want:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tc.overrides)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(cr); err != nil {
+				t.Fatal(err)
+			}
+			g := generatorPrunerCronJob{registryConfigLister: imageregistryv1listers.NewConfigLister(indexer)}
+
+			got, err := g.getPruneInterlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
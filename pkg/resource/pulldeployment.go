@@ -0,0 +1,246 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	appsset "k8s.io/client-go/kubernetes/typed/apps/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	securityv1 "github.com/openshift/api/security/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+var _ Mutator = &generatorPullDeployment{}
+
+// generatorPullDeployment manages the read-only registry replicas that serve
+// the pull endpoint. They run the same configuration as the registry
+// deployment, but refuse writes and serve their own certificate.
+type generatorPullDeployment struct {
+	eventRecorder   events.Recorder
+	lister          appslisters.DeploymentNamespaceLister
+	configMapLister corelisters.ConfigMapNamespaceLister
+	secretLister    corelisters.SecretNamespaceLister
+	proxyLister     configlisters.ProxyLister
+	coreClient      coreset.CoreV1Interface
+	client          appsset.AppsV1Interface
+	driver          storage.Driver
+	cr              *imageregistryv1.Config
+}
+
+func newGeneratorPullDeployment(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, secretLister corelisters.SecretNamespaceLister, proxyLister configlisters.ProxyLister, coreClient coreset.CoreV1Interface, client appsset.AppsV1Interface, driver storage.Driver, cr *imageregistryv1.Config) *generatorPullDeployment {
+	return &generatorPullDeployment{
+		eventRecorder:   eventRecorder,
+		lister:          lister,
+		configMapLister: configMapLister,
+		secretLister:    secretLister,
+		proxyLister:     proxyLister,
+		coreClient:      coreClient,
+		client:          client,
+		driver:          driver,
+		cr:              cr,
+	}
+}
+
+func (gd *generatorPullDeployment) Type() runtime.Object {
+	return &appsapi.Deployment{}
+}
+
+func (gd *generatorPullDeployment) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gd *generatorPullDeployment) GetName() string {
+	return defaults.ImageRegistryPullName
+}
+
+func (gd *generatorPullDeployment) expected() (*appsapi.Deployment, error) {
+	if gd.driver == nil {
+		return nil, fmt.Errorf("no storage driver present")
+	}
+	// The pull replicas serve the blobs pushed to the push replicas, they
+	// need the same storage.
+	if !gd.driver.Capabilities().MultiWriterSafe {
+		return nil, fmt.Errorf("the split pull endpoint needs a storage shared by the registry replicas")
+	}
+
+	configOverrides, err := overrides.Parse(gd.cr)
+	if err != nil {
+		return nil, err
+	}
+
+	podTemplateSpec, deps, err := makePodTemplateSpec(gd.coreClient, gd.proxyLister, gd.driver, gd.cr)
+	if err != nil {
+		return nil, err
+	}
+	pullPodTemplateSpec(&podTemplateSpec, gd.cr.Spec.ReadOnly)
+	deps.AddSecret(defaults.ImageRegistryPullName + "-tls")
+
+	depsChecksum, err := deps.Checksum(gd.configMapLister, gd.secretLister)
+	if err != nil {
+		return nil, err
+	}
+
+	if podTemplateSpec.Annotations == nil {
+		podTemplateSpec.Annotations = map[string]string{}
+	}
+	podTemplateSpec.Annotations[defaults.ChecksumOperatorDepsAnnotation] = depsChecksum
+
+	caChecksum, err := trustedCAChecksum(gd.configMapLister)
+	if err != nil {
+		return nil, err
+	}
+	podTemplateSpec.Annotations[defaults.TrustedCAChecksumAnnotation] = caChecksum
+	podTemplateSpec.Annotations[securityv1.RequiredSCCAnnotation] = configOverrides.RegistrySCC()
+
+	replicas, _, err := configOverrides.PullEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	if replicas == 0 {
+		replicas = gd.cr.Spec.Replicas
+	}
+
+	deploy := &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gd.GetName(),
+			Namespace: gd.GetNamespace(),
+			Labels:    defaults.PullLabels,
+			Annotations: map[string]string{
+				defaults.VersionAnnotation: os.Getenv("RELEASE_VERSION"),
+			},
+		},
+		Spec: appsapi.DeploymentSpec{
+			ProgressDeadlineSeconds: ptr.To[int32](60),
+			RevisionHistoryLimit:    ptr.To[int32](defaults.RevisionHistoryLimit),
+			Replicas:                ptr.To(replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: defaults.PullLabels,
+			},
+			Template: podTemplateSpec,
+		},
+	}
+
+	if depoverrides := configOverrides.Deployment; depoverrides != nil {
+		deploy.Spec.Template.Spec.RuntimeClassName = depoverrides.RuntimeClassName
+		for key, val := range depoverrides.Annotations {
+			deploy.Annotations[key] = val
+			deploy.Spec.Template.Annotations[key] = val
+		}
+	}
+
+	if err := applyBackupPolicy(deploy, gd.cr, configOverrides); err != nil {
+		return nil, err
+	}
+
+	if err := applyMeshPolicy(deploy, configOverrides); err != nil {
+		return nil, err
+	}
+
+	if err := applyCredentialsSourceVolume(deploy, configOverrides); err != nil {
+		return nil, err
+	}
+
+	dgst, err := strategy.Checksum(deploy)
+	if err != nil {
+		return nil, err
+	}
+	deploy.ObjectMeta.Annotations[defaults.ChecksumOperatorAnnotation] = dgst
+
+	return deploy, nil
+}
+
+// pullPodTemplateSpec turns the pod template of the registry into the pod
+// template of the read-only replicas.
+func pullPodTemplateSpec(template *corev1.PodTemplateSpec, readOnly bool) {
+	template.Labels = map[string]string{}
+	for k, v := range defaults.PullLabels {
+		template.Labels[k] = v
+	}
+
+	// The read-only replicas are spread by the same rules as the registry
+	// replicas, but independently of them.
+	retarget := func(selector *metav1.LabelSelector) {
+		if selector != nil && reflect.DeepEqual(selector.MatchLabels, defaults.DeploymentLabels) {
+			selector.MatchLabels = defaults.PullLabels
+		}
+	}
+	for i := range template.Spec.TopologySpreadConstraints {
+		retarget(template.Spec.TopologySpreadConstraints[i].LabelSelector)
+	}
+	if affinity := template.Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+		for i := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			retarget(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[i].LabelSelector)
+		}
+	}
+
+	for _, vol := range template.Spec.Volumes {
+		if vol.Name == "registry-tls" && vol.Projected != nil {
+			vol.Projected.Sources[0].Secret.Name = defaults.ImageRegistryPullName + "-tls"
+		}
+	}
+
+	if readOnly {
+		return
+	}
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Env = append(template.Spec.Containers[i].Env,
+			corev1.EnvVar{Name: "REGISTRY_STORAGE_MAINTENANCE_READONLY", Value: "{enabled: true}"},
+		)
+	}
+}
+
+func (gd *generatorPullDeployment) Get() (runtime.Object, error) {
+	return gd.lister.Get(gd.GetName())
+}
+
+func (gd *generatorPullDeployment) Create() (runtime.Object, error) {
+	dep, _, err := gd.Update(nil)
+	return dep, err
+}
+
+func (gd *generatorPullDeployment) Update(o runtime.Object) (runtime.Object, bool, error) {
+	exp, err := gd.expected()
+	if err != nil {
+		return o, false, err
+	}
+
+	dep, updated, err := resourceapply.ApplyDeployment(
+		context.TODO(), gd.client, gd.eventRecorder, exp,
+		resourcemerge.ExpectedDeploymentGeneration(exp, gd.cr.Status.Generations),
+	)
+	if err != nil {
+		return o, false, err
+	}
+
+	resourcemerge.SetDeploymentGeneration(&gd.cr.Status.Generations, dep)
+	return dep, updated, nil
+}
+
+func (gd *generatorPullDeployment) Delete(opts metav1.DeleteOptions) error {
+	return gd.client.Deployments(gd.GetNamespace()).Delete(
+		context.TODO(), gd.GetName(), opts,
+	)
+}
+
+func (gd *generatorPullDeployment) Owned() bool {
+	return true
+}
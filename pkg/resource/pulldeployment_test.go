@@ -0,0 +1,158 @@
+package resource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	fakeconfig "github.com/openshift/client-go/config/clientset/versioned/fake"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+)
+
+func TestPullPodTemplateSpec(t *testing.T) {
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: defaults.DeploymentLabels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "registry"}},
+			Volumes: []corev1.Volume{
+				{
+					Name: "registry-tls",
+					VolumeSource: corev1.VolumeSource{
+						Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{
+								{
+									Secret: &corev1.SecretProjection{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: defaults.ImageRegistryName + "-tls",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+				{
+					TopologyKey:   "kubernetes.io/hostname",
+					LabelSelector: &metav1.LabelSelector{MatchLabels: defaults.DeploymentLabels},
+				},
+				{
+					TopologyKey:   "topology.kubernetes.io/zone",
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "custom"}},
+				},
+			},
+		},
+	}
+
+	pullPodTemplateSpec(&template, false)
+
+	if !reflect.DeepEqual(template.Labels, defaults.PullLabels) {
+		t.Errorf("expected labels %v, got %v", defaults.PullLabels, template.Labels)
+	}
+	if !reflect.DeepEqual(defaults.DeploymentLabels, map[string]string{"docker-registry": "default"}) {
+		t.Errorf("the registry deployment labels have been modified: %v", defaults.DeploymentLabels)
+	}
+	if selector := template.Spec.TopologySpreadConstraints[0].LabelSelector.MatchLabels; !reflect.DeepEqual(selector, defaults.PullLabels) {
+		t.Errorf("expected the default topology spread constraint to select %v, got %v", defaults.PullLabels, selector)
+	}
+	if selector := template.Spec.TopologySpreadConstraints[1].LabelSelector.MatchLabels; selector["app"] != "custom" {
+		t.Errorf("expected custom topology spread constraint to be kept, got %v", selector)
+	}
+	if secret := template.Spec.Volumes[0].Projected.Sources[0].Secret.Name; secret != defaults.ImageRegistryPullName+"-tls" {
+		t.Errorf("expected the serving certificate %s-tls, got %s", defaults.ImageRegistryPullName, secret)
+	}
+
+	found := false
+	for _, env := range template.Spec.Containers[0].Env {
+		if env.Name == "REGISTRY_STORAGE_MAINTENANCE_READONLY" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the read-only mode to be enabled, got %v", template.Spec.Containers[0].Env)
+	}
+}
+
+func TestPullDeploymentNeedsSharedStorage(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	gd := newGeneratorPullDeployment(nil, nil, nil, nil, nil, nil, nil, emptydir.NewDriver(&imageregistryv1.ImageRegistryConfigStorageEmptyDir{}), cr)
+	if _, err := gd.expected(); err == nil || !strings.Contains(err.Error(), "shared by the registry replicas") {
+		t.Errorf("expected an error for the EmptyDir storage, got %v", err)
+	}
+}
+
+type storageEnvDriver struct {
+	testDriver
+	bucket string
+}
+
+func (d *storageEnvDriver) ConfigEnv() (envvar.List, error) {
+	return envvar.List{
+		{Name: "REGISTRY_STORAGE", Value: "s3"},
+		{Name: "REGISTRY_STORAGE_S3_BUCKET", Value: d.bucket},
+	}, nil
+}
+
+func TestPullDeploymentStorageInSync(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	})
+	kubeInformer := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	configInformer := configinformers.NewSharedInformerFactory(fakeconfig.NewSimpleClientset(), 0)
+	cmLister := kubeInformer.Core().V1().ConfigMaps().Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	secretLister := kubeInformer.Core().V1().Secrets().Lister().Secrets(defaults.ImageRegistryOperatorNamespace)
+	proxyLister := configInformer.Config().V1().Proxies().Lister()
+
+	storageEnv := func(dep *appsapi.Deployment) map[string]string {
+		env := map[string]string{}
+		for _, e := range dep.Spec.Template.Spec.Containers[0].Env {
+			if strings.HasPrefix(e.Name, "REGISTRY_STORAGE") && e.Name != "REGISTRY_STORAGE_MAINTENANCE_READONLY" {
+				env[e.Name] = e.Value
+			}
+		}
+		return env
+	}
+
+	cr := &imageregistryv1.Config{Spec: imageregistryv1.ImageRegistrySpec{Replicas: 2}}
+	for _, bucket := range []string{"bucket-a", "bucket-b"} {
+		driver := &storageEnvDriver{bucket: bucket}
+		gd := newGeneratorDeployment(nil, nil, cmLister, secretLister, proxyLister, kubeClient.CoreV1(), nil, driver, nil, cr)
+		gpd := newGeneratorPullDeployment(nil, nil, cmLister, secretLister, proxyLister, kubeClient.CoreV1(), nil, driver, cr)
+
+		obj, err := gd.expected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pull, err := gpd.expected()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		registryEnv := storageEnv(obj.(*appsapi.Deployment))
+		if registryEnv["REGISTRY_STORAGE_S3_BUCKET"] != bucket {
+			t.Fatalf("expected the registry to use the bucket %s, got %v", bucket, registryEnv)
+		}
+		if pullEnv := storageEnv(pull); !reflect.DeepEqual(pullEnv, registryEnv) {
+			t.Errorf("expected the read-only replicas to use the storage of the registry %v, got %v", registryEnv, pullEnv)
+		}
+	}
+}
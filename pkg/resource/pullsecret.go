@@ -43,6 +43,7 @@ func (gs *generatorPullSecret) expected() (runtime.Object, error) {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      gs.GetName(),
 			Namespace: gs.GetNamespace(),
+			Labels:    map[string]string{defaults.GeneratedSecretLabel: "true"},
 		},
 		Type: corev1.SecretTypeDockerConfigJson,
 		Data: map[string][]byte{},
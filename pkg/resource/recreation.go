@@ -0,0 +1,135 @@
+package resource
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// RecreationError is returned when a managed object was deleted by someone
+// else and is not recreated, because the recreation is halted or because the
+// object was recreated too many times during the last hour.
+type RecreationError struct {
+	Kind string
+	Name string
+	// Halted is set when the recreation is halted by the recreation
+	// override, rather than rate limited.
+	Halted bool
+}
+
+func (e *RecreationError) Error() string {
+	if e.Halted {
+		return fmt.Sprintf("the %s %s was deleted and its recreation is halted", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("the %s %s was deleted too many times during the last hour, it is not recreated yet", e.Kind, e.Name)
+}
+
+// RecreationTracker recognizes the managed objects that are deleted by
+// someone else: the objects it has seen that are not found anymore. It holds
+// its state in memory, a deletion while the operator is not running looks
+// like the first creation of the object.
+type RecreationTracker struct {
+	mtx         sync.Mutex
+	present     map[string]bool
+	recreations map[string][]time.Time
+	now         func() time.Time
+}
+
+// NewRecreationTracker returns a tracker that has not seen any object yet.
+func NewRecreationTracker() *RecreationTracker {
+	return &RecreationTracker{
+		present:     map[string]bool{},
+		recreations: map[string][]time.Time{},
+		now:         time.Now,
+	}
+}
+
+// recreationKind returns the kind of the objects of gen, such as Service.
+func recreationKind(gen Getter) string {
+	return reflect.TypeOf(gen.Type()).Elem().Name()
+}
+
+// Apply applies gen like ApplyMutator. An object that was deleted by someone
+// else is recreated at most policy.MaxPerHour times in an hour, or not at all
+// if policy.Halt is set. Each recreation is counted by a metric and recorded
+// by a ResourceRecreated event.
+func (t *RecreationTracker) Apply(gen Mutator, policy *overrides.RecreationOverrides, recorder events.Recorder) error {
+	key := Name(gen)
+	_, err := gen.Get()
+	if err == nil {
+		t.mtx.Lock()
+		t.present[key] = true
+		t.mtx.Unlock()
+		return ApplyMutator(gen)
+	}
+	if !errors.IsNotFound(err) || !t.wasPresent(key) {
+		return ApplyMutator(gen)
+	}
+
+	kind := recreationKind(gen)
+	if policy.Halt {
+		return &RecreationError{Kind: kind, Name: gen.GetName(), Halted: true}
+	}
+	if !t.allow(key, policy.MaxPerHour) {
+		return &RecreationError{Kind: kind, Name: gen.GetName()}
+	}
+	if err := ApplyMutator(gen); err != nil {
+		return err
+	}
+
+	t.mtx.Lock()
+	t.recreations[key] = append(t.recreations[key], t.now())
+	t.mtx.Unlock()
+	metrics.ResourceRecreated(kind)
+	recorder.Warningf("ResourceRecreated", "The %s %s was deleted by someone else and has been recreated", kind, gen.GetName())
+	return nil
+}
+
+func (t *RecreationTracker) wasPresent(key string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.present[key]
+}
+
+// allow returns true if the object was recreated less than maxPerHour times
+// during the last hour.
+func (t *RecreationTracker) allow(key string, maxPerHour int32) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	since := t.now().Add(-time.Hour)
+	var recent []time.Time
+	for _, recreated := range t.recreations[key] {
+		if recreated.After(since) {
+			recent = append(recent, recreated)
+		}
+	}
+	t.recreations[key] = recent
+	return len(recent) < int(maxPerHour)
+}
+
+// Retain forgets the objects that are not generated by gens, the operator
+// may delete them itself.
+func (t *RecreationTracker) Retain(gens []Mutator) {
+	keys := map[string]bool{}
+	for _, gen := range gens {
+		keys[Name(gen)] = true
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for key := range t.present {
+		if !keys[key] {
+			delete(t.present, key)
+			delete(t.recreations, key)
+		}
+	}
+}
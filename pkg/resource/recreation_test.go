@@ -0,0 +1,103 @@
+package resource
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/clock"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// fakeServiceMutator manages a service that only exists in memory.
+type fakeServiceMutator struct {
+	service *corev1.Service
+	created int
+}
+
+func (m *fakeServiceMutator) Type() runtime.Object { return &corev1.Service{} }
+func (m *fakeServiceMutator) GetName() string      { return "image-registry" }
+func (m *fakeServiceMutator) GetNamespace() string { return "openshift-image-registry" }
+func (m *fakeServiceMutator) Owned() bool          { return true }
+
+func (m *fakeServiceMutator) Get() (runtime.Object, error) {
+	if m.service == nil {
+		return nil, kerrors.NewNotFound(corev1.Resource("services"), m.GetName())
+	}
+	return m.service, nil
+}
+
+func (m *fakeServiceMutator) Create() (runtime.Object, error) {
+	m.service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: m.GetName(), Namespace: m.GetNamespace()}}
+	m.created++
+	return m.service, nil
+}
+
+func (m *fakeServiceMutator) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return o, false, nil
+}
+
+func (m *fakeServiceMutator) Delete(opts metav1.DeleteOptions) error {
+	m.service = nil
+	return nil
+}
+
+func TestRecreationTracker(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tracker := NewRecreationTracker()
+	tracker.now = func() time.Time { return now }
+	recorder := events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{})
+	policy := &overrides.RecreationOverrides{MaxPerHour: 2}
+	gen := &fakeServiceMutator{}
+
+	// the first creation is not a recreation, neither is an update.
+	for i := 0; i < 2; i++ {
+		if err := tracker.Apply(gen, policy, recorder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		gen.service = nil
+		if err := tracker.Apply(gen, policy, recorder); err != nil {
+			t.Fatalf("recreation %d: %s", i+1, err)
+		}
+	}
+	if n := len(recorder.Events()); n != 2 {
+		t.Errorf("got %d events, want 2", n)
+	}
+
+	gen.service = nil
+	var recreationErr *RecreationError
+	if err := tracker.Apply(gen, policy, recorder); !errors.As(err, &recreationErr) || recreationErr.Halted {
+		t.Fatalf("got %v, want a rate limited recreation", err)
+	}
+	if recreationErr.Kind != "Service" {
+		t.Errorf("got kind %q, want Service", recreationErr.Kind)
+	}
+
+	now = now.Add(time.Hour)
+	if err := tracker.Apply(gen, policy, recorder); err != nil {
+		t.Fatalf("the recreation is not allowed after an hour: %s", err)
+	}
+
+	gen.service = nil
+	if err := tracker.Apply(gen, &overrides.RecreationOverrides{Halt: true, MaxPerHour: 2}, recorder); !errors.As(err, &recreationErr) || !recreationErr.Halted {
+		t.Fatalf("got %v, want a halted recreation", err)
+	}
+	if gen.created != 4 {
+		t.Errorf("the service was created %d times, want 4", gen.created)
+	}
+
+	// an object the operator does not generate anymore is forgotten.
+	tracker.Retain(nil)
+	if err := tracker.Apply(gen, &overrides.RecreationOverrides{Halt: true, MaxPerHour: 2}, recorder); err != nil {
+		t.Fatalf("a forgotten object must be created: %s", err)
+	}
+}
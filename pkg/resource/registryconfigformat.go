@@ -0,0 +1,118 @@
+package resource
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// registryConfigFormatEnv is the environment variable of the operator
+	// that selects the configuration format of the registry image shipped
+	// in the same release.
+	registryConfigFormatEnv = "REGISTRY_CONFIG_FORMAT"
+
+	// registryConfigFormatV2 is the configuration of the registry images
+	// based on distribution v2.
+	registryConfigFormatV2 = "v2"
+	// registryConfigFormatV3 is the configuration of the registry images
+	// based on distribution v3 (registry 3.x).
+	registryConfigFormatV3 = "v3"
+)
+
+// distributionV3RemovedDrivers are the storage drivers that were removed
+// from distribution v3.
+var distributionV3RemovedDrivers = map[string]bool{
+	"oss":   true,
+	"swift": true,
+}
+
+// distributionV3DroppedEnv are the prefixes of the settings that are
+// deprecated in distribution v2 and rejected by distribution v3.
+var distributionV3DroppedEnv = []string{
+	"REGISTRY_LOGLEVEL",
+	"REGISTRY_REPORTING_",
+	"REGISTRY_STORAGE_S3_V4AUTH",
+}
+
+// registryConfigFormat returns the configuration format that is expected by
+// the registry image. The format is set per release image, distribution v2
+// is used when it is not set.
+func registryConfigFormat() (string, error) {
+	switch format := os.Getenv(registryConfigFormatEnv); format {
+	case "", registryConfigFormatV2:
+		return registryConfigFormatV2, nil
+	case registryConfigFormatV3:
+		return registryConfigFormatV3, nil
+	default:
+		return "", fmt.Errorf("unsupported registry configuration format %q in %s", format, registryConfigFormatEnv)
+	}
+}
+
+// renderRegistryConfigEnv converts the configuration of the registry, which
+// is rendered for distribution v2, into the format expected by the registry
+// image.
+func renderRegistryConfigEnv(env []corev1.EnvVar) ([]corev1.EnvVar, error) {
+	format, err := registryConfigFormat()
+	if err != nil {
+		return nil, err
+	}
+	if format == registryConfigFormatV2 {
+		return env, nil
+	}
+	return distributionV3Env(env)
+}
+
+// distributionV3Env converts the configuration of distribution v2 into the
+// configuration of distribution v3.
+func distributionV3Env(env []corev1.EnvVar) ([]corev1.EnvVar, error) {
+	var result []corev1.EnvVar
+	values := map[string]string{}
+	for _, e := range env {
+		if dropped(e.Name) {
+			continue
+		}
+		values[e.Name] = e.Value
+		result = append(result, e)
+	}
+
+	storage := values["REGISTRY_STORAGE"]
+	if distributionV3RemovedDrivers[storage] {
+		return nil, fmt.Errorf("the storage driver %q is not supported by the registry image (distribution v3)", storage)
+	}
+
+	// The Azure driver of distribution v3 needs to be told which
+	// credentials to use, distribution v2 only supports the account key
+	// and the workload identity is picked up by the Azure SDK.
+	if storage == "azure" {
+		if _, ok := values["REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE"]; !ok {
+			credentialsType := "default_credentials"
+			if hasEnv(env, "REGISTRY_STORAGE_AZURE_ACCOUNTKEY") {
+				credentialsType = "shared_key"
+			}
+			result = append(result, corev1.EnvVar{Name: "REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE", Value: credentialsType})
+		}
+	}
+
+	return result, nil
+}
+
+func dropped(name string) bool {
+	for _, prefix := range distributionV3DroppedEnv {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// envDriver is a storage driver that only renders the given configuration.
+type envDriver struct {
+	storage.Driver
+	env envvar.List
+}
+
+func (d *envDriver) ConfigEnv() (envvar.List, error) {
+	return d.env, nil
+}
+
+func (d *envDriver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	return nil, nil, nil
+}
+
+func TestRegistryConfigFormat(t *testing.T) {
+	config := &v1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Spec: v1.ImageRegistrySpec{
+			Storage: v1.ImageRegistryConfigStorage{
+				Azure: &v1.ImageRegistryConfigStorageAzure{
+					AccountName: "account",
+					Container:   "container",
+				},
+			},
+		},
+	}
+	accountKey := envvar.List{
+		{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: "key", Secret: true},
+		{Name: "REGISTRY_STORAGE", Value: "azure"},
+		{Name: "REGISTRY_STORAGE_AZURE_CONTAINER", Value: "container"},
+		{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTNAME", Value: "account"},
+	}
+	workloadIdentity := envvar.List{
+		{Name: "AZURE_FEDERATED_TOKEN_FILE", Value: "/var/run/secrets/openshift/serviceaccount/token"},
+		{Name: "REGISTRY_STORAGE", Value: "azure"},
+		{Name: "REGISTRY_STORAGE_AZURE_CONTAINER", Value: "container"},
+		{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTNAME", Value: "account"},
+	}
+	swift := envvar.List{
+		{Name: "REGISTRY_STORAGE", Value: "swift"},
+		{Name: "REGISTRY_STORAGE_SWIFT_CONTAINER", Value: "container"},
+	}
+
+	for _, tt := range []struct {
+		name       string
+		format     string
+		env        envvar.List
+		expected   map[string]string
+		unexpected []string
+		err        string
+	}{
+		{
+			name:   "v2 with account key",
+			format: "",
+			env:    accountKey,
+			expected: map[string]string{
+				"REGISTRY_STORAGE":                  "azure",
+				"REGISTRY_STORAGE_AZURE_CONTAINER":  "container",
+				"REGISTRY_STORAGE_DELETE_ENABLED":   "true",
+				"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": "",
+			},
+			unexpected: []string{"REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE"},
+		},
+		{
+			name:   "v3 with account key",
+			format: "v3",
+			env:    accountKey,
+			expected: map[string]string{
+				"REGISTRY_STORAGE":                        "azure",
+				"REGISTRY_STORAGE_AZURE_CONTAINER":        "container",
+				"REGISTRY_STORAGE_DELETE_ENABLED":         "true",
+				"REGISTRY_STORAGE_AZURE_ACCOUNTKEY":       "",
+				"REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE": "shared_key",
+			},
+		},
+		{
+			name:       "v2 with workload identity",
+			format:     "v2",
+			env:        workloadIdentity,
+			expected:   map[string]string{"REGISTRY_STORAGE": "azure"},
+			unexpected: []string{"REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE"},
+		},
+		{
+			name:   "v3 with workload identity",
+			format: "v3",
+			env:    workloadIdentity,
+			expected: map[string]string{
+				"REGISTRY_STORAGE":                        "azure",
+				"REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE": "default_credentials",
+			},
+		},
+		{
+			name:     "v2 with swift",
+			format:   "v2",
+			env:      swift,
+			expected: map[string]string{"REGISTRY_STORAGE": "swift"},
+		},
+		{
+			name:   "v3 with swift",
+			format: "v3",
+			env:    swift,
+			err:    `the storage driver "swift" is not supported`,
+		},
+		{
+			name:   "unknown format",
+			format: "v4",
+			env:    accountKey,
+			err:    `unsupported registry configuration format "v4"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(registryConfigFormatEnv, tt.format)
+
+			fixture := buildFakeClient(config, nil)
+			pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, &envDriver{env: tt.env}, config)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env := map[string]corev1.EnvVar{}
+			for _, e := range pod.Spec.Containers[0].Env {
+				env[e.Name] = e
+			}
+			for name, value := range tt.expected {
+				e, ok := env[name]
+				if !ok {
+					t.Errorf("expected env var %s not found", name)
+					continue
+				}
+				if e.Value != value {
+					t.Errorf("env var %s: expected %q, got %q", name, value, e.Value)
+				}
+			}
+			for _, name := range tt.unexpected {
+				if _, ok := env[name]; ok {
+					t.Errorf("unexpected env var %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDistributionV3EnvDropsDeprecatedSettings(t *testing.T) {
+	env, err := distributionV3Env([]corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE", Value: "s3"},
+		{Name: "REGISTRY_STORAGE_S3_V4AUTH", Value: "true"},
+		{Name: "REGISTRY_LOGLEVEL", Value: "info"},
+		{Name: "REGISTRY_REPORTING_BUGSNAG_APIKEY", Value: "key"},
+		{Name: "REGISTRY_LOG_LEVEL", Value: "info"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE", Value: "s3"},
+		{Name: "REGISTRY_LOG_LEVEL", Value: "info"},
+	}
+	if len(env) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, env)
+	}
+	for i := range expected {
+		if env[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, env)
+		}
+	}
+}
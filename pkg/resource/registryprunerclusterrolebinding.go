@@ -0,0 +1,113 @@
+package resource
+
+import (
+	"context"
+
+	rbacapi "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	rbacset "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorRegistryPrunerClusterRoleBinding{}
+
+// generatorRegistryPrunerClusterRoleBinding binds the service account of the
+// registry to the image pruner role, the jobs that run the hard prune of the
+// registry binary list the images and the image streams.
+type generatorRegistryPrunerClusterRoleBinding struct {
+	lister rbaclisters.ClusterRoleBindingLister
+	client rbacset.RbacV1Interface
+	name   string
+}
+
+// NewGeneratorHardPruneClusterRoleBinding returns the generator of the
+// binding that lets the service account of the registry list the images and
+// the image streams during a hard prune.
+func NewGeneratorHardPruneClusterRoleBinding(lister rbaclisters.ClusterRoleBindingLister, client rbacset.RbacV1Interface) *generatorRegistryPrunerClusterRoleBinding {
+	return &generatorRegistryPrunerClusterRoleBinding{
+		lister: lister,
+		client: client,
+		name:   "openshift-image-registry-hard-prune",
+	}
+}
+
+// NewGeneratorConsistencyCheckClusterRoleBinding returns the generator of the
+// binding that lets the service account of the registry list the images and
+// the image streams during a consistency check.
+func NewGeneratorConsistencyCheckClusterRoleBinding(lister rbaclisters.ClusterRoleBindingLister, client rbacset.RbacV1Interface) *generatorRegistryPrunerClusterRoleBinding {
+	return &generatorRegistryPrunerClusterRoleBinding{
+		lister: lister,
+		client: client,
+		name:   "openshift-image-registry-consistency-check",
+	}
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) Type() runtime.Object {
+	return &rbacapi.ClusterRoleBinding{}
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) GetNamespace() string {
+	return ""
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) GetName() string {
+	return gcrb.name
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) expected() (runtime.Object, error) {
+	crb := &rbacapi.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacapi.SchemeGroupVersion.String(),
+			Kind:       "ClusterRoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: gcrb.GetName(),
+		},
+		Subjects: []rbacapi.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      defaults.ServiceAccountName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+		},
+		RoleRef: rbacapi.RoleRef{
+			Kind: "ClusterRole",
+			Name: "system:image-pruner",
+		},
+	}
+
+	return crb, nil
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) Get() (runtime.Object, error) {
+	return gcrb.lister.Get(gcrb.GetName())
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) Create() (runtime.Object, error) {
+	return commonCreate(gcrb, func(obj runtime.Object) (runtime.Object, error) {
+		return gcrb.client.ClusterRoleBindings().Create(
+			context.TODO(), obj.(*rbacapi.ClusterRoleBinding), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gcrb, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gcrb.client.ClusterRoleBindings().Update(
+			context.TODO(), obj.(*rbacapi.ClusterRoleBinding), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gcrb *generatorRegistryPrunerClusterRoleBinding) Delete(opts metav1.DeleteOptions) error {
+	return gcrb.client.ClusterRoleBindings().Delete(
+		context.TODO(), gcrb.GetName(), opts,
+	)
+}
+
+func (g *generatorRegistryPrunerClusterRoleBinding) Owned() bool {
+	return true
+}
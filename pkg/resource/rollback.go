@@ -0,0 +1,243 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const defaultRollbackProgressDeadlineSeconds = 600
+
+// rollbackRecord is the state of automatic rollbacks. It is kept in the
+// rollback config map.
+type rollbackRecord struct {
+	// KnownGoodChecksum is the checksum of the last pod template that was
+	// rolled out successfully.
+	KnownGoodChecksum string
+	// KnownGoodTemplate is the last pod template that was rolled out
+	// successfully.
+	KnownGoodTemplate *corev1.PodTemplateSpec
+	// StorageChecksum is the checksum of the storage configuration that
+	// KnownGoodTemplate was generated for.
+	StorageChecksum string
+	// FailedChecksum is the checksum of the pod template that has been
+	// rolled back.
+	FailedChecksum string
+}
+
+// rollbackTracker remembers the last pod template of the registry deployment
+// that was rolled out successfully and reverts the deployment to it when a
+// rollout exceeds its progress deadline.
+type rollbackTracker struct {
+	eventRecorder   events.Recorder
+	configMapLister corelisters.ConfigMapNamespaceLister
+	coreClient      coreset.CoreV1Interface
+	cr              *imageregistryv1.Config
+}
+
+func newRollbackTracker(eventRecorder events.Recorder, configMapLister corelisters.ConfigMapNamespaceLister, coreClient coreset.CoreV1Interface, cr *imageregistryv1.Config) *rollbackTracker {
+	return &rollbackTracker{
+		eventRecorder:   eventRecorder,
+		configMapLister: configMapLister,
+		coreClient:      coreClient,
+		cr:              cr,
+	}
+}
+
+// Gate returns the deployment that should replace the current deployment
+// cur. It is exp unless the pod template of exp has already failed to roll
+// out, in which case exp is modified to use the last known-good pod template.
+func (r *rollbackTracker) Gate(cur, exp *appsapi.Deployment) (*appsapi.Deployment, error) {
+	record, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	storageChecksum, err := strategy.Checksum(r.cr.Spec.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := exp.Annotations[defaults.TemplateChecksumAnnotation]
+	rolledOut := cur.Annotations[defaults.TemplateChecksumAnnotation] == checksum
+
+	if rolledOut && deploymentComplete(cur) {
+		if record.KnownGoodChecksum != checksum || record.StorageChecksum != storageChecksum || record.FailedChecksum != "" {
+			klog.Infof("recording pod template %s as the last known-good registry configuration", checksum)
+			if err := r.save(rollbackRecord{
+				KnownGoodChecksum: checksum,
+				KnownGoodTemplate: exp.Spec.Template.DeepCopy(),
+				StorageChecksum:   storageChecksum,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		r.clearCondition()
+		return exp, nil
+	}
+
+	canRollback := record.KnownGoodTemplate != nil &&
+		record.KnownGoodChecksum != checksum &&
+		record.StorageChecksum == storageChecksum
+
+	if canRollback && record.FailedChecksum == checksum {
+		return rolledBack(exp, record)
+	}
+
+	if canRollback && rolledOut && progressDeadlineExceeded(cur) {
+		klog.Warningf("registry rollout of pod template %s exceeded its progress deadline, rolling back to %s", checksum, record.KnownGoodChecksum)
+		record.FailedChecksum = checksum
+		if err := r.save(record); err != nil {
+			return nil, err
+		}
+		r.eventRecorder.Warningf("RolloutRolledBack", "Registry rollout did not complete within the progress deadline, rolled back to the last known-good configuration")
+		util.UpdateCondition(
+			r.cr,
+			defaults.RolloutRolledBack,
+			operatorv1.ConditionTrue,
+			"ProgressDeadlineExceeded",
+			fmt.Sprintf("The rollout of pod template %s did not complete, the registry has been rolled back to the last known-good configuration. Change the configuration to retry.", checksum),
+		)
+		return rolledBack(exp, record)
+	}
+
+	r.clearCondition()
+	return exp, nil
+}
+
+func (r *rollbackTracker) clearCondition() {
+	if util.FetchCondition(r.cr, defaults.RolloutRolledBack).Status == operatorv1.ConditionTrue {
+		util.UpdateCondition(r.cr, defaults.RolloutRolledBack, operatorv1.ConditionFalse, "AsExpected", "")
+	}
+}
+
+// Remove deletes the rollback config map if it exists.
+func (r *rollbackTracker) Remove() error {
+	if _, err := r.configMapLister.Get(defaults.RollbackConfigMapName); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err := r.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.RollbackConfigMapName, metav1.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *rollbackTracker) load() (rollbackRecord, error) {
+	var record rollbackRecord
+
+	cm, err := r.configMapLister.Get(defaults.RollbackConfigMapName)
+	if errors.IsNotFound(err) {
+		return record, nil
+	} else if err != nil {
+		return record, err
+	}
+
+	record.KnownGoodChecksum = cm.Data["knownGoodChecksum"]
+	record.StorageChecksum = cm.Data["storageChecksum"]
+	record.FailedChecksum = cm.Data["failedChecksum"]
+	if data := cm.Data["knownGoodTemplate"]; data != "" {
+		record.KnownGoodTemplate = &corev1.PodTemplateSpec{}
+		if err := json.Unmarshal([]byte(data), record.KnownGoodTemplate); err != nil {
+			klog.Errorf("unable to decode the last known-good pod template, ignoring it: %s", err)
+			return rollbackRecord{}, nil
+		}
+	}
+	return record, nil
+}
+
+func (r *rollbackTracker) save(record rollbackRecord) error {
+	template, err := json.Marshal(record.KnownGoodTemplate)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{
+		"knownGoodChecksum": record.KnownGoodChecksum,
+		"knownGoodTemplate": string(template),
+		"storageChecksum":   record.StorageChecksum,
+		"failedChecksum":    record.FailedChecksum,
+	}
+
+	cm, err := r.configMapLister.Get(defaults.RollbackConfigMapName)
+	if errors.IsNotFound(err) {
+		_, err = r.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Create(
+			context.TODO(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.RollbackConfigMapName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: data,
+			}, metav1.CreateOptions{},
+		)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	cm = cm.DeepCopy()
+	cm.Data = data
+	_, err = r.coreClient.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Update(
+		context.TODO(), cm, metav1.UpdateOptions{},
+	)
+	return err
+}
+
+// rolledBack returns exp with the last known-good pod template of record.
+func rolledBack(exp *appsapi.Deployment, record rollbackRecord) (*appsapi.Deployment, error) {
+	exp = exp.DeepCopy()
+	exp.Spec.Template = *record.KnownGoodTemplate.DeepCopy()
+	exp.Annotations[defaults.TemplateChecksumAnnotation] = record.KnownGoodChecksum
+	delete(exp.Annotations, defaults.ChecksumOperatorAnnotation)
+
+	dgst, err := strategy.Checksum(exp)
+	if err != nil {
+		return nil, err
+	}
+	exp.Annotations[defaults.ChecksumOperatorAnnotation] = dgst
+	return exp, nil
+}
+
+func deploymentComplete(deploy *appsapi.Deployment) bool {
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	return deploy.Status.ObservedGeneration >= deploy.Generation &&
+		deploy.Status.UpdatedReplicas == replicas &&
+		deploy.Status.Replicas == replicas &&
+		deploy.Status.AvailableReplicas == replicas
+}
+
+func progressDeadlineExceeded(deploy *appsapi.Deployment) bool {
+	if deploy.Status.ObservedGeneration < deploy.Generation {
+		return false
+	}
+	for _, cond := range deploy.Status.Conditions {
+		if cond.Type == appsapi.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestRollbackGate(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	}
+	storageChecksum, err := strategy.Checksum(cr.Spec.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment := func(checksum, image string, modify func(*appsapi.Deployment)) *appsapi.Deployment {
+		d := &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       defaults.ImageRegistryName,
+				Namespace:  defaults.ImageRegistryOperatorNamespace,
+				Generation: 2,
+				Annotations: map[string]string{
+					defaults.TemplateChecksumAnnotation: checksum,
+				},
+			},
+			Spec: appsapi.DeploymentSpec{
+				Replicas: ptr.To[int32](2),
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "registry", Image: image}},
+					},
+				},
+			},
+			Status: appsapi.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  2,
+			},
+		}
+		if modify != nil {
+			modify(d)
+		}
+		return d
+	}
+	stuck := func(d *appsapi.Deployment) {
+		d.Status.UpdatedReplicas = 1
+		d.Status.Conditions = []appsapi.DeploymentCondition{
+			{Type: appsapi.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+		}
+	}
+	record := func(storage, failed string) *corev1.ConfigMap {
+		template, err := json.Marshal(deployment("good", "registry:good", nil).Spec.Template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.RollbackConfigMapName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Data: map[string]string{
+				"knownGoodChecksum": "good",
+				"knownGoodTemplate": string(template),
+				"storageChecksum":   storage,
+				"failedChecksum":    failed,
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name              string
+		record            *corev1.ConfigMap
+		cur               *appsapi.Deployment
+		exp               *appsapi.Deployment
+		expectedImage     string
+		expectedKnownGood string
+		expectedFailed    string
+		rolledBack        bool
+	}{
+		{
+			name:              "completed rollout is recorded",
+			cur:               deployment("good", "registry:good", nil),
+			exp:               deployment("good", "registry:good", nil),
+			expectedImage:     "registry:good",
+			expectedKnownGood: "good",
+		},
+		{
+			name:              "rollout in progress",
+			record:            record(storageChecksum, ""),
+			cur:               deployment("bad", "registry:bad", func(d *appsapi.Deployment) { d.Status.UpdatedReplicas = 1 }),
+			exp:               deployment("bad", "registry:bad", nil),
+			expectedImage:     "registry:bad",
+			expectedKnownGood: "good",
+		},
+		{
+			name:              "stuck rollout is rolled back",
+			record:            record(storageChecksum, ""),
+			cur:               deployment("bad", "registry:bad", stuck),
+			exp:               deployment("bad", "registry:bad", nil),
+			expectedImage:     "registry:good",
+			expectedKnownGood: "good",
+			expectedFailed:    "bad",
+			rolledBack:        true,
+		},
+		{
+			name:              "rolled back configuration stays rolled back",
+			record:            record(storageChecksum, "bad"),
+			cur:               deployment("good", "registry:good", nil),
+			exp:               deployment("bad", "registry:bad", nil),
+			expectedImage:     "registry:good",
+			expectedKnownGood: "good",
+			expectedFailed:    "bad",
+		},
+		{
+			name:              "new configuration is rolled out after a rollback",
+			record:            record(storageChecksum, "bad"),
+			cur:               deployment("good", "registry:good", nil),
+			exp:               deployment("fixed", "registry:fixed", nil),
+			expectedImage:     "registry:fixed",
+			expectedKnownGood: "good",
+			expectedFailed:    "bad",
+		},
+		{
+			name:              "storage changes are not rolled back",
+			record:            record("sha256:other-storage", ""),
+			cur:               deployment("bad", "registry:bad", stuck),
+			exp:               deployment("bad", "registry:bad", nil),
+			expectedImage:     "registry:bad",
+			expectedKnownGood: "good",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := cr.DeepCopy()
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			var objects []runtime.Object
+			if tt.record != nil {
+				if err := indexer.Add(tt.record); err != nil {
+					t.Fatal(err)
+				}
+				objects = append(objects, tt.record)
+			}
+			clientset := fake.NewSimpleClientset(objects...)
+
+			r := newRollbackTracker(
+				events.NewInMemoryRecorder("image-registry-operator", clock.RealClock{}),
+				corelisters.NewConfigMapLister(indexer).ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+				clientset.CoreV1(),
+				cr,
+			)
+
+			deploy, err := r.Gate(tt.cur, tt.exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if image := deploy.Spec.Template.Spec.Containers[0].Image; image != tt.expectedImage {
+				t.Errorf("expected image %q, got %q", tt.expectedImage, image)
+			}
+
+			cm, err := clientset.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.RollbackConfigMapName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cm.Data["knownGoodChecksum"] != tt.expectedKnownGood || cm.Data["failedChecksum"] != tt.expectedFailed {
+				t.Errorf("expected known-good %q and failed %q, got %v", tt.expectedKnownGood, tt.expectedFailed, cm.Data)
+			}
+
+			rolledBack := util.FetchCondition(cr, defaults.RolloutRolledBack).Status == operatorv1.ConditionTrue
+			if rolledBack != tt.rolledBack {
+				t.Errorf("expected rolled back condition %t, got %t", tt.rolledBack, rolledBack)
+			}
+		})
+	}
+}
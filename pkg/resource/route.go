@@ -2,6 +2,7 @@ package resource
 
 import (
 	"context"
+	"strconv"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -13,6 +14,7 @@ import (
 	routelisters "github.com/openshift/client-go/route/listers/route/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 )
 
 const RouteOwnerAnnotation = "imageregistry.openshift.io"
@@ -30,6 +32,7 @@ type generatorRoute struct {
 	client       routeset.RouteV1Interface
 	namespace    string
 	serviceName  string
+	annotations  map[string]string
 	route        imageregistryv1.ImageRegistryConfigRoute
 }
 
@@ -44,6 +47,52 @@ func newGeneratorRoute(lister routelisters.RouteNamespaceLister, secretLister co
 	}
 }
 
+// newGeneratorPullRoute returns the generator of a route that exposes the
+// read-only registry replicas. Pulls are long-running blob downloads, they
+// are balanced by the number of connections and are not cut by the default
+// router timeout.
+func newGeneratorPullRoute(lister routelisters.RouteNamespaceLister, secretLister corelisters.SecretNamespaceLister, client routeset.RouteV1Interface, cr *imageregistryv1.Config, route imageregistryv1.ImageRegistryConfigRoute) *generatorRoute {
+	gr := newGeneratorRoute(lister, secretLister, client, cr, route)
+	gr.serviceName = defaults.ImageRegistryPullName
+	gr.annotations = map[string]string{
+		"haproxy.router.openshift.io/balance": "leastconn",
+		"haproxy.router.openshift.io/timeout": "5m",
+	}
+	return gr
+}
+
+// rateLimitAnnotations returns the annotations that make the router limit
+// the connections and the requests of each client IP address.
+func rateLimitAnnotations(rateLimit *overrides.RateLimitOverrides) map[string]string {
+	if rateLimit == nil {
+		return nil
+	}
+	annotations := map[string]string{
+		"haproxy.router.openshift.io/rate-limit-connections": "true",
+	}
+	if rateLimit.ConcurrentConnectionsPerClient > 0 {
+		annotations["haproxy.router.openshift.io/rate-limit-connections.concurrent-tcp"] = strconv.Itoa(int(rateLimit.ConcurrentConnectionsPerClient))
+	}
+	if rateLimit.RequestsPerSecondPerClient > 0 {
+		// HAProxy counts the requests over 3 seconds.
+		annotations["haproxy.router.openshift.io/rate-limit-connections.rate-http"] = strconv.Itoa(int(rateLimit.RequestsPerSecondPerClient) * 3)
+	}
+	return annotations
+}
+
+// addAnnotations adds annotations to the route.
+func (gr *generatorRoute) addAnnotations(annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	if gr.annotations == nil {
+		gr.annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		gr.annotations[k] = v
+	}
+}
+
 func (gr *generatorRoute) Type() runtime.Object {
 	return &routeapi.Route{}
 }
@@ -72,6 +121,10 @@ func (gr *generatorRoute) expected() (runtime.Object, error) {
 		},
 	}
 
+	for k, v := range gr.annotations {
+		r.Annotations[k] = v
+	}
+
 	r.Spec.TLS = &routeapi.TLSConfig{}
 	r.Spec.TLS.Termination = routeapi.TLSTerminationReencrypt
 
@@ -0,0 +1,33 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestRateLimitAnnotations(t *testing.T) {
+	if annotations := rateLimitAnnotations(nil); annotations != nil {
+		t.Errorf("expected no annotations without limits, got %v", annotations)
+	}
+
+	annotations := rateLimitAnnotations(&overrides.RateLimitOverrides{
+		ConcurrentConnectionsPerClient: 20,
+		RequestsPerSecondPerClient:     50,
+	})
+	expected := map[string]string{
+		"haproxy.router.openshift.io/rate-limit-connections":                "true",
+		"haproxy.router.openshift.io/rate-limit-connections.concurrent-tcp": "20",
+		"haproxy.router.openshift.io/rate-limit-connections.rate-http":      "150",
+	}
+	if !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("expected %v, got %v", expected, annotations)
+	}
+
+	gr := &generatorRoute{annotations: map[string]string{"haproxy.router.openshift.io/balance": "leastconn"}}
+	gr.addAnnotations(annotations)
+	if len(gr.annotations) != 4 || gr.annotations["haproxy.router.openshift.io/balance"] != "leastconn" {
+		t.Errorf("expected the annotations of the route to be kept, got %v", gr.annotations)
+	}
+}
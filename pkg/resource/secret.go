@@ -55,6 +55,7 @@ func (gs *generatorSecret) expected() (runtime.Object, error) {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      gs.GetName(),
 			Namespace: gs.GetNamespace(),
+			Labels:    map[string]string{defaults.GeneratedSecretLabel: "true"},
 		},
 	}
 
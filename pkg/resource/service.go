@@ -3,6 +3,7 @@ package resource
 import (
 	"context"
 	"fmt"
+	"net"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,7 +12,10 @@ import (
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
 
+	configv1 "github.com/openshift/api/config/v1"
+
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 )
 
@@ -25,6 +29,95 @@ type generatorService struct {
 	labels     map[string]string
 	port       int
 	secretName string
+	// ipFamilyPolicy and ipFamilies are left to the defaults of the
+	// cluster when they are not set.
+	ipFamilyPolicy *corev1.IPFamilyPolicy
+	ipFamilies     []corev1.IPFamily
+}
+
+// clusterIPFamilies returns the IP families of the service network of the
+// cluster, the primary one first.
+func clusterIPFamilies(network *configv1.Network) ([]corev1.IPFamily, error) {
+	if network == nil {
+		return nil, nil
+	}
+	cidrs := network.Status.ServiceNetwork
+	if len(cidrs) == 0 {
+		cidrs = network.Spec.ServiceNetwork
+	}
+	var families []corev1.IPFamily
+	for _, cidr := range cidrs {
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the service network %s: %w", cidr, err)
+		}
+		family := corev1.IPv6Protocol
+		if ip.To4() != nil {
+			family = corev1.IPv4Protocol
+		}
+		if len(families) == 0 || (len(families) == 1 && families[0] != family) {
+			families = append(families, family)
+		}
+	}
+	return families, nil
+}
+
+// serviceIPFamilies returns the IP family policy and the IP families of the
+// registry services. By default they follow the service network of the
+// cluster: IPv6-only clusters get IPv6 services and dual-stack clusters get
+// dual-stack services. The overrides can prefer a family or require a
+// single or a dual stack, they must be served by the service network.
+func serviceIPFamilies(network *configv1.Network, settings *overrides.NetworkOverrides) (*corev1.IPFamilyPolicy, []corev1.IPFamily, error) {
+	cluster, err := clusterIPFamilies(network)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cluster) == 0 {
+		// the service network is unknown, the API server picks the
+		// families.
+		if settings == nil {
+			return nil, nil, nil
+		}
+		var policy *corev1.IPFamilyPolicy
+		if settings.IPFamilyPolicy != "" {
+			policy = &settings.IPFamilyPolicy
+		}
+		return policy, settings.IPFamilies, nil
+	}
+
+	policy := corev1.IPFamilyPolicySingleStack
+	if len(cluster) > 1 {
+		policy = corev1.IPFamilyPolicyPreferDualStack
+	}
+	families := cluster
+	if settings != nil {
+		if settings.IPFamilyPolicy != "" {
+			policy = settings.IPFamilyPolicy
+		}
+		for _, family := range settings.IPFamilies {
+			if len(cluster) == 1 && family != cluster[0] {
+				return nil, nil, fmt.Errorf("the IP family %s is not served by the service network of the cluster, it only has %s", family, cluster[0])
+			}
+		}
+		if len(settings.IPFamilies) > 0 {
+			families = settings.IPFamilies
+		}
+	}
+
+	if policy == corev1.IPFamilyPolicyRequireDualStack && len(cluster) < 2 {
+		return nil, nil, fmt.Errorf("the RequireDualStack IP family policy needs a dual-stack service network, the cluster only has %s", cluster[0])
+	}
+	if policy == corev1.IPFamilyPolicySingleStack {
+		families = families[:1]
+	} else if len(families) == 1 && len(cluster) > 1 {
+		// the preferred family first, then the other one.
+		other := cluster[0]
+		if other == families[0] {
+			other = cluster[1]
+		}
+		families = []corev1.IPFamily{families[0], other}
+	}
+	return &policy, families, nil
 }
 
 func newGeneratorService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface) *generatorService {
@@ -39,6 +132,20 @@ func newGeneratorService(lister corelisters.ServiceNamespaceLister, client cores
 	}
 }
 
+// newGeneratorPullService returns the generator of the service in front of
+// the read-only registry replicas.
+func newGeneratorPullService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface) *generatorService {
+	return &generatorService{
+		lister:     lister,
+		client:     client,
+		name:       defaults.ImageRegistryPullName,
+		namespace:  defaults.ImageRegistryOperatorNamespace,
+		labels:     defaults.PullLabels,
+		port:       defaults.ContainerPort,
+		secretName: defaults.ImageRegistryPullName + "-tls",
+	}
+}
+
 func (gs *generatorService) Type() runtime.Object {
 	return &corev1.Service{}
 }
@@ -71,6 +178,9 @@ func (gs *generatorService) expected() *corev1.Service {
 		},
 	}
 
+	svc.Spec.IPFamilyPolicy = gs.ipFamilyPolicy
+	svc.Spec.IPFamilies = gs.ipFamilies
+
 	svc.ObjectMeta.Annotations = map[string]string{
 		"service.alpha.openshift.io/serving-cert-secret-name": gs.secretName,
 	}
@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+func TestServiceIPFamilies(t *testing.T) {
+	network := func(cidrs ...string) *configv1.Network {
+		return &configv1.Network{Status: configv1.NetworkStatus{ServiceNetwork: cidrs}}
+	}
+	ipv4 := network("172.30.0.0/16")
+	ipv6 := network("fd02::/112")
+	dualStack := network("172.30.0.0/16", "fd02::/112")
+
+	for _, tc := range []struct {
+		name     string
+		network  *configv1.Network
+		settings *overrides.NetworkOverrides
+		policy   corev1.IPFamilyPolicy
+		families []corev1.IPFamily
+		err      bool
+	}{
+		{
+			name: "unknown service network",
+		},
+		{
+			name:     "IPv4 cluster",
+			network:  ipv4,
+			policy:   corev1.IPFamilyPolicySingleStack,
+			families: []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+		{
+			name:     "IPv6 cluster",
+			network:  ipv6,
+			policy:   corev1.IPFamilyPolicySingleStack,
+			families: []corev1.IPFamily{corev1.IPv6Protocol},
+		},
+		{
+			name:     "dual-stack cluster",
+			network:  dualStack,
+			policy:   corev1.IPFamilyPolicyPreferDualStack,
+			families: []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+		},
+		{
+			name:     "IPv6 preferred on a dual-stack cluster",
+			network:  dualStack,
+			settings: &overrides.NetworkOverrides{IPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}},
+			policy:   corev1.IPFamilyPolicyPreferDualStack,
+			families: []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol},
+		},
+		{
+			name:     "single stack on a dual-stack cluster",
+			network:  dualStack,
+			settings: &overrides.NetworkOverrides{IPFamilyPolicy: corev1.IPFamilyPolicySingleStack},
+			policy:   corev1.IPFamilyPolicySingleStack,
+			families: []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+		{
+			name:     "IPv6 on an IPv4 cluster",
+			network:  ipv4,
+			settings: &overrides.NetworkOverrides{IPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}},
+			err:      true,
+		},
+		{
+			name:     "dual stack required on an IPv6 cluster",
+			network:  ipv6,
+			settings: &overrides.NetworkOverrides{IPFamilyPolicy: corev1.IPFamilyPolicyRequireDualStack},
+			err:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, families, err := serviceIPFamilies(tc.network, tc.settings)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v %v", policy, families)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (policy == nil) != (tc.policy == "") || (policy != nil && *policy != tc.policy) {
+				t.Errorf("expected the policy %q, got %v", tc.policy, policy)
+			}
+			if !reflect.DeepEqual(families, tc.families) {
+				t.Errorf("expected the families %v, got %v", tc.families, families)
+			}
+		})
+	}
+}
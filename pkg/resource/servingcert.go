@@ -0,0 +1,67 @@
+package resource
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// servingCertExpiry checks that the certificate of the secret matches its
+// key, and returns when it expires.
+func servingCertExpiry(secret *corev1.Secret) (time.Time, error) {
+	crt, key := secret.Data["tls.crt"], secret.Data["tls.key"]
+	if len(crt) == 0 || len(key) == 0 {
+		return time.Time{}, fmt.Errorf("the secret %s must have the keys tls.crt and tls.key", secret.Name)
+	}
+	pair, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("the certificate and the key of the secret %s do not match: %w", secret.Name, err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse the certificate of the secret %s: %w", secret.Name, err)
+	}
+	return leaf.NotAfter, nil
+}
+
+// checkServingCert checks the serving certificate of the registry and
+// reports its expiry. A certificate supplied by the user that can not be
+// used fails the sync, the registry is not rolled out with it. The
+// certificate of the service CA may not be issued yet.
+func (g *Generator) checkServingCert(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	name, custom := configOverrides.ServingCertSecretName()
+
+	secret, err := g.listers.Secrets.Get(name)
+	if errors.IsNotFound(err) && !custom {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get the serving certificate: %w", err)
+	}
+	expiry, err := servingCertExpiry(secret)
+	if err != nil {
+		if custom {
+			return err
+		}
+		klog.Warningf("unable to check the serving certificate: %s", err)
+		return nil
+	}
+	metrics.ReportServingCertExpiry(name, expiry)
+	if time.Now().After(expiry) {
+		klog.Warningf("the serving certificate in the secret %s expired on %s", name, expiry.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
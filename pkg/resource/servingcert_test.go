@@ -0,0 +1,66 @@
+package resource
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testServingCertSecret(t *testing.T, notAfter time.Time) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"image-registry.openshift-image-registry.svc"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-cert"},
+		Data: map[string][]byte{
+			"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
+
+func TestServingCertExpiry(t *testing.T) {
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	secret := testServingCertSecret(t, notAfter)
+
+	expiry, err := servingCertExpiry(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiry.Equal(notAfter) {
+		t.Errorf("expected the expiry %s, got %s", notAfter, expiry)
+	}
+
+	secret.Data["tls.key"] = testServingCertSecret(t, notAfter).Data["tls.key"]
+	if _, err := servingCertExpiry(secret); err == nil {
+		t.Errorf("expected an error for the key of another certificate")
+	}
+
+	delete(secret.Data, "tls.key")
+	if _, err := servingCertExpiry(secret); err == nil {
+		t.Errorf("expected an error for a secret without a key")
+	}
+}
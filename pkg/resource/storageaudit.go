@@ -0,0 +1,76 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// appendStorageAudit adds ops to the operations of the audit trail. The
+// oldest operations are dropped when there are more than max of them.
+func appendStorageAudit(trail, ops []util.StorageOperation, max int) []util.StorageOperation {
+	trail = append(trail, ops...)
+	if len(trail) > max {
+		trail = trail[len(trail)-max:]
+	}
+	return trail
+}
+
+// writeStorageAudit adds the storage operations recorded by the drivers to
+// the StorageAuditConfigMapName config map. Operations that can not be
+// written are kept for the next attempt.
+func (g *Generator) writeStorageAudit() (err error) {
+	ops := util.TakeStorageOperations()
+	if len(ops) == 0 {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			util.ReturnStorageOperations(ops)
+		}
+	}()
+
+	configMaps := g.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	cm, err := configMaps.Get(context.TODO(), defaults.StorageAuditConfigMapName, metav1.GetOptions{})
+	create := errors.IsNotFound(err)
+	if create {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.StorageAuditConfigMapName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+		}
+	} else if err != nil {
+		return err
+	}
+
+	var trail []util.StorageOperation
+	if data, ok := cm.Data[defaults.StorageAuditKey]; ok {
+		if err := json.Unmarshal([]byte(data), &trail); err != nil {
+			klog.Errorf("unable to decode the storage audit trail, starting a new one: %s", err)
+			trail = nil
+		}
+	}
+	data, err := json.Marshal(appendStorageAudit(trail, ops, defaults.StorageAuditLength))
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[defaults.StorageAuditKey] = string(data)
+
+	if create {
+		_, err = configMaps.Create(context.TODO(), cm, metav1.CreateOptions{})
+		return err
+	}
+	_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,59 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestAppendStorageAudit(t *testing.T) {
+	var trail []util.StorageOperation
+	for _, resource := range []string{"a", "b", "c"} {
+		trail = appendStorageAudit(trail, []util.StorageOperation{{Resource: resource}}, 2)
+	}
+	if len(trail) != 2 || trail[0].Resource != "b" || trail[1].Resource != "c" {
+		t.Errorf("got %#+v, want the last 2 operations", trail)
+	}
+}
+
+func TestWriteStorageAudit(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	g := &Generator{clients: &client.Clients{Core: clientset.CoreV1()}}
+
+	util.RecordStorageOperation("CreateBucket", "s3://registry", "req-1", nil)
+	if err := g.writeStorageAudit(); err != nil {
+		t.Fatal(err)
+	}
+	util.RecordStorageOperation("DeleteBucket", "s3://registry", "", errors.New("access denied"))
+	if err := g.writeStorageAudit(); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(
+		context.Background(), defaults.StorageAuditConfigMapName, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trail []util.StorageOperation
+	if err := json.Unmarshal([]byte(cm.Data[defaults.StorageAuditKey]), &trail); err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 2 {
+		t.Fatalf("got %d operations, want 2", len(trail))
+	}
+	if trail[0].Operation != "CreateBucket" || trail[0].RequestID != "req-1" || trail[0].Outcome != util.OperationSucceeded {
+		t.Errorf("unexpected first operation %#+v", trail[0])
+	}
+	if trail[1].Operation != "DeleteBucket" || trail[1].Outcome != util.OperationFailed || trail[1].Error != "access denied" {
+		t.Errorf("unexpected second operation %#+v", trail[1])
+	}
+}
@@ -0,0 +1,196 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	securityv1 "github.com/openshift/api/security/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+const storageBenchmarkCAMountpoint = "/etc/registry-ca"
+
+var _ Mutator = &generatorStorageBenchmarkJob{}
+
+// generatorStorageBenchmarkJob generates the job that measures the
+// throughput and the latency of the registry storage for the storage
+// benchmark request benchmark.
+type generatorStorageBenchmarkJob struct {
+	lister    batchlisters.JobNamespaceLister
+	client    batchset.BatchV1Interface
+	settings  *overrides.StorageBenchmark
+	benchmark string
+}
+
+func NewGeneratorStorageBenchmarkJob(
+	lister batchlisters.JobNamespaceLister,
+	client batchset.BatchV1Interface,
+	settings *overrides.StorageBenchmark,
+	benchmark string,
+) *generatorStorageBenchmarkJob {
+	return &generatorStorageBenchmarkJob{
+		lister:    lister,
+		client:    client,
+		settings:  settings,
+		benchmark: benchmark,
+	}
+}
+
+func (gsbj *generatorStorageBenchmarkJob) Type() runtime.Object {
+	return &batchv1.Job{}
+}
+
+func (gsbj *generatorStorageBenchmarkJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gsbj *generatorStorageBenchmarkJob) GetName() string {
+	return defaults.StorageBenchmarkJobName
+}
+
+func (gsbj *generatorStorageBenchmarkJob) expected() (runtime.Object, error) {
+	registry := "https://" + net.JoinHostPort(
+		fmt.Sprintf("%s.%s.svc", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace),
+		strconv.Itoa(defaults.ContainerPort),
+	)
+	optional := false
+	caVolume := corev1.Volume{
+		Name: "registry-ca",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: defaults.ServiceCAName,
+				},
+				Optional: &optional,
+			},
+		},
+	}
+
+	// the blobs are pushed with the credentials of the operator, its role
+	// allows pushes to the namespace of the registry. A failed benchmark is
+	// not retried, its measures would not be comparable.
+	backoffLimit := int32(0)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gsbj.GetName(),
+			Namespace: gsbj.GetNamespace(),
+			Annotations: map[string]string{
+				defaults.StorageBenchmarkAnnotation: gsbj.benchmark,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						securityv1.RequiredSCCAnnotation: "restricted-v2",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: defaults.OperatorServiceAccountName,
+					PriorityClassName:  "system-cluster-critical",
+					Containers: []corev1.Container{
+						{
+							Name:  gsbj.GetName(),
+							Image: os.Getenv("OPERATOR_IMAGE"),
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("100m"),
+									corev1.ResourceMemory: resource.MustParse("128Mi"),
+								},
+							},
+							Command: []string{"/usr/bin/cluster-image-registry-operator"},
+							Args: []string{
+								"benchmark",
+								"--registry=" + registry,
+								"--repository=" + defaults.StorageBenchmarkRepository,
+								"--ca-file=" + storageBenchmarkCAMountpoint + "/service-ca.crt",
+								"--termination-log=/dev/termination-log",
+								fmt.Sprintf("--blob-size-mib=%d", gsbj.settings.BlobSizeMiB),
+								fmt.Sprintf("--blobs=%d", gsbj.settings.Blobs),
+								fmt.Sprintf("--concurrency=%d", gsbj.settings.Concurrency),
+							},
+							TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      caVolume.Name,
+									MountPath: storageBenchmarkCAMountpoint,
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{caVolume},
+				},
+			},
+		},
+	}
+	return job, nil
+}
+
+func (gsbj *generatorStorageBenchmarkJob) Get() (runtime.Object, error) {
+	return gsbj.lister.Get(gsbj.GetName())
+}
+
+func (gsbj *generatorStorageBenchmarkJob) Create() (runtime.Object, error) {
+	return commonCreate(gsbj, func(obj runtime.Object) (runtime.Object, error) {
+		return gsbj.client.Jobs(gsbj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.Job), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gsbj *generatorStorageBenchmarkJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	// jobs cannot be updated, the job is recreated when it belongs to another
+	// benchmark or when its settings changed.
+	exp, err := gsbj.expected()
+	if err != nil {
+		return nil, false, err
+	}
+	expectedJob := exp.(*batchv1.Job)
+	job := o.(*batchv1.Job)
+	if job.Annotations[defaults.StorageBenchmarkAnnotation] == gsbj.benchmark &&
+		reflect.DeepEqual(expectedJob.Spec.Template.Spec.Containers[0].Args, job.Spec.Template.Spec.Containers[0].Args) {
+		return o, false, nil
+	}
+
+	gracePeriod := int64(0)
+	propagationPolicy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &propagationPolicy,
+	}
+	if err := gsbj.Delete(opts); err != nil {
+		return nil, false, err
+	}
+	createdObj, err := gsbj.Create()
+	if err != nil {
+		return nil, false, err
+	}
+	return createdObj, true, nil
+}
+
+func (gsbj *generatorStorageBenchmarkJob) Delete(opts metav1.DeleteOptions) error {
+	return gsbj.client.Jobs(gsbj.GetNamespace()).Delete(
+		context.TODO(), gsbj.GetName(), opts,
+	)
+}
+
+func (gsbj *generatorStorageBenchmarkJob) Owned() bool {
+	return true
+}
@@ -0,0 +1,217 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	storageMigrationCredentialsMountpoint = "/var/run/secrets/cloud"
+	storageMigrationGCSMountpoint         = "/gcs"
+)
+
+var _ Mutator = &generatorStorageMigrationJob{}
+
+// generatorStorageMigrationJob generates the job that relocates the blobs of
+// the registry storage for the storage migration request migration.
+type generatorStorageMigrationJob struct {
+	lister                batchlisters.JobNamespaceLister
+	secretLister          corev1listers.SecretNamespaceLister
+	infrastructureLister  configlisters.InfrastructureLister
+	proxyLister           configlisters.ProxyLister
+	openshiftConfigLister corev1listers.ConfigMapNamespaceLister
+	client                batchset.BatchV1Interface
+	cr                    *imageregistryv1.Config
+	migration             string
+}
+
+func NewGeneratorStorageMigrationJob(
+	lister batchlisters.JobNamespaceLister,
+	client batchset.BatchV1Interface,
+	secretLister corev1listers.SecretNamespaceLister,
+	infrastructureLister configlisters.InfrastructureLister,
+	proxyLister configlisters.ProxyLister,
+	openshiftConfigLister corev1listers.ConfigMapNamespaceLister,
+	cr *imageregistryv1.Config,
+	migration string,
+) *generatorStorageMigrationJob {
+	return &generatorStorageMigrationJob{
+		lister:                lister,
+		client:                client,
+		cr:                    cr,
+		infrastructureLister:  infrastructureLister,
+		secretLister:          secretLister,
+		proxyLister:           proxyLister,
+		openshiftConfigLister: openshiftConfigLister,
+		migration:             migration,
+	}
+}
+
+func (gsmj *generatorStorageMigrationJob) Type() runtime.Object {
+	return &batchv1.Job{}
+}
+
+func (gsmj *generatorStorageMigrationJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gsmj *generatorStorageMigrationJob) GetName() string {
+	return defaults.StorageMigrationJobName
+}
+
+// storageEnvs returns the environment and the volumes the move-blobs command
+// needs to access the storage of the registry.
+func (gsmj *generatorStorageMigrationJob) storageEnvs() ([]corev1.EnvVar, []corev1.Volume, []corev1.VolumeMount, error) {
+	optional := false
+	storage := gsmj.cr.Status.Storage
+	switch {
+	case storage.Azure != nil:
+		envs, err := azureMoveBlobsEnvs(gsmj.cr, gsmj.secretLister, gsmj.infrastructureLister, gsmj.openshiftConfigLister)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return append([]corev1.EnvVar{{Name: "MOVE_BLOBS_BACKEND", Value: "azure"}}, envs...), nil, nil, nil
+	case storage.S3 != nil:
+		credentialsFile := filepath.Join(storageMigrationCredentialsMountpoint, "credentials")
+		envs := []corev1.EnvVar{
+			{Name: "MOVE_BLOBS_BACKEND", Value: "s3"},
+			{Name: "S3_BUCKET", Value: storage.S3.Bucket},
+			{Name: "S3_REGION", Value: storage.S3.Region},
+			{Name: "S3_REGION_ENDPOINT", Value: storage.S3.RegionEndpoint},
+			{Name: "S3_VIRTUAL_HOSTED_STYLE", Value: strconv.FormatBool(storage.S3.VirtualHostedStyle)},
+			// the credentials file of the operator is a shared config
+			// file, it may contain a role to assume instead of keys.
+			{Name: "AWS_CONFIG_FILE", Value: credentialsFile},
+			{Name: "AWS_SHARED_CREDENTIALS_FILE", Value: credentialsFile},
+		}
+		vol := corev1.Volume{
+			Name: defaults.ImageRegistryPrivateConfiguration,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: defaults.ImageRegistryPrivateConfiguration,
+					Optional:   &optional,
+				},
+			},
+		}
+		mount := corev1.VolumeMount{
+			Name:      vol.Name,
+			MountPath: storageMigrationCredentialsMountpoint,
+			ReadOnly:  true,
+		}
+		return envs, []corev1.Volume{vol}, []corev1.VolumeMount{mount}, nil
+	case storage.GCS != nil:
+		envs := []corev1.EnvVar{
+			{Name: "MOVE_BLOBS_BACKEND", Value: "gcs"},
+			{Name: "GCS_BUCKET", Value: storage.GCS.Bucket},
+			{Name: "GOOGLE_APPLICATION_CREDENTIALS", Value: filepath.Join(storageMigrationGCSMountpoint, "keyfile")},
+		}
+		vol := corev1.Volume{
+			Name: "registry-storage-keyfile",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: defaults.ImageRegistryPrivateConfiguration,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  "REGISTRY_STORAGE_GCS_KEYFILE",
+							Path: "keyfile",
+						},
+					},
+					Optional: &optional,
+				},
+			},
+		}
+		mount := corev1.VolumeMount{
+			Name:      vol.Name,
+			MountPath: storageMigrationGCSMountpoint,
+			ReadOnly:  true,
+		}
+		return envs, []corev1.Volume{vol}, []corev1.VolumeMount{mount}, nil
+	}
+	return nil, nil, nil, fmt.Errorf("storage migrations are only supported on Azure, S3 and GCS storage")
+}
+
+func (gsmj *generatorStorageMigrationJob) expected() (runtime.Object, error) {
+	envs, volumes, mounts, err := gsmj.storageEnvs()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := proxyEnvs(gsmj.cr, gsmj.proxyLister)
+	if err != nil {
+		return nil, err
+	}
+	envs = append(envs, proxy...)
+
+	job := moveBlobsJob(gsmj.GetName(), gsmj.GetNamespace(), envs, volumes, mounts)
+	job.Annotations = map[string]string{
+		defaults.StorageMigrationAnnotation: gsmj.migration,
+	}
+	return job, nil
+}
+
+func (gsmj *generatorStorageMigrationJob) Get() (runtime.Object, error) {
+	return gsmj.lister.Get(gsmj.GetName())
+}
+
+func (gsmj *generatorStorageMigrationJob) Create() (runtime.Object, error) {
+	return commonCreate(gsmj, func(obj runtime.Object) (runtime.Object, error) {
+		return gsmj.client.Jobs(gsmj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.Job), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gsmj *generatorStorageMigrationJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	// jobs cannot be updated, the job is recreated when it belongs to another
+	// migration or when its environment changed.
+	exp, err := gsmj.expected()
+	if err != nil {
+		return nil, false, err
+	}
+	expectedJob := exp.(*batchv1.Job)
+	job := o.(*batchv1.Job)
+	if job.Annotations[defaults.StorageMigrationAnnotation] == gsmj.migration &&
+		reflect.DeepEqual(expectedJob.Spec.Template.Spec.Containers[0].Env, job.Spec.Template.Spec.Containers[0].Env) {
+		return o, false, nil
+	}
+
+	gracePeriod := int64(0)
+	propagationPolicy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &propagationPolicy,
+	}
+	if err := gsmj.Delete(opts); err != nil {
+		return nil, false, err
+	}
+	createdObj, err := gsmj.Create()
+	if err != nil {
+		return nil, false, err
+	}
+	return createdObj, true, nil
+}
+
+func (gsmj *generatorStorageMigrationJob) Delete(opts metav1.DeleteOptions) error {
+	return gsmj.client.Jobs(gsmj.GetNamespace()).Delete(
+		context.TODO(), gsmj.GetName(), opts,
+	)
+}
+
+func (gsmj *generatorStorageMigrationJob) Owned() bool {
+	return true
+}
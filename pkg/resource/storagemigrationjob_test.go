@@ -0,0 +1,117 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestStorageMigrationJob(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		storage    imageregistryv1.ImageRegistryConfigStorage
+		envs       map[string]string
+		mountPaths []string
+		err        string
+	}{
+		{
+			name: "s3",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket:             "bucket",
+					Region:             "us-east-1",
+					RegionEndpoint:     "https://s3.example.com",
+					VirtualHostedStyle: true,
+				},
+			},
+			envs: map[string]string{
+				"MOVE_BLOBS_BACKEND":          "s3",
+				"S3_BUCKET":                   "bucket",
+				"S3_REGION":                   "us-east-1",
+				"S3_REGION_ENDPOINT":          "https://s3.example.com",
+				"S3_VIRTUAL_HOSTED_STYLE":     "true",
+				"AWS_CONFIG_FILE":             "/var/run/secrets/cloud/credentials",
+				"AWS_SHARED_CREDENTIALS_FILE": "/var/run/secrets/cloud/credentials",
+			},
+			mountPaths: []string{"/var/run/secrets/cloud"},
+		},
+		{
+			name: "gcs",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+					Bucket: "bucket",
+				},
+			},
+			envs: map[string]string{
+				"MOVE_BLOBS_BACKEND":             "gcs",
+				"GCS_BUCKET":                     "bucket",
+				"GOOGLE_APPLICATION_CREDENTIALS": "/gcs/keyfile",
+			},
+			mountPaths: []string{"/gcs"},
+		},
+		{
+			name: "unsupported storage",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+					Claim: "image-registry-storage",
+				},
+			},
+			err: "storage migrations are only supported on Azure, S3 and GCS storage",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().BuildListers()
+			cr := &imageregistryv1.Config{
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: tc.storage,
+				},
+			}
+
+			gen := NewGeneratorStorageMigrationJob(nil, nil, listers.Secrets, listers.Infrastructures, listers.ProxyConfigs, listers.OpenShiftConfig, cr, "migration-1")
+			obj, err := gen.expected()
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			job := obj.(*batchv1.Job)
+			if got := job.Annotations[defaults.StorageMigrationAnnotation]; got != "migration-1" {
+				t.Errorf("got migration annotation %q, want %q", got, "migration-1")
+			}
+
+			container := job.Spec.Template.Spec.Containers[0]
+			envs := map[string]string{}
+			for _, env := range container.Env {
+				envs[env.Name] = env.Value
+			}
+			if !reflect.DeepEqual(envs, tc.envs) {
+				t.Errorf("got envs %v, want %v", envs, tc.envs)
+			}
+
+			mounts := map[string]corev1.VolumeMount{}
+			for _, mount := range container.VolumeMounts {
+				mounts[mount.MountPath] = mount
+			}
+			for _, path := range tc.mountPaths {
+				if _, ok := mounts[path]; !ok {
+					t.Errorf("expected a volume mounted at %s, got %v", path, container.VolumeMounts)
+				}
+			}
+			if len(job.Spec.Template.Spec.Volumes) != len(container.VolumeMounts) {
+				t.Errorf("got %d volumes for %d mounts", len(job.Spec.Template.Spec.Volumes), len(container.VolumeMounts))
+			}
+		})
+	}
+}
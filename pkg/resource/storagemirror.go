@@ -0,0 +1,190 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageMirrorStateKey is the key of the StorageMirrorConfigMapName config
+// map with the JSON encoded storageMirrorState.
+const storageMirrorStateKey = "state.json"
+
+// storageMirrorState is what the storage driver of the mirror records in the
+// status of the registry config for the primary storage.
+type storageMirrorState struct {
+	ManagementState string                                     `json:"managementState,omitempty"`
+	Storage         imageregistryv1.ImageRegistryConfigStorage `json:"storage"`
+	Conditions      []operatorapi.OperatorCondition            `json:"conditions,omitempty"`
+}
+
+// mirrorConfig returns a registry config for the storage driver of the
+// mirror, with the mirror as its storage. The overrides of cr configure the
+// primary storage, they are left out.
+func mirrorConfig(cr *imageregistryv1.Config, mirror *imageregistryv1.ImageRegistryConfigStorage, state *storageMirrorState) *imageregistryv1.Config {
+	mcr := &imageregistryv1.Config{ObjectMeta: *cr.ObjectMeta.DeepCopy()}
+	mcr.Spec.Storage = *mirror.DeepCopy()
+	if mcr.Spec.Storage.ManagementState == "" {
+		mcr.Spec.Storage.ManagementState = state.ManagementState
+	}
+	mcr.Status.Storage = *state.Storage.DeepCopy()
+	mcr.Status.Conditions = append([]operatorapi.OperatorCondition(nil), state.Conditions...)
+	return mcr
+}
+
+// getStorageMirrorState returns the state of the mirror, and whether it has
+// been recorded.
+func (g *Generator) getStorageMirrorState() (*storageMirrorState, bool, error) {
+	state := &storageMirrorState{}
+	cm, err := g.listers.ConfigMaps.Get(defaults.StorageMirrorConfigMapName)
+	if errors.IsNotFound(err) {
+		return state, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal([]byte(cm.Data[storageMirrorStateKey]), state); err != nil {
+		return nil, true, fmt.Errorf("unable to decode the state of the storage mirror: %w", err)
+	}
+	return state, true, nil
+}
+
+func (g *Generator) writeStorageMirrorState(state *storageMirrorState, exists bool) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.StorageMirrorConfigMapName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string]string{storageMirrorStateKey: string(data)},
+	}
+	configMaps := g.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	if !exists {
+		_, err = configMaps.Create(context.TODO(), cm, metav1.CreateOptions{})
+		return err
+	}
+	current, err := g.listers.ConfigMaps.Get(defaults.StorageMirrorConfigMapName)
+	if err != nil {
+		return err
+	}
+	if current.Data[storageMirrorStateKey] == cm.Data[storageMirrorStateKey] {
+		return nil
+	}
+	current = current.DeepCopy()
+	current.Data = cm.Data
+	_, err = configMaps.Update(context.TODO(), current, metav1.UpdateOptions{})
+	return err
+}
+
+func (g *Generator) deleteStorageMirrorState() error {
+	err := g.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageMirrorConfigMapName, metav1.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// syncStorageMirror creates the secondary storage that is provisioned as a
+// copy target for the registry storage, and reports whether it is ready by
+// the StorageMirrored condition. The registry does not write to it, copying
+// the blobs is left to the administrator. A mirror that is not configured anymore is kept, it may
+// be the only copy of the data left.
+func (g *Generator) syncStorageMirror(cr *imageregistryv1.Config) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	mirror, err := configOverrides.StorageMirror()
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageMirrored, operatorapi.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+	if mirror == nil {
+		if util.FetchCondition(cr, defaults.StorageMirrored).Type == "" {
+			return nil
+		}
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageMirrored)
+		return g.deleteStorageMirrorState()
+	}
+
+	state, exists, err := g.getStorageMirrorState()
+	if err != nil {
+		return err
+	}
+	mcr := mirrorConfig(cr, mirror, state)
+	err = g.syncMirrorStorage(mcr)
+
+	state.ManagementState = mcr.Spec.Storage.ManagementState
+	state.Storage = mcr.Status.Storage
+	state.Conditions = mcr.Status.Conditions
+	if writeErr := g.writeStorageMirrorState(state, exists); writeErr != nil && err == nil {
+		err = fmt.Errorf("unable to record the state of the storage mirror: %w", writeErr)
+	}
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageMirrored, operatorapi.ConditionFalse, "MirrorUnavailable", fmt.Sprintf("The %s mirror storage is not ready: %s", storage.Name(mirror), err))
+		return err
+	}
+	util.UpdateCondition(cr, defaults.StorageMirrored, operatorapi.ConditionTrue, "MirrorReady", fmt.Sprintf("The %s mirror storage is provisioned", storage.Name(mirror)))
+	return nil
+}
+
+// syncMirrorStorage creates the mirror storage when it does not exist or
+// when its configuration has changed, like syncStorage does for the primary
+// storage.
+func (g *Generator) syncMirrorStorage(mcr *imageregistryv1.Config) error {
+	driver, err := storage.NewMirrorDriver(&mcr.Spec.Storage, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
+	if err != nil {
+		return err
+	}
+	if !driver.StorageChanged(mcr) {
+		exists, err := driver.StorageExists(mcr)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+	}
+	return driver.CreateStorage(mcr)
+}
+
+// removeStorageMirror removes the mirror storage with the registry when the
+// operator created it.
+func (g *Generator) removeStorageMirror() error {
+	state, exists, err := g.getStorageMirrorState()
+	if err != nil || !exists {
+		return err
+	}
+	if state.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		mcr := &imageregistryv1.Config{}
+		mcr.Spec.Storage = *state.Storage.DeepCopy()
+		mcr.Spec.Storage.ManagementState = state.ManagementState
+		mcr.Status.Storage = *state.Storage.DeepCopy()
+		mcr.Status.Conditions = state.Conditions
+		driver, err := storage.NewMirrorDriver(&mcr.Status.Storage, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
+		if err != nil {
+			return err
+		}
+		if _, err := driver.RemoveStorage(mcr); err != nil {
+			return err
+		}
+	}
+	return g.deleteStorageMirrorState()
+}
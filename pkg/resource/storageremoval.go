@@ -0,0 +1,92 @@
+package resource
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// removalCheckpoint persists the progress of the deletion of the objects of
+// the managed bucket in the storage removal config map. The config map is
+// read through the client rather than a lister, as it is saved after every
+// chunk of objects.
+type removalCheckpoint struct {
+	client coreset.ConfigMapsGetter
+}
+
+func (c *removalCheckpoint) Load() (*util.RemovalProgress, error) {
+	cm, err := c.client.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(
+		context.TODO(), defaults.StorageRemovalConfigMapName, metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	deleted, err := strconv.ParseInt(cm.Data["deleted"], 10, 64)
+	if err != nil {
+		klog.Errorf("unable to decode the storage removal progress, ignoring it: %s", err)
+		return nil, nil
+	}
+	total, err := strconv.ParseInt(cm.Data["total"], 10, 64)
+	if err != nil {
+		klog.Errorf("unable to decode the storage removal progress, ignoring it: %s", err)
+		return nil, nil
+	}
+	return &util.RemovalProgress{
+		Bucket:  cm.Data["bucket"],
+		Marker:  cm.Data["marker"],
+		Deleted: deleted,
+		Total:   total,
+	}, nil
+}
+
+func (c *removalCheckpoint) Save(progress *util.RemovalProgress) error {
+	data := map[string]string{
+		"bucket":  progress.Bucket,
+		"marker":  progress.Marker,
+		"deleted": strconv.FormatInt(progress.Deleted, 10),
+		"total":   strconv.FormatInt(progress.Total, 10),
+	}
+
+	configMaps := c.client.ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	cm, err := configMaps.Get(context.TODO(), defaults.StorageRemovalConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(
+			context.TODO(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.StorageRemovalConfigMapName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: data,
+			}, metav1.CreateOptions{},
+		)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	cm.Data = data
+	_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
+
+// Remove deletes the storage removal config map if it exists.
+func (c *removalCheckpoint) Remove() error {
+	err := c.client.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageRemovalConfigMapName, metav1.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestRemovalCheckpoint(t *testing.T) {
+	checkpoint := &removalCheckpoint{client: fake.NewSimpleClientset().CoreV1()}
+
+	progress, err := checkpoint.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != nil {
+		t.Fatalf("expected no progress, got %#+v", progress)
+	}
+
+	for _, expected := range []*util.RemovalProgress{
+		{Bucket: "bucket", Total: 2500},
+		{Bucket: "bucket", Marker: "docker/registry/v2/blobs/sha256/00/00aa", Deleted: 1000, Total: 2500},
+	} {
+		if err := checkpoint.Save(expected); err != nil {
+			t.Fatal(err)
+		}
+		progress, err := checkpoint.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(progress, expected) {
+			t.Errorf("got progress %#+v, want %#+v", progress, expected)
+		}
+	}
+
+	if err := checkpoint.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if progress, err := checkpoint.Load(); err != nil || progress != nil {
+		t.Errorf("expected no progress after removal, got %#+v, %v", progress, err)
+	}
+	if err := checkpoint.Remove(); err != nil {
+		t.Errorf("expected removing a missing checkpoint to succeed, got %v", err)
+	}
+}
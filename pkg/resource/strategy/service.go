@@ -1,6 +1,8 @@
 package strategy
 
 import (
+	"fmt"
+
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -16,10 +18,19 @@ func Service(o, n *corev1.Service) (bool, error) {
 		return false, nil
 	}
 
+	// The primary IP family of a service is immutable.
+	if len(o.Spec.IPFamilies) > 0 && len(n.Spec.IPFamilies) > 0 && o.Spec.IPFamilies[0] != n.Spec.IPFamilies[0] {
+		return false, fmt.Errorf("the primary IP family of the service %s is %s and can not be changed to %s, the service has to be deleted to be recreated", o.Name, o.Spec.IPFamilies[0], n.Spec.IPFamilies[0])
+	}
+
 	Metadata(&o.ObjectMeta, &n.ObjectMeta)
 	o.Spec.Selector = n.Spec.Selector
 	o.Spec.Type = n.Spec.Type
 	o.Spec.Ports = n.Spec.Ports
+	if n.Spec.IPFamilyPolicy != nil {
+		o.Spec.IPFamilyPolicy = n.Spec.IPFamilyPolicy
+		o.Spec.IPFamilies = n.Spec.IPFamilies
+	}
 
 	if o.Annotations == nil {
 		o.Annotations = map[string]string{}
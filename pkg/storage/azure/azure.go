@@ -11,21 +11,16 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Azure/azure-pipeline-go/pipeline"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
-	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
-	"github.com/Azure/azure-storage-blob-go/azblob"
-	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/to"
-	"github.com/jongio/azidext/go/azidext"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/rand"
 	kcorelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
@@ -34,11 +29,12 @@ import (
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapiv1 "github.com/openshift/api/operator/v1"
 	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
-	"github.com/openshift/cluster-image-registry-operator/pkg/filewatcher"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
@@ -52,7 +48,19 @@ const (
 	storageExistsReasonContainerExists   = "ContainerExists"
 	storageExistsReasonContainerDeleted  = "ContainerDeleted"
 	storageExistsReasonAccountDeleted    = "AccountDeleted"
-	storageExistsReasonAccountNotFound   = "AccountNotFound"
+
+	storageExistsReasonHierarchicalNamespace = "HierarchicalNamespaceEnabled"
+	storageExistsReasonAccountNotFound       = "AccountNotFound"
+	storageExistsReasonNotManaged            = "NotManagedByOperator"
+
+	privateEndpointReasonConnected = "SharedEndpointConnected"
+	privateEndpointReasonUnhealthy = "SharedEndpointUnhealthy"
+
+	softDeleteReasonEnabled = "SoftDeleteEnabled"
+	softDeleteReasonFailed  = "SoftDeleteFailed"
+
+	tagSyncReasonSynced = "TagsSynced"
+	tagSyncReasonFailed = "TagSyncFailed"
 )
 
 // storageAccountInvalidCharRe is a regular expression for characters that
@@ -76,6 +84,7 @@ type Azure struct {
 
 	// UPI
 	AccountKey string
+	SASToken   string
 }
 
 type errDoesNotExist struct {
@@ -91,17 +100,26 @@ func (e *errDoesNotExist) Error() string {
 // present this function loads credentials from cluster wide config present on secret
 // CloudCredentialsName.
 func GetConfig(secLister kcorelisters.SecretNamespaceLister, infraLister configlisters.InfrastructureLister) (*Azure, error) {
-	sec, err := secLister.Get(defaults.ImageRegistryPrivateConfigurationUser)
-	if err != nil {
-		if !errors.IsNotFound(err) {
-			return nil, fmt.Errorf("unable to get user provided secrets: %s", err)
-		}
+	cfg, _, err := getConfig(secLister, infraLister)
+	return cfg, err
+}
 
-		// loads cluster wide configuration.
-		if sec, err = secLister.Get(defaults.CloudCredentialsName); err != nil {
-			return nil, fmt.Errorf("unable to get cluster minted credentials: %s", err)
-		}
+// clusterCredentialsUsable returns true if the federated token of the
+// cluster minted secret, if any, is readable.
+func clusterCredentialsUsable(sec *corev1.Secret) bool {
+	return util.TokenFileReadable(string(sec.Data["azure_federated_token_file"]))
+}
+
+func getConfig(secLister kcorelisters.SecretNamespaceLister, infraLister configlisters.InfrastructureLister) (*Azure, util.CredentialsPath, error) {
+	sec, path, err := util.CredentialsSecret(secLister, clusterCredentialsUsable, time.Now())
+	if err != nil && path.Source == util.CredentialsSourceCluster {
+		return nil, path, fmt.Errorf("unable to get cluster minted credentials: %s", err)
+	} else if err != nil {
+		return nil, path, fmt.Errorf("unable to get user provided secrets: %s", err)
+	}
 
+	if path.Source == util.CredentialsSourceCluster {
+		// loads cluster wide configuration.
 		cfg := &Azure{
 			SubscriptionID:     string(sec.Data["azure_subscription_id"]),
 			ClientID:           string(sec.Data["azure_client_id"]),
@@ -117,40 +135,102 @@ func GetConfig(secLister kcorelisters.SecretNamespaceLister, infraLister configl
 		if cfg.ResourceGroup == "" {
 			infra, err := util.GetInfrastructure(infraLister)
 			if err != nil {
-				return nil, fmt.Errorf("unable to get infrastructure object: %s", err)
+				return nil, path, fmt.Errorf("unable to get infrastructure object: %s", err)
 			}
 			cfg.ResourceGroup = infra.Status.PlatformStatus.Azure.ResourceGroupName
 		}
 
-		return cfg, nil
+		return cfg, path, nil
 	}
 
 	// loads user provided account key.
 	key, err := util.GetValueFromSecret(sec, "REGISTRY_STORAGE_AZURE_ACCOUNTKEY")
-	if err != nil {
-		return nil, err
+	if err != nil && len(sec.Data[sasTokenKey]) > 0 {
+		return nil, path, fmt.Errorf("the secret %s/%s has a %s but no "+
+			"REGISTRY_STORAGE_AZURE_ACCOUNTKEY; the registry can not authenticate "+
+			"with a SAS token, the secret should also contain a valid storage "+
+			"account access key", sec.Namespace, sec.Name, sasTokenKey,
+		)
+	} else if err != nil {
+		return nil, path, err
 	} else if key == "" {
-		return nil, fmt.Errorf("the secret %s/%s has an empty value for "+
+		return nil, path, fmt.Errorf("the secret %s/%s has an empty value for "+
 			"REGISTRY_STORAGE_AZURE_ACCOUNTKEY; the secret should be removed so that "+
 			"the operator can use cluster-wide secrets or it should contain a valid "+
 			"storage account access key", sec.Namespace, sec.Name,
 		)
 	}
 
+	// a SAS token provided along the account key is only used by the
+	// operator, the registry has no SAS token support.
 	return &Azure{
 		AccountKey: key,
-	}, nil
+		SASToken:   string(sec.Data[sasTokenKey]),
+	}, path, nil
+}
+
+// CredentialsPath returns the credentials the registry is configured with.
+func (d *driver) CredentialsPath() (util.CredentialsPath, error) {
+	_, path, err := getConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	return path, err
 }
 
 func isAzureStackCloud(name string) bool {
 	return strings.EqualFold(name, "AZURESTACKCLOUD")
 }
 
+// getEnvironmentByName returns the endpoints of the cloud name. Besides the
+// clouds known by the Azure SDK, name can be a custom cloud that is defined
+// in the environment file of the operator.
 func getEnvironmentByName(name string) (autorestazure.Environment, error) {
 	if name == "" {
 		return autorestazure.PublicCloud, nil
 	}
-	return autorestazure.EnvironmentFromName(name)
+	environment, err := autorestazure.EnvironmentFromName(name)
+	if err == nil || isAzureStackCloud(name) {
+		return environment, err
+	}
+
+	custom, customErr := customEnvironment(os.Getenv(autorestazure.EnvironmentFilepathName))
+	if customErr != nil || !strings.EqualFold(custom.Name, name) {
+		return environment, err
+	}
+	return custom, nil
+}
+
+// customEnvironment loads the definition of a custom cloud from filename.
+// The token audience defaults to the resource manager endpoint, as it does
+// on the clouds known by the Azure SDK.
+func customEnvironment(filename string) (autorestazure.Environment, error) {
+	if filename == "" {
+		return autorestazure.Environment{}, fmt.Errorf("%s is not set", autorestazure.EnvironmentFilepathName)
+	}
+	environment, err := autorestazure.EnvironmentFromFile(filename)
+	if err != nil {
+		return environment, err
+	}
+
+	var missing []string
+	if environment.Name == "" {
+		missing = append(missing, "name")
+	}
+	if environment.ResourceManagerEndpoint == "" {
+		missing = append(missing, "resourceManagerEndpoint")
+	}
+	if environment.ActiveDirectoryEndpoint == "" {
+		missing = append(missing, "activeDirectoryEndpoint")
+	}
+	if environment.StorageEndpointSuffix == "" {
+		missing = append(missing, "storageEndpointSuffix")
+	}
+	if len(missing) > 0 {
+		return environment, fmt.Errorf("the custom cloud definition is missing %s", strings.Join(missing, ", "))
+	}
+
+	if environment.TokenAudience == "" {
+		environment.TokenAudience = environment.ResourceManagerEndpoint
+	}
+	return environment, nil
 }
 
 // generateAccountName returns a name that can be used for an Azure Storage
@@ -169,64 +249,14 @@ func getBlobServiceURL(environment autorestazure.Environment, accountName string
 	return url.Parse("https://" + accountName + ".blob." + environment.StorageEndpointSuffix)
 }
 
-func (d *driver) accountExists(storageAccountsClient storage.AccountsClient, accountName string) (storage.CheckNameAvailabilityResult, error) {
-	return storageAccountsClient.CheckNameAvailability(
-		d.Context,
-		storage.AccountCheckNameAvailabilityParameters{
-			Name: to.StringPtr(accountName),
-			Type: to.StringPtr("Microsoft.Storage/storageAccounts"),
-		},
-	)
-}
-
-func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName, location, cloudName string, tagset map[string]*string) error {
+func (d *driver) createStorageAccount(azClient *azureclient.Client, resourceGroupName, accountName, location string, disableSharedKeyAccess bool) error {
 	klog.Infof("attempt to create azure storage account %s (resourceGroup=%q, location=%q)...", accountName, resourceGroupName, location)
 
-	kind := storage.StorageV2
-	// NOTE: looks like this legacy version of the storage library does not support
-	// disabling public network access at all... either we update the storage
-	// account after creation using the new sdk, or we use the new sdk to create it
-	// outside of azure stack hub, and the old sdk for azure stack hub.
-	// Also doesn't support AccessKey usage disabling
-	params := &storage.AccountPropertiesCreateParameters{
-		EnableHTTPSTrafficOnly: to.BoolPtr(true),
-		AllowBlobPublicAccess:  to.BoolPtr(false),
-		MinimumTLSVersion:      storage.TLS12,
-	}
-
-	if isAzureStackCloud(cloudName) {
-		// It seems Azure Stack Hub does not support new API.
-		kind = storage.Storage
-		params = &storage.AccountPropertiesCreateParameters{}
-	}
-
-	future, err := storageAccountsClient.Create(
-		d.Context,
-		resourceGroupName,
-		accountName,
-		storage.AccountCreateParameters{
-			Kind:     kind,
-			Location: to.StringPtr(location),
-			Sku: &storage.Sku{
-				Name: storage.StandardLRS,
-			},
-			AccountPropertiesCreateParameters: params,
-			Tags:                              tagset,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to start creating storage account: %s", err)
-	}
-
-	// TODO: this may take up to 10 minutes
-	err = future.WaitForCompletionRef(d.Context, storageAccountsClient.Client)
-	if err != nil {
-		return fmt.Errorf("failed to finish creating storage account: %s", err)
-	}
-
-	_, err = future.Result(storageAccountsClient)
+	var rawResp *http.Response
+	err := azClient.CreateStorageAccount(runtime.WithCaptureResponse(d.Context, &rawResp), resourceGroupName, accountName, location, disableSharedKeyAccess)
+	recordOperation("CreateStorageAccount", "storageAccounts/"+accountName, rawResp, err)
 	if err != nil {
-		return fmt.Errorf("failed to create storage account: %s", err)
+		return err
 	}
 
 	klog.Infof("azure storage account %s has been created", accountName)
@@ -234,14 +264,12 @@ func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClie
 	return nil
 }
 
-func (d *driver) getAccountPrimaryKey(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName string) (string, error) {
-	key, err := primaryKey.get(d.Context, storageAccountsClient, resourceGroupName, accountName)
+func (d *driver) getAccountPrimaryKey(azClient *azureclient.Client, resourceGroupName, accountName string) (string, error) {
+	key, err := primaryKey.get(d.Context, azClient, resourceGroupName, accountName)
 	if err != nil {
 		wrappedErr := fmt.Errorf("failed to get keys for the storage account %s: %s", accountName, err)
-		if e, ok := err.(autorest.DetailedError); ok {
-			if e.StatusCode == http.StatusNotFound {
-				return "", &errDoesNotExist{Err: wrappedErr}
-			}
+		if isNotFound(err) {
+			return "", &errDoesNotExist{Err: wrappedErr}
 		}
 		return "", wrappedErr
 	}
@@ -249,44 +277,10 @@ func (d *driver) getAccountPrimaryKey(storageAccountsClient storage.AccountsClie
 	return key, nil
 }
 
-func (d *driver) getStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) (azblob.ContainerURL, error) {
-	c, err := azblob.NewSharedKeyCredential(accountName, key)
-	if err != nil {
-		return azblob.ContainerURL{}, err
-	}
-
-	p := azblob.NewPipeline(c, azblob.PipelineOptions{
-		Telemetry:  azblob.TelemetryOptions{Value: defaults.UserAgent},
-		HTTPSender: d.httpSender,
-	})
-
-	u, err := getBlobServiceURL(environment, accountName)
-	if err != nil {
-		return azblob.ContainerURL{}, err
-	}
-
-	service := azblob.NewServiceURL(*u, p)
-	return service.NewContainerURL(containerName), nil
-}
-
-func (d *driver) createStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
-	container, err := d.getStorageContainer(environment, accountName, key, containerName)
-	if err != nil {
-		return err
-	}
-
-	_, err = container.Create(d.Context, azblob.Metadata{}, azblob.PublicAccessNone)
-	return err
-}
-
-func (d *driver) deleteStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
-	container, err := d.getStorageContainer(environment, accountName, key, containerName)
-	if err != nil {
-		return err
-	}
-
-	_, err = container.Delete(d.Context, azblob.ContainerAccessConditions{})
-	return err
+// containerResource returns the name of a container in the storage audit
+// trail.
+func containerResource(accountName, containerName string) string {
+	return "storageAccounts/" + accountName + "/containers/" + containerName
 }
 
 type driver struct {
@@ -301,21 +295,13 @@ type driver struct {
 	// additional objects from the cluster.
 	Listers *regopclient.StorageListers
 
-	// authorizer is for Azure autorest generated clients.
-	// Added as a member to the struct to allow injection for testing.
-	authorizer autorest.Authorizer
-
-	// sender is for Azure autorest generated clients.
-	// Added as a member to the struct to allow injection for testing.
-	sender autorest.Sender
-
-	// httpSender is for Azure Pipeline.
-	// Added as a member to the struct to allow injection for testing.
-	httpSender pipeline.Factory
-
-	// policies is for new Azure Client Pipeline execution.
+	// policies is for the Azure Client Pipeline execution.
 	// Added as a member to the struct to allow injection for testing.
 	policies []policy.Policy
+
+	// trustedCA is the name of the config map with the CA bundle of the
+	// storage endpoints.
+	trustedCA string
 }
 
 // NewDriver creates a new storage driver for Azure Blob Storage.
@@ -328,6 +314,10 @@ func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorag
 }
 
 func (d *driver) newAzClient(cfg *Azure, environment autorestazure.Environment, tagset map[string]*string) (*azureclient.Client, error) {
+	caBundle, _, err := d.CABundle()
+	if err != nil {
+		return nil, err
+	}
 	client, err := azureclient.New(&azureclient.Options{
 		Environment:        environment,
 		TenantID:           cfg.TenantID,
@@ -337,6 +327,8 @@ func (d *driver) newAzClient(cfg *Azure, environment autorestazure.Environment,
 		SubscriptionID:     cfg.SubscriptionID,
 		TagSet:             tagset,
 		Policies:           d.policies,
+		AzureStackHub:      isAzureStackCloud(d.Config.CloudName),
+		CABundle:           caBundle,
 	})
 	if err != nil {
 		return nil, err
@@ -344,122 +336,112 @@ func (d *driver) newAzClient(cfg *Azure, environment autorestazure.Environment,
 	return client, nil
 }
 
-func (d *driver) storageAccountsClient(cfg *Azure, environment autorestazure.Environment) (storage.AccountsClient, error) {
-	storageAccountsClient := storage.NewAccountsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
-	storageAccountsClient.PollingDelay = 10 * time.Second
-	storageAccountsClient.PollingDuration = 3 * time.Minute
-	storageAccountsClient.RetryAttempts = 1
-	_ = storageAccountsClient.AddToUserAgent(defaults.UserAgent)
-
-	if d.authorizer != nil && d.sender != nil {
-		storageAccountsClient.Authorizer = d.authorizer
-		storageAccountsClient.Sender = d.sender
-		return storageAccountsClient, nil
-	}
-
-	cloudConfig := cloud.Configuration{
-		ActiveDirectoryAuthorityHost: environment.ActiveDirectoryEndpoint,
-		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
-			cloud.ResourceManager: {
-				Audience: environment.TokenAudience,
-				Endpoint: environment.ResourceManagerEndpoint,
-			},
-		},
+func (d *driver) getKey(cfg *Azure, environment autorestazure.Environment) (string, error) {
+	if cfg.AccountKey != "" {
+		return cfg.AccountKey, nil
 	}
 
-	var (
-		cred azcore.TokenCredential
-		err  error
-	)
-	// Managed Identity Override for ARO HCP
-	managedIdentityClientID := os.Getenv("ARO_HCP_MI_CLIENT_ID")
-	if managedIdentityClientID != "" {
-		klog.V(2).Info("Using client certification Azure authentication for ARO HCP")
-		options := &azidentity.ClientCertificateCredentialOptions{
-			ClientOptions: azcore.ClientOptions{
-				Cloud: cloudConfig,
-			},
-			SendCertificateChain: true,
-		}
-
-		tenantID := os.Getenv("ARO_HCP_TENANT_ID")
-		certPath := os.Getenv("ARO_HCP_CLIENT_CERTIFICATE_PATH")
-
-		certData, err := os.ReadFile(certPath)
-		if err != nil {
-			return storage.AccountsClient{}, fmt.Errorf(`failed to read certificate file "%s": %v`, certPath, err)
-		}
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		return "", err
+	}
 
-		certs, key, err := azidentity.ParseCertificates(certData, []byte{})
-		if err != nil {
-			return storage.AccountsClient{}, fmt.Errorf(`failed to parse certificate data "%s": %v`, certPath, err)
-		}
+	key, err := d.getAccountPrimaryKey(azClient, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		return "", err
+	}
 
-		// Watch the certificate for changes; if the certificate changes, the pod will be restarted
-		err = filewatcher.WatchFileForChanges(certPath)
-		if err != nil {
-			return storage.AccountsClient{}, err
-		}
+	return key, nil
+}
 
-		cred, err = azidentity.NewClientCertificateCredential(tenantID, managedIdentityClientID, certs, key, options)
-		if err != nil {
-			return storage.AccountsClient{}, err
-		}
-	} else if strings.TrimSpace(cfg.ClientSecret) == "" {
-		options := azidentity.WorkloadIdentityCredentialOptions{
-			ClientOptions: azcore.ClientOptions{
-				Cloud: cloudConfig,
-			},
-			ClientID:      cfg.ClientID,
-			TenantID:      cfg.TenantID,
-			TokenFilePath: cfg.FederatedTokenFile,
-		}
-		cred, err = azidentity.NewWorkloadIdentityCredential(&options)
-		if err != nil {
-			return storage.AccountsClient{}, err
-		}
-	} else {
-		options := azidentity.ClientSecretCredentialOptions{
-			ClientOptions: azcore.ClientOptions{
-				Cloud: cloudConfig,
-			},
-		}
-		cred, err = azidentity.NewClientSecretCredential(cfg.TenantID, cfg.ClientID, cfg.ClientSecret, &options)
-		if err != nil {
-			return storage.AccountsClient{}, err
-		}
+// GrantAccess issues a container SAS token that is signed with the key of the
+// storage account of the registry. Revoking it before it expires requires
+// the rotation of the account key.
+func (d *driver) GrantAccess(readOnly bool, duration time.Duration) (map[string][]byte, time.Time, error) {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return nil, time.Time{}, err
 	}
 
-	scope := environment.TokenAudience
-	if !strings.HasSuffix(scope, "/.default") {
-		scope += "/.default"
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return nil, time.Time{}, err
 	}
 
-	storageAccountsClient.Authorizer = azidext.NewTokenCredentialAdapter(cred, []string{scope})
-
-	return storageAccountsClient, nil
-}
-
-func (d *driver) getKey(cfg *Azure, environment autorestazure.Environment) (string, error) {
-	if cfg.AccountKey != "" {
-		return cfg.AccountKey, nil
+	key, err := d.getKey(cfg, environment)
+	if err != nil {
+		return nil, time.Time{}, err
 	}
 
-	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	credential, err := azblob.NewSharedKeyCredential(d.Config.AccountName, key)
 	if err != nil {
-		return "", err
+		return nil, time.Time{}, err
+	}
+
+	permissions := sas.ContainerPermissions{Read: true, List: true}
+	if !readOnly {
+		permissions.Add = true
+		permissions.Create = true
+		permissions.Write = true
+		permissions.Delete = true
+	}
+	expiry := time.Now().UTC().Add(duration)
+	params, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		ExpiryTime:    expiry,
+		ContainerName: d.Config.Container,
+		Permissions:   permissions.String(),
+	}.SignWithSharedKey(credential)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to sign the SAS token: %w", err)
 	}
 
-	key, err := d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+	u, err := getBlobServiceURL(environment, d.Config.AccountName)
 	if err != nil {
-		return "", err
+		return nil, time.Time{}, err
 	}
+	u.Path = "/" + d.Config.Container
 
-	return key, nil
+	return map[string][]byte{
+		"AZURE_STORAGE_ACCOUNT":   []byte(d.Config.AccountName),
+		"AZURE_STORAGE_CONTAINER": []byte(d.Config.Container),
+		"AZURE_STORAGE_SAS_TOKEN": []byte(params.Encode()),
+		"AZURE_STORAGE_URL":       []byte(u.String()),
+	}, expiry, nil
+}
+
+// SetTrustedCA sets the config map with the CA bundle of the storage
+// endpoints.
+func (d *driver) SetTrustedCA(name string) {
+	d.trustedCA = name
 }
 
+// CABundle returns the CA bundle of the storage endpoints, which is trusted
+// in addition to the system trust bundle. It is the bundle of the trustedCA
+// override, or on Azure Stack Hub the bundle of the cloud provider config.
 func (d *driver) CABundle() (string, bool, error) {
-	return "", true, nil
+	if d.trustedCA != "" {
+		trustedCA, err := d.Listers.OpenShiftConfig.Get(d.trustedCA)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to get trusted CA %q: %w", d.trustedCA, err)
+		}
+		bundle, ok := trustedCA.Data["ca-bundle.crt"]
+		if !ok {
+			return "", false, fmt.Errorf("trusted CA config map %q does not contain required key %q", d.trustedCA, "ca-bundle.crt")
+		}
+		return bundle, true, nil
+	}
+	if !isAzureStackCloud(d.Config.CloudName) {
+		return "", true, nil
+	}
+
+	cloudConfig, err := d.Listers.OpenShiftConfigManaged.Get(defaults.KubeCloudConfigName)
+	if kerrors.IsNotFound(err) {
+		return "", true, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("unable to get the kube cloud config: %w", err)
+	}
+	return cloudConfig.Data[defaults.CloudCABundleKey], true, nil
 }
 
 // ConfigEnv configures the environment variables that will be used in the
@@ -478,12 +460,7 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 	key := cfg.AccountKey
 	federated_token := cfg.FederatedTokenFile
 	if key == "" && federated_token == "" {
-		storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
-		if err != nil {
-			return nil, err
-		}
-
-		key, err = d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+		key, err = d.getKey(cfg, environment)
 		if err != nil {
 			return nil, err
 		}
@@ -530,43 +507,92 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 	return nil, nil
 }
 
-// containerExists determines whether or not an azure container exists
-func (d *driver) containerExists(ctx context.Context, environment autorestazure.Environment, accountName, key, containerName string) (bool, error) {
-	if accountName == "" || containerName == "" {
-		return false, nil
-	}
+// errHierarchicalNamespace returns the error for a storage account with a
+// hierarchical namespace. The registry deletes and moves blobs with the Blob
+// API, which behaves differently on Data Lake Storage Gen2 accounts and
+// breaks the registry.
+func errHierarchicalNamespace(accountName string) error {
+	return util.NewStorageError(util.ErrorKindInvalidConfig, fmt.Errorf("the storage account %s has a hierarchical namespace (Data Lake Storage Gen2), which is not supported by the registry", accountName))
+}
 
-	c, err := azblob.NewSharedKeyCredential(accountName, key)
+// hierarchicalNamespaceEnabled returns true if the storage account is known
+// to have a hierarchical namespace. The detection is best effort, the
+// credentials may not allow reading the account information. Azure Stack
+// Hub has no hierarchical namespace.
+func (d *driver) hierarchicalNamespaceEnabled(blobClient *azureclient.BlobClient) bool {
+	if isAzureStackCloud(d.Config.CloudName) {
+		return false
+	}
+	enabled, err := blobClient.HierarchicalNamespaceEnabled(d.Context)
 	if err != nil {
-		return false, err
+		klog.Warningf("unable to check whether the storage account %s has a hierarchical namespace: %s", d.Config.AccountName, err)
+		return false
 	}
+	return enabled
+}
 
-	u, err := getBlobServiceURL(environment, accountName)
+// StorageUsage returns the total size and the number of the blobs of the
+// container.
+func (d *driver) StorageUsage() (usage util.Usage, err error) {
+	defer func() { err = classifyError(err) }()
+	if d.Config.AccountName == "" || d.Config.Container == "" {
+		return usage, fmt.Errorf("the Azure storage container is not configured")
+	}
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
 	if err != nil {
-		return false, err
+		return usage, err
 	}
-
-	p := azblob.NewPipeline(c, azblob.PipelineOptions{
-		Telemetry:  azblob.TelemetryOptions{Value: defaults.UserAgent},
-		HTTPSender: d.httpSender,
-	})
-
-	service := azblob.NewServiceURL(*u, p)
-	container := service.NewContainerURL(containerName)
-	_, err = container.GetProperties(ctx, azblob.LeaseAccessConditions{})
-	if e, ok := err.(azblob.StorageError); ok {
-		if e.ServiceCode() == azblob.ServiceCodeContainerNotFound {
-			return false, nil
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return usage, err
+	}
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		return usage, err
+	}
+	key := cfg.AccountKey
+	if key == "" && cfg.FederatedTokenFile == "" {
+		if key, err = d.getKey(cfg, environment); err != nil {
+			return usage, err
 		}
 	}
+	u, err := getBlobServiceURL(environment, d.Config.AccountName)
 	if err != nil {
-		return false, fmt.Errorf("unable to get the storage container %s: %s", containerName, err)
+		return usage, err
 	}
-
-	return true, nil
+	var blobClient *azureclient.BlobClient
+	if cfg.SASToken != "" {
+		blobClient, err = azClient.NewBlobClientWithSAS(fmt.Sprintf("%s://%s/", u.Scheme, u.Host), cfg.SASToken)
+	} else {
+		blobClient, err = azClient.NewBlobClient(environment, d.Config.AccountName, key, fmt.Sprintf("%s://%s/", u.Scheme, u.Host))
+	}
+	if err != nil {
+		return usage, err
+	}
+	usage.Bytes, usage.Objects, err = blobClient.ContainerUsage(d.Context, d.Config.Container)
+	return usage, err
 }
 
-func (d *driver) storageExistsViaTrack2SDK(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) (exists bool, err error) {
+// StorageExists checks if the storage container exists and is accessible.
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (exists bool, err error) {
+	defer func() { err = classifyError(err) }()
+	if d.Config.AccountName == "" || d.Config.Container == "" {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonNotConfigured, "Storage is not configured")
+		return false, nil
+	}
+
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get configuration: %s", err))
+		return false, err
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get cloud environment: %s", err))
+		return false, err
+	}
+
 	key := cfg.AccountKey
 	federated_token := cfg.FederatedTokenFile
 	azClient, err := d.newAzClient(cfg, environment, nil)
@@ -574,13 +600,18 @@ func (d *driver) storageExistsViaTrack2SDK(cr *imageregistryv1.Config, cfg *Azur
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to create azure client: %s", err))
 		return false, err
 	}
+	if cfg.SASToken != "" {
+		if err := checkSASToken(cr, cfg.SASToken, time.Now()); err != nil {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, err.Error())
+			return false, err
+		}
+	}
 	if key == "" && federated_token == "" {
 		key, err = d.getKey(cfg, environment)
 		if err != nil {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get storage account key: %s", err))
 			return false, err
 		}
-
 	}
 
 	u, err := getBlobServiceURL(environment, d.Config.AccountName)
@@ -588,7 +619,12 @@ func (d *driver) storageExistsViaTrack2SDK(cr *imageregistryv1.Config, cfg *Azur
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to parse blob url: %s", err))
 		return false, err
 	}
-	blobClient, err := azClient.NewBlobClient(environment, d.Config.AccountName, key, fmt.Sprintf("%s://%s/", u.Scheme, u.Host))
+	var blobClient *azureclient.BlobClient
+	if cfg.SASToken != "" {
+		blobClient, err = azClient.NewBlobClientWithSAS(fmt.Sprintf("%s://%s/", u.Scheme, u.Host), cfg.SASToken)
+	} else {
+		blobClient, err = azClient.NewBlobClient(environment, d.Config.AccountName, key, fmt.Sprintf("%s://%s/", u.Scheme, u.Host))
+	}
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to create blob client: %s", err))
 		return false, err
@@ -604,59 +640,269 @@ func (d *driver) storageExistsViaTrack2SDK(cr *imageregistryv1.Config, cfg *Azur
 		return false, nil
 	}
 
+	if d.hierarchicalNamespaceEnabled(blobClient) {
+		err = errHierarchicalNamespace(d.Config.AccountName)
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonHierarchicalNamespace, err.Error())
+		return false, err
+	}
+
 	util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionTrue, storageExistsReasonContainerExists, "Storage container exists")
 	return true, nil
 }
 
-// StorageExists checks if the storage container exists and is accessible.
-func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
-	if d.Config.AccountName == "" || d.Config.Container == "" {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonNotConfigured, "Storage is not configured")
-		return false, nil
+// StorageChanged checks if the storage configuration has changed.
+func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
+	if !reflect.DeepEqual(cr.Status.Storage.Azure, cr.Spec.Storage.Azure) {
+		return true
 	}
+	// the soft delete and the tags are configured by CreateStorage, it runs
+	// again until the requested settings are applied and whenever the tags
+	// are due for a synchronization.
+	return softDeleteChanged(cr) || tagSyncChanged(cr)
+}
 
-	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+// softDeleteConfig returns the soft delete settings requested through the
+// unsupported config overrides of cr, or nil.
+func softDeleteConfig(cr *imageregistryv1.Config) (*overrides.AzureSoftDelete, error) {
+	configOverrides, err := overrides.Parse(cr)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get configuration: %s", err))
-		return false, err
+		return nil, err
+	}
+	return configOverrides.AzureSoftDelete()
+}
+
+// softDeleteMessage returns the message of the StorageSoftDeleteEnabled
+// condition once softDelete is applied.
+func softDeleteMessage(softDelete *overrides.AzureSoftDelete) string {
+	var retention []string
+	if softDelete.BlobRetentionDays > 0 {
+		retention = append(retention, fmt.Sprintf("deleted blobs are kept for %d days", softDelete.BlobRetentionDays))
+	}
+	if softDelete.ContainerRetentionDays > 0 {
+		retention = append(retention, fmt.Sprintf("deleted containers are kept for %d days", softDelete.ContainerRetentionDays))
+	}
+	return "Soft delete is enabled on the storage account: " + strings.Join(retention, ", ")
+}
+
+// softDeleteChanged returns true if the soft delete settings requested for
+// a managed storage account are not applied yet.
+func softDeleteChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	if cr.Spec.Storage.Azure == nil || isAzureStackCloud(cr.Spec.Storage.Azure.CloudName) {
+		return false
+	}
+	softDelete, err := softDeleteConfig(cr)
+	if err != nil || softDelete == nil {
+		return false
+	}
+	cond := util.FetchCondition(cr, defaults.StorageSoftDeleteEnabled)
+	return cond.Status != operatorapiv1.ConditionTrue || cond.Message != softDeleteMessage(softDelete)
+}
+
+// assureSoftDelete enables the soft delete requested through the unsupported
+// config overrides of cr on a managed storage account. Azure Stack Hub does
+// not support it. A failure is reported by the StorageSoftDeleteEnabled
+// condition, the storage stays usable.
+func (d *driver) assureSoftDelete(cr *imageregistryv1.Config, cfg *Azure) {
+	softDelete, err := softDeleteConfig(cr)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageSoftDeleteEnabled, operatorapiv1.ConditionFalse, softDeleteReasonFailed, fmt.Sprintf("Invalid soft delete configuration: %s", err))
+		return
+	}
+	if softDelete == nil || cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged || isAzureStackCloud(d.Config.CloudName) {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageSoftDeleteEnabled)
+		return
 	}
 
 	environment, err := getEnvironmentByName(d.Config.CloudName)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get cloud environment: %s", err))
-		return false, err
+		util.UpdateCondition(cr, defaults.StorageSoftDeleteEnabled, operatorapiv1.ConditionFalse, softDeleteReasonFailed, fmt.Sprintf("Unable to get cloud environment: %s", err))
+		return
+	}
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageSoftDeleteEnabled, operatorapiv1.ConditionFalse, softDeleteReasonFailed, fmt.Sprintf("Unable to create azure client: %s", err))
+		return
 	}
+	if err := azClient.ConfigureSoftDelete(d.Context, cfg.ResourceGroup, d.Config.AccountName, softDelete.BlobRetentionDays, softDelete.ContainerRetentionDays); err != nil {
+		klog.Errorf("unable to configure the soft delete of the storage account %s: %s", d.Config.AccountName, err)
+		util.UpdateCondition(cr, defaults.StorageSoftDeleteEnabled, operatorapiv1.ConditionFalse, softDeleteReasonFailed, fmt.Sprintf("Unable to configure soft delete: %s", err))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageSoftDeleteEnabled, operatorapiv1.ConditionTrue, softDeleteReasonEnabled, softDeleteMessage(softDelete))
+}
 
-	if !isAzureStackCloud(d.Config.CloudName) {
-		return d.storageExistsViaTrack2SDK(cr, cfg, environment)
+// tagSyncInterval returns the time between two synchronizations of the tags
+// of a managed storage account, or zero if the tags are only set when the
+// account is created.
+func tagSyncInterval(cr *imageregistryv1.Config) (time.Duration, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return 0, err
+	}
+	enabled, intervalSeconds, err := configOverrides.AzureTagSync()
+	if err != nil {
+		return 0, err
+	}
+	if !enabled || cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return 0, nil
 	}
+	return time.Duration(intervalSeconds) * time.Second, nil
+}
 
-	key, err := d.getKey(cfg, environment)
+// tagSyncChanged returns true if the tags of a managed storage account are
+// kept in sync and the last synchronization failed or is too old.
+func tagSyncChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.Azure == nil || isAzureStackCloud(cr.Spec.Storage.Azure.CloudName) {
+		return false
+	}
+	interval, err := tagSyncInterval(cr)
+	if err != nil || interval == 0 {
+		return false
+	}
+	if cond := util.FetchCondition(cr, defaults.StorageTagged); cond.Status != operatorapiv1.ConditionTrue {
+		return true
+	}
+	return tagSyncs.due(cr.Spec.Storage.Azure.AccountName, interval)
+}
+
+// assureTagSync sets tagset on a managed storage account when its tags are
+// kept in sync. Tags that are not in tagset are left in place. A failure is
+// reported by the StorageTagged condition, the storage stays usable.
+func (d *driver) assureTagSync(cr *imageregistryv1.Config, cfg *Azure, tagset map[string]*string) {
+	interval, err := tagSyncInterval(cr)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get storage account key: %s", err))
-		return false, err
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapiv1.ConditionFalse, tagSyncReasonFailed, fmt.Sprintf("Invalid tag sync configuration: %s", err))
+		return
+	}
+	if interval == 0 || isAzureStackCloud(d.Config.CloudName) {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageTagged)
+		return
 	}
 
-	exists, err := d.containerExists(d.Context, environment, d.Config.AccountName, key, d.Config.Container)
+	environment, err := getEnvironmentByName(d.Config.CloudName)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("%s", err))
-		return false, err
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapiv1.ConditionFalse, tagSyncReasonFailed, fmt.Sprintf("Unable to get cloud environment: %s", err))
+		return
 	}
-	if !exists {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerNotFound, fmt.Sprintf("Could not find storage container %s", d.Config.Container))
-		return false, nil
+	azClient, err := d.newAzClient(cfg, environment, tagset)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapiv1.ConditionFalse, tagSyncReasonFailed, fmt.Sprintf("Unable to create azure client: %s", err))
+		return
+	}
+	changed, err := azClient.MergeStorageAccountTags(d.Context, cfg.ResourceGroup, d.Config.AccountName, tagset)
+	if err != nil {
+		klog.Errorf("unable to sync the tags of the storage account %s: %s", d.Config.AccountName, err)
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapiv1.ConditionFalse, tagSyncReasonFailed, fmt.Sprintf("Unable to sync the tags of the storage account: %s", err))
+		return
 	}
+	if changed {
+		klog.Infof("updated the tags of the storage account %s", d.Config.AccountName)
+	}
+	tagSyncs.done(d.Config.AccountName)
+	util.UpdateCondition(cr, defaults.StorageTagged, operatorapiv1.ConditionTrue, tagSyncReasonSynced, "The tags of the storage account are in sync with the cluster")
+}
 
-	util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionTrue, storageExistsReasonContainerExists, "Storage container exists")
-	return true, nil
+const (
+	// privateDNSModeTag and privateDNSZoneTag record on the private
+	// endpoint the private DNS it was registered in when it was created,
+	// the overrides may have changed by the time it is removed.
+	privateDNSModeTag = "openshift-image-registry-private-dns-mode"
+	privateDNSZoneTag = "openshift-image-registry-private-dns-zone"
+)
+
+// privateDNSTags returns the tags that record privateDNS on the private
+// endpoint.
+func privateDNSTags(privateDNS overrides.AzurePrivateDNS) map[string]*string {
+	tags := map[string]*string{
+		privateDNSModeTag: to.Ptr(string(privateDNS.Mode)),
+	}
+	if privateDNS.ExistingZoneID != "" {
+		tags[privateDNSZoneTag] = to.Ptr(privateDNS.ExistingZoneID)
+	}
+	return tags
 }
 
-// StorageChanged checks if the storage configuration has changed.
-func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
-	return !reflect.DeepEqual(cr.Status.Storage.Azure, cr.Spec.Storage.Azure)
+// privateDNSFromTags returns the private DNS configuration recorded in the
+// tags of a private endpoint. Endpoints without the tags were registered in
+// the private DNS zone managed by the operator.
+func privateDNSFromTags(tags map[string]*string) overrides.AzurePrivateDNS {
+	privateDNS := overrides.AzurePrivateDNS{Mode: overrides.AzurePrivateDNSModeManaged}
+	if mode := tags[privateDNSModeTag]; mode != nil && *mode != "" {
+		privateDNS.Mode = overrides.AzurePrivateDNSMode(*mode)
+	}
+	if zone := tags[privateDNSZoneTag]; zone != nil {
+		privateDNS.ExistingZoneID = *zone
+	}
+	return privateDNS
 }
 
-func (d *driver) assurePrivateAccount(cfg *Azure, infra *configv1.Infrastructure, tagset map[string]*string, accountName string) (string, error) {
+// privateDNSConfig returns the private DNS configuration requested through the
+// unsupported config overrides of cr. The operator manages the private DNS
+// zone unless told otherwise.
+func privateDNSConfig(cr *imageregistryv1.Config) (overrides.AzurePrivateDNS, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return overrides.AzurePrivateDNS{}, err
+	}
+	privateDNS := overrides.AzurePrivateDNS{Mode: overrides.AzurePrivateDNSModeManaged}
+	if o := configOverrides.AzurePrivateDNS(); o != nil {
+		privateDNS = *o
+	}
+
+	switch privateDNS.Mode {
+	case "":
+		privateDNS.Mode = overrides.AzurePrivateDNSModeManaged
+		fallthrough
+	case overrides.AzurePrivateDNSModeManaged, overrides.AzurePrivateDNSModeUnmanaged:
+		if privateDNS.ExistingZoneID != "" {
+			return privateDNS, fmt.Errorf("existingZoneID can only be set when the private DNS mode is %s", overrides.AzurePrivateDNSModeExistingZone)
+		}
+	case overrides.AzurePrivateDNSModeExistingZone:
+		if privateDNS.ExistingZoneID == "" {
+			return privateDNS, fmt.Errorf("existingZoneID is required when the private DNS mode is %s", overrides.AzurePrivateDNSModeExistingZone)
+		}
+		if _, err := azureclient.ParsePrivateDNSZoneID(privateDNS.ExistingZoneID); err != nil {
+			return privateDNS, err
+		}
+	default:
+		return privateDNS, fmt.Errorf("unknown private DNS mode %q", privateDNS.Mode)
+	}
+	return privateDNS, nil
+}
+
+// sharedPrivateEndpointID returns the resource ID of the shared private
+// endpoint requested through the unsupported config overrides of cr, or an
+// empty string. A shared endpoint is managed outside of the cluster, as is
+// its private DNS.
+func sharedPrivateEndpointID(cr *imageregistryv1.Config, config *imageregistryv1.ImageRegistryConfigStorageAzure) (string, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return "", err
+	}
+	id := configOverrides.AzureSharedPrivateEndpointID()
+	if id == "" {
+		return "", nil
+	}
+
+	if config.NetworkAccess == nil || config.NetworkAccess.Type != imageregistryv1.AzureNetworkAccessTypeInternal {
+		return "", fmt.Errorf("sharedPrivateEndpointID requires the %s network access type", imageregistryv1.AzureNetworkAccessTypeInternal)
+	}
+	if internal := config.NetworkAccess.Internal; internal != nil && internal.PrivateEndpointName != "" {
+		return "", fmt.Errorf("sharedPrivateEndpointID cannot be used with the private endpoint %s managed by the operator", internal.PrivateEndpointName)
+	}
+	if privateDNS := configOverrides.AzurePrivateDNS(); privateDNS != nil && privateDNS.Mode != "" && privateDNS.Mode != overrides.AzurePrivateDNSModeUnmanaged {
+		return "", fmt.Errorf("sharedPrivateEndpointID requires the %s private DNS mode", overrides.AzurePrivateDNSModeUnmanaged)
+	}
+	if _, err := azureclient.ParsePrivateEndpointID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (d *driver) assurePrivateAccount(cfg *Azure, infra *configv1.Infrastructure, tagset map[string]*string, accountName string, privateDNS overrides.AzurePrivateDNS) (string, error) {
 	if d.Config.NetworkAccess == nil || d.Config.NetworkAccess.Type == imageregistryv1.AzureNetworkAccessTypeExternal {
 		// user did not request private storage account setup - skip.
 		return "", nil
@@ -728,20 +974,35 @@ func (d *driver) assurePrivateAccount(cfg *Azure, infra *configv1.Infrastructure
 			SubnetName:               internalConfig.SubnetName,
 			PrivateEndpointName:      privateEndpointName,
 			StorageAccountName:       accountName,
+			Tags:                     privateDNSTags(privateDNS),
 		},
 	)
+	recordOperation("CreatePrivateEndpoint", "privateEndpoints/"+privateEndpointName, nil, err)
 	if err != nil {
 		return "", err
 	}
 	klog.V(3).Info("private endpoint configured")
 
-	klog.V(3).Info("configuring private DNS...")
-	if err := azclient.ConfigurePrivateDNS(
-		d.Context, pe, cfg.ResourceGroup, networkResourceGroup, internalConfig.VNetName, accountName,
-	); err != nil {
-		return privateEndpointName, err
+	switch privateDNS.Mode {
+	case overrides.AzurePrivateDNSModeUnmanaged:
+		klog.V(3).Info("private DNS is not managed by the operator, skipping")
+	case overrides.AzurePrivateDNSModeExistingZone:
+		klog.V(3).Infof("registering private endpoint in existing private DNS zone %q...", privateDNS.ExistingZoneID)
+		if err := azclient.LinkExistingPrivateDNSZone(
+			d.Context, cfg.ResourceGroup, *pe.Name, privateDNS.ExistingZoneID,
+		); err != nil {
+			return privateEndpointName, err
+		}
+		klog.V(3).Info("private endpoint registered in existing private DNS zone")
+	default:
+		klog.V(3).Info("configuring private DNS...")
+		if err := azclient.ConfigurePrivateDNS(
+			d.Context, pe, cfg.ResourceGroup, networkResourceGroup, internalConfig.VNetName, accountName,
+		); err != nil {
+			return privateEndpointName, err
+		}
+		klog.V(3).Info("private DNS configured")
 	}
-	klog.V(3).Info("private DNS configured")
 
 	klog.V(3).Infof("disabling public network access for storage account %q...", accountName)
 	if err := azclient.UpdateStorageAccountNetworkAccess(d.Context, cfg.ResourceGroup, accountName, false); err != nil {
@@ -758,6 +1019,22 @@ func (d *driver) assurePrivateAccount(cfg *Azure, infra *configv1.Infrastructure
 	return privateEndpointName, nil
 }
 
+// checkSharedPrivateEndpoint verifies that the shared private endpoint id is
+// connected to the storage account. Neither the endpoint nor the network
+// access of the account are modified, they are managed by the administrator
+// of the shared network.
+func (d *driver) checkSharedPrivateEndpoint(cfg *Azure, tagset map[string]*string, accountName, id string) error {
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return err
+	}
+	azclient, err := d.newAzClient(cfg, environment, tagset)
+	if err != nil {
+		return err
+	}
+	return azclient.CheckSharedPrivateEndpoint(d.Context, id, accountName)
+}
+
 // assureStorageAccount makes sure there is a storage account in place and apply any provided tags.
 // If no storage account name is provided it attempts to generate one. Returns the account name
 // (either the one provided or the one generated), if the account was created or was already there and an error.
@@ -767,7 +1044,7 @@ func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure
 		return "", false, err
 	}
 
-	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	azClient, err := d.newAzClient(cfg, environment, tagset)
 	if err != nil {
 		return "", false, err
 	}
@@ -779,33 +1056,29 @@ func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure
 		accountName = generateAccountName(infra.Status.InfrastructureName)
 	}
 
-	result, err := d.accountExists(storageAccountsClient, accountName)
+	nameAvailable, err := azClient.StorageAccountNameAvailable(d.Context, accountName)
 	if err != nil {
 		return "", false, err
 	}
 
 	// if the generated storage account is not available we return an error.
-	if accountNameGenerated && !*result.NameAvailable {
+	if accountNameGenerated && !nameAvailable {
 		return "", false, fmt.Errorf("create storage account failed, name not available")
 	}
 
 	// regardless if the storage account name was provided by the user or we generated it,
 	// if it is available, we do attempt to create it.
+	// the keys of the storage account are not needed when the cluster uses
+	// workload identity, the access with them is disabled.
 	var storageAccountCreated bool
-	if *result.NameAvailable {
+	if nameAvailable {
 		storageAccountCreated = true
 		if err := d.createStorageAccount(
-			storageAccountsClient, cfg.ResourceGroup, accountName, cfg.Region, d.Config.CloudName, tagset,
+			azClient, cfg.ResourceGroup, accountName, cfg.Region, cfg.FederatedTokenFile != "",
 		); err != nil {
 			return "", false, err
 		}
-	}
-
-	if !isAzureStackCloud(d.Config.CloudName) && cfg.FederatedTokenFile != "" {
-		azClient, err := d.newAzClient(cfg, environment, tagset)
-		if err != nil {
-			return "", false, err
-		}
+	} else if !isAzureStackCloud(d.Config.CloudName) && cfg.FederatedTokenFile != "" {
 		err = azClient.DisableStorageAccountAccessKeyAccess(d.Context, cfg.ResourceGroup, accountName)
 		if err != nil {
 			return "", false, err
@@ -815,7 +1088,10 @@ func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure
 	return accountName, storageAccountCreated, nil
 }
 
-func (d *driver) assureContainerViaTrack2SDK(cfg *Azure) (string, bool, error) {
+// assureContainer makes sure we have a container in place. Container name may be provided or
+// generated automatically. Returns the container name (the provided one or the automatically
+// generated), if the container was created or was already there and an error.
+func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	environment, err := getEnvironmentByName(d.Config.CloudName)
 	if err != nil {
 		return "", false, err
@@ -827,13 +1103,7 @@ func (d *driver) assureContainerViaTrack2SDK(cfg *Azure) (string, bool, error) {
 		return "", false, err
 	}
 	if key == "" && federated_token == "" {
-		storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
-		if err != nil {
-			return "", false, err
-		}
-		key, err = d.getAccountPrimaryKey(
-			storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName,
-		)
+		key, err = d.getAccountPrimaryKey(azClient, cfg.ResourceGroup, d.Config.AccountName)
 		if err != nil {
 			return "", false, err
 		}
@@ -847,15 +1117,18 @@ func (d *driver) assureContainerViaTrack2SDK(cfg *Azure) (string, bool, error) {
 	if err != nil {
 		return "", false, err
 	}
+	if d.hierarchicalNamespaceEnabled(blobClient) {
+		return "", false, errHierarchicalNamespace(d.Config.AccountName)
+	}
 	if d.Config.Container == "" {
 		containerName, err := util.GenerateStorageName(d.Listers, "")
 		if err != nil {
 			return "", false, err
 		}
 
-		if err = blobClient.CreateStorageContainer(
-			d.Context, containerName,
-		); err != nil {
+		err = blobClient.CreateStorageContainer(d.Context, containerName)
+		recordOperation("CreateContainer", containerResource(d.Config.AccountName, containerName), nil, err)
+		if err != nil {
 			return "", false, err
 		}
 
@@ -870,63 +1143,11 @@ func (d *driver) assureContainerViaTrack2SDK(cfg *Azure) (string, bool, error) {
 		return d.Config.Container, false, nil
 	}
 
-	if err = blobClient.CreateStorageContainer(
-		d.Context, d.Config.Container,
-	); err != nil {
-		return "", false, err
-	}
-	return d.Config.Container, true, nil
-}
-
-// assureContainer makes sure we have a container in place. Container name may be provided or
-// generated automatically. Returns the container name (the provided one or the automatically
-// generated), if the container was created or was already there and an error.
-func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
-	environment, err := getEnvironmentByName(d.Config.CloudName)
+	err = blobClient.CreateStorageContainer(d.Context, d.Config.Container)
+	recordOperation("CreateContainer", containerResource(d.Config.AccountName, d.Config.Container), nil, err)
 	if err != nil {
 		return "", false, err
 	}
-
-	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
-	if err != nil {
-		return "", false, err
-	}
-
-	key, err := d.getAccountPrimaryKey(
-		storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName,
-	)
-	if err != nil {
-		return "", false, err
-	}
-
-	if d.Config.Container == "" {
-		containerName, err := util.GenerateStorageName(d.Listers, "")
-		if err != nil {
-			return "", false, err
-		}
-
-		if err = d.createStorageContainer(
-			environment, d.Config.AccountName, key, containerName,
-		); err != nil {
-			return "", false, err
-		}
-
-		return containerName, true, nil
-	}
-
-	if exists, err := d.containerExists(
-		d.Context, environment, d.Config.AccountName, key, d.Config.Container,
-	); err != nil {
-		return "", false, err
-	} else if exists {
-		return d.Config.Container, false, nil
-	}
-
-	if err = d.createStorageContainer(
-		environment, d.Config.AccountName, key, d.Config.Container,
-	); err != nil {
-		return "", false, err
-	}
 	return d.Config.Container, true, nil
 }
 
@@ -973,8 +1194,19 @@ func (d *driver) processUPI(cr *imageregistryv1.Config) {
 	)
 }
 
+// TokenFile returns the federated token file that is used when the cluster
+// uses Azure workload identity.
+func (d *driver) TokenFile() (string, error) {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return "", err
+	}
+	return cfg.FederatedTokenFile, nil
+}
+
 // CreateStorage attempts to create a storage account and a storage container.
-func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
 	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
 	if err != nil {
 		util.UpdateCondition(
@@ -990,6 +1222,14 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	// if AccountKey is present in our configuration it means it was provided by the user
 	// so we only verify if everything we need is in place.
 	if cfg.AccountKey != "" {
+		// a SAS token provided as well must allow the operator to use
+		// the container.
+		if cfg.SASToken != "" {
+			if err := checkSASToken(cr, cfg.SASToken, time.Now()); err != nil {
+				util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, err.Error())
+				return err
+			}
+		}
 		d.processUPI(cr)
 		return nil
 	}
@@ -1019,17 +1259,20 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	// along with any user defined tags from the cluster configuration
 	klog.V(2).Info("setting azure storage account tags")
 	tagset := map[string]*string{
-		fmt.Sprintf("kubernetes.io_cluster.%s", infra.Status.InfrastructureName): to.StringPtr("owned"),
+		fmt.Sprintf("kubernetes.io_cluster.%s", infra.Status.InfrastructureName): to.Ptr("owned"),
+	}
+	for key, value := range util.ManagedMetadata(infra, cr) {
+		tagset[key] = to.Ptr(value)
 	}
 
-	// at this stage we are not keeping user tags in sync. as per enhancement proposal
-	// we only set user provided tags when we created the bucket.
+	// user provided tags are set when the storage account is created, they
+	// are only kept in sync afterwards when requested in the overrides.
 	hasAzureStatus := infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Azure != nil && infra.Status.PlatformStatus.Azure.ResourceTags != nil
 	if hasAzureStatus {
 		klog.V(5).Infof("user has provided %d tags", len(infra.Status.PlatformStatus.Azure.ResourceTags))
 		for _, tag := range infra.Status.PlatformStatus.Azure.ResourceTags {
 			klog.V(5).Infof("user has provided storage account tag: %s: %s", tag.Key, tag.Value)
-			tagset[tag.Key] = to.StringPtr(tag.Value)
+			tagset[tag.Key] = to.Ptr(tag.Value)
 		}
 	}
 	klog.V(5).Infof("tagging storage account with tags: %+v", tagset)
@@ -1047,13 +1290,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 	d.Config.AccountName = storageAccountName
 
-	var containerName string
-	var containerCreated bool
-	if isAzureStackCloud(d.Config.CloudName) {
-		containerName, containerCreated, err = d.assureContainer(cfg)
-	} else {
-		containerName, containerCreated, err = d.assureContainerViaTrack2SDK(cfg)
-	}
+	containerName, containerCreated, err := d.assureContainer(cfg)
 	if err != nil {
 		util.UpdateCondition(
 			cr,
@@ -1066,7 +1303,60 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 	d.Config.Container = containerName
 
-	privateEndpointName, err := d.assurePrivateAccount(cfg, infra, tagset, storageAccountName)
+	privateDNS, err := privateDNSConfig(cr)
+	if err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Invalid private DNS configuration: %s", err),
+		)
+		return err
+	}
+
+	sharedEndpointID, err := sharedPrivateEndpointID(cr, d.Config)
+	if err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Invalid shared private endpoint configuration: %s", err),
+		)
+		return err
+	}
+	if sharedEndpointID != "" {
+		if err := d.checkSharedPrivateEndpoint(cfg, tagset, storageAccountName, sharedEndpointID); err != nil {
+			util.UpdateCondition(
+				cr,
+				defaults.StoragePrivateEndpointHealthy,
+				operatorapiv1.ConditionFalse,
+				privateEndpointReasonUnhealthy,
+				fmt.Sprintf("The shared private endpoint %s is not usable: %s", sharedEndpointID, err),
+			)
+			util.UpdateCondition(
+				cr,
+				defaults.StorageExists,
+				operatorapiv1.ConditionUnknown,
+				storageExistsReasonAzureError,
+				fmt.Sprintf("Unable to process shared private endpoint: %s", err),
+			)
+			return err
+		}
+		util.UpdateCondition(
+			cr,
+			defaults.StoragePrivateEndpointHealthy,
+			operatorapiv1.ConditionTrue,
+			privateEndpointReasonConnected,
+			fmt.Sprintf("The shared private endpoint %s is connected to the storage account", sharedEndpointID),
+		)
+	}
+
+	var privateEndpointName string
+	if sharedEndpointID == "" {
+		privateEndpointName, err = d.assurePrivateAccount(cfg, infra, tagset, storageAccountName, privateDNS)
+	}
 	if err != nil {
 		util.UpdateCondition(
 			cr,
@@ -1095,6 +1385,9 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
+	d.assureSoftDelete(cr, cfg)
+	d.assureTagSync(cr, cfg, tagset)
+
 	cr.Spec.Storage.Azure = d.Config.DeepCopy()
 	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 		Azure: d.Config.DeepCopy(),
@@ -1110,22 +1403,16 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
-func (d *driver) removeStorageContainerViaTrack2SDK(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, storageAccountsClient storage.AccountsClient) (accountNotFound bool, err error) {
+func (d *driver) removeStorageContainer(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, azClient *azureclient.Client) (accountNotFound bool, err error) {
 	key := cfg.AccountKey
 	federated_token := cfg.FederatedTokenFile
-	azClient, err := d.newAzClient(cfg, environment, nil)
-	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to create azure client: %s", err))
-		return false, err
-	}
 	if key == "" && federated_token == "" {
-		key, err = d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+		key, err = d.getAccountPrimaryKey(azClient, cfg.ResourceGroup, d.Config.AccountName)
 		if _, ok := err.(*errDoesNotExist); ok {
 			d.Config.AccountName = ""
 			cr.Spec.Storage.Azure.AccountName = "" // TODO
 			cr.Status.Storage.Azure.AccountName = ""
-			// TODO: The update condition should suggest Account doesn't exist rather than Container
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerNotFound, fmt.Sprintf("Container has been already deleted: %s", err))
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAccountNotFound, fmt.Sprintf("Account has been already deleted: %s", err))
 			return true, nil
 		}
 		if err != nil {
@@ -1133,19 +1420,18 @@ func (d *driver) removeStorageContainerViaTrack2SDK(cr *imageregistryv1.Config,
 			return false, err
 		}
 	} else {
-		result, err := d.accountExists(storageAccountsClient, d.Config.AccountName)
+		nameAvailable, err := azClient.StorageAccountNameAvailable(d.Context, d.Config.AccountName)
 		if err != nil {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to check account existence: %s", err))
 			return false, err
 		}
 
 		// if the storage account is not available we return no error.
-		if *result.NameAvailable {
+		if nameAvailable {
 			d.Config.AccountName = ""
 			cr.Spec.Storage.Azure.AccountName = ""
 			cr.Status.Storage.Azure.AccountName = ""
-			// TODO: The update condition should suggest Account doesn't exist rather than Container
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerNotFound, fmt.Sprintf("Container has been already deleted: %s", err))
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAccountNotFound, fmt.Sprintf("Account has been already deleted: %s", err))
 			return true, nil
 		}
 	}
@@ -1161,6 +1447,7 @@ func (d *driver) removeStorageContainerViaTrack2SDK(cr *imageregistryv1.Config,
 		return false, err
 	}
 	err = blobClient.DeleteStorageContainer(d.Context, d.Config.Container)
+	recordOperation("DeleteContainer", containerResource(d.Config.AccountName, d.Config.Container), nil, err)
 	if err != nil {
 		if bloberror.HasCode(err, bloberror.AuthorizationPermissionMismatch) || bloberror.HasCode(err, bloberror.AuthorizationFailure) {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage container due to delete container permission missing, trying account deletion: %s", err))
@@ -1169,8 +1456,7 @@ func (d *driver) removeStorageContainerViaTrack2SDK(cr *imageregistryv1.Config,
 			d.Config.AccountName = ""
 			cr.Spec.Storage.Azure.AccountName = ""
 			cr.Status.Storage.Azure.AccountName = ""
-			// TODO: The update condition should suggest Account doesn't exist rather than Container
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerNotFound, fmt.Sprintf("Container has been already deleted: %s", err))
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAccountNotFound, fmt.Sprintf("Account has been already deleted: %s", err))
 			return true, nil
 		} else if !bloberror.HasCode(err, bloberror.ContainerNotFound) {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage container: %s", err))
@@ -1185,35 +1471,33 @@ func (d *driver) removeStorageContainerViaTrack2SDK(cr *imageregistryv1.Config,
 	return false, nil
 }
 
-func (d *driver) removeStorageContainer(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, storageAccountsClient storage.AccountsClient) (accountNotFound bool, err error) {
-	key, err := d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
-	if _, ok := err.(*errDoesNotExist); ok {
-		d.Config.AccountName = ""
-		cr.Spec.Storage.Azure.AccountName = "" // TODO
-		cr.Status.Storage.Azure.AccountName = ""
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAccountNotFound, fmt.Sprintf("Account has been already deleted: %s", err))
-		return true, nil
-	}
+// accountManagedByCluster returns true if the storage account carries the
+// managed metadata of this cluster, or if it doesn't exist anymore.
+func (d *driver) accountManagedByCluster(azClient *azureclient.Client, resourceGroupName string) (bool, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get account primary keys: %s", err))
 		return false, err
 	}
 
-	err = d.deleteStorageContainer(environment, d.Config.AccountName, key, d.Config.Container)
-	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage container: %s", err))
-		return false, err // TODO: is it retryable?
+	accountTags, err := azClient.StorageAccountTags(d.Context, resourceGroupName, d.Config.AccountName)
+	if isNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
 	}
 
-	d.Config.Container = ""
-	cr.Spec.Storage.Azure.Container = "" // TODO: what if it was provided by a user?
-	cr.Status.Storage.Azure.Container = ""
-	util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerDeleted, "Storage container has been deleted")
-	return false, nil
+	tags := make(map[string]string)
+	for key, value := range accountTags {
+		if value != nil {
+			tags[key] = *value
+		}
+	}
+	return util.ManagedByCluster(tags, infra, fmt.Sprintf("kubernetes.io_cluster.%s", infra.Status.InfrastructureName)), nil
 }
 
 // RemoveStorage deletes the storage medium that was created.
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
 		return false, nil
 	}
@@ -1234,38 +1518,57 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 		return false, err
 	}
 
-	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	azClient, err := d.newAzClient(cfg, environment, nil)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get accounts client: %s", err))
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get azure client: %s", err))
 		return false, err
 	}
 
+	managed, err := d.accountManagedByCluster(azClient, cfg.ResourceGroup)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get storage account: %s", err))
+		return false, err
+	}
+	if !managed {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionTrue, storageExistsReasonNotManaged, fmt.Sprintf("The storage account %s is not tagged as managed by the operator of this cluster, it was not deleted", d.Config.AccountName))
+		return false, nil
+	}
+
 	if d.Config.NetworkAccess != nil && d.Config.NetworkAccess.Internal != nil && d.Config.NetworkAccess.Internal.PrivateEndpointName != "" {
-		azclient, err := azureclient.New(&azureclient.Options{
-			Environment:        environment,
-			TenantID:           cfg.TenantID,
-			ClientID:           cfg.ClientID,
-			ClientSecret:       cfg.ClientSecret,
-			FederatedTokenFile: cfg.FederatedTokenFile,
-			SubscriptionID:     cfg.SubscriptionID,
-		})
-		if err != nil {
+		// the private DNS is cleaned up as it was configured when the
+		// private endpoint was created, not as currently requested.
+		tags, err := azClient.PrivateEndpointTags(d.Context, cfg.ResourceGroup, d.Config.NetworkAccess.Internal.PrivateEndpointName)
+		if err != nil && !isNotFound(err) {
 			util.UpdateCondition(
 				cr,
 				defaults.StorageExists,
 				operatorapiv1.ConditionUnknown,
 				storageExistsReasonAzureError,
-				fmt.Sprintf("Unable to get azure client: %s", err),
+				fmt.Sprintf("Unable to get private endpoint: %q", err),
 			)
 			return false, err
 		}
-		if err := azclient.DestroyPrivateDNS(
-			d.Context,
-			cfg.ResourceGroup,
-			d.Config.NetworkAccess.Internal.PrivateEndpointName,
-			d.Config.NetworkAccess.Internal.VNetName,
-			d.Config.AccountName,
-		); err != nil {
+		privateDNS := privateDNSFromTags(tags)
+		switch privateDNS.Mode {
+		case overrides.AzurePrivateDNSModeUnmanaged:
+			// the private DNS zone is managed by the administrator.
+		case overrides.AzurePrivateDNSModeExistingZone:
+			err = azClient.UnlinkExistingPrivateDNSZone(
+				d.Context,
+				cfg.ResourceGroup,
+				d.Config.NetworkAccess.Internal.PrivateEndpointName,
+				privateDNS.ExistingZoneID,
+			)
+		default:
+			err = azClient.DestroyPrivateDNS(
+				d.Context,
+				cfg.ResourceGroup,
+				d.Config.NetworkAccess.Internal.PrivateEndpointName,
+				d.Config.NetworkAccess.Internal.VNetName,
+				d.Config.AccountName,
+			)
+		}
+		if err != nil {
 			util.UpdateCondition(
 				cr,
 				defaults.StorageExists,
@@ -1275,7 +1578,7 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 			)
 			return false, err
 		}
-		if err := azclient.DeletePrivateEndpoint(
+		if err := azClient.DeletePrivateEndpoint(
 			d.Context, cfg.ResourceGroup, d.Config.NetworkAccess.Internal.PrivateEndpointName,
 		); err != nil {
 			util.UpdateCondition(
@@ -1291,12 +1594,7 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 	}
 
 	if d.Config.Container != "" {
-		var accountNotFound bool
-		if isAzureStackCloud(d.Config.CloudName) {
-			accountNotFound, err = d.removeStorageContainer(cr, cfg, environment, storageAccountsClient)
-		} else {
-			accountNotFound, err = d.removeStorageContainerViaTrack2SDK(cr, cfg, environment, storageAccountsClient)
-		}
+		accountNotFound, err := d.removeStorageContainer(cr, cfg, environment, azClient)
 		if err != nil {
 			return false, err
 		}
@@ -1305,7 +1603,9 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 		}
 	}
 
-	_, err = storageAccountsClient.Delete(d.Context, cfg.ResourceGroup, d.Config.AccountName)
+	var rawResp *http.Response
+	err = azClient.DeleteStorageAccount(runtime.WithCaptureResponse(d.Context, &rawResp), cfg.ResourceGroup, d.Config.AccountName)
+	recordOperation("DeleteStorageAccount", "storageAccounts/"+d.Config.AccountName, rawResp, err)
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage account: %s", err))
 		return false, err
@@ -1324,3 +1624,13 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 func (d *driver) ID() string {
 	return d.Config.Container
 }
+
+// Capabilities returns the capabilities of Azure storage. The storage
+// account is tagged with the cluster tags.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		SupportsRedirect: true,
+		SupportsTagging:  true,
+		MultiWriterSafe:  true,
+	}
+}
@@ -1,23 +1,22 @@
 package azure
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
-	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/mocks"
-	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/google/go-cmp/cmp"
 
 	configlisters "github.com/openshift/client-go/config/listers/config/v1"
@@ -34,32 +33,125 @@ import (
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const mockTenantID = "00000000-0000-0000-0000-000000000000"
 
-type testDoer struct {
-	response   *http.Response
-	body       string
-	statusCode int
-	header     http.Header
+// fakeResponse is the answer of the fake Azure API to the requests with the
+// method whose URL path matches the regular expression path.
+type fakeResponse struct {
+	method string
+	path   string
+	status int
+	body   string
+	header http.Header
 }
 
-// Do implements the Doer interface for mocking.
-// Do accepts the passed policy request and body, then appends the response and emits it.
-func (td *testDoer) Do(r *policy.Request) (resp *http.Response, err error) {
-	// Helps in emitting sequential Responses for the same client
-	if td.response != nil {
-		return r.Next()
+// fakeAzure answers the requests of the Azure clients of the driver. A
+// request gets the first matching response that was not used yet, or the
+// last matching one once all of them were used. Requests without a matching
+// response fail.
+type fakeAzure struct {
+	responses []fakeResponse
+	used      []bool
+	// requests are the requests that were received, with their bodies.
+	requests []fakeRequest
+}
+
+type fakeRequest struct {
+	method string
+	url    *url.URL
+	header http.Header
+	body   []byte
+}
+
+// Do implements the policy.Policy interface, the request is not sent.
+func (f *fakeAzure) Do(r *policy.Request) (*http.Response, error) {
+	req := fakeRequest{method: r.Raw().Method, url: r.Raw().URL, header: r.Raw().Header}
+	if body := r.Body(); body != nil {
+		var err error
+		if req.body, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	f.requests = append(f.requests, req)
+
+	if len(f.used) != len(f.responses) {
+		f.used = make([]bool, len(f.responses))
 	}
-	resp = &http.Response{
-		StatusCode: td.statusCode,
+	match := -1
+	for i, resp := range f.responses {
+		if resp.method != req.method || !regexp.MustCompile(resp.path).MatchString(req.url.Path) {
+			continue
+		}
+		match = i
+		if !f.used[i] {
+			break
+		}
+	}
+	if match == -1 {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Request:    r.Raw(),
+			Body:       io.NopCloser(strings.NewReader(fmt.Sprintf("unexpected request %s %s", req.method, req.url))),
+		}, nil
+	}
+	f.used[match] = true
+	resp := f.responses[match]
+	header := resp.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: resp.status,
 		Request:    r.Raw(),
-		Body:       io.NopCloser(bytes.NewBufferString(td.body)),
-		Header:     td.header,
+		Body:       io.NopCloser(strings.NewReader(resp.body)),
+		Header:     header,
+	}, nil
+}
+
+// The responses of the fake Azure API to the requests of the driver.
+func nameAvailable(available bool) fakeResponse {
+	return fakeResponse{method: http.MethodPost, path: "/checkNameAvailability$", status: http.StatusOK, body: fmt.Sprintf(`{"nameAvailable":%t}`, available)}
+}
+
+func accountCreated() fakeResponse {
+	return fakeResponse{method: http.MethodPut, path: "/storageAccounts/[^/]+$", status: http.StatusOK, body: `{"properties":{"provisioningState":"Succeeded"}}`}
+}
+
+func accountKeys(key string) fakeResponse {
+	return fakeResponse{method: http.MethodPost, path: "/listKeys$", status: http.StatusOK, body: fmt.Sprintf(`{"keys":[{"value":%q}]}`, key)}
+}
+
+func containerFound() fakeResponse {
+	return fakeResponse{method: http.MethodGet, path: "^/[^/]+$", status: http.StatusOK}
+}
+
+func containerNotFound() fakeResponse {
+	return fakeResponse{method: http.MethodGet, path: "^/[^/]+$", status: http.StatusNotFound, header: http.Header{"X-Ms-Error-Code": []string{"ContainerNotFound"}}}
+}
+
+func containerCreated() fakeResponse {
+	return fakeResponse{method: http.MethodPut, path: "^/[^/]+$", status: http.StatusCreated}
+}
+
+func accountInfo(hierarchicalNamespace bool) fakeResponse {
+	return fakeResponse{method: http.MethodGet, path: "^/$", status: http.StatusOK, header: http.Header{"X-Ms-Is-Hns-Enabled": []string{fmt.Sprint(hierarchicalNamespace)}}}
+}
+
+// newStorageResponses returns the responses to the creation of a storage
+// account and of its container.
+func newStorageResponses() []fakeResponse {
+	return []fakeResponse{
+		nameAvailable(true),
+		accountCreated(),
+		accountKeys("firstKey"),
+		accountInfo(false),
+		containerNotFound(),
+		containerCreated(),
 	}
-	td.response = resp
-	return resp, nil
 }
 
 func TestGetConfig(t *testing.T) {
@@ -106,6 +198,43 @@ func TestGetConfig(t *testing.T) {
 				`should be removed so that the operator can use cluster-wide ` +
 				`secrets or it should contain a valid storage account access key`,
 		},
+		{
+			name: "only a SAS token",
+			secrets: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfigurationUser,
+						Namespace: "test",
+					},
+					Data: map[string][]byte{
+						"REGISTRY_STORAGE_AZURE_SAS_TOKEN": []byte("sig=abc"),
+					},
+				},
+			},
+			err: `the secret test/image-registry-private-configuration-user has a ` +
+				`REGISTRY_STORAGE_AZURE_SAS_TOKEN but no REGISTRY_STORAGE_AZURE_ACCOUNTKEY; ` +
+				`the registry can not authenticate with a SAS token, the secret should ` +
+				`also contain a valid storage account access key`,
+		},
+		{
+			name: "SAS token along the account key",
+			secrets: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfigurationUser,
+						Namespace: "test",
+					},
+					Data: map[string][]byte{
+						"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("abc"),
+						"REGISTRY_STORAGE_AZURE_SAS_TOKEN":  []byte("sig=abc"),
+					},
+				},
+			},
+			result: &Azure{
+				AccountKey: "abc",
+				SASToken:   "sig=abc",
+			},
+		},
 		{
 			name: "valid user provided secret",
 			secrets: []runtime.Object{
@@ -325,19 +454,9 @@ func TestConfigEnvNonAzureStackHub(t *testing.T) {
 
 	listers := testBuilder.BuildListers()
 
-	authorizer := autorest.NullAuthorizer{}
-	sender := mocks.NewSender()
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"nameAvailable":true}`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`?`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"name":"account"}`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`))
-
 	d := NewDriver(ctx, config, &listers.StorageListers)
-	d.authorizer = authorizer
-	d.sender = sender
 	d.policies = []policy.Policy{
-		&testDoer{statusCode: http.StatusCreated},
+		&fakeAzure{responses: newStorageResponses()},
 	}
 	err := d.CreateStorage(cr)
 	if err != nil {
@@ -400,21 +519,9 @@ func TestConfigEnvWorkloadIdentityNonAzureStackHub(t *testing.T) {
 
 	listers := testBuilder.BuildListers()
 
-	authorizer := autorest.NullAuthorizer{}
-	sender := mocks.NewSender()
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"nameAvailable":true}`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`?`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"name":"account"}`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`))
-	sender.AppendResponse(mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`))
-
 	d := NewDriver(ctx, config, &listers.StorageListers)
-	d.authorizer = authorizer
-	d.sender = sender
 	d.policies = []policy.Policy{
-		&testDoer{
-			statusCode: http.StatusAccepted,
-		},
+		&fakeAzure{},
 	}
 
 	envvars, err := d.ConfigEnv()
@@ -457,6 +564,7 @@ func TestConfigEnvWithUserKey(t *testing.T) {
 		},
 		Data: map[string][]byte{
 			"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("key"),
+			"REGISTRY_STORAGE_AZURE_SAS_TOKEN":  []byte("sig=abc"),
 		},
 	})
 
@@ -467,6 +575,9 @@ func TestConfigEnvWithUserKey(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if e := findEnvVar(envvars, "REGISTRY_STORAGE_AZURE_SAS_TOKEN"); e != nil {
+		t.Errorf("the SAS token must not be passed to the registry, got %v", envvars)
+	}
 
 	expectedVars := map[string]interface{}{
 		"REGISTRY_STORAGE":                   "azure",
@@ -486,22 +597,16 @@ func TestConfigEnvWithUserKey(t *testing.T) {
 	}
 }
 
-// custom sender for mocking
-type sender struct {
-	response []*http.Response
-	body     string
-}
-
-// Do implements the Sender interface for mocking
-// Do accepts the passed request and body, then appends the response and emits it.
-func (s *sender) Do(r *http.Request) (*http.Response, error) {
-	resp := &http.Response{
-		StatusCode: http.StatusOK,
-		Request:    r,
-		Body:       io.NopCloser(bytes.NewBufferString(s.body)),
+// testAzure returns the credentials of a service principal, the requests
+// made with them never reach the token endpoint.
+func testAzure() *Azure {
+	return &Azure{
+		SubscriptionID: "subscription_id",
+		ResourceGroup:  "resource_group",
+		TenantID:       mockTenantID,
+		ClientID:       "client_id",
+		ClientSecret:   "client_secret",
 	}
-	s.response = append(s.response, resp)
-	return resp, nil
 }
 
 func TestUserProvidedTags(t *testing.T) {
@@ -510,16 +615,14 @@ func TestUserProvidedTags(t *testing.T) {
 		userTags     []configv1.AzureResourceTag
 		expectedTags map[string]*string
 		infraName    string
-		responseBody string
 	}{
 		{
 			name:      "no-user-tags",
 			infraName: "some-infra",
 			// only default tags
 			expectedTags: map[string]*string{
-				"kubernetes.io_cluster.some-infra": to.StringPtr("owned"),
+				"kubernetes.io_cluster.some-infra": to.Ptr("owned"),
 			},
-			responseBody: `{"nameAvailable":true}`,
 		},
 		{
 			name:      "with-user-tags",
@@ -536,29 +639,24 @@ func TestUserProvidedTags(t *testing.T) {
 			},
 			// default tags and user tags
 			expectedTags: map[string]*string{
-				"kubernetes.io_cluster.test-infra": to.StringPtr("owned"),
-				"tag1":                             to.StringPtr("value1"),
-				"tag2":                             to.StringPtr("value2"),
+				"kubernetes.io_cluster.test-infra": to.Ptr("owned"),
+				"tag1":                             to.Ptr("value1"),
+				"tag2":                             to.Ptr("value2"),
 			},
-			responseBody: `{"nameAvailable":true}`,
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			sender := &sender{
-				body: tt.responseBody,
+			fake := &fakeAzure{
+				responses: []fakeResponse{nameAvailable(true), accountCreated()},
 			}
 
 			storageConfig := &imageregistryv1.ImageRegistryConfigStorageAzure{}
 
 			drv := NewDriver(context.Background(), storageConfig, nil)
-			drv.authorizer = autorest.NullAuthorizer{}
-			drv.sender = sender
+			drv.policies = []policy.Policy{fake}
 
 			_, _, err := drv.assureStorageAccount(
-				&Azure{
-					SubscriptionID: "subscription-id",
-					ResourceGroup:  "resource-group",
-				},
+				testAzure(),
 				&configv1.Infrastructure{
 					Status: configv1.InfrastructureStatus{
 						InfrastructureName: tt.infraName,
@@ -580,36 +678,29 @@ func TestUserProvidedTags(t *testing.T) {
 			// flag to confirm presence of tags
 			foundTags := false
 
-			for _, resp := range sender.response {
-				if resp != nil && resp.Request != nil && resp.Request.Body != nil {
+			for _, req := range fake.requests {
+				if len(req.body) == 0 {
+					continue
+				}
+				var reqBody struct {
+					Tags map[string]*string `json:"tags"`
+				}
+				if err := json.Unmarshal(req.body, &reqBody); err != nil {
+					t.Fatalf("error decoding request: %q", err)
+				}
 
-					reqBody := make(map[string]interface{})
-					if err := json.NewDecoder(resp.Request.Body).Decode(&reqBody); err != nil {
-						t.Fatalf("error decoding request: %q", err)
-					}
+				// ignore request without tags
+				if reqBody.Tags == nil {
+					continue
+				}
+				foundTags = true
 
-					// ignore request without tags
-					if _, ok := reqBody["tags"]; ok {
-						foundTags = true
-
-						tags, ok := reqBody["tags"].(map[string]interface{})
-						if !ok {
-							t.Fatal("unable to type assert tags field")
-						}
-						// convert into correct type
-						receivedTags := make(map[string]*string)
-						for k, v := range tags {
-							receivedTags[k] = to.StringPtr(fmt.Sprintf("%+v", v))
-						}
-
-						// compare the tags
-						if !reflect.DeepEqual(tt.expectedTags, receivedTags) {
-							t.Fatalf(
-								"unexpected tags: %s",
-								cmp.Diff(tt.expectedTags, receivedTags),
-							)
-						}
-					}
+				// compare the tags
+				if !reflect.DeepEqual(tt.expectedTags, reqBody.Tags) {
+					t.Fatalf(
+						"unexpected tags: %s",
+						cmp.Diff(tt.expectedTags, reqBody.Tags),
+					)
 				}
 			}
 			if !foundTags {
@@ -623,7 +714,7 @@ func Test_assureStorageAccount(t *testing.T) {
 	for _, tt := range []struct {
 		name          string
 		storageConfig *imageregistryv1.ImageRegistryConfigStorageAzure
-		mockResponses []*http.Response
+		responses     []fakeResponse
 		generated     bool
 		err           string
 		accountName   string
@@ -631,30 +722,26 @@ func Test_assureStorageAccount(t *testing.T) {
 		{
 			name:      "generate account name with success",
 			generated: true,
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":true}`),
-			},
+			responses: []fakeResponse{nameAvailable(true), accountCreated()},
 		},
 		{
-			name: "fail to generate account name",
-			err:  "create storage account failed, name not available",
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
-			},
+			name:      "fail to generate account name",
+			err:       "create storage account failed, name not available",
+			responses: []fakeResponse{nameAvailable(false)},
 		},
 		{
 			name: "error checking if account exists",
-			err:  "storage.AccountsClient#CheckNameAvailability: Failure",
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithStatus("NotFound", http.StatusNotFound),
+			err:  "RESPONSE 404",
+			responses: []fakeResponse{
+				{method: http.MethodPost, path: "/checkNameAvailability$", status: http.StatusNotFound},
 			},
 		},
 		{
 			name: "error creating account remotely",
 			err:  "failed to start creating storage account",
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":true}`),
-				mocks.NewResponseWithStatus("not found", http.StatusNotFound),
+			responses: []fakeResponse{
+				nameAvailable(true),
+				{method: http.MethodPut, path: "/storageAccounts/[^/]+$", status: http.StatusNotFound},
 			},
 		},
 		{
@@ -664,9 +751,7 @@ func Test_assureStorageAccount(t *testing.T) {
 			storageConfig: &imageregistryv1.ImageRegistryConfigStorageAzure{
 				AccountName: "myaccountname",
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":true}`),
-			},
+			responses: []fakeResponse{nameAvailable(true), accountCreated()},
 		},
 		{
 			name:        "provided account name already exists",
@@ -675,9 +760,7 @@ func Test_assureStorageAccount(t *testing.T) {
 			storageConfig: &imageregistryv1.ImageRegistryConfigStorageAzure{
 				AccountName: "myotheraccountname",
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
-			},
+			responses: []fakeResponse{nameAvailable(false)},
 		},
 		{
 			name: "invalid environment",
@@ -688,25 +771,18 @@ func Test_assureStorageAccount(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			sender := mocks.NewSender()
-			for _, response := range tt.mockResponses {
-				sender.AppendResponse(response)
-			}
-
 			storageConfig := &imageregistryv1.ImageRegistryConfigStorageAzure{}
 			if tt.storageConfig != nil {
 				storageConfig = tt.storageConfig
 			}
 
 			drv := NewDriver(context.Background(), storageConfig, nil)
-			drv.authorizer = autorest.NullAuthorizer{}
-			drv.sender = sender
+			drv.policies = []policy.Policy{
+				&fakeAzure{responses: tt.responses},
+			}
 
 			name, generated, err := drv.assureStorageAccount(
-				&Azure{
-					SubscriptionID: "subscription_id",
-					ResourceGroup:  "resource_group",
-				},
+				testAzure(),
 				&configv1.Infrastructure{},
 				map[string]*string{},
 			)
@@ -869,29 +945,22 @@ func Test_assureContainer(t *testing.T) {
 	})
 	listers := builder.BuildListers()
 
+	containerError := fakeResponse{method: http.MethodGet, path: "^/[^/]+$", status: http.StatusForbidden}
+	createError := fakeResponse{method: http.MethodPut, path: "^/[^/]+$", status: http.StatusForbidden}
+
 	for _, tt := range []struct {
 		name          string
 		storageConfig *imageregistryv1.ImageRegistryConfigStorageAzure
-		mockResponses []*http.Response
-		httpSender    func(int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error)
+		responses     []fakeResponse
 		generated     bool
 		err           string
 		containerName string
 	}{
 		{
 			name:      "fails to create a new container (generating random container name)",
-			err:       "azblob.newStorageError",
+			err:       "RESPONSE 403",
 			generated: false,
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
-			},
-			httpSender: func(req int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-				return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-					return pipeline.NewHTTPResponse(
-						mocks.NewResponseWithStatus("NotFound", http.StatusNotFound),
-					), nil
-				}
-			},
+			responses: []fakeResponse{accountKeys("firstKey"), accountInfo(false), createError},
 		},
 		{
 			name:      "fail to check if container (provided by user) exists",
@@ -901,16 +970,7 @@ func Test_assureContainer(t *testing.T) {
 				AccountName: "account_name",
 				Container:   "user-container",
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
-			},
-			httpSender: func(req int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-				return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-					return pipeline.NewHTTPResponse(
-						mocks.NewResponseWithStatus("NotFound", http.StatusNotFound),
-					), nil
-				}
-			},
+			responses: []fakeResponse{accountKeys("firstKey"), accountInfo(false), containerError},
 		},
 		{
 			name:          "use container provided by user (container exists)",
@@ -920,9 +980,7 @@ func Test_assureContainer(t *testing.T) {
 				AccountName: "account_name",
 				Container:   "user-container",
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
-			},
+			responses: []fakeResponse{accountKeys("firstKey"), accountInfo(false), containerFound()},
 		},
 		{
 			name:          "use container provided by user (container does not exist)",
@@ -932,54 +990,29 @@ func Test_assureContainer(t *testing.T) {
 				AccountName: "account_name",
 				Container:   "user-container",
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
-			},
-			httpSender: func(req int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-				if req == 0 {
-					return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-						r := mocks.NewResponseWithStatus("", http.StatusNotFound)
-						r.Header = map[string][]string{}
-						r.Header.Add("x-ms-error-code", "ContainerNotFound")
-						return pipeline.NewHTTPResponse(r), nil
-					}
-				}
-				return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-					return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
-				}
-			},
+			responses: []fakeResponse{accountKeys("firstKey"), accountInfo(false), containerNotFound(), containerCreated()},
 		},
 		{
 			name: "fail to create container provided by user",
-			err:  "azblob.newStorageError",
+			err:  "RESPONSE 403",
 			storageConfig: &imageregistryv1.ImageRegistryConfigStorageAzure{
 				AccountName: "account_name",
 				Container:   "user-container",
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
-			},
-			httpSender: func(req int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-				if req == 0 {
-					return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-						r := mocks.NewResponseWithStatus("", http.StatusNotFound)
-						r.Header = map[string][]string{}
-						r.Header.Add("x-ms-error-code", "ContainerNotFound")
-						return pipeline.NewHTTPResponse(r), nil
-					}
-				}
-				return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-					return pipeline.NewHTTPResponse(
-						mocks.NewResponseWithStatus("NotFound", http.StatusNotFound),
-					), nil
-				}
-			},
+			responses: []fakeResponse{accountKeys("firstKey"), accountInfo(false), containerNotFound(), createError},
 		},
 		{
 			name:      "generate container with success",
 			generated: true,
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
+			responses: []fakeResponse{accountKeys("firstKey"), accountInfo(false), containerCreated()},
+		},
+		{
+			name: "storage account with a hierarchical namespace",
+			err:  "hierarchical namespace",
+			responses: []fakeResponse{
+				accountKeys("firstKey"),
+				accountInfo(true),
+				containerCreated(),
 			},
 		},
 		{
@@ -992,17 +1025,12 @@ func Test_assureContainer(t *testing.T) {
 		{
 			name: "fail to list keys",
 			err:  "failed to get keys for the storage account",
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`---`),
+			responses: []fakeResponse{
+				{method: http.MethodPost, path: "/listKeys$", status: http.StatusOK, body: `---`},
 			},
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			sender := mocks.NewSender()
-			for _, response := range tt.mockResponses {
-				sender.AppendResponse(response)
-			}
-
 			storageConfig := &imageregistryv1.ImageRegistryConfigStorageAzure{
 				AccountName: "account_name",
 			}
@@ -1011,33 +1039,12 @@ func Test_assureContainer(t *testing.T) {
 			}
 
 			drv := NewDriver(context.Background(), storageConfig, &listers.StorageListers)
-			drv.authorizer = autorest.NullAuthorizer{}
-			drv.sender = sender
+			drv.policies = []policy.Policy{
+				&fakeAzure{responses: tt.responses},
+			}
 			primaryKey = cachedKey{}
 
-			var requestCounter int
-			drv.httpSender = pipeline.FactoryFunc(
-				func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
-					defer func() {
-						requestCounter++
-					}()
-
-					if tt.httpSender != nil {
-						return tt.httpSender(requestCounter)
-					}
-
-					return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-						return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
-					}
-				},
-			)
-
-			name, generated, err := drv.assureContainer(
-				&Azure{
-					SubscriptionID: "subscription_id",
-					ResourceGroup:  "resource_group",
-				},
-			)
+			name, generated, err := drv.assureContainer(testAzure())
 
 			if err != nil {
 				if len(tt.err) == 0 {
@@ -1072,114 +1079,6 @@ func Test_assureContainer(t *testing.T) {
 	}
 }
 
-func Test_containerExists(t *testing.T) {
-	for _, tt := range []struct {
-		name          string
-		httpSenderFn  func(context.Context, pipeline.Request) (pipeline.Response, error)
-		accountName   string
-		accountKey    string
-		containerName string
-		err           string
-		exists        bool
-	}{
-		{
-			name: "no account name neither account key",
-		},
-		{
-			name:          "non existent container",
-			accountName:   "account_name",
-			accountKey:    base64.StdEncoding.EncodeToString([]byte("account_key")),
-			containerName: "container_name",
-			httpSenderFn: func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-				resp := mocks.NewResponseWithStatus("NotFound", http.StatusNotFound)
-				resp.Header = map[string][]string{}
-				resp.Header.Add("x-ms-error-code", "ContainerNotFound")
-				return pipeline.NewHTTPResponse(resp), nil
-			},
-		},
-		{
-			name:          "existent container",
-			accountName:   "account_name",
-			accountKey:    base64.StdEncoding.EncodeToString([]byte("account_key")),
-			containerName: "container_name",
-			exists:        true,
-		},
-		{
-			name:          "unknown request error",
-			accountName:   "account_name",
-			accountKey:    base64.StdEncoding.EncodeToString([]byte("account_key")),
-			containerName: "container_name",
-			err:           "unable to get the storage container",
-			httpSenderFn: func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-				return pipeline.NewHTTPResponse(
-					mocks.NewResponseWithStatus("NotFound", http.StatusNotFound),
-				), nil
-			},
-		},
-		{
-			name:          "invalid account name",
-			accountName:   "account  name",
-			accountKey:    base64.StdEncoding.EncodeToString([]byte("account_key")),
-			containerName: "container_name",
-			err:           `invalid character " " in host name`,
-		},
-		{
-			name:          "invalid account key",
-			accountName:   "account_name",
-			accountKey:    "invalid base 64 string",
-			containerName: "container_name",
-			err:           "illegal base64 data",
-		},
-	} {
-		t.Run(tt.name, func(t *testing.T) {
-			environment, err := getEnvironmentByName("")
-			if err != nil {
-				t.Fatalf("unexpected error when getting environment: %v", err)
-			}
-
-			drv := NewDriver(context.Background(), nil, nil)
-			drv.authorizer = autorest.NullAuthorizer{}
-			drv.sender = mocks.NewSender()
-			drv.httpSender = pipeline.FactoryFunc(
-				func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
-					if tt.httpSenderFn != nil {
-						return tt.httpSenderFn
-					}
-					return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
-						return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
-					}
-				},
-			)
-
-			exists, err := drv.containerExists(
-				context.Background(),
-				environment,
-				tt.accountName,
-				tt.accountKey,
-				tt.containerName,
-			)
-
-			if err != nil {
-				if len(tt.err) == 0 {
-					t.Errorf("unexpected error: %v", err)
-				} else if !strings.Contains(err.Error(), tt.err) {
-					t.Errorf(
-						"expected error to be %q, %v received instead",
-						tt.err,
-						err,
-					)
-				}
-			} else if len(tt.err) > 0 {
-				t.Errorf("expected error %q, nil received instead", tt.err)
-			}
-
-			if exists != tt.exists {
-				t.Errorf("expected result to be %v, received %v", tt.exists, exists)
-			}
-		})
-	}
-}
-
 func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 	builder := cirofake.NewFixturesBuilder()
 	builder.AddInfraConfig(&configv1.Infrastructure{
@@ -1210,14 +1109,11 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 		},
 	})
 	listers := builder.BuildListers()
-	containerNotFoundHeader := http.Header{}
-	containerNotFoundHeader.Add("x-ms-error-code", "ContainerNotFound")
 
 	for _, tt := range []struct {
 		name           string
 		registryConfig *imageregistryv1.Config
-		mockResponses  []*http.Response
-		policies       []policy.Policy
+		responses      []fakeResponse
 		err            string
 		checkFn        func(*imageregistryv1.Config)
 	}{
@@ -1235,17 +1131,14 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 					t.Error("unexpected empty container")
 				}
 			},
-			policies: []policy.Policy{
-				&testDoer{
-					statusCode: http.StatusCreated,
-				},
-			},
 		},
 		{
 			name: "user providing container and account name (both already exist)",
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
+			responses: []fakeResponse{
+				nameAvailable(false),
+				accountKeys("firstKey"),
+				accountInfo(false),
+				containerFound(),
 			},
 			registryConfig: &imageregistryv1.Config{
 				Spec: imageregistryv1.ImageRegistrySpec{
@@ -1268,11 +1161,27 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 					t.Errorf("container has changed to %s", cr.Spec.Storage.Azure.Container)
 				}
 			},
-			policies: []policy.Policy{
-				&testDoer{
-					statusCode: http.StatusOK,
+		},
+		{
+			name: "user providing an account with a hierarchical namespace",
+			responses: []fakeResponse{
+				nameAvailable(false),
+				accountKeys("firstKey"),
+				accountInfo(true),
+				containerFound(),
+			},
+			registryConfig: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName: "foo_account",
+							Container:   "foo_container",
+						},
+					},
 				},
 			},
+			err:     "has a hierarchical namespace (Data Lake Storage Gen2)",
+			checkFn: func(cr *imageregistryv1.Config) {},
 		},
 		{
 			name: "user providing container and account name (both don't exist)",
@@ -1297,15 +1206,6 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 					t.Errorf("container has changed to %s", cr.Spec.Storage.Azure.Container)
 				}
 			},
-			policies: []policy.Policy{
-				&testDoer{
-					statusCode: http.StatusNotFound,
-					header:     containerNotFoundHeader,
-				},
-				&testDoer{
-					statusCode: http.StatusCreated,
-				},
-			},
 		},
 		{
 			name: "user providing container and account name (only account name exists)",
@@ -1330,18 +1230,12 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 					t.Errorf("container has changed to %s", cr.Spec.Storage.Azure.Container)
 				}
 			},
-			mockResponses: []*http.Response{
-				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
-				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
-			},
-			policies: []policy.Policy{
-				&testDoer{
-					statusCode: http.StatusNotFound,
-					header:     containerNotFoundHeader,
-				},
-				&testDoer{
-					statusCode: http.StatusCreated,
-				},
+			responses: []fakeResponse{
+				nameAvailable(false),
+				accountKeys("firstKey"),
+				accountInfo(false),
+				containerNotFound(),
+				containerCreated(),
 			},
 		},
 		{
@@ -1364,22 +1258,12 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 					t.Error("unexpected empty container")
 				}
 			},
-			policies: []policy.Policy{
-				&testDoer{statusCode: http.StatusCreated},
-			},
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			sender := mocks.NewSender()
-			if len(tt.mockResponses) > 0 {
-				for _, resp := range tt.mockResponses {
-					sender.AppendResponse(resp)
-				}
-			} else {
-				sender.AppendResponse(mocks.NewResponseWithContent(`{"nameAvailable":true}`))
-				sender.AppendResponse(mocks.NewResponseWithContent(`?`))
-				sender.AppendResponse(mocks.NewResponseWithContent(`{"name":"account"}`))
-				sender.AppendResponse(mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`))
+			responses := tt.responses
+			if responses == nil {
+				responses = newStorageResponses()
 			}
 
 			storageConfig := tt.registryConfig.Spec.Storage.Azure
@@ -1392,11 +1276,10 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 				storageConfig,
 				&listers.StorageListers,
 			)
-			drv.authorizer = autorest.NullAuthorizer{}
-			drv.sender = sender
-			if tt.policies != nil {
-				drv.policies = tt.policies
+			drv.policies = []policy.Policy{
+				&fakeAzure{responses: responses},
 			}
+			primaryKey = cachedKey{}
 
 			if err := drv.CreateStorage(tt.registryConfig); err != nil {
 				if len(tt.err) == 0 {
@@ -1416,3 +1299,486 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 		})
 	}
 }
+
+func TestPrivateDNSConfig(t *testing.T) {
+	const zoneID = "/subscriptions/sub/resourceGroups/dns-rg/providers/Microsoft.Network/privateDnsZones/privatelink.blob.core.windows.net"
+
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  overrides.AzurePrivateDNS
+		err       bool
+	}{
+		{
+			name:     "defaults to managed",
+			expected: overrides.AzurePrivateDNS{Mode: overrides.AzurePrivateDNSModeManaged},
+		},
+		{
+			name:      "unmanaged",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"privateDNS":{"mode":"Unmanaged"}}}}}}`,
+			expected:  overrides.AzurePrivateDNS{Mode: overrides.AzurePrivateDNSModeUnmanaged},
+		},
+		{
+			name:      "existing zone",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"privateDNS":{"mode":"ExistingZone","existingZoneID":"` + zoneID + `"}}}}}}`,
+			expected:  overrides.AzurePrivateDNS{Mode: overrides.AzurePrivateDNSModeExistingZone, ExistingZoneID: zoneID},
+		},
+		{
+			name:      "existing zone without id",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"privateDNS":{"mode":"ExistingZone"}}}}}}`,
+			err:       true,
+		},
+		{
+			name:      "existing zone with invalid id",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"privateDNS":{"mode":"ExistingZone","existingZoneID":"privatelink.blob.core.windows.net"}}}}}}`,
+			err:       true,
+		},
+		{
+			name:      "zone id without existing zone mode",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"privateDNS":{"existingZoneID":"` + zoneID + `"}}}}}}`,
+			err:       true,
+		},
+		{
+			name:      "unknown mode",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"privateDNS":{"mode":"Shared"}}}}}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			if tt.overrides != "" {
+				cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			}
+			privateDNS, err := privateDNSConfig(cr)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", privateDNS)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(privateDNS, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, privateDNS)
+			}
+		})
+	}
+}
+
+func TestPrivateDNSTags(t *testing.T) {
+	const zoneID = "/subscriptions/sub/resourceGroups/dns-rg/providers/Microsoft.Network/privateDnsZones/privatelink.blob.core.windows.net"
+
+	for _, privateDNS := range []overrides.AzurePrivateDNS{
+		{Mode: overrides.AzurePrivateDNSModeManaged},
+		{Mode: overrides.AzurePrivateDNSModeUnmanaged},
+		{Mode: overrides.AzurePrivateDNSModeExistingZone, ExistingZoneID: zoneID},
+	} {
+		t.Run(string(privateDNS.Mode), func(t *testing.T) {
+			tags := privateDNSTags(privateDNS)
+			tags["kubernetes.io_cluster.test"] = to.Ptr("owned")
+			if got := privateDNSFromTags(tags); !reflect.DeepEqual(got, privateDNS) {
+				t.Errorf("expected %#v, got %#v", privateDNS, got)
+			}
+		})
+	}
+
+	// private endpoints created without the tags were registered in the
+	// private DNS zone of the operator.
+	expected := overrides.AzurePrivateDNS{Mode: overrides.AzurePrivateDNSModeManaged}
+	if got := privateDNSFromTags(nil); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+}
+
+func TestSoftDeleteChanged(t *testing.T) {
+	const softDelete = `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7,"containerRetentionDays":14}}}}`
+	const message = "Soft delete is enabled on the storage account: deleted blobs are kept for 7 days, deleted containers are kept for 14 days"
+
+	for _, tt := range []struct {
+		name            string
+		overrides       string
+		managementState string
+		cloudName       string
+		condition       *operatorapiv1.OperatorCondition
+		expected        bool
+	}{
+		{
+			name:            "not requested",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+		},
+		{
+			name:            "requested, not applied yet",
+			overrides:       softDelete,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			expected:        true,
+		},
+		{
+			name:            "requested and applied",
+			overrides:       softDelete,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionTrue, Message: message},
+		},
+		{
+			name:            "retention changed",
+			overrides:       `{"storage":{"azure":{"softDelete":{"blobRetentionDays":30}}}}`,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionTrue, Message: message},
+			expected:        true,
+		},
+		{
+			name:            "previous attempt failed",
+			overrides:       softDelete,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionFalse, Reason: softDeleteReasonFailed},
+			expected:        true,
+		},
+		{
+			name:            "unmanaged storage",
+			overrides:       softDelete,
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+		},
+		{
+			name:            "azure stack hub",
+			overrides:       softDelete,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			cloudName:       "AzureStackCloud",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.managementState
+			cr.Spec.Storage.Azure = &imageregistryv1.ImageRegistryConfigStorageAzure{CloudName: tt.cloudName}
+			if tt.overrides != "" {
+				cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			}
+			if tt.condition != nil {
+				util.UpdateCondition(cr, defaults.StorageSoftDeleteEnabled, tt.condition.Status, tt.condition.Reason, tt.condition.Message)
+			}
+			if got := softDeleteChanged(cr); got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTagSyncChanged(t *testing.T) {
+	const tagSync = `{"storage":{"azure":{"tagSync":{"enabled":true}}}}`
+	const account = "imageregistryabc123"
+
+	for _, tt := range []struct {
+		name            string
+		overrides       string
+		managementState string
+		cloudName       string
+		condition       *operatorapiv1.OperatorCondition
+		lastSync        time.Duration
+		expected        bool
+	}{
+		{
+			name:            "not requested",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+		},
+		{
+			name:            "requested, never synced",
+			overrides:       tagSync,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			expected:        true,
+		},
+		{
+			name:            "synced recently",
+			overrides:       tagSync,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionTrue, Reason: tagSyncReasonSynced},
+			lastSync:        10 * time.Minute,
+		},
+		{
+			name:            "synced more than an interval ago",
+			overrides:       tagSync,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionTrue, Reason: tagSyncReasonSynced},
+			lastSync:        2 * time.Hour,
+			expected:        true,
+		},
+		{
+			name:            "shorter interval",
+			overrides:       `{"storage":{"azure":{"tagSync":{"enabled":true,"intervalSeconds":300}}}}`,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionTrue, Reason: tagSyncReasonSynced},
+			lastSync:        10 * time.Minute,
+			expected:        true,
+		},
+		{
+			name:            "previous attempt failed",
+			overrides:       tagSync,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			condition:       &operatorapiv1.OperatorCondition{Status: operatorapiv1.ConditionFalse, Reason: tagSyncReasonFailed},
+			lastSync:        10 * time.Minute,
+			expected:        true,
+		},
+		{
+			name:            "unmanaged storage",
+			overrides:       tagSync,
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+		},
+		{
+			name:            "azure stack hub",
+			overrides:       tagSync,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			cloudName:       "AzureStackCloud",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tagSyncs.account = ""
+			if tt.lastSync != 0 {
+				tagSyncs.account = account
+				tagSyncs.last = time.Now().Add(-tt.lastSync)
+			}
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.managementState
+			cr.Spec.Storage.Azure = &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName: account,
+				CloudName:   tt.cloudName,
+			}
+			if tt.overrides != "" {
+				cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			}
+			if tt.condition != nil {
+				util.UpdateCondition(cr, defaults.StorageTagged, tt.condition.Status, tt.condition.Reason, tt.condition.Message)
+			}
+			if got := tagSyncChanged(cr); got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSharedPrivateEndpointID(t *testing.T) {
+	const peID = "/subscriptions/hub/resourceGroups/hub-rg/providers/Microsoft.Network/privateEndpoints/registry"
+
+	internal := &imageregistryv1.ImageRegistryConfigStorageAzure{
+		NetworkAccess: &imageregistryv1.AzureNetworkAccess{
+			Type: imageregistryv1.AzureNetworkAccessTypeInternal,
+		},
+	}
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		config    *imageregistryv1.ImageRegistryConfigStorageAzure
+		expected  string
+		err       bool
+	}{
+		{
+			name:   "not shared",
+			config: internal,
+		},
+		{
+			name:      "shared",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"sharedPrivateEndpointID":"` + peID + `"}}}}}`,
+			config:    internal,
+			expected:  peID,
+		},
+		{
+			name:      "shared with unmanaged private DNS",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"sharedPrivateEndpointID":"` + peID + `","privateDNS":{"mode":"Unmanaged"}}}}}}`,
+			config:    internal,
+			expected:  peID,
+		},
+		{
+			name:      "shared with managed private DNS",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"sharedPrivateEndpointID":"` + peID + `","privateDNS":{"mode":"Managed"}}}}}}`,
+			config:    internal,
+			err:       true,
+		},
+		{
+			name:      "external network access",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"sharedPrivateEndpointID":"` + peID + `"}}}}}`,
+			config:    &imageregistryv1.ImageRegistryConfigStorageAzure{},
+			err:       true,
+		},
+		{
+			name:      "private endpoint managed by the operator",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"sharedPrivateEndpointID":"` + peID + `"}}}}}`,
+			config: &imageregistryv1.ImageRegistryConfigStorageAzure{
+				NetworkAccess: &imageregistryv1.AzureNetworkAccess{
+					Type: imageregistryv1.AzureNetworkAccessTypeInternal,
+					Internal: &imageregistryv1.AzureNetworkAccessInternal{
+						PrivateEndpointName: "imageregistry",
+					},
+				},
+			},
+			err: true,
+		},
+		{
+			name:      "invalid id",
+			overrides: `{"storage":{"azure":{"networkAccess":{"internal":{"sharedPrivateEndpointID":"registry"}}}}}`,
+			config:    internal,
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			if tt.overrides != "" {
+				cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			}
+			id, err := sharedPrivateEndpointID(cr, tt.config)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, id)
+			}
+		})
+	}
+}
+
+func TestGetEnvironmentByNameCustomCloud(t *testing.T) {
+	const custom = `{
+		"name": "ContosoCloud",
+		"resourceManagerEndpoint": "https://management.contoso.example/",
+		"activeDirectoryEndpoint": "https://login.contoso.example/",
+		"storageEndpointSuffix": "core.contoso.example"
+	}`
+
+	environmentFile := filepath.Join(t.TempDir(), "cloud.json")
+	if err := os.WriteFile(environmentFile, []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", environmentFile)
+
+	environment, err := getEnvironmentByName("contosocloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if environment.StorageEndpointSuffix != "core.contoso.example" {
+		t.Errorf("unexpected storage endpoint suffix %q", environment.StorageEndpointSuffix)
+	}
+	if environment.TokenAudience != "https://management.contoso.example/" {
+		t.Errorf("expected the token audience to default to the resource manager endpoint, got %q", environment.TokenAudience)
+	}
+
+	// Built-in clouds are not shadowed by the custom cloud.
+	environment, err = getEnvironmentByName("AzureUSGovernmentCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if environment.StorageEndpointSuffix != "core.usgovcloudapi.net" {
+		t.Errorf("unexpected storage endpoint suffix %q", environment.StorageEndpointSuffix)
+	}
+
+	if _, err := getEnvironmentByName("FabrikamCloud"); err == nil {
+		t.Errorf("expected an error for a cloud that is not defined")
+	}
+
+	if err := os.WriteFile(environmentFile, []byte(`{"name": "ContosoCloud", "storageEndpointSuffix": "core.contoso.example"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := customEnvironment(environmentFile); err == nil || !strings.Contains(err.Error(), "resourceManagerEndpoint, activeDirectoryEndpoint") {
+		t.Errorf("expected an error about the missing endpoints, got %v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	expected := util.Capabilities{
+		SupportsRedirect: true,
+		SupportsTagging:  true,
+		MultiWriterSafe:  true,
+	}
+	if caps := (&driver{}).Capabilities(); caps != expected {
+		t.Errorf("expected Azure storage capabilities %+v, got %+v", expected, caps)
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddConfigMaps(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.KubeCloudConfigName,
+				Namespace: defaults.OpenShiftConfigManagedNamespace,
+			},
+			Data: map[string]string{
+				defaults.CloudCABundleKey: "cloud-ca",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "storage-ca",
+				Namespace: defaults.OpenShiftConfigNamespace,
+			},
+			Data: map[string]string{
+				"ca-bundle.crt": "storage-ca",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "no-bundle",
+				Namespace: defaults.OpenShiftConfigNamespace,
+			},
+		},
+	)
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name      string
+		cloudName string
+		trustedCA string
+		bundle    string
+		err       string
+	}{
+		{
+			name: "azure",
+		},
+		{
+			name:      "azure stack hub",
+			cloudName: ashCloudName,
+			bundle:    "cloud-ca",
+		},
+		{
+			name:      "trusted CA",
+			cloudName: ashCloudName,
+			trustedCA: "storage-ca",
+			bundle:    "storage-ca",
+		},
+		{
+			name:      "trusted CA without bundle",
+			trustedCA: "no-bundle",
+			err:       `trusted CA config map "no-bundle" does not contain required key "ca-bundle.crt"`,
+		},
+		{
+			name:      "missing trusted CA",
+			trustedCA: "missing",
+			err:       `failed to get trusted CA "missing"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+				CloudName: tt.cloudName,
+			}, &listers.StorageListers)
+			drv.SetTrustedCA(tt.trustedCA)
+
+			bundle, system, err := drv.CABundle()
+			if err != nil {
+				if len(tt.err) == 0 || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			} else if len(tt.err) > 0 {
+				t.Fatalf("expected error %q, nil received instead", tt.err)
+			}
+			if bundle != tt.bundle {
+				t.Errorf("expected bundle %q, got %q", tt.bundle, bundle)
+			}
+			if !system {
+				t.Errorf("expected the system trust bundle to be used")
+			}
+		})
+	}
+}
@@ -2,16 +2,21 @@ package azureclient
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
@@ -20,9 +25,10 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/filewatcher"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 )
 
 const (
@@ -30,6 +36,19 @@ const (
 	defaultPrivateZoneName     = "privatelink.blob.core.windows.net"
 	defaultPrivateZoneLocation = "global"
 	defaultRecordSetTTL        = 10
+
+	// azureStackHubStorageAPIVersion is the version of the storage resource
+	// provider API that is used on Azure Stack Hub, it does not serve the
+	// version of the SDK.
+	azureStackHubStorageAPIVersion = "2019-06-01"
+
+	// azureStackHubBlobAPIVersion is the version of the blob service API
+	// that is used on Azure Stack Hub.
+	azureStackHubBlobAPIVersion = "2019-02-02"
+
+	// storageAccountCreateTimeout is how long the creation of a storage
+	// account is waited for.
+	storageAccountCreateTimeout = 3 * time.Minute
 )
 
 type Client struct {
@@ -48,6 +67,12 @@ type Options struct {
 	TagSet             map[string]*string
 	Policies           []policy.Policy
 	Creds              azcore.TokenCredential
+	// AzureStackHub selects the versions of the APIs that Azure Stack Hub
+	// serves.
+	AzureStackHub bool
+	// CABundle is trusted in addition to the system trust bundle, for the
+	// endpoints served with the certificates of a private CA.
+	CABundle string
 }
 
 type PrivateEndpointCreateOptions struct {
@@ -62,6 +87,9 @@ type PrivateEndpointCreateOptions struct {
 	// The resource group name used by the cluster. This is where the
 	// the storage account will be in.
 	ClusterResourceGroupName string
+	// Tags are set on the private endpoint in addition to the tags of
+	// the client.
+	Tags map[string]*string
 }
 
 func New(opts *Options) (*Client, error) {
@@ -81,11 +109,18 @@ func New(opts *Options) (*Client, error) {
 	coreOpts := azcore.ClientOptions{
 		Cloud: cloudConfig,
 	}
-	coreOpts.PerCallPolicies = opts.Policies
+	coreOpts.PerCallPolicies = append([]policy.Policy{userAgentPolicy{}}, opts.Policies...)
 	creds := opts.Creds
 	coreOpts.Retry = policy.RetryOptions{
 		MaxRetries: -1, // try once
 	}
+	if opts.CABundle != "" {
+		httpClient, err := newHTTPClient(opts.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		coreOpts.Transport = httpClient
+	}
 
 	return &Client{
 		creds:      creds,
@@ -94,6 +129,23 @@ func New(opts *Options) (*Client, error) {
 	}, nil
 }
 
+// newHTTPClient returns an HTTP client that trusts the certificates of
+// caBundle and of the system trust bundle.
+func newHTTPClient(caBundle string) (*http.Client, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load system root CA bundle: %w", err)
+	}
+	if !rootCAs.AppendCertsFromPEM([]byte(caBundle)) {
+		return nil, fmt.Errorf("no certificates found in the CA bundle")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs: rootCAs,
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
 func (c *Client) getCreds() (azcore.TokenCredential, error) {
 	if c.creds != nil {
 		return c.creds, nil
@@ -170,16 +222,29 @@ func (c *Client) getCreds() (azcore.TokenCredential, error) {
 	return c.creds, nil
 }
 
-func (c *Client) getStorageAccount(ctx context.Context, resourceGroupName, accountName string) (armstorage.Account, error) {
+// accountsClient returns a client of the storage accounts.
+func (c *Client) accountsClient() (*armstorage.AccountsClient, error) {
 	creds, err := c.getCreds()
 	if err != nil {
-		return armstorage.Account{}, fmt.Errorf("failed to get credentials: %q", err)
+		return nil, fmt.Errorf("failed to get credentials: %q", err)
+	}
+	clientOpts := *c.clientOpts
+	if c.opts.AzureStackHub {
+		clientOpts.APIVersion = azureStackHubStorageAPIVersion
 	}
 	client, err := armstorage.NewAccountsClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
-		ClientOptions: *c.clientOpts,
+		ClientOptions: clientOpts,
 	})
 	if err != nil {
-		return armstorage.Account{}, fmt.Errorf("failed to create accounts client: %q", err)
+		return nil, fmt.Errorf("failed to create accounts client: %q", err)
+	}
+	return client, nil
+}
+
+func (c *Client) getStorageAccount(ctx context.Context, resourceGroupName, accountName string) (armstorage.Account, error) {
+	client, err := c.accountsClient()
+	if err != nil {
+		return armstorage.Account{}, err
 	}
 	resp, err := client.GetProperties(ctx, resourceGroupName, accountName, nil)
 	if err != nil {
@@ -188,6 +253,102 @@ func (c *Client) getStorageAccount(ctx context.Context, resourceGroupName, accou
 	return resp.Account, nil
 }
 
+// StorageAccountNameAvailable returns true if no storage account has the
+// name accountName yet.
+func (c *Client) StorageAccountNameAvailable(ctx context.Context, accountName string) (bool, error) {
+	client, err := c.accountsClient()
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.CheckNameAvailability(ctx, armstorage.AccountCheckNameAvailabilityParameters{
+		Name: to.Ptr(accountName),
+		Type: to.Ptr("Microsoft.Storage/storageAccounts"),
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return resp.NameAvailable != nil && *resp.NameAvailable, nil
+}
+
+// CreateStorageAccount creates a storage account with the tags of the client
+// and waits until it is provisioned. Access to the account with its keys is
+// not allowed when disableSharedKeyAccess is true. On Azure Stack Hub the
+// account is created with the legacy kind and without properties, they are
+// not supported there.
+func (c *Client) CreateStorageAccount(ctx context.Context, resourceGroupName, accountName, location string, disableSharedKeyAccess bool) error {
+	client, err := c.accountsClient()
+	if err != nil {
+		return err
+	}
+
+	params := armstorage.AccountCreateParameters{
+		Kind:     to.Ptr(armstorage.KindStorageV2),
+		Location: to.Ptr(location),
+		SKU: &armstorage.SKU{
+			Name: to.Ptr(armstorage.SKUNameStandardLRS),
+		},
+		Tags: c.opts.TagSet,
+		Properties: &armstorage.AccountPropertiesCreateParameters{
+			EnableHTTPSTrafficOnly: to.Ptr(true),
+			AllowBlobPublicAccess:  to.Ptr(false),
+			MinimumTLSVersion:      to.Ptr(armstorage.MinimumTLSVersionTLS12),
+		},
+	}
+	if disableSharedKeyAccess {
+		params.Properties.AllowSharedKeyAccess = to.Ptr(false)
+	}
+	if c.opts.AzureStackHub {
+		params.Kind = to.Ptr(armstorage.KindStorage)
+		params.Properties = nil
+	}
+
+	poller, err := client.BeginCreate(ctx, resourceGroupName, accountName, params, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start creating storage account: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, storageAccountCreateTimeout)
+	defer cancel()
+	if _, err := poller.PollUntilDone(ctx, &runtime.PollUntilDoneOptions{Frequency: 10 * time.Second}); err != nil {
+		return fmt.Errorf("failed to finish creating storage account: %w", err)
+	}
+	return nil
+}
+
+// StorageAccountKey returns the primary key of the storage account.
+func (c *Client) StorageAccountKey(ctx context.Context, resourceGroupName, accountName string) (string, error) {
+	client, err := c.accountsClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.ListKeys(ctx, resourceGroupName, accountName, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Keys) == 0 || resp.Keys[0].Value == nil {
+		return "", fmt.Errorf("the storage account %s has no keys", accountName)
+	}
+	return *resp.Keys[0].Value, nil
+}
+
+// StorageAccountTags returns the tags of the storage account.
+func (c *Client) StorageAccountTags(ctx context.Context, resourceGroupName, accountName string) (map[string]*string, error) {
+	account, err := c.getStorageAccount(ctx, resourceGroupName, accountName)
+	if err != nil {
+		return nil, err
+	}
+	return account.Tags, nil
+}
+
+// DeleteStorageAccount deletes the storage account.
+func (c *Client) DeleteStorageAccount(ctx context.Context, resourceGroupName, accountName string) error {
+	client, err := c.accountsClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.Delete(ctx, resourceGroupName, accountName, nil)
+	return err
+}
+
 func (c *Client) vnetHasAnyTag(vnet armnetwork.VirtualNetwork, tagFilter map[string][]string) bool {
 	for tagKey, tagValues := range tagFilter {
 		tag, ok := vnet.Tags[tagKey]
@@ -263,15 +424,9 @@ func (c *Client) GetSubnetsByVNet(ctx context.Context, resourceGroupName, vnetNa
 }
 
 func (c *Client) UpdateStorageAccountNetworkAccess(ctx context.Context, resourceGroupName, accountName string, allowPublicAccess bool) error {
-	creds, err := c.getCreds()
-	if err != nil {
-		return fmt.Errorf("failed to get credentials: %q", err)
-	}
-	client, err := armstorage.NewAccountsClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
-		ClientOptions: *c.clientOpts,
-	})
+	client, err := c.accountsClient()
 	if err != nil {
-		return fmt.Errorf("failed to create accounts client: %q", err)
+		return err
 	}
 	publicNetworkAccess := armstorage.PublicNetworkAccessDisabled
 	if allowPublicAccess {
@@ -289,23 +444,92 @@ func (c *Client) UpdateStorageAccountNetworkAccess(ctx context.Context, resource
 }
 
 func (c *Client) DisableStorageAccountAccessKeyAccess(ctx context.Context, resourceGroupName, accountName string) error {
+	client, err := c.accountsClient()
+	if err != nil {
+		return err
+	}
+
+	params := armstorage.AccountUpdateParameters{
+		Properties: &armstorage.AccountPropertiesUpdateParameters{
+			AllowSharedKeyAccess: to.Ptr(false),
+		},
+	}
+	if _, err := client.Update(ctx, resourceGroupName, accountName, params, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MergeStorageAccountTags sets tags on the storage account, overwriting the
+// values of the keys that already exist. The other tags of the account are
+// kept. It returns true if the account had to be updated.
+func (c *Client) MergeStorageAccountTags(ctx context.Context, resourceGroupName, accountName string, tags map[string]*string) (bool, error) {
+	account, err := c.getStorageAccount(ctx, resourceGroupName, accountName)
+	if err != nil {
+		return false, err
+	}
+
+	merged := make(map[string]*string, len(account.Tags)+len(tags))
+	for key, value := range account.Tags {
+		merged[key] = value
+	}
+	changed := false
+	for key, value := range tags {
+		if current, ok := merged[key]; !ok || ptr.Deref(current, "") != ptr.Deref(value, "") {
+			changed = true
+		}
+		merged[key] = value
+	}
+	if !changed {
+		return false, nil
+	}
+
+	client, err := c.accountsClient()
+	if err != nil {
+		return false, err
+	}
+	params := armstorage.AccountUpdateParameters{
+		Tags: merged,
+	}
+	if _, err := client.Update(ctx, resourceGroupName, accountName, params, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ConfigureSoftDelete enables the soft delete of the blobs and of the
+// containers of the storage account. Deleted blobs are kept for
+// blobRetentionDays and deleted containers for containerRetentionDays, a
+// zero number of days leaves the setting unchanged.
+func (c *Client) ConfigureSoftDelete(ctx context.Context, resourceGroupName, accountName string, blobRetentionDays, containerRetentionDays int32) error {
 	creds, err := c.getCreds()
 	if err != nil {
 		return fmt.Errorf("failed to get credentials: %q", err)
 	}
-	client, err := armstorage.NewAccountsClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
+	client, err := armstorage.NewBlobServicesClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
 		ClientOptions: *c.clientOpts,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create accounts client: %q", err)
+		return fmt.Errorf("failed to create blob services client: %q", err)
 	}
 
-	params := armstorage.AccountUpdateParameters{
-		Properties: &armstorage.AccountPropertiesUpdateParameters{
-			AllowSharedKeyAccess: to.BoolPtr(false),
-		},
+	props := &armstorage.BlobServicePropertiesProperties{}
+	if blobRetentionDays > 0 {
+		props.DeleteRetentionPolicy = &armstorage.DeleteRetentionPolicy{
+			Enabled: to.Ptr(true),
+			Days:    to.Ptr(blobRetentionDays),
+		}
 	}
-	if _, err := client.Update(ctx, resourceGroupName, accountName, params, nil); err != nil {
+	if containerRetentionDays > 0 {
+		props.ContainerDeleteRetentionPolicy = &armstorage.DeleteRetentionPolicy{
+			Enabled: to.Ptr(true),
+			Days:    to.Ptr(containerRetentionDays),
+		}
+	}
+	params := armstorage.BlobServiceProperties{
+		BlobServiceProperties: props,
+	}
+	if _, err := client.SetServiceProperties(ctx, resourceGroupName, accountName, params, nil); err != nil {
 		return err
 	}
 	return nil
@@ -355,6 +579,118 @@ func (c *Client) PrivateEndpointExists(ctx context.Context, resourceGroupName, p
 	return true, nil
 }
 
+// PrivateEndpointID identifies a private endpoint. Shared private endpoints
+// may live in another subscription than the cluster.
+type PrivateEndpointID struct {
+	SubscriptionID    string
+	ResourceGroupName string
+	Name              string
+}
+
+// ParsePrivateEndpointID validates the resource ID of a private endpoint.
+func ParsePrivateEndpointID(id string) (PrivateEndpointID, error) {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	if len(parts) != 8 ||
+		!strings.EqualFold(parts[0], "subscriptions") ||
+		!strings.EqualFold(parts[2], "resourceGroups") ||
+		!strings.EqualFold(parts[4], "providers") ||
+		!strings.EqualFold(parts[5], "Microsoft.Network") ||
+		!strings.EqualFold(parts[6], "privateEndpoints") ||
+		parts[1] == "" || parts[3] == "" || parts[7] == "" {
+		return PrivateEndpointID{}, fmt.Errorf("invalid private endpoint ID %q, expected /subscriptions/<id>/resourceGroups/<name>/providers/Microsoft.Network/privateEndpoints/<name>", id)
+	}
+	return PrivateEndpointID{
+		SubscriptionID:    parts[1],
+		ResourceGroupName: parts[3],
+		Name:              parts[7],
+	}, nil
+}
+
+// CheckSharedPrivateEndpoint verifies that the existing private endpoint id
+// serves the blob service of the storage account and that its connection is
+// approved. The private endpoint is not modified.
+func (c *Client) CheckSharedPrivateEndpoint(ctx context.Context, id, accountName string) error {
+	peID, err := ParsePrivateEndpointID(id)
+	if err != nil {
+		return err
+	}
+	creds, err := c.getCreds()
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %q", err)
+	}
+	client, err := armnetwork.NewPrivateEndpointsClient(
+		peID.SubscriptionID,
+		creds,
+		&arm.ClientOptions{
+			ClientOptions: *c.clientOpts,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get private endpoints client: %q", err)
+	}
+	resp, err := client.Get(ctx, peID.ResourceGroupName, peID.Name, nil)
+	if err != nil {
+		if c.is404(err) {
+			return fmt.Errorf("private endpoint %s not found", id)
+		}
+		return err
+	}
+	return checkPrivateEndpointConnection(&resp.PrivateEndpoint, accountName)
+}
+
+// checkPrivateEndpointConnection returns an error unless pe is provisioned
+// and has an approved connection to the blob service of the storage account.
+// Storage account names are globally unique, the account may live in another
+// subscription or resource group than the cluster.
+func checkPrivateEndpointConnection(pe *armnetwork.PrivateEndpoint, accountName string) error {
+	if pe.Properties == nil {
+		return fmt.Errorf("private endpoint has no properties")
+	}
+	if state := pe.Properties.ProvisioningState; state == nil || *state != armnetwork.ProvisioningStateSucceeded {
+		return fmt.Errorf("private endpoint is not provisioned")
+	}
+
+	var connections []*armnetwork.PrivateLinkServiceConnection
+	connections = append(connections, pe.Properties.PrivateLinkServiceConnections...)
+	connections = append(connections, pe.Properties.ManualPrivateLinkServiceConnections...)
+	for _, conn := range connections {
+		if conn == nil || conn.Properties == nil || conn.Properties.PrivateLinkServiceID == nil {
+			continue
+		}
+		if !isStorageAccountID(*conn.Properties.PrivateLinkServiceID, accountName) {
+			continue
+		}
+		hasBlob := false
+		for _, groupID := range conn.Properties.GroupIDs {
+			if groupID != nil && strings.EqualFold(*groupID, targetSubResource) {
+				hasBlob = true
+			}
+		}
+		if !hasBlob {
+			continue
+		}
+		status := ""
+		if state := conn.Properties.PrivateLinkServiceConnectionState; state != nil && state.Status != nil {
+			status = *state.Status
+		}
+		if status != "Approved" {
+			return fmt.Errorf("the connection of the private endpoint to the storage account is %q, not Approved", status)
+		}
+		return nil
+	}
+	return fmt.Errorf("private endpoint is not connected to the %s service of the storage account %s", targetSubResource, accountName)
+}
+
+// isStorageAccountID returns whether id is the resource ID of the storage
+// account accountName.
+func isStorageAccountID(id, accountName string) bool {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	return len(parts) == 8 &&
+		strings.EqualFold(parts[5], "Microsoft.Storage") &&
+		strings.EqualFold(parts[6], "storageAccounts") &&
+		strings.EqualFold(parts[7], accountName)
+}
+
 func (c *Client) CreatePrivateEndpoint(
 	ctx context.Context,
 	opts *PrivateEndpointCreateOptions,
@@ -388,17 +724,25 @@ func (c *Client) CreatePrivateEndpoint(
 
 	privateEndpointName := opts.PrivateEndpointName
 
+	tags := make(map[string]*string, len(c.opts.TagSet)+len(opts.Tags))
+	for k, v := range c.opts.TagSet {
+		tags[k] = v
+	}
+	for k, v := range opts.Tags {
+		tags[k] = v
+	}
+
 	params := armnetwork.PrivateEndpoint{
-		Location: to.StringPtr(opts.Location),
-		Tags:     c.opts.TagSet,
+		Location: to.Ptr(opts.Location),
+		Tags:     tags,
 		Properties: &armnetwork.PrivateEndpointProperties{
-			CustomNetworkInterfaceName: to.StringPtr(fmt.Sprintf("%s-nic", privateEndpointName)),
-			Subnet:                     &armnetwork.Subnet{ID: to.StringPtr(subnetID)},
+			CustomNetworkInterfaceName: to.Ptr(fmt.Sprintf("%s-nic", privateEndpointName)),
+			Subnet:                     &armnetwork.Subnet{ID: to.Ptr(subnetID)},
 			PrivateLinkServiceConnections: []*armnetwork.PrivateLinkServiceConnection{{
-				Name: to.StringPtr(privateEndpointName),
+				Name: to.Ptr(privateEndpointName),
 				Properties: &armnetwork.PrivateLinkServiceConnectionProperties{
-					PrivateLinkServiceID: to.StringPtr(privateLinkResourceID),
-					GroupIDs:             []*string{to.StringPtr(targetSubResource)},
+					PrivateLinkServiceID: to.Ptr(privateLinkResourceID),
+					GroupIDs:             []*string{to.Ptr(targetSubResource)},
 				},
 			}},
 		},
@@ -421,6 +765,29 @@ func (c *Client) CreatePrivateEndpoint(
 	return &resp.PrivateEndpoint, nil
 }
 
+// PrivateEndpointTags returns the tags of the private endpoint.
+func (c *Client) PrivateEndpointTags(ctx context.Context, resourceGroupName, privateEndpointName string) (map[string]*string, error) {
+	creds, err := c.getCreds()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %q", err)
+	}
+	client, err := armnetwork.NewPrivateEndpointsClient(
+		c.opts.SubscriptionID,
+		creds,
+		&arm.ClientOptions{
+			ClientOptions: *c.clientOpts,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private endpoints client: %q", err)
+	}
+	resp, err := client.Get(ctx, resourceGroupName, privateEndpointName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Tags, nil
+}
+
 func (c *Client) DeletePrivateEndpoint(ctx context.Context, resourceGroupName, privateEndpointName string) error {
 	creds, err := c.getCreds()
 	if err != nil {
@@ -473,7 +840,8 @@ func (c *Client) ConfigurePrivateDNS(
 		return err
 	}
 
-	if err := c.createPrivateDNSZoneGroup(ctx, clusterResourceGroupName, *privateEndpoint.Name, defaultPrivateZoneName); err != nil {
+	privateZoneID := formatPrivateDNSZoneID(c.opts.SubscriptionID, clusterResourceGroupName, defaultPrivateZoneName)
+	if err := c.createPrivateDNSZoneGroup(ctx, clusterResourceGroupName, *privateEndpoint.Name, defaultPrivateZoneName, privateZoneID); err != nil {
 		return err
 	}
 
@@ -522,6 +890,50 @@ func (c *Client) DestroyPrivateDNS(ctx context.Context, resourceGroupName, priva
 	return nil
 }
 
+// LinkExistingPrivateDNSZone registers the given private endpoint in an
+// existing private DNS zone by creating a private DNS zone group. Azure keeps
+// the A record of the endpoint in the zone up to date through the group.
+//
+// The zone and its virtual network links are managed by the administrator.
+func (c *Client) LinkExistingPrivateDNSZone(ctx context.Context, resourceGroupName, privateEndpointName, privateZoneID string) error {
+	privateZoneName, err := ParsePrivateDNSZoneID(privateZoneID)
+	if err != nil {
+		return err
+	}
+	return c.createPrivateDNSZoneGroup(ctx, resourceGroupName, privateEndpointName, privateZoneName, privateZoneID)
+}
+
+// UnlinkExistingPrivateDNSZone removes the private DNS zone group created by
+// LinkExistingPrivateDNSZone. The zone itself is not touched.
+func (c *Client) UnlinkExistingPrivateDNSZone(ctx context.Context, resourceGroupName, privateEndpointName, privateZoneID string) error {
+	privateZoneName, err := ParsePrivateDNSZoneID(privateZoneID)
+	if err != nil {
+		return err
+	}
+	if err := c.deletePrivateDNSZoneGroup(
+		ctx, resourceGroupName, privateEndpointName, privateZoneName,
+	); err != nil && !c.is404(err) {
+		return err
+	}
+	return nil
+}
+
+// ParsePrivateDNSZoneID validates the resource ID of a private DNS zone and
+// returns the name of the zone.
+func ParsePrivateDNSZoneID(id string) (string, error) {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	if len(parts) != 8 ||
+		!strings.EqualFold(parts[0], "subscriptions") ||
+		!strings.EqualFold(parts[2], "resourceGroups") ||
+		!strings.EqualFold(parts[4], "providers") ||
+		!strings.EqualFold(parts[5], "Microsoft.Network") ||
+		!strings.EqualFold(parts[6], "privateDnsZones") ||
+		parts[1] == "" || parts[3] == "" || parts[7] == "" {
+		return "", fmt.Errorf("invalid private DNS zone ID %q, expected /subscriptions/<id>/resourceGroups/<name>/providers/Microsoft.Network/privateDnsZones/<zone>", id)
+	}
+	return parts[7], nil
+}
+
 func (c *Client) createPrivateDNSZone(ctx context.Context, resourceGroupName, name, location string) error {
 	creds, err := c.getCreds()
 	if err != nil {
@@ -538,7 +950,7 @@ func (c *Client) createPrivateDNSZone(ctx context.Context, resourceGroupName, na
 		resourceGroupName,
 		name,
 		armprivatedns.PrivateZone{
-			Location: to.StringPtr(location),
+			Location: to.Ptr(location),
 			Tags:     c.opts.TagSet,
 		},
 		nil,
@@ -577,9 +989,9 @@ func (c *Client) createRecordSet(
 
 	rs := armprivatedns.RecordSet{
 		Properties: &armprivatedns.RecordSetProperties{
-			TTL: to.Int64Ptr(defaultRecordSetTTL),
+			TTL: to.Ptr[int64](defaultRecordSetTTL),
 			ARecords: []*armprivatedns.ARecord{{
-				IPv4Address: to.StringPtr(nicAddress),
+				IPv4Address: to.Ptr(nicAddress),
 			}},
 		},
 	}
@@ -624,7 +1036,7 @@ func (c *Client) deleteRecordSet(ctx context.Context, resourceGroupName, private
 	return nil
 }
 
-func (c *Client) createPrivateDNSZoneGroup(ctx context.Context, resourceGroupName, privateEndpointName, privateZoneName string) error {
+func (c *Client) createPrivateDNSZoneGroup(ctx context.Context, resourceGroupName, privateEndpointName, privateZoneName, privateZoneID string) error {
 	creds, err := c.getCreds()
 	if err != nil {
 		return fmt.Errorf("failed to get credentials: %q", err)
@@ -635,15 +1047,14 @@ func (c *Client) createPrivateDNSZoneGroup(ctx context.Context, resourceGroupNam
 	if err != nil {
 		return fmt.Errorf("failed to get private dns zone groups client: %q", err)
 	}
-	privateZoneID := formatPrivateDNSZoneID(c.opts.SubscriptionID, resourceGroupName, privateZoneName)
 	groupName := strings.Replace(privateZoneName, ".", "-", -1)
 	group := armnetwork.PrivateDNSZoneGroup{
-		Name: to.StringPtr(fmt.Sprintf("%s/default", privateZoneName)),
+		Name: to.Ptr(fmt.Sprintf("%s/default", privateZoneName)),
 		Properties: &armnetwork.PrivateDNSZoneGroupPropertiesFormat{
 			PrivateDNSZoneConfigs: []*armnetwork.PrivateDNSZoneConfig{{
-				Name: to.StringPtr(groupName),
+				Name: to.Ptr(groupName),
 				Properties: &armnetwork.PrivateDNSZonePropertiesFormat{
-					PrivateDNSZoneID: to.StringPtr(privateZoneID),
+					PrivateDNSZoneID: to.Ptr(privateZoneID),
 				},
 			}},
 		},
@@ -721,11 +1132,11 @@ func (c *Client) createVirtualNetworkLink(
 		privateZoneName,
 		linkName,
 		armprivatedns.VirtualNetworkLink{
-			Location: to.StringPtr(privateZoneLocation),
+			Location: to.Ptr(privateZoneLocation),
 			Tags:     c.opts.TagSet,
 			Properties: &armprivatedns.VirtualNetworkLinkProperties{
-				RegistrationEnabled: to.BoolPtr(false),
-				VirtualNetwork:      &armprivatedns.SubResource{ID: to.StringPtr(vnetID)},
+				RegistrationEnabled: to.Ptr(false),
+				VirtualNetwork:      &armprivatedns.SubResource{ID: to.Ptr(vnetID)},
 			},
 		},
 		nil,
@@ -870,15 +1281,42 @@ func validate(opts *Options) error {
 	return nil
 }
 
+// userAgentPolicy adds the user agent of the operator to the requests.
+type userAgentPolicy struct{}
+
+func (userAgentPolicy) Do(req *policy.Request) (*http.Response, error) {
+	header := req.Raw().Header
+	header.Set("User-Agent", strings.TrimSpace(header.Get("User-Agent")+" "+defaults.UserAgent))
+	return req.Next()
+}
+
+// apiVersionPolicy sets the version of the blob service API that is
+// requested.
+type apiVersionPolicy string
+
+func (v apiVersionPolicy) Do(req *policy.Request) (*http.Response, error) {
+	req.Raw().Header.Set("x-ms-version", string(v))
+	return req.Next()
+}
+
+// blobClientOptions returns the options of the blob clients.
+func (c *Client) blobClientOptions() *azblob.ClientOptions {
+	clientOpts := *c.clientOpts
+	if c.opts.AzureStackHub {
+		clientOpts.PerCallPolicies = append([]policy.Policy{apiVersionPolicy(azureStackHubBlobAPIVersion)}, clientOpts.PerCallPolicies...)
+	}
+	return &azblob.ClientOptions{
+		ClientOptions: clientOpts,
+	}
+}
+
 func (c *Client) NewBlobClient(environment autorestazure.Environment, accountName, key, blobURL string) (*BlobClient, error) {
 	if key != "" {
 		cred, err := azblob.NewSharedKeyCredential(accountName, key)
 		if err != nil {
 			return nil, err
 		}
-		client, err := azblob.NewClientWithSharedKeyCredential(blobURL, cred, &azblob.ClientOptions{
-			ClientOptions: *c.clientOpts,
-		})
+		client, err := azblob.NewClientWithSharedKeyCredential(blobURL, cred, c.blobClientOptions())
 		return &BlobClient{
 			client: client,
 		}, err
@@ -888,9 +1326,16 @@ func (c *Client) NewBlobClient(environment autorestazure.Environment, accountNam
 	if err != nil {
 		return nil, fmt.Errorf("failed to get credentials: %q", err)
 	}
-	client, err := azblob.NewClient(blobURL, creds, &azblob.ClientOptions{
-		ClientOptions: *c.clientOpts,
-	})
+	client, err := azblob.NewClient(blobURL, creds, c.blobClientOptions())
+	return &BlobClient{
+		client: client,
+	}, err
+}
+
+// NewBlobClientWithSAS returns a blob client that authenticates with the SAS
+// token sasToken.
+func (c *Client) NewBlobClientWithSAS(blobURL, sasToken string) (*BlobClient, error) {
+	client, err := azblob.NewClientWithNoCredential(blobURL+"?"+strings.TrimPrefix(sasToken, "?"), c.blobClientOptions())
 	return &BlobClient{
 		client: client,
 	}, err
@@ -918,6 +1363,35 @@ func (client *BlobClient) ContainerExists(ctx context.Context, accountName, cont
 	return true, nil
 }
 
+// HierarchicalNamespaceEnabled returns true if the storage account has a
+// hierarchical namespace, i.e. it is a Data Lake Storage Gen2 account.
+func (client *BlobClient) HierarchicalNamespaceEnabled(ctx context.Context) (bool, error) {
+	info, err := client.client.ServiceClient().GetAccountInfo(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("unable to get the storage account information: %w", err)
+	}
+	return info.IsHierarchicalNamespaceEnabled != nil && *info.IsHierarchicalNamespaceEnabled, nil
+}
+
+// ContainerUsage returns the total size and the number of the blobs of a
+// container.
+func (client *BlobClient) ContainerUsage(ctx context.Context, containerName string) (bytes int64, blobs int64, err error) {
+	pager := client.client.NewListBlobsFlatPager(containerName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return bytes, blobs, err
+		}
+		for _, blob := range page.Segment.BlobItems {
+			if blob.Properties != nil && blob.Properties.ContentLength != nil {
+				bytes += *blob.Properties.ContentLength
+			}
+			blobs++
+		}
+	}
+	return bytes, blobs, nil
+}
+
 func (client *BlobClient) CreateStorageContainer(ctx context.Context, containerName string) error {
 	_, err := client.client.CreateContainer(ctx, containerName, &azblob.CreateContainerOptions{})
 	return err
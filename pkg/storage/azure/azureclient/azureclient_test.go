@@ -5,16 +5,23 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
 type testDoer struct {
-	response []*http.Response
-	body     string
+	response   []*http.Response
+	body       string
+	statusCode int
+	header     http.Header
 }
 
 // Do implements the Doer interface for mocking.
@@ -24,6 +31,13 @@ func (td *testDoer) Do(r *policy.Request) (*http.Response, error) {
 		StatusCode: http.StatusOK,
 		Request:    r.Raw(),
 		Body:       io.NopCloser(bytes.NewBufferString(td.body)),
+		Header:     td.header,
+	}
+	if td.statusCode != 0 {
+		resp.StatusCode = td.statusCode
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
 	}
 	td.response = append(td.response, resp)
 	return resp, nil
@@ -42,6 +56,15 @@ func TestNew(t *testing.T) {
 			t.Logf("got %q", err)
 		}
 	})
+	t.Run("with an invalid CA bundle", func(t *testing.T) {
+		_, err := New(&Options{
+			Environment: autorestazure.PublicCloud,
+			CABundle:    "not a certificate",
+		})
+		if err == nil || !strings.Contains(err.Error(), "no certificates found in the CA bundle") {
+			t.Errorf("expected the CA bundle to be rejected, got %v", err)
+		}
+	})
 	t.Run("with correct options", func(t *testing.T) {
 		opts := &Options{
 			Environment: autorestazure.Environment{
@@ -128,3 +151,409 @@ func TestCreatePrivateEndpoint(t *testing.T) {
 		t.Fatalf("unexpected error: %q", err)
 	}
 }
+
+func TestConfigureSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	doer := &testDoer{}
+	client, err := New(&Options{
+		Environment: autorestazure.Environment{
+			ActiveDirectoryEndpoint: "https://test-active-directory-endpoint",
+			TokenAudience:           "test-token-audience",
+			ResourceManagerEndpoint: "https://test-resource-manager-endpoint",
+		},
+		TenantID:       "test-tenant-id",
+		ClientID:       "test-client-id",
+		ClientSecret:   "test-client-secret",
+		SubscriptionID: "test-subscription-id",
+		Policies: []policy.Policy{
+			doer,
+		},
+		Creds: &azfake.TokenCredential{},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %q", err)
+	}
+
+	if err := client.ConfigureSoftDelete(ctx, "test-resource-group", "imageregistryabc123", 7, 0); err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	if len(doer.response) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(doer.response))
+	}
+	req := doer.response[0].Request
+	if req.Method != http.MethodPut || !strings.HasSuffix(req.URL.Path, "/storageAccounts/imageregistryabc123/blobServices/default") {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"properties":{"deleteRetentionPolicy":{"days":7,"enabled":true}}}`
+	if string(body) != expected {
+		t.Errorf("expected body %s, got %s", expected, body)
+	}
+}
+
+func TestCreateStorageAccount(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name                   string
+		azureStackHub          bool
+		disableSharedKeyAccess bool
+		apiVersion             string
+		expected               string
+	}{
+		{
+			name:       "azure",
+			apiVersion: "2023-05-01",
+			expected:   `{"kind":"StorageV2","location":"eastus","properties":{"allowBlobPublicAccess":false,"minimumTlsVersion":"TLS1_2","supportsHttpsTrafficOnly":true},"sku":{"name":"Standard_LRS"},"tags":{"team":"registry"}}`,
+		},
+		{
+			name:                   "azure with workload identity",
+			disableSharedKeyAccess: true,
+			apiVersion:             "2023-05-01",
+			expected:               `{"kind":"StorageV2","location":"eastus","properties":{"allowBlobPublicAccess":false,"allowSharedKeyAccess":false,"minimumTlsVersion":"TLS1_2","supportsHttpsTrafficOnly":true},"sku":{"name":"Standard_LRS"},"tags":{"team":"registry"}}`,
+		},
+		{
+			name:          "azure stack hub",
+			azureStackHub: true,
+			apiVersion:    azureStackHubStorageAPIVersion,
+			expected:      `{"kind":"Storage","location":"eastus","sku":{"name":"Standard_LRS"},"tags":{"team":"registry"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doer := &testDoer{body: `{"properties":{"provisioningState":"Succeeded"}}`}
+			client, err := New(&Options{
+				Environment: autorestazure.Environment{
+					ActiveDirectoryEndpoint: "https://test-active-directory-endpoint",
+					TokenAudience:           "test-token-audience",
+					ResourceManagerEndpoint: "https://test-resource-manager-endpoint",
+				},
+				TenantID:       "test-tenant-id",
+				ClientID:       "test-client-id",
+				ClientSecret:   "test-client-secret",
+				SubscriptionID: "test-subscription-id",
+				TagSet:         map[string]*string{"team": to.Ptr("registry")},
+				Policies: []policy.Policy{
+					doer,
+				},
+				Creds:         &azfake.TokenCredential{},
+				AzureStackHub: tt.azureStackHub,
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %q", err)
+			}
+
+			if err := client.CreateStorageAccount(ctx, "test-resource-group", "imageregistryabc123", "eastus", tt.disableSharedKeyAccess); err != nil {
+				t.Fatalf("unexpected error: %q", err)
+			}
+			if len(doer.response) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(doer.response))
+			}
+			req := doer.response[0].Request
+			if req.Method != http.MethodPut || !strings.HasSuffix(req.URL.Path, "/storageAccounts/imageregistryabc123") {
+				t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+			}
+			if v := req.URL.Query().Get("api-version"); v != tt.apiVersion {
+				t.Errorf("expected api-version %s, got %s", tt.apiVersion, v)
+			}
+			if ua := req.Header.Get("User-Agent"); !strings.HasSuffix(ua, defaults.UserAgent) {
+				t.Errorf("expected the user agent of the operator, got %q", ua)
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.expected {
+				t.Errorf("expected body %s, got %s", tt.expected, body)
+			}
+		})
+	}
+}
+
+func TestBlobClientContainerExists(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name          string
+		doer          *testDoer
+		azureStackHub bool
+		containerName string
+		err           string
+		exists        bool
+	}{
+		{
+			name: "no container name",
+			doer: &testDoer{},
+		},
+		{
+			name:          "non existent container",
+			containerName: "container_name",
+			doer: &testDoer{
+				statusCode: http.StatusNotFound,
+				header:     http.Header{"X-Ms-Error-Code": []string{"ContainerNotFound"}},
+			},
+		},
+		{
+			name:          "existent container",
+			containerName: "container_name",
+			doer:          &testDoer{},
+			exists:        true,
+		},
+		{
+			name:          "existent container on azure stack hub",
+			containerName: "container_name",
+			doer:          &testDoer{},
+			azureStackHub: true,
+			exists:        true,
+		},
+		{
+			name:          "unknown request error",
+			containerName: "container_name",
+			doer:          &testDoer{statusCode: http.StatusNotFound},
+			err:           "unable to get the storage container",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(&Options{
+				Environment: autorestazure.PublicCloud,
+				Policies: []policy.Policy{
+					tt.doer,
+				},
+				Creds:         &azfake.TokenCredential{},
+				AzureStackHub: tt.azureStackHub,
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %q", err)
+			}
+			blobClient, err := client.NewBlobClient(autorestazure.PublicCloud, "account", "YWNjb3VudF9rZXk=", "https://account.blob.core.windows.net/")
+			if err != nil {
+				t.Fatalf("failed to create blob client: %q", err)
+			}
+
+			exists, err := blobClient.ContainerExists(ctx, "account", tt.containerName)
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error: %v", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error to be %q, %v received instead", tt.err, err)
+				}
+			} else if len(tt.err) > 0 {
+				t.Errorf("expected error %q, nil received instead", tt.err)
+			}
+			if exists != tt.exists {
+				t.Errorf("expected result to be %v, received %v", tt.exists, exists)
+			}
+
+			if tt.azureStackHub {
+				req := tt.doer.response[0].Request
+				if v := req.Header.Get("x-ms-version"); v != azureStackHubBlobAPIVersion {
+					t.Errorf("expected x-ms-version %s, got %s", azureStackHubBlobAPIVersion, v)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeStorageAccountTags(t *testing.T) {
+	ctx := context.Background()
+	newClient := func(doer *testDoer) *Client {
+		client, err := New(&Options{
+			Environment: autorestazure.Environment{
+				ActiveDirectoryEndpoint: "https://test-active-directory-endpoint",
+				TokenAudience:           "test-token-audience",
+				ResourceManagerEndpoint: "https://test-resource-manager-endpoint",
+			},
+			TenantID:       "test-tenant-id",
+			ClientID:       "test-client-id",
+			ClientSecret:   "test-client-secret",
+			SubscriptionID: "test-subscription-id",
+			Policies: []policy.Policy{
+				doer,
+			},
+			Creds: &azfake.TokenCredential{},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %q", err)
+		}
+		return client
+	}
+
+	t.Run("tags in sync", func(t *testing.T) {
+		doer := &testDoer{body: `{"tags":{"team":"registry","owner":"someone"}}`}
+		changed, err := newClient(doer).MergeStorageAccountTags(ctx, "test-resource-group", "imageregistryabc123", map[string]*string{
+			"team": to.Ptr("registry"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %q", err)
+		}
+		if changed {
+			t.Errorf("expected the account to be left unchanged")
+		}
+		if len(doer.response) != 1 {
+			t.Fatalf("expected 1 request, got %d", len(doer.response))
+		}
+	})
+
+	t.Run("tags out of sync", func(t *testing.T) {
+		doer := &testDoer{body: `{"tags":{"team":"storage","owner":"someone"}}`}
+		changed, err := newClient(doer).MergeStorageAccountTags(ctx, "test-resource-group", "imageregistryabc123", map[string]*string{
+			"team": to.Ptr("registry"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %q", err)
+		}
+		if !changed {
+			t.Errorf("expected the account to be updated")
+		}
+		if len(doer.response) != 2 {
+			t.Fatalf("expected 2 requests, got %d", len(doer.response))
+		}
+		req := doer.response[1].Request
+		if req.Method != http.MethodPatch || !strings.HasSuffix(req.URL.Path, "/storageAccounts/imageregistryabc123") {
+			t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"tags":{"owner":"someone","team":"registry"}}`
+		if string(body) != expected {
+			t.Errorf("expected body %s, got %s", expected, body)
+		}
+	})
+}
+
+func TestParsePrivateDNSZoneID(t *testing.T) {
+	for _, tt := range []struct {
+		id       string
+		expected string
+		err      bool
+	}{
+		{
+			id:       "/subscriptions/sub/resourceGroups/dns-rg/providers/Microsoft.Network/privateDnsZones/privatelink.blob.core.windows.net",
+			expected: "privatelink.blob.core.windows.net",
+		},
+		{
+			id:       "/subscriptions/sub/resourcegroups/dns-rg/providers/microsoft.network/privatednszones/privatelink.blob.core.windows.net",
+			expected: "privatelink.blob.core.windows.net",
+		},
+		{
+			id:  "privatelink.blob.core.windows.net",
+			err: true,
+		},
+		{
+			id:  "/subscriptions/sub/resourceGroups/dns-rg/providers/Microsoft.Network/dnszones/example.com",
+			err: true,
+		},
+		{
+			id:  "/subscriptions/sub/resourceGroups//providers/Microsoft.Network/privateDnsZones/privatelink.blob.core.windows.net",
+			err: true,
+		},
+	} {
+		t.Run(tt.id, func(t *testing.T) {
+			name, err := ParsePrivateDNSZoneID(tt.id)
+			if tt.err != (err != nil) {
+				t.Fatalf("expected error=%t, got %v", tt.err, err)
+			}
+			if name != tt.expected {
+				t.Errorf("expected zone name %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestParsePrivateEndpointID(t *testing.T) {
+	id, err := ParsePrivateEndpointID("/subscriptions/hub/resourceGroups/hub-rg/providers/Microsoft.Network/privateEndpoints/registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PrivateEndpointID{SubscriptionID: "hub", ResourceGroupName: "hub-rg", Name: "registry"}
+	if id != expected {
+		t.Errorf("expected %+v, got %+v", expected, id)
+	}
+
+	for _, invalid := range []string{
+		"registry",
+		"/subscriptions/hub/resourceGroups/hub-rg/providers/Microsoft.Network/privateDnsZones/registry",
+		"/subscriptions//resourceGroups/hub-rg/providers/Microsoft.Network/privateEndpoints/registry",
+	} {
+		if _, err := ParsePrivateEndpointID(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestCheckPrivateEndpointConnection(t *testing.T) {
+	const accountID = "/subscriptions/hub/resourceGroups/storage-rg/providers/Microsoft.Storage/storageAccounts/registry"
+
+	newEndpoint := func(state armnetwork.ProvisioningState, manual bool, accountID, groupID, status string) *armnetwork.PrivateEndpoint {
+		conn := &armnetwork.PrivateLinkServiceConnection{
+			Properties: &armnetwork.PrivateLinkServiceConnectionProperties{
+				PrivateLinkServiceID: to.Ptr(accountID),
+				GroupIDs:             []*string{to.Ptr(groupID)},
+				PrivateLinkServiceConnectionState: &armnetwork.PrivateLinkServiceConnectionState{
+					Status: to.Ptr(status),
+				},
+			},
+		}
+		pe := &armnetwork.PrivateEndpoint{
+			Properties: &armnetwork.PrivateEndpointProperties{
+				ProvisioningState: &state,
+			},
+		}
+		if manual {
+			pe.Properties.ManualPrivateLinkServiceConnections = []*armnetwork.PrivateLinkServiceConnection{conn}
+		} else {
+			pe.Properties.PrivateLinkServiceConnections = []*armnetwork.PrivateLinkServiceConnection{conn}
+		}
+		return pe
+	}
+
+	for _, tt := range []struct {
+		name string
+		pe   *armnetwork.PrivateEndpoint
+		err  string
+	}{
+		{
+			name: "approved",
+			pe:   newEndpoint(armnetwork.ProvisioningStateSucceeded, false, accountID, "blob", "Approved"),
+		},
+		{
+			name: "approved manual connection",
+			pe:   newEndpoint(armnetwork.ProvisioningStateSucceeded, true, accountID, "blob", "Approved"),
+		},
+		{
+			name: "pending",
+			pe:   newEndpoint(armnetwork.ProvisioningStateSucceeded, true, accountID, "blob", "Pending"),
+			err:  `the connection of the private endpoint to the storage account is "Pending", not Approved`,
+		},
+		{
+			name: "not provisioned",
+			pe:   newEndpoint(armnetwork.ProvisioningStateFailed, false, accountID, "blob", "Approved"),
+			err:  "private endpoint is not provisioned",
+		},
+		{
+			name: "another storage account",
+			pe:   newEndpoint(armnetwork.ProvisioningStateSucceeded, false, "/subscriptions/hub/resourceGroups/storage-rg/providers/Microsoft.Storage/storageAccounts/other", "blob", "Approved"),
+			err:  "private endpoint is not connected to the blob service of the storage account registry",
+		},
+		{
+			name: "another service",
+			pe:   newEndpoint(armnetwork.ProvisioningStateSucceeded, false, accountID, "file", "Approved"),
+			err:  "private endpoint is not connected to the blob service of the storage account registry",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPrivateEndpointConnection(tt.pe, "registry")
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
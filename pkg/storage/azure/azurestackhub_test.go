@@ -0,0 +1,367 @@
+package azure
+
+// This file simulates an Azure Stack Hub environment. Real Azure Stack Hub
+// environments are rarely available in CI, so the code paths that are
+// specific to them are exercised against HTTP interactions recorded from an
+// Azure Stack Hub instance. The recordings live in testdata/azurestackhub.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	ashFixturesDir  = "testdata/azurestackhub"
+	ashAccountName  = "imageregistryash"
+	ashContainer    = "registry"
+	ashCloudName    = "AzureStackCloud"
+	ashStorageRealm = "local.azurestack.external"
+
+	// The versions of the APIs that Azure Stack Hub serves, requests with
+	// newer versions are rejected by the stack.
+	ashStorageAPIVersion = "2019-06-01"
+	ashBlobAPIVersion    = "2019-02-02"
+)
+
+// recordedInteraction is an HTTP request to Azure Stack Hub and the response
+// it received.
+type recordedInteraction struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// replayedRequest is a request received by the replayer. APIVersion is the
+// api-version of the requests to Azure Resource Manager, or the x-ms-version
+// of the requests to the blob service.
+type replayedRequest struct {
+	Method     string
+	URL        string
+	APIVersion string
+	Body       []byte
+}
+
+// interactionReplayer answers requests with recorded interactions, in the
+// order they were recorded. It serves both the Azure Resource Manager and the
+// blob clients of the driver.
+type interactionReplayer struct {
+	t            *testing.T
+	interactions []recordedInteraction
+	requests     []replayedRequest
+}
+
+func newInteractionReplayer(t *testing.T, fixture string) *interactionReplayer {
+	data, err := os.ReadFile(filepath.Join(ashFixturesDir, fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &interactionReplayer{t: t}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		t.Fatalf("unable to decode %s: %s", fixture, err)
+	}
+	return r
+}
+
+// Do implements the policy.Policy interface, the request is not sent.
+func (r *interactionReplayer) Do(preq *policy.Request) (*http.Response, error) {
+	req := preq.Raw()
+	var body []byte
+	if preq.Body() != nil {
+		var err error
+		if body, err = io.ReadAll(preq.Body()); err != nil {
+			return nil, err
+		}
+	}
+	apiVersion := req.URL.Query().Get("api-version")
+	if apiVersion == "" {
+		apiVersion = req.Header.Get("x-ms-version")
+	}
+	u := *req.URL
+	u.RawQuery = ""
+	u.Path = "/" + strings.TrimLeft(u.Path, "/")
+	r.requests = append(r.requests, replayedRequest{Method: req.Method, URL: u.String(), APIVersion: apiVersion, Body: body})
+
+	if len(r.requests) > len(r.interactions) {
+		r.t.Fatalf("unexpected request %s %s, all %d recorded interactions have been replayed", req.Method, u.String(), len(r.interactions))
+	}
+	interaction := r.interactions[len(r.requests)-1]
+	if interaction.Method != req.Method || interaction.URL != u.String() {
+		r.t.Fatalf("request %d: expected %s %s, got %s %s", len(r.requests), interaction.Method, interaction.URL, req.Method, u.String())
+	}
+
+	resp := &http.Response{
+		StatusCode: interaction.Status,
+		Status:     http.StatusText(interaction.Status),
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(interaction.Body)),
+		Request:    req,
+	}
+	if len(interaction.Body) > 0 {
+		resp.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range interaction.Headers {
+		resp.Header.Set(k, v)
+	}
+	return resp, nil
+}
+
+// verify fails the test if some recorded interactions were not replayed, or
+// if a request used a version of an API that Azure Stack Hub does not serve.
+func (r *interactionReplayer) verify() {
+	if len(r.requests) != len(r.interactions) {
+		r.t.Errorf("expected %d requests, got %d", len(r.interactions), len(r.requests))
+	}
+	for _, req := range r.requests {
+		expected := ashStorageAPIVersion
+		if strings.Contains(req.URL, ".blob.") {
+			expected = ashBlobAPIVersion
+		}
+		if req.APIVersion != expected {
+			r.t.Errorf("%s %s: expected API version %s, got %q", req.Method, req.URL, expected, req.APIVersion)
+		}
+	}
+}
+
+// newAzureStackHubDriver returns a driver for an Azure Stack Hub cluster whose
+// requests are answered by replayer. The environment file is placed where
+// the AzureStackCloudController puts it.
+func newAzureStackHubDriver(t *testing.T, replayer *interactionReplayer, config *imageregistryv1.ImageRegistryConfigStorageAzure) *driver {
+	endpoints, err := os.ReadFile(filepath.Join(ashFixturesDir, "environment.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	environmentFile := filepath.Join(t.TempDir(), "azurestackcloud.json")
+	if err := os.WriteFile(environmentFile, endpoints, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", environmentFile)
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "ash-cluster",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+					CloudName:         configv1.AzureStackCloud,
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_tenant_id":       []byte(mockTenantID),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+			"azure_region":          []byte("local"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	primaryKey = cachedKey{}
+	drv := NewDriver(context.Background(), config, &listers.StorageListers)
+	drv.policies = []policy.Policy{replayer}
+	return drv
+}
+
+func TestAzureStackHubCreateStorage(t *testing.T) {
+	replayer := newInteractionReplayer(t, "create-storage.json")
+	drv := newAzureStackHubDriver(t, replayer, &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName: ashAccountName,
+		Container:   ashContainer,
+		CloudName:   ashCloudName,
+	})
+
+	cr := &imageregistryv1.Config{}
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatal(err)
+	}
+	replayer.verify()
+
+	// Azure Stack Hub only supports the legacy storage account kind, and
+	// none of the properties that are set on Azure.
+	var account struct {
+		Kind       string                 `json:"kind"`
+		Location   string                 `json:"location"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(replayer.requests[1].Body, &account); err != nil {
+		t.Fatalf("unable to decode the storage account creation request: %s", err)
+	}
+	if account.Kind != "Storage" {
+		t.Errorf("expected storage account kind Storage, got %q", account.Kind)
+	}
+	if account.Location != "local" {
+		t.Errorf("expected storage account location local, got %q", account.Location)
+	}
+	if len(account.Properties) != 0 {
+		t.Errorf("expected no storage account properties, got %v", account.Properties)
+	}
+
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		t.Errorf("expected storage to be managed, got %q", cr.Spec.Storage.ManagementState)
+	}
+	if cr.Status.Storage.Azure == nil || cr.Status.Storage.Azure.Container != ashContainer {
+		t.Errorf("expected container %q in status, got %#v", ashContainer, cr.Status.Storage.Azure)
+	}
+	if cond := util.FetchCondition(cr, defaults.StorageExists); cond.Status != operatorapiv1.ConditionTrue {
+		t.Errorf("expected StorageExists to be true, got %#v", cond)
+	}
+}
+
+func TestAzureStackHubStorageExists(t *testing.T) {
+	replayer := newInteractionReplayer(t, "storage-exists.json")
+	drv := newAzureStackHubDriver(t, replayer, &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName: ashAccountName,
+		Container:   ashContainer,
+		CloudName:   ashCloudName,
+	})
+
+	cr := &imageregistryv1.Config{}
+	exists, err := drv.StorageExists(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.verify()
+	if !exists {
+		t.Errorf("expected the container to exist")
+	}
+}
+
+func TestAzureStackHubConfigEnv(t *testing.T) {
+	replayer := newInteractionReplayer(t, "storage-exists.json")
+	replayer.interactions = replayer.interactions[:1]
+	drv := newAzureStackHubDriver(t, replayer, &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName: ashAccountName,
+		Container:   ashContainer,
+		CloudName:   ashCloudName,
+	})
+
+	envs, err := drv.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.verify()
+
+	actual := map[string]string{}
+	for _, env := range envs {
+		actual[env.Name] = fmt.Sprint(env.Value)
+	}
+
+	expected := map[string]string{
+		"REGISTRY_STORAGE":                   "azure",
+		"REGISTRY_STORAGE_AZURE_ACCOUNTNAME": ashAccountName,
+		"REGISTRY_STORAGE_AZURE_CONTAINER":   ashContainer,
+		"REGISTRY_STORAGE_AZURE_ACCOUNTKEY":  "Zmlyc3RLZXk=",
+		// the registry reaches the blob endpoints of the stack, not the
+		// ones of the public cloud.
+		"REGISTRY_STORAGE_AZURE_REALM": ashStorageRealm,
+	}
+	for name, value := range expected {
+		if v, ok := actual[name]; !ok {
+			t.Errorf("expected %s to be set", name)
+		} else if v != value {
+			t.Errorf("expected %s=%q, got %q", name, value, v)
+		}
+	}
+	for _, name := range []string{"AZURE_FEDERATED_TOKEN_FILE", "AZURE_AUTHORITY_HOST"} {
+		if _, ok := actual[name]; ok {
+			t.Errorf("expected %s not to be set", name)
+		}
+	}
+}
+
+func TestAzureStackHubRemoveStorage(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		fixture     string
+		condition   string
+		keepAccount bool
+	}{
+		{
+			name:      "container and account are deleted",
+			fixture:   "remove-storage.json",
+			condition: storageExistsReasonAccountDeleted,
+		},
+		{
+			name:      "account is already gone",
+			fixture:   "remove-storage-account-gone.json",
+			condition: storageExistsReasonAccountNotFound,
+		},
+		{
+			name:        "account is not managed by the operator",
+			fixture:     "remove-storage-not-managed.json",
+			condition:   storageExistsReasonNotManaged,
+			keepAccount: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			replayer := newInteractionReplayer(t, tt.fixture)
+			config := &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName: ashAccountName,
+				Container:   ashContainer,
+				CloudName:   ashCloudName,
+			}
+			drv := newAzureStackHubDriver(t, replayer, config)
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						Azure:           config.DeepCopy(),
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Azure: config.DeepCopy(),
+					},
+				},
+			}
+			if _, err := drv.RemoveStorage(cr); err != nil {
+				t.Fatal(err)
+			}
+			replayer.verify()
+
+			if tt.keepAccount && cr.Status.Storage.Azure.AccountName != ashAccountName {
+				t.Errorf("expected the account name to be kept, got %q", cr.Status.Storage.Azure.AccountName)
+			} else if !tt.keepAccount && cr.Status.Storage.Azure.AccountName != "" {
+				t.Errorf("expected the account name to be cleared, got %q", cr.Status.Storage.Azure.AccountName)
+			}
+			if cond := util.FetchCondition(cr, defaults.StorageExists); cond.Reason != tt.condition {
+				t.Errorf("expected StorageExists reason %q, got %#v", tt.condition, cond)
+			}
+		})
+	}
+}
@@ -5,9 +5,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
-
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
 )
 
 // cacheExpiration is the cache expiration duration in minutes.
@@ -26,9 +25,9 @@ type cachedKey struct {
 }
 
 // get returns the cached key if it is not expired yet, if expired fetches the key
-// remotely using provided AccountsClient.
+// remotely using provided Client.
 func (k *cachedKey) get(
-	ctx context.Context, cli storage.AccountsClient, resourceGroup, account string,
+	ctx context.Context, cli *azureclient.Client, resourceGroup, account string,
 ) (string, error) {
 	k.mtx.Lock()
 	defer k.mtx.Unlock()
@@ -39,14 +38,14 @@ func (k *cachedKey) get(
 	}
 	metrics.AzureKeyCacheMiss()
 
-	keysResponse, err := cli.ListKeys(ctx, resourceGroup, account, storage.Kerb)
+	key, err := cli.StorageAccountKey(ctx, resourceGroup, account)
 	if err != nil {
 		return "", err
 	}
 
 	k.resourceGroup = resourceGroup
 	k.account = account
-	k.value = *(*keysResponse.Keys)[0].Value
+	k.value = key
 	k.expire = time.Now().Add(cacheExpiration)
 	return k.value, nil
 }
@@ -2,12 +2,14 @@ package azure
 
 import (
 	"context"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
-	"github.com/Azure/go-autorest/autorest/mocks"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 )
 
 func Test_cachedKey_get(t *testing.T) {
@@ -23,13 +25,13 @@ func Test_cachedKey_get(t *testing.T) {
 		{
 			name: "empty resource group name",
 			key:  &cachedKey{},
-			err:  "parameter=resourceGroupName constraint=MinLength",
+			err:  "parameter resourceGroupName cannot be empty",
 		},
 		{
 			name:          "empty account name",
 			key:           &cachedKey{},
 			resourceGroup: "resource_group",
-			err:           "parameter=accountName constraint=MinLength",
+			err:           "parameter accountName cannot be empty",
 		},
 		{
 			name:          "cache miss",
@@ -93,12 +95,20 @@ func Test_cachedKey_get(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			cli := storage.NewAccountsClient("subscription_id")
-			sender := mocks.NewSender()
-			for _, resp := range tt.responses {
-				sender.AppendResponse(mocks.NewResponseWithContent(resp))
+			fake := &fakeAzure{}
+			for _, body := range tt.responses {
+				fake.responses = append(fake.responses, fakeResponse{method: http.MethodPost, path: "/listKeys$", status: http.StatusOK, body: body})
+			}
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{}, nil)
+			drv.policies = []policy.Policy{fake}
+			environment, err := getEnvironmentByName("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cli, err := drv.newAzClient(testAzure(), environment, nil)
+			if err != nil {
+				t.Fatal(err)
 			}
-			cli.Sender = sender
 
 			key, err := tt.key.get(
 				context.Background(),
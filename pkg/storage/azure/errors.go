@@ -0,0 +1,41 @@
+package azure
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// classifyError returns err as a util.StorageError when its kind is known.
+func classifyError(err error) error {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return util.ClassifyError(err, respErr.StatusCode)
+	}
+	return util.ClassifyError(err, 0)
+}
+
+// isNotFound returns true if err is the answer of Azure to a request for a
+// resource that does not exist.
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// recordOperation records an operation on resource in the storage audit
+// trail. The ID Azure gave to the request is taken from resp, or from the
+// response in err when the request failed.
+func recordOperation(operation, resource string, resp *http.Response, err error) {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		resp = respErr.RawResponse
+	}
+	requestID := ""
+	if resp != nil {
+		requestID = resp.Header.Get("x-ms-request-id")
+	}
+	util.RecordStorageOperation(operation, resource, requestID, err)
+}
@@ -0,0 +1,89 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// sasTokenKey is the key of the SAS token in the secret with the
+	// credentials provided by the user.
+	sasTokenKey = "REGISTRY_STORAGE_AZURE_SAS_TOKEN"
+
+	// sasTokenRequiredPermissions are the permissions the operator needs
+	// to manage the container: read, write, delete and list.
+	sasTokenRequiredPermissions = "rwdl"
+
+	// sasTokenExpiryWarning is how long before its expiry a SAS token is
+	// reported as expiring.
+	sasTokenExpiryWarning = 7 * 24 * time.Hour
+)
+
+// validateSASToken checks that the SAS token grants the permissions the
+// operator needs and has not expired, and returns its expiry. A token that
+// refers to a stored access policy has its permissions and its expiry in
+// the policy, they are not known and the zero time is returned.
+func validateSASToken(token string, now time.Time) (time.Time, error) {
+	values, err := url.ParseQuery(strings.TrimPrefix(token, "?"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse the SAS token: %w", err)
+	}
+	params := sas.NewQueryParameters(values, false)
+	if params.Signature() == "" {
+		return time.Time{}, fmt.Errorf("the SAS token has no signature")
+	}
+	if params.Identifier() != "" && params.ExpiryTime().IsZero() {
+		return time.Time{}, nil
+	}
+
+	var missing []string
+	for _, p := range sasTokenRequiredPermissions {
+		if !strings.ContainsRune(params.Permissions(), p) {
+			missing = append(missing, string(p))
+		}
+	}
+	if len(missing) > 0 {
+		return time.Time{}, fmt.Errorf("the SAS token lacks the permissions %s, the operator needs %s", strings.Join(missing, ""), sasTokenRequiredPermissions)
+	}
+
+	expiry := params.ExpiryTime()
+	if expiry.IsZero() {
+		return time.Time{}, fmt.Errorf("the SAS token has no expiry")
+	}
+	if !expiry.After(now) {
+		return time.Time{}, fmt.Errorf("the SAS token expired at %s", expiry.UTC().Format(time.RFC3339))
+	}
+	return expiry, nil
+}
+
+// checkSASToken validates the SAS token and reports when it expires with
+// the StorageSASTokenExpiring condition. A token that can not be used is
+// an invalid configuration.
+func checkSASToken(cr *imageregistryv1.Config, token string, now time.Time) error {
+	expiry, err := validateSASToken(token, now)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageSASTokenExpiring, operatorapiv1.ConditionTrue, "SASTokenInvalid", err.Error())
+		return util.NewStorageError(util.ErrorKindInvalidConfig, err)
+	}
+
+	secretName := fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser)
+	switch {
+	case expiry.IsZero():
+		util.UpdateCondition(cr, defaults.StorageSASTokenExpiring, operatorapiv1.ConditionUnknown, "StoredAccessPolicy", "The SAS token uses a stored access policy, its expiry is not known")
+	case expiry.Sub(now) < sasTokenExpiryWarning:
+		util.UpdateCondition(cr, defaults.StorageSASTokenExpiring, operatorapiv1.ConditionTrue, "SASTokenExpiringSoon", fmt.Sprintf("The SAS token expires at %s, replace it in the secret %s", expiry.UTC().Format(time.RFC3339), secretName))
+	default:
+		util.UpdateCondition(cr, defaults.StorageSASTokenExpiring, operatorapiv1.ConditionFalse, "SASTokenValid", fmt.Sprintf("The SAS token expires at %s", expiry.UTC().Format(time.RFC3339)))
+	}
+	return nil
+}
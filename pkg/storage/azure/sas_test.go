@@ -0,0 +1,103 @@
+package azure
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func testSASToken(permissions string, expiry time.Time, identifier string) string {
+	values := url.Values{}
+	values.Set("sv", "2021-08-06")
+	values.Set("sr", "c")
+	values.Set("sig", "c2lnbmF0dXJl")
+	if permissions != "" {
+		values.Set("sp", permissions)
+	}
+	if !expiry.IsZero() {
+		values.Set("se", expiry.UTC().Format(time.RFC3339))
+	}
+	if identifier != "" {
+		values.Set("si", identifier)
+	}
+	return values.Encode()
+}
+
+func TestCheckSASToken(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name   string
+		token  string
+		status operatorapiv1.ConditionStatus
+		reason string
+		err    bool
+	}{
+		{
+			name:   "valid token",
+			token:  testSASToken("racwdl", now.Add(30*24*time.Hour), ""),
+			status: operatorapiv1.ConditionFalse,
+			reason: "SASTokenValid",
+		},
+		{
+			name:   "token expiring soon",
+			token:  "?" + testSASToken("rwdl", now.Add(2*24*time.Hour), ""),
+			status: operatorapiv1.ConditionTrue,
+			reason: "SASTokenExpiringSoon",
+		},
+		{
+			name:   "stored access policy",
+			token:  testSASToken("", time.Time{}, "registry"),
+			status: operatorapiv1.ConditionUnknown,
+			reason: "StoredAccessPolicy",
+		},
+		{
+			name:   "missing permissions",
+			token:  testSASToken("rl", now.Add(30*24*time.Hour), ""),
+			status: operatorapiv1.ConditionTrue,
+			reason: "SASTokenInvalid",
+			err:    true,
+		},
+		{
+			name:   "expired token",
+			token:  testSASToken("rwdl", now.Add(-time.Hour), ""),
+			status: operatorapiv1.ConditionTrue,
+			reason: "SASTokenInvalid",
+			err:    true,
+		},
+		{
+			name:   "token without expiry",
+			token:  testSASToken("rwdl", time.Time{}, ""),
+			status: operatorapiv1.ConditionTrue,
+			reason: "SASTokenInvalid",
+			err:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			err := checkSASToken(cr, tt.token, now)
+			if tt.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+
+			var found bool
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageSASTokenExpiring {
+					continue
+				}
+				found = true
+				if cond.Status != tt.status || cond.Reason != tt.reason {
+					t.Errorf("expected %s/%s, got %s/%s: %s", tt.status, tt.reason, cond.Status, cond.Reason, cond.Message)
+				}
+			}
+			if !found {
+				t.Errorf("condition %s not found", defaults.StorageSASTokenExpiring)
+			}
+		})
+	}
+}
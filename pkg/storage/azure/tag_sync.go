@@ -0,0 +1,39 @@
+package azure
+
+import (
+	"sync"
+	"time"
+)
+
+// tagSyncs remembers when the tags of the storage account were last synced.
+var tagSyncs tagSyncSchedule
+
+// tagSyncSchedule holds in memory the time of the last synchronization of the
+// tags of a storage account. It is lost when the operator restarts, which
+// only causes an early synchronization.
+type tagSyncSchedule struct {
+	mtx     sync.Mutex
+	account string
+	last    time.Time
+}
+
+// due returns true if the tags of the account were not synced during the
+// last interval.
+func (s *tagSyncSchedule) due(account string, interval time.Duration) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.account != account {
+		return true
+	}
+	return time.Since(s.last) >= interval
+}
+
+// done records that the tags of the account have just been synced.
+func (s *tagSyncSchedule) done(account string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.account = account
+	s.last = time.Now()
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	kcorelisters "k8s.io/client-go/listers/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// BootstrapMode controls what the operator does with the storage it finds
+// when the registry config is bootstrapped.
+type BootstrapMode string
+
+const (
+	// BootstrapModeProvision configures the registry with the storage
+	// that was found, provisioning it if needed.
+	BootstrapModeProvision BootstrapMode = "Provision"
+	// BootstrapModePropose leaves the registry Removed and describes the
+	// storage that was found in the StorageBootstrapped condition.
+	BootstrapModePropose BootstrapMode = "Propose"
+	// BootstrapModeDisabled leaves the registry Removed without looking for
+	// storage.
+	BootstrapModeDisabled BootstrapMode = "Disabled"
+)
+
+// BootstrapSource is the kind of storage a bootstrap decision is based on.
+type BootstrapSource string
+
+const (
+	BootstrapSourceODFObjectStorage BootstrapSource = "ODFObjectStorage"
+	BootstrapSourceRWXStorageClass  BootstrapSource = "RWXStorageClass"
+	BootstrapSourceNone             BootstrapSource = "NoSuitableStorage"
+	BootstrapSourceDisabled         BootstrapSource = "Disabled"
+)
+
+const (
+	// odfObjectBucketProvisioner provisions object bucket claims backed by
+	// the Multicloud Object Gateway of OpenShift Data Foundation.
+	odfObjectBucketProvisioner = "openshift-storage.noobaa.io/obc"
+	// odfS3Endpoint is the in-cluster S3 endpoint of the Multicloud Object
+	// Gateway.
+	odfS3Endpoint = "https://s3.openshift-storage.svc"
+
+	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+)
+
+// rwxProvisioners are the provisioners that are known to always provide
+// ReadWriteMany volumes. The vSphere CSI driver is not one of them, it only
+// does with vSAN file services.
+var rwxProvisioners = map[string]bool{
+	"openshift-storage.cephfs.csi.ceph.com": true,
+	"nfs.csi.k8s.io":                        true,
+}
+
+// BootstrapDecision is the storage the registry is bootstrapped with.
+type BootstrapDecision struct {
+	Source BootstrapSource
+	// Storage is empty unless the storage can be provisioned.
+	Storage imageregistryv1.ImageRegistryConfigStorage
+	// StorageClassName is the class of the claim to provision for the PVC
+	// storage.
+	StorageClassName string
+	Message          string
+}
+
+// Provisioned returns true if the registry is bootstrapped with storage.
+func (d BootstrapDecision) Provisioned() bool {
+	return d.Storage != imageregistryv1.ImageRegistryConfigStorage{}
+}
+
+// GetBootstrapMode returns the bootstrap mode set in the
+// StorageBootstrapConfigMapName config map, Provision by default.
+func GetBootstrapMode(openshiftConfig kcorelisters.ConfigMapNamespaceLister) (BootstrapMode, error) {
+	cm, err := openshiftConfig.Get(defaults.StorageBootstrapConfigMapName)
+	if errors.IsNotFound(err) {
+		return BootstrapModeProvision, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	switch mode := BootstrapMode(cm.Data[defaults.StorageBootstrapModeKey]); mode {
+	case "":
+		return BootstrapModeProvision, nil
+	case BootstrapModeProvision, BootstrapModePropose, BootstrapModeDisabled:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid storage bootstrap mode %q in config map %s/%s", mode, defaults.OpenShiftConfigNamespace, defaults.StorageBootstrapConfigMapName)
+	}
+}
+
+// DecideBootstrapStorage chooses the storage for a platform without a default
+// storage backend. The following precedence applies:
+//
+//  1. OpenShift Data Foundation object storage. It is only proposed: using it
+//     requires an object bucket claim and its credentials in the user
+//     provided secret.
+//  2. A storage class with a provisioner known to provide ReadWriteMany
+//     volumes, the default class if it is one of them.
+//  3. No storage, the registry stays Removed.
+func DecideBootstrapStorage(classes []*storagev1.StorageClass, mode BootstrapMode) BootstrapDecision {
+	if mode == BootstrapModeDisabled {
+		return BootstrapDecision{
+			Source:  BootstrapSourceDisabled,
+			Message: fmt.Sprintf("Storage bootstrap is disabled by the config map %s/%s", defaults.OpenShiftConfigNamespace, defaults.StorageBootstrapConfigMapName),
+		}
+	}
+
+	sorted := make([]*storagev1.StorageClass, len(classes))
+	copy(sorted, classes)
+	sort.Slice(sorted, func(i, j int) bool {
+		iDefault := sorted[i].Annotations[defaultStorageClassAnnotation] == "true"
+		jDefault := sorted[j].Annotations[defaultStorageClassAnnotation] == "true"
+		if iDefault != jDefault {
+			return iDefault
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	for _, sc := range sorted {
+		if sc.Provisioner == odfObjectBucketProvisioner {
+			return BootstrapDecision{
+				Source:  BootstrapSourceODFObjectStorage,
+				Message: fmt.Sprintf("OpenShift Data Foundation object storage is available: create an object bucket claim with the storage class %s, add its credentials to the secret %s/%s and configure spec.storage.s3 with the region endpoint %s", sc.Name, defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser, odfS3Endpoint),
+			}
+		}
+	}
+
+	for _, sc := range sorted {
+		if !rwxProvisioners[sc.Provisioner] {
+			continue
+		}
+		d := BootstrapDecision{
+			Source:           BootstrapSourceRWXStorageClass,
+			StorageClassName: sc.Name,
+		}
+		if mode == BootstrapModePropose {
+			d.Message = fmt.Sprintf("The storage class %s provides ReadWriteMany volumes: configure spec.storage.pvc with a claim of this class", sc.Name)
+			return d
+		}
+		d.Storage.PVC = &imageregistryv1.ImageRegistryConfigStoragePVC{
+			Claim: defaults.PVCImageRegistryName,
+		}
+		d.Message = fmt.Sprintf("The registry uses a ReadWriteMany claim of the storage class %s", sc.Name)
+		return d
+	}
+
+	return BootstrapDecision{
+		Source:  BootstrapSourceNone,
+		Message: "No object storage nor storage class providing ReadWriteMany volumes was found, configure the registry storage manually",
+	}
+}
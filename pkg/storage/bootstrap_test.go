@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func storageClass(name, provisioner string, isDefault bool) *storagev1.StorageClass {
+	sc := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Provisioner: provisioner,
+	}
+	if isDefault {
+		sc.Annotations = map[string]string{defaultStorageClassAnnotation: "true"}
+	}
+	return sc
+}
+
+func TestDecideBootstrapStorage(t *testing.T) {
+	thin := storageClass("thin-csi", "csi.vsphere.vmware.com", true)
+	cephfs := storageClass("ocs-storagecluster-cephfs", "openshift-storage.cephfs.csi.ceph.com", false)
+	nfs := storageClass("nfs", "nfs.csi.k8s.io", true)
+	noobaa := storageClass("openshift-storage.noobaa.io", "openshift-storage.noobaa.io/obc", false)
+
+	for _, tt := range []struct {
+		name         string
+		classes      []*storagev1.StorageClass
+		mode         BootstrapMode
+		source       BootstrapSource
+		storageClass string
+		provisioned  bool
+	}{
+		{
+			name:    "no suitable storage",
+			classes: []*storagev1.StorageClass{thin},
+			mode:    BootstrapModeProvision,
+			source:  BootstrapSourceNone,
+		},
+		{
+			name:    "object storage takes precedence",
+			classes: []*storagev1.StorageClass{thin, cephfs, noobaa},
+			mode:    BootstrapModeProvision,
+			source:  BootstrapSourceODFObjectStorage,
+		},
+		{
+			name:         "rwx storage class",
+			classes:      []*storagev1.StorageClass{thin, cephfs},
+			mode:         BootstrapModeProvision,
+			source:       BootstrapSourceRWXStorageClass,
+			storageClass: "ocs-storagecluster-cephfs",
+			provisioned:  true,
+		},
+		{
+			name:         "default rwx storage class",
+			classes:      []*storagev1.StorageClass{cephfs, nfs},
+			mode:         BootstrapModeProvision,
+			source:       BootstrapSourceRWXStorageClass,
+			storageClass: "nfs",
+			provisioned:  true,
+		},
+		{
+			name:         "proposed rwx storage class",
+			classes:      []*storagev1.StorageClass{thin, cephfs},
+			mode:         BootstrapModePropose,
+			source:       BootstrapSourceRWXStorageClass,
+			storageClass: "ocs-storagecluster-cephfs",
+		},
+		{
+			name:    "disabled",
+			classes: []*storagev1.StorageClass{cephfs},
+			mode:    BootstrapModeDisabled,
+			source:  BootstrapSourceDisabled,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DecideBootstrapStorage(tt.classes, tt.mode)
+			if d.Source != tt.source {
+				t.Errorf("expected source %s, got %s", tt.source, d.Source)
+			}
+			if d.StorageClassName != tt.storageClass {
+				t.Errorf("expected storage class %q, got %q", tt.storageClass, d.StorageClassName)
+			}
+			if d.Provisioned() != tt.provisioned {
+				t.Errorf("expected provisioned %t, got %t", tt.provisioned, d.Provisioned())
+			}
+			if d.Message == "" {
+				t.Error("expected a message describing the decision")
+			}
+		})
+	}
+}
+
+func TestGetBootstrapMode(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     map[string]string
+		expected BootstrapMode
+		err      bool
+	}{
+		{
+			name:     "no config map",
+			expected: BootstrapModeProvision,
+		},
+		{
+			name:     "empty mode",
+			data:     map[string]string{},
+			expected: BootstrapModeProvision,
+		},
+		{
+			name:     "disabled",
+			data:     map[string]string{defaults.StorageBootstrapModeKey: "Disabled"},
+			expected: BootstrapModeDisabled,
+		},
+		{
+			name: "invalid mode",
+			data: map[string]string{defaults.StorageBootstrapModeKey: "Always"},
+			err:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.data != nil {
+				if err := indexer.Add(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: defaults.OpenShiftConfigNamespace,
+						Name:      defaults.StorageBootstrapConfigMapName,
+					},
+					Data: tt.data,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mode, err := GetBootstrapMode(corelisters.NewConfigMapLister(indexer).ConfigMaps(defaults.OpenShiftConfigNamespace))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got mode %s", mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode != tt.expected {
+				t.Errorf("expected mode %s, got %s", tt.expected, mode)
+			}
+		})
+	}
+}
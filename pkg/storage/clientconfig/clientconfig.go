@@ -0,0 +1,58 @@
+// Package clientconfig configures the clients of the cloud storage SDKs. It
+// is shared by the storage drivers of the operator and by move-blobs, so it
+// must not depend on Kubernetes.
+package clientconfig
+
+import (
+	"context"
+
+	gstorage "cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	goauth2 "golang.org/x/oauth2/google"
+	goption "google.golang.org/api/option"
+)
+
+// S3 describes how the S3 clients reach a bucket.
+type S3 struct {
+	Region string
+	// RegionEndpoint is a custom endpoint of the S3 API, the clients use
+	// path-style requests with custom endpoints unless VirtualHostedStyle
+	// is set.
+	RegionEndpoint     string
+	VirtualHostedStyle bool
+	// CredentialsFile is an AWS shared credentials file, which may
+	// configure a web identity. The default shared configuration files are
+	// used if it is empty.
+	CredentialsFile string
+}
+
+// SessionOptions returns the options of the sessions of the S3 clients of
+// move-blobs, which uses aws-sdk-go v1. The endpoint itself is not set, the
+// callers resolve it.
+func (c S3) SessionOptions() session.Options {
+	options := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if len(c.Region) > 0 {
+		options.Config.Region = aws.String(c.Region)
+	}
+	if len(c.RegionEndpoint) > 0 && !c.VirtualHostedStyle {
+		options.Config.S3ForcePathStyle = aws.Bool(true)
+	}
+	if len(c.CredentialsFile) > 0 {
+		options.SharedConfigFiles = []string{c.CredentialsFile}
+	}
+	return options
+}
+
+// GCSCredentials returns the client option that authenticates the GCS
+// clients with keyfileData, the content of a service account key file or of
+// a workload identity federation configuration.
+func GCSCredentials(ctx context.Context, keyfileData []byte) (goption.ClientOption, error) {
+	credentials, err := goauth2.CredentialsFromJSON(ctx, keyfileData, gstorage.ScopeFullControl)
+	if err != nil {
+		return nil, err
+	}
+	return goption.WithCredentials(credentials), nil
+}
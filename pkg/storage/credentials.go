@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// TokenFileDriver is implemented by drivers that can authenticate against
+// the cloud provider with a projected service account token, for example
+// with AWS STS or workload identity federation.
+type TokenFileDriver interface {
+	// TokenFile returns the path to the token file, or an empty string if
+	// the driver uses long-lived credentials.
+	TokenFile() (string, error)
+}
+
+// CredentialsPathDriver is implemented by drivers that can migrate from user
+// provided keys to cluster minted credentials, see util.CredentialsSecret.
+type CredentialsPathDriver interface {
+	// CredentialsPath returns the credentials the registry is configured
+	// with.
+	CredentialsPath() (util.CredentialsPath, error)
+}
+
+// Name returns the name of the storage configured in cfg, as it is reported
+// in metrics.
+func Name(cfg *imageregistryv1.ImageRegistryConfigStorage) string {
+	return util.DriverName(cfg)
+}
+
+// ReportCredentials reports the freshness of the token that drv uses to
+// authenticate against the cloud provider and updates the
+// StorageCredentialsValid condition. Nothing is reported for drivers that do
+// not use a token file.
+func ReportCredentials(cr *imageregistryv1.Config, drv Driver) {
+	reportCredentialsPath(cr, drv)
+
+	tokenDriver, ok := drv.(TokenFileDriver)
+	if !ok {
+		return
+	}
+	path, err := tokenDriver.TokenFile()
+	if err != nil {
+		klog.V(4).Infof("unable to get the storage token file: %s", err)
+		return
+	}
+	if path == "" {
+		return
+	}
+
+	age, expiry, err := tokenFileStatus(path, time.Now())
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageCredentialsValid, operatorapiv1.ConditionFalse, "TokenUnreadable", err.Error())
+		return
+	}
+
+	metrics.ReportStorageToken(Name(&cr.Spec.Storage), age, expiry)
+
+	if !expiry.IsZero() && !expiry.After(time.Now()) {
+		util.UpdateCondition(cr, defaults.StorageCredentialsValid, operatorapiv1.ConditionFalse, "TokenExpired", fmt.Sprintf("The token in %s expired at %s, it was last refreshed %s ago", path, expiry.UTC().Format(time.RFC3339), age.Round(time.Second)))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageCredentialsValid, operatorapiv1.ConditionTrue, "TokenValid", fmt.Sprintf("The token in %s was last refreshed %s ago", path, age.Round(time.Second)))
+}
+
+// reportCredentialsPath updates the StorageCredentialsFallback condition
+// while a credentials migration window is configured.
+func reportCredentialsPath(cr *imageregistryv1.Config, drv Driver) {
+	pathDriver, ok := drv.(CredentialsPathDriver)
+	if !ok {
+		return
+	}
+	path, err := pathDriver.CredentialsPath()
+	if err != nil {
+		klog.V(4).Infof("unable to get the storage credentials path: %s", err)
+		return
+	}
+	if path.MigrationUntil.IsZero() {
+		return
+	}
+
+	until := path.MigrationUntil.UTC().Format(time.RFC3339)
+	if path.Fallback() {
+		util.UpdateCondition(cr, defaults.StorageCredentialsFallback, operatorapiv1.ConditionTrue, "UsingFallbackCredentials", fmt.Sprintf("The cluster credentials in %s are not usable, the registry uses the credentials in %s until %s", defaults.CloudCredentialsName, defaults.ImageRegistryPrivateConfigurationUser, until))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageCredentialsFallback, operatorapiv1.ConditionFalse, "UsingClusterCredentials", fmt.Sprintf("The registry uses the cluster credentials in %s, the credentials in %s are a fallback until %s", defaults.CloudCredentialsName, defaults.ImageRegistryPrivateConfigurationUser, until))
+}
+
+// tokenFileStatus returns the time since the token file was last written and
+// the expiration time of the token. The expiration time is zero if the token
+// is not a JWT with an exp claim.
+func tokenFileStatus(path string, now time.Time) (time.Duration, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("unable to read the token file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("unable to read the token file: %w", err)
+	}
+	return now.Sub(info.ModTime()), tokenExpiry(strings.TrimSpace(string(data))), nil
+}
+
+// tokenExpiry returns the exp claim of a JWT without verifying it.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// ReportAuthSucceeded records that the operator has successfully talked to
+// the cloud provider of the storage configured in cr.
+func ReportAuthSucceeded(cr *imageregistryv1.Config) {
+	switch name := Name(&cr.Spec.Storage); name {
+	case "", "EmptyDir", "PVC":
+		// not backed by a cloud provider.
+	default:
+		metrics.StorageAuthSucceeded(name)
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type tokenFileDriver struct {
+	Driver
+	path string
+}
+
+func (d *tokenFileDriver) TokenFile() (string, error) {
+	return d.path, nil
+}
+
+func testToken(exp time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"system:serviceaccount:openshift-image-registry:registry","exp":%d}`, exp.Unix())))
+	return header + "." + payload + ".signature"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Unix(1700000000, 0)
+	if got := tokenExpiry(testToken(exp)); !got.Equal(exp) {
+		t.Errorf("expected expiry %s, got %s", exp, got)
+	}
+	if got := tokenExpiry("not-a-jwt"); !got.IsZero() {
+		t.Errorf("expected zero expiry for an opaque token, got %s", got)
+	}
+}
+
+func TestReportCredentials(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		name     string
+		token    string
+		noFile   bool
+		status   operatorapiv1.ConditionStatus
+		reason   string
+		noReport bool
+	}{
+		{
+			name:   "valid token",
+			token:  testToken(time.Now().Add(time.Hour)),
+			status: operatorapiv1.ConditionTrue,
+			reason: "TokenValid",
+		},
+		{
+			name:   "opaque token",
+			token:  "opaque",
+			status: operatorapiv1.ConditionTrue,
+			reason: "TokenValid",
+		},
+		{
+			name:   "expired token",
+			token:  testToken(time.Now().Add(-time.Minute)),
+			status: operatorapiv1.ConditionFalse,
+			reason: "TokenExpired",
+		},
+		{
+			name:   "missing token file",
+			noFile: true,
+			status: operatorapiv1.ConditionFalse,
+			reason: "TokenUnreadable",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "token")
+			os.Remove(path)
+			if !tt.noFile {
+				if err := os.WriteFile(path, []byte(tt.token), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cr := &imageregistryv1.Config{}
+			ReportCredentials(cr, &tokenFileDriver{path: path})
+
+			cond := util.FetchCondition(cr, defaults.StorageCredentialsValid)
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("expected %s/%s, got %s/%s: %s", tt.status, tt.reason, cond.Status, cond.Reason, cond.Message)
+			}
+		})
+	}
+
+	t.Run("driver without token file", func(t *testing.T) {
+		cr := &imageregistryv1.Config{}
+		ReportCredentials(cr, emptydir.NewDriver(&imageregistryv1.ImageRegistryConfigStorageEmptyDir{}))
+		if len(cr.Status.Conditions) != 0 {
+			t.Errorf("expected no conditions, got %v", cr.Status.Conditions)
+		}
+	})
+}
@@ -96,3 +96,9 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 func (d *driver) ID() string {
 	return ""
 }
+
+// Capabilities returns the capabilities of EmptyDir storage. Each replica
+// has its own ephemeral storage.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{}
+}
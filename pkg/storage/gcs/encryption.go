@@ -0,0 +1,173 @@
+package gcs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gstorage "cloud.google.com/go/storage"
+	gapi "google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// encryptionCheckInterval is how often the default KMS key of a managed
+	// bucket is checked for out-of-band changes.
+	encryptionCheckInterval = time.Hour
+
+	// encryptionReasonRestored is the reason of the StorageEncrypted
+	// condition when the default KMS key was changed out-of-band and the
+	// operator restored it.
+	encryptionReasonRestored = "Restored After Change"
+)
+
+// encryptionChecks remembers when the default KMS key of the bucket was last
+// checked.
+var encryptionChecks encryptionCheckSchedule
+
+// encryptionCheckSchedule holds in memory the time of the last check of the
+// default KMS key of a bucket. It is lost when the operator restarts, which
+// only causes an early check.
+type encryptionCheckSchedule struct {
+	mtx    sync.Mutex
+	bucket string
+	last   time.Time
+}
+
+// due returns true if the default KMS key of the bucket was not checked during
+// the last interval.
+func (s *encryptionCheckSchedule) due(bucket string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.bucket != bucket {
+		return true
+	}
+	return time.Since(s.last) >= encryptionCheckInterval
+}
+
+// done records that the default KMS key of the bucket has just been checked.
+func (s *encryptionCheckSchedule) done(bucket string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.bucket = bucket
+	s.last = time.Now()
+}
+
+// kmsKeyMessage returns the message of the StorageEncrypted condition once the
+// default KMS key of the bucket is keyID.
+func kmsKeyMessage(keyID string) string {
+	return fmt.Sprintf("KMS encryption with the key %s is enabled on the GCS bucket", keyID)
+}
+
+// reportsKMSKey returns true if the StorageEncrypted condition reports keyID
+// as the default KMS key of the bucket.
+func reportsKMSKey(cr *imageregistryv1.Config, keyID string) bool {
+	cond := util.FetchCondition(cr, defaults.StorageEncrypted)
+	return cond.Status == operatorapi.ConditionTrue && strings.HasPrefix(cond.Message, kmsKeyMessage(keyID))
+}
+
+// googleManagedMessage is the message of the StorageEncrypted condition once
+// the default KMS key set by the operator has been removed from the bucket.
+const googleManagedMessage = "The default KMS key was removed from the GCS bucket, objects are encrypted with Google-managed keys"
+
+// setsKMSKey returns true if the StorageEncrypted condition reports a default
+// KMS key set by the operator.
+func setsKMSKey(cr *imageregistryv1.Config) bool {
+	cond := util.FetchCondition(cr, defaults.StorageEncrypted)
+	return cond.Type != "" && cond.Message != googleManagedMessage
+}
+
+// kmsKeyChanged returns true if the default KMS key of the managed bucket does
+// not match spec.storage.gcs.keyID yet, or if it has to be checked for
+// out-of-band changes.
+func kmsKeyChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged || cr.Spec.Storage.GCS == nil {
+		return false
+	}
+	keyID := cr.Spec.Storage.GCS.KeyID
+	if keyID == "" {
+		return setsKMSKey(cr)
+	}
+	if !reportsKMSKey(cr, keyID) {
+		return true
+	}
+	return encryptionChecks.due(cr.Spec.Storage.GCS.Bucket)
+}
+
+// reconcileEncryption sets the default KMS key of the bucket to the key of
+// the config, and restores it when it was changed out-of-band. When the key is
+// removed from the config, the key the operator set is removed from the bucket
+// and new objects are encrypted with Google-managed keys again. Buckets that
+// never had a key from the config are left untouched.
+func (d *driver) reconcileEncryption(cr *imageregistryv1.Config, bucket *gstorage.BucketHandle) error {
+	if len(d.Config.KeyID) == 0 && !setsKMSKey(cr) {
+		return nil
+	}
+
+	attrs, err := bucket.Attrs(d.Context)
+	if err != nil {
+		reportEncryptionError(cr, err)
+		return err
+	}
+	defer encryptionChecks.done(d.Config.Bucket)
+
+	current := ""
+	if attrs.Encryption != nil {
+		current = attrs.Encryption.DefaultKMSKeyName
+	}
+	if current == d.Config.KeyID {
+		if len(d.Config.KeyID) == 0 {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Removed", googleManagedMessage)
+		} else if !reportsKMSKey(cr, d.Config.KeyID) {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Successful", kmsKeyMessage(d.Config.KeyID))
+		}
+		return nil
+	}
+
+	// A key that was already reported as applied was changed out-of-band.
+	drifted := len(d.Config.KeyID) != 0 && reportsKMSKey(cr, d.Config.KeyID)
+	if drifted {
+		klog.Warningf("the default KMS key of the GCS bucket %s was changed out-of-band to %q, restoring %s", d.Config.Bucket, current, d.Config.KeyID)
+	}
+
+	// An empty DefaultKMSKeyName removes the default KMS key of the bucket.
+	_, err = bucket.Update(d.Context, gstorage.BucketAttrsToUpdate{
+		Encryption: &gstorage.BucketEncryption{
+			DefaultKMSKeyName: d.Config.KeyID,
+		},
+	})
+	util.RecordStorageOperation("SetBucketEncryption", "gs://"+d.Config.Bucket, "", err)
+	if err != nil {
+		reportEncryptionError(cr, err)
+		return err
+	}
+
+	switch {
+	case len(d.Config.KeyID) == 0:
+		klog.Infof("default KMS key %s removed from the GCS bucket %s", current, d.Config.Bucket)
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Removed", googleManagedMessage)
+	case drifted:
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, encryptionReasonRestored, fmt.Sprintf("%s, it was restored after an out-of-band change to %q", kmsKeyMessage(d.Config.KeyID), current))
+	default:
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Successful", kmsKeyMessage(d.Config.KeyID))
+	}
+	return nil
+}
+
+func reportEncryptionError(cr *imageregistryv1.Config, err error) {
+	if gerr, ok := err.(*gapi.Error); ok {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, strconv.Itoa(gerr.Code), gerr.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
@@ -0,0 +1,25 @@
+package gcs
+
+import (
+	"errors"
+
+	gstorage "cloud.google.com/go/storage"
+	gapi "google.golang.org/api/googleapi"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// classifyError returns err as a util.StorageError when its kind is known.
+func classifyError(err error) error {
+	if errors.Is(err, gstorage.ErrBucketNotExist) {
+		return util.NewStorageError(util.ErrorKindNotFound, err)
+	}
+	if isTokenExchangeError(err) {
+		return util.NewStorageError(util.ErrorKindPermissionDenied, err)
+	}
+	var gerr *gapi.Error
+	if errors.As(err, &gerr) {
+		return util.ClassifyError(err, gerr.Code)
+	}
+	return util.ClassifyError(err, 0)
+}
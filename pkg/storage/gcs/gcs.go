@@ -3,12 +3,13 @@ package gcs
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
 	"strconv"
+	"time"
 
 	gstorage "cloud.google.com/go/storage"
-	goauth2 "golang.org/x/oauth2/google"
 	gapi "google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	goption "google.golang.org/api/option"
@@ -24,6 +25,7 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/clientconfig"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
@@ -38,6 +40,9 @@ type driver struct {
 	Config  *imageregistryv1.ImageRegistryConfigStorageGCS
 	Listers *regopclient.StorageListers
 
+	// removal controls how RemoveStorage deletes the objects.
+	removal util.RemovalOptions
+
 	// httpClient is used only during tests.
 	httpClient *http.Client
 }
@@ -63,12 +68,17 @@ func (d *driver) getGCSClient() (*gstorage.Client, error) {
 		d.Config.ProjectID = cfg.ProjectID
 	}
 
-	credentials, err := goauth2.CredentialsFromJSON(d.Context, []byte(cfg.KeyfileData), gstorage.ScopeFullControl)
+	keyfileData, err := workloadIdentityKeyfile([]byte(cfg.KeyfileData))
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := clientconfig.GCSCredentials(d.Context, keyfileData)
 	if err != nil {
 		return nil, err
 	}
 
-	opts := []goption.ClientOption{goption.WithCredentials(credentials)}
+	opts := []goption.ClientOption{credentials}
 	if d.httpClient != nil {
 		opts = append(opts, goption.WithHTTPClient(d.httpClient))
 	}
@@ -121,6 +131,21 @@ func GetConfig(listers *regopclient.StorageListers) (*GCS, error) {
 	return gcsConfig, nil
 }
 
+// TokenFile returns the projected service account token that a workload
+// identity federation configuration is exchanged with.
+func (d *driver) TokenFile() (string, error) {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return "", err
+	}
+
+	account, err := parseExternalAccount([]byte(cfg.KeyfileData))
+	if err != nil || account == nil {
+		return "", err
+	}
+	return projectedTokenFile, nil
+}
+
 func (d *driver) CABundle() (string, bool, error) {
 	return "", true, nil
 }
@@ -167,8 +192,13 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 		return nil, err
 	}
 
+	keyfileData, err := workloadIdentityKeyfile([]byte(cfg.KeyfileData))
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]string{
-		"REGISTRY_STORAGE_GCS_KEYFILE": cfg.KeyfileData,
+		"REGISTRY_STORAGE_GCS_KEYFILE": string(keyfileData),
 	}, nil
 }
 
@@ -183,12 +213,121 @@ func (d *driver) bucketExists(bucketName string) error {
 	return err
 }
 
-func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+// ProbeWrite writes a small object to the bucket and deletes it.
+func (d *driver) ProbeWrite(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
+	client, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+
+	obj := client.Bucket(d.Config.Bucket).Object(util.WriteProbeObject)
+	w := obj.NewWriter(d.Context)
+	if _, err := w.Write([]byte(util.WriteProbeObject)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	err = obj.Delete(d.Context)
+	if err == gstorage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
+
+// Validate writes the object util.ValidationProbeObject to the bucket, reads
+// it back and deletes it, the way the registry uses the bucket.
+func (d *driver) Validate(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
+	client, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+
+	obj := client.Bucket(d.Config.Bucket).Object(util.ValidationProbeObject)
+	w := obj.NewWriter(d.Context)
+	if _, err := w.Write([]byte(util.ValidationProbeObject)); err != nil {
+		w.Close()
+		return fmt.Errorf("unable to write the object %s: %w", util.ValidationProbeObject, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to write the object %s: %w", util.ValidationProbeObject, err)
+	}
+
+	r, err := obj.NewReader(d.Context)
+	if err != nil {
+		return fmt.Errorf("unable to read the object %s: %w", util.ValidationProbeObject, err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("unable to read the object %s: %w", util.ValidationProbeObject, err)
+	}
+	if string(data) != util.ValidationProbeObject {
+		return fmt.Errorf("the object %s read from the bucket does not match the object written to it", util.ValidationProbeObject)
+	}
+
+	if err := obj.Delete(d.Context); err != nil && err != gstorage.ErrObjectNotExist {
+		return fmt.Errorf("unable to delete the object %s: %w", util.ValidationProbeObject, err)
+	}
+	return nil
+}
+
+// SignURL returns a pre-signed URL that downloads the object key of the
+// bucket, like the URLs the registry redirects the blob downloads to.
+func (d *driver) SignURL(key string, expiry time.Duration) (string, error) {
+	client, err := d.getGCSClient()
+	if err != nil {
+		return "", err
+	}
+	return client.Bucket(d.Config.Bucket).SignedURL(key, &gstorage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(expiry),
+		Scheme:  gstorage.SigningSchemeV4,
+	})
+}
+
+// StorageUsage returns the total size and the number of the objects of the
+// bucket.
+func (d *driver) StorageUsage() (usage util.Usage, err error) {
+	defer func() { err = classifyError(err) }()
+	if len(d.Config.Bucket) == 0 {
+		return usage, fmt.Errorf("the GCS bucket is not configured")
+	}
+	client, err := d.getGCSClient()
+	if err != nil {
+		return usage, err
+	}
+
+	query := &gstorage.Query{}
+	if err := query.SetAttrSelection([]string{"Size"}); err != nil {
+		return usage, err
+	}
+	itr := client.Bucket(d.Config.Bucket).Objects(d.Context, query)
+	for {
+		attrs, err := itr.Next()
+		if err == iterator.Done {
+			return usage, nil
+		}
+		if err != nil {
+			return usage, err
+		}
+		usage.Bytes += attrs.Size
+		usage.Objects++
+	}
+}
+
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (exists bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if len(d.Config.Bucket) == 0 {
 		return false, nil
 	}
 
-	err := d.bucketExists(d.Config.Bucket)
+	err = d.bucketExists(d.Config.Bucket)
+	d.reportTokenExchange(cr, err)
 	if err != nil && err == gstorage.ErrBucketNotExist {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Bucket does not exist", err.Error())
 		return false, nil
@@ -208,6 +347,10 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 		return true
 	}
 
+	if kmsKeyChanged(cr) || labelSyncChanged(cr) {
+		return true
+	}
+
 	// Previous status condition was set to failed because, of tag operation failure,
 	// means bucket creation was successful and will retry adding tags.
 	if cond := util.FetchCondition(cr, defaults.StorageTagged); cond.Status != operatorapi.ConditionTrue {
@@ -217,7 +360,8 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
-func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
 	gclient, err := d.getGCSClient()
 	if err != nil {
 		return err
@@ -235,7 +379,9 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	var bucketExists bool
 	var bucketCreated bool
 	if len(d.Config.Bucket) != 0 {
-		if err := d.bucketExists(d.Config.Bucket); err == nil {
+		err := d.bucketExists(d.Config.Bucket)
+		d.reportTokenExchange(cr, err)
+		if err == nil {
 			bucketExists = true
 		} else if err != gstorage.ErrBucketNotExist {
 			util.UpdateCondition(
@@ -267,14 +413,16 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		bucketAttrs := gstorage.BucketAttrs{Location: d.Config.Region}
 		bucket = gclient.Bucket(d.Config.Bucket)
 
-		labels, err := getUserLabels(d.Listers.Infrastructures)
+		labels, err := d.clusterLabels(cr)
 		if err != nil {
 			return err
 		}
 		klog.V(1).Infof("createStorage: %v list of labels will be applied to %s bucket", labels, d.Config.Bucket)
 		bucketAttrs.Labels = labels
 
-		if err := bucket.Create(d.Context, d.Config.ProjectID, &bucketAttrs); err != nil {
+		err = bucket.Create(d.Context, d.Config.ProjectID, &bucketAttrs)
+		util.RecordStorageOperation("CreateBucket", "gs://"+d.Config.Bucket, "", err)
+		if err != nil {
 			if gerr, ok := err.(*gapi.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, strconv.Itoa(gerr.Code), gerr.Error())
 				return err
@@ -303,29 +451,19 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 
 	// Set KMS Key ID for encryption on the bucket (if specified)
 	// Data is encrypted by default on GCS: https://cloud.google.com/storage/docs/encryption/
-	if bucketCreated {
-		if len(d.Config.KeyID) != 0 {
-			_, err := bucket.Update(d.Context, gstorage.BucketAttrsToUpdate{
-				Encryption: &gstorage.BucketEncryption{
-					DefaultKMSKeyName: d.Config.KeyID,
-				},
-			})
-
-			if err != nil {
-				if gerr, ok := err.(*gapi.Error); ok {
-					util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "InvalidStorageConfiguration", gerr.Error())
-					return err
-				} else {
-					util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
-				}
-			} else {
-				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Successful", "KMS encryption was successfully enabled on the GCS bucket")
-				cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
-					GCS: d.Config.DeepCopy(),
-				}
-				cr.Spec.Storage.GCS = d.Config.DeepCopy()
-			}
+	if bucketCreated || cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		if err := d.reconcileEncryption(cr, bucket); err != nil {
+			return err
 		}
+	}
+
+	if !bucketCreated {
+		d.assureLabelSync(cr, bucket, func() (map[string]string, error) {
+			return d.clusterLabels(cr)
+		})
+	}
+
+	if bucketCreated {
 		// add user-defined tags to the created storage bucket and update `StorageTagged` condition.
 		err = tagMgr.AddTagsToStorageBucket(d.Context, cr)
 		return updateTagCondition(cr, err)
@@ -347,7 +485,74 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
-func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+// bucketObjects lists and deletes the objects of a GCS bucket.
+type bucketObjects struct {
+	client *gstorage.Client
+	bucket string
+}
+
+func (b *bucketObjects) CountObjects(ctx context.Context) (int64, error) {
+	query := &gstorage.Query{}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return 0, err
+	}
+	var count int64
+	itr := b.client.Bucket(b.bucket).Objects(ctx, query)
+	for {
+		_, err := itr.Next()
+		if err == iterator.Done {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
+
+func (b *bucketObjects) ListObjects(ctx context.Context, marker string, limit int) ([]string, error) {
+	// StartOffset includes the marker itself, it is skipped.
+	query := &gstorage.Query{StartOffset: marker}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+	var names []string
+	itr := b.client.Bucket(b.bucket).Objects(ctx, query)
+	for len(names) < limit {
+		attrs, err := itr.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if marker != "" && attrs.Name == marker {
+			continue
+		}
+		names = append(names, attrs.Name)
+	}
+	return names, nil
+}
+
+func (b *bucketObjects) DeleteObjects(ctx context.Context, names []string) error {
+	for _, name := range names {
+		klog.V(5).Infof("deleting object %s", name)
+		err := b.client.Bucket(b.bucket).Object(name).Delete(ctx)
+		if err != nil && err != gstorage.ErrObjectNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetRemovalOptions sets how RemoveStorage deletes the objects of the
+// bucket.
+func (d *driver) SetRemovalOptions(opts util.RemovalOptions) {
+	d.removal = opts
+}
+
+func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
 		return false, nil
 	}
@@ -356,20 +561,30 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	itr := gclient.Bucket(d.Config.Bucket).Objects(d.Context, nil)
-	klog.V(5).Infof("deleting all objects in bucket %s", d.Config.Bucket)
-	for attr, err := itr.Next(); err == nil || err != iterator.Done; {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return false, err
+	}
+	attrs, err := gclient.Bucket(d.Config.Bucket).Attrs(d.Context)
+	if err != nil && err != gstorage.ErrBucketNotExist {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return false, err
+	}
+	if attrs != nil && !util.ManagedByCluster(attrs.Labels, infra, fmt.Sprintf(ocpDefaultLabelFmt, infra.Status.InfrastructureName)) {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Not Managed By Operator", fmt.Sprintf("The GCS bucket %s is not labeled as managed by the operator of this cluster, it was not deleted", d.Config.Bucket))
+		return false, nil
+	}
+
+	if attrs != nil {
+		err = util.DeleteAllObjects(d.Context, d.Config.Bucket, &bucketObjects{client: gclient, bucket: d.Config.Bucket}, d.removal)
 		if err != nil {
 			return false, err
 		}
-		klog.V(5).Infof("deleting object %s", attr.Name)
-		deleteErr := gclient.Bucket(attr.Bucket).Object(attr.Name).Delete(d.Context)
-		if deleteErr != nil {
-			return false, deleteErr
-		}
 	}
 
-	if err = gclient.Bucket(d.Config.Bucket).Delete(d.Context); err != nil {
+	err = gclient.Bucket(d.Config.Bucket).Delete(d.Context)
+	util.RecordStorageOperation("DeleteBucket", "gs://"+d.Config.Bucket, "", err)
+	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "", err.Error())
 		return false, err
 	}
@@ -395,3 +610,14 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 func (d *driver) ID() string {
 	return d.Config.Bucket
 }
+
+// Capabilities returns the capabilities of GCS storage. The bucket is
+// encrypted with the configured KMS key and labeled with the cluster labels.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		SupportsRedirect:         true,
+		SupportsEncryptionConfig: true,
+		SupportsTagging:          true,
+		MultiWriterSafe:          true,
+	}
+}
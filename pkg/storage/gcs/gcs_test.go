@@ -4,19 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
 
+	gstorage "cloud.google.com/go/storage"
+	goption "google.golang.org/api/option"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 // tripper is injected on gcs client to simulate api responses.
@@ -191,3 +198,327 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	expected := util.Capabilities{
+		SupportsRedirect:         true,
+		SupportsEncryptionConfig: true,
+		SupportsTagging:          true,
+		MultiWriterSafe:          true,
+	}
+	if caps := (&driver{}).Capabilities(); caps != expected {
+		t.Errorf("expected GCS storage capabilities %+v, got %+v", expected, caps)
+	}
+}
+
+func TestReconcileEncryption(t *testing.T) {
+	const key = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+	for _, tt := range []struct {
+		name           string
+		keyID          string
+		condition      *operatorv1.OperatorCondition
+		responseBodies []string
+		reason         string
+		message        string
+	}{
+		{
+			name:           "no key",
+			responseBodies: nil,
+		},
+		{
+			name:           "key set",
+			keyID:          key,
+			responseBodies: []string{`{"name":"bucket"}`, `{"name":"bucket"}`},
+			reason:         "Encryption Successful",
+			message:        kmsKeyMessage(key),
+		},
+		{
+			name:           "key already set",
+			keyID:          key,
+			responseBodies: []string{`{"name":"bucket","encryption":{"defaultKmsKeyName":"` + key + `"}}`},
+			reason:         "Encryption Successful",
+			message:        kmsKeyMessage(key),
+		},
+		{
+			name:  "key changed out-of-band",
+			keyID: key,
+			condition: &operatorv1.OperatorCondition{
+				Type:    defaults.StorageEncrypted,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Encryption Successful",
+				Message: kmsKeyMessage(key),
+			},
+			responseBodies: []string{`{"name":"bucket","encryption":{"defaultKmsKeyName":"other"}}`, `{"name":"bucket"}`},
+			reason:         encryptionReasonRestored,
+			message:        kmsKeyMessage(key) + `, it was restored after an out-of-band change to "other"`,
+		},
+		{
+			name: "key removed from the config",
+			condition: &operatorv1.OperatorCondition{
+				Type:    defaults.StorageEncrypted,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Encryption Successful",
+				Message: kmsKeyMessage(key),
+			},
+			responseBodies: []string{`{"name":"bucket","encryption":{"defaultKmsKeyName":"` + key + `"}}`, `{"name":"bucket"}`},
+			reason:         "Encryption Removed",
+			message:        googleManagedMessage,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &tripper{}
+			for _, body := range tt.responseBodies {
+				rt.AddResponse(http.StatusOK, body)
+			}
+			client, err := gstorage.NewClient(context.Background(), goption.WithHTTPClient(&http.Client{Transport: rt}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+							Bucket: "bucket",
+							KeyID:  tt.keyID,
+						},
+					},
+				},
+			}
+			if tt.condition != nil {
+				cr.Status.Conditions = append(cr.Status.Conditions, *tt.condition)
+			}
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, nil)
+			if err := drv.reconcileEncryption(cr, client.Bucket("bucket")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rt.req != len(tt.responseBodies) {
+				t.Errorf("expected %d requests, got %d", len(tt.responseBodies), rt.req)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StorageEncrypted)
+			if cond.Reason != tt.reason || cond.Message != tt.message {
+				t.Errorf("expected the condition %q: %q, got %q: %q", tt.reason, tt.message, cond.Reason, cond.Message)
+			}
+			if tt.keyID != "" && kmsKeyChanged(cr) {
+				t.Errorf("expected the key to be reconciled")
+			}
+		})
+	}
+}
+
+func TestAssureLabelSync(t *testing.T) {
+	labels := func() (map[string]string, error) {
+		return map[string]string{"kubernetes-io-cluster-user-j45xj": "owned", "team": "registry"}, nil
+	}
+
+	for _, tt := range []struct {
+		name           string
+		overrides      string
+		responseBodies []string
+		reason         string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:           "in sync",
+			overrides:      `{"storage":{"gcs":{"labelSync":{"enabled":true}}}}`,
+			responseBodies: []string{`{"name":"bucket","labels":{"kubernetes-io-cluster-user-j45xj":"owned","team":"registry","other":"kept"}}`},
+			reason:         labelSyncReasonSynced,
+		},
+		{
+			name:           "label changed",
+			overrides:      `{"storage":{"gcs":{"labelSync":{"enabled":true}}}}`,
+			responseBodies: []string{`{"name":"bucket","labels":{"kubernetes-io-cluster-user-j45xj":"owned","team":"other"}}`, `{"name":"bucket"}`},
+			reason:         labelSyncReasonSynced,
+		},
+		{
+			name:           "update failed",
+			overrides:      `{"storage":{"gcs":{"labelSync":{"enabled":true}}}}`,
+			responseBodies: []string{`{"name":"bucket"}`, `{"error":{"code":403,"message":"forbidden"}}`},
+			reason:         labelSyncReasonFailed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &tripper{}
+			for i, body := range tt.responseBodies {
+				code := http.StatusOK
+				if tt.reason == labelSyncReasonFailed && i == len(tt.responseBodies)-1 {
+					code = http.StatusForbidden
+				}
+				rt.AddResponse(code, body)
+			}
+			client, err := gstorage.NewClient(context.Background(), goption.WithHTTPClient(&http.Client{Transport: rt}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						GCS:             &imageregistryv1.ImageRegistryConfigStorageGCS{Bucket: "bucket"},
+					},
+				},
+			}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, nil)
+			drv.assureLabelSync(cr, client.Bucket("bucket"), labels)
+			if rt.req != len(tt.responseBodies) {
+				t.Errorf("expected %d requests, got %d", len(tt.responseBodies), rt.req)
+			}
+			if cond := util.FetchCondition(cr, defaults.StorageLabeled); cond.Reason != tt.reason {
+				t.Errorf("expected the reason %q, got %q: %q", tt.reason, cond.Reason, cond.Message)
+			}
+			if tt.reason == labelSyncReasonSynced && labelSyncChanged(cr) {
+				t.Errorf("expected the labels to be synced")
+			}
+		})
+	}
+}
+
+func testExternalAccount(audience, tokenType string, source map[string]interface{}) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":               "external_account",
+		"audience":           audience,
+		"subject_token_type": tokenType,
+		"token_url":          "https://sts.googleapis.com/v1/token",
+		"credential_source":  source,
+	})
+	return data
+}
+
+func TestWorkloadIdentityKeyfile(t *testing.T) {
+	audience := "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider"
+
+	for _, tt := range []struct {
+		name    string
+		keyfile []byte
+		file    string
+		err     bool
+	}{
+		{
+			name:    "service account key",
+			keyfile: []byte(`{"type": "service_account", "project_id": "project-id"}`),
+		},
+		{
+			name:    "projected token",
+			keyfile: testExternalAccount(audience, jwtTokenType, map[string]interface{}{"file": projectedTokenFile}),
+			file:    projectedTokenFile,
+		},
+		{
+			name:    "token in another file",
+			keyfile: testExternalAccount(audience, jwtTokenType, map[string]interface{}{"file": "/var/run/service-account/token", "format": map[string]string{"type": "text"}}),
+			file:    projectedTokenFile,
+		},
+		{
+			name:    "workforce pool",
+			keyfile: testExternalAccount("//iam.googleapis.com/locations/global/workforcePools/pool/providers/provider", jwtTokenType, map[string]interface{}{"file": projectedTokenFile}),
+			err:     true,
+		},
+		{
+			name:    "SAML token",
+			keyfile: testExternalAccount(audience, "urn:ietf:params:oauth:token-type:saml2", map[string]interface{}{"file": projectedTokenFile}),
+			err:     true,
+		},
+		{
+			name:    "URL source",
+			keyfile: testExternalAccount(audience, jwtTokenType, map[string]interface{}{"url": "http://169.254.169.254/token"}),
+			err:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := workloadIdentityKeyfile(tt.keyfile)
+			if tt.err {
+				var storageErr *util.StorageError
+				if !errors.As(err, &storageErr) || storageErr.Kind != util.ErrorKindInvalidConfig {
+					t.Fatalf("expected an invalid config error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keyfile map[string]interface{}
+			if err := json.Unmarshal(data, &keyfile); err != nil {
+				t.Fatal(err)
+			}
+			if tt.file == "" {
+				if !bytes.Equal(data, tt.keyfile) {
+					t.Errorf("expected the keyfile to be unchanged, got %s", data)
+				}
+				return
+			}
+			source := keyfile["credential_source"].(map[string]interface{})
+			if source["file"] != tt.file {
+				t.Errorf("expected the credential source %s, got %v", tt.file, source["file"])
+			}
+			if keyfile["audience"] != audience {
+				t.Errorf("expected the audience to be kept, got %v", keyfile["audience"])
+			}
+		})
+	}
+}
+
+func TestReportTokenExchange(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": testExternalAccount("//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider", jwtTokenType, map[string]interface{}{"file": projectedTokenFile}),
+		},
+	})
+	builder.AddInfraConfig(&configv1.Infrastructure{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}})
+	listers := builder.BuildListers()
+	d := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageGCS{}, &listers.StorageListers)
+
+	for _, tt := range []struct {
+		name   string
+		err    error
+		status operatorv1.ConditionStatus
+		kind   util.ErrorKind
+	}{
+		{
+			name:   "deleted pool",
+			err:    fmt.Errorf(`Get "https://storage.googleapis.com/storage/v1/b/bucket": oauth2/google: status code 400: {"error":"invalid_grant","error_description":"The workload identity pool is deleted."}`),
+			status: operatorv1.ConditionTrue,
+			kind:   util.ErrorKindPermissionDenied,
+		},
+		{
+			name:   "bucket not found",
+			err:    gstorage.ErrBucketNotExist,
+			status: operatorv1.ConditionFalse,
+			kind:   util.ErrorKindNotFound,
+		},
+		{
+			name:   "network error",
+			err:    fmt.Errorf("connection reset by peer"),
+			status: operatorv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			util.UpdateCondition(cr, defaults.StorageTokenExchangeFailing, operatorv1.ConditionFalse, "TokenExchangeSucceeded", "")
+			d.reportTokenExchange(cr, tt.err)
+
+			cond := util.FetchCondition(cr, defaults.StorageTokenExchangeFailing)
+			if cond.Status != tt.status {
+				t.Errorf("expected the condition %s, got %s: %s", tt.status, cond.Status, cond.Message)
+			}
+
+			var storageErr *util.StorageError
+			if errors.As(classifyError(tt.err), &storageErr) != (tt.kind != "") || (tt.kind != "" && storageErr.Kind != tt.kind) {
+				t.Errorf("expected the error kind %q, got %v", tt.kind, classifyError(tt.err))
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package gcs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gstorage "cloud.google.com/go/storage"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	labelSyncReasonSynced = "LabelsSynced"
+	labelSyncReasonFailed = "LabelSyncFailed"
+)
+
+// labelSyncs remembers when the labels of the bucket were last synced.
+var labelSyncs labelSyncSchedule
+
+// labelSyncSchedule holds in memory the time of the last synchronization of
+// the labels of a bucket. It is lost when the operator restarts, which only
+// causes an early synchronization.
+type labelSyncSchedule struct {
+	mtx    sync.Mutex
+	bucket string
+	last   time.Time
+}
+
+// due returns true if the labels of the bucket were not synced during the
+// last interval.
+func (s *labelSyncSchedule) due(bucket string, interval time.Duration) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.bucket != bucket {
+		return true
+	}
+	return time.Since(s.last) >= interval
+}
+
+// done records that the labels of the bucket have just been synced.
+func (s *labelSyncSchedule) done(bucket string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.bucket = bucket
+	s.last = time.Now()
+}
+
+// labelSyncInterval returns the time between two synchronizations of the
+// labels of a managed bucket, or zero if the labels are only set when the
+// bucket is created.
+func labelSyncInterval(cr *imageregistryv1.Config) (time.Duration, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return 0, err
+	}
+	enabled, intervalSeconds, err := configOverrides.GCSLabelSync()
+	if err != nil {
+		return 0, err
+	}
+	if !enabled || cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return 0, nil
+	}
+	return time.Duration(intervalSeconds) * time.Second, nil
+}
+
+// labelSyncChanged returns true if the labels of a managed bucket are kept in
+// sync and the last synchronization failed or is too old.
+func labelSyncChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.GCS == nil {
+		return false
+	}
+	interval, err := labelSyncInterval(cr)
+	if err != nil || interval == 0 {
+		return false
+	}
+	if cond := util.FetchCondition(cr, defaults.StorageLabeled); cond.Status != operatorapi.ConditionTrue {
+		return true
+	}
+	return labelSyncs.due(cr.Spec.Storage.GCS.Bucket, interval)
+}
+
+// clusterLabels returns the labels the operator sets on the buckets it
+// creates: the user-defined labels of the cluster and the labels that mark
+// the bucket as owned by the cluster.
+func (d *driver) clusterLabels(cr *imageregistryv1.Config) (map[string]string, error) {
+	labels, err := getUserLabels(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range util.ManagedMetadata(infra, cr) {
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// assureLabelSync sets labels on a managed bucket when its labels are kept in
+// sync. Labels that are not in labels are left in place. A failure is
+// reported by the StorageLabeled condition, the storage stays usable.
+func (d *driver) assureLabelSync(cr *imageregistryv1.Config, bucket *gstorage.BucketHandle, labels func() (map[string]string, error)) {
+	interval, err := labelSyncInterval(cr)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageLabeled, operatorapi.ConditionFalse, labelSyncReasonFailed, fmt.Sprintf("Invalid label sync configuration: %s", err))
+		return
+	}
+	if interval == 0 {
+		return
+	}
+
+	expected, err := labels()
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageLabeled, operatorapi.ConditionFalse, labelSyncReasonFailed, fmt.Sprintf("Unable to get the labels of the cluster: %s", err))
+		return
+	}
+	attrs, err := bucket.Attrs(d.Context)
+	if err != nil {
+		klog.Errorf("unable to get the labels of the GCS bucket %s: %s", d.Config.Bucket, err)
+		util.UpdateCondition(cr, defaults.StorageLabeled, operatorapi.ConditionFalse, labelSyncReasonFailed, fmt.Sprintf("Unable to get the labels of the GCS bucket: %s", err))
+		return
+	}
+
+	var update gstorage.BucketAttrsToUpdate
+	changed := false
+	for key, value := range expected {
+		if current, ok := attrs.Labels[key]; !ok || current != value {
+			update.SetLabel(key, value)
+			changed = true
+		}
+	}
+	if changed {
+		if _, err := bucket.Update(d.Context, update); err != nil {
+			klog.Errorf("unable to sync the labels of the GCS bucket %s: %s", d.Config.Bucket, err)
+			util.UpdateCondition(cr, defaults.StorageLabeled, operatorapi.ConditionFalse, labelSyncReasonFailed, fmt.Sprintf("Unable to sync the labels of the GCS bucket: %s", err))
+			return
+		}
+		klog.Infof("updated the labels of the GCS bucket %s", d.Config.Bucket)
+	}
+	labelSyncs.done(d.Config.Bucket)
+	util.UpdateCondition(cr, defaults.StorageLabeled, operatorapi.ConditionTrue, labelSyncReasonSynced, "The labels of the GCS bucket are in sync with the cluster")
+}
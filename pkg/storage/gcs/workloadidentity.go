@@ -0,0 +1,137 @@
+package gcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	gstorage "cloud.google.com/go/storage"
+	gapi "google.golang.org/api/googleapi"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// externalAccountType is the type of the credential configuration
+	// files of workload identity federation.
+	externalAccountType = "external_account"
+
+	// jwtTokenType is the subject token type of a service account token.
+	jwtTokenType = "urn:ietf:params:oauth:token-type:jwt"
+
+	// projectedTokenFile is where the service account token is projected
+	// in the operator and in the registry pods.
+	projectedTokenFile = "/var/run/secrets/openshift/serviceaccount/token"
+)
+
+// workloadIdentityAudience matches the audience of a workload identity pool
+// provider.
+var workloadIdentityAudience = regexp.MustCompile(`^//iam\.googleapis\.com/projects/[^/]+/locations/[^/]+/workloadIdentityPools/[^/]+/providers/[^/]+$`)
+
+// tokenExchangeError matches the errors of the Security Token Service and of
+// the service account impersonation of the Google auth library.
+var tokenExchangeError = regexp.MustCompile(`oauth2/google: status code (\d+): (.*)`)
+
+// externalAccount is the part of a workload identity federation
+// configuration that the operator checks.
+type externalAccount struct {
+	Type             string `json:"type"`
+	Audience         string `json:"audience"`
+	SubjectTokenType string `json:"subject_token_type"`
+	CredentialSource struct {
+		File       string          `json:"file"`
+		URL        string          `json:"url"`
+		Executable json.RawMessage `json:"executable"`
+	} `json:"credential_source"`
+}
+
+// parseExternalAccount returns the workload identity federation
+// configuration in keyfileData, or nil if keyfileData is a service account
+// key. The registry pods only get the projected service account token, the
+// configuration must read it from a file.
+func parseExternalAccount(keyfileData []byte) (*externalAccount, error) {
+	var account externalAccount
+	if err := json.Unmarshal(keyfileData, &account); err != nil {
+		return nil, fmt.Errorf("unable to parse the GCS keyfile: %w", err)
+	}
+	if account.Type != externalAccountType {
+		return nil, nil
+	}
+
+	var problems []string
+	if !workloadIdentityAudience.MatchString(account.Audience) {
+		problems = append(problems, fmt.Sprintf("the audience %q is not a workload identity pool provider", account.Audience))
+	}
+	if account.SubjectTokenType != jwtTokenType {
+		problems = append(problems, fmt.Sprintf("the subject token type must be %s, got %q", jwtTokenType, account.SubjectTokenType))
+	}
+	if account.CredentialSource.URL != "" || len(account.CredentialSource.Executable) != 0 {
+		problems = append(problems, "the credential source must be a file, URL and executable sources are not supported")
+	} else if account.CredentialSource.File == "" {
+		problems = append(problems, "the credential source has no file")
+	}
+	if len(problems) > 0 {
+		return nil, util.NewStorageError(util.ErrorKindInvalidConfig, fmt.Errorf("invalid workload identity federation configuration: %s", strings.Join(problems, ", ")))
+	}
+	return &account, nil
+}
+
+// workloadIdentityKeyfile returns keyfileData with the credential source of a
+// workload identity federation configuration pointing at the projected
+// service account token. Service account keys are returned as they are.
+func workloadIdentityKeyfile(keyfileData []byte) ([]byte, error) {
+	account, err := parseExternalAccount(keyfileData)
+	if err != nil || account == nil {
+		return keyfileData, err
+	}
+	if account.CredentialSource.File == projectedTokenFile {
+		return keyfileData, nil
+	}
+
+	var keyfile map[string]interface{}
+	if err := json.Unmarshal(keyfileData, &keyfile); err != nil {
+		return nil, fmt.Errorf("unable to parse the GCS keyfile: %w", err)
+	}
+	source, _ := keyfile["credential_source"].(map[string]interface{})
+	source["file"] = projectedTokenFile
+	return json.Marshal(keyfile)
+}
+
+// isTokenExchangeError returns whether err is a rejected exchange of the
+// service account token for an access token.
+func isTokenExchangeError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var gerr *gapi.Error
+	if errors.As(err, &gerr) {
+		return false
+	}
+	return tokenExchangeError.MatchString(err.Error())
+}
+
+// reportTokenExchange updates the StorageTokenExchangeFailing condition
+// after a request to GCS authenticated with workload identity federation.
+// Errors that are not related to the authentication leave it unchanged.
+func (d *driver) reportTokenExchange(cr *imageregistryv1.Config, err error) {
+	if tokenFile, _ := d.TokenFile(); tokenFile == "" {
+		return
+	}
+
+	var gerr *gapi.Error
+	switch {
+	case isTokenExchangeError(err):
+		metrics.ReportStorageTokenExchange(util.DriverName(&cr.Spec.Storage), true)
+		util.UpdateCondition(cr, defaults.StorageTokenExchangeFailing, operatorapi.ConditionTrue, "TokenExchangeFailed", fmt.Sprintf("The workload identity token could not be exchanged for an access token, check that the workload identity pool and its provider exist: %s", err))
+	case err == nil, errors.Is(err, gstorage.ErrBucketNotExist), errors.As(err, &gerr):
+		metrics.ReportStorageTokenExchange(util.DriverName(&cr.Spec.Storage), false)
+		util.UpdateCondition(cr, defaults.StorageTokenExchangeFailing, operatorapi.ConditionFalse, "TokenExchangeSucceeded", "The workload identity token was exchanged for an access token")
+	}
+}
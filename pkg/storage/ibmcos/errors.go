@@ -0,0 +1,24 @@
+package ibmcos
+
+import (
+	"errors"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// classifyError returns err as a util.StorageError when its kind is known.
+func classifyError(err error) error {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		if kind, ok := util.ErrorKindForS3Code(aerr.Code()); ok {
+			return util.NewStorageError(kind, err)
+		}
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return util.ClassifyError(err, reqErr.StatusCode())
+	}
+	return util.ClassifyError(err, 0)
+}
@@ -60,6 +60,9 @@ type driver struct {
 	Config    *imageregistryv1.ImageRegistryConfigStorageIBMCOS
 	Listers   *regopclient.StorageListers
 
+	// removal controls how RemoveStorage deletes the objects.
+	removal util.RemovalOptions
+
 	// roundTripper is used only during tests.
 	roundTripper http.RoundTripper
 
@@ -157,7 +160,8 @@ func (d *driver) UpdateEffectiveConfig() (*imageregistryv1.ImageRegistryConfigSt
 
 // CreateStorage attempts to create an IBM COS service instance,
 // resource key, and bucket.
-func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
 	// Get Infrastructure spec
 	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
 	if err != nil {
@@ -654,9 +658,82 @@ func (d *driver) ID() string {
 	return d.Config.Bucket
 }
 
+// Capabilities returns the capabilities of IBM COS storage.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		SupportsRedirect: true,
+		MultiWriterSafe:  true,
+	}
+}
+
+// bucketObjects lists and deletes the objects of an IBM COS bucket.
+type bucketObjects struct {
+	client *s3.S3
+	bucket string
+}
+
+func (b *bucketObjects) CountObjects(ctx context.Context) (int64, error) {
+	var count int64
+	err := b.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		count += int64(len(page.Contents))
+		return true
+	})
+	return count, err
+}
+
+func (b *bucketObjects) ListObjects(ctx context.Context, marker string, limit int) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(b.bucket),
+		MaxKeys: aws.Int64(int64(limit)),
+	}
+	if marker != "" {
+		input.StartAfter = aws.String(marker)
+	}
+	output, err := b.client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(output.Contents))
+	for _, obj := range output.Contents {
+		names = append(names, aws.StringValue(obj.Key))
+	}
+	return names, nil
+}
+
+func (b *bucketObjects) DeleteObjects(ctx context.Context, names []string) error {
+	objects := make([]*s3.ObjectIdentifier, 0, len(names))
+	for _, name := range names {
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(name)})
+	}
+	output, err := b.client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(b.bucket),
+		Delete: &s3.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.Errors) > 0 {
+		e := output.Errors[0]
+		return awserr.New(aws.StringValue(e.Code), fmt.Sprintf("unable to delete %s: %s (and %d more errors)", aws.StringValue(e.Key), aws.StringValue(e.Message), len(output.Errors)-1), nil)
+	}
+	return nil
+}
+
+// SetRemovalOptions sets how RemoveStorage deletes the objects of the
+// bucket.
+func (d *driver) SetRemovalOptions(opts util.RemovalOptions) {
+	d.removal = opts
+}
+
 // RemoveStorage deletes the storage medium that was created.
 // The COS bucket must be empty before it can be removed.
-func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err error) {
+	defer func() { err = classifyError(err) }()
 	// Not enough info for clean up
 	if len(d.Config.Bucket) == 0 || len(d.Config.ServiceInstanceCRN) == 0 {
 		return false, nil
@@ -672,11 +749,7 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	iter := s3manager.NewDeleteListIterator(client, &s3.ListObjectsInput{
-		Bucket: aws.String(d.Config.Bucket),
-	})
-
-	err = s3manager.NewBatchDeleteWithClient(client).Delete(d.Context, iter)
+	err = util.DeleteAllObjects(d.Context, d.Config.Bucket, &bucketObjects{client: client, bucket: d.Config.Bucket}, d.removal)
 	if err != nil && !isBucketNotFound(err) {
 		return false, err
 	}
@@ -759,12 +832,13 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 
 // StorageExists checks if an IBM COS bucket with the given name exists
 // and we can access it.
-func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (exists bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if len(d.Config.Bucket) == 0 || len(d.Config.ServiceInstanceCRN) == 0 {
 		return false, nil
 	}
 
-	err := d.bucketExists(d.Config.Bucket, d.Config.ServiceInstanceCRN)
+	err = d.bucketExists(d.Config.Bucket, d.Config.ServiceInstanceCRN)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
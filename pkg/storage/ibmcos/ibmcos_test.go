@@ -20,6 +20,7 @@ import (
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestConfigEnv(t *testing.T) {
@@ -369,3 +370,13 @@ func (r *tripper) AddResponse(code int, body string) {
 	r.responseCodes = append(r.responseCodes, code)
 	r.responseBodies = append(r.responseBodies, body)
 }
+
+func TestCapabilities(t *testing.T) {
+	expected := util.Capabilities{
+		SupportsRedirect: true,
+		MultiWriterSafe:  true,
+	}
+	if caps := (&driver{}).Capabilities(); caps != expected {
+		t.Errorf("expected IBM COS storage capabilities %+v, got %+v", expected, caps)
+	}
+}
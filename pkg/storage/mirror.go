@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"k8s.io/client-go/rest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+)
+
+// NewMirrorDriver returns the driver of the secondary storage the operator
+// provisions as a copy target for the registry storage. Unlike NewDriver, it
+// does not report the storage type of the registry.
+func NewMirrorDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.StorageListers, fg featuregates.FeatureGateAccess) (Driver, error) {
+	_, driver, err := newDriver(cfg, kubeconfig, listers, fg)
+	return driver, err
+}
@@ -0,0 +1,243 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	securityv1 "github.com/openshift/api/security/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// healthProbeScript writes a file to the claim and reads it back. A stale
+// NFS file handle makes it fail, a hung mount makes it time out.
+const healthProbeScript = `f="` + RootDirectory + `/.storage-probe-$HOSTNAME" && echo "$HOSTNAME" > "$f" && [ "$(cat "$f")" = "$HOSTNAME" ] && rm -f "$f"`
+
+// healthProbes remembers when the claim was last probed.
+var healthProbes healthProbeSchedule
+
+// healthProbeSchedule holds in memory the time of the last health probe of a
+// claim, and whether a probe is running. It is lost when the operator
+// restarts, which only causes an early probe.
+type healthProbeSchedule struct {
+	mtx     sync.Mutex
+	claim   string
+	last    time.Time
+	running bool
+}
+
+// due returns true if a probe of the claim is running or if the claim was not
+// probed during the last interval.
+func (s *healthProbeSchedule) due(claim string, interval time.Duration) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.claim != claim {
+		return true
+	}
+	return s.running || time.Since(s.last) >= interval
+}
+
+// started records that a probe of the claim is running.
+func (s *healthProbeSchedule) started(claim string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.claim = claim
+	s.running = true
+}
+
+// done records that the claim has just been probed.
+func (s *healthProbeSchedule) done(claim string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.claim = claim
+	s.last = time.Now()
+	s.running = false
+}
+
+// healthProbeSettings returns the time between two probes of the claim and
+// the time a probe has to complete, or zeros if the claim is not probed.
+func healthProbeSettings(cr *imageregistryv1.Config) (time.Duration, time.Duration, error) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return 0, 0, err
+	}
+	enabled, intervalSeconds, timeoutSeconds, err := configOverrides.PVCHealthProbe()
+	if err != nil || !enabled {
+		return 0, 0, err
+	}
+	return time.Duration(intervalSeconds) * time.Second, time.Duration(timeoutSeconds) * time.Second, nil
+}
+
+// healthProbeChanged returns true if the claim is probed and a probe is
+// running or due.
+func healthProbeChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.PVC == nil {
+		return false
+	}
+	interval, _, err := healthProbeSettings(cr)
+	if err != nil {
+		return false
+	}
+	if interval == 0 {
+		return util.FetchCondition(cr, defaults.StorageDegraded).Type != ""
+	}
+	return healthProbes.due(cr.Spec.Storage.PVC.Claim, interval)
+}
+
+// healthProbeJob returns the job that probes the claim. It prefers the nodes
+// of the registry pods, so that ReadWriteOnce claims can be mounted.
+func (d *driver) healthProbeJob(timeout time.Duration) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.StorageHealthProbeJobName,
+			Namespace: d.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          ptr.To[int32](0),
+			ActiveDeadlineSeconds: ptr.To(int64(timeout.Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						securityv1.RequiredSCCAnnotation: "restricted-v2",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: defaults.ServiceAccountName,
+					PriorityClassName:  "system-cluster-critical",
+					Affinity: &corev1.Affinity{
+						PodAffinity: &corev1.PodAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+								Weight: 100,
+								PodAffinityTerm: corev1.PodAffinityTerm{
+									LabelSelector: &metav1.LabelSelector{MatchLabels: defaults.DeploymentLabels},
+									TopologyKey:   "kubernetes.io/hostname",
+								},
+							}},
+						},
+					},
+					Containers: []corev1.Container{{
+						Name:    "probe",
+						Image:   os.Getenv("OPERATOR_IMAGE"),
+						Command: []string{"/bin/sh", "-c", healthProbeScript},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("10m"),
+								corev1.ResourceMemory: resource.MustParse("16Mi"),
+							},
+						},
+						TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "registry-storage",
+							MountPath: RootDirectory,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "registry-storage",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+								ClaimName: d.Config.Claim,
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// healthProbeResult returns whether the job has finished, and the error of the
+// probe if it failed.
+func healthProbeResult(job *batchv1.Job, timeout time.Duration) (bool, error) {
+	if job.Status.Succeeded > 0 {
+		return true, nil
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Type != batchv1.JobFailed || cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		if cond.Reason == batchv1.JobReasonDeadlineExceeded {
+			return true, fmt.Errorf("the probe did not complete within %s, the volume may be hung", timeout)
+		}
+		return true, fmt.Errorf("a file could not be written to the volume and read back: %s", cond.Message)
+	}
+	return false, nil
+}
+
+// syncHealthProbe probes the claim of the registry periodically with a job
+// and reports the result by the StorageDegraded condition. The storage stays
+// in use while the probe fails.
+func (d *driver) syncHealthProbe(cr *imageregistryv1.Config) error {
+	interval, timeout, err := healthProbeSettings(cr)
+	if err != nil {
+		return err
+	}
+	if interval == 0 && util.FetchCondition(cr, defaults.StorageDegraded).Type == "" {
+		return nil
+	}
+
+	jobs := d.Batch.Jobs(d.Namespace)
+	if interval == 0 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageDegraded)
+		err := jobs.Delete(context.TODO(), defaults.StorageHealthProbeJobName, metav1.DeleteOptions{
+			PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	job, err := jobs.Get(context.TODO(), defaults.StorageHealthProbeJobName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if !healthProbes.due(d.Config.Claim, interval) {
+			return nil
+		}
+		if _, err := jobs.Create(context.TODO(), d.healthProbeJob(timeout), metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		healthProbes.started(d.Config.Claim)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	finished, probeErr := healthProbeResult(job, timeout)
+	if !finished {
+		healthProbes.started(d.Config.Claim)
+		return nil
+	}
+	if probeErr != nil {
+		klog.Warningf("the health probe of the claim %s failed: %s", d.Config.Claim, probeErr)
+		util.UpdateCondition(cr, defaults.StorageDegraded, operatorapi.ConditionTrue, "HealthProbeFailed", fmt.Sprintf("The health probe of the claim %s failed: %s", d.Config.Claim, probeErr))
+	} else {
+		util.UpdateCondition(cr, defaults.StorageDegraded, operatorapi.ConditionFalse, "HealthProbeSucceeded", fmt.Sprintf("A file was written to the claim %s and read back", d.Config.Claim))
+	}
+	healthProbes.done(d.Config.Claim)
+	err = jobs.Delete(context.TODO(), job.Name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
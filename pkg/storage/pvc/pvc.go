@@ -10,6 +10,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 
@@ -19,11 +21,12 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const (
-	rootDirectory      = "/registry"
+	RootDirectory      = "/registry"
 	PVCOwnerAnnotation = "imageregistry.openshift.io"
 )
 
@@ -31,6 +34,7 @@ type driver struct {
 	Namespace string
 	Config    *imageregistryv1.ImageRegistryConfigStoragePVC
 	Client    coreset.CoreV1Interface
+	Batch     batchset.BatchV1Interface
 }
 
 func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *rest.Config) (*driver, error) {
@@ -43,11 +47,16 @@ func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *res
 	if err != nil {
 		return nil, err
 	}
+	batchClient, err := batchset.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
 
 	return &driver{
 		Namespace: namespace,
 		Config:    c,
 		Client:    client,
+		Batch:     batchClient,
 	}, nil
 }
 
@@ -58,7 +67,7 @@ func (d *driver) CABundle() (string, bool, error) {
 func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "filesystem"},
-		envvar.EnvVar{Name: "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", Value: rootDirectory},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", Value: RootDirectory},
 	)
 	return
 }
@@ -75,7 +84,7 @@ func (d *driver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
 
 	mount := corev1.VolumeMount{
 		Name:      vol.Name,
-		MountPath: rootDirectory,
+		MountPath: RootDirectory,
 	}
 
 	return []corev1.Volume{vol}, []corev1.VolumeMount{mount}, nil
@@ -89,7 +98,8 @@ func (d *driver) Secrets() (map[string]string, error) {
 	return nil, nil
 }
 
-func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (exists bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if len(d.Config.Claim) != 0 {
 		_, err := d.Client.PersistentVolumeClaims(d.Namespace).Get(
 			context.TODO(), d.Config.Claim, metav1.GetOptions{},
@@ -112,7 +122,8 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "PVC Configuration Changed", "PVC storage is in an old state")
 		return true
 	}
-	return false
+	// The health probe of the claim is run by CreateStorage.
+	return healthProbeChanged(cr)
 }
 
 func (d *driver) checkPVC(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) (err error) {
@@ -129,7 +140,9 @@ func (d *driver) checkPVC(cr *imageregistryv1.Config, claim *corev1.PersistentVo
 
 	// We allow using RWO PV backend, but it has some limitations:
 	// 1. Image registry rollout strategy must be set to Recreate (default is RollingUpdate).
-	// 2. It's not possible to use more than 1 replica of the image registry.
+	// 2. It's not possible to use more than 1 replica of the image registry,
+	//    nor to let an autoscaler start more.
+	// 3. A surge replica can't be started, it can't mount the claim.
 
 	// RWX backends are accepted with no additional conditions.
 	rwoModeEnabled := false
@@ -147,6 +160,26 @@ func (d *driver) checkPVC(cr *imageregistryv1.Config, claim *corev1.PersistentVo
 			return fmt.Errorf("cannot use %s access mode with more than one replica of the image registry", corev1.ReadWriteOnce)
 		}
 
+		configOverrides, err := overrides.Parse(cr)
+		if err != nil {
+			return err
+		}
+		autoscaler, err := configOverrides.Autoscaler(cr.Spec.Replicas)
+		if err != nil {
+			return err
+		}
+		if autoscaler != nil && autoscaler.MaxReplicas > 1 {
+			return fmt.Errorf("cannot use %s access mode with an autoscaler that can start %d replicas of the image registry", corev1.ReadWriteOnce, autoscaler.MaxReplicas)
+		}
+
+		_, maxSurge, err := configOverrides.RollingUpdate()
+		if err != nil {
+			return err
+		}
+		if surge, _ := intstr.GetScaledValueFromIntOrPercent(maxSurge, 100, true); surge > 0 {
+			return fmt.Errorf("cannot use %s access mode with maxSurge %s, the surge replica can't mount the claim", corev1.ReadWriteOnce, maxSurge.String())
+		}
+
 		if cr.Spec.RolloutStrategy != string(appsv1.RecreateDeploymentStrategyType) {
 			return fmt.Errorf("cannot use %s access mode with %s rollout strategy", corev1.ReadWriteOnce, cr.Spec.RolloutStrategy)
 		}
@@ -183,11 +216,9 @@ func (d *driver) createPVC(cr *imageregistryv1.Config) (*corev1.PersistentVolume
 	)
 }
 
-func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
-	var (
-		err   error
-		claim *corev1.PersistentVolumeClaim
-	)
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
+	var claim *corev1.PersistentVolumeClaim
 
 	managementState := imageregistryv1.StorageManagementStateUnmanaged
 	if len(d.Config.Claim) == 0 {
@@ -229,6 +260,16 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		cr.Spec.Storage.ManagementState = managementState
 	}
 
+	if claim != nil && cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		if err := d.syncBackupLabel(cr, claim); err != nil {
+			return err
+		}
+	}
+
+	if err := d.syncHealthProbe(cr); err != nil {
+		return err
+	}
+
 	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 		PVC: d.Config.DeepCopy(),
 	}
@@ -237,7 +278,39 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
+// syncBackupLabel excludes the claim created by the operator from cluster
+// backups if the backup policy of the registry is Exclude.
+func (d *driver) syncBackupLabel(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) error {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	policy, err := configOverrides.BackupPolicy()
+	if err != nil {
+		return err
+	}
+	exclude := policy == overrides.BackupPolicyExclude
+	if _, labeled := claim.Labels[defaults.BackupExcludeLabel]; labeled == exclude {
+		return nil
+	}
+
+	claim = claim.DeepCopy()
+	if exclude {
+		if claim.Labels == nil {
+			claim.Labels = map[string]string{}
+		}
+		claim.Labels[defaults.BackupExcludeLabel] = "true"
+	} else {
+		delete(claim.Labels, defaults.BackupExcludeLabel)
+	}
+	_, err = d.Client.PersistentVolumeClaims(d.Namespace).Update(
+		context.TODO(), claim, metav1.UpdateOptions{},
+	)
+	return err
+}
+
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retriable bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged ||
 		len(d.Config.Claim) == 0 {
 		return false, nil
@@ -262,3 +335,26 @@ func pvcIsCreatedByOperator(claim *corev1.PersistentVolumeClaim) (exist bool) {
 func (d *driver) ID() string {
 	return d.Config.Claim
 }
+
+// Capabilities returns the capabilities of PVC storage. The replicas share
+// the claim, provided it can be mounted by all of them (ReadWriteMany).
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiWriterSafe: true,
+	}
+}
+
+// classifyError returns err as a util.StorageError when its kind is known.
+func classifyError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return util.NewStorageError(util.ErrorKindNotFound, err)
+	case errors.IsForbidden(err), errors.IsUnauthorized(err):
+		return util.NewStorageError(util.ErrorKindPermissionDenied, err)
+	case errors.IsTooManyRequests(err), errors.IsServiceUnavailable(err):
+		return util.NewStorageError(util.ErrorKindThrottled, err)
+	case errors.IsInvalid(err), errors.IsBadRequest(err):
+		return util.NewStorageError(util.ErrorKindInvalidConfig, err)
+	}
+	return util.ClassifyError(err, 0)
+}
@@ -1,17 +1,21 @@
 package pvc
 
 import (
+	"context"
 	"strings"
 	"testing"
 
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestStorageManagementState(t *testing.T) {
@@ -184,6 +188,39 @@ func TestStorageManagementState(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "user custom pvc (read write once with autoscaler)",
+			err:  "cannot use ReadWriteOnce access mode with an autoscaler",
+			config: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Replicas:        1,
+					RolloutStrategy: "Recreate",
+					OperatorSpec: operatorv1.OperatorSpec{
+						UnsupportedConfigOverrides: runtime.RawExtension{
+							Raw: []byte(`{"autoscaling":{"maxReplicas":3}}`),
+						},
+					},
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+							Claim: "user-provided-pvc",
+						},
+					},
+				},
+			},
+			objects: []runtime.Object{
+				&corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "openshift-image-registry",
+						Name:      "user-provided-pvc",
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{
+							corev1.ReadWriteOnce,
+						},
+					},
+				},
+			},
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			cliset := fake.NewSimpleClientset()
@@ -219,3 +256,148 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestBackupExcludeLabel(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		labels    map[string]string
+		expected  bool
+	}{
+		{
+			name:     "no backup policy",
+			expected: false,
+		},
+		{
+			name:      "exclude",
+			overrides: `{"backup": {"policy": "Exclude"}}`,
+			expected:  true,
+		},
+		{
+			name:     "label removed when the policy is unset",
+			labels:   map[string]string{defaults.BackupExcludeLabel: "true"},
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cliset := fake.NewSimpleClientset(&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "openshift-image-registry",
+					Name:      defaults.PVCImageRegistryName,
+					Labels:    tt.labels,
+					Annotations: map[string]string{
+						PVCOwnerAnnotation: "true",
+					},
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteMany,
+					},
+				},
+			})
+
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{},
+					},
+				},
+			}
+			config.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := &driver{
+				Namespace: "openshift-image-registry",
+				Config:    config.Spec.Storage.PVC,
+				Client:    cliset.CoreV1(),
+			}
+			if err := drv.CreateStorage(config); err != nil {
+				t.Fatal(err)
+			}
+
+			claim, err := cliset.CoreV1().PersistentVolumeClaims("openshift-image-registry").Get(
+				context.Background(), defaults.PVCImageRegistryName, metav1.GetOptions{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, labeled := claim.Labels[defaults.BackupExcludeLabel]; labeled != tt.expected {
+				t.Errorf("expected the claim to be labeled %t, got labels %v", tt.expected, claim.Labels)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	expected := util.Capabilities{
+		MultiWriterSafe: true,
+	}
+	if caps := (&driver{}).Capabilities(); caps != expected {
+		t.Errorf("expected PVC storage capabilities %+v, got %+v", expected, caps)
+	}
+}
+
+func TestSyncHealthProbe(t *testing.T) {
+	ctx := context.Background()
+	cliset := fake.NewSimpleClientset()
+	cr := &imageregistryv1.Config{}
+	cr.Spec.Storage.PVC = &imageregistryv1.ImageRegistryConfigStoragePVC{Claim: "nfs-claim"}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"storage":{"pvc":{"healthProbe":{"enabled":true,"timeoutSeconds":30}}}}`)
+	healthProbes = healthProbeSchedule{}
+
+	drv := &driver{
+		Namespace: "openshift-image-registry",
+		Config:    cr.Spec.Storage.PVC,
+		Client:    cliset.CoreV1(),
+		Batch:     cliset.BatchV1(),
+	}
+	jobs := cliset.BatchV1().Jobs("openshift-image-registry")
+
+	if !healthProbeChanged(cr) {
+		t.Fatal("expected a probe to be due")
+	}
+	if err := drv.syncHealthProbe(cr); err != nil {
+		t.Fatal(err)
+	}
+	job, err := jobs.Get(ctx, defaults.StorageHealthProbeJobName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the probe job to be created: %v", err)
+	}
+	if claim := job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != "nfs-claim" {
+		t.Errorf("expected the job to mount nfs-claim, got %s", claim)
+	}
+	if *job.Spec.ActiveDeadlineSeconds != 30 {
+		t.Errorf("expected the job to time out after 30s, got %d", *job.Spec.ActiveDeadlineSeconds)
+	}
+
+	job.Status.Conditions = []batchv1.JobCondition{{
+		Type:   batchv1.JobFailed,
+		Status: corev1.ConditionTrue,
+		Reason: batchv1.JobReasonDeadlineExceeded,
+	}}
+	if _, err := jobs.UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !healthProbeChanged(cr) {
+		t.Fatal("expected the running probe to be checked")
+	}
+	if err := drv.syncHealthProbe(cr); err != nil {
+		t.Fatal(err)
+	}
+	if cond := util.FetchCondition(cr, defaults.StorageDegraded); cond.Status != operatorv1.ConditionTrue {
+		t.Errorf("expected the storage to be degraded, got %#v", cond)
+	}
+	if _, err := jobs.Get(ctx, defaults.StorageHealthProbeJobName, metav1.GetOptions{}); err == nil {
+		t.Error("expected the finished probe job to be deleted")
+	}
+	if healthProbeChanged(cr) {
+		t.Error("expected the next probe to wait for the interval")
+	}
+
+	cr.Spec.UnsupportedConfigOverrides.Raw = nil
+	if err := drv.syncHealthProbe(cr); err != nil {
+		t.Fatal(err)
+	}
+	if cond := util.FetchCondition(cr, defaults.StorageDegraded); cond.Type != "" {
+		t.Errorf("expected the condition to be removed, got %#v", cond)
+	}
+}
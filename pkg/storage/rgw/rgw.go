@@ -0,0 +1,145 @@
+// Package rgw provisions the registry bucket on Ceph RADOS Gateway through an
+// ObjectBucketClaim, as OpenShift Data Foundation and Rook provide buckets to
+// applications. RGW is S3 compatible, the registry uses the bucket with the
+// S3 storage driver.
+package rgw
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	kubeset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// ObjectBucketClaimGVR is the resource of the ObjectBucketClaims.
+var ObjectBucketClaimGVR = schema.GroupVersionResource{
+	Group:    "objectbucket.io",
+	Version:  "v1alpha1",
+	Resource: "objectbucketclaims",
+}
+
+const (
+	// provisionerSuffix is the suffix of the Ceph bucket provisioners, such
+	// as openshift-storage.ceph.rook.io/bucket.
+	provisionerSuffix = ".ceph.rook.io/bucket"
+
+	// defaultRegion is the region of the bucket when the provisioner does
+	// not set one, RGW accepts any region but the S3 clients require one.
+	defaultRegion = "us-east-1"
+
+	// phaseBound is the phase of a claim once its bucket is created.
+	phaseBound = "Bound"
+)
+
+// Bucket is a bucket provisioned for a claim.
+type Bucket struct {
+	Name     string
+	Endpoint string
+	Region   string
+}
+
+// DiscoverStorageClass returns the storage class of the Ceph bucket
+// provisioner. The default storage class is preferred when there are several.
+func DiscoverStorageClass(ctx context.Context, client kubeset.Interface) (string, error) {
+	list, err := client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	found := ""
+	for _, sc := range list.Items {
+		if !strings.HasSuffix(sc.Provisioner, provisionerSuffix) {
+			continue
+		}
+		if sc.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+			return sc.Name, nil
+		}
+		if found == "" {
+			found = sc.Name
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("no storage class of a Ceph bucket provisioner (*%s) found", provisionerSuffix)
+	}
+	return found, nil
+}
+
+// EnsureClaim creates the claim if it does not exist, and returns true once it
+// is bound.
+func EnsureClaim(ctx context.Context, client dynamic.Interface, namespace, name, storageClassName string) (bool, error) {
+	claims := client.Resource(ObjectBucketClaimGVR).Namespace(namespace)
+	claim, err := claims.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		claim = &unstructured.Unstructured{}
+		claim.SetGroupVersionKind(ObjectBucketClaimGVR.GroupVersion().WithKind("ObjectBucketClaim"))
+		claim.SetNamespace(namespace)
+		claim.SetName(name)
+		claim.Object["spec"] = map[string]interface{}{
+			"generateBucketName": name,
+			"storageClassName":   storageClassName,
+		}
+		if claim, err = claims.Create(ctx, claim, metav1.CreateOptions{}); err != nil {
+			return false, err
+		}
+		klog.Infof("ObjectBucketClaim %s/%s created with the storage class %s", namespace, name, storageClassName)
+	} else if err != nil {
+		return false, err
+	}
+
+	phase, _, err := unstructured.NestedString(claim.Object, "status", "phase")
+	if err != nil {
+		return false, err
+	}
+	return phase == phaseBound, nil
+}
+
+// DeleteClaim deletes the claim. The bucket is deleted or kept according to
+// the reclaim policy of the storage class of the claim.
+func DeleteClaim(ctx context.Context, client dynamic.Interface, namespace, name string) error {
+	err := client.Resource(ObjectBucketClaimGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// BucketFromConfigMap returns the bucket described by the config map the
+// provisioner creates for a bound claim.
+func BucketFromConfigMap(cm *corev1.ConfigMap) (*Bucket, error) {
+	name := cm.Data["BUCKET_NAME"]
+	host := cm.Data["BUCKET_HOST"]
+	if name == "" || host == "" {
+		return nil, fmt.Errorf("config map %s/%s does not contain BUCKET_NAME and BUCKET_HOST", cm.Namespace, cm.Name)
+	}
+
+	scheme := "http"
+	port := cm.Data["BUCKET_PORT"]
+	if port == "443" {
+		scheme = "https"
+	}
+	endpoint := scheme + "://" + host
+	if port != "" && port != "80" && port != "443" {
+		endpoint = scheme + "://" + net.JoinHostPort(host, port)
+	}
+
+	region := cm.Data["BUCKET_REGION"]
+	if region == "" {
+		region = defaultRegion
+	}
+	return &Bucket{Name: name, Endpoint: endpoint, Region: region}, nil
+}
+
+// CredentialsKeys maps the keys of the secret the provisioner creates for a
+// bound claim to the keys the S3 storage driver reads the credentials from.
+var CredentialsKeys = map[string]string{
+	"AWS_ACCESS_KEY_ID":     "REGISTRY_STORAGE_S3_ACCESSKEY",
+	"AWS_SECRET_ACCESS_KEY": "REGISTRY_STORAGE_S3_SECRETKEY",
+}
@@ -0,0 +1,153 @@
+package rgw
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscoverStorageClass(t *testing.T) {
+	client := kubefake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "gp3-csi"},
+			Provisioner: "ebs.csi.aws.com",
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "ocs-storagecluster-ceph-rgw"},
+			Provisioner: "openshift-storage.ceph.rook.io/bucket",
+		},
+	)
+	name, err := DiscoverStorageClass(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "ocs-storagecluster-ceph-rgw" {
+		t.Errorf("got storage class %q, want ocs-storagecluster-ceph-rgw", name)
+	}
+
+	if _, err := DiscoverStorageClass(context.Background(), kubefake.NewSimpleClientset()); err == nil {
+		t.Error("expected an error without a Ceph bucket provisioner")
+	}
+}
+
+func TestEnsureClaim(t *testing.T) {
+	ctx := context.Background()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ObjectBucketClaimGVR: "ObjectBucketClaimList",
+	})
+
+	bound, err := EnsureClaim(ctx, client, "openshift-image-registry", "image-registry-bucket", "ocs-storagecluster-ceph-rgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bound {
+		t.Error("a new claim must not be bound")
+	}
+
+	claims := client.Resource(ObjectBucketClaimGVR).Namespace("openshift-image-registry")
+	claim, err := claims.Get(ctx, "image-registry-bucket", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc, _, _ := unstructured.NestedString(claim.Object, "spec", "storageClassName"); sc != "ocs-storagecluster-ceph-rgw" {
+		t.Errorf("got storage class %q, want ocs-storagecluster-ceph-rgw", sc)
+	}
+
+	if err := unstructured.SetNestedField(claim.Object, "Bound", "status", "phase"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := claims.Update(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	bound, err = EnsureClaim(ctx, client, "openshift-image-registry", "image-registry-bucket", "ocs-storagecluster-ceph-rgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bound {
+		t.Error("the claim is bound")
+	}
+
+	if err := DeleteClaim(ctx, client, "openshift-image-registry", "image-registry-bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteClaim(ctx, client, "openshift-image-registry", "image-registry-bucket"); err != nil {
+		t.Errorf("deleting a missing claim: %v", err)
+	}
+}
+
+func TestBucketFromConfigMap(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data map[string]string
+		want *Bucket
+	}{
+		{
+			name: "service endpoint",
+			data: map[string]string{
+				"BUCKET_NAME": "image-registry-1a2b3c",
+				"BUCKET_HOST": "rook-ceph-rgw-ocs-storagecluster-cephobjectstore.openshift-storage.svc",
+				"BUCKET_PORT": "80",
+			},
+			want: &Bucket{
+				Name:     "image-registry-1a2b3c",
+				Endpoint: "http://rook-ceph-rgw-ocs-storagecluster-cephobjectstore.openshift-storage.svc",
+				Region:   "us-east-1",
+			},
+		},
+		{
+			name: "tls endpoint",
+			data: map[string]string{
+				"BUCKET_NAME":   "image-registry-1a2b3c",
+				"BUCKET_HOST":   "rgw.example.com",
+				"BUCKET_PORT":   "443",
+				"BUCKET_REGION": "eu",
+			},
+			want: &Bucket{
+				Name:     "image-registry-1a2b3c",
+				Endpoint: "https://rgw.example.com",
+				Region:   "eu",
+			},
+		},
+		{
+			name: "custom port",
+			data: map[string]string{
+				"BUCKET_NAME": "image-registry-1a2b3c",
+				"BUCKET_HOST": "10.0.0.1",
+				"BUCKET_PORT": "8080",
+			},
+			want: &Bucket{
+				Name:     "image-registry-1a2b3c",
+				Endpoint: "http://10.0.0.1:8080",
+				Region:   "us-east-1",
+			},
+		},
+		{
+			name: "not provisioned",
+			data: map[string]string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := BucketFromConfigMap(&corev1.ConfigMap{Data: tc.data})
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("expected an error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tc.want {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package s3
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// acceleratedBucketName matches the bucket names that can be used with
+// Transfer Acceleration: DNS compliant names without periods.
+var acceleratedBucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// ValidateAccelerate checks that Transfer Acceleration can be used with the
+// S3 storage cfg. It is only available on AWS, and the bucket name, when it
+// is set, must not contain periods.
+func ValidateAccelerate(cfg *imageregistryv1.ImageRegistryConfigStorageS3, preset overrides.StoragePreset) error {
+	if cfg == nil {
+		return fmt.Errorf("transfer acceleration requires spec.storage.s3")
+	}
+	if cfg.RegionEndpoint != "" || preset != "" {
+		return fmt.Errorf("transfer acceleration is only available on AWS, it cannot be used with the regionEndpoint %q", cfg.RegionEndpoint)
+	}
+	if cfg.Bucket != "" && !acceleratedBucketName.MatchString(cfg.Bucket) {
+		return fmt.Errorf("the bucket name %q cannot be used with transfer acceleration, it must be DNS compliant and must not contain periods", cfg.Bucket)
+	}
+	return nil
+}
+
+// SetAccelerate makes the registry use the Transfer Acceleration endpoint
+// of the bucket.
+func (d *driver) SetAccelerate(accelerate bool) {
+	d.accelerate = accelerate
+}
+
+// applyAccelerate checks that Transfer Acceleration is available on the
+// bucket when it is requested, and enables it on a managed bucket. The
+// registry switches to the accelerated endpoint once the
+// StorageAccelerationEnabled condition is true. Acceleration is suspended
+// on a managed bucket when it is not requested anymore.
+func (d *driver) applyAccelerate(cr *imageregistryv1.Config, svc *s3.Client, accelerate, managed bool) {
+	if !accelerate {
+		if util.FetchCondition(cr, defaults.StorageAccelerationEnabled).Type == "" {
+			return
+		}
+		if managed {
+			_, err := svc.PutBucketAccelerateConfiguration(d.Context, &s3.PutBucketAccelerateConfigurationInput{
+				Bucket: aws.String(d.Config.Bucket),
+				AccelerateConfiguration: &s3types.AccelerateConfiguration{
+					Status: s3types.BucketAccelerateStatusSuspended,
+				},
+			})
+			if err != nil {
+				reportAccelerateError(cr, err)
+				return
+			}
+			klog.Infof("transfer acceleration of the S3 bucket %s suspended", d.Config.Bucket)
+		}
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageAccelerationEnabled)
+		return
+	}
+
+	if err := ValidateAccelerate(d.Config, d.preset); err != nil {
+		util.UpdateCondition(cr, defaults.StorageAccelerationEnabled, operatorapi.ConditionFalse, "Acceleration Not Supported", err.Error())
+		return
+	}
+
+	if managed {
+		_, err := svc.PutBucketAccelerateConfiguration(d.Context, &s3.PutBucketAccelerateConfigurationInput{
+			Bucket: aws.String(d.Config.Bucket),
+			AccelerateConfiguration: &s3types.AccelerateConfiguration{
+				Status: s3types.BucketAccelerateStatusEnabled,
+			},
+		})
+		if err != nil {
+			reportAccelerateError(cr, err)
+			return
+		}
+		util.UpdateCondition(cr, defaults.StorageAccelerationEnabled, operatorapi.ConditionTrue, "Enable Acceleration Successful", "Transfer acceleration is enabled on the S3 bucket")
+		return
+	}
+
+	output, err := svc.GetBucketAccelerateConfiguration(d.Context, &s3.GetBucketAccelerateConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		reportAccelerateError(cr, err)
+		return
+	}
+	if output.Status != s3types.BucketAccelerateStatusEnabled {
+		util.UpdateCondition(cr, defaults.StorageAccelerationEnabled, operatorapi.ConditionFalse, "Acceleration Not Enabled", fmt.Sprintf("Transfer acceleration is not enabled on the S3 bucket %s, it is not managed by the operator", d.Config.Bucket))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageAccelerationEnabled, operatorapi.ConditionTrue, "Acceleration Available", "Transfer acceleration is enabled on the S3 bucket")
+}
+
+func reportAccelerateError(cr *imageregistryv1.Config, err error) {
+	if code, ok := apiErrorCode(err); ok {
+		util.UpdateCondition(cr, defaults.StorageAccelerationEnabled, operatorapi.ConditionFalse, code, err.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StorageAccelerationEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// accelerationChanged returns true if the requested Transfer Acceleration
+// is not known to be available yet, or if it is not requested anymore.
+func accelerationChanged(cr *imageregistryv1.Config) bool {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return false
+	}
+	cond := util.FetchCondition(cr, defaults.StorageAccelerationEnabled)
+	if !configOverrides.S3Accelerate() {
+		return cond.Type != ""
+	}
+	return cond.Status != operatorapi.ConditionTrue
+}
@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// addressingProbeRetryInterval is the time after which a failed probe of the
+// addressing style is run again.
+const addressingProbeRetryInterval = 5 * time.Minute
+
+// addressingProbes remembers the result of the last probe of the addressing
+// style.
+var addressingProbes addressingProbeCache
+
+// addressingProbeCache holds in memory the addressing style detected for a
+// bucket on a custom endpoint. It is lost when the operator restarts, which
+// only causes a new probe.
+type addressingProbeCache struct {
+	mtx           sync.Mutex
+	endpoint      string
+	bucket        string
+	virtualHosted bool
+	err           error
+	last          time.Time
+}
+
+// get returns the result of the last probe of the bucket on endpoint, ok is
+// false if the bucket has to be probed again.
+func (c *addressingProbeCache) get(endpoint, bucket string) (virtualHosted, ok bool, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.endpoint != endpoint || c.bucket != bucket {
+		return false, false, nil
+	}
+	if c.err != nil && time.Since(c.last) >= addressingProbeRetryInterval {
+		return false, false, nil
+	}
+	return c.virtualHosted, true, c.err
+}
+
+// set records the result of a probe of the bucket on endpoint.
+func (c *addressingProbeCache) set(endpoint, bucket string, virtualHosted bool, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.endpoint = endpoint
+	c.bucket = bucket
+	c.virtualHosted = virtualHosted
+	c.err = err
+	c.last = time.Now()
+}
+
+// addressingStyleName returns the name of an addressing style for messages.
+func addressingStyleName(virtualHosted bool) string {
+	if virtualHosted {
+		return "virtual-hosted style"
+	}
+	return "path-style"
+}
+
+// probeAddressingStyle sends HeadBucket requests to the custom endpoint,
+// first with virtual-hosted style and then with path-style, and returns the
+// first style that reaches the bucket.
+func (d *driver) probeAddressingStyle() (bool, error) {
+	cfg, err := d.getConfig()
+	if err != nil {
+		return false, err
+	}
+	var errs []error
+	for _, virtualHosted := range []bool{true, false} {
+		svc := s3.NewFromConfig(cfg, d.endpointsResolver.s3Options(false, !virtualHosted), func(o *s3.Options) {
+			// a wrong style fails the same way on every attempt.
+			o.Retryer = aws.NopRetryer{}
+		})
+		_, err := svc.HeadBucket(d.Context, &s3.HeadBucketInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		if err == nil {
+			return virtualHosted, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addressingStyleName(virtualHosted), err))
+	}
+	return false, errors.Join(errs...)
+}
+
+// applyAddressingStyle sets spec.storage.s3.virtualHostedStyle as requested
+// by the addressing style of the overrides. With Auto the custom endpoint is
+// probed, and the detected style is reported by the
+// StorageAddressingStyleDetected condition. A failed probe leaves the
+// configured style unchanged. Without an addressing style, a preset uses
+// path-style.
+func (d *driver) applyAddressingStyle(cr *imageregistryv1.Config) {
+	spec := cr.Spec.Storage.S3
+	style := ""
+	if spec != nil && spec.RegionEndpoint != "" {
+		configOverrides, err := overrides.Parse(cr)
+		if err != nil {
+			return
+		}
+		if style, err = configOverrides.S3AddressingStyle(); err != nil {
+			return
+		}
+		if style == "" && d.preset != "" {
+			style = overrides.S3AddressingStylePath
+		}
+	}
+
+	var virtualHosted bool
+	switch style {
+	case overrides.S3AddressingStylePath, overrides.S3AddressingStyleVirtualHosted:
+		virtualHosted = style == overrides.S3AddressingStyleVirtualHosted
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageAddressingStyleDetected)
+	case overrides.S3AddressingStyleAuto:
+		if spec.Bucket == "" {
+			// the bucket is probed once it has a name.
+			return
+		}
+		var err error
+		var ok bool
+		virtualHosted, ok, err = addressingProbes.get(spec.RegionEndpoint, spec.Bucket)
+		if !ok {
+			virtualHosted, err = d.probeAddressingStyle()
+			addressingProbes.set(spec.RegionEndpoint, spec.Bucket, virtualHosted, err)
+			if err != nil {
+				klog.Warningf("unable to detect the addressing style of the S3 endpoint %s: %v", spec.RegionEndpoint, err)
+			}
+		}
+		if err != nil {
+			util.UpdateCondition(cr, defaults.StorageAddressingStyleDetected, operatorapi.ConditionFalse, "Probe Failed", fmt.Sprintf("Neither virtual-hosted style nor path-style requests reach the bucket %s on %s, keeping virtualHostedStyle %t: %v", spec.Bucket, spec.RegionEndpoint, spec.VirtualHostedStyle, err))
+			return
+		}
+		util.UpdateCondition(cr, defaults.StorageAddressingStyleDetected, operatorapi.ConditionTrue, "Probe Successful", fmt.Sprintf("The bucket %s is reachable with %s requests on %s", spec.Bucket, addressingStyleName(virtualHosted), spec.RegionEndpoint))
+	default:
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageAddressingStyleDetected)
+		return
+	}
+
+	spec.VirtualHostedStyle = virtualHosted
+	if d.Config != nil {
+		d.Config.VirtualHostedStyle = virtualHosted
+	}
+}
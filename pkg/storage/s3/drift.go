@@ -0,0 +1,211 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// driftReasonChanged is the reason of the conditions of the settings
+	// found changed out-of-band and left as they are.
+	driftReasonChanged = "Changed Out-of-Band"
+	// driftReasonRestored is the reason of the conditions of the settings
+	// found changed out-of-band and restored by the operator.
+	driftReasonRestored = "Restored After Change"
+)
+
+// driftChecks remembers when the settings of the bucket were last checked.
+var driftChecks driftCheckSchedule
+
+// driftCheckSchedule holds in memory the time of the last check of the
+// settings of a bucket. It is lost when the operator restarts, which only
+// causes an early check.
+type driftCheckSchedule struct {
+	mtx    sync.Mutex
+	bucket string
+	last   time.Time
+}
+
+// due returns true if the settings of the bucket were not checked during the
+// last interval.
+func (s *driftCheckSchedule) due(bucket string, interval time.Duration) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.bucket != bucket {
+		return true
+	}
+	return time.Since(s.last) >= interval
+}
+
+// done records that the settings of the bucket have just been checked.
+func (s *driftCheckSchedule) done(bucket string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.bucket = bucket
+	s.last = time.Now()
+}
+
+// bucketDrift describes the changes found on the settings of a bucket. A
+// setting that is as the operator applied it has an empty description.
+type bucketDrift struct {
+	// checked is true if the settings were read by this reconciliation.
+	checked           bool
+	encryption        string
+	publicAccessBlock string
+}
+
+// detectDrift reads the default encryption and the public access block of the
+// bucket when a check is due, and compares them with the settings the
+// operator applies. A failed check is logged and retried at the next
+// interval, it does not prevent the reconciliation of the bucket.
+func (d *driver) detectDrift(svc *s3.Client, detection *overrides.S3DriftDetection, features *overrides.S3ManagedFeatures) bucketDrift {
+	var drift bucketDrift
+	if detection == nil || !driftChecks.due(d.Config.Bucket, time.Duration(detection.IntervalSeconds)*time.Second) {
+		return drift
+	}
+	defer driftChecks.done(d.Config.Bucket)
+
+	if features.ManagesPublicAccessBlock() {
+		out, err := svc.GetPublicAccessBlock(d.Context, &s3.GetPublicAccessBlockInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		if code, ok := apiErrorCode(err); ok && code == "NoSuchPublicAccessBlockConfiguration" {
+			drift.publicAccessBlock = "The public access block of the S3 bucket was removed out-of-band"
+		} else if err != nil {
+			klog.Errorf("unable to check the public access block of the S3 bucket %s: %v", d.Config.Bucket, err)
+			return bucketDrift{}
+		} else {
+			drift.publicAccessBlock = publicAccessBlockDrift(out.PublicAccessBlockConfiguration)
+		}
+	}
+
+	if features.ManagesEncryption() {
+		out, err := svc.GetBucketEncryption(d.Context, &s3.GetBucketEncryptionInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		if code, ok := apiErrorCode(err); ok && code == "ServerSideEncryptionConfigurationNotFoundError" {
+			drift.encryption = "The default encryption of the S3 bucket was removed out-of-band"
+		} else if err != nil {
+			klog.Errorf("unable to check the default encryption of the S3 bucket %s: %v", d.Config.Bucket, err)
+			return bucketDrift{}
+		} else {
+			drift.encryption = encryptionDrift(out.ServerSideEncryptionConfiguration, d.Config.KeyID)
+		}
+	}
+
+	drift.checked = true
+	if drift.publicAccessBlock != "" {
+		klog.Warningf("S3 bucket %s: %s", d.Config.Bucket, drift.publicAccessBlock)
+	}
+	if drift.encryption != "" {
+		klog.Warningf("S3 bucket %s: %s", d.Config.Bucket, drift.encryption)
+	}
+	return drift
+}
+
+// publicAccessBlockDrift describes the settings of the public access block
+// that are not enabled anymore.
+func publicAccessBlockDrift(config *s3types.PublicAccessBlockConfiguration) string {
+	if config == nil {
+		return "The public access block of the S3 bucket was removed out-of-band"
+	}
+	var disabled []string
+	for _, setting := range []struct {
+		name    string
+		enabled *bool
+	}{
+		{"BlockPublicAcls", config.BlockPublicAcls},
+		{"IgnorePublicAcls", config.IgnorePublicAcls},
+		{"BlockPublicPolicy", config.BlockPublicPolicy},
+		{"RestrictPublicBuckets", config.RestrictPublicBuckets},
+	} {
+		if !aws.ToBool(setting.enabled) {
+			disabled = append(disabled, setting.name)
+		}
+	}
+	if len(disabled) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("The public access block of the S3 bucket was changed out-of-band, %s disabled", strings.Join(disabled, ", "))
+}
+
+// encryptionDrift describes how the default encryption of the bucket differs
+// from the one the operator applies: SSE-KMS with keyID, or SSE-S3 if keyID
+// is empty.
+func encryptionDrift(config *s3types.ServerSideEncryptionConfiguration, keyID string) string {
+	var current *s3types.ServerSideEncryptionByDefault
+	if config != nil {
+		for _, rule := range config.Rules {
+			if rule.ApplyServerSideEncryptionByDefault != nil {
+				current = rule.ApplyServerSideEncryptionByDefault
+				break
+			}
+		}
+	}
+	if current == nil {
+		return "The default encryption of the S3 bucket was removed out-of-band"
+	}
+
+	expected := s3types.ServerSideEncryptionAes256
+	if keyID != "" {
+		expected = s3types.ServerSideEncryptionAwsKms
+	}
+	if current.SSEAlgorithm != expected {
+		return fmt.Sprintf("The default encryption of the S3 bucket was changed out-of-band from %s to %s", expected, current.SSEAlgorithm)
+	}
+	if keyID != "" && !sameKMSKey(keyID, aws.ToString(current.KMSMasterKeyID)) {
+		return fmt.Sprintf("The KMS key of the default encryption of the S3 bucket was changed out-of-band from %s to %q", keyID, aws.ToString(current.KMSMasterKeyID))
+	}
+	return ""
+}
+
+// sameKMSKey returns true if a and b name the same KMS key, either of them may
+// be the ARN of the key and the other its ID.
+func sameKMSKey(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "/"+b) || strings.HasSuffix(b, "/"+a)
+}
+
+// keepsChange returns true if the operator has to leave a setting that was
+// changed out-of-band as it is. Changes are only reported unless remediation
+// is enabled, and they stay reported until a check finds the setting
+// restored.
+func keepsChange(cr *imageregistryv1.Config, conditionType string, detection *overrides.S3DriftDetection, drift bucketDrift, change string) bool {
+	if detection == nil || detection.Remediate {
+		return false
+	}
+	if drift.checked {
+		return change != ""
+	}
+	return util.FetchCondition(cr, conditionType).Reason == driftReasonChanged
+}
+
+// driftCheckDue returns true if the settings of the managed bucket have to be
+// checked for out-of-band changes.
+func driftCheckDue(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged || cr.Status.Storage.S3 == nil {
+		return false
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return false
+	}
+	detection, err := configOverrides.S3DriftDetection()
+	if err != nil || detection == nil {
+		return false
+	}
+	return driftChecks.due(cr.Status.Storage.S3.Bucket, time.Duration(detection.IntervalSeconds)*time.Second)
+}
@@ -0,0 +1,23 @@
+package s3
+
+import (
+	"errors"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// classifyError returns err as a util.StorageError when its kind is known.
+func classifyError(err error) error {
+	if code, ok := apiErrorCode(err); ok {
+		if kind, ok := util.ErrorKindForS3Code(code); ok {
+			return util.NewStorageError(kind, err)
+		}
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return util.ClassifyError(err, respErr.HTTPStatusCode())
+	}
+	return util.ClassifyError(err, 0)
+}
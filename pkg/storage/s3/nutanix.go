@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	kcorelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// Nutanix Objects is an S3 compatible object store. Nutanix clusters have no
+// cloud credential operator support for it and the platform status doesn't
+// advertise it, so the endpoint is provided together with the access keys in
+// the user provided secret.
+
+// nutanixObjectsRegion is the region requested from Nutanix Objects, it
+// accepts any region but the S3 clients require one.
+const nutanixObjectsRegion = "us-east-1"
+
+// NutanixObjectsEndpoint returns the Nutanix Objects endpoint from the user
+// provided secret, or an empty string if it isn't configured.
+func NutanixObjectsEndpoint(secrets kcorelisters.SecretNamespaceLister) (string, error) {
+	sec, err := secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if errors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return string(sec.Data[defaults.NutanixObjectsEndpointKey]), nil
+}
+
+// nutanixManagedFeatures disables by default the bucket settings that Nutanix
+// Objects doesn't implement. They can still be enabled explicitly.
+func nutanixManagedFeatures(features *overrides.S3ManagedFeatures) *overrides.S3ManagedFeatures {
+	f := &overrides.S3ManagedFeatures{
+		Encryption:        ptr.To(false),
+		PublicAccessBlock: ptr.To(false),
+		Tagging:           ptr.To(false),
+	}
+	if features == nil {
+		return f
+	}
+	if features.Encryption != nil {
+		f.Encryption = features.Encryption
+	}
+	if features.PublicAccessBlock != nil {
+		f.PublicAccessBlock = features.PublicAccessBlock
+	}
+	if features.Tagging != nil {
+		f.Tagging = features.Tagging
+	}
+	f.Lifecycle = features.Lifecycle
+	return f
+}
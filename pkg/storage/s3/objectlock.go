@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// objectLockConfiguration returns the Object Lock configuration of the
+// bucket, or nil if Object Lock is not enabled on it. Endpoints that do not
+// implement Object Lock are reported as not having it enabled.
+func (d *driver) objectLockConfiguration(svc *s3.Client) (*s3types.ObjectLockConfiguration, error) {
+	output, err := svc.GetObjectLockConfiguration(d.Context, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if code, ok := apiErrorCode(err); ok && (code == "ObjectLockConfigurationNotFoundError" || code == "NotImplemented") {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if output.ObjectLockConfiguration == nil || output.ObjectLockConfiguration.ObjectLockEnabled != s3types.ObjectLockEnabledEnabled {
+		return nil, nil
+	}
+	return output.ObjectLockConfiguration, nil
+}
+
+// objectLockMessage returns the message of the StorageObjectLockEnabled
+// condition for the configuration of a bucket with Object Lock.
+func objectLockMessage(config *s3types.ObjectLockConfiguration) string {
+	if config.Rule == nil || config.Rule.DefaultRetention == nil {
+		return "Object Lock is enabled on the S3 bucket without a default retention period"
+	}
+	retention := config.Rule.DefaultRetention
+	period := fmt.Sprintf("%d days", aws.ToInt32(retention.Days))
+	if retention.Years != nil {
+		period = fmt.Sprintf("%d years", aws.ToInt32(retention.Years))
+	}
+	return fmt.Sprintf("Object Lock is enabled on the S3 bucket, objects are retained for %s in %s mode", period, retention.Mode)
+}
+
+// objectLockRule returns the default retention rule requested for a managed
+// bucket.
+func objectLockRule(lock *overrides.S3ObjectLock) *s3types.ObjectLockRule {
+	return &s3types.ObjectLockRule{
+		DefaultRetention: &s3types.DefaultRetention{
+			Mode: s3types.ObjectLockRetentionModeGovernance,
+			Days: aws.Int32(lock.RetentionDays),
+		},
+	}
+}
+
+// applyObjectLock detects Object Lock on the bucket, and enables it with
+// the requested default retention on a managed bucket. Object Lock can not
+// be disabled once it has been enabled, the retention of a managed bucket is
+// left as it is when Object Lock is not requested anymore.
+func (d *driver) applyObjectLock(cr *imageregistryv1.Config, svc *s3.Client, lock *overrides.S3ObjectLock, managed bool) {
+	config, err := d.objectLockConfiguration(svc)
+	if err != nil {
+		reportObjectLockError(cr, err)
+		return
+	}
+
+	if lock == nil || !managed {
+		switch {
+		case config != nil:
+			util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionTrue, "Object Lock Detected", objectLockMessage(config))
+		case lock != nil:
+			util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionFalse, "Object Lock Not Available", fmt.Sprintf("Object Lock is not enabled on the S3 bucket %s, it is not managed by the operator", d.Config.Bucket))
+		default:
+			util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionFalse, "Object Lock Not Enabled", "Object Lock is not enabled on the S3 bucket")
+		}
+		return
+	}
+
+	rule := objectLockRule(lock)
+	if config != nil && config.Rule != nil && config.Rule.DefaultRetention != nil &&
+		config.Rule.DefaultRetention.Mode == rule.DefaultRetention.Mode &&
+		aws.ToInt32(config.Rule.DefaultRetention.Days) == lock.RetentionDays {
+		util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionTrue, "Enable Object Lock Successful", objectLockMessage(config))
+		return
+	}
+
+	if config == nil {
+		// Object Lock can only be enabled on a versioned bucket.
+		_, err := svc.PutBucketVersioning(d.Context, &s3.PutBucketVersioningInput{
+			Bucket: aws.String(d.Config.Bucket),
+			VersioningConfiguration: &s3types.VersioningConfiguration{
+				Status: s3types.BucketVersioningStatusEnabled,
+			},
+		})
+		if err != nil {
+			reportObjectLockError(cr, err)
+			return
+		}
+	}
+	config = &s3types.ObjectLockConfiguration{
+		ObjectLockEnabled: s3types.ObjectLockEnabledEnabled,
+		Rule:              rule,
+	}
+	_, err = svc.PutObjectLockConfiguration(d.Context, &s3.PutObjectLockConfigurationInput{
+		Bucket:                  aws.String(d.Config.Bucket),
+		ObjectLockConfiguration: config,
+	})
+	if err != nil {
+		reportObjectLockError(cr, err)
+		return
+	}
+	klog.Infof("object lock of the S3 bucket %s configured with a retention of %d days", d.Config.Bucket, lock.RetentionDays)
+	util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionTrue, "Enable Object Lock Successful", objectLockMessage(config))
+}
+
+func reportObjectLockError(cr *imageregistryv1.Config, err error) {
+	if code, ok := apiErrorCode(err); ok {
+		util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionFalse, code, err.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StorageObjectLockEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// objectLocked returns true if Object Lock was found on the bucket.
+func objectLocked(cr *imageregistryv1.Config) bool {
+	return util.FetchCondition(cr, defaults.StorageObjectLockEnabled).Status == operatorapi.ConditionTrue
+}
+
+// objectLockChanged returns true if the bucket was not checked for Object
+// Lock yet, or if the requested Object Lock is not enabled yet.
+func objectLockChanged(cr *imageregistryv1.Config) bool {
+	cond := util.FetchCondition(cr, defaults.StorageObjectLockEnabled)
+	if cond.Type == "" {
+		return true
+	}
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return false
+	}
+	lock, err := configOverrides.S3ObjectLockRetention()
+	if err != nil || lock == nil {
+		return false
+	}
+	return cond.Status != operatorapi.ConditionTrue || cond.Message != objectLockMessage(&s3types.ObjectLockConfiguration{Rule: objectLockRule(lock)})
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+)
+
+// s3Preset holds what an on-prem object store expects beyond the settings
+// that all presets share: path-style requests on the regionEndpoint, version
+// 4 signatures and no dual-stack endpoints.
+type s3Preset struct {
+	// requireTLS is set for the stores that only serve their S3 API over
+	// HTTPS.
+	requireTLS bool
+	// encryption is set for the stores that support server-side encryption
+	// without an external key management service.
+	encryption bool
+}
+
+var s3Presets = map[overrides.StoragePreset]s3Preset{
+	overrides.StoragePresetMinIO:             {},
+	overrides.StoragePresetCephRGW:           {},
+	overrides.StoragePresetNetAppStorageGRID: {requireTLS: true, encryption: true},
+	overrides.StoragePresetQuobyte:           {},
+}
+
+// ValidatePreset checks that the S3 storage cfg can be configured by preset,
+// with the addressing style of the overrides.
+func ValidatePreset(preset overrides.StoragePreset, cfg *imageregistryv1.ImageRegistryConfigStorageS3, addressingStyle string) error {
+	p, ok := s3Presets[preset]
+	if !ok {
+		return fmt.Errorf("unknown storage preset %q", preset)
+	}
+	if cfg == nil {
+		return fmt.Errorf("the %s preset requires spec.storage.s3", preset)
+	}
+	if cfg.RegionEndpoint == "" {
+		return fmt.Errorf("the %s preset requires spec.storage.s3.regionEndpoint", preset)
+	}
+	endpoint, err := url.Parse(cfg.RegionEndpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return fmt.Errorf("the regionEndpoint %q of the %s preset must be an http or https URL", cfg.RegionEndpoint, preset)
+	}
+	if p.requireTLS && endpoint.Scheme != "https" {
+		return fmt.Errorf("%s serves its S3 API over HTTPS, the regionEndpoint %q must be an https URL", preset, cfg.RegionEndpoint)
+	}
+	if cfg.Encrypt && !p.encryption {
+		return fmt.Errorf("%s does not support server-side encryption without a key management service, spec.storage.s3.encrypt must be false", preset)
+	}
+	if cfg.VirtualHostedStyle || addressingStyle == overrides.S3AddressingStyleVirtualHosted {
+		return fmt.Errorf("the %s preset uses path-style requests, virtual-hosted style cannot be used", preset)
+	}
+	return nil
+}
+
+// SetPreset sets the on-prem product behind the custom endpoint, the driver
+// and the registry are configured for it.
+func (d *driver) SetPreset(preset overrides.StoragePreset) {
+	d.preset = preset
+}
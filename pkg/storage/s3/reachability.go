@@ -0,0 +1,118 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// reachabilityTimeout is how long the operator waits for the S3 endpoint
+// to answer the reachability check.
+const reachabilityTimeout = 10 * time.Second
+
+// privateNetworkHint is appended to the messages of the network errors.
+const privateNetworkHint = "in a private cluster, check that the VPC has an S3 gateway endpoint associated with the route tables of the nodes, or that the cluster proxy allows the endpoint"
+
+// reachability is the result of the reachability check of the S3 endpoint.
+type reachability struct {
+	status  operatorapi.ConditionStatus
+	reason  string
+	message string
+}
+
+// endpointHost returns the host the request that failed with err was sent
+// to, or "the S3 endpoint" if it is not known.
+func endpointHost(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.Request != nil {
+		return respErr.Response.Request.URL.Host
+	}
+	return "the S3 endpoint"
+}
+
+// checkReachability returns whether the result of a HEAD request to the
+// bucket shows that the S3 endpoint can be reached. Any answer of S3, even
+// an error, means that the endpoint is reachable, except a denied access
+// that may come from the policy of a VPC endpoint.
+func checkReachability(err error) reachability {
+	if err == nil {
+		return reachability{operatorapi.ConditionTrue, "EndpointReachable", "The S3 endpoint can be reached from the operator"}
+	}
+
+	host := endpointHost(err)
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certErr *tls.CertificateVerificationError
+	var respErr *smithyhttp.ResponseError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return reachability{operatorapi.ConditionFalse, "EndpointNotResolvable", fmt.Sprintf("Unable to resolve %s, check the DNS resolution of the VPC; %s: %s", host, privateNetworkHint, err)}
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &certErr):
+		return reachability{operatorapi.ConditionFalse, "EndpointCertificateInvalid", fmt.Sprintf("The certificate of %s is not trusted, a proxy or an interface endpoint may need its CA in the trusted CA bundle of the cluster: %s", host, err)}
+	case errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden:
+		return reachability{operatorapi.ConditionFalse, "EndpointAccessDenied", fmt.Sprintf("%s denied the access to the bucket, check that the IAM policy of the credentials and the policy of the S3 VPC endpoint, if any, allow it: %s", host, err)}
+	case errors.As(err, &respErr):
+		return reachability{operatorapi.ConditionTrue, "EndpointReachable", fmt.Sprintf("The S3 endpoint %s can be reached from the operator", host)}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return reachability{operatorapi.ConditionFalse, "EndpointTimeout", fmt.Sprintf("%s did not answer within %s; %s", host, reachabilityTimeout, privateNetworkHint)}
+	default:
+		return reachability{operatorapi.ConditionFalse, "EndpointUnreachable", fmt.Sprintf("Unable to connect to %s; %s: %s", host, privateNetworkHint, err)}
+	}
+}
+
+// applyReachabilityCheck sends a HEAD request to the bucket, without
+// retries, and reports whether the S3 endpoint can be reached in the
+// StorageNetworkReachable condition when the check is requested.
+func (d *driver) applyReachabilityCheck(cr *imageregistryv1.Config) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil || !configOverrides.S3ReachabilityCheck() {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageNetworkReachable)
+		return
+	}
+	if len(d.Config.Bucket) == 0 {
+		return
+	}
+
+	svc, err := d.getS3Service()
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageNetworkReachable, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(d.Context, reachabilityTimeout)
+	defer cancel()
+	_, err = svc.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	}, func(o *s3.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+
+	result := checkReachability(err)
+	util.UpdateCondition(cr, defaults.StorageNetworkReachable, result.status, result.reason, result.message)
+}
@@ -5,37 +5,46 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/endpoints"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	smithymiddleware "github.com/aws/smithy-go/middleware"
 	"golang.org/x/net/http/httpproxy"
 	"golang.org/x/net/http2"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapi "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 	"github.com/openshift/cluster-image-registry-operator/pkg/version"
 )
@@ -43,8 +52,16 @@ import (
 const (
 	imageRegistrySecretMountpoint = "/var/run/secrets/cloud"
 	imageRegistrySecretDataKey    = "credentials"
+
+	// bucketWaitTimeout is how long the operator waits for a bucket to be
+	// created or deleted.
+	bucketWaitTimeout = 100 * time.Second
 )
 
+// endpointsResolver resolves the custom service endpoints of the cluster.
+// The S3 endpoint is set on the S3 clients, so that the SDK still builds the
+// bucket URLs, the endpoints of the other services (STS for the web identity
+// and the federation tokens) are resolved for the whole AWS configuration.
 type endpointsResolver struct {
 	region           string
 	serviceEndpoints map[string]string
@@ -66,37 +83,75 @@ func newEndpointsResolver(region, s3Endpoint string, endpoints []configv1.AWSSer
 	}
 }
 
-func (er *endpointsResolver) EndpointFor(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
-	if ep, ok := er.serviceEndpoints[service]; ok {
-		// The signing region and the cluster region may be different, see
-		// https://github.com/openshift/installer/commit/41a15b787b5f6d0b0766e1737dcdfeb5b23020d5
-		signingRegion := er.region
-		def, _ := endpoints.DefaultResolver().EndpointFor(service, region)
-		if len(def.SigningRegion) > 0 {
-			signingRegion = def.SigningRegion
+// ResolveEndpoint returns the custom endpoint of service, the clients fall
+// back to their default endpoints when aws.EndpointNotFoundError is returned.
+func (er *endpointsResolver) ResolveEndpoint(service, region string, options ...interface{}) (aws.Endpoint, error) {
+	if service != s3.ServiceID {
+		if ep, ok := er.serviceEndpoints[strings.ToLower(service)]; ok {
+			// The signing region and the cluster region may be different, see
+			// https://github.com/openshift/installer/commit/41a15b787b5f6d0b0766e1737dcdfeb5b23020d5
+			signingRegion := er.region
+			if resolver, ok := defaultEndpointResolvers[strings.ToLower(service)]; ok {
+				def, _ := resolver(region)
+				if len(def.SigningRegion) > 0 {
+					signingRegion = def.SigningRegion
+				}
+			} else if len(region) > 0 {
+				signingRegion = region
+			}
+			return aws.Endpoint{
+				URL:           ep,
+				SigningRegion: signingRegion,
+			}, nil
 		}
-		return endpoints.ResolvedEndpoint{
-			URL:           ep,
-			SigningRegion: signingRegion,
-		}, nil
 	}
-	return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	return aws.Endpoint{}, &aws.EndpointNotFoundError{}
 }
 
-func isUnknownEndpointError(err error) bool {
-	_, ok := err.(endpoints.UnknownEndpointError)
-	return ok
+// defaultEndpointResolvers resolve the default endpoints of the services the
+// operator calls besides S3, with the signing regions of the partition
+// metadata of the SDK.
+var defaultEndpointResolvers = map[string]func(region string) (aws.Endpoint, error){
+	"sts": func(region string) (aws.Endpoint, error) {
+		return sts.NewDefaultEndpointResolver().ResolveEndpoint(region, sts.EndpointResolverOptions{})
+	},
 }
 
-func regionHasDualStackS3(region string) (bool, error) {
-	_, err := endpoints.DefaultResolver().EndpointFor("s3", region, endpoints.UseDualStackEndpointOption)
-	if isUnknownEndpointError(err) {
-		return false, nil
+// s3Options configures the endpoint of the S3 clients. Dual-stack endpoints
+// are only used with the default endpoints of the region, path-style requests
+// only with a custom endpoint.
+func (er *endpointsResolver) s3Options(useDualStack, usePathStyle bool) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if ep, ok := er.serviceEndpoints["s3"]; ok {
+			o.BaseEndpoint = aws.String(ep)
+			o.UsePathStyle = usePathStyle
+			return
+		}
+		if useDualStack {
+			o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
 	}
-	if err != nil {
-		return false, err
+}
+
+// partitionForRegion returns the partition of region used in the ARNs of its
+// resources, from the partition metadata of the SDK. Unknown regions are in
+// the commercial partition.
+func partitionForRegion(region string) string {
+	ep, err := s3.NewDefaultEndpointResolver().ResolveEndpoint(region, s3.EndpointResolverOptions{})
+	if err != nil || ep.PartitionID == "" {
+		return "aws"
 	}
-	return true, nil
+	return ep.PartitionID
+}
+
+// regionHasDualStackS3 returns true if the S3 endpoints of region can be
+// reached over IPv6, that is if the partition metadata of the SDK has a
+// dual-stack endpoint for the region.
+func regionHasDualStackS3(region string) bool {
+	_, err := s3.NewDefaultEndpointResolver().ResolveEndpoint(region, s3.EndpointResolverOptions{
+		UseDualStackEndpoint: aws.DualStackEndpointStateEnabled,
+	})
+	return err == nil
 }
 
 type driver struct {
@@ -108,6 +163,15 @@ type driver struct {
 	// account the cluster configuration.
 	endpointsResolver *endpointsResolver
 
+	// removal controls how RemoveStorage deletes the objects.
+	removal util.RemovalOptions
+
+	// preset is the on-prem product behind the custom endpoint.
+	preset overrides.StoragePreset
+
+	// accelerate makes the registry use the Transfer Acceleration endpoint.
+	accelerate bool
+
 	// roundTripper is used only during tests.
 	roundTripper http.RoundTripper
 
@@ -143,6 +207,17 @@ func (d *driver) UpdateEffectiveConfig() error {
 
 	var clusterRegion, clusterRegionEndpoint string
 	var clusterServiceEndpoints []configv1.AWSServiceEndpoint
+	virtualHostedStyle := true
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Type == configv1.NutanixPlatformType {
+		clusterRegion = nutanixObjectsRegion
+		clusterRegionEndpoint, err = NutanixObjectsEndpoint(d.Listers.Secrets)
+		if err != nil {
+			return err
+		}
+		// Nutanix Objects buckets are not resolvable as subdomains of
+		// the endpoint unless the DNS is configured for it.
+		virtualHostedStyle = false
+	}
 	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Type == configv1.AWSPlatformType {
 		clusterRegion = infra.Status.PlatformStatus.AWS.Region
 		clusterServiceEndpoints = infra.Status.PlatformStatus.AWS.ServiceEndpoints
@@ -160,7 +235,7 @@ func (d *driver) UpdateEffectiveConfig() error {
 		effectiveConfig.Region = clusterRegion
 		effectiveConfig.RegionEndpoint = clusterRegionEndpoint
 		if len(effectiveConfig.RegionEndpoint) != 0 {
-			effectiveConfig.VirtualHostedStyle = true
+			effectiveConfig.VirtualHostedStyle = virtualHostedStyle
 		}
 	}
 
@@ -181,12 +256,10 @@ func (d *driver) UpdateEffectiveConfig() error {
 //
 // defer os.Remove(sharedCredentialsFile)
 //
-//	options := session.Options{
-//		SharedConfigState: session.SharedConfigEnable,
-//		SharedConfigFiles: []string{sharedCredentialsFile},
-//	}
-//
-// sess := session.Must(session.NewSessionWithOptions(options))
+//	cfg, err := config.LoadDefaultConfig(ctx,
+//		config.WithSharedConfigFiles([]string{sharedCredentialsFile}),
+//		config.WithSharedCredentialsFiles([]string{sharedCredentialsFile}),
+//	)
 func (d *driver) GetCredentialsFile() (string, error) {
 	data, err := d.getCredentialsConfigData()
 	if err != nil {
@@ -196,38 +269,78 @@ func (d *driver) GetCredentialsFile() (string, error) {
 	return saveSharedCredentialsFile(data)
 }
 
-func (d *driver) getCredentialsConfigData() ([]byte, error) {
-	// Look for a user defined secret to get the AWS credentials from first
-	sec, err := d.Listers.Secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
-	if err != nil && errors.IsNotFound(err) {
-		// Fall back to those provided by the credential minter if nothing is provided by the user
-		sec, err = d.Listers.Secrets.Get(defaults.CloudCredentialsName)
-		if err != nil {
-			return nil, fmt.Errorf("unable to get cluster minted credentials %q: %v", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.CloudCredentialsName), err)
+// TokenFile returns the web identity token file that is used to assume the
+// role of the registry when the cluster uses AWS STS.
+func (d *driver) TokenFile() (string, error) {
+	data, err := d.getCredentialsConfigData()
+	if err != nil {
+		return "", err
+	}
+	return webIdentityTokenFile(data), nil
+}
+
+// webIdentityTokenFile returns the value of web_identity_token_file from the
+// shared credentials data.
+func webIdentityTokenFile(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == "web_identity_token_file" {
+			return strings.TrimSpace(value)
 		}
+	}
+	return ""
+}
+
+func (d *driver) getCredentialsConfigData() ([]byte, error) {
+	data, _, err := d.credentialsConfigData()
+	return data, err
+}
+
+// CredentialsPath returns the credentials the registry is configured with.
+func (d *driver) CredentialsPath() (util.CredentialsPath, error) {
+	_, path, err := d.credentialsConfigData()
+	return path, err
+}
+
+// clusterCredentialsUsable returns true if the cluster minted secret has
+// valid shared credentials data with a readable web identity token.
+func clusterCredentialsUsable(sec *corev1.Secret) bool {
+	data, err := sharedCredentialsDataFromSecret(sec)
+	return err == nil && util.TokenFileReadable(webIdentityTokenFile(data))
+}
 
+func (d *driver) credentialsConfigData() ([]byte, util.CredentialsPath, error) {
+	// Look for a user defined secret to get the AWS credentials from first,
+	// fall back to those provided by the credential minter if nothing is
+	// provided by the user
+	sec, path, err := util.CredentialsSecret(d.Listers.Secrets, clusterCredentialsUsable, time.Now())
+	if err != nil && path.Source == util.CredentialsSourceCluster {
+		return nil, path, fmt.Errorf("unable to get cluster minted credentials %q: %v", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.CloudCredentialsName), err)
+	} else if err != nil {
+		return nil, path, err
+	}
+
+	if path.Source == util.CredentialsSourceCluster {
 		data, err := sharedCredentialsDataFromSecret(sec)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate shared secrets data: %v", err)
-		}
-		return data, nil
-	} else if err != nil {
-		return nil, err
-	} else {
-		var accessKey, secretKey string
-		if v, ok := sec.Data["REGISTRY_STORAGE_S3_ACCESSKEY"]; ok {
-			accessKey = string(v)
-		} else {
-			return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_ACCESSKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
-		}
-		if v, ok := sec.Data["REGISTRY_STORAGE_S3_SECRETKEY"]; ok {
-			secretKey = string(v)
-		} else {
-			return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_SECRETKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
+			return nil, path, fmt.Errorf("failed to generate shared secrets data: %v", err)
 		}
+		return data, path, nil
+	}
 
-		return sharedCredentialsDataFromStaticCreds(accessKey, secretKey), nil
+	var accessKey, secretKey string
+	if v, ok := sec.Data["REGISTRY_STORAGE_S3_ACCESSKEY"]; ok {
+		accessKey = string(v)
+	} else {
+		return nil, path, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_ACCESSKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
 	}
+	if v, ok := sec.Data["REGISTRY_STORAGE_S3_SECRETKEY"]; ok {
+		secretKey = string(v)
+	} else {
+		return nil, path, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_SECRETKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
+	}
+
+	return sharedCredentialsDataFromStaticCreds(accessKey, secretKey), path, nil
 }
 
 // CABundle gets the custom CA bundle for trusting communication with the AWS
@@ -247,7 +360,7 @@ func (d *driver) CABundle() (string, bool, error) {
 
 	cloudConfig, err := d.Listers.OpenShiftConfigManaged.Get(defaults.KubeCloudConfigName)
 	switch {
-	case errors.IsNotFound(err):
+	case kerrors.IsNotFound(err):
 		// No cloud config, so no custom CA bundle.
 		return "", true, nil
 	case err != nil:
@@ -262,41 +375,54 @@ func (d *driver) CABundle() (string, bool, error) {
 }
 
 // useDualStack returns true if the driver should use dual-stack endpoints
-func (d *driver) useDualStack() (bool, error) {
-	if d.Config.RegionEndpoint != "" {
-		return true, nil
+func (d *driver) useDualStack() bool {
+	if d.preset != "" {
+		// the on-prem products have no dual-stack endpoints.
+		return false
 	}
-	ok, err := regionHasDualStackS3(d.Config.Region)
-	if err != nil {
-		return false, fmt.Errorf("failed to determine if region %s has dual stack S3: %w", d.Config.Region, err)
+	if d.Config.RegionEndpoint != "" {
+		return true
 	}
-	return ok, nil
+	return regionHasDualStackS3(d.Config.Region)
 }
 
 // getS3Service returns a client that allows us to interact
 // with the aws S3 service
-func (d *driver) getS3Service() (*s3.S3, error) {
-	credentialsFilename, err := d.GetCredentialsFile()
+func (d *driver) getS3Service() (*s3.Client, error) {
+	cfg, err := d.getConfig()
 	if err != nil {
 		return nil, err
 	}
+	usePathStyle := len(d.Config.RegionEndpoint) > 0 && !d.Config.VirtualHostedStyle
+	return s3.NewFromConfig(cfg, d.endpointsResolver.s3Options(d.useDualStack(), usePathStyle)), nil
+}
+
+// getConfig returns the configuration of the AWS clients with the
+// credentials and the endpoints of the registry storage. The clients use
+// adaptive retries, which also slow down the requests when AWS throttles
+// them.
+func (d *driver) getConfig() (aws.Config, error) {
+	credentialsFilename, err := d.GetCredentialsFile()
+	if err != nil {
+		return aws.Config{}, err
+	}
 	defer os.Remove(credentialsFilename)
 
 	err = d.UpdateEffectiveConfig()
 	if err != nil {
-		return nil, err
+		return aws.Config{}, err
 	}
 
 	userCABundle, useSystemCertPool, err := d.CABundle()
 	if err != nil {
-		return nil, fmt.Errorf("unable to get S3 CA bundle: %w", err)
+		return aws.Config{}, fmt.Errorf("unable to get S3 CA bundle: %w", err)
 	}
 
 	var rootCAs *x509.CertPool
 	if useSystemCertPool {
 		rootCAs, err = x509.SystemCertPool()
 		if err != nil {
-			return nil, fmt.Errorf("unable to load system root CA bundle: %w", err)
+			return aws.Config{}, fmt.Errorf("unable to load system root CA bundle: %w", err)
 		}
 	} else {
 		rootCAs = x509.NewCertPool()
@@ -325,74 +451,59 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 
 	err = http2.ConfigureTransport(tr)
 	if err != nil {
-		return nil, fmt.Errorf("unable to configure http2 transport: %w", err)
+		return aws.Config{}, fmt.Errorf("unable to configure http2 transport: %w", err)
 	}
 
 	// A custom HTTPClient is used here since the default HTTPClients ProxyFromEnvironment
 	// uses a cache which won't let us update the proxy env vars
-	awsOptions := session.Options{
-		Config: aws.Config{
-			Region: &d.Config.Region,
-			HTTPClient: &http.Client{
-				Transport: tr,
-			},
-		},
-		SharedConfigState: session.SharedConfigEnable,
-		SharedConfigFiles: []string{credentialsFilename},
+	httpClient := &http.Client{
+		Transport: tr,
 	}
 
 	if d.roundTripper != nil {
-		awsOptions.Config.HTTPClient.Transport = d.roundTripper
-	}
+		httpClient.Transport = d.roundTripper
+	}
+
+	// The credentials file may configure static keys or a web identity,
+	// it is read when the configuration is loaded.
+	return awsconfig.LoadDefaultConfig(d.Context,
+		awsconfig.WithRegion(d.Config.Region),
+		awsconfig.WithSharedConfigFiles([]string{credentialsFilename}),
+		awsconfig.WithSharedCredentialsFiles([]string{credentialsFilename}),
+		awsconfig.WithHTTPClient(httpClient),
+		awsconfig.WithEndpointResolverWithOptions(d.endpointsResolver),
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return retry.NewAdaptiveMode()
+		}),
+		awsconfig.WithAPIOptions([]func(*smithymiddleware.Stack) error{
+			awsmiddleware.AddUserAgentKeyValue("openshift.io cluster-image-registry-operator", version.Version),
+		}),
+	)
+}
 
-	useDualStack, err := d.useDualStack()
-	if err != nil {
-		return nil, err
-	}
-	if useDualStack {
-		awsOptions.Config.WithUseDualStack(true)
+// apiErrorCode returns the code of the AWS API error err.
+func apiErrorCode(err error) (string, bool) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode(), true
 	}
+	return "", false
+}
 
-	if d.Config.RegionEndpoint != "" {
-		if !d.Config.VirtualHostedStyle {
-			awsOptions.Config.WithS3ForcePathStyle(true)
-		}
-	}
-
-	awsOptions.Config.WithEndpointResolver(d.endpointsResolver)
-
-	sess, err := session.NewSessionWithOptions(awsOptions)
-	if err != nil {
-		return nil, err
+// recordOperation records an operation on the bucket in the storage audit
+// trail, with the ID S3 gave to the request.
+func recordOperation(operation, bucket string, metadata smithymiddleware.Metadata, err error) {
+	requestID, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		requestID = respErr.ServiceRequestID()
 	}
-	sess.Handlers.Build.PushBackNamed(request.NamedHandler{
-		Name: "openshift.io/cluster-image-registry-operator",
-		Fn:   request.MakeAddToUserAgentHandler("openshift.io cluster-image-registry-operator", version.Version),
-	})
-
-	return s3.New(sess), nil
+	util.RecordStorageOperation(operation, "s3://"+bucket, requestID, err)
 }
 
-func isBucketNotFound(err interface{}) bool {
-	switch s3Err := err.(type) {
-	case awserr.Error:
-		if s3Err.Code() == "NoSuchBucket" {
-			return true
-		}
-		origErr := s3Err.OrigErr()
-		if origErr != nil {
-			return isBucketNotFound(origErr)
-		}
-	case s3manager.Error:
-		if s3Err.OrigErr != nil {
-			return isBucketNotFound(s3Err.OrigErr)
-		}
-	case s3manager.Errors:
-		if len(s3Err) == 1 {
-			return isBucketNotFound(s3Err[0])
-		}
-	}
-	return false
+func isBucketNotFound(err error) bool {
+	code, ok := apiErrorCode(err)
+	return ok && code == "NoSuchBucket"
 }
 
 // ConfigEnv configures the environment variables that will be
@@ -447,14 +558,18 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_CREDENTIALSCONFIGPATH", Value: filepath.Join(imageRegistrySecretMountpoint, imageRegistrySecretDataKey)},
 	)
 
-	useDualStack, err := d.useDualStack()
-	if err != nil {
-		return nil, err
-	}
-	if useDualStack {
+	if d.useDualStack() {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_USEDUALSTACK", Value: true})
 	}
 
+	if d.preset != "" {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_V4AUTH", Value: true})
+	}
+
+	if d.accelerate {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_ACCELERATE", Value: true})
+	}
+
 	if d.Config.CloudFront != nil {
 		// Use structs to make ordering deterministic
 		type cloudFrontOptions struct {
@@ -573,26 +688,169 @@ func (d *driver) bucketExists(bucketName string) error {
 		return err
 	}
 
-	_, err = svc.HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+	_, err = svc.HeadBucket(d.Context, &s3.HeadBucketInput{
 		Bucket: aws.String(bucketName),
 	})
 
 	return err
 }
 
+// createBucketInput returns the request that creates bucket in region.
+// Buckets outside of us-east-1 need the region as their location constraint.
+func createBucketInput(bucket, region string) *s3.CreateBucketInput {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	}
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(region),
+		}
+	}
+	return input
+}
+
+// probeObjectInput returns the request that uploads the probe object key
+// the way the registry uploads its objects.
+func (d *driver) probeObjectInput(cr *imageregistryv1.Config, key string) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(key),
+	}
+	// uploads to a bucket with Object Lock must have a checksum.
+	if objectLocked(cr) {
+		input.ChecksumAlgorithm = s3types.ChecksumAlgorithmSha256
+	}
+	// the bucket policy may require the encryption the registry uses.
+	if d.Config.Encrypt {
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAes256
+		if len(d.Config.KeyID) != 0 {
+			input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+			input.SSEKMSKeyId = aws.String(d.Config.KeyID)
+		}
+	}
+	return input
+}
+
+// ProbeWrite writes a small object to the bucket and deletes it.
+func (d *driver) ProbeWrite(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
+	svc, err := d.getS3Service()
+	if err != nil {
+		return err
+	}
+
+	if _, err := svc.PutObject(d.Context, d.probeObjectInput(cr, util.WriteProbeObject)); err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteObject(d.Context, &s3.DeleteObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(util.WriteProbeObject),
+	})
+	return err
+}
+
+// Validate writes the object util.ValidationProbeObject to the bucket, reads
+// it back and deletes it, the way the registry uses the bucket.
+func (d *driver) Validate(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
+	svc, err := d.getS3Service()
+	if err != nil {
+		return err
+	}
+
+	if _, err := svc.PutObject(d.Context, d.probeObjectInput(cr, util.ValidationProbeObject)); err != nil {
+		return fmt.Errorf("unable to write the object %s: %w", util.ValidationProbeObject, err)
+	}
+
+	output, err := svc.GetObject(d.Context, &s3.GetObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(util.ValidationProbeObject),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read the object %s: %w", util.ValidationProbeObject, err)
+	}
+	data, err := io.ReadAll(output.Body)
+	output.Body.Close()
+	if err != nil {
+		return fmt.Errorf("unable to read the object %s: %w", util.ValidationProbeObject, err)
+	}
+	if string(data) != util.ValidationProbeObject {
+		return fmt.Errorf("the object %s read from the bucket does not match the object written to it", util.ValidationProbeObject)
+	}
+
+	_, err = svc.DeleteObject(d.Context, &s3.DeleteObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(util.ValidationProbeObject),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete the object %s: %w", util.ValidationProbeObject, err)
+	}
+	return nil
+}
+
+// SignURL returns a pre-signed URL that downloads the object key of the
+// bucket, like the URLs the registry redirects the blob downloads to.
+func (d *driver) SignURL(key string, expiry time.Duration) (string, error) {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return "", err
+	}
+	req, err := s3.NewPresignClient(svc).PresignGetObject(d.Context, &s3.GetObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// StorageUsage returns the total size and the number of the objects of the
+// bucket.
+func (d *driver) StorageUsage() (usage util.Usage, err error) {
+	defer func() { err = classifyError(err) }()
+	if len(d.Config.Bucket) == 0 {
+		return usage, fmt.Errorf("the S3 bucket is not configured")
+	}
+	svc, err := d.getS3Service()
+	if err != nil {
+		return usage, err
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(svc, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(d.Context)
+		if err != nil {
+			return usage, err
+		}
+		for _, obj := range page.Contents {
+			usage.Bytes += aws.ToInt64(obj.Size)
+			usage.Objects++
+		}
+	}
+	return usage, nil
+}
+
 // StorageExists checks if an S3 bucket with the given name exists
 // and we can access it
-func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (exists bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if len(d.Config.Bucket) == 0 {
 		return false, nil
 	}
 
-	err := d.bucketExists(d.Config.Bucket)
+	d.applyReachabilityCheck(cr)
+
+	err = d.bucketExists(d.Config.Bucket)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case s3.ErrCodeNoSuchBucket, "Forbidden", "NotFound":
-				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+		if code, ok := apiErrorCode(err); ok {
+			switch code {
+			case "NoSuchBucket", "Forbidden", "NotFound":
+				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, code, err.Error())
 				return false, nil
 			}
 		}
@@ -607,17 +865,25 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 // StorageChanged checks to see if the name of the storage medium
 // has changed
 func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
+	// a new addressing style is written to the spec, and reaches the
+	// status through CreateStorage.
+	d.applyAddressingStyle(cr)
+
 	if !reflect.DeepEqual(cr.Status.Storage.S3, cr.Spec.Storage.S3) {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "S3 Configuration Changed", "S3 storage is in an unknown state")
 		return true
 	}
 
-	return false
+	// the lifecycle rules, the versioning and the Object Lock are configured by
+	// CreateStorage, it runs again until the requested settings are
+	// applied. It also checks the bucket for out-of-band changes.
+	return transitionsChanged(cr) || versioningChanged(cr) || accelerationChanged(cr) || objectLockChanged(cr) || driftCheckDue(cr)
 }
 
 // CreateStorage attempts to create an s3 bucket
 // and apply any provided tags
-func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
 	svc, err := d.getS3Service()
 	if err != nil {
 		return err
@@ -632,17 +898,32 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return err
+	}
+	features := configOverrides.S3ManagedFeatures()
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Type == configv1.NutanixPlatformType {
+		features = nutanixManagedFeatures(features)
+	}
+	objectLock, err := configOverrides.S3ObjectLockRetention()
+	if err != nil {
+		return err
+	}
+
+	d.applyReachabilityCheck(cr)
+
 	// If a bucket name is supplied, and it already exists and we can access it
 	// just update the config
 	var bucketExists bool
 	if len(d.Config.Bucket) != 0 {
 		err = d.bucketExists(d.Config.Bucket)
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				case s3.ErrCodeNoSuchBucket, "Forbidden", "NotFound":
+			if code, ok := apiErrorCode(err); ok {
+				switch code {
+				case "NoSuchBucket", "Forbidden", "NotFound":
 					// If the bucket doesn't exist that's ok, we'll try to create it
-					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, code, err.Error())
 				default:
 					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
 					return err
@@ -680,13 +961,20 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				generatedName = true
 			}
 
-			_, err := svc.CreateBucketWithContext(d.Context, &s3.CreateBucketInput{
-				Bucket: aws.String(d.Config.Bucket),
-			})
+			input := createBucketInput(d.Config.Bucket, d.Config.Region)
+			if objectLock != nil {
+				input.ObjectLockEnabledForBucket = aws.Bool(true)
+			}
+			out, err := svc.CreateBucket(d.Context, input)
+			var metadata smithymiddleware.Metadata
+			if out != nil {
+				metadata = out.ResultMetadata
+			}
+			recordOperation("CreateBucket", d.Config.Bucket, metadata, err)
 			if err != nil {
-				if aerr, ok := err.(awserr.Error); ok {
-					switch aerr.Code() {
-					case s3.ErrCodeBucketAlreadyExists:
+				if code, ok := apiErrorCode(err); ok {
+					switch code {
+					case "BucketAlreadyExists":
 						if d.Config.Bucket != "" && !generatedName {
 							util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unable to Access Bucket", "The bucket exists, but we do not have permission to access it")
 							break
@@ -694,7 +982,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 						d.Config.Bucket = ""
 						continue
 					default:
-						util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+						util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, code, err.Error())
 						return err
 					}
 				}
@@ -718,21 +1006,44 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 
 	// Wait until the bucket exists
-	if err := svc.WaitUntilBucketExistsWithContext(d.Context, &s3.HeadBucketInput{
+	if err := s3.NewBucketExistsWaiter(svc).Wait(d.Context, &s3.HeadBucketInput{
 		Bucket: aws.String(d.Config.Bucket),
-	}); err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+	}, bucketWaitTimeout); err != nil {
+		if code, ok := apiErrorCode(err); ok {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, code, err.Error())
 		}
 
 		return err
 	}
 
+	managed := cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
+
+	// Look for out-of-band changes of the encryption and of the public
+	// access block before applying them again
+	detection, err := configOverrides.S3DriftDetection()
+	if err != nil {
+		return err
+	}
+	var drift bucketDrift
+	if managed {
+		drift = d.detectDrift(svc, detection, features)
+	}
+
 	// Block public access to the s3 bucket and its objects by default
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		_, err := svc.PutPublicAccessBlockWithContext(d.Context, &s3.PutPublicAccessBlockInput{
+	if managed && !features.ManagesPublicAccessBlock() {
+		externallyManaged(cr, defaults.StoragePublicAccessBlocked, "public access block")
+	} else if managed && keepsChange(cr, defaults.StoragePublicAccessBlocked, detection, drift, drift.publicAccessBlock) {
+		if drift.checked {
+			util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionFalse, driftReasonChanged, drift.publicAccessBlock)
+		}
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			S3: d.Config.DeepCopy(),
+		}
+		cr.Spec.Storage.S3 = d.Config.DeepCopy()
+	} else if managed {
+		_, err := svc.PutPublicAccessBlock(d.Context, &s3.PutPublicAccessBlockInput{
 			Bucket: aws.String(d.Config.Bucket),
-			PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
 				BlockPublicAcls:       aws.Bool(true),
 				BlockPublicPolicy:     aws.Bool(true),
 				IgnorePublicAcls:      aws.Bool(true),
@@ -741,11 +1052,13 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		})
 
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+			if code, ok := apiErrorCode(err); ok {
+				util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionFalse, code, err.Error())
 			} else {
 				util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
 			}
+		} else if drift.publicAccessBlock != "" {
+			util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionTrue, driftReasonRestored, drift.publicAccessBlock+", the operator restored it")
 		} else {
 			util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionTrue, "Public Access Block Successful", "Public access to the S3 bucket and its contents have been successfully blocked.")
 			cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
@@ -757,10 +1070,13 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 
 	// Tag the bucket with the openshiftClusterID
 	// along with any user defined tags from the cluster configuration
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+	if managed && !features.ManagesTagging() {
+		klog.Info("ignoring bucket tags, tagging is managed externally")
+		externallyManaged(cr, defaults.StorageTagged, "tagging")
+	} else if managed {
 		klog.Info("setting aws bucket tags")
 
-		tagset := []*s3.Tag{
+		tagset := []s3types.Tag{
 			{
 				Key:   aws.String("kubernetes.io/cluster/" + infra.Status.InfrastructureName),
 				Value: aws.String("owned"),
@@ -770,6 +1086,13 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				Value: aws.String(infra.Status.InfrastructureName + "-image-registry"),
 			},
 		}
+		metadata := util.ManagedMetadata(infra, cr)
+		for _, key := range []string{util.ManagedByKey, util.InfraIDKey, util.ConfigGenerationKey} {
+			tagset = append(tagset, s3types.Tag{
+				Key:   aws.String(key),
+				Value: aws.String(metadata[key]),
+			})
+		}
 
 		// at this stage we are not keeping user tags in sync. as per enhancement proposal
 		// we only set user provided tags when we created the bucket.
@@ -777,7 +1100,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 			klog.V(5).Infof("infra.Status has %d user provided tags", len(infra.Status.PlatformStatus.AWS.ResourceTags))
 			for _, tag := range infra.Status.PlatformStatus.AWS.ResourceTags {
 				klog.Infof("user provided bucket tag in infra.Status: %s: %s", tag.Key, tag.Value)
-				tagset = append(tagset, &s3.Tag{
+				tagset = append(tagset, s3types.Tag{
 					Key:   aws.String(tag.Key),
 					Value: aws.String(tag.Value),
 				})
@@ -785,15 +1108,15 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 		klog.V(5).Infof("tagging bucket with tags: %+v", tagset)
 
-		_, err := svc.PutBucketTaggingWithContext(d.Context, &s3.PutBucketTaggingInput{
+		_, err := svc.PutBucketTagging(d.Context, &s3.PutBucketTaggingInput{
 			Bucket: aws.String(d.Config.Bucket),
-			Tagging: &s3.Tagging{
+			Tagging: &s3types.Tagging{
 				TagSet: tagset,
 			},
 		})
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+			if code, ok := apiErrorCode(err); ok {
+				util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, code, err.Error())
 			} else {
 				util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
 			}
@@ -805,28 +1128,37 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 
 	// Enable default encryption on the bucket
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		var encryption *s3.ServerSideEncryptionByDefault
-		var encryptionType string
+	if managed && features.ManagesEncryption() && keepsChange(cr, defaults.StorageEncrypted, detection, drift, drift.encryption) {
+		if drift.checked {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, driftReasonChanged, drift.encryption)
+		}
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			S3: d.Config.DeepCopy(),
+		}
+		cr.Spec.Storage.S3 = d.Config.DeepCopy()
+	} else if managed && features.ManagesEncryption() {
+		var encryption *s3types.ServerSideEncryptionByDefault
+		var encryptionType s3types.ServerSideEncryption
 
 		if len(d.Config.KeyID) != 0 {
-			encryption = &s3.ServerSideEncryptionByDefault{
-				SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
+			encryption = &s3types.ServerSideEncryptionByDefault{
+				SSEAlgorithm:   s3types.ServerSideEncryptionAwsKms,
 				KMSMasterKeyID: aws.String(d.Config.KeyID),
 			}
-			encryptionType = s3.ServerSideEncryptionAwsKms
+			encryptionType = s3types.ServerSideEncryptionAwsKms
 		} else {
-			encryption = &s3.ServerSideEncryptionByDefault{
-				SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+			encryption = &s3types.ServerSideEncryptionByDefault{
+				SSEAlgorithm: s3types.ServerSideEncryptionAes256,
 			}
-			encryptionType = s3.ServerSideEncryptionAes256
+			encryptionType = s3types.ServerSideEncryptionAes256
 		}
 
 		enableBucketKey := true
-		_, err = svc.PutBucketEncryptionWithContext(d.Context, &s3.PutBucketEncryptionInput{
+		var out *s3.PutBucketEncryptionOutput
+		out, err = svc.PutBucketEncryption(d.Context, &s3.PutBucketEncryptionInput{
 			Bucket: aws.String(d.Config.Bucket),
-			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
-				Rules: []*s3.ServerSideEncryptionRule{
+			ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+				Rules: []s3types.ServerSideEncryptionRule{
 					{
 						ApplyServerSideEncryptionByDefault: encryption,
 						BucketKeyEnabled:                   &enableBucketKey,
@@ -834,14 +1166,23 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				},
 			},
 		})
+		var metadata smithymiddleware.Metadata
+		if out != nil {
+			metadata = out.ResultMetadata
+		}
+		recordOperation("PutBucketEncryption", d.Config.Bucket, metadata, err)
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+			if code, ok := apiErrorCode(err); ok {
+				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, code, err.Error())
 			} else {
 				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
 			}
 		} else {
-			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Successful", fmt.Sprintf("Default %s encryption was successfully enabled on the S3 bucket", encryptionType))
+			if drift.encryption != "" {
+				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, driftReasonRestored, drift.encryption+", the operator restored it")
+			} else {
+				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Successful", fmt.Sprintf("Default %s encryption was successfully enabled on the S3 bucket", encryptionType))
+			}
 			d.Config.Encrypt = true
 			cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 				S3: d.Config.DeepCopy(),
@@ -849,6 +1190,9 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 			cr.Spec.Storage.S3 = d.Config.DeepCopy()
 		}
 	} else {
+		if managed {
+			externallyManaged(cr, defaults.StorageEncrypted, "default encryption")
+		}
 		if !reflect.DeepEqual(cr.Status.Storage.S3, d.Config) {
 			cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 				S3: d.Config.DeepCopy(),
@@ -856,42 +1200,270 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
-	// Enable default incomplete multipart upload cleanup after one (1) day
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		_, err = svc.PutBucketLifecycleConfigurationWithContext(d.Context, &s3.PutBucketLifecycleConfigurationInput{
+	// Detect Object Lock, and enable it when it is requested in the
+	// overrides
+	d.applyObjectLock(cr, svc, objectLock, managed)
+
+	// Enable the versioning requested in the overrides. Versioning can not
+	// be suspended on a bucket with Object Lock.
+	versioning, err := configOverrides.S3Versioning()
+	if err != nil {
+		return err
+	}
+	if managed && versioning == nil && objectLocked(cr) {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageVersioningEnabled)
+	} else if managed {
+		d.applyVersioning(cr, svc, versioning, features.ManagesLifecycle())
+	}
+
+	// Enable or check the transfer acceleration requested in the overrides
+	d.applyAccelerate(cr, svc, configOverrides.S3Accelerate(), managed)
+
+	// Enable default incomplete multipart upload cleanup after one (1) day,
+	// along with the transitions of old blobs and the expiration of
+	// noncurrent versions requested in the overrides.
+	// The operator owns the whole lifecycle configuration of the bucket.
+	transitions, err := configOverrides.S3LifecycleRules()
+	if err != nil {
+		return err
+	}
+	if managed && !features.ManagesLifecycle() {
+		externallyManaged(cr, defaults.StorageIncompleteUploadCleanupEnabled, "lifecycle configuration")
+		if len(transitions) > 0 {
+			externallyManaged(cr, defaults.StorageLifecycleTransitionsEnabled, "lifecycle configuration")
+		}
+	} else if managed {
+		_, err = svc.PutBucketLifecycleConfiguration(d.Context, &s3.PutBucketLifecycleConfigurationInput{
 			Bucket: aws.String(d.Config.Bucket),
-			LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
-				Rules: []*s3.LifecycleRule{
-					{
-						ID:     aws.String("cleanup-incomplete-multipart-registry-uploads"),
-						Status: aws.String("Enabled"),
-						Filter: &s3.LifecycleRuleFilter{
-							Prefix: aws.String(""),
-						},
-						AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
-							DaysAfterInitiation: aws.Int64(1),
-						},
-					},
-				},
+			LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{
+				Rules: lifecycleRules(transitions, noncurrentVersionExpirationDays(versioning)),
 			},
 		})
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+			if code, ok := apiErrorCode(err); ok {
+				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, code, err.Error())
+				if len(transitions) > 0 {
+					util.UpdateCondition(cr, defaults.StorageLifecycleTransitionsEnabled, operatorapi.ConditionFalse, code, err.Error())
+				}
 			} else {
 				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+				if len(transitions) > 0 {
+					util.UpdateCondition(cr, defaults.StorageLifecycleTransitionsEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+				}
 			}
 		} else {
 			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionTrue, "Enable Cleanup Successful", "Default cleanup of incomplete multipart uploads after one (1) day was successfully enabled")
+			if len(transitions) > 0 {
+				util.UpdateCondition(cr, defaults.StorageLifecycleTransitionsEnabled, operatorapi.ConditionTrue, "Enable Transitions Successful", transitionsMessage(transitions))
+			}
 		}
 	}
+	if len(transitions) == 0 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageLifecycleTransitionsEnabled)
+	}
 
 	return nil
 }
 
+// blobsPrefix is the prefix of the objects holding the layers and the
+// manifests pushed to the registry.
+const blobsPrefix = "docker/registry/v2/blobs/"
+
+// lifecycleRules returns the lifecycle rules of a managed bucket: the cleanup
+// of incomplete multipart uploads and, if requested, the expiration of
+// noncurrent versions and the transitions of the blobs to other storage
+// classes.
+func lifecycleRules(transitions []overrides.S3LifecycleRule, noncurrentDays int32) []s3types.LifecycleRule {
+	rules := []s3types.LifecycleRule{
+		{
+			ID:     aws.String("cleanup-incomplete-multipart-registry-uploads"),
+			Status: s3types.ExpirationStatusEnabled,
+			Filter: &s3types.LifecycleRuleFilterMemberPrefix{
+				Value: "",
+			},
+			AbortIncompleteMultipartUpload: &s3types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int32(1),
+			},
+		},
+	}
+	if noncurrentDays > 0 {
+		rules = append(rules, s3types.LifecycleRule{
+			ID:     aws.String("expire-noncurrent-registry-versions"),
+			Status: s3types.ExpirationStatusEnabled,
+			Filter: &s3types.LifecycleRuleFilterMemberPrefix{
+				Value: "",
+			},
+			NoncurrentVersionExpiration: &s3types.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int32(noncurrentDays),
+			},
+			// delete markers without versions left are removed too.
+			Expiration: &s3types.LifecycleExpiration{
+				ExpiredObjectDeleteMarker: aws.Bool(true),
+			},
+		})
+	}
+	if len(transitions) == 0 {
+		return rules
+	}
+	rule := s3types.LifecycleRule{
+		ID:     aws.String("transition-registry-blobs"),
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilterMemberPrefix{
+			Value: blobsPrefix,
+		},
+	}
+	for _, transition := range transitions {
+		rule.Transitions = append(rule.Transitions, s3types.Transition{
+			StorageClass: s3types.TransitionStorageClass(transition.StorageClass),
+			Days:         aws.Int32(int32(transition.Days)),
+		})
+	}
+	return append(rules, rule)
+}
+
+// transitionsMessage returns the message of the
+// StorageLifecycleTransitionsEnabled condition once transitions are applied.
+func transitionsMessage(transitions []overrides.S3LifecycleRule) string {
+	var steps []string
+	for _, transition := range transitions {
+		steps = append(steps, fmt.Sprintf("%s after %d days", transition.StorageClass, transition.Days))
+	}
+	return "Blobs are moved to " + strings.Join(steps, ", then ")
+}
+
+// transitionsChanged returns true if the transitions requested for a managed
+// bucket are not applied yet.
+func transitionsChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil || !configOverrides.S3ManagedFeatures().ManagesLifecycle() {
+		return false
+	}
+	transitions, err := configOverrides.S3LifecycleRules()
+	if err != nil {
+		return false
+	}
+	cond := util.FetchCondition(cr, defaults.StorageLifecycleTransitionsEnabled)
+	if len(transitions) == 0 {
+		// the rules were removed, the lifecycle configuration has to be
+		// written again without them.
+		return cond.Type != ""
+	}
+	return cond.Status != operatorapi.ConditionTrue || cond.Message != transitionsMessage(transitions)
+}
+
+// externallyManaged reports that the operator does not apply the given feature
+// to the bucket as it has been disabled through the managed features.
+func externallyManaged(cr *imageregistryv1.Config, conditionType, feature string) {
+	util.UpdateCondition(cr, conditionType, operatorapi.ConditionUnknown, "Externally Managed", fmt.Sprintf("The %s of the S3 bucket is not managed by the operator", feature))
+}
+
+// bucketManagedByCluster returns true if the bucket carries the managed
+// metadata of this cluster, or if it doesn't exist anymore. A bucket without
+// tags is managed if the storage is recorded as managed in the status, as
+// buckets created by the operator are not tagged when tagging is managed
+// externally.
+func (d *driver) bucketManagedByCluster(cr *imageregistryv1.Config, svc *s3.Client) (bool, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return false, err
+	}
+
+	output, err := svc.GetBucketTagging(d.Context, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if code, ok := apiErrorCode(err); ok && code == "NoSuchTagSet" {
+		return cr.Status.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged, nil
+	} else if isBucketNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range output.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return util.ManagedByCluster(tags, infra, "kubernetes.io/cluster/"+infra.Status.InfrastructureName), nil
+}
+
+// bucketObjects lists and deletes the objects of an S3 bucket.
+type bucketObjects struct {
+	client *s3.Client
+	bucket string
+}
+
+func (b *bucketObjects) CountObjects(ctx context.Context) (int64, error) {
+	var count int64
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += int64(len(page.Contents))
+	}
+	return count, nil
+}
+
+func (b *bucketObjects) ListObjects(ctx context.Context, marker string, limit int) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(b.bucket),
+		MaxKeys: aws.Int32(int32(limit)),
+	}
+	if marker != "" {
+		input.StartAfter = aws.String(marker)
+	}
+	output, err := b.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(output.Contents))
+	for _, obj := range output.Contents {
+		names = append(names, aws.ToString(obj.Key))
+	}
+	return names, nil
+}
+
+func (b *bucketObjects) DeleteObjects(ctx context.Context, names []string) error {
+	objects := make([]s3types.ObjectIdentifier, 0, len(names))
+	for _, name := range names {
+		objects = append(objects, s3types.ObjectIdentifier{Key: aws.String(name)})
+	}
+	output, err := b.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(b.bucket),
+		Delete: &s3types.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.Errors) > 0 {
+		e := output.Errors[0]
+		return &smithy.GenericAPIError{
+			Code:    aws.ToString(e.Code),
+			Message: fmt.Sprintf("unable to delete %s: %s (and %d more errors)", aws.ToString(e.Key), aws.ToString(e.Message), len(output.Errors)-1),
+		}
+	}
+	return nil
+}
+
+// SetRemovalOptions sets how RemoveStorage deletes the objects of the
+// bucket.
+func (d *driver) SetRemovalOptions(opts util.RemovalOptions) {
+	d.removal = opts
+}
+
 // RemoveStorage deletes the storage medium that we created
 // The s3 bucket must be empty before it can be removed
-func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged ||
 		len(d.Config.Bucket) == 0 {
 		return false, nil
@@ -902,36 +1474,69 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	iter := s3manager.NewDeleteListIterator(svc, &s3.ListObjectsInput{
-		Bucket: aws.String(d.Config.Bucket),
-	})
+	managed, err := d.bucketManagedByCluster(cr, svc)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return false, err
+	}
+	if !managed {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Not Managed By Operator", fmt.Sprintf("The S3 bucket %s is not tagged as managed by the operator of this cluster, it was not deleted", d.Config.Bucket))
+		return false, nil
+	}
+
+	// the retained objects of a bucket with Object Lock can not be
+	// deleted, the bucket is kept.
+	locked := objectLocked(cr)
+	if lockConfig, err := d.objectLockConfiguration(svc); err == nil {
+		locked = lockConfig != nil
+	} else if isBucketNotFound(err) {
+		locked = false
+	} else {
+		klog.Warningf("unable to check the object lock of the S3 bucket %s: %s", d.Config.Bucket, err)
+	}
+	if locked {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Retained By Object Lock", fmt.Sprintf("Object Lock is enabled on the S3 bucket %s, it was not deleted", d.Config.Bucket))
+		return false, nil
+	}
+
+	err = util.DeleteAllObjects(d.Context, d.Config.Bucket, &bucketObjects{client: svc, bucket: d.Config.Bucket}, d.removal)
+	if err != nil && !isBucketNotFound(err) {
+		return false, err
+	}
 
-	err = s3manager.NewBatchDeleteWithClient(svc).Delete(d.Context, iter)
+	// a versioned bucket still holds the noncurrent versions of the
+	// deleted objects.
+	err = deleteObjectVersions(d.Context, svc, d.Config.Bucket)
 	if err != nil && !isBucketNotFound(err) {
 		return false, err
 	}
 
-	_, err = svc.DeleteBucketWithContext(d.Context, &s3.DeleteBucketInput{
+	out, err := svc.DeleteBucket(d.Context, &s3.DeleteBucketInput{
 		Bucket: aws.String(d.Config.Bucket),
 	})
+	var metadata smithymiddleware.Metadata
+	if out != nil {
+		metadata = out.ResultMetadata
+	}
+	recordOperation("DeleteBucket", d.Config.Bucket, metadata, err)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == s3.ErrCodeNoSuchBucket {
+		if code, ok := apiErrorCode(err); ok {
+			if code == "NoSuchBucket" {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "S3 Bucket Deleted", "The S3 bucket did not exist.")
 				return false, nil
 			}
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, aerr.Code(), aerr.Error())
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, code, err.Error())
 			return false, err
 		}
 		return true, err
 	}
 
 	// Wait until the bucket does not exist
-	if err := svc.WaitUntilBucketNotExistsWithContext(d.Context, &s3.HeadBucketInput{
+	if err := s3.NewBucketNotExistsWaiter(svc).Wait(d.Context, &s3.HeadBucketInput{
 		Bucket: aws.String(d.Config.Bucket),
-	}); err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, aerr.Code(), aerr.Error())
+	}, bucketWaitTimeout); err != nil {
+		if code, ok := apiErrorCode(err); ok {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, code, err.Error())
 		}
 
 		return false, err
@@ -959,6 +1564,17 @@ func (d *driver) ID() string {
 	return d.Config.Bucket
 }
 
+// Capabilities returns the capabilities of S3 storage.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		SupportsRedirect:         true,
+		SupportsEncryptionConfig: true,
+		SupportsTagging:          true,
+		SupportsManagedLifecycle: true,
+		MultiWriterSafe:          true,
+	}
+}
+
 // saveSharedCredentialsFile will create a file with the provided data expected to be
 // an AWS ini-style credentials configuration file.
 // Caller is responsible for cleaning up the created file.
@@ -998,6 +1614,82 @@ func sharedCredentialsDataFromStaticCreds(accessKey, accessSecret string) []byte
 	return buf.Bytes()
 }
 
+// bucketAccessPolicy returns an IAM policy that allows to access the objects of
+// bucket, read-only or read-write.
+func bucketAccessPolicy(partition, bucket string, readOnly bool) (string, error) {
+	type statement struct {
+		Effect   string   `json:"Effect"`
+		Action   []string `json:"Action"`
+		Resource []string `json:"Resource"`
+	}
+	type policy struct {
+		Version   string      `json:"Version"`
+		Statement []statement `json:"Statement"`
+	}
+
+	bucketActions := []string{"s3:ListBucket", "s3:GetBucketLocation"}
+	objectActions := []string{"s3:GetObject"}
+	if !readOnly {
+		bucketActions = append(bucketActions, "s3:ListBucketMultipartUploads")
+		objectActions = append(objectActions, "s3:PutObject", "s3:DeleteObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts")
+	}
+
+	data, err := json.Marshal(policy{
+		Version: "2012-10-17",
+		Statement: []statement{
+			{Effect: "Allow", Action: bucketActions, Resource: []string{fmt.Sprintf("arn:%s:s3:::%s", partition, bucket)}},
+			{Effect: "Allow", Action: objectActions, Resource: []string{fmt.Sprintf("arn:%s:s3:::%s/*", partition, bucket)}},
+		},
+	})
+	return string(data), err
+}
+
+// GrantAccess issues an STS federation token that is scoped to the bucket of
+// the registry. Federation tokens can only be obtained with the long-lived
+// credentials of an IAM user, not with AWS STS credentials.
+func (d *driver) GrantAccess(readOnly bool, duration time.Duration) (map[string][]byte, time.Time, error) {
+	tokenFile, err := d.TokenFile()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if tokenFile != "" {
+		return nil, time.Time{}, util.NewStorageError(util.ErrorKindInvalidConfig, fmt.Errorf("the operator uses temporary AWS STS credentials, short-lived storage credentials can only be issued with IAM user credentials"))
+	}
+
+	cfg, err := d.getConfig()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	partition := partitionForRegion(d.Config.Region)
+	policy, err := bucketAccessPolicy(partition, d.Config.Bucket, readOnly)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	out, err := sts.NewFromConfig(cfg).GetFederationToken(d.Context, &sts.GetFederationTokenInput{
+		Name:            aws.String("image-registry-access"),
+		DurationSeconds: aws.Int32(int32(duration.Seconds())),
+		Policy:          aws.String(policy),
+	})
+	if err != nil {
+		return nil, time.Time{}, classifyError(fmt.Errorf("unable to get a federation token: %w", err))
+	}
+
+	creds := out.Credentials
+	data := map[string][]byte{
+		"aws_access_key_id":     []byte(aws.ToString(creds.AccessKeyId)),
+		"aws_secret_access_key": []byte(aws.ToString(creds.SecretAccessKey)),
+		"aws_session_token":     []byte(aws.ToString(creds.SessionToken)),
+		"bucket":                []byte(d.Config.Bucket),
+		"region":                []byte(d.Config.Region),
+	}
+	if d.Config.RegionEndpoint != "" {
+		data["endpoint"] = []byte(d.Config.RegionEndpoint)
+	}
+	return data, aws.ToTime(creds.Expiration), nil
+}
+
 // PutStorageTags is for adding/overwriting tags of the S3 bucket
 // which name is obtained using this driver's ID() method.
 func (d *driver) PutStorageTags(tagMap map[string]string) error {
@@ -1011,24 +1703,24 @@ func (d *driver) PutStorageTags(tagMap map[string]string) error {
 		return err
 	}
 
-	tags := make([]*s3.Tag, 0, len(tagMap))
+	tags := make([]s3types.Tag, 0, len(tagMap))
 	for key, value := range tagMap {
-		tags = append(tags, &s3.Tag{
+		tags = append(tags, s3types.Tag{
 			Key:   aws.String(key),
 			Value: aws.String(value),
 		})
 	}
 
-	_, err = svc.PutBucketTaggingWithContext(d.Context, &s3.PutBucketTaggingInput{
+	_, err = svc.PutBucketTagging(d.Context, &s3.PutBucketTaggingInput{
 		Bucket: aws.String(d.ID()),
-		Tagging: &s3.Tagging{
+		Tagging: &s3types.Tagging{
 			TagSet: tags,
 		},
 	})
 	if err != nil {
 		errMsg := ""
-		if aerr, ok := err.(awserr.Error); ok {
-			errMsg = fmt.Sprintf("%s: %s", aerr.Code(), aerr.Error())
+		if code, ok := apiErrorCode(err); ok {
+			errMsg = fmt.Sprintf("%s: %s", code, err.Error())
 		} else {
 			errMsg = fmt.Sprintf("Unknown Error Occurred: %s", err.Error())
 		}
@@ -1048,14 +1740,14 @@ func (d *driver) GetStorageTags() (map[string]string, error) {
 		return nil, err
 	}
 
-	output, err := svc.GetBucketTaggingWithContext(d.Context, &s3.GetBucketTaggingInput{
+	output, err := svc.GetBucketTagging(d.Context, &s3.GetBucketTaggingInput{
 		Bucket: aws.String(d.ID()),
 	})
 	if err != nil {
 		errMsg := ""
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() != "NoSuchTagSet" {
-				errMsg = fmt.Sprintf("%s: %s", aerr.Code(), aerr.Error())
+		if code, ok := apiErrorCode(err); ok {
+			if code != "NoSuchTagSet" {
+				errMsg = fmt.Sprintf("%s: %s", code, err.Error())
 			}
 		} else {
 			errMsg = fmt.Sprintf("Unknown Error Occurred: %s", err.Error())
@@ -1065,7 +1757,7 @@ func (d *driver) GetStorageTags() (map[string]string, error) {
 
 	tags := make(map[string]string)
 	for _, tag := range output.TagSet {
-		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
 	}
 
 	return tags, nil
@@ -3,88 +3,168 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/endpoints"
-	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/google/go-cmp/cmp"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
+// urlTripper records the URL of the last request.
+type urlTripper struct {
+	url *url.URL
+}
+
+func (r *urlTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.url = req.URL
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString("")),
+	}, nil
+}
+
 func TestEndpointsResolver(t *testing.T) {
 	testCases := []struct {
+		name         string
 		region       string
+		s3Endpoint   string
 		useDualStack bool
-		endpoint     string
+		usePathStyle bool
+		url          string
 	}{
 		{
-			region:   "us-east-1",
-			endpoint: "https://s3.amazonaws.com",
+			name:   "us-east-1",
+			region: "us-east-1",
+			url:    "https://a-bucket.s3.us-east-1.amazonaws.com/",
 		},
 		{
+			name:         "us-east-1 dual-stack",
 			region:       "us-east-1",
 			useDualStack: true,
-			endpoint:     "https://s3.dualstack.us-east-1.amazonaws.com",
+			url:          "https://a-bucket.s3.dualstack.us-east-1.amazonaws.com/",
 		},
 		{
-			region:   "us-gov-east-1",
-			endpoint: "https://s3.us-gov-east-1.amazonaws.com",
+			name:   "us-gov-east-1",
+			region: "us-gov-east-1",
+			url:    "https://a-bucket.s3.us-gov-east-1.amazonaws.com/",
 		},
 		{
+			name:         "us-gov-east-1 dual-stack",
 			region:       "us-gov-east-1",
 			useDualStack: true,
-			endpoint:     "https://s3.dualstack.us-gov-east-1.amazonaws.com",
+			url:          "https://a-bucket.s3.dualstack.us-gov-east-1.amazonaws.com/",
 		},
 		{
-			region:   "us-iso-east-1",
-			endpoint: "https://s3.us-iso-east-1.c2s.ic.gov",
+			name:   "us-iso-east-1",
+			region: "us-iso-east-1",
+			url:    "https://a-bucket.s3.us-iso-east-1.c2s.ic.gov/",
+		},
+		{
+			name:         "custom endpoint",
+			region:       "example",
+			s3Endpoint:   "https://s3.example.com",
+			useDualStack: true,
+			usePathStyle: true,
+			url:          "https://s3.example.com/a-bucket",
 		},
 		{
-			region:       "us-iso-east-1",
+			name:         "custom endpoint with virtual hosted style",
+			region:       "example",
+			s3Endpoint:   "https://s3.example.com",
 			useDualStack: true,
-			endpoint:     "",
+			url:          "https://a-bucket.s3.example.com/",
 		},
 	}
 	for _, tc := range testCases {
-		t.Run(tc.region, func(t *testing.T) {
-			er := newEndpointsResolver(tc.region, "", nil)
-			var opts []func(*endpoints.Options)
-			if tc.useDualStack {
-				opts = append(opts, endpoints.UseDualStackEndpointOption)
-			}
-			ep, err := er.EndpointFor("s3", tc.region, opts...)
-			if isUnknownEndpointError(err) && tc.endpoint == "" {
-				return // the error is expected
-			}
+		t.Run(tc.name, func(t *testing.T) {
+			er := newEndpointsResolver(tc.region, tc.s3Endpoint, nil)
+			rt := &urlTripper{}
+			client := s3.New(s3.Options{
+				Region:      tc.region,
+				Credentials: aws.AnonymousCredentials{},
+				HTTPClient:  &http.Client{Transport: rt},
+			}, er.s3Options(tc.useDualStack, tc.usePathStyle))
+			_, err := client.HeadBucket(context.Background(), &s3.HeadBucketInput{
+				Bucket: aws.String("a-bucket"),
+			})
 			if err != nil {
 				t.Fatal(err)
 			}
-			if ep.URL != tc.endpoint {
-				t.Errorf("got %s, want %s", ep.URL, tc.endpoint)
+			if rt.url.String() != tc.url {
+				t.Errorf("got %s, want %s", rt.url, tc.url)
 			}
 		})
 	}
 }
 
+func TestEndpointsResolverServiceEndpoints(t *testing.T) {
+	er := newEndpointsResolver("us-east-1", "https://s3.example.com", []configv1.AWSServiceEndpoint{
+		{
+			Name: "sts",
+			URL:  "https://sts.example.com",
+		},
+	})
+
+	ep, err := er.ResolveEndpoint(sts.ServiceID, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.URL != "https://sts.example.com" || ep.SigningRegion != "us-east-1" {
+		t.Errorf("unexpected STS endpoint %+v", ep)
+	}
+
+	// the signing region of the global endpoint is not the name of the
+	// region, it comes from the partition metadata.
+	ep, err = er.ResolveEndpoint(sts.ServiceID, "aws-global")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.URL != "https://sts.example.com" || ep.SigningRegion != "us-east-1" {
+		t.Errorf("unexpected global STS endpoint %+v", ep)
+	}
+
+	// the S3 endpoint is set on the S3 clients and other services use
+	// their default endpoints.
+	for _, service := range []string{s3.ServiceID, "EC2"} {
+		var notFound *aws.EndpointNotFoundError
+		if _, err := er.ResolveEndpoint(service, "us-east-1"); !errors.As(err, &notFound) {
+			t.Errorf("%s: expected the default endpoint to be used, got %v", service, err)
+		}
+	}
+}
+
 func TestRegionS3DualStack(t *testing.T) {
 	testCases := []struct {
 		region string
@@ -98,18 +178,26 @@ func TestRegionS3DualStack(t *testing.T) {
 			region: "us-gov-east-1",
 			want:   true,
 		},
+		{
+			region: "cn-north-1",
+			want:   true,
+		},
 		{
 			region: "us-iso-east-1",
 			want:   false,
 		},
+		{
+			region: "us-isob-east-1",
+			want:   false,
+		},
+		{
+			region: "eu-isoe-west-1",
+			want:   false,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.region, func(t *testing.T) {
-			got, err := regionHasDualStackS3(tc.region)
-			if err != nil {
-				t.Fatal(err)
-			}
-			if got != tc.want {
+			if got := regionHasDualStackS3(tc.region); got != tc.want {
 				t.Errorf("got %t, want %t", got, tc.want)
 			}
 		})
@@ -545,7 +633,7 @@ func TestUserProvidedTags(t *testing.T) {
 		name          string
 		config        *imageregistryv1.Config
 		userTags      []configv1.AWSResourceTag
-		expectedTags  []*s3.Tag
+		expectedTags  []s3types.Tag
 		responseCodes []int
 		infraName     string
 		noTagRequest  bool
@@ -553,7 +641,7 @@ func TestUserProvidedTags(t *testing.T) {
 		{
 			name:      "no user tags",
 			infraName: "test-infra",
-			expectedTags: []*s3.Tag{
+			expectedTags: []s3types.Tag{
 				{
 					Key:   aws.String("kubernetes.io/cluster/test-infra"),
 					Value: aws.String("owned"),
@@ -562,6 +650,18 @@ func TestUserProvidedTags(t *testing.T) {
 					Key:   aws.String("Name"),
 					Value: aws.String("test-infra-image-registry"),
 				},
+				{
+					Key:   aws.String("openshift-image-registry-managed-by"),
+					Value: aws.String("cluster-image-registry-operator"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-infra-id"),
+					Value: aws.String("test-infra"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-config-generation"),
+					Value: aws.String("0"),
+				},
 			},
 			config: &imageregistryv1.Config{
 				Spec: imageregistryv1.ImageRegistrySpec{
@@ -584,7 +684,7 @@ func TestUserProvidedTags(t *testing.T) {
 					Value: "value1",
 				},
 			},
-			expectedTags: []*s3.Tag{
+			expectedTags: []s3types.Tag{
 				{
 					Key:   aws.String("kubernetes.io/cluster/another-test-infra"),
 					Value: aws.String("owned"),
@@ -593,6 +693,18 @@ func TestUserProvidedTags(t *testing.T) {
 					Key:   aws.String("Name"),
 					Value: aws.String("another-test-infra-image-registry"),
 				},
+				{
+					Key:   aws.String("openshift-image-registry-managed-by"),
+					Value: aws.String("cluster-image-registry-operator"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-infra-id"),
+					Value: aws.String("another-test-infra"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-config-generation"),
+					Value: aws.String("0"),
+				},
 				{
 					Key:   aws.String("tag0"),
 					Value: aws.String("value0"),
@@ -624,7 +736,7 @@ func TestUserProvidedTags(t *testing.T) {
 				},
 			},
 			noTagRequest: true,
-			expectedTags: []*s3.Tag{},
+			expectedTags: []s3types.Tag{},
 			config: &imageregistryv1.Config{
 				Spec: imageregistryv1.ImageRegistrySpec{
 					Storage: imageregistryv1.ImageRegistryConfigStorage{
@@ -649,7 +761,7 @@ func TestUserProvidedTags(t *testing.T) {
 					Value: "value1",
 				},
 			},
-			expectedTags: []*s3.Tag{
+			expectedTags: []s3types.Tag{
 				{
 					Key:   aws.String("kubernetes.io/cluster/tinfra"),
 					Value: aws.String("owned"),
@@ -658,6 +770,18 @@ func TestUserProvidedTags(t *testing.T) {
 					Key:   aws.String("Name"),
 					Value: aws.String("tinfra-image-registry"),
 				},
+				{
+					Key:   aws.String("openshift-image-registry-managed-by"),
+					Value: aws.String("cluster-image-registry-operator"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-infra-id"),
+					Value: aws.String("tinfra"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-config-generation"),
+					Value: aws.String("0"),
+				},
 				{
 					Key:   aws.String("tag0"),
 					Value: aws.String("value0"),
@@ -692,7 +816,7 @@ func TestUserProvidedTags(t *testing.T) {
 				},
 			},
 			responseCodes: []int{http.StatusNotFound},
-			expectedTags: []*s3.Tag{
+			expectedTags: []s3types.Tag{
 				{
 					Key:   aws.String("kubernetes.io/cluster/tinfra"),
 					Value: aws.String("owned"),
@@ -701,6 +825,18 @@ func TestUserProvidedTags(t *testing.T) {
 					Key:   aws.String("Name"),
 					Value: aws.String("tinfra-image-registry"),
 				},
+				{
+					Key:   aws.String("openshift-image-registry-managed-by"),
+					Value: aws.String("cluster-image-registry-operator"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-infra-id"),
+					Value: aws.String("tinfra"),
+				},
+				{
+					Key:   aws.String("openshift-image-registry-config-generation"),
+					Value: aws.String("0"),
+				},
 				{
 					Key:   aws.String("tag0"),
 					Value: aws.String("value0"),
@@ -774,11 +910,10 @@ func TestUserProvidedTags(t *testing.T) {
 					continue
 				}
 
-				buf := bytes.NewBuffer(body)
-				tagging := s3.Tagging{}
-				xmldec := xml.NewDecoder(buf)
-
-				if err := xmlutil.UnmarshalXML(&tagging, xmldec, ""); err != nil {
+				var tagging struct {
+					TagSet []s3types.Tag `xml:"TagSet>Tag"`
+				}
+				if err := xml.Unmarshal(body, &tagging); err != nil {
 					t.Fatalf("error decoding tagging request: %s", err)
 				}
 
@@ -798,3 +933,1378 @@ func TestUserProvidedTags(t *testing.T) {
 		})
 	}
 }
+
+func TestManagedFeatures(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "a-bucket",
+				},
+			},
+			OperatorSpec: operatorapi.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{
+					Raw: []byte(`{"storage":{"s3":{"managedFeatures":{"encryption":false,"publicAccessBlock":false}}}}`),
+				},
+			},
+		},
+	}
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+	drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+	rt := &tripper{}
+	drv.roundTripper = rt
+
+	if err := drv.CreateStorage(config); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	var requests []string
+	for _, body := range rt.reqBodies {
+		for _, root := range []string{"ServerSideEncryptionConfiguration", "PublicAccessBlockConfiguration", "LifecycleConfiguration", "Tagging"} {
+			if strings.Contains(string(body), "<"+root) {
+				requests = append(requests, root)
+			}
+		}
+	}
+	expectedRequests := []string{"Tagging", "LifecycleConfiguration"}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("expected requests %v, got %v", expectedRequests, requests)
+	}
+
+	for _, conditionType := range []string{defaults.StorageEncrypted, defaults.StoragePublicAccessBlocked} {
+		cond := util.FetchCondition(config, conditionType)
+		if cond.Status != operatorapi.ConditionUnknown || cond.Reason != "Externally Managed" {
+			t.Errorf("expected %s to be externally managed, got %s: %s", conditionType, cond.Status, cond.Reason)
+		}
+	}
+	for _, conditionType := range []string{defaults.StorageTagged, defaults.StorageIncompleteUploadCleanupEnabled} {
+		if cond := util.FetchCondition(config, conditionType); cond.Status != operatorapi.ConditionTrue {
+			t.Errorf("expected %s to be true, got %s: %s", conditionType, cond.Status, cond.Reason)
+		}
+	}
+}
+
+func TestLifecycleTransitions(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "a-bucket",
+				},
+			},
+			OperatorSpec: operatorapi.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{
+					Raw: []byte(`{"storage":{"s3":{"lifecycleRules":[{"storageClass":"STANDARD_IA","days":30},{"storageClass":"GLACIER_IR","days":90}]}}}`),
+				},
+			},
+		},
+	}
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+	drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+	rt := &tripper{}
+	drv.roundTripper = rt
+
+	if !drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be changed until the transitions are applied")
+	}
+	if err := drv.CreateStorage(config); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	var lifecycle string
+	for _, body := range rt.reqBodies {
+		if strings.Contains(string(body), "<LifecycleConfiguration") {
+			lifecycle = string(body)
+		}
+	}
+	for _, expected := range []string{
+		"<ID>cleanup-incomplete-multipart-registry-uploads</ID>",
+		"<Prefix>docker/registry/v2/blobs/</Prefix>",
+		"<StorageClass>STANDARD_IA</StorageClass>",
+		"<Days>30</Days>",
+		"<StorageClass>GLACIER_IR</StorageClass>",
+		"<Days>90</Days>",
+	} {
+		if !strings.Contains(lifecycle, expected) {
+			t.Errorf("expected the lifecycle configuration to contain %s, got %s", expected, lifecycle)
+		}
+	}
+
+	cond := util.FetchCondition(config, defaults.StorageLifecycleTransitionsEnabled)
+	if cond.Status != operatorapi.ConditionTrue || cond.Message != "Blobs are moved to STANDARD_IA after 30 days, then GLACIER_IR after 90 days" {
+		t.Errorf("unexpected condition %s: %s", cond.Status, cond.Message)
+	}
+	if drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be unchanged once the transitions are applied")
+	}
+
+	config.Spec.UnsupportedConfigOverrides = runtime.RawExtension{}
+	if !drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be changed once the transitions are removed")
+	}
+}
+
+// untaggedBucketTripper serves a bucket without tags and records whether it
+// has been deleted.
+type untaggedBucketTripper struct {
+	deleted bool
+}
+
+func (r *untaggedBucketTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	code, body := http.StatusOK, ""
+	switch {
+	case req.Method == http.MethodGet && req.URL.Query().Has("tagging"):
+		code, body = http.StatusNotFound, "<Error><Code>NoSuchTagSet</Code><Message>The TagSet does not exist</Message></Error>"
+	case req.Method == http.MethodGet:
+		body = "<ListBucketResult><KeyCount>0</KeyCount><IsTruncated>false</IsTruncated></ListBucketResult>"
+	case req.Method == http.MethodDelete:
+		r.deleted = true
+		code = http.StatusNoContent
+	case req.Method == http.MethodHead && r.deleted:
+		code = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}, nil
+}
+
+func TestRemoveStorageWithoutTagging(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+
+	for _, tt := range []struct {
+		name            string
+		managementState string
+		deleted         bool
+	}{
+		{
+			name:            "managed",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			deleted:         true,
+		},
+		{
+			name:            "previously unmanaged",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			deleted:         false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket: "a-bucket",
+						},
+					},
+					OperatorSpec: operatorapi.OperatorSpec{
+						UnsupportedConfigOverrides: runtime.RawExtension{
+							Raw: []byte(`{"storage":{"s3":{"managedFeatures":{"tagging":false}}}}`),
+						},
+					},
+				},
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+			drv.roundTripper = &tripper{}
+			if err := drv.CreateStorage(config); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+			config.Status.Storage.ManagementState = tt.managementState
+
+			rt := &untaggedBucketTripper{}
+			drv.roundTripper = rt
+			if _, err := drv.RemoveStorage(config); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+			if rt.deleted != tt.deleted {
+				t.Errorf("expected the bucket deletion to be %t, got %t", tt.deleted, rt.deleted)
+			}
+		})
+	}
+}
+
+func TestWebIdentityTokenFile(t *testing.T) {
+	data := []byte("[default]\nrole_arn = arn:aws:iam::123456789012:role/registry\nweb_identity_token_file = /var/run/secrets/openshift/serviceaccount/token\n")
+	if got := webIdentityTokenFile(data); got != "/var/run/secrets/openshift/serviceaccount/token" {
+		t.Errorf("unexpected token file %q", got)
+	}
+	if got := webIdentityTokenFile(sharedCredentialsDataFromStaticCreds("key", "secret")); got != "" {
+		t.Errorf("expected no token file for static credentials, got %q", got)
+	}
+}
+
+func TestBucketAccessPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		readOnly bool
+		expected string
+	}{
+		{
+			name:     "read-only",
+			readOnly: true,
+			expected: `{"Version":"2012-10-17","Statement":[` +
+				`{"Effect":"Allow","Action":["s3:ListBucket","s3:GetBucketLocation"],"Resource":["arn:aws:s3:::registry"]},` +
+				`{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::registry/*"]}]}`,
+		},
+		{
+			name:     "read-write",
+			readOnly: false,
+			expected: `{"Version":"2012-10-17","Statement":[` +
+				`{"Effect":"Allow","Action":["s3:ListBucket","s3:GetBucketLocation","s3:ListBucketMultipartUploads"],"Resource":["arn:aws:s3:::registry"]},` +
+				`{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject","s3:DeleteObject","s3:AbortMultipartUpload","s3:ListMultipartUploadParts"],"Resource":["arn:aws:s3:::registry/*"]}]}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := bucketAccessPolicy("aws", "registry", tt.readOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if policy != tt.expected {
+				t.Errorf("unexpected policy:\n%s", cmp.Diff(tt.expected, policy))
+			}
+		})
+	}
+}
+
+func TestGetConfigNutanix(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.NutanixPlatformType,
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_S3_ACCESSKEY":    []byte("access"),
+			"REGISTRY_STORAGE_S3_SECRETKEY":    []byte("secret"),
+			defaults.NutanixObjectsEndpointKey: []byte("https://objects.nutanix.example.com"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	s3Driver := &driver{
+		Listers: &listers.StorageListers,
+		Config:  &imageregistryv1.ImageRegistryConfigStorageS3{},
+	}
+	err := s3Driver.UpdateEffectiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &imageregistryv1.ImageRegistryConfigStorageS3{
+		Region:         "us-east-1",
+		RegionEndpoint: "https://objects.nutanix.example.com",
+	}
+	if !reflect.DeepEqual(s3Driver.Config, expected) {
+		t.Errorf("unexpected config: %s", cmp.Diff(expected, s3Driver.Config))
+	}
+}
+
+func TestNutanixManagedFeatures(t *testing.T) {
+	features := nutanixManagedFeatures(nil)
+	if features.ManagesEncryption() || features.ManagesPublicAccessBlock() || features.ManagesTagging() {
+		t.Errorf("expected encryption, public access block and tagging to be disabled by default, got %+v", features)
+	}
+	if !features.ManagesLifecycle() {
+		t.Error("expected lifecycle to be managed by default")
+	}
+
+	features = nutanixManagedFeatures(&overrides.S3ManagedFeatures{
+		Encryption: aws.Bool(true),
+		Lifecycle:  aws.Bool(false),
+	})
+	if !features.ManagesEncryption() {
+		t.Error("expected encryption to be managed when it is enabled explicitly")
+	}
+	if features.ManagesLifecycle() {
+		t.Error("expected lifecycle to be disabled when it is disabled explicitly")
+	}
+}
+
+// responseError returns err as the SDK returns the errors of the responses
+// with statusCode.
+func responseError(err error, statusCode int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+			Err:      err,
+		},
+		RequestID: "req",
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		kind util.ErrorKind
+	}{
+		{
+			name: "known error code",
+			err:  responseError(&smithy.GenericAPIError{Code: "SignatureDoesNotMatch", Message: "signature mismatch"}, http.StatusForbidden),
+			kind: util.ErrorKindPermissionDenied,
+		},
+		{
+			name: "throttled",
+			err:  &smithy.GenericAPIError{Code: "SlowDown", Message: "reduce your request rate"},
+			kind: util.ErrorKindThrottled,
+		},
+		{
+			name: "unknown error code with status",
+			err:  responseError(&smithy.GenericAPIError{Code: "BucketGone", Message: "bucket is gone"}, http.StatusNotFound),
+			kind: util.ErrorKindNotFound,
+		},
+		{
+			name: "unknown error code",
+			err:  responseError(&smithy.GenericAPIError{Code: "InternalError", Message: "internal error"}, http.StatusInternalServerError),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var storageErr *util.StorageError
+			err := classifyError(tt.err)
+			if !errors.As(err, &storageErr) {
+				if tt.kind != "" {
+					t.Fatalf("got unclassified error %v, want kind %s", err, tt.kind)
+				}
+				return
+			}
+			if storageErr.Kind != tt.kind {
+				t.Errorf("got kind %s, want %s", storageErr.Kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	expected := util.Capabilities{
+		SupportsRedirect:         true,
+		SupportsEncryptionConfig: true,
+		SupportsTagging:          true,
+		SupportsManagedLifecycle: true,
+		MultiWriterSafe:          true,
+	}
+	if caps := (&driver{}).Capabilities(); caps != expected {
+		t.Errorf("expected S3 storage capabilities %+v, got %+v", expected, caps)
+	}
+}
+
+// driftedBucketTripper serves a bucket whose public access block and default
+// encryption were weakened, and records the settings written to it.
+type driftedBucketTripper struct {
+	written []string
+}
+
+func (r *driftedBucketTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	switch {
+	case req.Method == http.MethodGet && req.URL.Query().Has("publicAccessBlock"):
+		body = "<PublicAccessBlockConfiguration><BlockPublicAcls>false</BlockPublicAcls><IgnorePublicAcls>true</IgnorePublicAcls><BlockPublicPolicy>true</BlockPublicPolicy><RestrictPublicBuckets>false</RestrictPublicBuckets></PublicAccessBlockConfiguration>"
+	case req.Method == http.MethodGet && req.URL.Query().Has("encryption"):
+		body = "<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault><SSEAlgorithm>AES256</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>"
+	case req.Method == http.MethodPut && req.URL.Query().Has("publicAccessBlock"):
+		r.written = append(r.written, "publicAccessBlock")
+	case req.Method == http.MethodPut && req.URL.Query().Has("encryption"):
+		r.written = append(r.written, "encryption")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}, nil
+}
+
+func TestDriftDetection(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+
+	for _, tt := range []struct {
+		name            string
+		bucket          string
+		remediate       bool
+		expectedWritten []string
+		expectedStatus  operatorapi.ConditionStatus
+		expectedReason  string
+	}{
+		{
+			name:           "report",
+			bucket:         "reported-bucket",
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: driftReasonChanged,
+		},
+		{
+			name:            "remediate",
+			bucket:          "remediated-bucket",
+			remediate:       true,
+			expectedWritten: []string{"publicAccessBlock", "encryption"},
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  driftReasonRestored,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Config := &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: tt.bucket,
+				KeyID:  "arn:aws:kms:us-west-1:123456789012:key/key-id",
+			}
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						S3:              s3Config.DeepCopy(),
+					},
+					OperatorSpec: operatorapi.OperatorSpec{
+						UnsupportedConfigOverrides: runtime.RawExtension{
+							Raw: []byte(fmt.Sprintf(`{"storage":{"s3":{"driftDetection":{"enabled":true,"remediate":%t}}}}`, tt.remediate)),
+						},
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: s3Config.DeepCopy(),
+					},
+				},
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+			rt := &driftedBucketTripper{}
+			drv.roundTripper = rt
+
+			if !drv.StorageChanged(config) {
+				t.Errorf("expected the storage to be changed when a check is due")
+			}
+			if err := drv.CreateStorage(config); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+			if !reflect.DeepEqual(rt.written, tt.expectedWritten) {
+				t.Errorf("expected settings %v to be written, got %v", tt.expectedWritten, rt.written)
+			}
+
+			for conditionType, expectedMessage := range map[string]string{
+				defaults.StoragePublicAccessBlocked: "BlockPublicAcls, RestrictPublicBuckets disabled",
+				defaults.StorageEncrypted:           "from aws:kms to AES256",
+			} {
+				cond := util.FetchCondition(config, conditionType)
+				if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason || !strings.Contains(cond.Message, expectedMessage) {
+					t.Errorf("unexpected condition %s %s: %s: %s", conditionType, cond.Status, cond.Reason, cond.Message)
+				}
+			}
+			if drv.StorageChanged(config) {
+				t.Errorf("expected the storage to be unchanged until the next check")
+			}
+
+			// reconciliations between two checks leave reported changes
+			// as they are.
+			rt.written = nil
+			drv = NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+			drv.roundTripper = rt
+			if err := drv.CreateStorage(config); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+			if tt.remediate && len(rt.written) != 2 || !tt.remediate && len(rt.written) != 0 {
+				t.Errorf("unexpected settings written between checks: %v", rt.written)
+			}
+		})
+	}
+}
+
+func TestEncryptionDrift(t *testing.T) {
+	kms := func(keyID string) *s3types.ServerSideEncryptionConfiguration {
+		return &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{
+					SSEAlgorithm:   s3types.ServerSideEncryptionAwsKms,
+					KMSMasterKeyID: aws.String(keyID),
+				},
+			}},
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		config  *s3types.ServerSideEncryptionConfiguration
+		keyID   string
+		drifted bool
+	}{
+		{
+			name:   "same key id",
+			config: kms("key-id"),
+			keyID:  "key-id",
+		},
+		{
+			name:   "key arn",
+			config: kms("arn:aws:kms:us-east-1:123456789012:key/key-id"),
+			keyID:  "key-id",
+		},
+		{
+			name:    "other key",
+			config:  kms("other-key-id"),
+			keyID:   "key-id",
+			drifted: true,
+		},
+		{
+			name:    "kms instead of sse-s3",
+			config:  kms("key-id"),
+			drifted: true,
+		},
+		{
+			name:    "no rules",
+			config:  &s3types.ServerSideEncryptionConfiguration{},
+			drifted: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			change := encryptionDrift(tt.config, tt.keyID)
+			if (change != "") != tt.drifted {
+				t.Errorf("expected drift %t, got %q", tt.drifted, change)
+			}
+		})
+	}
+}
+
+// styleTripper serves the bucket only to requests with the given addressing
+// style.
+type styleTripper struct {
+	virtualHosted bool
+	requests      int
+}
+
+func (r *styleTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests++
+	code := http.StatusNotFound
+	if strings.HasPrefix(req.URL.Host, "s3.") != r.virtualHosted {
+		code = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString("")),
+	}, nil
+}
+
+func TestAddressingStyle(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.NonePlatformType,
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("access_key_id"),
+			"REGISTRY_STORAGE_S3_SECRETKEY": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+
+	for _, tt := range []struct {
+		name                  string
+		bucket                string
+		style                 string
+		virtualHostedEndpoint bool
+		expectedVirtualHosted bool
+		expectedRequests      int
+		expectedCondition     operatorapi.ConditionStatus
+	}{
+		{
+			name:              "detect path-style",
+			bucket:            "path-bucket",
+			style:             overrides.S3AddressingStyleAuto,
+			expectedRequests:  2,
+			expectedCondition: operatorapi.ConditionTrue,
+		},
+		{
+			name:                  "detect virtual-hosted style",
+			bucket:                "virtual-hosted-bucket",
+			style:                 overrides.S3AddressingStyleAuto,
+			virtualHostedEndpoint: true,
+			expectedVirtualHosted: true,
+			expectedRequests:      1,
+			expectedCondition:     operatorapi.ConditionTrue,
+		},
+		{
+			name:                  "explicit style",
+			bucket:                "explicit-bucket",
+			style:                 overrides.S3AddressingStyleVirtualHosted,
+			expectedVirtualHosted: true,
+		},
+		{
+			name:   "configured style",
+			bucket: "configured-bucket",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket:         tt.bucket,
+							Region:         "example",
+							RegionEndpoint: "https://s3.example.com",
+						},
+					},
+					OperatorSpec: operatorapi.OperatorSpec{
+						UnsupportedConfigOverrides: runtime.RawExtension{
+							Raw: []byte(fmt.Sprintf(`{"storage":{"s3":{"addressingStyle":%q}}}`, tt.style)),
+						},
+					},
+				},
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+			rt := &styleTripper{virtualHosted: tt.virtualHostedEndpoint}
+			drv.roundTripper = rt
+
+			drv.StorageChanged(config)
+			if config.Spec.Storage.S3.VirtualHostedStyle != tt.expectedVirtualHosted {
+				t.Errorf("expected virtualHostedStyle %t, got %t", tt.expectedVirtualHosted, config.Spec.Storage.S3.VirtualHostedStyle)
+			}
+			if rt.requests != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, rt.requests)
+			}
+			if cond := util.FetchCondition(config, defaults.StorageAddressingStyleDetected); cond.Status != tt.expectedCondition {
+				t.Errorf("unexpected condition %s: %s", cond.Status, cond.Message)
+			}
+
+			// the detected style is remembered.
+			drv.StorageChanged(config)
+			if rt.requests != tt.expectedRequests {
+				t.Errorf("expected the endpoint to be probed once, got %d requests", rt.requests)
+			}
+		})
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "a-bucket",
+				},
+			},
+			OperatorSpec: operatorapi.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{
+					Raw: []byte(`{"storage":{"s3":{"versioning":{"enabled":true,"noncurrentVersionExpirationDays":30}}}}`),
+				},
+			},
+		},
+	}
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+	drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+	rt := &tripper{}
+	drv.roundTripper = rt
+
+	if !drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be changed until versioning is enabled")
+	}
+	if err := drv.CreateStorage(config); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	var versioning, lifecycle string
+	for _, body := range rt.reqBodies {
+		switch {
+		case strings.Contains(string(body), "<VersioningConfiguration"):
+			versioning = string(body)
+		case strings.Contains(string(body), "<LifecycleConfiguration"):
+			lifecycle = string(body)
+		}
+	}
+	if !strings.Contains(versioning, "<Status>Enabled</Status>") {
+		t.Errorf("expected versioning to be enabled, got %s", versioning)
+	}
+	for _, expected := range []string{
+		"<ID>expire-noncurrent-registry-versions</ID>",
+		"<NoncurrentDays>30</NoncurrentDays>",
+		"<ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker>",
+	} {
+		if !strings.Contains(lifecycle, expected) {
+			t.Errorf("expected the lifecycle configuration to contain %s, got %s", expected, lifecycle)
+		}
+	}
+
+	cond := util.FetchCondition(config, defaults.StorageVersioningEnabled)
+	if cond.Status != operatorapi.ConditionTrue || cond.Message != "Versioning is enabled on the S3 bucket, noncurrent versions expire after 30 days" {
+		t.Errorf("unexpected condition %s: %s", cond.Status, cond.Message)
+	}
+	if drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be unchanged once versioning is enabled")
+	}
+
+	config.Spec.UnsupportedConfigOverrides = runtime.RawExtension{}
+	if !drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be changed once versioning is not requested anymore")
+	}
+	rt.reqBodies = nil
+	if err := drv.CreateStorage(config); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+	versioning = ""
+	for _, body := range rt.reqBodies {
+		if strings.Contains(string(body), "<VersioningConfiguration") {
+			versioning = string(body)
+		}
+	}
+	if !strings.Contains(versioning, "<Status>Suspended</Status>") {
+		t.Errorf("expected versioning to be suspended, got %s", versioning)
+	}
+	if cond := util.FetchCondition(config, defaults.StorageVersioningEnabled); cond.Type != "" {
+		t.Errorf("expected the versioning condition to be removed, got %s: %s", cond.Status, cond.Message)
+	}
+}
+
+func TestAccelerate(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "a-bucket",
+				},
+			},
+			OperatorSpec: operatorapi.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{
+					Raw: []byte(`{"storage":{"s3":{"accelerate":true}}}`),
+				},
+			},
+		},
+	}
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+	drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+	rt := &tripper{}
+	drv.roundTripper = rt
+
+	if !drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be changed until acceleration is enabled")
+	}
+	if err := drv.CreateStorage(config); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+	var accelerate string
+	for _, body := range rt.reqBodies {
+		if strings.Contains(string(body), "<AccelerateConfiguration") {
+			accelerate = string(body)
+		}
+	}
+	if !strings.Contains(accelerate, "<Status>Enabled</Status>") {
+		t.Errorf("expected acceleration to be enabled, got %s", accelerate)
+	}
+	if cond := util.FetchCondition(config, defaults.StorageAccelerationEnabled); cond.Status != operatorapi.ConditionTrue {
+		t.Errorf("unexpected condition %s: %s", cond.Status, cond.Message)
+	}
+	if drv.StorageChanged(config) {
+		t.Errorf("expected the storage to be unchanged once acceleration is enabled")
+	}
+
+	drv.SetAccelerate(true)
+	envs, err := drv.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range envs {
+		if e.Name == "REGISTRY_STORAGE_S3_ACCELERATE" && e.Value == true {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected REGISTRY_STORAGE_S3_ACCELERATE to be set, got %v", envs)
+	}
+}
+
+func TestValidateAccelerate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  *imageregistryv1.ImageRegistryConfigStorageS3
+		err  bool
+	}{
+		{
+			name: "generated bucket name",
+			cfg:  &imageregistryv1.ImageRegistryConfigStorageS3{},
+		},
+		{
+			name: "compatible bucket name",
+			cfg:  &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry-bucket"},
+		},
+		{
+			name: "bucket name with periods",
+			cfg:  &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry.example.com"},
+			err:  true,
+		},
+		{
+			name: "custom endpoint",
+			cfg:  &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry", RegionEndpoint: "https://s3.example.com"},
+			err:  true,
+		},
+		{
+			name: "no S3 storage",
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAccelerate(tc.cfg, "")
+			if tc.err && err == nil {
+				t.Errorf("expected an error")
+			} else if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoragePreset(t *testing.T) {
+	config := &imageregistryv1.ImageRegistryConfigStorageS3{
+		Bucket:         "registry",
+		Region:         "us-east-1",
+		RegionEndpoint: "https://minio.example.com:9000",
+	}
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.NonePlatformType,
+			},
+		},
+	})
+	listers := testBuilder.BuildListers()
+	featureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+
+	d := NewDriver(context.Background(), config, &listers.StorageListers, featureGateAccessor)
+	d.SetPreset(overrides.StoragePresetMinIO)
+	envvars, err := d.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_USEDUALSTACK"); e != nil {
+		t.Errorf("a preset must not use dual-stack endpoints, got %#+v", e.Value)
+	}
+	if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_V4AUTH"); e == nil || e.Value != true {
+		t.Errorf("a preset must use version 4 signatures, got %v", envvars)
+	}
+
+	for _, tc := range []struct {
+		name            string
+		preset          overrides.StoragePreset
+		config          *imageregistryv1.ImageRegistryConfigStorageS3
+		addressingStyle string
+		err             string
+	}{
+		{
+			name:   "minio over http",
+			preset: overrides.StoragePresetMinIO,
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{RegionEndpoint: "http://minio.example.com:9000"},
+		},
+		{
+			name:   "storagegrid over http",
+			preset: overrides.StoragePresetNetAppStorageGRID,
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{RegionEndpoint: "http://storagegrid.example.com:8082"},
+			err:    "must be an https URL",
+		},
+		{
+			name:   "storagegrid with encryption",
+			preset: overrides.StoragePresetNetAppStorageGRID,
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{RegionEndpoint: "https://storagegrid.example.com", Encrypt: true},
+		},
+		{
+			name:   "ceph with encryption",
+			preset: overrides.StoragePresetCephRGW,
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{RegionEndpoint: "https://rgw.example.com", Encrypt: true},
+			err:    "does not support server-side encryption",
+		},
+		{
+			name:   "no region endpoint",
+			preset: overrides.StoragePresetQuobyte,
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{},
+			err:    "requires spec.storage.s3.regionEndpoint",
+		},
+		{
+			name:            "virtual-hosted style",
+			preset:          overrides.StoragePresetMinIO,
+			config:          &imageregistryv1.ImageRegistryConfigStorageS3{RegionEndpoint: "https://minio.example.com"},
+			addressingStyle: overrides.S3AddressingStyleVirtualHosted,
+			err:             "uses path-style requests",
+		},
+		{
+			name:   "not an s3 storage",
+			preset: overrides.StoragePresetMinIO,
+			err:    "requires spec.storage.s3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidatePreset(tc.preset, tc.config, tc.addressingStyle)
+			if tc.err == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("got %v, want an error containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+// objectLockTripper serves a bucket with or without Object Lock, and records
+// the settings written to it.
+type objectLockTripper struct {
+	exists  bool
+	locked  bool
+	written []string
+}
+
+func (r *objectLockTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	code, body := http.StatusOK, ""
+	switch {
+	case req.Method == http.MethodHead && !r.exists:
+		code = http.StatusNotFound
+		r.exists = true
+	case req.Method == http.MethodPut && req.URL.RawQuery == "":
+		r.exists = true
+		if req.Header.Get("X-Amz-Bucket-Object-Lock-Enabled") == "true" {
+			r.locked = true
+			r.written = append(r.written, "lockedBucket")
+		}
+	case req.Method == http.MethodGet && req.URL.Query().Has("object-lock") && r.locked:
+		body = "<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled><Rule><DefaultRetention><Mode>COMPLIANCE</Mode><Years>1</Years></DefaultRetention></Rule></ObjectLockConfiguration>"
+	case req.Method == http.MethodGet && req.URL.Query().Has("object-lock"):
+		code = http.StatusNotFound
+		body = "<Error><Code>ObjectLockConfigurationNotFoundError</Code><Message>Object Lock configuration does not exist for this bucket</Message></Error>"
+	case req.Method == http.MethodPut && req.URL.Query().Has("object-lock"):
+		data, _ := io.ReadAll(req.Body)
+		r.locked = true
+		r.written = append(r.written, string(data))
+	case req.Method == http.MethodPut && req.URL.Query().Has("versioning"):
+		r.written = append(r.written, "versioning")
+	case req.Method == http.MethodGet && req.URL.Query().Has("tagging"):
+		code = http.StatusNotFound
+		body = "<Error><Code>NoSuchTagSet</Code><Message>The TagSet does not exist</Message></Error>"
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}, nil
+}
+
+func TestObjectLock(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	TestFeatureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(
+		[]configv1.FeatureGateName{util.TestFeatureGateName},
+		[]configv1.FeatureGateName{},
+	)
+
+	retention := "<DefaultRetention><Days>7</Days><Mode>GOVERNANCE</Mode></DefaultRetention>"
+	for _, tt := range []struct {
+		name            string
+		managementState string
+		rt              *objectLockTripper
+		overrides       string
+		expectedWritten []string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:            "managed bucket created with object lock",
+			rt:              &objectLockTripper{},
+			overrides:       `{"storage":{"s3":{"objectLock":{"enabled":true,"retentionDays":7}}}}`,
+			expectedWritten: []string{"lockedBucket", retention},
+			expectedReason:  "Enable Object Lock Successful",
+			expectedMessage: "objects are retained for 7 days in GOVERNANCE mode",
+		},
+		{
+			name:            "object lock enabled on a managed bucket",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			rt:              &objectLockTripper{exists: true},
+			overrides:       `{"storage":{"s3":{"objectLock":{"enabled":true,"retentionDays":7}}}}`,
+			expectedWritten: []string{"versioning", retention},
+			expectedReason:  "Enable Object Lock Successful",
+			expectedMessage: "objects are retained for 7 days in GOVERNANCE mode",
+		},
+		{
+			name:            "object lock detected on a user provided bucket",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			rt:              &objectLockTripper{exists: true, locked: true},
+			expectedReason:  "Object Lock Detected",
+			expectedMessage: "objects are retained for 1 years in COMPLIANCE mode",
+		},
+		{
+			name:            "bucket without object lock",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			rt:              &objectLockTripper{exists: true},
+			expectedReason:  "Object Lock Not Enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: tt.managementState,
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket: "a-bucket",
+						},
+					},
+					OperatorSpec: operatorapi.OperatorSpec{
+						UnsupportedConfigOverrides: runtime.RawExtension{
+							Raw: []byte(tt.overrides),
+						},
+					},
+				},
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.S3, &listers.StorageListers, TestFeatureGateAccessor)
+			drv.roundTripper = tt.rt
+
+			if !objectLockChanged(config) {
+				t.Errorf("expected the storage to be changed until object lock is checked")
+			}
+			if err := drv.CreateStorage(config); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+
+			if len(tt.rt.written) != len(tt.expectedWritten) {
+				t.Fatalf("expected %d settings to be written, got %q", len(tt.expectedWritten), tt.rt.written)
+			}
+			for i, expected := range tt.expectedWritten {
+				if !strings.Contains(tt.rt.written[i], expected) {
+					t.Errorf("expected %s to be written, got %s", expected, tt.rt.written[i])
+				}
+			}
+			cond := util.FetchCondition(config, defaults.StorageObjectLockEnabled)
+			if cond.Reason != tt.expectedReason || !strings.Contains(cond.Message, tt.expectedMessage) {
+				t.Errorf("unexpected condition %s %s: %s", cond.Status, cond.Reason, cond.Message)
+			}
+			if objectLockChanged(config) {
+				t.Errorf("expected the storage to be unchanged once object lock is checked")
+			}
+
+			if !tt.rt.locked {
+				return
+			}
+			config.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+			config.Status.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+			retry, err := drv.RemoveStorage(config)
+			if retry || err != nil {
+				t.Fatalf("expected the bucket to be kept, got %t %v", retry, err)
+			}
+			if cond := util.FetchCondition(config, defaults.StorageExists); cond.Reason != "Retained By Object Lock" {
+				t.Errorf("unexpected condition %s %s: %s", cond.Status, cond.Reason, cond.Message)
+			}
+		})
+	}
+}
+
+func TestCheckReachability(t *testing.T) {
+	endpoint := "https://a-bucket.s3.us-west-1.amazonaws.com/"
+	response := func(code int) error {
+		return &smithy.OperationError{
+			ServiceID:     "S3",
+			OperationName: "HeadBucket",
+			Err: &awshttp.ResponseError{
+				ResponseError: &smithyhttp.ResponseError{
+					Response: &smithyhttp.Response{Response: &http.Response{StatusCode: code}},
+					Err:      fmt.Errorf("status code %d", code),
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		reason string
+		host   bool
+	}{
+		{
+			name:   "bucket exists",
+			reason: "EndpointReachable",
+		},
+		{
+			name:   "bucket not found",
+			err:    response(http.StatusNotFound),
+			reason: "EndpointReachable",
+		},
+		{
+			name:   "denied by the endpoint policy",
+			err:    response(http.StatusForbidden),
+			reason: "EndpointAccessDenied",
+		},
+		{
+			name:   "no DNS record",
+			err:    &url.Error{Op: "Head", URL: endpoint, Err: &net.DNSError{Err: "no such host", Name: "a-bucket.s3.us-west-1.amazonaws.com", IsNotFound: true}},
+			reason: "EndpointNotResolvable",
+			host:   true,
+		},
+		{
+			name:   "no route to the endpoint",
+			err:    &url.Error{Op: "Head", URL: endpoint, Err: context.DeadlineExceeded},
+			reason: "EndpointTimeout",
+			host:   true,
+		},
+		{
+			name:   "connection refused",
+			err:    &url.Error{Op: "Head", URL: endpoint, Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}},
+			reason: "EndpointUnreachable",
+			host:   true,
+		},
+		{
+			name:   "untrusted certificate",
+			err:    &url.Error{Op: "Head", URL: endpoint, Err: x509.UnknownAuthorityError{}},
+			reason: "EndpointCertificateInvalid",
+			host:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := checkReachability(tc.err)
+			if result.reason != tc.reason {
+				t.Errorf("expected the reason %s, got %s: %s", tc.reason, result.reason, result.message)
+			}
+			if (result.status == operatorapi.ConditionTrue) != (tc.reason == "EndpointReachable") {
+				t.Errorf("unexpected status %s: %s", result.status, result.message)
+			}
+			if tc.host && !strings.Contains(result.message, "a-bucket.s3.us-west-1.amazonaws.com") {
+				t.Errorf("expected the message to name the endpoint, got %s", result.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// versioningMessage returns the message of the StorageVersioningEnabled
+// condition once versioning is enabled.
+func versioningMessage(versioning *overrides.S3Versioning, managesLifecycle bool) string {
+	switch {
+	case versioning.NoncurrentVersionExpirationDays == 0:
+		return "Versioning is enabled on the S3 bucket, noncurrent versions are kept"
+	case !managesLifecycle:
+		return "Versioning is enabled on the S3 bucket, noncurrent versions are expired by the externally managed lifecycle configuration"
+	default:
+		return fmt.Sprintf("Versioning is enabled on the S3 bucket, noncurrent versions expire after %d days", versioning.NoncurrentVersionExpirationDays)
+	}
+}
+
+// noncurrentVersionExpirationDays returns the number of days after which the
+// lifecycle configuration expires noncurrent versions, zero if they are kept.
+func noncurrentVersionExpirationDays(versioning *overrides.S3Versioning) int32 {
+	if versioning == nil {
+		return 0
+	}
+	return versioning.NoncurrentVersionExpirationDays
+}
+
+// applyVersioning enables the versioning of the managed bucket when it is
+// requested. Versioning can not be disabled once it has been enabled, it is
+// suspended when it is not requested anymore: the existing versions are kept
+// but new ones are not created.
+func (d *driver) applyVersioning(cr *imageregistryv1.Config, svc *s3.Client, versioning *overrides.S3Versioning, managesLifecycle bool) {
+	if versioning == nil {
+		if util.FetchCondition(cr, defaults.StorageVersioningEnabled).Type == "" {
+			return
+		}
+		_, err := svc.PutBucketVersioning(d.Context, &s3.PutBucketVersioningInput{
+			Bucket: aws.String(d.Config.Bucket),
+			VersioningConfiguration: &s3types.VersioningConfiguration{
+				Status: s3types.BucketVersioningStatusSuspended,
+			},
+		})
+		if err != nil {
+			reportVersioningError(cr, err)
+			return
+		}
+		klog.Infof("versioning of the S3 bucket %s suspended", d.Config.Bucket)
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageVersioningEnabled)
+		return
+	}
+
+	_, err := svc.PutBucketVersioning(d.Context, &s3.PutBucketVersioningInput{
+		Bucket: aws.String(d.Config.Bucket),
+		VersioningConfiguration: &s3types.VersioningConfiguration{
+			Status: s3types.BucketVersioningStatusEnabled,
+		},
+	})
+	if err != nil {
+		reportVersioningError(cr, err)
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionTrue, "Enable Versioning Successful", versioningMessage(versioning, managesLifecycle))
+}
+
+func reportVersioningError(cr *imageregistryv1.Config, err error) {
+	if code, ok := apiErrorCode(err); ok {
+		util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionFalse, code, err.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// versioningChanged returns true if the versioning requested for a managed
+// bucket is not applied yet, or if it has to be suspended.
+func versioningChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		return false
+	}
+	versioning, err := configOverrides.S3Versioning()
+	if err != nil {
+		return false
+	}
+	cond := util.FetchCondition(cr, defaults.StorageVersioningEnabled)
+	if versioning == nil {
+		return cond.Type != ""
+	}
+	return cond.Status != operatorapi.ConditionTrue || cond.Message != versioningMessage(versioning, configOverrides.S3ManagedFeatures().ManagesLifecycle())
+}
+
+// deleteObjectVersions deletes the noncurrent versions and the delete markers
+// left in a bucket once its objects are deleted. The bucket can not be
+// deleted while they exist.
+func deleteObjectVersions(ctx context.Context, svc *s3.Client, bucket string) error {
+	paginator := s3.NewListObjectVersionsPaginator(svc, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		var objects []s3types.ObjectIdentifier
+		for _, version := range page.Versions {
+			objects = append(objects, s3types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, s3types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		klog.Infof("deleting %d object versions of the bucket %s", len(objects), bucket)
+		output, err := svc.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if len(output.Errors) > 0 {
+			e := output.Errors[0]
+			return &smithy.GenericAPIError{
+				Code:    aws.ToString(e.Code),
+				Message: fmt.Sprintf("unable to delete version %s of %s: %s (and %d more errors)", aws.ToString(e.VersionId), aws.ToString(e.Key), aws.ToString(e.Message), len(output.Errors)-1),
+			}
+		}
+	}
+	return nil
+}
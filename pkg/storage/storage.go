@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
@@ -15,6 +16,7 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/gcs"
@@ -86,9 +88,105 @@ type Driver interface {
 	// the operator to determine if the storage backend is changed and the
 	// data potentially needs to be migrated.
 	ID() string
+
+	// Capabilities returns what the storage backend supports.
+	Capabilities() Capabilities
+}
+
+// Capabilities describes what a storage backend supports.
+type Capabilities = util.Capabilities
+
+// AccessGranter is implemented by drivers that can issue short-lived
+// credentials scoped to the registry storage, for tools that need direct
+// access to it (migrations, audits).
+type AccessGranter interface {
+	// GrantAccess returns credentials that expire after duration, and
+	// their expiration time. With readOnly the credentials can only list
+	// and read objects.
+	GrantAccess(readOnly bool, duration time.Duration) (map[string][]byte, time.Time, error)
+}
+
+// RemovalOptions controls the deletion of the objects of a bucket.
+type RemovalOptions = util.RemovalOptions
+
+// ChunkedRemover is implemented by drivers that delete the objects of the
+// storage before they remove it. The objects are deleted in chunks, and the
+// deletion resumes from its checkpoint when it is interrupted.
+type ChunkedRemover interface {
+	// SetRemovalOptions sets how RemoveStorage deletes the objects.
+	SetRemovalOptions(opts RemovalOptions)
+}
+
+// PresetConfigurable is implemented by drivers whose storage can be an
+// on-prem product configured by a preset.
+type PresetConfigurable interface {
+	// SetPreset sets the on-prem product the storage is.
+	SetPreset(preset overrides.StoragePreset)
+}
+
+// AccelerationConfigurable is implemented by drivers whose storage can be
+// reached through an accelerated endpoint.
+type AccelerationConfigurable interface {
+	// SetAccelerate makes the registry use the accelerated endpoint.
+	SetAccelerate(accelerate bool)
+}
+
+// TrustedCAConfigurable is implemented by drivers whose storage endpoints
+// can be served with the certificates of a private CA.
+type TrustedCAConfigurable interface {
+	// SetTrustedCA sets the name of the config map in the openshift-config
+	// namespace with the CA bundle of the storage endpoints.
+	SetTrustedCA(name string)
+}
+
+// WriteProber is implemented by drivers that can check whether the storage
+// accepts writes. A storage can stop accepting writes while it can still be
+// read, for example when its quota is exceeded.
+type WriteProber interface {
+	// ProbeWrite writes the object util.WriteProbeObject to the storage and
+	// deletes it.
+	ProbeWrite(*imageregistryv1.Config) error
+}
+
+// Validator is implemented by drivers that can check that the registry will
+// be able to use the storage before it is rolled out with it.
+type Validator interface {
+	// Validate writes the object util.ValidationProbeObject to the storage,
+	// reads it back and deletes it.
+	Validate(*imageregistryv1.Config) error
+}
+
+// URLSigner is implemented by drivers that can sign the URLs the registry
+// redirects the blob downloads to.
+type URLSigner interface {
+	// SignURL returns a pre-signed URL that downloads the object key of
+	// the storage until expiry.
+	SignURL(key string, expiry time.Duration) (string, error)
+}
+
+// Usage is the amount of data in the storage of the registry.
+type Usage = util.Usage
+
+// UsageReporter is implemented by drivers that can measure the data in the
+// storage of the registry. The objects are listed, so it can take a while on
+// large storages.
+type UsageReporter interface {
+	// StorageUsage returns the total size and the number of the objects
+	// in the storage.
+	StorageUsage() (Usage, error)
 }
 
 func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.StorageListers, fg featuregates.FeatureGateAccess) (Driver, error) {
+	name, driver, err := newDriver(cfg, kubeconfig, listers, fg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ReportStorageType(name)
+	return driver, nil
+}
+
+// newDriver returns the driver of the storage cfg and its name.
+func newDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.StorageListers, fg featuregates.FeatureGateAccess) (string, Driver, error) {
 	var names []string
 	var drivers []Driver
 
@@ -123,7 +221,7 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 	if cfg.PVC != nil {
 		drv, err := pvc.NewDriver(cfg.PVC, kubeconfig)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 		names = append(names, "PVC")
 		drivers = append(drivers, drv)
@@ -137,13 +235,12 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 
 	switch len(drivers) {
 	case 0:
-		return nil, ErrStorageNotConfigured
+		return "", nil, ErrStorageNotConfigured
 	case 1:
-		metrics.ReportStorageType(names[0])
-		return drivers[0], nil
+		return names[0], drivers[0], nil
 	}
 
-	return nil, &MultiStoragesError{names}
+	return "", nil, &MultiStoragesError{names}
 }
 
 // GetPlatformStorage returns the storage configuration that should be used
@@ -176,7 +273,6 @@ func GetPlatformStorage(listers *regopclient.StorageListers) (imageregistryv1.Im
 	case configapiv1.BareMetalPlatformType,
 		configapiv1.VSpherePlatformType,
 		configapiv1.NonePlatformType,
-		configapiv1.NutanixPlatformType,
 		configapiv1.KubevirtPlatformType,
 		configapiv1.EquinixMetalPlatformType,
 		configapiv1.AlibabaCloudPlatformType,
@@ -211,6 +307,17 @@ func GetPlatformStorage(listers *regopclient.StorageListers) (imageregistryv1.Im
 			Claim: defaults.PVCImageRegistryName,
 		}
 		replicas = 1
+	case configapiv1.NutanixPlatformType:
+		// Nutanix Objects is used when its endpoint is provided, otherwise
+		// the registry is bootstrapped as "Removed".
+		endpoint, err := s3.NutanixObjectsEndpoint(listers.Secrets)
+		if err != nil {
+			return cfg, 0, err
+		}
+		if endpoint != "" {
+			cfg.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{}
+			replicas = 2
+		}
 	case configapiv1.OvirtPlatformType:
 		cfg.PVC = &imageregistryv1.ImageRegistryConfigStoragePVC{
 			Claim: defaults.PVCImageRegistryName,
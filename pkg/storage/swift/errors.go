@@ -0,0 +1,18 @@
+package swift
+
+import (
+	"errors"
+
+	"github.com/gophercloud/gophercloud/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// classifyError returns err as a util.StorageError when its kind is known.
+func classifyError(err error) error {
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &codeErr) {
+		return util.ClassifyError(err, codeErr.Actual)
+	}
+	return util.ClassifyError(err, 0)
+}
@@ -388,12 +388,36 @@ func ensureAuthURLHasAPIVersion(authURL, authVersion string) (string, error) {
 	return authURL + "v" + authVersion, nil
 }
 
+// recordOperation records an operation on the container in the storage audit
+// trail, with the transaction ID Swift gave to the request.
+func recordOperation(operation, container string, header http.Header, err error) {
+	util.RecordStorageOperation(operation, "swift://"+container, header.Get("X-Trans-Id"), err)
+}
+
 func (d *driver) containerExists(client *gophercloud.ServiceClient, containerName string) error {
 	_, err := containers.Get(context.TODO(), client, containerName, containers.GetOpts{}).Extract()
 	return err
 }
 
-func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+// StorageUsage returns the bytes and the objects of the registry container
+// reported by Swift.
+func (d *driver) StorageUsage() (usage util.Usage, err error) {
+	defer func() { err = classifyError(err) }()
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return usage, err
+	}
+	header, err := containers.Get(context.TODO(), client, d.Config.Container, containers.GetOpts{}).Extract()
+	if err != nil {
+		return usage, err
+	}
+	usage.Bytes = header.BytesUsed
+	usage.Objects = header.ObjectCount
+	return usage, nil
+}
+
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (exists bool, err error) {
+	defer func() { err = classifyError(err) }()
 	client, err := d.getSwiftClient()
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Could not connect to registry storage", err.Error())
@@ -423,7 +447,8 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
-func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) (err error) {
+	defer func() { err = classifyError(err) }()
 	client, err := d.getSwiftClient()
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, err.Error(), err.Error())
@@ -482,7 +507,9 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 			},
 		}
 
-		_, err = containers.Create(context.TODO(), client, cr.Spec.Storage.Swift.Container, createOps).Extract()
+		result := containers.Create(context.TODO(), client, cr.Spec.Storage.Swift.Container, createOps)
+		_, err = result.Extract()
+		recordOperation("CreateContainer", cr.Spec.Storage.Swift.Container, result.Header, err)
 		if err != nil {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Creation Failed", err.Error())
 			return err
@@ -504,7 +531,8 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
-func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err error) {
+	defer func() { err = classifyError(err) }()
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged ||
 		cr.Spec.Storage.Swift.Container == "" {
 		return false, nil
@@ -546,7 +574,9 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		}
 	}
 
-	_, err = containers.Delete(context.TODO(), client, cr.Spec.Storage.Swift.Container).Extract()
+	result := containers.Delete(context.TODO(), client, cr.Spec.Storage.Swift.Container)
+	_, err = result.Extract()
+	recordOperation("DeleteContainer", cr.Spec.Storage.Swift.Container, result.Header, err)
 	if err != nil {
 		if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, err.Error(), err.Error())
@@ -581,3 +611,12 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 func (d *driver) ID() string {
 	return d.Config.Container
 }
+
+// Capabilities returns the capabilities of Swift storage. The registry
+// cannot redirect clients to Swift without temporary URL keys, which the
+// operator does not configure.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiWriterSafe: true,
+	}
+}
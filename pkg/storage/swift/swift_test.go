@@ -26,6 +26,7 @@ import (
 	configlisters "github.com/openshift/client-go/config/listers/config/v1"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const (
@@ -1215,3 +1216,12 @@ func TestConfigStatusUpdate(t *testing.T) {
 		spew.Dump(status)
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	expected := util.Capabilities{
+		MultiWriterSafe: true,
+	}
+	if caps := (&driver{}).Capabilities(); caps != expected {
+		t.Errorf("expected Swift storage capabilities %+v, got %+v", expected, caps)
+	}
+}
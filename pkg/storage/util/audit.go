@@ -0,0 +1,75 @@
+package util
+
+import (
+	"sync"
+
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// OperationSucceeded and OperationFailed are the outcomes of a storage
+	// operation.
+	OperationSucceeded = "Succeeded"
+	OperationFailed    = "Failed"
+)
+
+// StorageOperation is an operation of the operator that changed, or tried to
+// change, the resources of the cloud account of the registry storage.
+type StorageOperation struct {
+	Time      metaapi.Time `json:"time"`
+	Operation string       `json:"operation"`
+	Resource  string       `json:"resource"`
+	// RequestID is the ID the cloud provider gave to the request, when it
+	// returns one.
+	RequestID string `json:"requestID,omitempty"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+}
+
+// storageOperations holds the operations recorded by the storage drivers
+// until they are written to the audit trail.
+var storageOperations struct {
+	mtx sync.Mutex
+	ops []StorageOperation
+}
+
+// RecordStorageOperation records that operation was run on resource, with err
+// as its outcome. The storage drivers record the operations that create,
+// delete or reconfigure cloud resources.
+func RecordStorageOperation(operation, resource, requestID string, err error) {
+	op := StorageOperation{
+		Time:      metaapi.Now(),
+		Operation: operation,
+		Resource:  resource,
+		RequestID: requestID,
+		Outcome:   OperationSucceeded,
+	}
+	if err != nil {
+		op.Outcome = OperationFailed
+		op.Error = err.Error()
+	}
+
+	storageOperations.mtx.Lock()
+	defer storageOperations.mtx.Unlock()
+	storageOperations.ops = append(storageOperations.ops, op)
+}
+
+// TakeStorageOperations returns the recorded operations that were not
+// written to the audit trail yet, and forgets them.
+func TakeStorageOperations() []StorageOperation {
+	storageOperations.mtx.Lock()
+	defer storageOperations.mtx.Unlock()
+
+	ops := storageOperations.ops
+	storageOperations.ops = nil
+	return ops
+}
+
+// ReturnStorageOperations puts back operations that could not be written to
+// the audit trail, they are written with the next ones.
+func ReturnStorageOperations(ops []StorageOperation) {
+	storageOperations.mtx.Lock()
+	defer storageOperations.mtx.Unlock()
+
+	storageOperations.ops = append(ops, storageOperations.ops...)
+}
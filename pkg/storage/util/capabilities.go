@@ -0,0 +1,22 @@
+package util
+
+// Capabilities describes what a storage backend supports. The controllers
+// consult them instead of checking the type of the storage.
+type Capabilities struct {
+	// SupportsRedirect is true when clients can be redirected to the
+	// storage to download blobs.
+	SupportsRedirect bool
+	// SupportsEncryptionConfig is true when the operator can configure
+	// the encryption of the storage.
+	SupportsEncryptionConfig bool
+	// SupportsTagging is true when the operator can tag or label the
+	// storage with the cluster metadata.
+	SupportsTagging bool
+	// SupportsManagedLifecycle is true when the operator can configure
+	// lifecycle rules of the storage, such as the cleanup of incomplete
+	// uploads.
+	SupportsManagedLifecycle bool
+	// MultiWriterSafe is true when several registry replicas can share
+	// the storage and write to it at the same time.
+	MultiWriterSafe bool
+}
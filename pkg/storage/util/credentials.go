@@ -0,0 +1,93 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// CredentialsSource tells which secret the storage credentials are read from.
+type CredentialsSource string
+
+const (
+	// CredentialsSourceUser is the secret provided by the administrator,
+	// usually with long-lived keys.
+	CredentialsSourceUser CredentialsSource = "User"
+	// CredentialsSourceCluster is the secret minted by the cloud credential
+	// operator, usually with a short-lived identity (STS, workload identity).
+	CredentialsSourceCluster CredentialsSource = "Cluster"
+)
+
+// CredentialsPath describes the storage credentials the operator uses.
+type CredentialsPath struct {
+	Source CredentialsSource
+	// MigrationUntil is the end of the credentials migration window, it is
+	// zero if no migration is in progress.
+	MigrationUntil time.Time
+}
+
+// Fallback returns true if the user provided credentials are used because
+// the cluster credentials are not usable during a migration window.
+func (p CredentialsPath) Fallback() bool {
+	return !p.MigrationUntil.IsZero() && p.Source == CredentialsSourceUser
+}
+
+// CredentialsSecret returns the secret with the storage credentials.
+//
+// The user provided secret takes precedence over the cluster minted one,
+// unless it has the CredentialsMigrationUntilAnnotation. In that case the
+// cluster credentials are preferred if usable returns true for them, and the
+// user provided ones are kept as a fallback until the end of the migration
+// window. After the window only the cluster credentials are used.
+//
+// On errors, the returned source tells which secret could not be read.
+func CredentialsSecret(lister corelisters.SecretNamespaceLister, usable func(*corev1.Secret) bool, now time.Time) (*corev1.Secret, CredentialsPath, error) {
+	user, err := lister.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if errors.IsNotFound(err) {
+		user = nil
+	} else if err != nil {
+		return nil, CredentialsPath{Source: CredentialsSourceUser}, err
+	}
+
+	var until time.Time
+	if user != nil {
+		value, ok := user.Annotations[defaults.CredentialsMigrationUntilAnnotation]
+		if !ok {
+			return user, CredentialsPath{Source: CredentialsSourceUser}, nil
+		}
+		until, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, CredentialsPath{Source: CredentialsSourceUser}, fmt.Errorf("invalid annotation %s on secret %s/%s: %w", defaults.CredentialsMigrationUntilAnnotation, user.Namespace, user.Name, err)
+		}
+	}
+
+	cluster, err := lister.Get(defaults.CloudCredentialsName)
+	if err == nil && (user == nil || usable(cluster)) {
+		return cluster, CredentialsPath{Source: CredentialsSourceCluster, MigrationUntil: until}, nil
+	}
+	if user != nil && now.Before(until) {
+		klog.Warningf("the cluster storage credentials are not usable, falling back to the secret %s/%s until %s", user.Namespace, user.Name, until.Format(time.RFC3339))
+		return user, CredentialsPath{Source: CredentialsSourceUser, MigrationUntil: until}, nil
+	}
+	if err != nil {
+		return nil, CredentialsPath{Source: CredentialsSourceCluster, MigrationUntil: until}, err
+	}
+	return cluster, CredentialsPath{Source: CredentialsSourceCluster, MigrationUntil: until}, nil
+}
+
+// TokenFileReadable returns true if path is empty (long-lived credentials) or
+// if the token file can be read.
+func TokenFileReadable(path string) bool {
+	if path == "" {
+		return true
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && len(data) > 0
+}
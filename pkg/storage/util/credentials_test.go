@@ -0,0 +1,121 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestCredentialsSecret(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	userSecret := func(until string) *corev1.Secret {
+		sec := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			},
+		}
+		if until != "" {
+			sec.Annotations = map[string]string{
+				defaults.CredentialsMigrationUntilAnnotation: until,
+			}
+		}
+		return sec
+	}
+	clusterSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      defaults.CloudCredentialsName,
+		},
+	}
+
+	for _, tt := range []struct {
+		name          string
+		secrets       []*corev1.Secret
+		clusterUsable bool
+		expected      string
+		fallback      bool
+		err           bool
+	}{
+		{
+			name:          "user credentials",
+			secrets:       []*corev1.Secret{userSecret(""), clusterSecret},
+			clusterUsable: true,
+			expected:      defaults.ImageRegistryPrivateConfigurationUser,
+		},
+		{
+			name:          "cluster credentials",
+			secrets:       []*corev1.Secret{clusterSecret},
+			clusterUsable: false,
+			expected:      defaults.CloudCredentialsName,
+		},
+		{
+			name:          "migration with usable cluster credentials",
+			secrets:       []*corev1.Secret{userSecret("2026-10-02T00:00:00Z"), clusterSecret},
+			clusterUsable: true,
+			expected:      defaults.CloudCredentialsName,
+		},
+		{
+			name:          "migration with unusable cluster credentials",
+			secrets:       []*corev1.Secret{userSecret("2026-10-02T00:00:00Z"), clusterSecret},
+			clusterUsable: false,
+			expected:      defaults.ImageRegistryPrivateConfigurationUser,
+			fallback:      true,
+		},
+		{
+			name:     "migration without cluster credentials",
+			secrets:  []*corev1.Secret{userSecret("2026-10-02T00:00:00Z")},
+			expected: defaults.ImageRegistryPrivateConfigurationUser,
+			fallback: true,
+		},
+		{
+			name:          "expired migration window",
+			secrets:       []*corev1.Secret{userSecret("2026-09-30T00:00:00Z"), clusterSecret},
+			clusterUsable: false,
+			expected:      defaults.CloudCredentialsName,
+		},
+		{
+			name:    "expired migration window without cluster credentials",
+			secrets: []*corev1.Secret{userSecret("2026-09-30T00:00:00Z")},
+			err:     true,
+		},
+		{
+			name:    "invalid migration window",
+			secrets: []*corev1.Secret{userSecret("tomorrow"), clusterSecret},
+			err:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, sec := range tt.secrets {
+				if err := indexer.Add(sec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			lister := corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+
+			sec, path, err := CredentialsSecret(lister, func(*corev1.Secret) bool { return tt.clusterUsable }, now)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got secret %s", sec.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sec.Name != tt.expected {
+				t.Errorf("expected secret %s, got %s", tt.expected, sec.Name)
+			}
+			if path.Fallback() != tt.fallback {
+				t.Errorf("expected fallback %t, got %t", tt.fallback, path.Fallback())
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ErrorKind classifies the errors of the storage drivers. The kinds are the
+// same for every cloud, so they can be used by remediation tooling.
+type ErrorKind string
+
+const (
+	// ErrorKindNotFound means that the storage (bucket, container,
+	// account) does not exist.
+	ErrorKindNotFound ErrorKind = "NotFound"
+	// ErrorKindPermissionDenied means that the credentials are rejected or
+	// lack a permission.
+	ErrorKindPermissionDenied ErrorKind = "PermissionDenied"
+	// ErrorKindThrottled means that the cloud provider rate limited the
+	// operator or is temporarily unavailable.
+	ErrorKindThrottled ErrorKind = "Throttled"
+	// ErrorKindInvalidConfig means that the storage configuration is
+	// rejected by the operator or by the cloud provider.
+	ErrorKindInvalidConfig ErrorKind = "InvalidConfig"
+	// ErrorKindTransientNetwork means that the cloud provider could not be
+	// reached.
+	ErrorKindTransientNetwork ErrorKind = "TransientNetwork"
+)
+
+// StorageError is an error of a storage driver with its kind.
+type StorageError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewStorageError returns err classified as kind, or nil if err is nil.
+func NewStorageError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StorageError{Kind: kind, Err: err}
+}
+
+func (e *StorageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// Reason returns the condition reason for the error, for example
+// StoragePermissionDenied.
+func (e *StorageError) Reason() string {
+	return "Storage" + string(e.Kind)
+}
+
+// Permanent returns whether the error needs an action from the
+// administrator to go away.
+func (e *StorageError) Permanent() bool {
+	return e.Kind == ErrorKindPermissionDenied || e.Kind == ErrorKindInvalidConfig
+}
+
+// ErrorKindForHTTPStatus returns the kind of an error response of a cloud
+// provider API.
+func ErrorKindForHTTPStatus(code int) (ErrorKind, bool) {
+	switch code {
+	case http.StatusNotFound:
+		return ErrorKindNotFound, true
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindPermissionDenied, true
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrorKindThrottled, true
+	case http.StatusBadRequest:
+		return ErrorKindInvalidConfig, true
+	}
+	return "", false
+}
+
+// s3ErrorKinds are the kinds of the error codes of the S3 compatible APIs
+// (AWS, IBM COS).
+var s3ErrorKinds = map[string]ErrorKind{
+	"NoSuchBucket":                       ErrorKindNotFound,
+	"NotFound":                           ErrorKindNotFound,
+	"AccessDenied":                       ErrorKindPermissionDenied,
+	"Forbidden":                          ErrorKindPermissionDenied,
+	"InvalidAccessKeyId":                 ErrorKindPermissionDenied,
+	"InvalidClientTokenId":               ErrorKindPermissionDenied,
+	"SignatureDoesNotMatch":              ErrorKindPermissionDenied,
+	"ExpiredToken":                       ErrorKindPermissionDenied,
+	"SlowDown":                           ErrorKindThrottled,
+	"Throttling":                         ErrorKindThrottled,
+	"ThrottlingException":                ErrorKindThrottled,
+	"RequestLimitExceeded":               ErrorKindThrottled,
+	"ServiceUnavailable":                 ErrorKindThrottled,
+	"InvalidBucketName":                  ErrorKindInvalidConfig,
+	"InvalidLocationConstraint":          ErrorKindInvalidConfig,
+	"IllegalLocationConstraintException": ErrorKindInvalidConfig,
+	"RequestError":                       ErrorKindTransientNetwork,
+}
+
+// ErrorKindForS3Code returns the kind of an error code of an S3 compatible
+// API.
+func ErrorKindForS3Code(code string) (ErrorKind, bool) {
+	kind, ok := s3ErrorKinds[code]
+	return kind, ok
+}
+
+// ClassifyError returns err as a StorageError. The kind is taken from
+// statusCode when it is known, otherwise network errors are classified as
+// transient. Errors that cannot be classified and errors that are already
+// classified are returned as they are.
+func ClassifyError(err error, statusCode int) error {
+	if err == nil {
+		return nil
+	}
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return err
+	}
+	if kind, ok := ErrorKindForHTTPStatus(statusCode); ok {
+		return NewStorageError(kind, err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return NewStorageError(ErrorKindTransientNetwork, err)
+	}
+	return err
+}
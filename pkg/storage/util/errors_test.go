@@ -0,0 +1,99 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	dnsErr := &net.DNSError{Err: "no such host", Name: "storage.example.com"}
+	classified := NewStorageError(ErrorKindInvalidConfig, fmt.Errorf("bad region"))
+
+	for _, tt := range []struct {
+		name       string
+		err        error
+		statusCode int
+		kind       ErrorKind
+		permanent  bool
+	}{
+		{
+			name:       "not found",
+			err:        fmt.Errorf("no such bucket"),
+			statusCode: 404,
+			kind:       ErrorKindNotFound,
+		},
+		{
+			name:       "forbidden",
+			err:        fmt.Errorf("access denied"),
+			statusCode: 403,
+			kind:       ErrorKindPermissionDenied,
+			permanent:  true,
+		},
+		{
+			name:       "throttled",
+			err:        fmt.Errorf("slow down"),
+			statusCode: 429,
+			kind:       ErrorKindThrottled,
+		},
+		{
+			name:       "bad request",
+			err:        fmt.Errorf("invalid bucket name"),
+			statusCode: 400,
+			kind:       ErrorKindInvalidConfig,
+			permanent:  true,
+		},
+		{
+			name: "network error",
+			err:  fmt.Errorf("unable to reach the storage: %w", dnsErr),
+			kind: ErrorKindTransientNetwork,
+		},
+		{
+			name: "deadline exceeded",
+			err:  fmt.Errorf("request: %w", context.DeadlineExceeded),
+			kind: ErrorKindTransientNetwork,
+		},
+		{
+			name:       "already classified",
+			err:        classified,
+			statusCode: 404,
+			kind:       ErrorKindInvalidConfig,
+			permanent:  true,
+		},
+		{
+			name:       "unknown",
+			err:        fmt.Errorf("internal error"),
+			statusCode: 500,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyError(tt.err, tt.statusCode)
+			if err.Error() != tt.err.Error() {
+				t.Errorf("got message %q, want %q", err.Error(), tt.err.Error())
+			}
+
+			var storageErr *StorageError
+			if !errors.As(err, &storageErr) {
+				if tt.kind != "" {
+					t.Fatalf("got unclassified error %v, want kind %s", err, tt.kind)
+				}
+				return
+			}
+			if storageErr.Kind != tt.kind {
+				t.Errorf("got kind %s, want %s", storageErr.Kind, tt.kind)
+			}
+			if storageErr.Permanent() != tt.permanent {
+				t.Errorf("got permanent %t, want %t", storageErr.Permanent(), tt.permanent)
+			}
+			if reason := storageErr.Reason(); reason != "Storage"+string(tt.kind) {
+				t.Errorf("got reason %q", reason)
+			}
+		})
+	}
+
+	if err := ClassifyError(nil, 404); err != nil {
+		t.Errorf("got %v for a nil error", err)
+	}
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"strconv"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// The operator records these keys on the buckets, containers and accounts it
+// manages, in addition to the tags and labels requested by the user. The key
+// names are valid AWS tag keys, Azure tag names and GCP label keys.
+const (
+	ManagedByKey        = "openshift-image-registry-managed-by"
+	InfraIDKey          = "openshift-image-registry-infra-id"
+	ConfigGenerationKey = "openshift-image-registry-config-generation"
+
+	// ManagedByValue is the value of ManagedByKey.
+	ManagedByValue = "cluster-image-registry-operator"
+)
+
+// ManagedMetadata returns the metadata the operator records on the cloud
+// resources of the registry storage.
+func ManagedMetadata(infra *configv1.Infrastructure, cr *imageregistryv1.Config) map[string]string {
+	return map[string]string{
+		ManagedByKey:        ManagedByValue,
+		InfraIDKey:          infra.Status.InfrastructureName,
+		ConfigGenerationKey: strconv.FormatInt(cr.Generation, 10),
+	}
+}
+
+// ManagedByCluster returns true if metadata shows that the resource is
+// managed by the operator of the cluster infra. Resources tagged before the
+// managed metadata was introduced are recognized by legacyOwnedKey, the
+// ownership tag of the cluster, if it is not empty.
+func ManagedByCluster(metadata map[string]string, infra *configv1.Infrastructure, legacyOwnedKey string) bool {
+	if metadata[ManagedByKey] == ManagedByValue {
+		return metadata[InfraIDKey] == infra.Status.InfrastructureName
+	}
+	return legacyOwnedKey != "" && metadata[legacyOwnedKey] == "owned"
+}
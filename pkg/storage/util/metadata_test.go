@@ -0,0 +1,65 @@
+package util
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+func TestManagedByCluster(t *testing.T) {
+	infra := &configv1.Infrastructure{
+		Status: configv1.InfrastructureStatus{InfrastructureName: "cluster-abc12"},
+	}
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Generation: 3},
+	}
+	legacyKey := "kubernetes.io/cluster/cluster-abc12"
+
+	for _, tt := range []struct {
+		name     string
+		metadata map[string]string
+		expected bool
+	}{
+		{
+			name:     "managed metadata",
+			metadata: ManagedMetadata(infra, cr),
+			expected: true,
+		},
+		{
+			name: "managed by another cluster",
+			metadata: map[string]string{
+				ManagedByKey: ManagedByValue,
+				InfraIDKey:   "other-xyz34",
+				legacyKey:    "owned",
+			},
+			expected: false,
+		},
+		{
+			name:     "legacy ownership tag",
+			metadata: map[string]string{legacyKey: "owned"},
+			expected: true,
+		},
+		{
+			name:     "user resource",
+			metadata: map[string]string{"team": "registry"},
+			expected: false,
+		},
+		{
+			name:     "no metadata",
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ManagedByCluster(tt.metadata, infra, legacyKey); got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+
+	if gen := ManagedMetadata(infra, cr)[ConfigGenerationKey]; gen != "3" {
+		t.Errorf("expected config generation 3, got %q", gen)
+	}
+}
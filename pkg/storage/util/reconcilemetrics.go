@@ -0,0 +1,111 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+)
+
+// problemConditions are the conditions of the drivers that report a
+// problem when they are True.
+var problemConditions = map[string]bool{
+	defaults.StorageDegraded:             true,
+	defaults.StorageCredentialsFallback:  true,
+	defaults.StorageTokenExchangeFailing: true,
+}
+
+// stateReasons are the reasons of the conditions that are not True because
+// of the state of the storage (not created yet, removed, provisioning,
+// changed and reconciled again), not because the reconciliation failed.
+var stateReasons = map[string]bool{
+	"Storage does not exist":                   true,
+	"Bucket does not exist":                    true,
+	"PVC does not exist":                       true,
+	"S3 Bucket Deleted":                        true,
+	"GCS Bucket Deleted":                       true,
+	"IBM COS Bucket Deleted":                   true,
+	"Swift Container Deleted":                  true,
+	"IBM COS Instance Active":                  true,
+	"IBM COS Instance Provisioning":            true,
+	"IBM COS Instance Creation Successful":     true,
+	"IBM COS Resource Key Creation Successful": true,
+	"IBM COS Resource Key Valid":               true,
+	"Changed Out-of-Band":                      true,
+	"StorageNotConfigured":                     true,
+	"ContainerNotFound":                        true,
+	"ContainerDeleted":                         true,
+	"AccountNotFound":                          true,
+	"AccountDeleted":                           true,
+	"UserManaged":                              true,
+	"NotManagedByOperator":                     true,
+	"UsingClusterCredentials":                  true,
+	"HealthProbeSucceeded":                     true,
+	"Object Lock Not Enabled":                  true,
+}
+
+// metricReason matches the reasons that are used as they are in the reason
+// label. Some drivers use error messages as reasons, they would make the
+// label unbounded.
+var metricReason = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 -]{0,63}$`)
+
+// DriverName returns the name of the storage configured in cfg, as it is
+// reported in metrics.
+func DriverName(cfg *imageregistryv1.ImageRegistryConfigStorage) string {
+	switch {
+	case cfg.EmptyDir != nil:
+		return "EmptyDir"
+	case cfg.S3 != nil:
+		return "S3"
+	case cfg.Swift != nil:
+		return "Swift"
+	case cfg.GCS != nil:
+		return "GCS"
+	case cfg.IBMCOS != nil:
+		return "IBMCOS"
+	case cfg.PVC != nil:
+		return "PVC"
+	case cfg.Azure != nil:
+		return "Azure"
+	}
+	return ""
+}
+
+// reconcileError returns whether a condition set by a driver reports a
+// failed reconciliation, and the reason label of the error.
+func reconcileError(conditionType string, status operatorapi.ConditionStatus, reason string) (string, bool) {
+	if problemConditions[conditionType] {
+		if status != operatorapi.ConditionTrue {
+			return "", false
+		}
+	} else if status == operatorapi.ConditionTrue || stateReasons[reason] || strings.HasSuffix(reason, " Configuration Changed") {
+		return "", false
+	}
+	if !metricReason.MatchString(reason) {
+		return "Other", true
+	}
+	return strings.ReplaceAll(reason, " ", ""), true
+}
+
+// IsReconcileError returns whether the condition cond, set by a storage
+// driver, reports a failed reconciliation of the storage.
+func IsReconcileError(cond operatorapi.OperatorCondition) bool {
+	_, ok := reconcileError(cond.Type, cond.Status, cond.Reason)
+	return ok
+}
+
+// reportCondition updates the metrics of the reconciliation of the storage
+// for a condition set on cr.
+func reportCondition(cr *imageregistryv1.Config, conditionType string, status operatorapi.ConditionStatus, reason string) {
+	driver := DriverName(&cr.Spec.Storage)
+	if conditionType == defaults.StorageExists {
+		metrics.ReportStorageExists(driver, status == operatorapi.ConditionTrue)
+	}
+	if errorReason, ok := reconcileError(conditionType, status, reason); ok {
+		metrics.StorageReconcileError(driver, errorReason)
+	}
+}
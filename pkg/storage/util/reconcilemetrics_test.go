@@ -0,0 +1,84 @@
+package util
+
+import (
+	"testing"
+
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestReconcileError(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		conditionType string
+		status        operatorapi.ConditionStatus
+		reason        string
+		expected      string
+		isError       bool
+	}{
+		{
+			name:          "bucket exists",
+			conditionType: defaults.StorageExists,
+			status:        operatorapi.ConditionTrue,
+			reason:        "S3 Bucket Exists",
+		},
+		{
+			name:          "bucket not created yet",
+			conditionType: defaults.StorageExists,
+			status:        operatorapi.ConditionFalse,
+			reason:        "Bucket does not exist",
+		},
+		{
+			name:          "configuration changed",
+			conditionType: defaults.StorageExists,
+			status:        operatorapi.ConditionUnknown,
+			reason:        "S3 Configuration Changed",
+		},
+		{
+			name:          "creation failed",
+			conditionType: defaults.StorageExists,
+			status:        operatorapi.ConditionFalse,
+			reason:        "Creation Failed",
+			expected:      "CreationFailed",
+			isError:       true,
+		},
+		{
+			name:          "error code",
+			conditionType: defaults.StorageEncrypted,
+			status:        operatorapi.ConditionFalse,
+			reason:        "AccessDenied",
+			expected:      "AccessDenied",
+			isError:       true,
+		},
+		{
+			name:          "error message as reason",
+			conditionType: defaults.StorageExists,
+			status:        operatorapi.ConditionUnknown,
+			reason:        "Expected HTTP response code [200 204] when accessing [HEAD https://swift.example.com/v1/AUTH_x/registry], but got 401 instead",
+			expected:      "Other",
+			isError:       true,
+		},
+		{
+			name:          "health probe failed",
+			conditionType: defaults.StorageDegraded,
+			status:        operatorapi.ConditionTrue,
+			reason:        "HealthProbeFailed",
+			expected:      "HealthProbeFailed",
+			isError:       true,
+		},
+		{
+			name:          "health probe succeeded",
+			conditionType: defaults.StorageDegraded,
+			status:        operatorapi.ConditionFalse,
+			reason:        "HealthProbeSucceeded",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, isError := reconcileError(tc.conditionType, tc.status, tc.reason)
+			if reason != tc.expected || isError != tc.isError {
+				t.Errorf("expected %q, %t, got %q, %t", tc.expected, tc.isError, reason, isError)
+			}
+		})
+	}
+}
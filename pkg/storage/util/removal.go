@@ -0,0 +1,143 @@
+package util
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+)
+
+// RemovalProgress is the progress of the deletion of the objects of a
+// bucket.
+type RemovalProgress struct {
+	// Bucket is the bucket whose objects are deleted.
+	Bucket string
+	// Marker is the name of the last deleted object, the deletion resumes
+	// with the objects that sort after it.
+	Marker string
+	// Deleted is the number of objects deleted so far.
+	Deleted int64
+	// Total is the number of objects the bucket had when the deletion
+	// started.
+	Total int64
+}
+
+// Remaining returns the number of objects that are still to be deleted.
+func (p *RemovalProgress) Remaining() int64 {
+	if p.Deleted > p.Total {
+		return 0
+	}
+	return p.Total - p.Deleted
+}
+
+// RemovalCheckpoint persists the progress of the deletion of the objects of
+// a bucket.
+type RemovalCheckpoint interface {
+	// Load returns the persisted progress, or nil if there is none.
+	Load() (*RemovalProgress, error)
+	// Save persists progress.
+	Save(progress *RemovalProgress) error
+}
+
+// RemovalOptions controls the deletion of the objects of a bucket. The zero
+// value deletes the objects in chunks of the default size, without rate
+// limiting and without persisting the progress.
+type RemovalOptions struct {
+	Checkpoint RemovalCheckpoint
+	ChunkSize  int
+	// Limiter limits the rate at which objects are deleted. Its burst must
+	// not be smaller than ChunkSize.
+	Limiter *rate.Limiter
+}
+
+// ObjectDeleter lists and deletes the objects of a bucket.
+type ObjectDeleter interface {
+	// CountObjects returns the number of objects in the bucket.
+	CountObjects(ctx context.Context) (int64, error)
+	// ListObjects returns the names of up to limit objects that sort after
+	// marker, in lexical order.
+	ListObjects(ctx context.Context, marker string, limit int) ([]string, error)
+	// DeleteObjects deletes the objects names.
+	DeleteObjects(ctx context.Context, names []string) error
+}
+
+// DeleteAllObjects deletes the objects of bucket in chunks. The progress is
+// saved after each chunk, and the deletion resumes from the saved progress
+// if it was interrupted. The number of remaining objects is reported in
+// metrics.
+func DeleteAllObjects(ctx context.Context, bucket string, objects ObjectDeleter, opts RemovalOptions) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaults.StorageRemovalChunkSize
+	}
+
+	var progress *RemovalProgress
+	if opts.Checkpoint != nil {
+		saved, err := opts.Checkpoint.Load()
+		if err != nil {
+			return err
+		}
+		if saved != nil && saved.Bucket == bucket {
+			klog.Infof("resuming the deletion of the objects of the bucket %s, %d of %d objects are deleted", bucket, saved.Deleted, saved.Total)
+			progress = saved
+		}
+	}
+	if progress == nil {
+		total, err := objects.CountObjects(ctx)
+		if err != nil {
+			return err
+		}
+		klog.Infof("deleting %d objects of the bucket %s", total, bucket)
+		progress = &RemovalProgress{Bucket: bucket, Total: total}
+		if err := saveRemovalProgress(opts.Checkpoint, progress); err != nil {
+			return err
+		}
+	}
+	metrics.ReportStorageRemovalRemaining(progress.Remaining())
+
+	for {
+		names, err := objects.ListObjects(ctx, progress.Marker, chunkSize)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			if progress.Marker == "" {
+				break
+			}
+			// Objects that were created before the marker during the
+			// deletion are picked up by a last pass from the beginning.
+			progress.Marker = ""
+			continue
+		}
+
+		if opts.Limiter != nil {
+			if err := opts.Limiter.WaitN(ctx, len(names)); err != nil {
+				return err
+			}
+		}
+		if err := objects.DeleteObjects(ctx, names); err != nil {
+			return err
+		}
+
+		progress.Marker = names[len(names)-1]
+		progress.Deleted += int64(len(names))
+		klog.V(4).Infof("deleted %d objects of the bucket %s, %d remaining", progress.Deleted, bucket, progress.Remaining())
+		metrics.ReportStorageRemovalRemaining(progress.Remaining())
+		if err := saveRemovalProgress(opts.Checkpoint, progress); err != nil {
+			return err
+		}
+	}
+
+	metrics.ReportStorageRemovalRemaining(0)
+	return nil
+}
+
+func saveRemovalProgress(checkpoint RemovalCheckpoint, progress *RemovalProgress) error {
+	if checkpoint == nil {
+		return nil
+	}
+	return checkpoint.Save(progress)
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type fakeObjects struct {
+	objects map[string]bool
+	// failAfter makes DeleteObjects fail once that many chunks have been
+	// deleted, if it is positive.
+	failAfter int
+	deletes   int
+	// created is created by the first DeleteObjects call, to simulate an
+	// object uploaded during the deletion.
+	created string
+}
+
+func (f *fakeObjects) CountObjects(ctx context.Context) (int64, error) {
+	return int64(len(f.objects)), nil
+}
+
+func (f *fakeObjects) ListObjects(ctx context.Context, marker string, limit int) ([]string, error) {
+	var names []string
+	for name := range f.objects {
+		if name > marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (f *fakeObjects) DeleteObjects(ctx context.Context, names []string) error {
+	if f.failAfter > 0 && f.deletes == f.failAfter {
+		return fmt.Errorf("interrupted")
+	}
+	f.deletes++
+	for _, name := range names {
+		delete(f.objects, name)
+	}
+	if f.created != "" {
+		f.objects[f.created] = true
+		f.created = ""
+	}
+	return nil
+}
+
+type fakeCheckpoint struct {
+	progress *RemovalProgress
+	saves    int
+}
+
+func (c *fakeCheckpoint) Load() (*RemovalProgress, error) {
+	if c.progress == nil {
+		return nil, nil
+	}
+	p := *c.progress
+	return &p, nil
+}
+
+func (c *fakeCheckpoint) Save(progress *RemovalProgress) error {
+	p := *progress
+	c.progress = &p
+	c.saves++
+	return nil
+}
+
+func newFakeObjects(n int) *fakeObjects {
+	f := &fakeObjects{objects: map[string]bool{}}
+	for i := 0; i < n; i++ {
+		f.objects[fmt.Sprintf("docker/registry/v2/blobs/%04d", i)] = true
+	}
+	return f
+}
+
+func TestDeleteAllObjectsResumes(t *testing.T) {
+	ctx := context.Background()
+	objects := newFakeObjects(10)
+	objects.failAfter = 2
+	checkpoint := &fakeCheckpoint{}
+	opts := RemovalOptions{Checkpoint: checkpoint, ChunkSize: 3}
+
+	if err := DeleteAllObjects(ctx, "bucket", objects, opts); err == nil {
+		t.Fatal("expected the deletion to be interrupted")
+	}
+	expected := &RemovalProgress{
+		Bucket:  "bucket",
+		Marker:  "docker/registry/v2/blobs/0005",
+		Deleted: 6,
+		Total:   10,
+	}
+	if !reflect.DeepEqual(checkpoint.progress, expected) {
+		t.Fatalf("got progress %#+v, want %#+v", checkpoint.progress, expected)
+	}
+
+	// The deletion resumes after the marker and keeps the counters.
+	objects.failAfter = 0
+	if err := DeleteAllObjects(ctx, "bucket", objects, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.objects) != 0 {
+		t.Errorf("expected all objects to be deleted, got %v", objects.objects)
+	}
+	if checkpoint.progress.Deleted != 10 || checkpoint.progress.Remaining() != 0 {
+		t.Errorf("got progress %#+v, want 10 deleted objects", checkpoint.progress)
+	}
+}
+
+func TestDeleteAllObjectsIgnoresOtherBucket(t *testing.T) {
+	objects := newFakeObjects(4)
+	checkpoint := &fakeCheckpoint{
+		progress: &RemovalProgress{
+			Bucket:  "old-bucket",
+			Marker:  "docker/registry/v2/blobs/9999",
+			Deleted: 100,
+			Total:   200,
+		},
+	}
+
+	if err := DeleteAllObjects(context.Background(), "bucket", objects, RemovalOptions{Checkpoint: checkpoint}); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.objects) != 0 {
+		t.Errorf("expected all objects to be deleted, got %v", objects.objects)
+	}
+	expected := &RemovalProgress{
+		Bucket:  "bucket",
+		Marker:  "docker/registry/v2/blobs/0003",
+		Deleted: 4,
+		Total:   4,
+	}
+	if !reflect.DeepEqual(checkpoint.progress, expected) {
+		t.Errorf("got progress %#+v, want %#+v", checkpoint.progress, expected)
+	}
+}
+
+func TestDeleteAllObjectsCreatedBeforeMarker(t *testing.T) {
+	objects := newFakeObjects(4)
+	objects.created = "docker/registry/v2/aaaa"
+
+	if err := DeleteAllObjects(context.Background(), "bucket", objects, RemovalOptions{ChunkSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.objects) != 0 {
+		t.Errorf("expected all objects to be deleted, got %v", objects.objects)
+	}
+}
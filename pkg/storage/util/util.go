@@ -21,11 +21,33 @@ import (
 // TestFeatureGateName is a constant use in helper function for testing
 const TestFeatureGateName = "TestFeatureGate"
 
+// WriteProbeObject is the name of the object that the operator writes to the
+// storage to check that it accepts writes. It is outside of the directory of
+// the registry, so the registry never sees it.
+const WriteProbeObject = "openshift-image-registry-write-probe"
+
+// ValidationProbeObject is the name of the object that the operator writes,
+// reads and deletes to validate the storage before the registry is rolled
+// out with it.
+const ValidationProbeObject = "openshift-image-registry-validation-probe"
+
+// Usage is the amount of data in the storage of the registry.
+type Usage struct {
+	// Bytes is the total size of the objects.
+	Bytes int64
+	// Objects is the number of objects.
+	Objects int64
+}
+
 // multiDashes is a regexp matching multiple dashes in a sequence.
 var multiDashes = regexp.MustCompile(`-{2,}`)
 
-// UpdateCondition will update or add the provided condition.
+// UpdateCondition will update or add the provided condition. Conditions
+// that report a failed reconciliation are counted in the metrics of the
+// driver.
 func UpdateCondition(cr *imageregistryv1.Config, conditionType string, status operatorapi.ConditionStatus, reason string, message string) {
+	reportCondition(cr, conditionType, status, reason)
+
 	found := false
 	condition := &operatorapi.OperatorCondition{
 		Type:               conditionType,
@@ -63,13 +85,13 @@ func UpdateCondition(cr *imageregistryv1.Config, conditionType string, status op
 }
 
 // FetchCondition will return the provided condition.
-func FetchCondition(cr *imageregistryv1.Config, conditionType string) (c operatorapi.OperatorCondition) {
-	for _, c = range cr.Status.Conditions {
+func FetchCondition(cr *imageregistryv1.Config, conditionType string) operatorapi.OperatorCondition {
+	for _, c := range cr.Status.Conditions {
 		if conditionType == c.Type {
 			return c
 		}
 	}
-	return
+	return operatorapi.OperatorCondition{}
 }
 
 // GetInfrastructure gets information about the cloud platform that the cluster is
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"fmt"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// Validate checks that the registry can write, read and delete objects in the
+// storage of drv and updates the StorageValidated condition. An error is
+// returned when the validation fails, the registry must not be rolled out
+// with the storage configuration. The condition is removed for drivers that
+// cannot validate the storage, and for read-only registries.
+func Validate(cr *imageregistryv1.Config, drv Driver) error {
+	validator, ok := drv.(Validator)
+	if !ok || cr.Spec.ReadOnly {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageValidated)
+		return nil
+	}
+
+	if err := validator.Validate(cr); err != nil {
+		util.UpdateCondition(cr, defaults.StorageValidated, operatorapiv1.ConditionFalse, "ValidationFailed", fmt.Sprintf("The registry is not rolled out with the storage configuration until it can write, read and delete objects: %s", err))
+		return fmt.Errorf("storage validation failed: %w", err)
+	}
+	util.UpdateCondition(cr, defaults.StorageValidated, operatorapiv1.ConditionTrue, "ValidationSucceeded", "The registry can write, read and delete objects in the storage")
+	return nil
+}
+
+// ValidationFailed returns true if the last validation of the storage failed.
+// The storage is validated again on each sync until it succeeds.
+func ValidationFailed(cr *imageregistryv1.Config) bool {
+	cond := util.FetchCondition(cr, defaults.StorageValidated)
+	return cond.Status == operatorapiv1.ConditionFalse
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type validatorDriver struct {
+	Driver
+	err error
+}
+
+func (d *validatorDriver) Validate(cr *imageregistryv1.Config) error {
+	return d.err
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		err      error
+		readOnly bool
+		status   operatorapiv1.ConditionStatus
+		reason   string
+		failed   bool
+	}{
+		{
+			name:   "storage validated",
+			status: operatorapiv1.ConditionTrue,
+			reason: "ValidationSucceeded",
+		},
+		{
+			name:   "storage fails validation",
+			err:    fmt.Errorf("unable to read the object %s: AccessDenied", util.ValidationProbeObject),
+			status: operatorapiv1.ConditionFalse,
+			reason: "ValidationFailed",
+			failed: true,
+		},
+		{
+			name:     "read-only registry",
+			err:      fmt.Errorf("AccessDenied"),
+			readOnly: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.ReadOnly = tt.readOnly
+			err := Validate(cr, &validatorDriver{err: tt.err})
+			if tt.failed != (err != nil) {
+				t.Fatalf("expected failure %t, got %v", tt.failed, err)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StorageValidated)
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("expected %s/%s, got %s/%s: %s", tt.status, tt.reason, cond.Status, cond.Reason, cond.Message)
+			}
+			if got := ValidationFailed(cr); got != tt.failed {
+				t.Errorf("expected validation failed %t, got %t", tt.failed, got)
+			}
+		})
+	}
+
+	t.Run("driver without validation", func(t *testing.T) {
+		cr := &imageregistryv1.Config{}
+		util.UpdateCondition(cr, defaults.StorageValidated, operatorapiv1.ConditionFalse, "ValidationFailed", "")
+		if err := Validate(cr, emptydir.NewDriver(&imageregistryv1.ImageRegistryConfigStorageEmptyDir{})); err != nil {
+			t.Fatal(err)
+		}
+		if len(cr.Status.Conditions) != 0 {
+			t.Errorf("expected no conditions, got %v", cr.Status.Conditions)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"fmt"
+
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// ReportWritable checks whether the storage of drv accepts writes and updates
+// the StorageWritable condition. It must only be called once the storage is
+// known to exist and to be readable. The condition is removed for drivers
+// that cannot probe writes.
+func ReportWritable(cr *imageregistryv1.Config, drv Driver) {
+	prober, ok := drv.(WriteProber)
+	if !ok {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StorageWritable)
+		return
+	}
+
+	if err := prober.ProbeWrite(cr); err != nil {
+		klog.Warningf("the storage is readable but does not accept writes, switching the registry to read-only mode: %s", err)
+		util.UpdateCondition(cr, defaults.StorageWritable, operatorapiv1.ConditionFalse, "WriteProbeFailed", fmt.Sprintf("The storage does not accept writes, the registry is in read-only mode until it does: %s", err))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageWritable, operatorapiv1.ConditionTrue, "WriteProbeSucceeded", "The storage accepts writes")
+}
+
+// WritesFailing returns true if the last write probe of the storage failed
+// while the storage was readable. The registry is run in read-only mode
+// while the writes are failing, so that images can still be pulled.
+func WritesFailing(cr *imageregistryv1.Config) bool {
+	cond := util.FetchCondition(cr, defaults.StorageWritable)
+	return cond.Status == operatorapiv1.ConditionFalse
+}
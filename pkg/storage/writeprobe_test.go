@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type writeProberDriver struct {
+	Driver
+	err error
+}
+
+func (d *writeProberDriver) ProbeWrite(cr *imageregistryv1.Config) error {
+	return d.err
+}
+
+func TestReportWritable(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		err           error
+		status        operatorapiv1.ConditionStatus
+		reason        string
+		writesFailing bool
+	}{
+		{
+			name:   "storage accepts writes",
+			status: operatorapiv1.ConditionTrue,
+			reason: "WriteProbeSucceeded",
+		},
+		{
+			name:          "storage rejects writes",
+			err:           fmt.Errorf("QuotaExceeded: the bucket quota is exceeded"),
+			status:        operatorapiv1.ConditionFalse,
+			reason:        "WriteProbeFailed",
+			writesFailing: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			ReportWritable(cr, &writeProberDriver{err: tt.err})
+
+			cond := util.FetchCondition(cr, defaults.StorageWritable)
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("expected %s/%s, got %s/%s: %s", tt.status, tt.reason, cond.Status, cond.Reason, cond.Message)
+			}
+			if got := WritesFailing(cr); got != tt.writesFailing {
+				t.Errorf("expected writes failing %t, got %t", tt.writesFailing, got)
+			}
+		})
+	}
+
+	t.Run("driver without write probe", func(t *testing.T) {
+		cr := &imageregistryv1.Config{}
+		util.UpdateCondition(cr, defaults.StorageWritable, operatorapiv1.ConditionFalse, "WriteProbeFailed", "")
+		ReportWritable(cr, emptydir.NewDriver(&imageregistryv1.ImageRegistryConfigStorageEmptyDir{}))
+		if len(cr.Status.Conditions) != 0 {
+			t.Errorf("expected no conditions, got %v", cr.Status.Conditions)
+		}
+		if WritesFailing(cr) {
+			t.Errorf("expected writes not to be failing")
+		}
+	})
+}
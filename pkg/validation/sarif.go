@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"fmt"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifTool    = "cluster-image-registry-operator"
+	sarifToolURI = "https://github.com/openshift/cluster-image-registry-operator"
+)
+
+// SARIFLog is a Static Analysis Results Interchange Format (SARIF) 2.1.0 log.
+// Only the properties needed to report findings are defined.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri"`
+}
+
+type SARIFResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   SARIFMessage    `json:"message"`
+	Locations []SARIFLocation `json:"locations"`
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFLocation struct {
+	PhysicalLocation *SARIFPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []SARIFLogicalLocation `json:"logicalLocations"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+}
+
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type SARIFLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// SARIF converts the findings into a SARIF log with a single run, so that
+// they can be consumed by code scanning and compliance tools. The rule of a
+// finding is the field it was found in, errors are reported with the error
+// level and warnings with the warning level.
+func (fs Findings) SARIF(toolVersion string) SARIFLog {
+	results := []SARIFResult{}
+	for _, f := range fs {
+		level := "warning"
+		if f.Severity == SeverityError {
+			level = "error"
+		}
+
+		ruleID := f.Kind
+		object := fmt.Sprintf("%s/%s", f.Kind, f.Name)
+		logical := SARIFLogicalLocation{FullyQualifiedName: object, Kind: "object"}
+		if f.Field != "" {
+			ruleID = fmt.Sprintf("%s/%s", f.Kind, f.Field)
+			logical = SARIFLogicalLocation{FullyQualifiedName: object + "." + f.Field, Kind: "member"}
+		}
+
+		location := SARIFLocation{LogicalLocations: []SARIFLogicalLocation{logical}}
+		if f.File != "" {
+			location.PhysicalLocation = &SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{URI: f.File},
+			}
+		}
+
+		results = append(results, SARIFResult{
+			RuleID:    ruleID,
+			Level:     level,
+			Message:   SARIFMessage{Text: f.Message},
+			Locations: []SARIFLocation{location},
+		})
+	}
+
+	return SARIFLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []SARIFRun{
+			{
+				Tool: SARIFTool{
+					Driver: SARIFDriver{
+						Name:           sarifTool,
+						Version:        toolVersion,
+						InformationURI: sarifToolURI,
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+}
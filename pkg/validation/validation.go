@@ -0,0 +1,527 @@
+package validation
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/robfig/cron"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/overrides"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/s3"
+)
+
+// Severity indicates how serious a finding is. Findings with SeverityError
+// make the operator fail to apply the configuration, findings with
+// SeverityWarning are accepted but are likely to cause problems at runtime.
+type Severity string
+
+const (
+	SeverityError   Severity = "Error"
+	SeverityWarning Severity = "Warning"
+)
+
+// Finding is a single problem found in a configuration object.
+type Finding struct {
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name,omitempty"`
+	Field    string   `json:"field,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// File is the file the object was read from, if any.
+	File string `json:"file,omitempty"`
+}
+
+func (f Finding) String() string {
+	if f.Field == "" {
+		return fmt.Sprintf("%s %s/%s: %s", f.Severity, f.Kind, f.Name, f.Message)
+	}
+	return fmt.Sprintf("%s %s/%s: %s: %s", f.Severity, f.Kind, f.Name, f.Field, f.Message)
+}
+
+// Findings is a list of findings.
+type Findings []Finding
+
+// HasErrors returns true if at least one of the findings is an error.
+func (fs Findings) HasErrors() bool {
+	for _, f := range fs {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an error that aggregates the messages of all error findings,
+// or nil if there are none. Warnings are not included.
+func (fs Findings) Err() error {
+	var msgs []string
+	for _, f := range fs {
+		if f.Severity == SeverityError {
+			msgs = append(msgs, f.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+type findingsBuilder struct {
+	kind     string
+	name     string
+	findings Findings
+}
+
+func (b *findingsBuilder) errorf(field, format string, args ...interface{}) {
+	b.add(SeverityError, field, format, args...)
+}
+
+func (b *findingsBuilder) warningf(field, format string, args ...interface{}) {
+	b.add(SeverityWarning, field, format, args...)
+}
+
+func (b *findingsBuilder) add(severity Severity, field, format string, args ...interface{}) {
+	b.findings = append(b.findings, Finding{
+		Kind:     b.kind,
+		Name:     b.name,
+		Field:    field,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// ConfiguredStorages returns the names of the storage backends that are set
+// in cfg. The operator expects exactly one of them to be configured.
+func ConfiguredStorages(cfg *imageregistryv1.ImageRegistryConfigStorage) []string {
+	var names []string
+	if cfg.EmptyDir != nil {
+		names = append(names, "EmptyDir")
+	}
+	if cfg.S3 != nil {
+		names = append(names, "S3")
+	}
+	if cfg.Swift != nil {
+		names = append(names, "Swift")
+	}
+	if cfg.GCS != nil {
+		names = append(names, "GCS")
+	}
+	if cfg.IBMCOS != nil {
+		names = append(names, "IBMCOS")
+	}
+	if cfg.PVC != nil {
+		names = append(names, "PVC")
+	}
+	if cfg.Azure != nil {
+		names = append(names, "Azure")
+	}
+	return names
+}
+
+// ValidateConfig checks the image registry configuration offline. It reports
+// the errors the operator runs into when it applies the configuration, and
+// the settings that are likely to cause problems at runtime.
+func ValidateConfig(cr *imageregistryv1.Config) Findings {
+	b := &findingsBuilder{kind: "Config", name: cr.Name}
+	spec := &cr.Spec
+
+	if spec.Replicas < 0 {
+		b.errorf("spec.replicas", "replicas must be greater than or equal to 0")
+	}
+
+	switch spec.RolloutStrategy {
+	case "", string(appsapi.RollingUpdateDeploymentStrategyType), string(appsapi.RecreateDeploymentStrategyType):
+	default:
+		b.errorf("spec.rolloutStrategy", "unsupported rollout strategy %q, must be one of %s or %s", spec.RolloutStrategy, appsapi.RollingUpdateDeploymentStrategyType, appsapi.RecreateDeploymentStrategyType)
+	}
+
+	validateStorage(b, spec)
+	validateRequests(b, "spec.requests.read", spec.Requests.Read)
+	validateRequests(b, "spec.requests.write", spec.Requests.Write)
+	validateRoutes(b, spec)
+	validateOverrides(b, cr)
+
+	return b.findings
+}
+
+func validateOverrides(b *findingsBuilder, cr *imageregistryv1.Config) {
+	configOverrides, err := overrides.Parse(cr)
+	if err != nil {
+		b.errorf("spec.unsupportedConfigOverrides", "%s", err)
+		return
+	}
+	if _, _, err := configOverrides.Canary(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.rollout.canaryTimeoutSeconds", "%s", err)
+	}
+	if maxUnavailable, maxSurge, err := configOverrides.RollingUpdate(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.rollout", "%s", err)
+	} else if maxUnavailable != nil || maxSurge != nil {
+		validateRollingUpdate(b, &cr.Spec, maxSurge)
+	}
+	if autoscaler, err := configOverrides.Autoscaler(cr.Spec.Replicas); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.autoscaling", "%s", err)
+	} else if autoscaler != nil {
+		switch names := ConfiguredStorages(&cr.Spec.Storage); {
+		case len(names) != 1:
+		case names[0] == "EmptyDir":
+			b.errorf("spec.unsupportedConfigOverrides.autoscaling", "the registry can not be autoscaled, the storage can not be shared by several replicas")
+		case names[0] == "PVC":
+			b.warningf("spec.unsupportedConfigOverrides.autoscaling", "the replicas started by the autoscaler can't mount the claim if it is %s", corev1.ReadWriteOnce)
+		}
+	}
+	if _, _, err := configOverrides.RegistryProbes(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.probes", "%s", err)
+	}
+	if _, err := configOverrides.NodeCAPools(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.nodeCA.pools", "%s", err)
+	}
+	if _, err := configOverrides.NodeCAPodSettings(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.nodeCA", "%s", err)
+	}
+	if _, _, err := configOverrides.AutoRollback(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.rollback.progressDeadlineSeconds", "%s", err)
+	}
+	if _, err := configOverrides.RequestLoggingMode(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.logging.requests.mode", "%s", err)
+	}
+	if _, err := configOverrides.RegistryLogLevel(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.logging.level", "%s", err)
+	}
+	if _, err := configOverrides.RegistryLogFormat(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.logging.format", "%s", err)
+	}
+	if _, err := configOverrides.PullThroughCache(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.cache", "%s", err)
+	}
+	if _, pullRoutes, err := configOverrides.PullEndpoint(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.routing", "%s", err)
+	} else {
+		names := map[string]bool{defaults.RouteName: true}
+		for _, route := range cr.Spec.Routes {
+			names[route.Name] = true
+		}
+		for i, route := range pullRoutes {
+			if names[route.Name] {
+				b.errorf(fmt.Sprintf("spec.unsupportedConfigOverrides.routing.pullRoutes[%d].name", i), "route %q is also a route of the registry", route.Name)
+			}
+		}
+	}
+	if _, err := configOverrides.ServiceIPFamilies(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.network", "%s", err)
+	}
+	if _, err := configOverrides.Gateway(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.routing.gateway", "%s", err)
+	}
+	if _, err := configOverrides.RouteRateLimit(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.routing.rateLimit", "%s", err)
+	}
+	if _, err := configOverrides.BackupPolicy(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.backup", "%s", err)
+	}
+	if _, err := configOverrides.MaintenanceWindow(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.maintenance.window", "%s", err)
+	}
+	if _, _, err := configOverrides.PruneInterlock(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.maintenance.pruneInterlock", "%s", err)
+	}
+	if _, err := configOverrides.HardPrune(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.maintenance.hardPrune", "%s", err)
+	}
+	if _, err := configOverrides.ConsistencyCheck(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.maintenance.consistencyCheck", "%s", err)
+	}
+	if _, err := configOverrides.RecreationPolicy(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.recreation", "%s", err)
+	}
+	if _, err := configOverrides.MeshMode(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.mesh.mode", "%s", err)
+	}
+	if _, err := configOverrides.StorageCredentialsSource(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.credentials", "%s", err)
+	}
+	if _, _, err := configOverrides.StorageRemoval(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.removal", "%s", err)
+	}
+	if _, err := configOverrides.AzureSoftDelete(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.azure.softDelete", "%s", err)
+	}
+	if _, err := configOverrides.S3LifecycleRules(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.s3.lifecycleRules", "%s", err)
+	}
+	if _, err := configOverrides.S3DriftDetection(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.s3.driftDetection", "%s", err)
+	}
+	addressingStyle, err := configOverrides.S3AddressingStyle()
+	if err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.s3.addressingStyle", "%s", err)
+	}
+	if _, _, err := configOverrides.UsagePrune(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.maintenance.usagePrune", "%s", err)
+	}
+	if _, err := configOverrides.StorageBenchmark(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.benchmark", "%s", err)
+	}
+	preset, err := configOverrides.StoragePreset()
+	if err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.preset", "%s", err)
+	} else if preset != "" {
+		if err := s3.ValidatePreset(preset, cr.Spec.Storage.S3, addressingStyle); err != nil {
+			b.errorf("spec.unsupportedConfigOverrides.storage.preset", "%s", err)
+		}
+	}
+	if configOverrides.S3Accelerate() {
+		if err := s3.ValidateAccelerate(cr.Spec.Storage.S3, preset); err != nil {
+			b.errorf("spec.unsupportedConfigOverrides.storage.s3.accelerate", "%s", err)
+		}
+	}
+	if _, err := configOverrides.S3Versioning(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.s3.versioning", "%s", err)
+	}
+	if configOverrides.S3ReachabilityCheck() && cr.Spec.Storage.S3 == nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.s3.checkReachability", "the reachability check requires spec.storage.s3")
+	}
+	if _, err := configOverrides.S3ObjectLockRetention(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.s3.objectLock", "%s", err)
+	}
+	if configOverrides.RGWBucketClaim() != nil {
+		if cr.Spec.Storage.S3 == nil {
+			b.errorf("spec.unsupportedConfigOverrides.storage.rgw", "the bucket claim requires spec.storage.s3")
+		}
+		if source, err := configOverrides.StorageCredentialsSource(); err == nil && source != nil {
+			b.errorf("spec.unsupportedConfigOverrides.storage.rgw", "the bucket claim provides the storage credentials, storage.credentials must not be set")
+		}
+	}
+	if _, _, err := configOverrides.AzureTagSync(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.azure.tagSync", "%s", err)
+	}
+	if _, err := configOverrides.AzureTrustedCAName(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.azure.trustedCA.name", "%s", err)
+	}
+	if _, _, err := configOverrides.GCSLabelSync(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.gcs.labelSync", "%s", err)
+	}
+	if mirror, err := configOverrides.StorageMirror(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.mirror", "%s", err)
+	} else if mirror != nil && storage.Name(mirror) == storage.Name(&cr.Spec.Storage) {
+		b.errorf("spec.unsupportedConfigOverrides.storage.mirror", "the mirror must not be a %s storage like spec.storage", storage.Name(mirror))
+	}
+	if _, _, _, err := configOverrides.PVCHealthProbe(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.storage.pvc.healthProbe", "%s", err)
+	}
+	if _, _, err := configOverrides.StagedChanges(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.staging", "%s", err)
+	}
+	if labels, err := configOverrides.PodSecurityLabels(); err != nil {
+		b.errorf("spec.unsupportedConfigOverrides.podSecurity", "%s", err)
+	} else if labels[defaults.PodSecurityEnforceLabel] != "privileged" {
+		b.warningf("spec.unsupportedConfigOverrides.podSecurity.enforce", "the node-ca pods use the host network and a host path, they are rejected by the %s level", labels[defaults.PodSecurityEnforceLabel])
+	}
+}
+
+// validateRollingUpdate checks the maxUnavailable and maxSurge of the overrides
+// against the rollout strategy and the storage.
+func validateRollingUpdate(b *findingsBuilder, spec *imageregistryv1.ImageRegistrySpec, maxSurge *intstr.IntOrString) {
+	if spec.RolloutStrategy == string(appsapi.RecreateDeploymentStrategyType) {
+		b.errorf("spec.unsupportedConfigOverrides.rollout", "maxUnavailable and maxSurge can not be used with the %s rollout strategy", appsapi.RecreateDeploymentStrategyType)
+		return
+	}
+	if surge, _ := intstr.GetScaledValueFromIntOrPercent(maxSurge, 100, true); surge == 0 {
+		return
+	}
+	switch names := ConfiguredStorages(&spec.Storage); {
+	case len(names) != 1:
+	case names[0] == "EmptyDir":
+		b.errorf("spec.unsupportedConfigOverrides.rollout.maxSurge", "maxSurge must be 0, the storage can not be shared by the old and the new replicas")
+	case names[0] == "PVC":
+		b.warningf("spec.unsupportedConfigOverrides.rollout.maxSurge", "maxSurge is rejected if the claim is %s, the surge replica can't mount it", corev1.ReadWriteOnce)
+	}
+}
+
+func validateStorage(b *findingsBuilder, spec *imageregistryv1.ImageRegistrySpec) {
+	switch spec.Storage.ManagementState {
+	case "", imageregistryv1.StorageManagementStateManaged, imageregistryv1.StorageManagementStateUnmanaged:
+	default:
+		b.errorf("spec.storage.managementState", "unsupported storage management state %q", spec.Storage.ManagementState)
+	}
+
+	names := ConfiguredStorages(&spec.Storage)
+	if len(names) > 1 {
+		b.errorf("spec.storage", "exactly one storage type should be configured at the same time, got %d: %v", len(names), names)
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	switch names[0] {
+	case "PVC":
+		if spec.Replicas > 1 {
+			b.warningf("spec.replicas", "%d replicas are configured with PVC storage, all replicas must be able to mount the claim (ReadWriteMany)", spec.Replicas)
+		}
+		if spec.RolloutStrategy != string(appsapi.RecreateDeploymentStrategyType) {
+			b.warningf("spec.rolloutStrategy", "PVC storage with a ReadWriteOnce claim requires the %s rollout strategy", appsapi.RecreateDeploymentStrategyType)
+		}
+	case "EmptyDir":
+		if spec.Replicas > 1 {
+			b.warningf("spec.replicas", "%d replicas are configured with EmptyDir storage, each replica will have its own ephemeral storage", spec.Replicas)
+		}
+	}
+}
+
+func validateRequests(b *findingsBuilder, field string, limits imageregistryv1.ImageRegistryConfigRequestsLimits) {
+	if limits.MaxRunning < 0 {
+		b.errorf(field+".maxRunning", "must be positive number")
+	}
+	if limits.MaxInQueue < 0 {
+		b.errorf(field+".maxInQueue", "must be positive number")
+	}
+	if limits.MaxWaitInQueue.Duration < 0 {
+		b.errorf(field+".maxWaitInQueue", "must not be negative")
+	}
+}
+
+func validateRoutes(b *findingsBuilder, spec *imageregistryv1.ImageRegistrySpec) {
+	names := map[string]struct{}{
+		defaults.RouteName: {},
+	}
+	for i, route := range spec.Routes {
+		field := fmt.Sprintf("spec.routes[%d]", i)
+		if route.Name == "" {
+			b.errorf(field+".name", "route name must not be empty")
+		} else if _, found := names[route.Name]; found {
+			b.errorf(field+".name", "duplication of names has been detected in the additional routes")
+		}
+		names[route.Name] = struct{}{}
+
+		if route.Hostname != "" {
+			for _, msg := range kvalidation.IsDNS1123Subdomain(route.Hostname) {
+				b.errorf(field+".hostname", "invalid hostname %q: %s", route.Hostname, msg)
+			}
+		} else if route.SecretName != "" {
+			b.warningf(field+".secretName", "a TLS secret is set but the route has no hostname, the generated hostname is unlikely to match the certificate")
+		}
+	}
+}
+
+// ValidateImagePruner checks the image pruner configuration offline.
+func ValidateImagePruner(cr *imageregistryv1.ImagePruner) Findings {
+	b := &findingsBuilder{kind: "ImagePruner", name: cr.Name}
+	spec := &cr.Spec
+
+	if spec.Schedule != "" {
+		if _, err := cron.ParseStandard(spec.Schedule); err != nil {
+			b.errorf("spec.schedule", "invalid schedule %q: %s", spec.Schedule, err)
+		}
+	}
+	if spec.KeepTagRevisions != nil && *spec.KeepTagRevisions < 0 {
+		b.errorf("spec.keepTagRevisions", "must be greater than or equal to 0")
+	}
+	if spec.KeepYoungerThanDuration != nil && spec.KeepYoungerThanDuration.Duration < 0 {
+		b.errorf("spec.keepYoungerThanDuration", "must not be negative")
+	}
+	if spec.SuccessfulJobsHistoryLimit != nil && *spec.SuccessfulJobsHistoryLimit < 0 {
+		b.errorf("spec.successfulJobsHistoryLimit", "must be greater than or equal to 0")
+	}
+	if spec.FailedJobsHistoryLimit != nil && *spec.FailedJobsHistoryLimit < 0 {
+		b.errorf("spec.failedJobsHistoryLimit", "must be greater than or equal to 0")
+	}
+
+	return b.findings
+}
+
+// ValidateManifests decodes every YAML or JSON document from r and validates
+// the Config and ImagePruner objects found. Unknown fields are reported as
+// errors, documents of other kinds are reported as warnings and skipped.
+func ValidateManifests(r io.Reader) (Findings, error) {
+	var findings Findings
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return findings, nil
+		} else if err != nil {
+			return findings, fmt.Errorf("unable to read document: %w", err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		findings = append(findings, validateDocument(doc)...)
+	}
+}
+
+func validateDocument(doc []byte) Findings {
+	var meta struct {
+		metav1.TypeMeta   `json:",inline"`
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}
+	if err := yaml.Unmarshal(doc, &meta); err != nil {
+		return Findings{{Severity: SeverityError, Message: fmt.Sprintf("unable to decode document: %s", err)}}
+	}
+
+	if meta.APIVersion != imageregistryv1.GroupVersion.String() {
+		return Findings{{
+			Kind:     meta.Kind,
+			Name:     meta.Name,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("skipping object with apiVersion %q", meta.APIVersion),
+		}}
+	}
+
+	switch meta.Kind {
+	case "Config":
+		cr := &imageregistryv1.Config{}
+		if err := yaml.UnmarshalStrict(doc, cr); err != nil {
+			return Findings{{Kind: meta.Kind, Name: meta.Name, Severity: SeverityError, Message: err.Error()}}
+		}
+		findings := ValidateConfig(cr)
+		if cr.Name != defaults.ImageRegistryResourceName {
+			findings = append(findings, Finding{
+				Kind:     meta.Kind,
+				Name:     meta.Name,
+				Field:    "metadata.name",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("the operator only reconciles the object named %q", defaults.ImageRegistryResourceName),
+			})
+		}
+		return findings
+	case "ImagePruner":
+		cr := &imageregistryv1.ImagePruner{}
+		if err := yaml.UnmarshalStrict(doc, cr); err != nil {
+			return Findings{{Kind: meta.Kind, Name: meta.Name, Severity: SeverityError, Message: err.Error()}}
+		}
+		findings := ValidateImagePruner(cr)
+		if cr.Name != defaults.ImageRegistryImagePrunerResourceName {
+			findings = append(findings, Finding{
+				Kind:     meta.Kind,
+				Name:     meta.Name,
+				Field:    "metadata.name",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("the operator only reconciles the object named %q", defaults.ImageRegistryImagePrunerResourceName),
+			})
+		}
+		return findings
+	}
+
+	return Findings{{
+		Kind:     meta.Kind,
+		Name:     meta.Name,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("skipping unsupported kind %q", meta.Kind),
+	}}
+}
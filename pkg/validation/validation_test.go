@@ -0,0 +1,815 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestValidateConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		spec     imageregistryv1.ImageRegistrySpec
+		errors   []string
+		warnings []string
+	}{
+		{
+			name: "valid",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 2,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					S3: &imageregistryv1.ImageRegistryConfigStorageS3{},
+				},
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "public", Hostname: "registry.apps.example.com"},
+				},
+			},
+		},
+		{
+			name: "negative replicas",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: -1,
+			},
+			errors: []string{"spec.replicas"},
+		},
+		{
+			name: "multiple storages",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					S3:       &imageregistryv1.ImageRegistryConfigStorageS3{},
+					EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+				},
+			},
+			errors: []string{"spec.storage"},
+		},
+		{
+			name: "pvc with rolling update and replicas",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas:        2,
+				RolloutStrategy: "RollingUpdate",
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{},
+				},
+			},
+			warnings: []string{"spec.replicas", "spec.rolloutStrategy"},
+		},
+		{
+			name: "unknown rollout strategy",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas:        1,
+				RolloutStrategy: "BlueGreen",
+			},
+			errors: []string{"spec.rolloutStrategy"},
+		},
+		{
+			name: "invalid routes",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "default-route"},
+					{Name: "public", Hostname: "Not_A_Host"},
+					{Name: "tls", SecretName: "tls"},
+				},
+			},
+			errors:   []string{"spec.routes[0].name", "spec.routes[1].hostname"},
+			warnings: []string{"spec.routes[2].secretName"},
+		},
+		{
+			name: "negative request limits",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Requests: imageregistryv1.ImageRegistryConfigRequests{
+					Write: imageregistryv1.ImageRegistryConfigRequestsLimits{
+						MaxRunning: -1,
+					},
+				},
+			},
+			errors: []string{"spec.requests.write.maxRunning"},
+		},
+		{
+			name: "invalid maintenance window",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"maintenance":{"window":{"days":["Caturday"],"startHour":2,"endHour":4}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.maintenance.window"},
+		},
+		{
+			name: "mesh compatible mode without sidecar",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"mesh":{"mode":"Compatible"},"deployment":{"annotations":{"sidecar.istio.io/inject":"false"}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.mesh.mode"},
+		},
+		{
+			name: "storage removal chunk larger than a delete request",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"removal":{"chunkSize":5000}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.removal"},
+		},
+		{
+			name: "storage removal with the default chunk size",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"removal":{"chunkSize":0,"objectsPerSecond":200}}}`),
+					},
+				},
+			},
+		},
+		{
+			name: "azure soft delete retention out of range",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"azure":{"softDelete":{"blobRetentionDays":7,"containerRetentionDays":400}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.azure.softDelete"},
+		},
+		{
+			name: "azure trusted CA without a name",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"azure":{"trustedCA":{}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.azure.trustedCA.name"},
+		},
+		{
+			name: "s3 lifecycle rule to an archive class",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"lifecycleRules":[{"storageClass":"STANDARD_IA","days":30},{"storageClass":"GLACIER","days":90}]}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.lifecycleRules"},
+		},
+		{
+			name: "s3 drift detection interval too short",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"driftDetection":{"enabled":true,"intervalSeconds":120}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.driftDetection"},
+		},
+		{
+			name: "unknown s3 addressing style",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"addressingStyle":"Subdomain"}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.addressingStyle"},
+		},
+		{
+			name: "negative s3 noncurrent version expiration",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"versioning":{"enabled":true,"noncurrentVersionExpirationDays":-1}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.versioning"},
+		},
+		{
+			name: "object lock retention too long",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"objectLock":{"enabled":true,"retentionDays":40000}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.objectLock"},
+		},
+		{
+			name: "reachability check without S3",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"checkReachability":true}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.checkReachability"},
+		},
+		{
+			name: "prune interlock deferral too long",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"maintenance":{"pruneInterlock":{"enabled":true,"maxDeferralSeconds":172800}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.maintenance.pruneInterlock"},
+		},
+		{
+			name: "hard prune with an invalid schedule",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"maintenance":{"hardPrune":{"enabled":true,"schedule":"every sunday"}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.maintenance.hardPrune"},
+		},
+		{
+			name: "invalid consistency check schedule",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"maintenance":{"consistencyCheck":{"enabled":true,"schedule":"daily"}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.maintenance.consistencyCheck"},
+		},
+		{
+			name: "single stack with two IP families",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"network":{"ipFamilyPolicy":"SingleStack","ipFamilies":["IPv6","IPv4"]}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.network"},
+		},
+		{
+			name: "gateway without hostnames",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"routing":{"gateway":{"parentRefs":[{"name":"public","namespace":"openshift-ingress"}]}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.routing.gateway"},
+		},
+		{
+			name: "negative rate limit",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"routing":{"rateLimit":{"requestsPerSecondPerClient":-1}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.routing.rateLimit"},
+		},
+		{
+			name: "invalid log level and format",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"logging":{"level":"trace","format":"logstash"}}`),
+					},
+				},
+			},
+			errors: []string{
+				"spec.unsupportedConfigOverrides.logging.level",
+				"spec.unsupportedConfigOverrides.logging.format",
+			},
+		},
+		{
+			name: "pull-through cache without a scheme",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"cache":{"remoteURL":"registry.example.com"}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.cache"},
+		},
+		{
+			name: "transfer acceleration with a bucket name with periods",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+						Bucket: "registry.example.com",
+						Region: "us-east-1",
+					},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"s3":{"accelerate":true}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.s3.accelerate"},
+		},
+		{
+			name: "autoscaling with emptyDir",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"autoscaling":{"maxReplicas":4}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.autoscaling"},
+		},
+		{
+			name: "autoscaling below the minimum",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 2,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"autoscaling":{"minReplicas":3,"maxReplicas":2}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.autoscaling"},
+		},
+		{
+			name: "probe timeout out of bounds",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"probes":{"liveness":{"timeoutSeconds":120}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.probes"},
+		},
+		{
+			name: "probe timeout longer than the period",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"probes":{"readiness":{"timeoutSeconds":20,"periodSeconds":15}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.probes"},
+		},
+		{
+			name: "node-ca pool with several labels",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"nodeCA":{"pools":[{"name":"edge","nodeSelector":{"node-role.kubernetes.io/edge":"","zone":"a"},"trustedCA":"edge-registries"}]}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.nodeCA.pools"},
+		},
+		{
+			name: "node-ca pools with the same selector",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"nodeCA":{"pools":[{"name":"edge","nodeSelector":{"node-role.kubernetes.io/edge":""},"trustedCA":"edge-registries"},{"name":"store","nodeSelector":{"node-role.kubernetes.io/edge":""},"trustedCA":"store-registries"}]}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.nodeCA.pools"},
+		},
+		{
+			name: "node-ca request greater than the limit",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"nodeCA":{"resources":{"requests":{"memory":"64Mi"},"limits":{"memory":"32Mi"}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.nodeCA"},
+		},
+		{
+			name: "node-ca toleration seconds without NoExecute",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"nodeCA":{"tolerations":[{"key":"edge","operator":"Exists","effect":"NoSchedule","tolerationSeconds":60}]}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.nodeCA"},
+		},
+		{
+			name: "usage prune without quota",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"maintenance":{"usagePrune":{"enabled":true,"thresholdPercent":80}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.maintenance.usagePrune"},
+		},
+		{
+			name: "storage benchmark blobs too large",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"benchmark":{"blobSizeMiB":4096}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.benchmark"},
+		},
+		{
+			name: "too many recreations per hour",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"recreation":{"maxPerHour":120}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.recreation"},
+		},
+		{
+			name: "storage preset without tls",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+						Bucket:         "registry",
+						RegionEndpoint: "http://storagegrid.example.com:8082",
+					},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"preset":"NetAppStorageGRID"}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.preset"},
+		},
+		{
+			name: "azure tag sync interval too short",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"azure":{"tagSync":{"enabled":true,"intervalSeconds":60}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.azure.tagSync"},
+		},
+		{
+			name: "invalid rollout, logging and backup overrides",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"rollout":{"canary":true,"canaryTimeoutSeconds":-1},"rollback":{"enabled":true,"progressDeadlineSeconds":-1},"logging":{"requests":{"mode":"Sampled"}},"backup":{"policy":"Snapshot"}}`),
+					},
+				},
+			},
+			errors: []string{
+				"spec.unsupportedConfigOverrides.rollout.canaryTimeoutSeconds",
+				"spec.unsupportedConfigOverrides.rollback.progressDeadlineSeconds",
+				"spec.unsupportedConfigOverrides.logging.requests.mode",
+				"spec.unsupportedConfigOverrides.backup",
+			},
+		},
+		{
+			name: "rolling update overrides with the recreate strategy",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas:        1,
+				RolloutStrategy: "Recreate",
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"rollout":{"maxSurge":1}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.rollout"},
+		},
+		{
+			name: "rolling update overrides that can not make progress",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"rollout":{"maxUnavailable":0,"maxSurge":"0%"}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.rollout"},
+		},
+		{
+			name: "surge with emptydir storage",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"rollout":{"maxUnavailable":"50%","maxSurge":"25%"}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.rollout.maxSurge"},
+		},
+		{
+			name: "rgw bucket claim without s3 storage",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					Swift: &imageregistryv1.ImageRegistryConfigStorageSwift{Container: "registry"},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"rgw":{"enabled":true}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.rgw"},
+		},
+		{
+			name: "staged changes expiring too early",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"staging":{"enabled":true,"expirySeconds":60}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.staging"},
+		},
+		{
+			name: "gcs label sync too frequent",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"gcs":{"labelSync":{"enabled":true,"intervalSeconds":60}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.gcs.labelSync"},
+		},
+		{
+			name: "pvc health probe timeout too long",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"pvc":{"healthProbe":{"enabled":true,"timeoutSeconds":3600}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.pvc.healthProbe"},
+		},
+		{
+			name: "storage mirror of the same type",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Storage: imageregistryv1.ImageRegistryConfigStorage{
+					S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry"},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"mirror":{"s3":{"bucket":"registry-dr"}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.mirror"},
+		},
+		{
+			name: "storage mirror without a container",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"storage":{"mirror":{"azure":{"accountName":"registrydr"}}}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.storage.mirror"},
+		},
+		{
+			name: "pull route with the name of a registry route",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "registry"},
+				},
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"routing":{"splitPullEndpoint":true,"pullRoutes":[{"name":"registry"}]}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.routing.pullRoutes[0].name"},
+		},
+		{
+			name: "unsupported pod security level",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"podSecurity":{"audit":"strict"}}`),
+					},
+				},
+			},
+			errors: []string{"spec.unsupportedConfigOverrides.podSecurity"},
+		},
+		{
+			name: "restricted pod security enforced",
+			spec: imageregistryv1.ImageRegistrySpec{
+				Replicas: 1,
+				OperatorSpec: operatorv1.OperatorSpec{
+					UnsupportedConfigOverrides: runtime.RawExtension{
+						Raw: []byte(`{"podSecurity":{"enforce":"restricted"}}`),
+					},
+				},
+			},
+			warnings: []string{"spec.unsupportedConfigOverrides.podSecurity.enforce"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := ValidateConfig(&imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+				Spec:       tt.spec,
+			})
+
+			var errors, warnings []string
+			for _, f := range findings {
+				switch f.Severity {
+				case SeverityError:
+					errors = append(errors, f.Field)
+				case SeverityWarning:
+					warnings = append(warnings, f.Field)
+				}
+			}
+			if strings.Join(errors, ",") != strings.Join(tt.errors, ",") {
+				t.Errorf("expected errors for %v, got %v", tt.errors, findings)
+			}
+			if strings.Join(warnings, ",") != strings.Join(tt.warnings, ",") {
+				t.Errorf("expected warnings for %v, got %v", tt.warnings, findings)
+			}
+			if findings.HasErrors() != (findings.Err() != nil) {
+				t.Errorf("HasErrors and Err disagree for %v", findings)
+			}
+		})
+	}
+}
+
+func TestValidateImagePruner(t *testing.T) {
+	findings := ValidateImagePruner(&imageregistryv1.ImagePruner{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Spec: imageregistryv1.ImagePrunerSpec{
+			Schedule:         "every day",
+			KeepTagRevisions: ptr.To(-1),
+		},
+	})
+	if len(findings) != 2 || !findings.HasErrors() {
+		t.Fatalf("expected two errors, got %v", findings)
+	}
+	if findings[0].Field != "spec.schedule" || findings[1].Field != "spec.keepTagRevisions" {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+}
+
+func TestValidateManifests(t *testing.T) {
+	manifests := `apiVersion: imageregistry.operator.openshift.io/v1
+kind: Config
+metadata:
+  name: cluster
+spec:
+  replicas: 2
+  storage:
+    s3:
+      bucket: registry
+---
+apiVersion: imageregistry.operator.openshift.io/v1
+kind: ImagePruner
+metadata:
+  name: cluster
+spec:
+  schedule: "0 0 * * *"
+  unknownField: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+`
+
+	findings, err := ValidateManifests(strings.NewReader(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("expected two findings, got %v", findings)
+	}
+	if findings[0].Kind != "ImagePruner" || findings[0].Severity != SeverityError || !strings.Contains(findings[0].Message, "unknownField") {
+		t.Errorf("expected unknown field error for the image pruner, got %v", findings[0])
+	}
+	if findings[1].Kind != "ConfigMap" || findings[1].Severity != SeverityWarning {
+		t.Errorf("expected the config map to be skipped, got %v", findings[1])
+	}
+}
+
+func TestFindingsSARIF(t *testing.T) {
+	findings := Findings{
+		{Kind: "Config", Name: "cluster", Field: "spec.replicas", Severity: SeverityError, Message: "replicas must be greater than or equal to 0", File: "config.yaml"},
+		{Kind: "ImagePruner", Name: "cluster", Severity: SeverityWarning, Message: "pruning is suspended"},
+	}
+
+	log := findings.SARIF("v1.0.0")
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("expected a SARIF 2.1.0 log with one run, got %+v", log)
+	}
+	if version := log.Runs[0].Tool.Driver.Version; version != "v1.0.0" {
+		t.Errorf("expected tool version v1.0.0, got %q", version)
+	}
+
+	results := log.Runs[0].Results
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	if results[0].RuleID != "Config/spec.replicas" || results[0].Level != "error" {
+		t.Errorf("unexpected result for the error finding: %+v", results[0])
+	}
+	if loc := results[0].Locations[0]; loc.PhysicalLocation == nil || loc.PhysicalLocation.ArtifactLocation.URI != "config.yaml" {
+		t.Errorf("expected the error finding to be located in config.yaml, got %+v", loc)
+	}
+	if name := results[0].Locations[0].LogicalLocations[0].FullyQualifiedName; name != "Config/cluster.spec.replicas" {
+		t.Errorf("unexpected logical location %q", name)
+	}
+
+	if results[1].RuleID != "ImagePruner" || results[1].Level != "warning" {
+		t.Errorf("unexpected result for the warning finding: %+v", results[1])
+	}
+	if loc := results[1].Locations[0]; loc.PhysicalLocation != nil {
+		t.Errorf("expected no physical location for the warning finding, got %+v", loc.PhysicalLocation)
+	}
+}
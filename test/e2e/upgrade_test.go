@@ -0,0 +1,81 @@
+package e2e
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/test/framework"
+)
+
+type conditionSummary struct {
+	Status string
+	Reason string
+}
+
+func summarizeConditions(te framework.TestEnv) map[string]conditionSummary {
+	cr, err := te.Client().Configs().Get(
+		context.Background(), defaults.ImageRegistryResourceName, metav1.GetOptions{},
+	)
+	if err != nil {
+		te.Fatalf("unable to get the image registry resource: %s", err)
+	}
+	conds := map[string]conditionSummary{}
+	for _, cond := range cr.Status.Conditions {
+		conds[cond.Type] = conditionSummary{Status: string(cond.Status), Reason: cond.Reason}
+	}
+	return conds
+}
+
+// TestStorageConfigPersistsAcrossOperatorUpgrade re-deploys the operator at
+// a newer image and checks that the new operator neither re-defaults the
+// storage configuration nor rolls out the registry again. In OpenShift CI the
+// operator is restarted with the image built for the job.
+func TestStorageConfigPersistsAcrossOperatorUpgrade(t *testing.T) {
+	image := framework.UpgradeOperatorImage()
+	if image == "" && framework.RunningInCI() {
+		t.Fatalf("neither %s nor IMAGE_FORMAT is set", framework.UpgradeOperatorImageEnv)
+	} else if image == "" {
+		t.Skipf("skipping because %s is not set", framework.UpgradeOperatorImageEnv)
+	}
+
+	te := framework.SetupAvailableImageRegistry(t, nil)
+	defer framework.TeardownImageRegistry(te)
+
+	before := framework.WaitUntilImageRegistryConfigIsProcessed(te)
+	beforeConds := summarizeConditions(te)
+	beforeDeployment := framework.GetImageRegistryDeployment(te)
+
+	previousImage := framework.GetOperatorImage(te)
+	defer framework.SetOperatorImage(te, previousImage)
+	framework.SetOperatorImage(te, image)
+
+	framework.WaitUntilImageRegistryIsAvailable(te)
+	framework.EnsureOperatorIsNotHotLooping(te)
+
+	after := framework.WaitUntilImageRegistryConfigIsProcessed(te)
+	if after.Generation != before.Generation {
+		t.Errorf("the image registry resource was updated by the new operator: generation %d, want %d", after.Generation, before.Generation)
+	}
+	if !reflect.DeepEqual(after.Spec.Storage, before.Spec.Storage) {
+		t.Errorf("spec.storage changed after the upgrade:\nbefore: %#v\nafter: %#v", before.Spec.Storage, after.Spec.Storage)
+	}
+	if !reflect.DeepEqual(after.Status.Storage, before.Status.Storage) {
+		t.Errorf("status.storage changed after the upgrade:\nbefore: %#v\nafter: %#v", before.Status.Storage, after.Status.Storage)
+	}
+	if afterConds := summarizeConditions(te); !reflect.DeepEqual(afterConds, beforeConds) {
+		t.Errorf("conditions changed after the upgrade:\nbefore: %#v\nafter: %#v", beforeConds, afterConds)
+	}
+
+	afterDeployment := framework.GetImageRegistryDeployment(te)
+	if afterDeployment.Generation != beforeDeployment.Generation {
+		t.Errorf("the registry deployment was rolled out by the new operator: generation %d, want %d", afterDeployment.Generation, beforeDeployment.Generation)
+	}
+	framework.CheckEnvVars(te, beforeDeployment.Spec.Template.Spec.Containers[0].Env, afterDeployment.Spec.Template.Spec.Containers[0].Env, false)
+	if len(afterDeployment.Spec.Template.Spec.Containers[0].Env) != len(beforeDeployment.Spec.Template.Spec.Containers[0].Env) {
+		t.Errorf("the registry environment changed after the upgrade:\nbefore: %#v\nafter: %#v", beforeDeployment.Spec.Template.Spec.Containers[0].Env, afterDeployment.Spec.Template.Spec.Containers[0].Env)
+	}
+}
@@ -0,0 +1,68 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// UpgradeOperatorImageEnv is the environment variable with the operator
+// image that the upgrade tests deploy over the running operator.
+const UpgradeOperatorImageEnv = "UPGRADE_OPERATOR_IMAGE"
+
+// UpgradeOperatorImage returns the image of the newer operator, or an empty
+// string if the upgrade tests are not configured. In OpenShift CI, where
+// UPGRADE_OPERATOR_IMAGE is not set, it is the operator image built for the
+// job, which ci-operator exposes through IMAGE_FORMAT.
+func UpgradeOperatorImage() string {
+	if image := os.Getenv(UpgradeOperatorImageEnv); image != "" {
+		return image
+	}
+	if format := os.Getenv("IMAGE_FORMAT"); format != "" {
+		return strings.ReplaceAll(format, "${component}", "cluster-image-registry-operator")
+	}
+	return ""
+}
+
+// RunningInCI returns true if the tests are run by OpenShift CI, where tests
+// must not be skipped for a missing configuration.
+func RunningInCI() bool {
+	return os.Getenv("OPENSHIFT_CI") == "true"
+}
+
+// GetOperatorImage returns the image of the running operator.
+func GetOperatorImage(te TestEnv) string {
+	deployment, err := te.Client().Deployments(OperatorDeploymentNamespace).Get(
+		context.Background(), OperatorDeploymentName, metav1.GetOptions{},
+	)
+	if err != nil {
+		te.Fatalf("unable to get the operator deployment: %s", err)
+	}
+	return deployment.Spec.Template.Spec.Containers[0].Image
+}
+
+// SetOperatorImage re-deploys the operator with the given image and waits
+// until the new operator is rolled out. It simulates an upgrade of the
+// operator. The operator is restarted even if it already runs the image.
+func SetOperatorImage(te TestEnv, image string) {
+	te.Logf("deploying the operator image %s...", image)
+	patch := fmt.Sprintf(
+		`{"spec": {"template": {"metadata": {"annotations": {"kubectl.kubernetes.io/restartedAt": %q}}, "spec": {"containers": [{"name": %q, "image": %q}]}}}}`,
+		time.Now().Format(time.RFC3339), OperatorDeploymentName, image,
+	)
+	if _, err := te.Client().Deployments(OperatorDeploymentNamespace).Patch(
+		context.Background(),
+		OperatorDeploymentName,
+		types.StrategicMergePatchType, []byte(patch),
+		metav1.PatchOptions{},
+	); err != nil {
+		te.Fatalf("unable to set the operator image: %s", err)
+	}
+
+	WaitUntilDeploymentIsRolledOut(te, OperatorDeploymentNamespace, OperatorDeploymentName)
+}